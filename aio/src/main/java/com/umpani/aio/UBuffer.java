@@ -0,0 +1,261 @@
+package com.umpani.aio;
+
+import java.nio.ByteBuffer;
+import java.util.concurrent.atomic.AtomicIntegerFieldUpdater;
+
+import com.umpani.aio.exception.UIllegalReferenceCountException;
+
+/**
+ * A reference counted {@link ByteBuffer}, normally allocated from a {@link UBufferPool}. Once the reference count
+ * drops to zero, the memory is returned to the pool and the buffer must no longer be used. The position and limit of
+ * the underlying buffer, available via {@link #nio()}, are used as usual: after the allocation the position is zero
+ * and the limit is the requested size.
+ *
+ * </p><p>A slice shares the memory of the buffer it was created from and keeps it alive until the slice is released.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UBuffer implements UReferenceCounted {
+	/**
+	 * The updater of the reference count.
+	 */
+	private static final AtomicIntegerFieldUpdater<UBuffer> REF_CNT = AtomicIntegerFieldUpdater.newUpdater(UBuffer.class, "refCnt");
+
+	/**
+	 * Create a new pooled buffer.
+	 * @param pool
+	 * the pool that owns the memory or null, if the buffer is not pooled.
+	 * @param buffer
+	 * the memory.
+	 * @param sizeClass
+	 * the size class of the memory or a negative value, if the memory is not pooled.
+	 */
+	UBuffer( final UBufferPool pool, final ByteBuffer buffer, final int sizeClass ) {
+		this.pool = pool;
+		this.buffer = buffer;
+		this.sizeClass = sizeClass;
+		this.root = null;
+	}
+
+	/**
+	 * Create a new slice of the given root buffer, the root must already be retained.
+	 */
+	private UBuffer( final UBuffer root, final ByteBuffer view ) {
+		this.pool = null;
+		this.buffer = view;
+		this.sizeClass = -1;
+		this.root = root;
+	}
+
+	/**
+	 * The pool that owns the memory.
+	 */
+	private final UBufferPool pool;
+
+	/**
+	 * The memory.
+	 */
+	private final ByteBuffer buffer;
+
+	/**
+	 * The size class of the memory.
+	 */
+	private final int sizeClass;
+
+	/**
+	 * The buffer whose memory this slice shares or null.
+	 */
+	private final UBuffer root;
+
+	/**
+	 * The leak record, if the buffer is tracked.
+	 */
+	UBufferPool.Leak leak;
+
+	/**
+	 * The reference count.
+	 */
+	private volatile int refCnt = 1;
+
+	/**
+	 * Returns an unpooled buffer that wraps the given byte buffer, releasing it has no effect on the memory.
+	 * @param buffer
+	 * the byte buffer to wrap.
+	 * @return
+	 * the buffer.
+	 */
+	public static UBuffer wrap( final ByteBuffer buffer ) {
+		return new UBuffer(null, buffer, -1);
+	}
+
+	/**
+	 * Returns an unpooled heap buffer that wraps the given bytes.
+	 * @param bytes
+	 * the bytes to wrap.
+	 * @return
+	 * the buffer.
+	 */
+	public static UBuffer wrap( final byte[] bytes ) {
+		return wrap(ByteBuffer.wrap(bytes));
+	}
+
+	/**
+	 * Returns the underlying byte buffer.
+	 * @return
+	 * the underlying byte buffer.
+	 * @throws UIllegalReferenceCountException
+	 * if the buffer was already released.
+	 */
+	public final ByteBuffer nio() {
+		final int refCnt = this.refCnt;
+		if (refCnt <= 0) throw new UIllegalReferenceCountException(refCnt, 0);
+		return buffer;
+	}
+
+	/**
+	 * Returns the capacity of the underlying byte buffer, which may be bigger than the requested size.
+	 * @return
+	 * the capacity.
+	 */
+	public final int capacity() {
+		return buffer.capacity();
+	}
+
+	/**
+	 * Returns the amount of bytes between the position and the limit of the underlying byte buffer.
+	 * @return
+	 * the amount of remaining bytes.
+	 */
+	public final int remaining() {
+		return buffer.remaining();
+	}
+
+	/**
+	 * Returns true if the underlying byte buffer is direct.
+	 * @return
+	 * true if the underlying byte buffer is direct.
+	 */
+	public final boolean isDirect() {
+		return buffer.isDirect();
+	}
+
+	/**
+	 * Returns true if this buffer is a slice of another buffer.
+	 * @return
+	 * true if this buffer is a slice of another buffer.
+	 */
+	public final boolean isSlice() {
+		return root!=null;
+	}
+
+	@Override
+	public final int refCnt() {
+		return refCnt;
+	}
+
+	@Override
+	public final UBuffer retain() {
+		return retain(1);
+	}
+
+	/**
+	 * Increments the reference count.
+	 * @param increment
+	 * the amount by which to increment, must be greater than zero.
+	 * @return
+	 * this.
+	 * @throws UIllegalReferenceCountException
+	 * if the buffer was already freed or the count would overflow.
+	 */
+	public final UBuffer retain( final int increment ) {
+		if (increment <= 0) throw new IllegalArgumentException("increment: "+increment);
+		for (;;) {
+			final int refCnt = this.refCnt;
+			final int next = refCnt + increment;
+			if (refCnt <= 0 || next < refCnt) throw new UIllegalReferenceCountException(refCnt, increment);
+			if (REF_CNT.compareAndSet(this, refCnt, next)) return this;
+		}
+	}
+
+	@Override
+	public final boolean release() {
+		return release(1);
+	}
+
+	/**
+	 * Decrements the reference count and frees the memory, if the count dropped to zero.
+	 * @param decrement
+	 * the amount by which to decrement, must be greater than zero.
+	 * @return
+	 * true if the count dropped to zero.
+	 * @throws UIllegalReferenceCountException
+	 * if the count is less than the decrement.
+	 */
+	public final boolean release( final int decrement ) {
+		if (decrement <= 0) throw new IllegalArgumentException("decrement: "+decrement);
+		for (;;) {
+			final int refCnt = this.refCnt;
+			if (refCnt < decrement) throw new UIllegalReferenceCountException(refCnt, -decrement);
+			if (REF_CNT.compareAndSet(this, refCnt, refCnt - decrement)) {
+				if (refCnt==decrement) {
+					deallocate();
+					return true;
+				}
+				return false;
+			}
+		}
+	}
+
+	/**
+	 * Frees the memory.
+	 */
+	private void deallocate() {
+		if (root!=null) {
+			root.release();
+		} else
+		if (pool!=null) {
+			pool.free(buffer, sizeClass, leak);
+		}
+	}
+
+	/**
+	 * Returns a new slice of the bytes between the position and the limit, the slice shares the memory and retains
+	 * this buffer until the slice is released.
+	 * @return
+	 * the slice.
+	 */
+	public final UBuffer retainedSlice() {
+		final ByteBuffer buffer = nio();
+		return retainedSlice(buffer.position(), buffer.remaining());
+	}
+
+	/**
+	 * Returns a new slice of the given region, the slice shares the memory and retains this buffer until the slice is
+	 * released.
+	 * @param index
+	 * the absolute index of the first byte.
+	 * @param length
+	 * the amount of bytes.
+	 * @return
+	 * the slice.
+	 * @throws IndexOutOfBoundsException
+	 * if the region is outside of the capacity.
+	 */
+	public final UBuffer retainedSlice( final int index, final int length ) {
+		final ByteBuffer buffer = nio();
+		if (index < 0 || length < 0 || index + length > buffer.capacity()) {
+			throw new IndexOutOfBoundsException("index: "+index+", length: "+length+", capacity: "+buffer.capacity());
+		}
+		final ByteBuffer view = buffer.duplicate();
+		view.limit(index + length);
+		view.position(index);
+		final UBuffer root = this.root!=null ? this.root : this;
+		root.retain();
+		return new UBuffer(root, view.slice());
+	}
+
+	@Override
+	public String toString() {
+		return "UBuffer[pos="+buffer.position()+", lim="+buffer.limit()+", cap="+buffer.capacity()+", refCnt="+refCnt+"]";
+	}
+}
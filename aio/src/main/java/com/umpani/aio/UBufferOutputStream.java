@@ -0,0 +1,248 @@
+package com.umpani.aio;
+
+import java.io.OutputStream;
+import java.nio.ByteBuffer;
+
+/**
+ * An output stream that writes into buffers allocated from a {@link UBufferPool}. The first buffer is small, every
+ * further buffer doubles in size up to a maximum, so that small messages do not waste memory and large messages do
+ * not need too many buffers. Once written, the bytes are taken as {@link UCompositeBuffer} with
+ * {@link #toBuffer()}, closing the stream releases all bytes not taken.
+ *
+ * </p><p>The stream is as well an {@link Appendable} that encodes characters as UTF-8, so that text serializers like
+ * the {@link com.umpani.util.json.UJsonWriter} can write directly into pooled buffers. Unpaired surrogates are
+ * encoded as question mark, like {@link String#getBytes(java.nio.charset.Charset)} does.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UBufferOutputStream extends OutputStream implements Appendable {
+	/**
+	 * The default size of the first buffer.
+	 */
+	public static final int DEFAULT_INITIAL_SIZE = 256;
+
+	/**
+	 * The default maximal size of a buffer.
+	 */
+	public static final int DEFAULT_MAX_CHUNK_SIZE = 16384;
+
+	/**
+	 * Create a new output stream with default buffer sizes.
+	 * @param pool
+	 * the pool to allocate buffers from.
+	 */
+	public UBufferOutputStream( final UBufferPool pool ) {
+		this(pool, DEFAULT_INITIAL_SIZE, DEFAULT_MAX_CHUNK_SIZE);
+	}
+
+	/**
+	 * Create a new output stream.
+	 * @param pool
+	 * the pool to allocate buffers from.
+	 * @param initialSize
+	 * the size of the first buffer.
+	 * @param maxChunkSize
+	 * the maximal size of a buffer.
+	 */
+	public UBufferOutputStream( final UBufferPool pool, final int initialSize, final int maxChunkSize ) {
+		if (initialSize <= 0 || maxChunkSize < initialSize) throw new IllegalArgumentException("initialSize: "+initialSize+", maxChunkSize: "+maxChunkSize);
+		this.pool = pool;
+		this.nextSize = initialSize;
+		this.maxChunkSize = maxChunkSize;
+	}
+
+	/**
+	 * The pool.
+	 */
+	private final UBufferPool pool;
+
+	/**
+	 * The maximal size of a buffer.
+	 */
+	private final int maxChunkSize;
+
+	/**
+	 * The size of the next buffer.
+	 */
+	private int nextSize;
+
+	/**
+	 * The completely written buffers.
+	 */
+	private UCompositeBuffer written = new UCompositeBuffer();
+
+	/**
+	 * The buffer currently written or null.
+	 */
+	private UBuffer current;
+
+	/**
+	 * The amount of written bytes.
+	 */
+	private int size;
+
+	/**
+	 * A high surrogate waiting for its low surrogate or zero.
+	 */
+	private char highSurrogate;
+
+	/**
+	 * Returns the amount of bytes written since the last call of {@link #toBuffer()}.
+	 * @return
+	 * the amount of bytes.
+	 */
+	public int size() {
+		return size;
+	}
+
+	/**
+	 * Returns the buffer to write to, allocating a new one if the current one is full.
+	 */
+	private ByteBuffer current() {
+		if (current!=null) {
+			final ByteBuffer buffer = current.nio();
+			if (buffer.hasRemaining()) return buffer;
+			buffer.flip();
+			written.add(current);
+		}
+		current = pool.allocate(nextSize);
+		if (nextSize < maxChunkSize) nextSize = Math.min(nextSize << 1, maxChunkSize);
+		return current.nio();
+	}
+
+	@Override
+	public void write( final int b ) {
+		current().put((byte)b);
+		size++;
+	}
+
+	@Override
+	public void write( final byte[] b, int off, int len ) {
+		if (off < 0 || len < 0 || off + len > b.length) throw new IndexOutOfBoundsException();
+		size += len;
+		while (len > 0) {
+			final ByteBuffer buffer = current();
+			final int n = Math.min(len, buffer.remaining());
+			buffer.put(b, off, n);
+			off += n;
+			len -= n;
+		}
+	}
+
+	/**
+	 * Writes the remaining bytes of the given buffer.
+	 * @param src
+	 * the bytes to write.
+	 */
+	public void write( final ByteBuffer src ) {
+		size += src.remaining();
+		while (src.hasRemaining()) {
+			final ByteBuffer buffer = current();
+			final int n = Math.min(src.remaining(), buffer.remaining());
+			final ByteBuffer part = src.duplicate();
+			part.limit(part.position() + n);
+			buffer.put(part);
+			src.position(src.position() + n);
+		}
+	}
+
+	@Override
+	public UBufferOutputStream append( final CharSequence csq ) {
+		return csq==null ? append("null", 0, 4) : append(csq, 0, csq.length());
+	}
+
+	@Override
+	public UBufferOutputStream append( final CharSequence csq, final int start, final int end ) {
+		if (csq==null) return append("null", start, end);
+		for (int i=start; i < end; i++) {
+			final char c = csq.charAt(i);
+			if (c < 0x80 && highSurrogate==0) {
+				current().put((byte)c);
+				size++;
+			} else {
+				append(c);
+			}
+		}
+		return this;
+	}
+
+	@Override
+	public UBufferOutputStream append( final char c ) {
+		if (highSurrogate!=0) {
+			final char high = highSurrogate;
+			highSurrogate = 0;
+			if (Character.isLowSurrogate(c)) {
+				writeCodePoint(Character.toCodePoint(high, c));
+				return this;
+			}
+			write('?');
+		}
+		if (Character.isHighSurrogate(c)) {
+			highSurrogate = c;
+		} else
+		if (Character.isLowSurrogate(c)) {
+			write('?');
+		} else {
+			writeCodePoint(c);
+		}
+		return this;
+	}
+
+	/**
+	 * Writes the given code point as UTF-8.
+	 */
+	private void writeCodePoint( final int cp ) {
+		if (cp < 0x80) {
+			write(cp);
+		} else
+		if (cp < 0x800) {
+			write(0xc0 | (cp >>> 6));
+			write(0x80 | (cp & 0x3f));
+		} else
+		if (cp < 0x10000) {
+			write(0xe0 | (cp >>> 12));
+			write(0x80 | ((cp >>> 6) & 0x3f));
+			write(0x80 | (cp & 0x3f));
+		} else {
+			write(0xf0 | (cp >>> 18));
+			write(0x80 | ((cp >>> 12) & 0x3f));
+			write(0x80 | ((cp >>> 6) & 0x3f));
+			write(0x80 | (cp & 0x3f));
+		}
+	}
+
+	/**
+	 * Returns all bytes written so far and resets the stream, so that it can be used to write the next message.
+	 * @return
+	 * the written bytes, which must be released by the caller.
+	 */
+	public UCompositeBuffer toBuffer() {
+		if (highSurrogate!=0) {
+			highSurrogate = 0;
+			write('?');
+		}
+		if (current!=null) {
+			current.nio().flip();
+			written.add(current);
+			current = null;
+		}
+		final UCompositeBuffer result = written;
+		written = new UCompositeBuffer();
+		size = 0;
+		return result;
+	}
+
+	/**
+	 * Releases all bytes that were not taken with {@link #toBuffer()}.
+	 */
+	@Override
+	public void close() {
+		if (current!=null) {
+			current.release();
+			current = null;
+		}
+		if (written.refCnt() > 0) written.release();
+		size = 0;
+		highSurrogate = 0;
+	}
+}
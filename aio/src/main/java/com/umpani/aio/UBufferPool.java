@@ -0,0 +1,465 @@
+package com.umpani.aio;
+
+import java.lang.ref.ReferenceQueue;
+import java.lang.ref.WeakReference;
+import java.nio.ByteBuffer;
+import java.util.ArrayDeque;
+import java.util.ArrayList;
+import java.util.Collections;
+import java.util.List;
+import java.util.Queue;
+import java.util.Set;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.ConcurrentLinkedQueue;
+import java.util.concurrent.ThreadLocalRandom;
+import java.util.concurrent.atomic.AtomicInteger;
+import java.util.concurrent.atomic.AtomicLong;
+
+import com.umpani.util.log.ULogger;
+
+/**
+ * A pool of reference counted buffers. Requested sizes are rounded up to a power of two size class, released buffers
+ * are kept in a small cache of the releasing thread and, if that is full, in a shared queue per size class, so that
+ * the event loops normally allocate and release without any contention. Requests bigger than the maximal size class
+ * are served with unpooled buffers. Heap and direct buffers are pooled separately.
+ *
+ * </p><p>Leak detection tracks a sample of the allocated buffers together with the stack trace of their allocation.
+ * {@link #getUnreleased()} returns the allocation sites of all tracked buffers that were not yet released, which is
+ * what tests should check; tracked buffers that are garbage collected without being released are logged as errors
+ * with their allocation site and counted. The sampling interval defaults to the system property
+ * <tt>umpani.aio.leakDetection</tt>, zero disables the tracking, one tracks every buffer.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UBufferPool {
+	/**
+	 * The logger of the buffer pools.
+	 */
+	private static final ULogger LOG = new ULogger(UBufferPool.class.getName());
+
+	/**
+	 * The default size of the smallest size class.
+	 */
+	public static final int DEFAULT_MIN_SIZE = 256;
+
+	/**
+	 * The default size of the biggest size class.
+	 */
+	public static final int DEFAULT_MAX_SIZE = 1 << 20;
+
+	/**
+	 * The default amount of buffers per size class that are cached per thread.
+	 */
+	public static final int DEFAULT_CACHE_SIZE = 32;
+
+	/**
+	 * The default amount of buffers per size class that are kept in the shared queue.
+	 */
+	public static final int DEFAULT_MAX_POOLED = 256;
+
+	/**
+	 * The default pool, which prefers direct buffers.
+	 */
+	public static final UBufferPool DEFAULT = new UBufferPool(true);
+
+	/**
+	 * Create a new pool with the default sizes.
+	 * @param preferDirect
+	 * true if {@link #allocate(int)} should return direct buffers; false for heap buffers.
+	 */
+	public UBufferPool( final boolean preferDirect ) {
+		this(preferDirect, DEFAULT_MIN_SIZE, DEFAULT_MAX_SIZE, DEFAULT_CACHE_SIZE, DEFAULT_MAX_POOLED);
+	}
+
+	/**
+	 * Create a new pool.
+	 * @param preferDirect
+	 * true if {@link #allocate(int)} should return direct buffers; false for heap buffers.
+	 * @param minSize
+	 * the size of the smallest size class, must be a power of two.
+	 * @param maxSize
+	 * the size of the biggest size class, must be a power of two.
+	 * @param cacheSize
+	 * the amount of buffers per size class that are cached per thread.
+	 * @param maxPooled
+	 * the amount of buffers per size class that are kept in the shared queue.
+	 * @throws IllegalArgumentException
+	 * if any of the arguments is invalid.
+	 */
+	public UBufferPool( final boolean preferDirect, final int minSize, final int maxSize, final int cacheSize, final int maxPooled ) {
+		if (minSize <= 0 || Integer.bitCount(minSize)!=1) throw new IllegalArgumentException("minSize must be a power of two");
+		if (maxSize < minSize || Integer.bitCount(maxSize)!=1) throw new IllegalArgumentException("maxSize must be a power of two not less than minSize");
+		if (cacheSize < 0 || maxPooled < 0) throw new IllegalArgumentException("The cache sizes must not be negative");
+		this.preferDirect = preferDirect;
+		this.minSize = minSize;
+		this.minShift = Integer.numberOfTrailingZeros(minSize);
+		this.maxSize = maxSize;
+		this.classes = Integer.numberOfTrailingZeros(maxSize) - minShift + 1;
+		this.cacheSize = cacheSize;
+		this.heap = new Arena(classes, maxPooled);
+		this.direct = new Arena(classes, maxPooled);
+		this.leakSampling = Integer.getInteger("umpani.aio.leakDetection", 0);
+	}
+
+	/**
+	 * True if direct buffers are preferred.
+	 */
+	private final boolean preferDirect;
+
+	/**
+	 * The size of the smallest size class and its shift.
+	 */
+	private final int minSize, minShift;
+
+	/**
+	 * The size of the biggest size class.
+	 */
+	private final int maxSize;
+
+	/**
+	 * The amount of size classes.
+	 */
+	private final int classes;
+
+	/**
+	 * The amount of buffers per size class that are cached per thread.
+	 */
+	private final int cacheSize;
+
+	/**
+	 * The shared queues.
+	 */
+	private final Arena heap, direct;
+
+	/**
+	 * The thread local caches.
+	 */
+	private final ThreadLocal<Cache> caches = new ThreadLocal<Cache>() {
+		@Override
+		protected Cache initialValue() {
+			return new Cache(classes, cacheSize);
+		}
+	};
+
+	/**
+	 * The amount of allocated but not yet released buffers.
+	 */
+	private final AtomicLong active = new AtomicLong();
+
+	/**
+	 * The capacity of the allocated but not yet released buffers.
+	 */
+	private final AtomicLong activeBytes = new AtomicLong();
+
+	/**
+	 * The amount of allocations.
+	 */
+	private final AtomicLong allocations = new AtomicLong();
+
+	/**
+	 * The leak detection sampling interval.
+	 */
+	private volatile int leakSampling;
+
+	/**
+	 * The tracked buffers.
+	 */
+	private final Set<Leak> leaks = Collections.newSetFromMap(new ConcurrentHashMap<Leak,Boolean>());
+
+	/**
+	 * The queue of garbage collected tracked buffers.
+	 */
+	private final ReferenceQueue<UBuffer> collected = new ReferenceQueue<UBuffer>();
+
+	/**
+	 * The amount of buffers that were garbage collected without being released.
+	 */
+	private final AtomicLong leaked = new AtomicLong();
+
+	/**
+	 * The record of a tracked buffer.
+	 */
+	static final class Leak extends WeakReference<UBuffer> {
+		Leak( final UBuffer buffer, final ReferenceQueue<UBuffer> queue ) {
+			super(buffer, queue);
+			this.site = new Throwable("Allocation site of an unreleased buffer");
+		}
+
+		/**
+		 * The stack trace of the allocation.
+		 */
+		final Throwable site;
+	}
+
+	/**
+	 * The shared queues of one buffer type.
+	 */
+	private static final class Arena {
+		@SuppressWarnings("unchecked")
+		Arena( final int classes, final int maxPooled ) {
+			this.queues = new Queue[classes];
+			this.sizes = new AtomicInteger[classes];
+			for (int i=0; i < classes; i++) {
+				queues[i] = new ConcurrentLinkedQueue<ByteBuffer>();
+				sizes[i] = new AtomicInteger();
+			}
+			this.maxPooled = maxPooled;
+		}
+
+		final Queue<ByteBuffer>[] queues;
+		final AtomicInteger[] sizes;
+		final int maxPooled;
+
+		ByteBuffer poll( final int sizeClass ) {
+			final ByteBuffer buffer = queues[sizeClass].poll();
+			if (buffer!=null) sizes[sizeClass].decrementAndGet();
+			return buffer;
+		}
+
+		void offer( final ByteBuffer buffer, final int sizeClass ) {
+			if (sizes[sizeClass].incrementAndGet() > maxPooled) {
+				// the pool is full, let the garbage collector free the memory
+				sizes[sizeClass].decrementAndGet();
+				return;
+			}
+			queues[sizeClass].offer(buffer);
+		}
+	}
+
+	/**
+	 * The cache of a thread.
+	 */
+	private static final class Cache {
+		@SuppressWarnings("unchecked")
+		Cache( final int classes, final int cacheSize ) {
+			this.heap = new ArrayDeque[classes];
+			this.direct = new ArrayDeque[classes];
+			for (int i=0; i < classes; i++) {
+				heap[i] = new ArrayDeque<ByteBuffer>();
+				direct[i] = new ArrayDeque<ByteBuffer>();
+			}
+			this.cacheSize = cacheSize;
+		}
+
+		final ArrayDeque<ByteBuffer>[] heap, direct;
+		final int cacheSize;
+
+		ByteBuffer poll( final boolean isDirect, final int sizeClass ) {
+			return (isDirect ? direct : heap)[sizeClass].pollLast();
+		}
+
+		boolean offer( final ByteBuffer buffer, final int sizeClass ) {
+			final ArrayDeque<ByteBuffer> deque = (buffer.isDirect() ? direct : heap)[sizeClass];
+			if (deque.size() >= cacheSize) return false;
+			deque.addLast(buffer);
+			return true;
+		}
+	}
+
+	/**
+	 * Returns true if {@link #allocate(int)} returns direct buffers.
+	 * @return
+	 * true if {@link #allocate(int)} returns direct buffers.
+	 */
+	public boolean isPreferDirect() {
+		return preferDirect;
+	}
+
+	/**
+	 * Returns the size of the biggest size class, bigger buffers are not pooled.
+	 * @return
+	 * the size of the biggest size class.
+	 */
+	public int getMaxSize() {
+		return maxSize;
+	}
+
+	/**
+	 * Returns the amount of buffers that were allocated and not yet released.
+	 * @return
+	 * the amount of active buffers.
+	 */
+	public long getActive() {
+		return active.get();
+	}
+
+	/**
+	 * Returns the capacity of the buffers that were allocated and not yet released, the memory in use.
+	 * @return
+	 * the amount of bytes in use.
+	 */
+	public long getActiveBytes() {
+		return activeBytes.get();
+	}
+
+	/**
+	 * Returns the amount of buffers that were allocated since the pool was created.
+	 * @return
+	 * the amount of allocations.
+	 */
+	public long getAllocations() {
+		return allocations.get();
+	}
+
+	/**
+	 * Returns the amount of tracked buffers that were not yet released, cheaper than {@link #getUnreleased()}.
+	 * @return
+	 * the amount of unreleased tracked buffers.
+	 */
+	public int getTracked() {
+		return leaks.size();
+	}
+
+	/**
+	 * Sets the leak detection sampling interval.
+	 * @param sampling
+	 * zero to disable the leak detection, one to track every buffer, otherwise on average one of the given amount of
+	 * buffers is tracked.
+	 * @return
+	 * this.
+	 */
+	public UBufferPool setLeakDetection( final int sampling ) {
+		if (sampling < 0) throw new IllegalArgumentException("sampling: "+sampling);
+		this.leakSampling = sampling;
+		return this;
+	}
+
+	/**
+	 * Returns the leak detection sampling interval.
+	 * @return
+	 * the leak detection sampling interval, zero if disabled.
+	 */
+	public int getLeakDetection() {
+		return leakSampling;
+	}
+
+	/**
+	 * Returns the allocation sites of all tracked buffers that were not yet released.
+	 * @return
+	 * the allocation sites, empty if all tracked buffers were released.
+	 */
+	public List<Throwable> getUnreleased() {
+		reportLeaks();
+		final ArrayList<Throwable> sites = new ArrayList<Throwable>();
+		for (final Leak leak : leaks) sites.add(leak.site);
+		return sites;
+	}
+
+	/**
+	 * Returns the amount of tracked buffers that were garbage collected without being released.
+	 * @return
+	 * the amount of leaked buffers.
+	 */
+	public long getLeaked() {
+		reportLeaks();
+		return leaked.get();
+	}
+
+	/**
+	 * Returns the size class of the given size.
+	 * @return
+	 * the size class or -1, if the size is too big to be pooled.
+	 */
+	private int sizeClass( final int size ) {
+		if (size > maxSize) return -1;
+		if (size <= minSize) return 0;
+		return 32 - Integer.numberOfLeadingZeros(size-1) - minShift;
+	}
+
+	/**
+	 * Allocates a buffer of the preferred type.
+	 * @param size
+	 * the size of the buffer.
+	 * @return
+	 * the buffer with the position zero and the limit set to the given size.
+	 */
+	public UBuffer allocate( final int size ) {
+		return allocate(size, preferDirect);
+	}
+
+	/**
+	 * Allocates a heap buffer.
+	 * @param size
+	 * the size of the buffer.
+	 * @return
+	 * the buffer with the position zero and the limit set to the given size.
+	 */
+	public UBuffer heapBuffer( final int size ) {
+		return allocate(size, false);
+	}
+
+	/**
+	 * Allocates a direct buffer.
+	 * @param size
+	 * the size of the buffer.
+	 * @return
+	 * the buffer with the position zero and the limit set to the given size.
+	 */
+	public UBuffer directBuffer( final int size ) {
+		return allocate(size, true);
+	}
+
+	/**
+	 * Allocates a buffer.
+	 */
+	private UBuffer allocate( final int size, final boolean isDirect ) {
+		if (size < 0) throw new IllegalArgumentException("size: "+size);
+		final int sizeClass = sizeClass(size);
+		ByteBuffer buffer = null;
+		if (sizeClass >= 0) {
+			buffer = caches.get().poll(isDirect, sizeClass);
+			if (buffer==null) buffer = (isDirect ? direct : heap).poll(sizeClass);
+		}
+		if (buffer==null) {
+			final int capacity = sizeClass >= 0 ? minSize << sizeClass : size;
+			buffer = isDirect ? ByteBuffer.allocateDirect(capacity) : ByteBuffer.allocate(capacity);
+		}
+		buffer.clear();
+		buffer.limit(size);
+		active.incrementAndGet();
+		activeBytes.addAndGet(buffer.capacity());
+		allocations.incrementAndGet();
+		final UBuffer result = new UBuffer(this, buffer, sizeClass);
+		track(result);
+		return result;
+	}
+
+	/**
+	 * Returns the memory of a released buffer to the pool.
+	 */
+	void free( final ByteBuffer buffer, final int sizeClass, final Leak leak ) {
+		active.decrementAndGet();
+		activeBytes.addAndGet(-buffer.capacity());
+		if (leak!=null) {
+			leaks.remove(leak);
+			leak.clear();
+		}
+		if (sizeClass < 0) return;
+		if (!caches.get().offer(buffer, sizeClass)) (buffer.isDirect() ? direct : heap).offer(buffer, sizeClass);
+	}
+
+	/**
+	 * Starts to track the given buffer, if it is sampled.
+	 */
+	private void track( final UBuffer buffer ) {
+		final int sampling = leakSampling;
+		if (sampling <= 0) return;
+		reportLeaks();
+		if (sampling > 1 && ThreadLocalRandom.current().nextInt(sampling)!=0) return;
+		final Leak leak = new Leak(buffer, collected);
+		buffer.leak = leak;
+		leaks.add(leak);
+	}
+
+	/**
+	 * Reports all tracked buffers that were garbage collected without being released.
+	 */
+	private void reportLeaks() {
+		Leak leak;
+		while ((leak = (Leak)collected.poll())!=null) {
+			if (!leaks.remove(leak)) continue;
+			leaked.incrementAndGet();
+			LOG.error("LEAK: a buffer was garbage collected without being released", leak.site);
+		}
+	}
+}
@@ -0,0 +1,709 @@
+package com.umpani.aio;
+
+import java.io.IOException;
+import java.net.SocketAddress;
+import java.nio.ByteBuffer;
+import java.nio.channels.ClosedChannelException;
+import java.nio.channels.FileChannel;
+import java.nio.channels.WritableByteChannel;
+import java.util.ArrayDeque;
+
+/**
+ * A connection that is served by an {@link UEventLoop} and processes its events with a {@link UPipeline}. Messages
+ * written to the channel are queued until flushed, the flushed bytes are written by the loop whenever the transport
+ * accepts them. If the amount of queued bytes exceeds the high water mark, the channel becomes unwritable until the
+ * amount drops below the low water mark again, every change is signalled to the handlers via
+ * {@link UChannelHandler#channelWritabilityChanged(UHandlerContext)}. Producers should stop writing while the
+ * channel is unwritable, the channel itself never rejects writes.
+ *
+ * </p><p>The channel counts the bytes it read and wrote, the counters and the amount of queued bytes may be read by any
+ * thread and are summed up by the loop, see {@link UEventLoop#getBytesRead()}.
+ *
+ * </p><p>The head of the pipeline accepts {@link UBuffer}, {@link UCompositeBuffer}, {@link ByteBuffer}, byte[] and
+ * {@link UFileRegion} messages, encoders must convert all other messages. Buffers and regions are released once
+ * written. Message oriented transports, like {@link UDatagramChannel}, additionally accept {@link UDatagramPacket}s.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public abstract class UChannel {
+	/**
+	 * The default low water mark in bytes.
+	 */
+	public static final int DEFAULT_LOW_WATER_MARK = 32 * 1024;
+
+	/**
+	 * The default high water mark in bytes.
+	 */
+	public static final int DEFAULT_HIGH_WATER_MARK = 64 * 1024;
+
+	/**
+	 * Create a new channel.
+	 * @param loop
+	 * the event loop that serves the channel.
+	 * @param alloc
+	 * the buffer pool of the channel.
+	 */
+	protected UChannel( final UEventLoop loop, final UBufferPool alloc ) {
+		if (loop==null) throw new NullPointerException("loop");
+		this.loop = loop;
+		this.alloc = alloc!=null ? alloc : UBufferPool.DEFAULT;
+		this.pipeline = new UPipeline(this);
+		this.closeFuture = new UPromise<Void>(loop);
+	}
+
+	/**
+	 * The event loop.
+	 */
+	private final UEventLoop loop;
+
+	/**
+	 * The buffer pool.
+	 */
+	private final UBufferPool alloc;
+
+	/**
+	 * The pipeline.
+	 */
+	private final UPipeline pipeline;
+
+	/**
+	 * Completed once the channel is closed.
+	 */
+	private final UPromise<Void> closeFuture;
+
+	/**
+	 * The written, but not yet flushed buffers.
+	 */
+	private final ArrayDeque<Pending> unflushed = new ArrayDeque<>();
+
+	/**
+	 * The flushed buffers that are not yet completely written.
+	 */
+	private final ArrayDeque<Pending> flushed = new ArrayDeque<>();
+
+	/**
+	 * The amount of queued bytes, only written by the event loop.
+	 */
+	private volatile long pendingBytes;
+
+	/**
+	 * The amount of bytes read, only written by the event loop.
+	 */
+	private volatile long bytesRead;
+
+	/**
+	 * The amount of bytes written, only written by the event loop.
+	 */
+	private volatile long bytesWritten;
+
+	/**
+	 * True once the channel is counted as open connection of the loop.
+	 */
+	private boolean counted;
+
+	/**
+	 * The low water mark.
+	 */
+	private volatile int lowWaterMark = DEFAULT_LOW_WATER_MARK;
+
+	/**
+	 * The high water mark.
+	 */
+	private volatile int highWaterMark = DEFAULT_HIGH_WATER_MARK;
+
+	/**
+	 * True if the amount of queued bytes is below the high water mark.
+	 */
+	private volatile boolean writable = true;
+
+	/**
+	 * True once closeNow was called.
+	 */
+	private boolean closed;
+
+	/**
+	 * True while the flushed buffers are written.
+	 */
+	private boolean flushing;
+
+	/**
+	 * An attachment.
+	 */
+	private volatile Object attachment;
+
+	/**
+	 * Returns the event loop that serves this channel.
+	 * @return
+	 * the event loop.
+	 */
+	public final UEventLoop loop() {
+		return loop;
+	}
+
+	/**
+	 * Returns the buffer pool of this channel.
+	 * @return
+	 * the buffer pool.
+	 */
+	public final UBufferPool alloc() {
+		return alloc;
+	}
+
+	/**
+	 * Returns the pipeline of this channel.
+	 * @return
+	 * the pipeline.
+	 */
+	public final UPipeline pipeline() {
+		return pipeline;
+	}
+
+	/**
+	 * Returns the future that is completed once this channel was closed.
+	 * @return
+	 * the close future.
+	 */
+	public final UFuture<Void> closeFuture() {
+		return closeFuture;
+	}
+
+	/**
+	 * Returns the attachment.
+	 * @return
+	 * the attachment.
+	 */
+	public final Object getAttachment() {
+		return attachment;
+	}
+
+	/**
+	 * Sets the attachment, an arbitrary object that is associated with the channel.
+	 * @param attachment
+	 * the attachment.
+	 * @return
+	 * this.
+	 */
+	public final UChannel setAttachment( final Object attachment ) {
+		this.attachment = attachment;
+		return this;
+	}
+
+	/**
+	 * Returns true if the amount of queued bytes is below the high water mark.
+	 * @return
+	 * true if the channel is writable.
+	 */
+	public final boolean isWritable() {
+		return writable;
+	}
+
+	/**
+	 * Sets the water marks of the outbound queue.
+	 * @param low
+	 * the low water mark, when the queued bytes drop below it, the channel becomes writable again.
+	 * @param high
+	 * the high water mark, when the queued bytes exceed it, the channel becomes unwritable.
+	 * @return
+	 * this.
+	 * @throws IllegalArgumentException
+	 * if the low water mark is negative or greater than the high water mark.
+	 */
+	public final UChannel setWriteBufferWaterMark( final int low, final int high ) {
+		if (low < 0 || low > high) throw new IllegalArgumentException("low: "+low+", high: "+high);
+		this.lowWaterMark = low;
+		this.highWaterMark = high;
+		return this;
+	}
+
+	/**
+	 * Returns the low water mark.
+	 * @return
+	 * the low water mark.
+	 */
+	public final int getLowWaterMark() {
+		return lowWaterMark;
+	}
+
+	/**
+	 * Returns the high water mark.
+	 * @return
+	 * the high water mark.
+	 */
+	public final int getHighWaterMark() {
+		return highWaterMark;
+	}
+
+	/**
+	 * Returns the amount of queued bytes.
+	 * @return
+	 * the amount of queued bytes.
+	 */
+	public final long getPendingBytes() {
+		return pendingBytes;
+	}
+
+	/**
+	 * Returns the amount of bytes read from the transport.
+	 * @return
+	 * the amount of bytes read.
+	 */
+	public final long getBytesRead() {
+		return bytesRead;
+	}
+
+	/**
+	 * Returns the amount of bytes written to the transport.
+	 * @return
+	 * the amount of bytes written.
+	 */
+	public final long getBytesWritten() {
+		return bytesWritten;
+	}
+
+	/**
+	 * Writes the given message through the pipeline, without flushing.
+	 * @param msg
+	 * the message.
+	 * @return
+	 * the future that is completed once the message was written to the transport.
+	 */
+	public final UFuture<Void> write( final Object msg ) {
+		return pipeline.write(msg, new UPromise<Void>(loop));
+	}
+
+	/**
+	 * Writes the given message through the pipeline and flushes.
+	 * @param msg
+	 * the message.
+	 * @return
+	 * the future that is completed once the message was written to the transport.
+	 */
+	public final UFuture<Void> writeAndFlush( final Object msg ) {
+		final UFuture<Void> future = write(msg);
+		pipeline.flush();
+		return future;
+	}
+
+	/**
+	 * Flushes all written messages.
+	 * @return
+	 * this.
+	 */
+	public final UChannel flush() {
+		pipeline.flush();
+		return this;
+	}
+
+	/**
+	 * Writes a region of the given file through the pipeline and flushes, the bytes are transferred without copying
+	 * them, unless a handler has to process them, like the {@link com.umpani.aio.ssl.USslHandler}. The file is owned by
+	 * the caller and must not be closed before the returned future is done.
+	 * @param file
+	 * the file.
+	 * @param position
+	 * the position of the first byte.
+	 * @param count
+	 * the amount of bytes.
+	 * @return
+	 * the future that is completed once the region was written to the transport.
+	 */
+	public final UFuture<Void> sendFile( final FileChannel file, final long position, final long count ) {
+		return writeAndFlush(new UFileRegion(file, position, count));
+	}
+
+	/**
+	 * Closes the channel through the pipeline.
+	 * @return
+	 * the future that is completed once the channel was closed.
+	 */
+	public final UFuture<Void> close() {
+		return pipeline.close(new UPromise<Void>(loop));
+	}
+
+	/**
+	 * Returns true if the channel is open.
+	 * @return
+	 * true if the channel is open.
+	 */
+	public abstract boolean isOpen();
+
+	/**
+	 * Returns true if the channel is open and connected.
+	 * @return
+	 * true if the channel is active.
+	 */
+	public abstract boolean isActive();
+
+	/**
+	 * Returns the local address.
+	 * @return
+	 * the local address or null, if not bound.
+	 */
+	public abstract SocketAddress localAddress();
+
+	/**
+	 * Returns the remote address.
+	 * @return
+	 * the remote address or null, if not connected.
+	 */
+	public abstract SocketAddress remoteAddress();
+
+	/**
+	 * Writes as many bytes of the given buffer as the transport accepts without blocking.
+	 * @param buffer
+	 * the buffer to write.
+	 * @return
+	 * the amount of written bytes.
+	 * @throws IOException
+	 * if the write failed.
+	 */
+	protected abstract int writeBytes( final ByteBuffer buffer ) throws IOException;
+
+	/**
+	 * Sends the given buffer as one datagram to the given address, either completely or not at all. The default
+	 * implementation throws an {@link UnsupportedOperationException}, message oriented transports override it.
+	 * @param buffer
+	 * the bytes of the datagram.
+	 * @param address
+	 * the recipient.
+	 * @return
+	 * the amount of written bytes, zero if the transport does not accept the datagram now.
+	 * @throws IOException
+	 * if sending failed.
+	 */
+	protected int writeDatagram( final ByteBuffer buffer, final SocketAddress address ) throws IOException {
+		throw new UnsupportedOperationException("Datagrams are not supported by "+getClass().getName());
+	}
+
+	/**
+	 * Returns true if the transport writes independent messages, like datagrams. A failed write of such a transport
+	 * only fails the promise of the message, otherwise the channel is closed. The default implementation returns
+	 * false.
+	 * @return
+	 * true if the transport is message oriented.
+	 */
+	protected boolean isMessageOriented() {
+		return false;
+	}
+
+	/**
+	 * Transfers as many bytes of the given region as the transport accepts without blocking. The default
+	 * implementation copies the bytes and writes them with {@link #writeBytes(ByteBuffer)}, transports that support
+	 * zero-copy transfers override it.
+	 * @param region
+	 * the region to write.
+	 * @return
+	 * the amount of written bytes.
+	 * @throws IOException
+	 * if the write failed.
+	 */
+	protected long writeRegion( final UFileRegion region ) throws IOException {
+		return region.transferTo(new WritableByteChannel() {
+			@Override
+			public int write( final ByteBuffer src ) throws IOException {
+				return writeBytes(src);
+			}
+
+			@Override
+			public boolean isOpen() {
+				return UChannel.this.isOpen();
+			}
+
+			@Override
+			public void close() {}
+		});
+	}
+
+	/**
+	 * Fires the active event and counts the channel as open connection of its loop, called by the transports once the
+	 * channel became active.
+	 */
+	protected final void fireChannelActive() {
+		if (!counted) {
+			counted = true;
+			loop.channelOpened(1);
+		}
+		pipeline.fireChannelActive();
+	}
+
+	/**
+	 * Counts the bytes read from the transport, called by the transports before the bytes are passed into the
+	 * pipeline.
+	 * @param n
+	 * the amount of bytes.
+	 */
+	protected final void countRead( final long n ) {
+		bytesRead += n;
+		loop.channelRead(n);
+	}
+
+	/**
+	 * Called to request a notification, once the transport accepts more bytes, the implementation must then invoke
+	 * {@link #flushPending()}.
+	 * @param interested
+	 * true to request the notification; false to cancel the request.
+	 */
+	protected abstract void setWriteInterest( final boolean interested );
+
+	/**
+	 * Closes the transport.
+	 * @throws IOException
+	 * if closing failed.
+	 */
+	protected abstract void doClose() throws IOException;
+
+	/**
+	 * Queues the given message, called by the head of the pipeline.
+	 */
+	final void enqueue( final Object msg, final UPromise<Void> promise ) {
+		if (closed) {
+			UReferences.release(msg);
+			promise.fail(new ClosedChannelException());
+			return;
+		}
+		if (msg instanceof UBuffer) {
+			add(new Pending((UBuffer)msg, promise));
+		} else
+		if (msg instanceof UCompositeBuffer) {
+			final UCompositeBuffer composite = (UCompositeBuffer)msg;
+			UBuffer component = composite.removeFirst();
+			if (component==null) {
+				add(new Pending(UBuffer.wrap(new byte[0]), promise));
+			} else {
+				while (component!=null) {
+					final UBuffer next = composite.removeFirst();
+					add(new Pending(component, next==null ? promise : null));
+					component = next;
+				}
+			}
+			composite.release();
+		} else
+		if (msg instanceof ByteBuffer) {
+			add(new Pending(UBuffer.wrap((ByteBuffer)msg), promise));
+		} else
+		if (msg instanceof byte[]) {
+			add(new Pending(UBuffer.wrap((byte[])msg), promise));
+		} else
+		if (msg instanceof UFileRegion) {
+			add(new Pending((UFileRegion)msg, promise));
+		} else
+		if (msg instanceof UDatagramPacket) {
+			final UDatagramPacket packet = (UDatagramPacket)msg;
+			add(new Pending(packet.content(), packet.address(), promise));
+		} else {
+			UReferences.release(msg);
+			promise.fail(new IllegalArgumentException("Unsupported message type: "+(msg!=null ? msg.getClass().getName() : null)));
+		}
+	}
+
+	/**
+	 * Adds the given entry to the unflushed buffers.
+	 */
+	private void add( final Pending pending ) {
+		unflushed.addLast(pending);
+		pendingBytes += pending.size;
+		loop.channelPending(pending.size);
+		if (writable && pendingBytes > highWaterMark) {
+			writable = false;
+			pipeline.fireChannelWritabilityChanged();
+		}
+	}
+
+	/**
+	 * Flushes all queued buffers, called by the head of the pipeline.
+	 */
+	final void flushNow() {
+		Pending pending;
+		while ((pending = unflushed.pollFirst())!=null) flushed.addLast(pending);
+		flushPending();
+	}
+
+	/**
+	 * Writes the flushed buffers until the transport does not accept more bytes. If bytes remain, write interest is
+	 * requested, otherwise cancelled. Must be called from the event loop.
+	 */
+	protected final void flushPending() {
+		// completing a promise may cause a reentrant flush, the outer call writes the added buffers
+		if (closed || flushing) return;
+		flushing = true;
+		try {
+			Pending pending;
+			while ((pending = flushed.peekFirst())!=null) {
+				if (pending.remaining() > 0) {
+					final long n;
+					try {
+						if (pending.address!=null) {
+							n = writeDatagram(pending.buffer.nio(), pending.address);
+						} else {
+							n = pending.buffer!=null ? writeBytes(pending.buffer.nio()) : writeRegion(pending.region);
+						}
+					} catch (Throwable t) {
+						if (isMessageOriented() && !(t instanceof ClosedChannelException)) {
+							// only this message is lost, the following ones are written
+							flushed.pollFirst();
+							decrementPending(pending.remaining());
+							pending.release();
+							if (pending.promise!=null) pending.promise.fail(t);
+							if (closed) return;
+							continue;
+						}
+						flushing = false;
+						pipeline.fireExceptionCaught(t);
+						closeNow(new UPromise<Void>(null));
+						return;
+					}
+					if (n > 0) {
+						bytesWritten += n;
+						loop.channelWritten(n);
+						decrementPending(n);
+					}
+					if (pending.remaining() > 0) {
+						setWriteInterest(true);
+						return;
+					}
+				}
+				flushed.pollFirst();
+				pending.release();
+				if (pending.promise!=null) pending.promise.complete(null);
+				if (closed) return;
+			}
+			setWriteInterest(false);
+		} finally {
+			flushing = false;
+		}
+	}
+
+	/**
+	 * Decrements the amount of queued bytes and signals, if the channel becomes writable again.
+	 */
+	private void decrementPending( final long amount ) {
+		pendingBytes -= amount;
+		loop.channelPending(-amount);
+		if (!writable && pendingBytes < lowWaterMark) {
+			writable = true;
+			pipeline.fireChannelWritabilityChanged();
+		}
+	}
+
+	/**
+	 * Closes the channel, called by the head of the pipeline. All queued writes fail, the pipeline is informed that
+	 * the channel is inactive and then the close future is completed.
+	 */
+	final void closeNow( final UPromise<Void> promise ) {
+		if (closed) {
+			closeFuture.addListener(new UFutureListener<Void>() {
+				@Override
+				public void complete( final UFuture<Void> future ) {
+					promise.complete(null);
+				}
+			}, null);
+			return;
+		}
+		closed = true;
+		final boolean wasActive = isActive();
+		Throwable failure = null;
+		try {
+			doClose();
+		} catch (Throwable t) {
+			failure = t;
+		}
+		final ClosedChannelException cause = new ClosedChannelException();
+		failPending(unflushed, cause);
+		failPending(flushed, cause);
+		loop.channelPending(-pendingBytes);
+		pendingBytes = 0;
+		if (counted) loop.channelOpened(-1);
+		// handlers release their resources before anybody is told that the channel is closed
+		if (wasActive) pipeline.fireChannelInactive();
+		closeFuture.complete(null);
+		if (failure!=null) {
+			promise.fail(failure);
+		} else {
+			promise.complete(null);
+		}
+	}
+
+	/**
+	 * Releases all buffers of the given queue and fails their promises.
+	 */
+	private static void failPending( final ArrayDeque<Pending> queue, final Throwable cause ) {
+		Pending pending;
+		while ((pending = queue.pollFirst())!=null) {
+			pending.release();
+			if (pending.promise!=null) pending.promise.fail(cause);
+		}
+	}
+
+	@Override
+	public String toString() {
+		return getClass().getSimpleName()+"[local="+localAddress()+", remote="+remoteAddress()+"]";
+	}
+
+	/**
+	 * A queued buffer or file region.
+	 */
+	private static final class Pending {
+		Pending( final UBuffer buffer, final UPromise<Void> promise ) {
+			this(buffer, null, promise);
+		}
+
+		Pending( final UBuffer buffer, final SocketAddress address, final UPromise<Void> promise ) {
+			this.buffer = buffer;
+			this.region = null;
+			this.address = address;
+			this.size = buffer.nio().remaining();
+			this.promise = promise;
+		}
+
+		Pending( final UFileRegion region, final UPromise<Void> promise ) {
+			this.buffer = null;
+			this.region = region;
+			this.address = null;
+			this.size = region.remaining();
+			this.promise = promise;
+		}
+
+		/**
+		 * The buffer or null, if a region is queued.
+		 */
+		final UBuffer buffer;
+
+		/**
+		 * The region or null, if a buffer is queued.
+		 */
+		final UFileRegion region;
+
+		/**
+		 * The recipient of a datagram or null, if the buffer is written to the connected peer.
+		 */
+		final SocketAddress address;
+
+		/**
+		 * The amount of bytes, when queued.
+		 */
+		final long size;
+
+		/**
+		 * The promise to complete once written, may be null.
+		 */
+		final UPromise<Void> promise;
+
+		/**
+		 * Returns the amount of bytes not yet written.
+		 */
+		long remaining() {
+			return buffer!=null ? buffer.nio().remaining() : region.remaining();
+		}
+
+		/**
+		 * Releases the buffer or region.
+		 */
+		void release() {
+			if (buffer!=null) {
+				buffer.release();
+			} else {
+				region.release();
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package com.umpani.aio;
+
+/**
+ * A handler in the {@link UPipeline} of a {@link UChannel}. Inbound events (activation, read messages, exceptions and
+ * alike) travel from the head of the pipeline, where the bytes arrive, towards the tail; outbound operations (write,
+ * flush and close) travel from the tail towards the head, where the bytes are written to the transport. Each method
+ * receives the {@link UHandlerContext} of the handler, which is used to pass the event on to the next handler, a
+ * handler that does not pass an event on terminates it.
+ *
+ * </p><p>All methods are invoked from the event loop thread of the channel. Exceptions thrown by an inbound method
+ * are passed to {@link #exceptionCaught(UHandlerContext, Throwable)} of the same handler, exceptions thrown by an
+ * outbound method fail the promise of the operation. Most handlers extend {@link UChannelHandlerAdapter}, which passes
+ * all events on.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface UChannelHandler {
+	/**
+	 * Called after the handler was added to a pipeline.
+	 * @param ctx
+	 * the context of the handler.
+	 * @throws Exception
+	 * if anything went wrong.
+	 */
+	public void handlerAdded( final UHandlerContext ctx ) throws Exception;
+
+	/**
+	 * Called after the handler was removed from a pipeline.
+	 * @param ctx
+	 * the context of the handler.
+	 * @throws Exception
+	 * if anything went wrong.
+	 */
+	public void handlerRemoved( final UHandlerContext ctx ) throws Exception;
+
+	/**
+	 * Called once the channel is connected.
+	 * @param ctx
+	 * the context of the handler.
+	 * @throws Exception
+	 * if anything went wrong.
+	 */
+	public void channelActive( final UHandlerContext ctx ) throws Exception;
+
+	/**
+	 * Called once the channel was closed.
+	 * @param ctx
+	 * the context of the handler.
+	 * @throws Exception
+	 * if anything went wrong.
+	 */
+	public void channelInactive( final UHandlerContext ctx ) throws Exception;
+
+	/**
+	 * Called for every inbound message. The head of the pipeline produces {@link UBuffer}s, decoders convert them
+	 * into other messages. A handler that terminates a reference counted message must release it.
+	 * @param ctx
+	 * the context of the handler.
+	 * @param msg
+	 * the message.
+	 * @throws Exception
+	 * if anything went wrong.
+	 */
+	public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception;
+
+	/**
+	 * Called after all the data currently available at the transport was read.
+	 * @param ctx
+	 * the context of the handler.
+	 * @throws Exception
+	 * if anything went wrong.
+	 */
+	public void channelReadComplete( final UHandlerContext ctx ) throws Exception;
+
+	/**
+	 * Called if the writability of the channel changed because the pending outbound bytes crossed a water mark.
+	 * @param ctx
+	 * the context of the handler.
+	 * @throws Exception
+	 * if anything went wrong.
+	 * @see UChannel#isWritable()
+	 */
+	public void channelWritabilityChanged( final UHandlerContext ctx ) throws Exception;
+
+	/**
+	 * Called for user defined events, for example idle notifications.
+	 * @param ctx
+	 * the context of the handler.
+	 * @param event
+	 * the event.
+	 * @throws Exception
+	 * if anything went wrong.
+	 */
+	public void userEvent( final UHandlerContext ctx, final Object event ) throws Exception;
+
+	/**
+	 * Called if an inbound method of this handler or of a handler before it threw an exception.
+	 * @param ctx
+	 * the context of the handler.
+	 * @param cause
+	 * the exception.
+	 * @throws Exception
+	 * if anything went wrong.
+	 */
+	public void exceptionCaught( final UHandlerContext ctx, final Throwable cause ) throws Exception;
+
+	/**
+	 * Called to write a message, the message is queued at the channel, but not written before a flush. Encoders
+	 * convert messages into {@link UBuffer}s, which is what the head of the pipeline expects.
+	 * @param ctx
+	 * the context of the handler.
+	 * @param msg
+	 * the message.
+	 * @param promise
+	 * the promise to complete once the message was written.
+	 * @throws Exception
+	 * if anything went wrong, the promise is then failed.
+	 */
+	public void write( final UHandlerContext ctx, final Object msg, final UPromise<Void> promise ) throws Exception;
+
+	/**
+	 * Called to write all queued messages to the transport.
+	 * @param ctx
+	 * the context of the handler.
+	 * @throws Exception
+	 * if anything went wrong.
+	 */
+	public void flush( final UHandlerContext ctx ) throws Exception;
+
+	/**
+	 * Called to close the channel.
+	 * @param ctx
+	 * the context of the handler.
+	 * @param promise
+	 * the promise to complete once the channel was closed.
+	 * @throws Exception
+	 * if anything went wrong, the promise is then failed.
+	 */
+	public void close( final UHandlerContext ctx, final UPromise<Void> promise ) throws Exception;
+}
@@ -0,0 +1,64 @@
+package com.umpani.aio;
+
+/**
+ * An adapter for the {@link UChannelHandler} that passes all events on to the next handler.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public abstract class UChannelHandlerAdapter implements UChannelHandler {
+	@Override
+	public void handlerAdded( final UHandlerContext ctx ) throws Exception {}
+
+	@Override
+	public void handlerRemoved( final UHandlerContext ctx ) throws Exception {}
+
+	@Override
+	public void channelActive( final UHandlerContext ctx ) throws Exception {
+		ctx.fireChannelActive();
+	}
+
+	@Override
+	public void channelInactive( final UHandlerContext ctx ) throws Exception {
+		ctx.fireChannelInactive();
+	}
+
+	@Override
+	public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+		ctx.fireChannelRead(msg);
+	}
+
+	@Override
+	public void channelReadComplete( final UHandlerContext ctx ) throws Exception {
+		ctx.fireChannelReadComplete();
+	}
+
+	@Override
+	public void channelWritabilityChanged( final UHandlerContext ctx ) throws Exception {
+		ctx.fireChannelWritabilityChanged();
+	}
+
+	@Override
+	public void userEvent( final UHandlerContext ctx, final Object event ) throws Exception {
+		ctx.fireUserEvent(event);
+	}
+
+	@Override
+	public void exceptionCaught( final UHandlerContext ctx, final Throwable cause ) throws Exception {
+		ctx.fireExceptionCaught(cause);
+	}
+
+	@Override
+	public void write( final UHandlerContext ctx, final Object msg, final UPromise<Void> promise ) throws Exception {
+		ctx.write(msg, promise);
+	}
+
+	@Override
+	public void flush( final UHandlerContext ctx ) throws Exception {
+		ctx.flush();
+	}
+
+	@Override
+	public void close( final UHandlerContext ctx, final UPromise<Void> promise ) throws Exception {
+		ctx.close(promise);
+	}
+}
@@ -0,0 +1,17 @@
+package com.umpani.aio;
+
+/**
+ * Sets up the pipeline of new channels, used by {@link UServer} and {@link UClient}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface UChannelInitializer {
+	/**
+	 * Called from the event loop of the channel before the channel is registered at the loop.
+	 * @param channel
+	 * the new channel.
+	 * @throws Exception
+	 * if anything went wrong, the channel is then closed.
+	 */
+	public void initChannel( final UChannel channel ) throws Exception;
+}
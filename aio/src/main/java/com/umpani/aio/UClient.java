@@ -0,0 +1,130 @@
+package com.umpani.aio;
+
+import java.io.IOException;
+import java.net.SocketAddress;
+import java.net.StandardSocketOptions;
+import java.nio.channels.SocketChannel;
+
+/**
+ * Opens TCP connections, every connection is served by the next loop of an {@link UEventLoopGroup} and its pipeline
+ * is set up by the {@link UChannelInitializer} of the client. With the {@link UTransport#UNIX} transport the client
+ * connects to Unix domain sockets instead.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UClient {
+	/**
+	 * Create a new client that uses the default buffer pool.
+	 * @param group
+	 * the event loops.
+	 * @param initializer
+	 * the initializer of the channels.
+	 */
+	public UClient( final UEventLoopGroup group, final UChannelInitializer initializer ) {
+		this(group, initializer, UBufferPool.DEFAULT);
+	}
+
+	/**
+	 * Create a new client.
+	 * @param group
+	 * the event loops.
+	 * @param initializer
+	 * the initializer of the channels.
+	 * @param alloc
+	 * the buffer pool of the channels.
+	 */
+	public UClient( final UEventLoopGroup group, final UChannelInitializer initializer, final UBufferPool alloc ) {
+		this.group = group;
+		this.initializer = initializer;
+		this.alloc = alloc;
+	}
+
+	/**
+	 * The event loops.
+	 */
+	protected final UEventLoopGroup group;
+
+	/**
+	 * The initializer of the channels.
+	 */
+	protected final UChannelInitializer initializer;
+
+	/**
+	 * The buffer pool of the channels.
+	 */
+	protected final UBufferPool alloc;
+
+	/**
+	 * The transport.
+	 */
+	private volatile UTransport transport = UTransport.TCP;
+
+	/**
+	 * Sets the transport of new connections.
+	 * @param transport
+	 * the transport.
+	 * @return
+	 * this.
+	 * @throws UnsupportedOperationException
+	 * if the transport is not available.
+	 */
+	public UClient setTransport( final UTransport transport ) {
+		if (transport==null) throw new NullPointerException("transport");
+		if (!transport.isAvailable()) throw new UnsupportedOperationException(transport+" sockets are not supported by this JDK");
+		this.transport = transport;
+		return this;
+	}
+
+	/**
+	 * Returns the transport of new connections.
+	 * @return
+	 * the transport.
+	 */
+	public UTransport getTransport() {
+		return transport;
+	}
+
+	/**
+	 * Connects to the given address. Cancelling the returned future aborts the connect.
+	 * @param address
+	 * the remote address, with the {@link UTransport#UNIX} transport the address of the socket file.
+	 * @return
+	 * the future that is completed with the channel once it is connected and active.
+	 */
+	public UFuture<USocketChannel> connect( final SocketAddress address ) {
+		final UEventLoop loop = group.next();
+		final UPromise<USocketChannel> promise = new UPromise<USocketChannel>(loop);
+		final USocketChannel channel;
+		try {
+			final UTransport transport = this.transport;
+			final SocketChannel socket = transport.openChannel();
+			if (transport==UTransport.TCP) socket.setOption(StandardSocketOptions.TCP_NODELAY, true);
+			channel = new USocketChannel(loop, alloc, socket);
+		} catch (IOException | RuntimeException e) {
+			promise.fail(e);
+			return promise;
+		}
+		promise.onCancel(new Runnable() {
+			@Override
+			public void run() {
+				channel.close();
+			}
+		});
+		try {
+			loop.execute(new Runnable() {
+				@Override
+				public void run() {
+					channel.start(initializer, address, promise);
+				}
+			});
+		} catch (Throwable t) {
+			try {
+				channel.javaChannel().close();
+			} catch (IOException e) {
+				// ignore, the loop rejected the channel
+			}
+			promise.fail(t);
+		}
+		return promise;
+	}
+}
@@ -0,0 +1,26 @@
+package com.umpani.aio;
+
+/**
+ * A source of monotonic time, used by timers so that tests can control the time.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface UClock {
+	/**
+	 * The clock based upon {@link System#nanoTime()}.
+	 */
+	public static final UClock SYSTEM = new UClock() {
+		@Override
+		public long nanoTime() {
+			return System.nanoTime();
+		}
+	};
+
+	/**
+	 * Returns the current value of this clock in nanoseconds. The value has no relation to the wall clock time and is
+	 * only meaningful when compared to other values of the same clock.
+	 * @return
+	 * the current value of this clock in nanoseconds.
+	 */
+	public long nanoTime();
+}
@@ -0,0 +1,530 @@
+package com.umpani.aio;
+
+import java.nio.ByteBuffer;
+import java.util.ArrayDeque;
+import java.util.concurrent.atomic.AtomicIntegerFieldUpdater;
+
+import com.umpani.aio.exception.UIllegalReferenceCountException;
+
+/**
+ * A sequence of buffers that is read as one continuous buffer without copying, used by codecs to handle frames that
+ * are split across several reads. The readable bytes of each component are those between its position and limit, the
+ * composite takes ownership of added components and releases them as soon as they are completely read. All indices
+ * are relative to the current read position of the composite and all multi-byte values are big-endian.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UCompositeBuffer implements UReferenceCounted {
+	/**
+	 * The updater of the reference count.
+	 */
+	private static final AtomicIntegerFieldUpdater<UCompositeBuffer> REF_CNT = AtomicIntegerFieldUpdater.newUpdater(UCompositeBuffer.class, "refCnt");
+
+	/**
+	 * Create a new empty composite buffer.
+	 */
+	public UCompositeBuffer() {
+		this.components = new ArrayDeque<UBuffer>();
+	}
+
+	/**
+	 * The components.
+	 */
+	private final ArrayDeque<UBuffer> components;
+
+	/**
+	 * The amount of readable bytes.
+	 */
+	private int readable;
+
+	/**
+	 * The reference count.
+	 */
+	private volatile int refCnt = 1;
+
+	/**
+	 * Adds the given buffer as last component, taking over the reference of the caller.
+	 * @param buffer
+	 * the buffer whose bytes between position and limit to add.
+	 * @return
+	 * this.
+	 */
+	public UCompositeBuffer add( final UBuffer buffer ) {
+		ensureAccessible();
+		final int remaining = buffer.nio().remaining();
+		if (remaining==0) {
+			buffer.release();
+			return this;
+		}
+		components.addLast(buffer);
+		readable += remaining;
+		return this;
+	}
+
+	/**
+	 * Moves all components of the given buffer to the end of this buffer and releases the given buffer.
+	 * @param buffer
+	 * the buffer whose readable bytes to add.
+	 * @return
+	 * this.
+	 */
+	public UCompositeBuffer add( final UCompositeBuffer buffer ) {
+		ensureAccessible();
+		UBuffer component;
+		while ((component = buffer.removeFirst())!=null) add(component);
+		buffer.release();
+		return this;
+	}
+
+	/**
+	 * Removes the first component, the reference is passed to the caller.
+	 * @return
+	 * the first component with its position at the first readable byte or null, if there are no components.
+	 */
+	public UBuffer removeFirst() {
+		ensureAccessible();
+		final UBuffer head = components.pollFirst();
+		if (head!=null) readable -= head.nio().remaining();
+		return head;
+	}
+
+	/**
+	 * Returns the amount of readable bytes.
+	 * @return
+	 * the amount of readable bytes.
+	 */
+	public int readableBytes() {
+		return readable;
+	}
+
+	/**
+	 * Returns true if there is at least one readable byte.
+	 * @return
+	 * true if there is at least one readable byte.
+	 */
+	public boolean isReadable() {
+		return readable > 0;
+	}
+
+	/**
+	 * Returns the amount of components.
+	 * @return
+	 * the amount of components.
+	 */
+	public int components() {
+		return components.size();
+	}
+
+	/**
+	 * Throws an exception if the given region is not readable.
+	 */
+	private void checkIndex( final int index, final int length ) {
+		ensureAccessible();
+		if (index < 0 || length < 0 || index + length > readable) {
+			throw new IndexOutOfBoundsException("index: "+index+", length: "+length+", readable: "+readable);
+		}
+	}
+
+	/**
+	 * Throws an exception if this buffer was released.
+	 */
+	private void ensureAccessible() {
+		final int refCnt = this.refCnt;
+		if (refCnt <= 0) throw new UIllegalReferenceCountException(refCnt, 0);
+	}
+
+	/**
+	 * Returns the byte at the given index.
+	 * @param index
+	 * the index relative to the read position.
+	 * @return
+	 * the byte.
+	 */
+	public byte getByte( final int index ) {
+		checkIndex(index, 1);
+		int offset = index;
+		for (final UBuffer component : components) {
+			final ByteBuffer buffer = component.nio();
+			final int remaining = buffer.remaining();
+			if (offset < remaining) return buffer.get(buffer.position() + offset);
+			offset -= remaining;
+		}
+		throw new IndexOutOfBoundsException("index: "+index);
+	}
+
+	/**
+	 * Returns the unsigned byte at the given index.
+	 * @param index
+	 * the index relative to the read position.
+	 * @return
+	 * the unsigned byte.
+	 */
+	public int getUnsignedByte( final int index ) {
+		return getByte(index) & 0xff;
+	}
+
+	/**
+	 * Returns the big-endian value of the given amount of bytes at the given index.
+	 */
+	private long getValue( final int index, final int length ) {
+		checkIndex(index, length);
+		long value = 0L;
+		int offset = index;
+		int needed = length;
+		for (final UBuffer component : components) {
+			final ByteBuffer buffer = component.nio();
+			final int remaining = buffer.remaining();
+			if (offset >= remaining) {
+				offset -= remaining;
+				continue;
+			}
+			int i = buffer.position() + offset;
+			final int end = buffer.limit();
+			while (needed > 0 && i < end) {
+				value = (value << 8) | (buffer.get(i++) & 0xff);
+				needed--;
+			}
+			if (needed==0) break;
+			offset = 0;
+		}
+		return value;
+	}
+
+	/**
+	 * Returns the big-endian short at the given index.
+	 * @param index
+	 * the index relative to the read position.
+	 * @return
+	 * the short.
+	 */
+	public short getShort( final int index ) {
+		return (short)getValue(index, 2);
+	}
+
+	/**
+	 * Returns the big-endian unsigned short at the given index.
+	 * @param index
+	 * the index relative to the read position.
+	 * @return
+	 * the unsigned short.
+	 */
+	public int getUnsignedShort( final int index ) {
+		return (int)getValue(index, 2);
+	}
+
+	/**
+	 * Returns the big-endian unsigned 24-bit integer at the given index.
+	 * @param index
+	 * the index relative to the read position.
+	 * @return
+	 * the unsigned 24-bit integer.
+	 */
+	public int getUnsignedMedium( final int index ) {
+		return (int)getValue(index, 3);
+	}
+
+	/**
+	 * Returns the big-endian int at the given index.
+	 * @param index
+	 * the index relative to the read position.
+	 * @return
+	 * the int.
+	 */
+	public int getInt( final int index ) {
+		return (int)getValue(index, 4);
+	}
+
+	/**
+	 * Returns the big-endian unsigned int at the given index.
+	 * @param index
+	 * the index relative to the read position.
+	 * @return
+	 * the unsigned int.
+	 */
+	public long getUnsignedInt( final int index ) {
+		return getValue(index, 4);
+	}
+
+	/**
+	 * Returns the big-endian long at the given index.
+	 * @param index
+	 * the index relative to the read position.
+	 * @return
+	 * the long.
+	 */
+	public long getLong( final int index ) {
+		return getValue(index, 8);
+	}
+
+	/**
+	 * Copies the given region into the given array without changing the read position.
+	 * @param index
+	 * the index relative to the read position.
+	 * @param dst
+	 * the destination.
+	 * @param off
+	 * the offset in the destination.
+	 * @param len
+	 * the amount of bytes to copy.
+	 */
+	public void getBytes( final int index, final byte[] dst, final int off, final int len ) {
+		checkIndex(index, len);
+		int offset = index;
+		int pos = off;
+		int needed = len;
+		for (final UBuffer component : components) {
+			if (needed==0) break;
+			final ByteBuffer buffer = component.nio();
+			final int remaining = buffer.remaining();
+			if (offset >= remaining) {
+				offset -= remaining;
+				continue;
+			}
+			final int n = Math.min(remaining - offset, needed);
+			final ByteBuffer dup = buffer.duplicate();
+			dup.position(buffer.position() + offset);
+			dup.get(dst, pos, n);
+			pos += n;
+			needed -= n;
+			offset = 0;
+		}
+	}
+
+	/**
+	 * Returns the index of the first occurrence of the given byte.
+	 * @param value
+	 * the byte to search.
+	 * @param from
+	 * the index relative to the read position at which to start.
+	 * @return
+	 * the index relative to the read position or -1, if not found.
+	 */
+	public int indexOf( final byte value, final int from ) {
+		ensureAccessible();
+		if (from >= readable) return -1;
+		int base = 0;
+		for (final UBuffer component : components) {
+			final ByteBuffer buffer = component.nio();
+			final int remaining = buffer.remaining();
+			if (from < base + remaining) {
+				final int start = buffer.position();
+				for (int i=Math.max(0, from - base); i < remaining; i++) {
+					if (buffer.get(start + i)==value) return base + i;
+				}
+			}
+			base += remaining;
+		}
+		return -1;
+	}
+
+	/**
+	 * Reads one byte.
+	 * @return
+	 * the byte.
+	 * @throws IndexOutOfBoundsException
+	 * if there is no readable byte.
+	 */
+	public byte readByte() {
+		checkIndex(0, 1);
+		final UBuffer head = components.peekFirst();
+		final byte value = head.nio().get();
+		readable--;
+		discardRead();
+		return value;
+	}
+
+	/**
+	 * Reads bytes into the given array.
+	 * @param dst
+	 * the destination.
+	 * @param off
+	 * the offset in the destination.
+	 * @param len
+	 * the amount of bytes to read.
+	 * @return
+	 * this.
+	 * @throws IndexOutOfBoundsException
+	 * if less bytes are readable.
+	 */
+	public UCompositeBuffer readBytes( final byte[] dst, final int off, final int len ) {
+		checkIndex(0, len);
+		int pos = off;
+		int needed = len;
+		while (needed > 0) {
+			final ByteBuffer buffer = components.peekFirst().nio();
+			final int n = Math.min(buffer.remaining(), needed);
+			buffer.get(dst, pos, n);
+			pos += n;
+			needed -= n;
+			readable -= n;
+			discardRead();
+		}
+		return this;
+	}
+
+	/**
+	 * Reads as many bytes as fit into the given buffer.
+	 * @param dst
+	 * the destination.
+	 * @return
+	 * the amount of bytes read.
+	 */
+	public int readBytes( final ByteBuffer dst ) {
+		ensureAccessible();
+		int total = 0;
+		while (readable > 0 && dst.hasRemaining()) {
+			final ByteBuffer buffer = components.peekFirst().nio();
+			final int n = Math.min(buffer.remaining(), dst.remaining());
+			final int limit = buffer.limit();
+			buffer.limit(buffer.position() + n);
+			dst.put(buffer);
+			buffer.limit(limit);
+			total += n;
+			readable -= n;
+			discardRead();
+		}
+		return total;
+	}
+
+	/**
+	 * Skips the given amount of bytes.
+	 * @param length
+	 * the amount of bytes to skip.
+	 * @return
+	 * this.
+	 * @throws IndexOutOfBoundsException
+	 * if less bytes are readable.
+	 */
+	public UCompositeBuffer skipBytes( final int length ) {
+		checkIndex(0, length);
+		int needed = length;
+		while (needed > 0) {
+			final ByteBuffer buffer = components.peekFirst().nio();
+			final int n = Math.min(buffer.remaining(), needed);
+			buffer.position(buffer.position() + n);
+			needed -= n;
+			readable -= n;
+			discardRead();
+		}
+		return this;
+	}
+
+	/**
+	 * Reads the given amount of bytes as a new composite buffer, which shares the memory with this buffer.
+	 * @param length
+	 * the amount of bytes to read.
+	 * @return
+	 * the new composite buffer, which must be released by the caller.
+	 * @throws IndexOutOfBoundsException
+	 * if less bytes are readable.
+	 */
+	public UCompositeBuffer readRetainedSlice( final int length ) {
+		checkIndex(0, length);
+		final UCompositeBuffer slice = new UCompositeBuffer();
+		int needed = length;
+		while (needed > 0) {
+			final UBuffer head = components.peekFirst();
+			final ByteBuffer buffer = head.nio();
+			final int n = Math.min(buffer.remaining(), needed);
+			slice.add(head.retainedSlice(buffer.position(), n));
+			buffer.position(buffer.position() + n);
+			needed -= n;
+			readable -= n;
+			discardRead();
+		}
+		return slice;
+	}
+
+	/**
+	 * Reads the given amount of bytes as a single buffer. If the bytes are within the first component, the returned
+	 * buffer is a slice of it, otherwise the bytes are copied into a buffer allocated from the given pool.
+	 * @param length
+	 * the amount of bytes to read.
+	 * @param pool
+	 * the pool to allocate from, if the bytes must be copied.
+	 * @return
+	 * the buffer with the position at the first byte, which must be released by the caller.
+	 * @throws IndexOutOfBoundsException
+	 * if less bytes are readable.
+	 */
+	public UBuffer readBuffer( final int length, final UBufferPool pool ) {
+		checkIndex(0, length);
+		final UBuffer head = components.peekFirst();
+		if (head!=null && head.nio().remaining() >= length) {
+			final ByteBuffer buffer = head.nio();
+			final UBuffer slice = head.retainedSlice(buffer.position(), length);
+			buffer.position(buffer.position() + length);
+			readable -= length;
+			discardRead();
+			return slice;
+		}
+		final UBuffer copy = pool.allocate(length);
+		readBytes(copy.nio());
+		copy.nio().flip();
+		return copy;
+	}
+
+	/**
+	 * Returns the readable bytes of all components, without changing the read position, for example for a gathering
+	 * write.
+	 * @return
+	 * duplicates of the readable parts of the components.
+	 */
+	public ByteBuffer[] nioBuffers() {
+		ensureAccessible();
+		final ByteBuffer[] buffers = new ByteBuffer[components.size()];
+		int i = 0;
+		for (final UBuffer component : components) buffers[i++] = component.nio().duplicate();
+		return buffers;
+	}
+
+	/**
+	 * Removes and releases completely read components from the head.
+	 */
+	private void discardRead() {
+		UBuffer head;
+		while ((head = components.peekFirst())!=null && !head.nio().hasRemaining()) {
+			components.pollFirst();
+			head.release();
+		}
+	}
+
+	@Override
+	public int refCnt() {
+		return refCnt;
+	}
+
+	@Override
+	public UCompositeBuffer retain() {
+		for (;;) {
+			final int refCnt = this.refCnt;
+			if (refCnt <= 0 || refCnt==Integer.MAX_VALUE) throw new UIllegalReferenceCountException(refCnt, 1);
+			if (REF_CNT.compareAndSet(this, refCnt, refCnt + 1)) return this;
+		}
+	}
+
+	/**
+	 * Decrements the reference count and releases all components, if the count dropped to zero.
+	 * @return
+	 * true if the count dropped to zero.
+	 */
+	@Override
+	public boolean release() {
+		for (;;) {
+			final int refCnt = this.refCnt;
+			if (refCnt <= 0) throw new UIllegalReferenceCountException(refCnt, -1);
+			if (REF_CNT.compareAndSet(this, refCnt, refCnt - 1)) {
+				if (refCnt > 1) return false;
+				UBuffer component;
+				while ((component = components.pollFirst())!=null) component.release();
+				readable = 0;
+				return true;
+			}
+		}
+	}
+
+	@Override
+	public String toString() {
+		return "UCompositeBuffer[components="+components.size()+", readable="+readable+", refCnt="+refCnt+"]";
+	}
+}
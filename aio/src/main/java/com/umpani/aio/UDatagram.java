@@ -0,0 +1,174 @@
+package com.umpani.aio;
+
+import java.io.IOException;
+import java.net.ProtocolFamily;
+import java.net.SocketAddress;
+import java.net.SocketOption;
+import java.nio.channels.DatagramChannel;
+import java.util.LinkedHashMap;
+import java.util.Map;
+
+/**
+ * Opens UDP sockets, every socket is served by the next loop of an {@link UEventLoopGroup} and its pipeline is set
+ * up by the {@link UChannelInitializer} of this factory. Sockets that receive multicast datagrams usually need the
+ * option {@link java.net.StandardSocketOptions#SO_REUSEADDR} and the protocol family of the group.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UDatagram {
+	/**
+	 * Create a new factory that uses the default buffer pool.
+	 * @param group
+	 * the event loops.
+	 * @param initializer
+	 * the initializer of the channels.
+	 */
+	public UDatagram( final UEventLoopGroup group, final UChannelInitializer initializer ) {
+		this(group, initializer, UBufferPool.DEFAULT);
+	}
+
+	/**
+	 * Create a new factory.
+	 * @param group
+	 * the event loops.
+	 * @param initializer
+	 * the initializer of the channels.
+	 * @param alloc
+	 * the buffer pool of the channels.
+	 */
+	public UDatagram( final UEventLoopGroup group, final UChannelInitializer initializer, final UBufferPool alloc ) {
+		this.group = group;
+		this.initializer = initializer;
+		this.alloc = alloc;
+	}
+
+	/**
+	 * The event loops.
+	 */
+	protected final UEventLoopGroup group;
+
+	/**
+	 * The initializer of the channels.
+	 */
+	protected final UChannelInitializer initializer;
+
+	/**
+	 * The buffer pool of the channels.
+	 */
+	protected final UBufferPool alloc;
+
+	/**
+	 * The options set on every new socket.
+	 */
+	private final LinkedHashMap<SocketOption<?>,Object> options = new LinkedHashMap<>();
+
+	/**
+	 * The protocol family of new sockets, null for the default of the platform.
+	 */
+	private volatile ProtocolFamily family;
+
+	/**
+	 * Sets an option that is set on every new socket before it is bound.
+	 * @param option
+	 * the option.
+	 * @param value
+	 * the value; null to remove the option.
+	 * @return
+	 * this.
+	 */
+	public <T> UDatagram setOption( final SocketOption<T> option, final T value ) {
+		synchronized (options) {
+			if (value==null) {
+				options.remove(option);
+			} else {
+				options.put(option, value);
+			}
+		}
+		return this;
+	}
+
+	/**
+	 * Sets the protocol family of new sockets, multicast sockets must use the family of their groups.
+	 * @param family
+	 * the protocol family; null for the default of the platform.
+	 * @return
+	 * this.
+	 */
+	public UDatagram setFamily( final ProtocolFamily family ) {
+		this.family = family;
+		return this;
+	}
+
+	/**
+	 * Opens a socket that is bound to the given address and may send datagrams to every address.
+	 * @param local
+	 * the local address, use port zero to bind to any free port.
+	 * @return
+	 * the future that is completed with the channel once it is bound and active.
+	 */
+	public UFuture<UDatagramChannel> bind( final SocketAddress local ) {
+		return open(local, null);
+	}
+
+	/**
+	 * Opens a socket that is bound to any free port and connected to the given address, it only exchanges datagrams
+	 * with that address.
+	 * @param remote
+	 * the remote address.
+	 * @return
+	 * the future that is completed with the channel once it is connected and active.
+	 */
+	public UFuture<UDatagramChannel> connect( final SocketAddress remote ) {
+		return open(null, remote);
+	}
+
+	/**
+	 * Opens a socket that is bound to the given address and connected to the given remote address.
+	 * @param local
+	 * the local address; null to bind to any free port.
+	 * @param remote
+	 * the remote address; null to not connect the socket.
+	 * @return
+	 * the future that is completed with the channel once it is active.
+	 */
+	@SuppressWarnings({ "unchecked", "rawtypes" })
+	public UFuture<UDatagramChannel> open( final SocketAddress local, final SocketAddress remote ) {
+		final UEventLoop loop = group.next();
+		final UPromise<UDatagramChannel> promise = new UPromise<UDatagramChannel>(loop);
+		final UDatagramChannel channel;
+		try {
+			final ProtocolFamily family = this.family;
+			final DatagramChannel datagram = family!=null ? DatagramChannel.open(family) : DatagramChannel.open();
+			try {
+				synchronized (options) {
+					for (final Map.Entry<SocketOption<?>,Object> option : options.entrySet()) {
+						datagram.setOption((SocketOption)option.getKey(), option.getValue());
+					}
+				}
+			} catch (IOException | RuntimeException e) {
+				datagram.close();
+				throw e;
+			}
+			channel = new UDatagramChannel(loop, alloc, datagram);
+		} catch (IOException | RuntimeException e) {
+			promise.fail(e);
+			return promise;
+		}
+		try {
+			loop.execute(new Runnable() {
+				@Override
+				public void run() {
+					channel.start(initializer, local, remote, promise);
+				}
+			});
+		} catch (Throwable t) {
+			try {
+				channel.javaChannel().close();
+			} catch (IOException e) {
+				// ignore, the loop rejected the channel
+			}
+			promise.fail(t);
+		}
+		return promise;
+	}
+}
@@ -0,0 +1,354 @@
+package com.umpani.aio;
+
+import java.io.IOException;
+import java.net.InetAddress;
+import java.net.NetworkInterface;
+import java.net.PortUnreachableException;
+import java.net.SocketAddress;
+import java.nio.ByteBuffer;
+import java.nio.channels.DatagramChannel;
+import java.nio.channels.MembershipKey;
+import java.nio.channels.SelectionKey;
+import java.util.ArrayList;
+import java.util.Iterator;
+
+/**
+ * A UDP socket served by an {@link UEventLoop}. Every received datagram is passed as {@link UDatagramPacket} that
+ * carries the address of the sender into the pipeline, datagrams that exceed the maximal datagram size are truncated.
+ * Written {@link UDatagramPacket}s are sent to their address, plain buffers to the connected peer. Every datagram
+ * is written either completely or not at all and a failed datagram only fails its own future, the channel stays open.
+ * Channels are created by {@link UDatagram}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UDatagramChannel extends UChannel implements UIoHandler {
+	/**
+	 * The default maximal size of received datagrams.
+	 */
+	public static final int DEFAULT_MAX_DATAGRAM_SIZE = 2048;
+
+	/**
+	 * The maximal amount of received datagrams per readiness event, to not starve other channels of the same loop.
+	 */
+	private static final int MAX_READS = 16;
+
+	/**
+	 * Create a new channel.
+	 * @param loop
+	 * the event loop that serves the channel.
+	 * @param alloc
+	 * the buffer pool of the channel.
+	 * @param channel
+	 * the datagram channel.
+	 */
+	public UDatagramChannel( final UEventLoop loop, final UBufferPool alloc, final DatagramChannel channel ) {
+		super(loop, alloc);
+		this.channel = channel;
+	}
+
+	/**
+	 * The datagram channel.
+	 */
+	private final DatagramChannel channel;
+
+	/**
+	 * The joined multicast groups.
+	 */
+	private final ArrayList<MembershipKey> memberships = new ArrayList<>();
+
+	/**
+	 * The selection key, once registered.
+	 */
+	private SelectionKey key;
+
+	/**
+	 * The maximal size of received datagrams.
+	 */
+	private volatile int maxDatagramSize = DEFAULT_MAX_DATAGRAM_SIZE;
+
+	/**
+	 * True if the channel reads automatically.
+	 */
+	private volatile boolean autoRead = true;
+
+	/**
+	 * True once the channel was activated.
+	 */
+	private volatile boolean active;
+
+	/**
+	 * Returns the datagram channel.
+	 * @return
+	 * the datagram channel.
+	 */
+	public final DatagramChannel javaChannel() {
+		return channel;
+	}
+
+	/**
+	 * Sets the maximal size of received datagrams, larger datagrams are truncated.
+	 * @param size
+	 * the size in bytes.
+	 * @return
+	 * this.
+	 */
+	public UDatagramChannel setMaxDatagramSize( final int size ) {
+		if (size <= 0) throw new IllegalArgumentException("size: "+size);
+		this.maxDatagramSize = size;
+		return this;
+	}
+
+	/**
+	 * Returns true if the channel reads automatically.
+	 * @return
+	 * true if the channel reads automatically.
+	 */
+	public boolean isAutoRead() {
+		return autoRead;
+	}
+
+	/**
+	 * Enables or disables automatic reading, while disabled received datagrams are queued by the operating system
+	 * and dropped once its buffer is full.
+	 * @param autoRead
+	 * true to read; false to stop reading.
+	 * @return
+	 * this.
+	 */
+	public UDatagramChannel setAutoRead( final boolean autoRead ) {
+		this.autoRead = autoRead;
+		final UEventLoop loop = loop();
+		if (loop.inEventLoop()) {
+			updateReadInterest();
+		} else {
+			loop.execute(new Runnable() {
+				@Override
+				public void run() {
+					updateReadInterest();
+				}
+			});
+		}
+		return this;
+	}
+
+	/**
+	 * Joins the given multicast group to receive the datagrams sent to it via the given interface.
+	 * @param group
+	 * the multicast address.
+	 * @param networkInterface
+	 * the interface on which to join the group.
+	 * @return
+	 * the membership key.
+	 * @throws IOException
+	 * if joining failed.
+	 */
+	public MembershipKey joinGroup( final InetAddress group, final NetworkInterface networkInterface ) throws IOException {
+		return joinGroup(group, networkInterface, null);
+	}
+
+	/**
+	 * Joins the given multicast group to receive the datagrams sent to it by the given source via the given
+	 * interface.
+	 * @param group
+	 * the multicast address.
+	 * @param networkInterface
+	 * the interface on which to join the group.
+	 * @param source
+	 * the source address; null to receive datagrams of all sources.
+	 * @return
+	 * the membership key.
+	 * @throws IOException
+	 * if joining failed.
+	 */
+	public MembershipKey joinGroup( final InetAddress group, final NetworkInterface networkInterface, final InetAddress source ) throws IOException {
+		final MembershipKey key = source!=null ? channel.join(group, networkInterface, source) : channel.join(group, networkInterface);
+		synchronized (memberships) {
+			if (!memberships.contains(key)) memberships.add(key);
+		}
+		return key;
+	}
+
+	/**
+	 * Leaves the given multicast group on the given interface, all source specific memberships of the group are
+	 * dropped as well.
+	 * @param group
+	 * the multicast address.
+	 * @param networkInterface
+	 * the interface on which the group was joined.
+	 * @return
+	 * true if the group was joined.
+	 */
+	public boolean leaveGroup( final InetAddress group, final NetworkInterface networkInterface ) {
+		boolean left = false;
+		synchronized (memberships) {
+			for (final Iterator<MembershipKey> it = memberships.iterator(); it.hasNext();) {
+				final MembershipKey key = it.next();
+				if (key.group().equals(group) && key.networkInterface().equals(networkInterface)) {
+					key.drop();
+					it.remove();
+					left = true;
+				}
+			}
+		}
+		return left;
+	}
+
+	@Override
+	public boolean isOpen() {
+		return channel.isOpen();
+	}
+
+	@Override
+	public boolean isActive() {
+		return active && channel.isOpen();
+	}
+
+	@Override
+	public SocketAddress localAddress() {
+		try {
+			return channel.getLocalAddress();
+		} catch (IOException e) {
+			return null;
+		}
+	}
+
+	@Override
+	public SocketAddress remoteAddress() {
+		try {
+			return channel.getRemoteAddress();
+		} catch (IOException e) {
+			return null;
+		}
+	}
+
+	/**
+	 * Initializes the pipeline, binds, connects and registers the channel. Must be called from the event loop.
+	 * @param initializer
+	 * the initializer of the pipeline, may be null.
+	 * @param local
+	 * the local address; null to bind to any free port.
+	 * @param remote
+	 * the address to connect to; null to not connect the channel.
+	 * @param promise
+	 * the promise to complete once the channel is active.
+	 */
+	final void start( final UChannelInitializer initializer, final SocketAddress local, final SocketAddress remote, final UPromise<UDatagramChannel> promise ) {
+		try {
+			if (initializer!=null) initializer.initChannel(this);
+			channel.configureBlocking(false);
+			if (channel.getLocalAddress()==null) channel.bind(local);
+			if (remote!=null) channel.connect(remote);
+			key = loop().registerNow(channel, 0, this);
+			active = true;
+			updateReadInterest();
+			fireChannelActive();
+			promise.complete(this);
+			// write what was flushed while starting
+			flushPending();
+		} catch (Throwable t) {
+			promise.fail(t);
+			closeNow(new UPromise<Void>(null));
+		}
+	}
+
+	/**
+	 * Adds or removes read interest according to the auto read flag.
+	 */
+	private void updateReadInterest() {
+		final SelectionKey key = this.key;
+		if (key==null || !key.isValid() || !active) return;
+		final int ops = key.interestOps();
+		key.interestOps(autoRead ? ops | SelectionKey.OP_READ : ops & ~SelectionKey.OP_READ);
+	}
+
+	@Override
+	protected int writeBytes( final ByteBuffer buffer ) throws IOException {
+		if (!active) return 0;
+		return channel.write(buffer);
+	}
+
+	@Override
+	protected int writeDatagram( final ByteBuffer buffer, final SocketAddress address ) throws IOException {
+		if (!active) return 0;
+		return channel.send(buffer, address);
+	}
+
+	@Override
+	protected boolean isMessageOriented() {
+		return true;
+	}
+
+	@Override
+	protected void setWriteInterest( final boolean interested ) {
+		final SelectionKey key = this.key;
+		if (key==null || !key.isValid() || !active) return;
+		final int ops = key.interestOps();
+		final int newOps = interested ? ops | SelectionKey.OP_WRITE : ops & ~SelectionKey.OP_WRITE;
+		if (newOps!=ops) key.interestOps(newOps);
+	}
+
+	@Override
+	protected void doClose() throws IOException {
+		if (key!=null) key.cancel();
+		synchronized (memberships) {
+			// closing the channel drops the memberships
+			memberships.clear();
+		}
+		channel.close();
+	}
+
+	@Override
+	public void accept( final UEventLoop loop, final SelectionKey key ) throws Exception {}
+
+	@Override
+	public void connect( final UEventLoop loop, final SelectionKey key ) throws Exception {}
+
+	@Override
+	public void read( final UEventLoop loop, final SelectionKey key ) throws Exception {
+		final UPipeline pipeline = pipeline();
+		final int size = maxDatagramSize;
+		try {
+			for (int i=0; i < MAX_READS && autoRead; i++) {
+				final UBuffer buffer = alloc().allocate(size);
+				final SocketAddress sender;
+				try {
+					sender = channel.receive(buffer.nio());
+				} catch (PortUnreachableException e) {
+					// a connected channel learned that the peer does not listen, the channel stays usable
+					buffer.release();
+					pipeline.fireExceptionCaught(e);
+					break;
+				} catch (Throwable t) {
+					buffer.release();
+					throw t;
+				}
+				if (sender==null) {
+					buffer.release();
+					break;
+				}
+				buffer.nio().flip();
+				countRead(buffer.nio().remaining());
+				pipeline.fireChannelRead(new UDatagramPacket(buffer, sender));
+				if (!channel.isOpen()) return;
+			}
+		} finally {
+			if (channel.isOpen()) pipeline.fireChannelReadComplete();
+		}
+	}
+
+	@Override
+	public void write( final UEventLoop loop, final SelectionKey key ) throws Exception {
+		flushPending();
+	}
+
+	@Override
+	public void exception( final UEventLoop loop, final SelectionKey key, final Throwable cause ) {
+		pipeline().fireExceptionCaught(cause);
+		closeNow(new UPromise<Void>(null));
+	}
+
+	@Override
+	public void closed( final UEventLoop loop, final SelectionKey key ) {
+		closeNow(new UPromise<Void>(null));
+	}
+}
@@ -0,0 +1,98 @@
+package com.umpani.aio;
+
+import java.net.SocketAddress;
+
+/**
+ * A datagram together with the address of its peer. Received datagrams carry the address of the sender, datagrams
+ * written to an {@link UDatagramChannel} the address of the recipient, which may be null if the channel is
+ * connected. The packet owns its content, retaining or releasing the packet retains or releases the content.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UDatagramPacket implements UReferenceCounted {
+	/**
+	 * Create a new packet.
+	 * @param content
+	 * the bytes of the datagram, the packet takes the ownership.
+	 * @param address
+	 * the address of the sender or recipient, may be null.
+	 * @throws NullPointerException
+	 * if the content is null.
+	 */
+	public UDatagramPacket( final UBuffer content, final SocketAddress address ) {
+		if (content==null) throw new NullPointerException("content");
+		this.content = content;
+		this.address = address;
+	}
+
+	/**
+	 * Create a new packet that wraps the given bytes.
+	 * @param content
+	 * the bytes of the datagram.
+	 * @param address
+	 * the address of the sender or recipient, may be null.
+	 */
+	public UDatagramPacket( final byte[] content, final SocketAddress address ) {
+		this(UBuffer.wrap(content), address);
+	}
+
+	/**
+	 * The bytes of the datagram.
+	 */
+	private final UBuffer content;
+
+	/**
+	 * The address of the sender or recipient.
+	 */
+	private final SocketAddress address;
+
+	/**
+	 * Returns the bytes of the datagram.
+	 * @return
+	 * the content.
+	 */
+	public UBuffer content() {
+		return content;
+	}
+
+	/**
+	 * Returns the address of the sender of a received datagram or of the recipient of a written datagram.
+	 * @return
+	 * the address, may be null.
+	 */
+	public SocketAddress address() {
+		return address;
+	}
+
+	/**
+	 * Returns a copy of the remaining bytes of the content.
+	 * @return
+	 * the bytes.
+	 */
+	public byte[] toByteArray() {
+		final byte[] bytes = new byte[content.remaining()];
+		content.nio().duplicate().get(bytes);
+		return bytes;
+	}
+
+	@Override
+	public int refCnt() {
+		return content.refCnt();
+	}
+
+	@Override
+	public UDatagramPacket retain() {
+		content.retain();
+		return this;
+	}
+
+	@Override
+	public boolean release() {
+		return content.release();
+	}
+
+	@Override
+	public String toString() {
+		return "UDatagramPacket["+content.remaining()+" bytes, address="+address+"]";
+	}
+}
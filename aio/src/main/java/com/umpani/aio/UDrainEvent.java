@@ -0,0 +1,27 @@
+package com.umpani.aio;
+
+/**
+ * The user event fired through the pipelines of the connections of a server, once the server shuts down gracefully,
+ * see {@link UServer#shutdown(long, java.util.concurrent.TimeUnit)}. Protocol handlers react by finishing the work in
+ * progress, telling the peer that the connection ends and closing the channel, like the HTTP server with a final
+ * <tt>Connection: close</tt>, a WebSocket with a close frame and the JSON-RPC server by rejecting further requests.
+ * Connections that are still open at the deadline are closed forcibly.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UDrainEvent {
+	/**
+	 * The event.
+	 */
+	public static final UDrainEvent INSTANCE = new UDrainEvent();
+
+	/**
+	 * There is only one instance.
+	 */
+	private UDrainEvent() {}
+
+	@Override
+	public String toString() {
+		return "UDrainEvent";
+	}
+}
@@ -0,0 +1,53 @@
+package com.umpani.aio;
+
+/**
+ * The outcome of a graceful shutdown, see {@link UServer#shutdown(long, java.util.concurrent.TimeUnit)}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UDrainResult {
+	/**
+	 * Create a new result.
+	 * @param drained
+	 * the amount of connections that closed before the deadline.
+	 * @param killed
+	 * the amount of connections that were closed forcibly at the deadline.
+	 */
+	public UDrainResult( final int drained, final int killed ) {
+		this.drained = drained;
+		this.killed = killed;
+	}
+
+	/**
+	 * The amount of connections that closed before the deadline.
+	 */
+	private final int drained;
+
+	/**
+	 * The amount of connections that were closed forcibly.
+	 */
+	private final int killed;
+
+	/**
+	 * Returns the amount of connections that closed before the deadline.
+	 * @return
+	 * the amount of drained connections.
+	 */
+	public int drained() {
+		return drained;
+	}
+
+	/**
+	 * Returns the amount of connections that were still open at the deadline and closed forcibly.
+	 * @return
+	 * the amount of killed connections.
+	 */
+	public int killed() {
+		return killed;
+	}
+
+	@Override
+	public String toString() {
+		return "UDrainResult[drained="+drained+", killed="+killed+"]";
+	}
+}
@@ -0,0 +1,763 @@
+package com.umpani.aio;
+
+import java.io.IOException;
+import java.nio.channels.ClosedChannelException;
+import java.nio.channels.SelectableChannel;
+import java.nio.channels.SelectionKey;
+import java.nio.channels.Selector;
+import java.util.Iterator;
+import java.util.Queue;
+import java.util.Set;
+import java.util.concurrent.ConcurrentLinkedQueue;
+import java.util.concurrent.CountDownLatch;
+import java.util.concurrent.Executor;
+import java.util.concurrent.RejectedExecutionException;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicBoolean;
+import java.util.concurrent.atomic.AtomicInteger;
+import java.util.concurrent.atomic.AtomicLong;
+
+import com.umpani.aio.metrics.UHistogram;
+import com.umpani.util.log.ULogger;
+
+/**
+ * A single threaded event loop that owns a {@link Selector} and all channels registered at it. The loop waits for
+ * channels to become ready and then invokes the {@link UIoHandler} of the channel from its own thread. Other threads
+ * may submit tasks to the loop using {@link #execute(Runnable)}, the tasks are executed by the loop thread in the
+ * order in which they were submitted, the loop is woken up if it is blocked in a select.
+ *
+ * </p><p>All state owned by an event loop, for example the channels and their handlers, must only be touched from the
+ * loop thread. Use {@link #inEventLoop()} to test whether the current thread is the loop thread and
+ * {@link #execute(Runnable)} to switch to it.
+ *
+ * </p><p>A shutdown is orderly: no new tasks are accepted, all already submitted tasks are executed, then all
+ * registered channels are closed, their handlers are notified and finally the selector is closed.
+ *
+ * </p><p>The loop counts its queued tasks, wake-ups and iterations, the latency of every iteration and the open
+ * connections and bytes of its channels. The counters are updated without locks and may be read by any thread, see
+ * {@link com.umpani.aio.metrics.UMetrics}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UEventLoop implements Executor {
+	/**
+	 * The logger of the event loops.
+	 */
+	private static final ULogger LOG = new ULogger(UEventLoop.class.getName());
+
+	/**
+	 * The state of a loop that was not yet started.
+	 */
+	protected static final int ST_NOT_STARTED = 0;
+
+	/**
+	 * The state of a running loop.
+	 */
+	protected static final int ST_STARTED = 1;
+
+	/**
+	 * The state of a loop that is shutting down.
+	 */
+	protected static final int ST_SHUTTING_DOWN = 2;
+
+	/**
+	 * The state of a terminated loop.
+	 */
+	protected static final int ST_TERMINATED = 3;
+
+	/**
+	 * The event loop of the current thread.
+	 */
+	private static final ThreadLocal<UEventLoop> CURRENT = new ThreadLocal<UEventLoop>();
+
+	/**
+	 * Returns the event loop that runs in the current thread.
+	 * @return
+	 * the event loop of the current thread or null, if the current thread is no event loop thread.
+	 */
+	public static UEventLoop current() {
+		return CURRENT.get();
+	}
+
+	/**
+	 * Create a new event loop, the loop must be started using {@link #start()}.
+	 * @param name
+	 * the name of the loop, used as thread name.
+	 * @throws IOException
+	 * if opening the selector failed.
+	 */
+	public UEventLoop( final String name ) throws IOException {
+		this(name, UClock.SYSTEM);
+	}
+
+	/**
+	 * Create a new event loop, the loop must be started using {@link #start()}.
+	 * @param name
+	 * the name of the loop, used as thread name.
+	 * @param clock
+	 * the clock used by the timers of the loop.
+	 * @throws IOException
+	 * if opening the selector failed.
+	 */
+	public UEventLoop( final String name, final UClock clock ) throws IOException {
+		this.name = name;
+		this.selector = Selector.open();
+		this.timers = new UTimerWheel(clock, 1, TimeUnit.MILLISECONDS);
+	}
+
+	/**
+	 * The name of the loop.
+	 */
+	protected final String name;
+
+	/**
+	 * The selector of this loop.
+	 */
+	protected final Selector selector;
+
+	/**
+	 * The queue of submitted tasks.
+	 */
+	private final Queue<Runnable> tasks = new ConcurrentLinkedQueue<Runnable>();
+
+	/**
+	 * The timer wheel of scheduled tasks, only accessed from the loop thread.
+	 */
+	private final UTimerWheel timers;
+
+	/**
+	 * True if the selector was already woken up and no further wakeup is needed.
+	 */
+	private final AtomicBoolean wakenUp = new AtomicBoolean();
+
+	/**
+	 * The amount of submitted but not yet executed tasks.
+	 */
+	private final AtomicInteger queuedTasks = new AtomicInteger();
+
+	/**
+	 * The amount of times the selector was woken up by another thread.
+	 */
+	private final AtomicLong wakeups = new AtomicLong();
+
+	/**
+	 * The amount of iterations of the loop, only written by the loop thread.
+	 */
+	private volatile long iterations;
+
+	/**
+	 * The time in nanoseconds it took to process the ready channels, timers and tasks of an iteration.
+	 */
+	private final UHistogram iterationLatency = new UHistogram();
+
+	/**
+	 * The amount of active channels.
+	 */
+	private final AtomicInteger openChannels = new AtomicInteger();
+
+	/**
+	 * The amount of bytes read and written by the channels.
+	 */
+	private final AtomicLong bytesRead = new AtomicLong(), bytesWritten = new AtomicLong();
+
+	/**
+	 * The amount of bytes queued by the channels to be written.
+	 */
+	private final AtomicLong pendingWriteBytes = new AtomicLong();
+
+	/**
+	 * The latch that is released once the loop terminated.
+	 */
+	private final CountDownLatch terminated = new CountDownLatch(1);
+
+	/**
+	 * The current state of the loop.
+	 */
+	protected volatile int state = ST_NOT_STARTED;
+
+	/**
+	 * The loop thread.
+	 */
+	protected volatile Thread thread;
+
+	/**
+	 * Returns the name of this loop.
+	 * @return
+	 * the name of this loop.
+	 */
+	public final String getName() {
+		return name;
+	}
+
+	/**
+	 * Returns the selector of this loop, must only be used from the loop thread.
+	 * @return
+	 * the selector of this loop.
+	 */
+	public final Selector selector() {
+		return selector;
+	}
+
+	/**
+	 * Returns true if the current thread is the thread of this loop.
+	 * @return
+	 * true if the current thread is the thread of this loop.
+	 */
+	public final boolean inEventLoop() {
+		return Thread.currentThread()==thread;
+	}
+
+	/**
+	 * Returns true if {@link #shutdown()} was called.
+	 * @return
+	 * true if {@link #shutdown()} was called.
+	 */
+	public final boolean isShuttingDown() {
+		return state >= ST_SHUTTING_DOWN;
+	}
+
+	/**
+	 * Returns true if the loop terminated.
+	 * @return
+	 * true if the loop terminated.
+	 */
+	public final boolean isTerminated() {
+		return state==ST_TERMINATED;
+	}
+
+	/**
+	 * Starts the loop thread.
+	 * @return
+	 * this.
+	 * @throws IllegalStateException
+	 * if the loop was already started.
+	 */
+	public synchronized UEventLoop start() {
+		if (state!=ST_NOT_STARTED) throw new IllegalStateException("Event loop "+name+" was already started");
+		state = ST_STARTED;
+		final Thread thread = new Thread(name) {
+			@Override
+			public void run() {
+				UEventLoop.this.run();
+			}
+		};
+		this.thread = thread;
+		thread.start();
+		return this;
+	}
+
+	/**
+	 * Makes the current thread the thread of this loop instead of starting a new one. The caller then drives the loop
+	 * itself and must call {@link #terminate()} once done, like the {@link UVirtualEventLoop}.
+	 * @throws IllegalStateException
+	 * if the loop was already started.
+	 */
+	protected final synchronized void runInCurrentThread() {
+		if (state!=ST_NOT_STARTED) throw new IllegalStateException("Event loop "+name+" was already started");
+		state = ST_STARTED;
+		thread = Thread.currentThread();
+		CURRENT.set(this);
+	}
+
+	/**
+	 * Submits the given task to be executed by the loop thread. Tasks are executed in the order of their submission.
+	 * @param task
+	 * the task to execute.
+	 * @throws RejectedExecutionException
+	 * if the loop is shutting down.
+	 * @throws NullPointerException
+	 * if the given task is null.
+	 */
+	@Override
+	public void execute( final Runnable task ) {
+		if (task==null) throw new NullPointerException("task");
+		if (state >= ST_SHUTTING_DOWN) throw new RejectedExecutionException("Event loop "+name+" is shutting down");
+		tasks.add(task);
+		queuedTasks.incrementAndGet();
+		// the loop may have terminated since the check, it drains the tasks once more after the state changed
+		if (state==ST_TERMINATED && tasks.remove(task)) {
+			queuedTasks.decrementAndGet();
+			throw new RejectedExecutionException("Event loop "+name+" is terminated");
+		}
+		if (!inEventLoop()) wakeup();
+	}
+
+	/**
+	 * Returns the timer wheel of this loop, must only be used from the loop thread. The timers are expired by the loop
+	 * before the submitted tasks are executed.
+	 * @return
+	 * the timer wheel of this loop.
+	 */
+	public final UTimerWheel timers() {
+		return timers;
+	}
+
+	/**
+	 * A task scheduled via {@link UEventLoop#schedule(Runnable, long, TimeUnit)}.
+	 */
+	private final class ScheduledTask implements Runnable {
+		ScheduledTask( final Runnable task, final UPromise<Void> promise ) {
+			this.task = task;
+			this.promise = promise;
+		}
+
+		final Runnable task;
+		final UPromise<Void> promise;
+
+		@Override
+		public void run() {
+			if (promise.isDone()) return;
+			try {
+				task.run();
+				promise.complete(null);
+			} catch (Throwable t) {
+				promise.fail(t);
+				exception(t);
+			}
+		}
+
+		/**
+		 * Adds the task to the timers and binds the cancellation of the promise to the timeout.
+		 */
+		void schedule( final long deadline ) {
+			final UTimeout timeout = timers.scheduleAt(this, deadline);
+			promise.onCancel(new Runnable() {
+				@Override
+				public void run() {
+					if (inEventLoop()) {
+						timeout.cancel();
+						return;
+					}
+					try {
+						execute(new Runnable() {
+							@Override
+							public void run() {
+								timeout.cancel();
+							}
+						});
+					} catch (RejectedExecutionException e) {
+						// the loop terminates and discards all timers
+					}
+				}
+			});
+		}
+	}
+
+	/**
+	 * Schedules the given task to be executed by the loop thread after the given delay. The returned future completes
+	 * after the task was executed, cancelling it before removes the task from the timers.
+	 * @param task
+	 * the task to execute.
+	 * @param delay
+	 * the delay.
+	 * @param unit
+	 * the unit of the delay.
+	 * @return
+	 * the future of the execution.
+	 * @throws RejectedExecutionException
+	 * if the loop is shutting down.
+	 */
+	public UFuture<Void> schedule( final Runnable task, final long delay, final TimeUnit unit ) {
+		if (task==null) throw new NullPointerException("task");
+		final ScheduledTask scheduled = new ScheduledTask(task, new UPromise<Void>(this));
+		final long now = timers.clock().nanoTime();
+		long deadline = delay > 0 ? now + unit.toNanos(delay) : now;
+		if (deadline < now) deadline = Long.MAX_VALUE;
+		final long at = deadline;
+		if (inEventLoop()) {
+			scheduled.schedule(at);
+		} else {
+			execute(new Runnable() {
+				@Override
+				public void run() {
+					scheduled.schedule(at);
+				}
+			});
+		}
+		return scheduled.promise;
+	}
+
+	/**
+	 * Returns the amount of milliseconds until the next timer may expire.
+	 * @return
+	 * the amount of milliseconds until the next timer may expire, zero if there is none or a negative value if a
+	 * timer is already due.
+	 */
+	private final long timersTimeout() {
+		final long nanos = timers.nextDelayNanos();
+		if (nanos < 0) return 0L;
+		if (nanos==0) return -1L;
+		// round up to not wake up too early
+		return TimeUnit.NANOSECONDS.toMillis(nanos + 999999L);
+	}
+
+	/**
+	 * Wakes up the loop, if it is blocked in a select.
+	 */
+	public final void wakeup() {
+		if (wakenUp.compareAndSet(false, true)) {
+			wakeups.incrementAndGet();
+			selector.wakeup();
+		}
+	}
+
+	/**
+	 * Returns the amount of submitted tasks that were not yet executed.
+	 * @return
+	 * the amount of queued tasks.
+	 */
+	public final int getQueuedTasks() {
+		return queuedTasks.get();
+	}
+
+	/**
+	 * Returns the amount of times another thread woke up the loop, for example to execute a task.
+	 * @return
+	 * the amount of wake-ups.
+	 */
+	public final long getWakeups() {
+		return wakeups.get();
+	}
+
+	/**
+	 * Returns the amount of iterations of the loop, each one a select followed by the processing of the ready
+	 * channels, the timers and the tasks.
+	 * @return
+	 * the amount of iterations.
+	 */
+	public final long getIterations() {
+		return iterations;
+	}
+
+	/**
+	 * Returns the histogram of the time in nanoseconds every iteration spent processing, a high percentile means
+	 * that a handler or task blocks the loop.
+	 * @return
+	 * the histogram of the iteration latency.
+	 */
+	public final UHistogram iterationLatency() {
+		return iterationLatency;
+	}
+
+	/**
+	 * Returns the amount of active channels served by this loop.
+	 * @return
+	 * the amount of open connections.
+	 */
+	public final int getOpenChannels() {
+		return openChannels.get();
+	}
+
+	/**
+	 * Returns the amount of bytes read by the channels of this loop.
+	 * @return
+	 * the amount of bytes read.
+	 */
+	public final long getBytesRead() {
+		return bytesRead.get();
+	}
+
+	/**
+	 * Returns the amount of bytes written by the channels of this loop.
+	 * @return
+	 * the amount of bytes written.
+	 */
+	public final long getBytesWritten() {
+		return bytesWritten.get();
+	}
+
+	/**
+	 * Returns the amount of bytes the channels of this loop queued, but not yet written.
+	 * @return
+	 * the amount of pending write bytes.
+	 */
+	public final long getPendingWriteBytes() {
+		return pendingWriteBytes.get();
+	}
+
+	/**
+	 * Counts a channel that became active or was closed, called by the channels.
+	 */
+	final void channelOpened( final int delta ) {
+		openChannels.addAndGet(delta);
+	}
+
+	/**
+	 * Counts the bytes read by a channel.
+	 */
+	final void channelRead( final long bytes ) {
+		bytesRead.addAndGet(bytes);
+	}
+
+	/**
+	 * Counts the bytes written by a channel.
+	 */
+	final void channelWritten( final long bytes ) {
+		bytesWritten.addAndGet(bytes);
+	}
+
+	/**
+	 * Counts the bytes queued or dequeued by a channel.
+	 */
+	final void channelPending( final long delta ) {
+		pendingWriteBytes.addAndGet(delta);
+	}
+
+	/**
+	 * Registers the given channel at this loop, the channel is switched into non-blocking mode. If called from outside
+	 * of the loop thread the registration is submitted as task. If the registration fails, the handler is informed
+	 * via its exception method with a null key.
+	 * @param channel
+	 * the channel to register.
+	 * @param ops
+	 * the interest set.
+	 * @param handler
+	 * the handler of the channel.
+	 */
+	public void register( final SelectableChannel channel, final int ops, final UIoHandler handler ) {
+		if (inEventLoop()) {
+			try {
+				registerNow(channel, ops, handler);
+			} catch (Throwable t) {
+				handler.exception(this, null, t);
+			}
+		} else {
+			execute(new Runnable() {
+				@Override
+				public void run() {
+					register(channel, ops, handler);
+				}
+			});
+		}
+	}
+
+	/**
+	 * Registers the given channel at this loop, must be called from within the loop thread.
+	 * @param channel
+	 * the channel to register.
+	 * @param ops
+	 * the interest set.
+	 * @param handler
+	 * the handler of the channel.
+	 * @return
+	 * the selection key.
+	 * @throws IOException
+	 * if the registration failed.
+	 * @throws IllegalStateException
+	 * if not called from the loop thread.
+	 */
+	public SelectionKey registerNow( final SelectableChannel channel, final int ops, final UIoHandler handler ) throws IOException {
+		if (!inEventLoop()) throw new IllegalStateException("Not called from the event loop thread");
+		if (state >= ST_SHUTTING_DOWN) throw new ClosedChannelException();
+		channel.configureBlocking(false);
+		return channel.register(selector, ops, handler);
+	}
+
+	/**
+	 * Initiates an orderly shutdown, already submitted tasks are executed, no new tasks are accepted. If the loop was
+	 * never started, it terminates immediately.
+	 */
+	public void shutdown() {
+		synchronized (this) {
+			if (state >= ST_SHUTTING_DOWN) return;
+			if (state==ST_NOT_STARTED) {
+				state = ST_TERMINATED;
+				closeAll();
+				terminated.countDown();
+				return;
+			}
+			state = ST_SHUTTING_DOWN;
+		}
+		wakeup();
+	}
+
+	/**
+	 * Waits until the loop terminated.
+	 * @param timeout
+	 * the maximal time to wait.
+	 * @param unit
+	 * the unit of the timeout.
+	 * @return
+	 * true if the loop terminated; false if the timeout elapsed before.
+	 * @throws InterruptedException
+	 * if the current thread was interrupted.
+	 */
+	public boolean awaitTermination( final long timeout, final TimeUnit unit ) throws InterruptedException {
+		return terminated.await(timeout, unit);
+	}
+
+	/**
+	 * Returns the amount of milliseconds the loop may block in select, if there are no tasks. The default
+	 * implementation returns zero, which means to block until woken up.
+	 * @return
+	 * the maximal amount of milliseconds to block, zero to block until woken up or a negative value to not block.
+	 */
+	protected long selectTimeout() {
+		return 0L;
+	}
+
+	/**
+	 * Called by the loop thread in every iteration after the selected keys were processed and before the tasks are
+	 * executed. The default implementation does nothing.
+	 */
+	protected void beforeTasks() {}
+
+	/**
+	 * Called if a task or the loop itself threw an exception, the default implementation logs it.
+	 * @param t
+	 * the exception.
+	 */
+	protected void exception( final Throwable t ) {
+		LOG.error("Unexpected exception in event loop", "loop", name, t);
+	}
+
+	/**
+	 * The loop.
+	 */
+	protected void run() {
+		CURRENT.set(this);
+		try {
+			while (state < ST_SHUTTING_DOWN) {
+				try {
+					runOnce();
+				} catch (Throwable t) {
+					exception(t);
+				}
+			}
+			// orderly shutdown, execute the remaining tasks
+			runTasks();
+		} finally {
+			terminate();
+		}
+	}
+
+	/**
+	 * Closes all channels, cancels all timers and marks the loop as terminated, must be called by the loop thread
+	 * once the loop ended.
+	 */
+	protected final void terminate() {
+		closeAll();
+		state = ST_TERMINATED;
+		// tasks submitted while the loop terminated, later submissions are rejected
+		runTasks();
+		CURRENT.remove();
+		terminated.countDown();
+	}
+
+	/**
+	 * Executes one iteration of the loop: select, process the ready channels and execute the tasks.
+	 * @throws IOException
+	 * if the select failed.
+	 */
+	protected void runOnce() throws IOException {
+		wakenUp.set(false);
+		if (tasks.isEmpty()) {
+			long timeout = selectTimeout();
+			final long timersTimeout = timersTimeout();
+			if (timersTimeout!=0 && (timeout==0 || (timeout > 0 && timersTimeout < timeout))) timeout = timersTimeout;
+			if (timeout < 0) {
+				selector.selectNow();
+			} else {
+				selector.select(timeout);
+			}
+		} else {
+			selector.selectNow();
+		}
+		// avoid further wakeup calls, we are awake
+		wakenUp.set(true);
+		final long start = System.nanoTime();
+		processSelectedKeys();
+		try {
+			timers.expire();
+		} catch (Throwable t) {
+			exception(t);
+		}
+		beforeTasks();
+		runTasks();
+		iterationLatency.record(System.nanoTime() - start);
+		iterations++;
+	}
+
+	/**
+	 * Processes all selected keys.
+	 */
+	private final void processSelectedKeys() {
+		final Set<SelectionKey> selectedKeys = selector.selectedKeys();
+		if (selectedKeys.isEmpty()) return;
+		final Iterator<SelectionKey> it = selectedKeys.iterator();
+		while (it.hasNext()) {
+			final SelectionKey key = it.next();
+			it.remove();
+			final UIoHandler handler = (UIoHandler)key.attachment();
+			try {
+				if (!key.isValid()) continue;
+				final int readyOps = key.readyOps();
+				if ((readyOps & SelectionKey.OP_CONNECT)!=0) {
+					// the connect must be finished before reading or writing
+					key.interestOps(key.interestOps() & ~SelectionKey.OP_CONNECT);
+					handler.connect(this, key);
+				}
+				if ((readyOps & SelectionKey.OP_ACCEPT)!=0 && key.isValid()) handler.accept(this, key);
+				if ((readyOps & SelectionKey.OP_WRITE)!=0 && key.isValid()) handler.write(this, key);
+				if ((readyOps & SelectionKey.OP_READ)!=0 && key.isValid()) handler.read(this, key);
+			} catch (Throwable t) {
+				handler.exception(this, key, t);
+			}
+		}
+	}
+
+	/**
+	 * Executes all submitted tasks.
+	 * @return
+	 * the amount of executed tasks.
+	 */
+	protected final int runTasks() {
+		final Queue<Runnable> tasks = this.tasks;
+		int count = 0;
+		Runnable task;
+		while ((task = tasks.poll())!=null) {
+			queuedTasks.decrementAndGet();
+			try {
+				task.run();
+			} catch (Throwable t) {
+				exception(t);
+			}
+			count++;
+		}
+		return count;
+	}
+
+	/**
+	 * Closes all channels registered at the selector, notifies their handlers and closes the selector.
+	 */
+	private final void closeAll() {
+		for (final Runnable task : timers.clear()) {
+			if (task instanceof ScheduledTask) ((ScheduledTask)task).promise.cancel(false);
+		}
+		try {
+			for (final SelectionKey key : selector.keys()) {
+				try {
+					key.channel().close();
+				} catch (IOException e) {
+					// ignore, we are shutting down
+				}
+				final Object attachment = key.attachment();
+				if (attachment instanceof UIoHandler) {
+					try {
+						((UIoHandler)attachment).closed(this, key);
+					} catch (Throwable t) {
+						exception(t);
+					}
+				}
+			}
+			selector.close();
+		} catch (Throwable t) {
+			exception(t);
+		}
+	}
+
+	@Override
+	public String toString() {
+		return "UEventLoop["+name+"]";
+	}
+}
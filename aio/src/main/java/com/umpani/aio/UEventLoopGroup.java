@@ -0,0 +1,148 @@
+package com.umpani.aio;
+
+import java.io.IOException;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicInteger;
+
+/**
+ * A group of event loops, new channels are distributed round-robin across the loops using {@link #next()}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UEventLoopGroup {
+	/**
+	 * Create a new group of event loops and start all loops.
+	 * @param name
+	 * the name of the group, the loops are named <tt>name-0</tt>, <tt>name-1</tt> and so on.
+	 * @param size
+	 * the amount of loops, if zero or less the amount of available processors is used.
+	 * @throws IOException
+	 * if creating any loop failed.
+	 */
+	public UEventLoopGroup( final String name, int size ) throws IOException {
+		if (size <= 0) size = Runtime.getRuntime().availableProcessors();
+		this.name = name;
+		this.loops = new UEventLoop[size];
+		try {
+			for (int i=0; i < size; i++) loops[i] = newLoop(name+"-"+i);
+		} catch (IOException e) {
+			shutdown();
+			throw e;
+		}
+		for (final UEventLoop loop : loops) loop.start();
+	}
+
+	/**
+	 * The name of the group.
+	 */
+	protected final String name;
+
+	/**
+	 * The loops of this group.
+	 */
+	protected final UEventLoop[] loops;
+
+	/**
+	 * The index of the next loop to return.
+	 */
+	private final AtomicInteger next = new AtomicInteger();
+
+	/**
+	 * Creates a new loop of this group, may be overridden to create loops of another type.
+	 * @param name
+	 * the name of the loop.
+	 * @return
+	 * the new loop.
+	 * @throws IOException
+	 * if creating the loop failed.
+	 */
+	protected UEventLoop newLoop( final String name ) throws IOException {
+		return new UEventLoop(name);
+	}
+
+	/**
+	 * Returns the amount of loops in this group.
+	 * @return
+	 * the amount of loops in this group.
+	 */
+	public final int size() {
+		return loops.length;
+	}
+
+	/**
+	 * Returns the loop with the given index.
+	 * @param index
+	 * the index of the loop.
+	 * @return
+	 * the loop.
+	 */
+	public final UEventLoop get( final int index ) {
+		return loops[index];
+	}
+
+	/**
+	 * Returns the next loop, round-robin.
+	 * @return
+	 * the next loop.
+	 */
+	public UEventLoop next() {
+		return loops[(next.getAndIncrement() & Integer.MAX_VALUE) % loops.length];
+	}
+
+	/**
+	 * Initiates an orderly shutdown of all loops.
+	 */
+	public void shutdown() {
+		for (final UEventLoop loop : loops) {
+			if (loop!=null) loop.shutdown();
+		}
+	}
+
+	/**
+	 * Shuts the given groups down in dependency order: every group is shut down only after the previous one terminated,
+	 * so that the loops of a group can still use the loops of the following groups while they shut down, like the
+	 * loops of a server that call other services with the loops of a client group. Once the timeout elapsed the
+	 * remaining groups are shut down without waiting.
+	 * @param timeout
+	 * the maximal time to wait for all groups.
+	 * @param unit
+	 * the unit of the timeout.
+	 * @param groups
+	 * the groups, the dependent groups first.
+	 * @return
+	 * true if all groups terminated; false if the timeout elapsed before.
+	 * @throws InterruptedException
+	 * if the current thread was interrupted.
+	 */
+	public static boolean shutdown( final long timeout, final TimeUnit unit, final UEventLoopGroup... groups ) throws InterruptedException {
+		final long deadline = System.nanoTime() + unit.toNanos(timeout);
+		boolean terminated = true;
+		for (final UEventLoopGroup group : groups) {
+			group.shutdown();
+			if (terminated) terminated = group.awaitTermination(deadline - System.nanoTime(), TimeUnit.NANOSECONDS);
+		}
+		return terminated;
+	}
+
+	/**
+	 * Waits until all loops terminated.
+	 * @param timeout
+	 * the maximal time to wait.
+	 * @param unit
+	 * the unit of the timeout.
+	 * @return
+	 * true if all loops terminated; false if the timeout elapsed before.
+	 * @throws InterruptedException
+	 * if the current thread was interrupted.
+	 */
+	public boolean awaitTermination( final long timeout, final TimeUnit unit ) throws InterruptedException {
+		final long deadline = System.nanoTime() + unit.toNanos(timeout);
+		for (final UEventLoop loop : loops) {
+			if (loop==null) continue;
+			final long remaining = deadline - System.nanoTime();
+			if (remaining <= 0 && !loop.isTerminated()) return false;
+			if (!loop.awaitTermination(remaining, TimeUnit.NANOSECONDS)) return false;
+		}
+		return true;
+	}
+}
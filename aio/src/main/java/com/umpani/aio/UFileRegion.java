@@ -0,0 +1,256 @@
+package com.umpani.aio;
+
+import java.io.EOFException;
+import java.io.IOException;
+import java.nio.ByteBuffer;
+import java.nio.channels.FileChannel;
+import java.nio.channels.WritableByteChannel;
+import java.nio.file.Path;
+import java.nio.file.StandardOpenOption;
+import java.util.concurrent.atomic.AtomicIntegerFieldUpdater;
+
+import com.umpani.aio.exception.UIllegalReferenceCountException;
+
+/**
+ * A region of a file that is written to a {@link UChannel} without copying it into the memory of the JVM, the bytes
+ * are transferred with {@link FileChannel#transferTo(long, long, WritableByteChannel)}, which lets the operating
+ * system send them directly from the file cache to the socket. The region tracks how many bytes were transferred, so
+ * it can only be written once.
+ *
+ * </p><p>The region is reference counted like a buffer. If it was opened with {@link #open(Path, long, long)}, the
+ * file is closed once the region is released, otherwise the file is owned by the caller.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UFileRegion implements UReferenceCounted {
+	/**
+	 * The updater of the reference count.
+	 */
+	private static final AtomicIntegerFieldUpdater<UFileRegion> REF_CNT = AtomicIntegerFieldUpdater.newUpdater(UFileRegion.class, "refCnt");
+
+	/**
+	 * Create a new region of a file that is owned by the caller.
+	 * @param file
+	 * the file.
+	 * @param position
+	 * the position of the first byte.
+	 * @param count
+	 * the amount of bytes.
+	 */
+	public UFileRegion( final FileChannel file, final long position, final long count ) {
+		this(file, position, count, false);
+	}
+
+	/**
+	 * Create a new region.
+	 */
+	private UFileRegion( final FileChannel file, final long position, final long count, final boolean owned ) {
+		if (file==null) throw new NullPointerException("file");
+		if (position < 0 || count < 0) throw new IllegalArgumentException("position: "+position+", count: "+count);
+		this.file = file;
+		this.position = position;
+		this.count = count;
+		this.owned = owned;
+	}
+
+	/**
+	 * Opens the given file for reading and returns a region of it, the file is closed once the region is released.
+	 * @param path
+	 * the path of the file.
+	 * @param position
+	 * the position of the first byte.
+	 * @param count
+	 * the amount of bytes.
+	 * @return
+	 * the region.
+	 * @throws IOException
+	 * if the file could not be opened.
+	 */
+	public static UFileRegion open( final Path path, final long position, final long count ) throws IOException {
+		final FileChannel file = FileChannel.open(path, StandardOpenOption.READ);
+		try {
+			return new UFileRegion(file, position, count, true);
+		} catch (RuntimeException e) {
+			file.close();
+			throw e;
+		}
+	}
+
+	/**
+	 * Opens the given file for reading and returns a region of the whole file.
+	 * @param path
+	 * the path of the file.
+	 * @return
+	 * the region.
+	 * @throws IOException
+	 * if the file could not be opened.
+	 */
+	public static UFileRegion open( final Path path ) throws IOException {
+		final FileChannel file = FileChannel.open(path, StandardOpenOption.READ);
+		return new UFileRegion(file, 0, file.size(), true);
+	}
+
+	/**
+	 * The file.
+	 */
+	private final FileChannel file;
+
+	/**
+	 * The position of the first byte.
+	 */
+	private final long position;
+
+	/**
+	 * The amount of bytes.
+	 */
+	private final long count;
+
+	/**
+	 * True if the file is closed once the region is released.
+	 */
+	private final boolean owned;
+
+	/**
+	 * The amount of transferred bytes.
+	 */
+	private long transferred;
+
+	/**
+	 * The reference count.
+	 */
+	private volatile int refCnt = 1;
+
+	/**
+	 * Returns the file.
+	 * @return
+	 * the file.
+	 */
+	public FileChannel file() {
+		return file;
+	}
+
+	/**
+	 * Returns the position of the first byte in the file.
+	 * @return
+	 * the position.
+	 */
+	public long position() {
+		return position;
+	}
+
+	/**
+	 * Returns the amount of bytes of the region.
+	 * @return
+	 * the amount of bytes.
+	 */
+	public long count() {
+		return count;
+	}
+
+	/**
+	 * Returns the amount of bytes already transferred.
+	 * @return
+	 * the amount of transferred bytes.
+	 */
+	public long transferred() {
+		return transferred;
+	}
+
+	/**
+	 * Returns the amount of bytes not yet transferred.
+	 * @return
+	 * the amount of remaining bytes.
+	 */
+	public long remaining() {
+		return count - transferred;
+	}
+
+	/**
+	 * Transfers as many of the remaining bytes to the given target as it accepts without blocking.
+	 * @param target
+	 * the target.
+	 * @return
+	 * the amount of transferred bytes.
+	 * @throws IOException
+	 * if the transfer failed or the file ends before the region.
+	 */
+	public long transferTo( final WritableByteChannel target ) throws IOException {
+		final long remaining = remaining();
+		if (remaining==0) return 0;
+		final long n = file.transferTo(position + transferred, remaining, target);
+		if (n==0) checkSize();
+		transferred += n;
+		return n;
+	}
+
+	/**
+	 * Reads the next remaining bytes into the given buffer, used if the bytes have to be processed before they are
+	 * written, for example to encrypt them.
+	 * @param dst
+	 * the buffer to read into.
+	 * @return
+	 * the amount of read bytes.
+	 * @throws IOException
+	 * if reading failed or the file ends before the region.
+	 */
+	public int read( final ByteBuffer dst ) throws IOException {
+		final long remaining = remaining();
+		if (remaining==0 || !dst.hasRemaining()) return 0;
+		final int limit = dst.limit();
+		if (dst.remaining() > remaining) dst.limit(dst.position() + (int)remaining);
+		final int n;
+		try {
+			n = file.read(dst, position + transferred);
+		} finally {
+			dst.limit(limit);
+		}
+		if (n < 0) throw new EOFException("File ends before the region "+this);
+		transferred += n;
+		return n;
+	}
+
+	/**
+	 * Fails if the file was truncated, so that the remaining bytes can't be transferred.
+	 */
+	private void checkSize() throws IOException {
+		if (file.size() <= position + transferred) throw new EOFException("File ends before the region "+this);
+	}
+
+	@Override
+	public int refCnt() {
+		return refCnt;
+	}
+
+	@Override
+	public UFileRegion retain() {
+		for (;;) {
+			final int refCnt = this.refCnt;
+			if (refCnt <= 0 || refCnt==Integer.MAX_VALUE) throw new UIllegalReferenceCountException(refCnt, 1);
+			if (REF_CNT.compareAndSet(this, refCnt, refCnt + 1)) return this;
+		}
+	}
+
+	@Override
+	public boolean release() {
+		for (;;) {
+			final int refCnt = this.refCnt;
+			if (refCnt <= 0) throw new UIllegalReferenceCountException(refCnt, -1);
+			if (REF_CNT.compareAndSet(this, refCnt, refCnt - 1)) {
+				if (refCnt > 1) return false;
+				if (owned) {
+					try {
+						file.close();
+					} catch (IOException e) {
+						// nothing was written to the file
+					}
+				}
+				return true;
+			}
+		}
+	}
+
+	@Override
+	public String toString() {
+		return "UFileRegion[position="+position+", count="+count+", transferred="+transferred+"]";
+	}
+}
@@ -0,0 +1,23 @@
+package com.umpani.aio;
+
+/**
+ * A function that converts a value into another value, used by the combinators of {@link UFuture}.
+ *
+ * @param <A>
+ * the argument type.
+ * @param <R>
+ * the result type.
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface UFunction<A,R> {
+	/**
+	 * Applies this function to the given value.
+	 * @param value
+	 * the value.
+	 * @return
+	 * the result.
+	 * @throws Exception
+	 * if the function failed, the resulting future fails with this exception.
+	 */
+	public R apply( final A value ) throws Exception;
+}
@@ -0,0 +1,795 @@
+package com.umpani.aio;
+
+import java.util.ArrayList;
+import java.util.Arrays;
+import java.util.Collection;
+import java.util.List;
+import java.util.concurrent.CancellationException;
+import java.util.concurrent.ExecutionException;
+import java.util.concurrent.Executor;
+import java.util.concurrent.Future;
+import java.util.concurrent.RejectedExecutionException;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.TimeoutException;
+import java.util.concurrent.atomic.AtomicInteger;
+import java.util.concurrent.atomic.AtomicReference;
+
+import com.umpani.aio.exception.UBlockingOperationException;
+import com.umpani.util.log.ULogger;
+
+/**
+ * The result of an asynchronous operation. A future is completed exactly once, either successfully with a value,
+ * with a failure or by cancellation. Listeners added to the future are invoked once it completes, using the executor
+ * of the future, which by default is the event loop that created it. The combinators <tt>then</tt>, <tt>map</tt>,
+ * <tt>flatMap</tt> and <tt>recover</tt> return new futures, cancelling such a derived future cancels the future it
+ * was derived from, so a cancellation propagates back to the operation that is performed, for example a pending
+ * channel operation.
+ *
+ * </p><p>Blocking methods like {@link #await()} and {@link #get()} throw an {@link UBlockingOperationException} if
+ * they are called from an event loop thread and the future is not yet done, because blocking the loop would most
+ * likely cause a deadlock.
+ *
+ * </p><p>A future can only be completed by its creator, using the {@link UPromise} sub-class.
+ *
+ * @param <T>
+ * the result type.
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UFuture<T> implements Future<T> {
+	/**
+	 * The logger of the futures.
+	 */
+	private static final ULogger LOG = new ULogger(UFuture.class.getName());
+
+	/**
+	 * The result stored if the future was completed with null.
+	 */
+	private static final Object NULL = new Object();
+
+	/**
+	 * The result stored if the future failed.
+	 */
+	private static final class Failure {
+		Failure( final Throwable cause ) {
+			this.cause = cause;
+		}
+
+		/**
+		 * The cause of the failure.
+		 */
+		final Throwable cause;
+	}
+
+	/**
+	 * Create a new future.
+	 * @param executor
+	 * the executor used to invoke listeners, if null listeners are invoked by the thread that completes the future
+	 * or, if already completed, by the thread that adds the listener.
+	 */
+	protected UFuture( final Executor executor ) {
+		this.executor = executor;
+	}
+
+	/**
+	 * The executor used to invoke listeners.
+	 */
+	protected final Executor executor;
+
+	/**
+	 * The result, null while pending.
+	 */
+	private volatile Object result;
+
+	/**
+	 * The registered listeners alternating with their executors, guarded by this.
+	 */
+	private ArrayList<Object> listeners;
+
+	/**
+	 * The handler to invoke on cancellation, guarded by this.
+	 */
+	private Runnable cancelHandler;
+
+	/**
+	 * Returns a future that is already completed with the given value.
+	 * @param value
+	 * the value.
+	 * @return
+	 * the completed future.
+	 */
+	public static <T> UFuture<T> succeeded( final T value ) {
+		final UPromise<T> promise = new UPromise<T>(null);
+		promise.complete(value);
+		return promise;
+	}
+
+	/**
+	 * Returns a future that already failed with the given cause.
+	 * @param cause
+	 * the cause of the failure.
+	 * @return
+	 * the failed future.
+	 */
+	public static <T> UFuture<T> failed( final Throwable cause ) {
+		final UPromise<T> promise = new UPromise<T>(null);
+		promise.fail(cause);
+		return promise;
+	}
+
+	/**
+	 * Returns the executor used to invoke listeners.
+	 * @return
+	 * the executor used to invoke listeners, may be null.
+	 */
+	public final Executor executor() {
+		return executor;
+	}
+
+	@Override
+	public final boolean isDone() {
+		return result!=null;
+	}
+
+	/**
+	 * Returns true if this future completed successfully.
+	 * @return
+	 * true if this future completed successfully.
+	 */
+	public final boolean isSuccess() {
+		final Object result = this.result;
+		return result!=null && !(result instanceof Failure);
+	}
+
+	@Override
+	public final boolean isCancelled() {
+		final Object result = this.result;
+		return result instanceof Failure && ((Failure)result).cause instanceof CancellationException;
+	}
+
+	/**
+	 * Returns the cause of the failure.
+	 * @return
+	 * the cause of the failure or null, if this future is not done or succeeded.
+	 */
+	public final Throwable cause() {
+		final Object result = this.result;
+		return result instanceof Failure ? ((Failure)result).cause : null;
+	}
+
+	/**
+	 * Returns the value without blocking.
+	 * @return
+	 * the value or null, if this future is not done or failed.
+	 */
+	@SuppressWarnings("unchecked")
+	public final T getNow() {
+		final Object result = this.result;
+		return (result==null || result==NULL || result instanceof Failure) ? null : (T)result;
+	}
+
+	/**
+	 * Completes this future successfully.
+	 * @param value
+	 * the value.
+	 * @return
+	 * true if this future was completed; false if it was already done.
+	 */
+	protected final boolean setValue( final T value ) {
+		return setResult(value==null ? NULL : value);
+	}
+
+	/**
+	 * Completes this future with a failure.
+	 * @param cause
+	 * the cause of the failure.
+	 * @return
+	 * true if this future was completed; false if it was already done.
+	 * @throws NullPointerException
+	 * if the given cause is null.
+	 */
+	protected final boolean setFailure( final Throwable cause ) {
+		if (cause==null) throw new NullPointerException("cause");
+		return setResult(new Failure(cause));
+	}
+
+	/**
+	 * Completes this future with the result of the given future, which must be done.
+	 * @param other
+	 * the done future whose result to copy.
+	 * @return
+	 * true if this future was completed; false if it was already done.
+	 * @throws IllegalStateException
+	 * if the given future is not done.
+	 */
+	protected final boolean setResultOf( final UFuture<? extends T> other ) {
+		final Object result = other.result;
+		if (result==null) throw new IllegalStateException("The given future is not done");
+		return setResult(result);
+	}
+
+	/**
+	 * Stores the result and notifies waiters and listeners.
+	 * @param result
+	 * the result.
+	 * @return
+	 * true if the result was stored; false if the future was already done.
+	 */
+	private final boolean setResult( final Object result ) {
+		return setResult(result, false);
+	}
+
+	/**
+	 * Stores the result and notifies waiters and listeners, then invokes the cancel handler, if requested.
+	 * @param result
+	 * the result.
+	 * @param cancel
+	 * true to invoke the cancel handler.
+	 * @return
+	 * true if the result was stored; false if the future was already done.
+	 */
+	private final boolean setResult( final Object result, final boolean cancel ) {
+		final ArrayList<Object> listeners;
+		final Runnable handler;
+		synchronized (this) {
+			if (this.result!=null) return false;
+			this.result = result;
+			listeners = this.listeners;
+			this.listeners = null;
+			// taken together with the result, a handler set afterwards is invoked by setCancelHandler
+			handler = cancel ? cancelHandler : null;
+			if (cancel || !(result instanceof Failure && ((Failure)result).cause instanceof CancellationException)) {
+				cancelHandler = null;
+			}
+			notifyAll();
+		}
+		if (listeners!=null) {
+			for (int i=0; i < listeners.size(); i+=2) {
+				@SuppressWarnings("unchecked")
+				final UFutureListener<T> listener = (UFutureListener<T>)listeners.get(i);
+				dispatch(listener, (Executor)listeners.get(i+1));
+			}
+		}
+		if (handler!=null) {
+			try {
+				handler.run();
+			} catch (Throwable t) {
+				report(t);
+			}
+		}
+		return true;
+	}
+
+	/**
+	 * Sets the handler to invoke if this future is cancelled, replacing the current one. If this future was already
+	 * cancelled, the handler is invoked immediately.
+	 * @param handler
+	 * the handler.
+	 */
+	protected final void setCancelHandler( final Runnable handler ) {
+		synchronized (this) {
+			if (result==null) {
+				cancelHandler = handler;
+				return;
+			}
+		}
+		if (isCancelled() && handler!=null) handler.run();
+	}
+
+	/**
+	 * Cancels this future, if it is not yet done. The cancel handler is invoked, which normally cancels the operation
+	 * whose result this future is.
+	 * @param mayInterruptIfRunning
+	 * ignored.
+	 * @return
+	 * true if this future was cancelled; false if it was already done.
+	 */
+	@Override
+	public boolean cancel( final boolean mayInterruptIfRunning ) {
+		return setResult(new Failure(new CancellationException()), true);
+	}
+
+	/**
+	 * Adds a listener that is invoked using the executor of this future once this future is done. If this future is
+	 * already done, the listener is invoked immediately.
+	 * @param listener
+	 * the listener.
+	 * @return
+	 * this.
+	 */
+	public final UFuture<T> addListener( final UFutureListener<T> listener ) {
+		return addListener(listener, executor);
+	}
+
+	/**
+	 * Adds a listener that is invoked using the given executor once this future is done. If this future is already
+	 * done, the listener is invoked immediately.
+	 * @param listener
+	 * the listener.
+	 * @param executor
+	 * the executor to use or null, to invoke the listener by the thread that completes the future.
+	 * @return
+	 * this.
+	 */
+	public final UFuture<T> addListener( final UFutureListener<T> listener, final Executor executor ) {
+		if (listener==null) throw new NullPointerException("listener");
+		synchronized (this) {
+			if (result==null) {
+				if (listeners==null) listeners = new ArrayList<Object>(4);
+				listeners.add(listener);
+				listeners.add(executor);
+				return this;
+			}
+		}
+		dispatch(listener, executor);
+		return this;
+	}
+
+	/**
+	 * Invokes the given listener using the given executor.
+	 */
+	private final void dispatch( final UFutureListener<T> listener, final Executor executor ) {
+		if (executor==null || (executor instanceof UEventLoop && ((UEventLoop)executor).inEventLoop())) {
+			invoke(listener);
+			return;
+		}
+		try {
+			executor.execute(new Runnable() {
+				@Override
+				public void run() {
+					invoke(listener);
+				}
+			});
+		} catch (RejectedExecutionException e) {
+			// the executor is shut down, we must not lose the notification
+			invoke(listener);
+		}
+	}
+
+	/**
+	 * Invokes the given listener and reports its exceptions.
+	 */
+	private final void invoke( final UFutureListener<T> listener ) {
+		try {
+			listener.complete(this);
+		} catch (Throwable t) {
+			report(t);
+		}
+	}
+
+	/**
+	 * Reports an exception thrown by a listener or cancel handler.
+	 */
+	private static final void report( final Throwable t ) {
+		final UEventLoop loop = UEventLoop.current();
+		if (loop!=null) {
+			loop.exception(t);
+		} else {
+			LOG.error("Unexpected exception in a future listener", t);
+		}
+	}
+
+	/**
+	 * Throws an exception if the current thread is an event loop thread.
+	 */
+	private static final void checkDeadlock() {
+		final UEventLoop loop = UEventLoop.current();
+		if (loop!=null) throw new UBlockingOperationException("Blocking wait called from event loop "+loop.getName());
+	}
+
+	/**
+	 * Waits until this future is done.
+	 * @return
+	 * this.
+	 * @throws InterruptedException
+	 * if the current thread was interrupted.
+	 * @throws UBlockingOperationException
+	 * if called from an event loop thread and this future is not yet done.
+	 */
+	public UFuture<T> await() throws InterruptedException {
+		if (result!=null) return this;
+		checkDeadlock();
+		synchronized (this) {
+			while (result==null) wait();
+		}
+		return this;
+	}
+
+	/**
+	 * Waits until this future is done or the timeout elapsed.
+	 * @param timeout
+	 * the maximal time to wait.
+	 * @param unit
+	 * the unit of the timeout.
+	 * @return
+	 * true if this future is done; false if the timeout elapsed before.
+	 * @throws InterruptedException
+	 * if the current thread was interrupted.
+	 * @throws UBlockingOperationException
+	 * if called from an event loop thread and this future is not yet done.
+	 */
+	public boolean await( final long timeout, final TimeUnit unit ) throws InterruptedException {
+		if (result!=null) return true;
+		checkDeadlock();
+		final long deadline = System.nanoTime() + unit.toNanos(timeout);
+		synchronized (this) {
+			while (result==null) {
+				final long remaining = deadline - System.nanoTime();
+				if (remaining <= 0) return false;
+				TimeUnit.NANOSECONDS.timedWait(this, remaining);
+			}
+		}
+		return true;
+	}
+
+	@Override
+	public T get() throws InterruptedException, ExecutionException {
+		await();
+		return reportGet();
+	}
+
+	@Override
+	public T get( final long timeout, final TimeUnit unit ) throws InterruptedException, ExecutionException, TimeoutException {
+		if (!await(timeout, unit)) throw new TimeoutException();
+		return reportGet();
+	}
+
+	/**
+	 * Returns the value or throws the failure the way defined by {@link Future#get()}.
+	 */
+	@SuppressWarnings("unchecked")
+	private final T reportGet() throws ExecutionException {
+		final Object result = this.result;
+		if (result instanceof Failure) {
+			final Throwable cause = ((Failure)result).cause;
+			if (cause instanceof CancellationException) throw (CancellationException)cause;
+			throw new ExecutionException(cause);
+		}
+		return result==NULL ? null : (T)result;
+	}
+
+	/**
+	 * Returns a handler that cancels this future.
+	 */
+	private final Runnable cancelThis() {
+		return new Runnable() {
+			@Override
+			public void run() {
+				cancel(false);
+			}
+		};
+	}
+
+	/**
+	 * Returns a new future that completes with the result of one of the given functions. If this future succeeds,
+	 * the success function is applied to the value; if this future fails, the failure function is applied to the
+	 * cause. A null success function passes the value unchanged, a null failure function passes the failure
+	 * unchanged. The functions are invoked using the executor of this future.
+	 * @param onSuccess
+	 * the function to apply to the value or null.
+	 * @param onFailure
+	 * the function to apply to the cause of a failure or null.
+	 * @return
+	 * the new future.
+	 */
+	public final <R> UFuture<R> then( final UFunction<? super T, ? extends R> onSuccess, final UFunction<? super Throwable, ? extends R> onFailure ) {
+		final UPromise<R> promise = new UPromise<R>(executor);
+		promise.onCancel(cancelThis());
+		addListener(new UFutureListener<T>() {
+			@SuppressWarnings("unchecked")
+			@Override
+			public void complete( final UFuture<T> future ) {
+				if (promise.isDone()) return;
+				final Throwable cause = future.cause();
+				try {
+					if (cause==null) {
+						if (onSuccess==null) {
+							promise.complete((R)future.getNow());
+						} else {
+							promise.complete(onSuccess.apply(future.getNow()));
+						}
+					} else {
+						if (onFailure==null) {
+							promise.fail(cause);
+						} else {
+							promise.complete(onFailure.apply(cause));
+						}
+					}
+				} catch (Throwable t) {
+					promise.fail(t);
+				}
+			}
+		});
+		return promise;
+	}
+
+	/**
+	 * Returns a new future that completes with the value of this future converted by the given function. If this
+	 * future fails, the new future fails with the same cause.
+	 * @param fn
+	 * the function to apply to the value.
+	 * @return
+	 * the new future.
+	 */
+	public final <R> UFuture<R> map( final UFunction<? super T, ? extends R> fn ) {
+		if (fn==null) throw new NullPointerException("fn");
+		return then(fn, null);
+	}
+
+	/**
+	 * Returns a new future that completes with the value of this future or, if this future fails, with the value
+	 * returned by the given function for the cause.
+	 * @param fn
+	 * the function that converts the cause into a value.
+	 * @return
+	 * the new future.
+	 */
+	public final UFuture<T> recover( final UFunction<? super Throwable, ? extends T> fn ) {
+		if (fn==null) throw new NullPointerException("fn");
+		return then(null, fn);
+	}
+
+	/**
+	 * Returns a new future that completes with the result of the future returned by the given function for the value
+	 * of this future. If this future fails, the new future fails with the same cause. Cancelling the new future
+	 * cancels this future and the future returned by the function.
+	 * @param fn
+	 * the function that starts the next asynchronous operation.
+	 * @return
+	 * the new future.
+	 */
+	public final <R> UFuture<R> flatMap( final UFunction<? super T, ? extends UFuture<R>> fn ) {
+		if (fn==null) throw new NullPointerException("fn");
+		final UPromise<R> promise = new UPromise<R>(executor);
+		final AtomicReference<UFuture<R>> inner = new AtomicReference<UFuture<R>>();
+		promise.onCancel(new Runnable() {
+			@Override
+			public void run() {
+				cancel(false);
+				final UFuture<R> next = inner.get();
+				if (next!=null) next.cancel(false);
+			}
+		});
+		addListener(new UFutureListener<T>() {
+			@Override
+			public void complete( final UFuture<T> future ) {
+				if (promise.isDone()) return;
+				final Throwable cause = future.cause();
+				if (cause!=null) {
+					promise.fail(cause);
+					return;
+				}
+				final UFuture<R> next;
+				try {
+					next = fn.apply(future.getNow());
+				} catch (Throwable t) {
+					promise.fail(t);
+					return;
+				}
+				if (next==null) {
+					promise.complete(null);
+					return;
+				}
+				inner.set(next);
+				if (promise.isCancelled()) next.cancel(false);
+				promise.completeWith(next);
+			}
+		});
+		return promise;
+	}
+
+	/**
+	 * Returns a new future that completes with the value of this future or, if this future fails, with the result
+	 * of the future returned by the given function for the cause.
+	 * @param fn
+	 * the function that starts an alternative asynchronous operation.
+	 * @return
+	 * the new future.
+	 */
+	public final UFuture<T> recoverWith( final UFunction<? super Throwable, ? extends UFuture<T>> fn ) {
+		if (fn==null) throw new NullPointerException("fn");
+		final UPromise<T> promise = new UPromise<T>(executor);
+		promise.onCancel(cancelThis());
+		addListener(new UFutureListener<T>() {
+			@Override
+			public void complete( final UFuture<T> future ) {
+				if (promise.isDone()) return;
+				final Throwable cause = future.cause();
+				if (cause==null) {
+					promise.setResultOf(future);
+					return;
+				}
+				try {
+					final UFuture<T> next = fn.apply(cause);
+					if (next==null) {
+						promise.complete(null);
+					} else {
+						promise.completeWith(next);
+					}
+				} catch (Throwable t) {
+					promise.fail(t);
+				}
+			}
+		});
+		return promise;
+	}
+
+	/**
+	 * Returns a new future that completes with the result of this future or fails with a {@link TimeoutException}
+	 * if this future is not done within the given time, in which case this future is cancelled. The timer is
+	 * scheduled at the executor of this future, if it is an event loop, otherwise at the event loop of the current
+	 * thread.
+	 * @param timeout
+	 * the timeout.
+	 * @param unit
+	 * the unit of the timeout.
+	 * @return
+	 * the new future.
+	 * @throws IllegalStateException
+	 * if neither the executor of this future is an event loop nor the current thread is an event loop thread.
+	 */
+	public final UFuture<T> withTimeout( final long timeout, final TimeUnit unit ) {
+		final UEventLoop loop = executor instanceof UEventLoop ? (UEventLoop)executor : UEventLoop.current();
+		if (loop==null) throw new IllegalStateException("No event loop available to schedule the timeout");
+		return withTimeout(timeout, unit, loop);
+	}
+
+	/**
+	 * Returns a new future that completes with the result of this future or fails with a {@link TimeoutException}
+	 * if this future is not done within the given time, in which case this future is cancelled.
+	 * @param timeout
+	 * the timeout.
+	 * @param unit
+	 * the unit of the timeout.
+	 * @param loop
+	 * the event loop at which to schedule the timer.
+	 * @return
+	 * the new future.
+	 */
+	public final UFuture<T> withTimeout( final long timeout, final TimeUnit unit, final UEventLoop loop ) {
+		final UPromise<T> promise = new UPromise<T>(executor);
+		final UFuture<Void> timer = loop.schedule(new Runnable() {
+			@Override
+			public void run() {
+				if (promise.fail(new TimeoutException("Timeout after "+timeout+" "+unit))) cancel(false);
+			}
+		}, timeout, unit);
+		promise.onCancel(new Runnable() {
+			@Override
+			public void run() {
+				timer.cancel(false);
+				cancel(false);
+			}
+		});
+		addListener(new UFutureListener<T>() {
+			@Override
+			public void complete( final UFuture<T> future ) {
+				timer.cancel(false);
+				promise.setResultOf(future);
+			}
+		}, null);
+		return promise;
+	}
+
+	/**
+	 * Returns a future that succeeds with the values of all given futures, in the same order, once all of them
+	 * succeeded, or that fails as soon as the first of them fails. Cancelling the returned future cancels all given
+	 * futures.
+	 * @param futures
+	 * the futures.
+	 * @return
+	 * the combined future.
+	 */
+	@SuppressWarnings("unchecked")
+	public static <T> UFuture<List<T>> all( final Collection<? extends UFuture<? extends T>> futures ) {
+		final UPromise<List<T>> promise = new UPromise<List<T>>(null);
+		final UFuture<?>[] all = futures.toArray(new UFuture<?>[futures.size()]);
+		final Object[] results = new Object[all.length];
+		if (all.length==0) {
+			promise.complete(new ArrayList<T>(0));
+			return promise;
+		}
+		final AtomicInteger remaining = new AtomicInteger(all.length);
+		promise.onCancel(cancelAll(all));
+		for (int i=0; i < all.length; i++) {
+			final int index = i;
+			((UFuture<Object>)all[i]).addListener(new UFutureListener<Object>() {
+				@Override
+				public void complete( final UFuture<Object> future ) {
+					final Throwable cause = future.cause();
+					if (cause!=null) {
+						promise.fail(cause);
+						return;
+					}
+					results[index] = future.getNow();
+					if (remaining.decrementAndGet()==0) {
+						final ArrayList<T> list = new ArrayList<T>(results.length);
+						for (final Object result : results) list.add((T)result);
+						promise.complete(list);
+					}
+				}
+			}, null);
+		}
+		return promise;
+	}
+
+	/**
+	 * Returns a future that succeeds with the values of all given futures.
+	 * @param futures
+	 * the futures.
+	 * @return
+	 * the combined future.
+	 * @see #all(Collection)
+	 */
+	@SafeVarargs
+	public static <T> UFuture<List<T>> all( final UFuture<? extends T>... futures ) {
+		return all(Arrays.asList(futures));
+	}
+
+	/**
+	 * Returns a future that succeeds with the value of the first of the given futures that succeeds or that fails
+	 * with the cause of the last failure, if all of the given futures fail. Cancelling the returned future cancels all
+	 * given futures.
+	 * @param futures
+	 * the futures.
+	 * @return
+	 * the combined future.
+	 * @throws IllegalArgumentException
+	 * if no future is given.
+	 */
+	@SuppressWarnings("unchecked")
+	public static <T> UFuture<T> any( final Collection<? extends UFuture<? extends T>> futures ) {
+		final UFuture<?>[] all = futures.toArray(new UFuture<?>[futures.size()]);
+		if (all.length==0) throw new IllegalArgumentException("At least one future is required");
+		final UPromise<T> promise = new UPromise<T>(null);
+		final AtomicInteger remaining = new AtomicInteger(all.length);
+		promise.onCancel(cancelAll(all));
+		for (int i=0; i < all.length; i++) {
+			((UFuture<Object>)all[i]).addListener(new UFutureListener<Object>() {
+				@Override
+				public void complete( final UFuture<Object> future ) {
+					final Throwable cause = future.cause();
+					if (cause==null) {
+						promise.complete((T)future.getNow());
+					} else
+					if (remaining.decrementAndGet()==0) {
+						promise.fail(cause);
+					}
+				}
+			}, null);
+		}
+		return promise;
+	}
+
+	/**
+	 * Returns a future that succeeds with the value of the first of the given futures that succeeds.
+	 * @param futures
+	 * the futures.
+	 * @return
+	 * the combined future.
+	 * @see #any(Collection)
+	 */
+	@SafeVarargs
+	public static <T> UFuture<T> any( final UFuture<? extends T>... futures ) {
+		return any(Arrays.asList(futures));
+	}
+
+	/**
+	 * Returns a handler that cancels all given futures.
+	 */
+	private static final Runnable cancelAll( final UFuture<?>[] futures ) {
+		return new Runnable() {
+			@Override
+			public void run() {
+				for (final UFuture<?> future : futures) future.cancel(false);
+			}
+		};
+	}
+
+	@Override
+	public String toString() {
+		final Object result = this.result;
+		if (result==null) return "UFuture[pending]";
+		if (result instanceof Failure) return "UFuture[failed: "+((Failure)result).cause+"]";
+		return "UFuture[success: "+(result==NULL ? null : result)+"]";
+	}
+}
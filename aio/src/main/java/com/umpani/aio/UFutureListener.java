@@ -0,0 +1,20 @@
+package com.umpani.aio;
+
+/**
+ * A listener that is notified when a {@link UFuture} completes.
+ *
+ * @param <T>
+ * the result type of the future.
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface UFutureListener<T> {
+	/**
+	 * Called when the future completed, successfully, with a failure or by cancellation.
+	 * @param future
+	 * the completed future.
+	 * @throws Exception
+	 * if the listener failed, the exception is reported to the executor thread, if it is an event loop, and
+	 * otherwise printed.
+	 */
+	public void complete( final UFuture<T> future ) throws Exception;
+}
@@ -0,0 +1,541 @@
+package com.umpani.aio;
+
+import java.util.concurrent.RejectedExecutionException;
+
+import com.umpani.util.log.ULogger;
+
+/**
+ * The context of a {@link UChannelHandler} within a {@link UPipeline}. The context knows the neighbours of the
+ * handler, the fire methods pass inbound events to the next handler towards the tail, the outbound methods pass
+ * operations to the previous handler towards the head. All methods may be called from any thread, if not called from
+ * the event loop of the channel, the event is submitted as task to the loop.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UHandlerContext {
+	/**
+	 * The logger of the handler contexts.
+	 */
+	private static final ULogger LOG = new ULogger(UHandlerContext.class.getName());
+
+	/**
+	 * Create a new context.
+	 * @param pipeline
+	 * the pipeline.
+	 * @param name
+	 * the unique name of the handler within the pipeline.
+	 * @param handler
+	 * the handler.
+	 */
+	UHandlerContext( final UPipeline pipeline, final String name, final UChannelHandler handler ) {
+		this.pipeline = pipeline;
+		this.name = name;
+		this.handler = handler;
+	}
+
+	/**
+	 * The pipeline.
+	 */
+	private final UPipeline pipeline;
+
+	/**
+	 * The unique name of the handler.
+	 */
+	private final String name;
+
+	/**
+	 * The handler.
+	 */
+	private final UChannelHandler handler;
+
+	/**
+	 * The previous context towards the head, modified only while holding the lock of the pipeline.
+	 */
+	volatile UHandlerContext prev;
+
+	/**
+	 * The next context towards the tail, modified only while holding the lock of the pipeline.
+	 */
+	volatile UHandlerContext next;
+
+	/**
+	 * True if the handler was removed from the pipeline.
+	 */
+	volatile boolean removed;
+
+	/**
+	 * Returns the unique name of the handler within the pipeline.
+	 * @return
+	 * the name.
+	 */
+	public String name() {
+		return name;
+	}
+
+	/**
+	 * Returns the handler.
+	 * @return
+	 * the handler.
+	 */
+	public UChannelHandler handler() {
+		return handler;
+	}
+
+	/**
+	 * Returns the pipeline.
+	 * @return
+	 * the pipeline.
+	 */
+	public UPipeline pipeline() {
+		return pipeline;
+	}
+
+	/**
+	 * Returns the channel.
+	 * @return
+	 * the channel.
+	 */
+	public UChannel channel() {
+		return pipeline.channel();
+	}
+
+	/**
+	 * Returns the event loop of the channel.
+	 * @return
+	 * the event loop.
+	 */
+	public UEventLoop loop() {
+		return pipeline.channel().loop();
+	}
+
+	/**
+	 * Returns the buffer pool of the channel.
+	 * @return
+	 * the buffer pool.
+	 */
+	public UBufferPool alloc() {
+		return pipeline.channel().alloc();
+	}
+
+	/**
+	 * Returns true if the handler was removed from the pipeline.
+	 * @return
+	 * true if the handler was removed.
+	 */
+	public boolean isRemoved() {
+		return removed;
+	}
+
+	/**
+	 * Returns a new promise for an outbound operation of the channel.
+	 * @return
+	 * the new promise.
+	 */
+	public UPromise<Void> newPromise() {
+		return new UPromise<Void>(loop());
+	}
+
+	/**
+	 * Passes the activation of the channel to the next handler.
+	 * @return
+	 * this.
+	 */
+	public UHandlerContext fireChannelActive() {
+		next.invokeChannelActive();
+		return this;
+	}
+
+	/**
+	 * Passes the deactivation of the channel to the next handler.
+	 * @return
+	 * this.
+	 */
+	public UHandlerContext fireChannelInactive() {
+		next.invokeChannelInactive();
+		return this;
+	}
+
+	/**
+	 * Passes the given message to the next handler.
+	 * @param msg
+	 * the message.
+	 * @return
+	 * this.
+	 */
+	public UHandlerContext fireChannelRead( final Object msg ) {
+		next.invokeChannelRead(msg);
+		return this;
+	}
+
+	/**
+	 * Passes the end of a read to the next handler.
+	 * @return
+	 * this.
+	 */
+	public UHandlerContext fireChannelReadComplete() {
+		next.invokeChannelReadComplete();
+		return this;
+	}
+
+	/**
+	 * Passes a writability change to the next handler.
+	 * @return
+	 * this.
+	 */
+	public UHandlerContext fireChannelWritabilityChanged() {
+		next.invokeChannelWritabilityChanged();
+		return this;
+	}
+
+	/**
+	 * Passes the given user event to the next handler.
+	 * @param event
+	 * the event.
+	 * @return
+	 * this.
+	 */
+	public UHandlerContext fireUserEvent( final Object event ) {
+		next.invokeUserEvent(event);
+		return this;
+	}
+
+	/**
+	 * Passes the given exception to the next handler.
+	 * @param cause
+	 * the exception.
+	 * @return
+	 * this.
+	 */
+	public UHandlerContext fireExceptionCaught( final Throwable cause ) {
+		next.invokeExceptionCaught(cause);
+		return this;
+	}
+
+	/**
+	 * Passes the given message to the previous handler for writing.
+	 * @param msg
+	 * the message.
+	 * @return
+	 * the future that is completed once the message was written.
+	 */
+	public UFuture<Void> write( final Object msg ) {
+		final UPromise<Void> promise = newPromise();
+		write(msg, promise);
+		return promise;
+	}
+
+	/**
+	 * Passes the given message to the previous handler for writing.
+	 * @param msg
+	 * the message.
+	 * @param promise
+	 * the promise to complete once the message was written.
+	 * @return
+	 * the given promise.
+	 */
+	public UFuture<Void> write( final Object msg, final UPromise<Void> promise ) {
+		prev.invokeWrite(msg, promise);
+		return promise;
+	}
+
+	/**
+	 * Passes a flush to the previous handler.
+	 * @return
+	 * this.
+	 */
+	public UHandlerContext flush() {
+		prev.invokeFlush();
+		return this;
+	}
+
+	/**
+	 * Writes the given message and flushes.
+	 * @param msg
+	 * the message.
+	 * @return
+	 * the future that is completed once the message was written.
+	 */
+	public UFuture<Void> writeAndFlush( final Object msg ) {
+		final UFuture<Void> future = write(msg);
+		flush();
+		return future;
+	}
+
+	/**
+	 * Passes a close to the previous handler.
+	 * @return
+	 * the future that is completed once the channel was closed.
+	 */
+	public UFuture<Void> close() {
+		return close(newPromise());
+	}
+
+	/**
+	 * Passes a close to the previous handler.
+	 * @param promise
+	 * the promise to complete once the channel was closed.
+	 * @return
+	 * the given promise.
+	 */
+	public UFuture<Void> close( final UPromise<Void> promise ) {
+		prev.invokeClose(promise);
+		return promise;
+	}
+
+	/**
+	 * Invokes the exception handler of this handler for an exception thrown by an inbound method.
+	 */
+	private void handleException( final Throwable t ) {
+		try {
+			handler.exceptionCaught(this, t);
+		} catch (Throwable e) {
+			LOG.error("Exception in exceptionCaught of handler", "handler", name, e);
+		}
+	}
+
+	/**
+	 * Invokes handlerAdded of the handler.
+	 */
+	void invokeHandlerAdded() {
+		try {
+			handler.handlerAdded(this);
+		} catch (Throwable t) {
+			handleException(t);
+		}
+	}
+
+	/**
+	 * Invokes handlerRemoved of the handler.
+	 */
+	void invokeHandlerRemoved() {
+		try {
+			handler.handlerRemoved(this);
+		} catch (Throwable t) {
+			handleException(t);
+		}
+	}
+
+	/**
+	 * Invokes channelActive of the handler from the event loop.
+	 */
+	void invokeChannelActive() {
+		final UEventLoop loop = loop();
+		if (!loop.inEventLoop()) {
+			loop.execute(new Runnable() {
+				@Override
+				public void run() {
+					invokeChannelActive();
+				}
+			});
+			return;
+		}
+		try {
+			handler.channelActive(this);
+		} catch (Throwable t) {
+			handleException(t);
+		}
+	}
+
+	/**
+	 * Invokes channelInactive of the handler from the event loop.
+	 */
+	void invokeChannelInactive() {
+		final UEventLoop loop = loop();
+		if (!loop.inEventLoop()) {
+			loop.execute(new Runnable() {
+				@Override
+				public void run() {
+					invokeChannelInactive();
+				}
+			});
+			return;
+		}
+		try {
+			handler.channelInactive(this);
+		} catch (Throwable t) {
+			handleException(t);
+		}
+	}
+
+	/**
+	 * Invokes channelRead of the handler from the event loop.
+	 */
+	void invokeChannelRead( final Object msg ) {
+		final UEventLoop loop = loop();
+		if (!loop.inEventLoop()) {
+			loop.execute(new Runnable() {
+				@Override
+				public void run() {
+					invokeChannelRead(msg);
+				}
+			});
+			return;
+		}
+		try {
+			handler.channelRead(this, msg);
+		} catch (Throwable t) {
+			handleException(t);
+		}
+	}
+
+	/**
+	 * Invokes channelReadComplete of the handler from the event loop.
+	 */
+	void invokeChannelReadComplete() {
+		final UEventLoop loop = loop();
+		if (!loop.inEventLoop()) {
+			loop.execute(new Runnable() {
+				@Override
+				public void run() {
+					invokeChannelReadComplete();
+				}
+			});
+			return;
+		}
+		try {
+			handler.channelReadComplete(this);
+		} catch (Throwable t) {
+			handleException(t);
+		}
+	}
+
+	/**
+	 * Invokes channelWritabilityChanged of the handler from the event loop.
+	 */
+	void invokeChannelWritabilityChanged() {
+		final UEventLoop loop = loop();
+		if (!loop.inEventLoop()) {
+			loop.execute(new Runnable() {
+				@Override
+				public void run() {
+					invokeChannelWritabilityChanged();
+				}
+			});
+			return;
+		}
+		try {
+			handler.channelWritabilityChanged(this);
+		} catch (Throwable t) {
+			handleException(t);
+		}
+	}
+
+	/**
+	 * Invokes userEvent of the handler from the event loop.
+	 */
+	void invokeUserEvent( final Object event ) {
+		final UEventLoop loop = loop();
+		if (!loop.inEventLoop()) {
+			loop.execute(new Runnable() {
+				@Override
+				public void run() {
+					invokeUserEvent(event);
+				}
+			});
+			return;
+		}
+		try {
+			handler.userEvent(this, event);
+		} catch (Throwable t) {
+			handleException(t);
+		}
+	}
+
+	/**
+	 * Invokes exceptionCaught of the handler from the event loop.
+	 */
+	void invokeExceptionCaught( final Throwable cause ) {
+		final UEventLoop loop = loop();
+		if (!loop.inEventLoop()) {
+			loop.execute(new Runnable() {
+				@Override
+				public void run() {
+					invokeExceptionCaught(cause);
+				}
+			});
+			return;
+		}
+		try {
+			handler.exceptionCaught(this, cause);
+		} catch (Throwable t) {
+			LOG.error("Exception in exceptionCaught of handler", "handler", name, t);
+		}
+	}
+
+	/**
+	 * Invokes write of the handler from the event loop.
+	 */
+	void invokeWrite( final Object msg, final UPromise<Void> promise ) {
+		final UEventLoop loop = loop();
+		if (!loop.inEventLoop()) {
+			try {
+				loop.execute(new Runnable() {
+					@Override
+					public void run() {
+						invokeWrite(msg, promise);
+					}
+				});
+			} catch (RejectedExecutionException e) {
+				UReferences.release(msg);
+				promise.fail(e);
+			}
+			return;
+		}
+		try {
+			handler.write(this, msg, promise);
+		} catch (Throwable t) {
+			promise.fail(t);
+		}
+	}
+
+	/**
+	 * Invokes flush of the handler from the event loop.
+	 */
+	void invokeFlush() {
+		final UEventLoop loop = loop();
+		if (!loop.inEventLoop()) {
+			loop.execute(new Runnable() {
+				@Override
+				public void run() {
+					invokeFlush();
+				}
+			});
+			return;
+		}
+		try {
+			handler.flush(this);
+		} catch (Throwable t) {
+			handleException(t);
+		}
+	}
+
+	/**
+	 * Invokes close of the handler from the event loop.
+	 */
+	void invokeClose( final UPromise<Void> promise ) {
+		final UEventLoop loop = loop();
+		if (!loop.inEventLoop()) {
+			try {
+				loop.execute(new Runnable() {
+					@Override
+					public void run() {
+						invokeClose(promise);
+					}
+				});
+			} catch (RejectedExecutionException e) {
+				promise.fail(e);
+			}
+			return;
+		}
+		try {
+			handler.close(this, promise);
+		} catch (Throwable t) {
+			promise.fail(t);
+		}
+	}
+
+	@Override
+	public String toString() {
+		return "UHandlerContext["+name+"]";
+	}
+}
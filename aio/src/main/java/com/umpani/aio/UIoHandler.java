@@ -0,0 +1,76 @@
+package com.umpani.aio;
+
+import java.nio.channels.SelectionKey;
+
+/**
+ * The handler of a channel that is registered at an {@link UEventLoop}. The event loop invokes the methods of the
+ * handler from its own thread whenever the channel is ready for the corresponding operation. The handler is stored
+ * as attachment of the selection key.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface UIoHandler {
+	/**
+	 * Called if a server channel is ready to accept a new connection.
+	 * @param loop
+	 * the event loop that owns the channel.
+	 * @param key
+	 * the selection key of the channel.
+	 * @throws Exception
+	 * if anything went wrong, the event loop will then invoke {@link #exception(UEventLoop, SelectionKey, Throwable)}.
+	 */
+	public void accept( final UEventLoop loop, final SelectionKey key ) throws Exception;
+
+	/**
+	 * Called if a socket channel is ready to finish connecting.
+	 * @param loop
+	 * the event loop that owns the channel.
+	 * @param key
+	 * the selection key of the channel.
+	 * @throws Exception
+	 * if anything went wrong, the event loop will then invoke {@link #exception(UEventLoop, SelectionKey, Throwable)}.
+	 */
+	public void connect( final UEventLoop loop, final SelectionKey key ) throws Exception;
+
+	/**
+	 * Called if a channel is ready for reading.
+	 * @param loop
+	 * the event loop that owns the channel.
+	 * @param key
+	 * the selection key of the channel.
+	 * @throws Exception
+	 * if anything went wrong, the event loop will then invoke {@link #exception(UEventLoop, SelectionKey, Throwable)}.
+	 */
+	public void read( final UEventLoop loop, final SelectionKey key ) throws Exception;
+
+	/**
+	 * Called if a channel is ready for writing.
+	 * @param loop
+	 * the event loop that owns the channel.
+	 * @param key
+	 * the selection key of the channel.
+	 * @throws Exception
+	 * if anything went wrong, the event loop will then invoke {@link #exception(UEventLoop, SelectionKey, Throwable)}.
+	 */
+	public void write( final UEventLoop loop, final SelectionKey key ) throws Exception;
+
+	/**
+	 * Called if any other method of the handler or the registration of the channel failed.
+	 * @param loop
+	 * the event loop that owns the channel.
+	 * @param key
+	 * the selection key of the channel, null if the registration failed.
+	 * @param cause
+	 * the exception.
+	 */
+	public void exception( final UEventLoop loop, final SelectionKey key, final Throwable cause );
+
+	/**
+	 * Called by the event loop when it closes the channel during its shutdown.
+	 * @param loop
+	 * the event loop that owns the channel.
+	 * @param key
+	 * the selection key of the channel.
+	 */
+	public void closed( final UEventLoop loop, final SelectionKey key );
+}
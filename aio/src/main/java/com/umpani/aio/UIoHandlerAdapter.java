@@ -0,0 +1,38 @@
+package com.umpani.aio;
+
+import java.io.IOException;
+import java.nio.channels.SelectionKey;
+
+/**
+ * An adapter for the {@link UIoHandler} that ignores all readiness events. If an exception occurs, the channel is
+ * closed.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public abstract class UIoHandlerAdapter implements UIoHandler {
+	@Override
+	public void accept( final UEventLoop loop, final SelectionKey key ) throws Exception {}
+
+	@Override
+	public void connect( final UEventLoop loop, final SelectionKey key ) throws Exception {}
+
+	@Override
+	public void read( final UEventLoop loop, final SelectionKey key ) throws Exception {}
+
+	@Override
+	public void write( final UEventLoop loop, final SelectionKey key ) throws Exception {}
+
+	@Override
+	public void exception( final UEventLoop loop, final SelectionKey key, final Throwable cause ) {
+		if (key!=null) {
+			try {
+				key.channel().close();
+			} catch (IOException e) {
+				// we are closing because of another exception, ignore this one
+			}
+		}
+	}
+
+	@Override
+	public void closed( final UEventLoop loop, final SelectionKey key ) {}
+}
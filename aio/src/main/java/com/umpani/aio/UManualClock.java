@@ -0,0 +1,53 @@
+package com.umpani.aio;
+
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicLong;
+
+/**
+ * A clock that only advances when told to, used to drive timers deterministically in tests.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UManualClock implements UClock {
+	/**
+	 * Create a new clock starting at zero.
+	 */
+	public UManualClock() {
+		this(0L);
+	}
+
+	/**
+	 * Create a new clock.
+	 * @param nanoTime
+	 * the initial time in nanoseconds.
+	 */
+	public UManualClock( final long nanoTime ) {
+		this.nanoTime = new AtomicLong(nanoTime);
+	}
+
+	/**
+	 * The current time.
+	 */
+	private final AtomicLong nanoTime;
+
+	@Override
+	public long nanoTime() {
+		return nanoTime.get();
+	}
+
+	/**
+	 * Advances this clock.
+	 * @param amount
+	 * the amount of time to advance, must not be negative.
+	 * @param unit
+	 * the unit of the amount.
+	 * @return
+	 * the new time in nanoseconds.
+	 * @throws IllegalArgumentException
+	 * if the amount is negative.
+	 */
+	public long advance( final long amount, final TimeUnit unit ) {
+		if (amount < 0) throw new IllegalArgumentException("A clock must not go backwards");
+		return nanoTime.addAndGet(unit.toNanos(amount));
+	}
+}
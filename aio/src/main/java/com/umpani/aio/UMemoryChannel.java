@@ -0,0 +1,597 @@
+package com.umpani.aio;
+
+import java.io.IOException;
+import java.net.SocketAddress;
+import java.nio.ByteBuffer;
+import java.nio.channels.ClosedChannelException;
+import java.util.PriorityQueue;
+import java.util.Random;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicInteger;
+
+/**
+ * One end of an in-memory connection between two channels of the same {@link UEventLoop}, to test pipelines without
+ * sockets. Together with an {@link UVirtualEventLoop} whole conversations run single-threaded and deterministically.
+ * A stream connection delivers the written bytes as {@link UBuffer}s in order, like TCP, a datagram connection every
+ * written buffer or {@link UDatagramPacket} as one {@link UDatagramPacket}, like UDP.
+ *
+ * </p><p>Every end injects faults into the data it sends: a latency delays the delivery, a jitter adds a random delay
+ * and thereby reorders datagrams, streams stay in order, and a maximal write size splits the bytes into partial writes,
+ * so that the peer reads them in pieces. {@link #reset()} aborts the connection, {@link #shutdownOutput()} half-closes
+ * it. Closing an end of a stream delivers the bytes in flight and then signals the end of the stream, the peer closes
+ * as well, unless half closure is allowed.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UMemoryChannel extends UChannel {
+	/**
+	 * The user event that is fired, once the peer shut down its output or closed and all its bytes were read.
+	 */
+	public static final Object INPUT_SHUTDOWN = new Object() {
+		@Override
+		public String toString() {
+			return "INPUT_SHUTDOWN";
+		}
+	};
+
+	/**
+	 * The marker that signals the end of the stream.
+	 */
+	private static final Object EOF = new Object();
+
+	/**
+	 * The marker that signals a reset.
+	 */
+	private static final Object RESET = new Object();
+
+	/**
+	 * The counter of the connections, used to name the addresses.
+	 */
+	private static final AtomicInteger CONNECTIONS = new AtomicInteger();
+
+	/**
+	 * Create a new end.
+	 */
+	private UMemoryChannel( final UEventLoop loop, final UBufferPool alloc, final boolean datagram, final Address local, final Address remote ) {
+		super(loop, alloc);
+		this.datagram = datagram;
+		this.local = local;
+		this.remote = remote;
+	}
+
+	/**
+	 * True if the connection exchanges datagrams.
+	 */
+	private final boolean datagram;
+
+	/**
+	 * The address of this end.
+	 */
+	private final Address local;
+
+	/**
+	 * The address of the peer.
+	 */
+	private final Address remote;
+
+	/**
+	 * The messages sent, but not yet delivered to the peer, ordered by their delivery time.
+	 */
+	private final PriorityQueue<InFlight> inFlight = new PriorityQueue<>();
+
+	/**
+	 * The other end.
+	 */
+	private UMemoryChannel peer;
+
+	/**
+	 * The delay of every delivery in nanoseconds.
+	 */
+	private long latency;
+
+	/**
+	 * The maximal additional random delay in nanoseconds.
+	 */
+	private long jitter;
+
+	/**
+	 * The source of the jitter.
+	 */
+	private Random random;
+
+	/**
+	 * The maximal amount of bytes per write.
+	 */
+	private int maxWriteSize = Integer.MAX_VALUE;
+
+	/**
+	 * True if the channel stays open, once the peer shut down its output.
+	 */
+	private boolean allowHalfClosure;
+
+	/**
+	 * The sequence number of the next message, keeps messages with the same delivery time in order.
+	 */
+	private long sequence;
+
+	/**
+	 * The delivery time of the last message sent over a stream.
+	 */
+	private long lastDelivery = Long.MIN_VALUE;
+
+	/**
+	 * The delivery time for which the delivery is scheduled or {@link Long#MAX_VALUE}, if none is scheduled.
+	 */
+	private long scheduledDelivery = Long.MAX_VALUE;
+
+	/**
+	 * True while a flush is scheduled, because the last write was partial.
+	 */
+	private boolean flushScheduled;
+
+	/**
+	 * True once the output was shut down.
+	 */
+	private boolean outputShutdown;
+
+	/**
+	 * True while the channel is reset.
+	 */
+	private boolean resetting;
+
+	/**
+	 * True once the channel is active.
+	 */
+	private volatile boolean active;
+
+	/**
+	 * True until the channel is closed.
+	 */
+	private volatile boolean open = true;
+
+	/**
+	 * Opens a stream connection, like TCP. The pipelines are initialized and activated by the loop.
+	 * @param loop
+	 * the event loop of both ends.
+	 * @param alloc
+	 * the buffer pool of both ends.
+	 * @param client
+	 * the initializer of the client end, may be null.
+	 * @param server
+	 * the initializer of the server end, may be null.
+	 * @return
+	 * the future that is completed with the client end once both ends are active, the server end is its
+	 * {@link #peer()}.
+	 */
+	public static UFuture<UMemoryChannel> openStream( final UEventLoop loop, final UBufferPool alloc, final UChannelInitializer client, final UChannelInitializer server ) {
+		return open(loop, alloc, false, client, server);
+	}
+
+	/**
+	 * Opens a datagram connection, like UDP.
+	 * @param loop
+	 * the event loop of both ends.
+	 * @param alloc
+	 * the buffer pool of both ends.
+	 * @param client
+	 * the initializer of the client end, may be null.
+	 * @param server
+	 * the initializer of the server end, may be null.
+	 * @return
+	 * the future that is completed with the client end once both ends are active, the server end is its
+	 * {@link #peer()}.
+	 */
+	public static UFuture<UMemoryChannel> openDatagram( final UEventLoop loop, final UBufferPool alloc, final UChannelInitializer client, final UChannelInitializer server ) {
+		return open(loop, alloc, true, client, server);
+	}
+
+	/**
+	 * Opens a connection.
+	 */
+	private static UFuture<UMemoryChannel> open( final UEventLoop loop, final UBufferPool alloc, final boolean datagram, final UChannelInitializer clientInitializer, final UChannelInitializer serverInitializer ) {
+		final int id = CONNECTIONS.incrementAndGet();
+		final Address clientAddress = new Address("client-"+id);
+		final Address serverAddress = new Address("server-"+id);
+		final UMemoryChannel client = new UMemoryChannel(loop, alloc, datagram, clientAddress, serverAddress);
+		final UMemoryChannel server = new UMemoryChannel(loop, alloc, datagram, serverAddress, clientAddress);
+		client.peer = server;
+		server.peer = client;
+		final UPromise<UMemoryChannel> promise = new UPromise<UMemoryChannel>(loop);
+		loop.execute(new Runnable() {
+			@Override
+			public void run() {
+				try {
+					if (serverInitializer!=null) serverInitializer.initChannel(server);
+					if (clientInitializer!=null) clientInitializer.initChannel(client);
+				} catch (Throwable t) {
+					promise.fail(t);
+					server.closeNow(new UPromise<Void>(null));
+					client.closeNow(new UPromise<Void>(null));
+					return;
+				}
+				server.activate();
+				client.activate();
+				promise.complete(client);
+			}
+		});
+		return promise;
+	}
+
+	/**
+	 * Activates the channel.
+	 */
+	private void activate() {
+		if (!open) return;
+		active = true;
+		fireChannelActive();
+		flushPending();
+	}
+
+	/**
+	 * Returns the other end of the connection.
+	 * @return
+	 * the peer.
+	 */
+	public final UMemoryChannel peer() {
+		return peer;
+	}
+
+	/**
+	 * Returns true if the connection exchanges datagrams.
+	 * @return
+	 * true for datagrams; false for a stream.
+	 */
+	public final boolean isDatagram() {
+		return datagram;
+	}
+
+	/**
+	 * Delays the delivery of the messages sent by this end.
+	 * @param latency
+	 * the delay.
+	 * @param unit
+	 * the unit of the delay.
+	 * @return
+	 * this.
+	 */
+	public UMemoryChannel setLatency( final long latency, final TimeUnit unit ) {
+		if (latency < 0) throw new IllegalArgumentException("latency: "+latency);
+		this.latency = unit.toNanos(latency);
+		return this;
+	}
+
+	/**
+	 * Delays every message sent by this end additionally by a random amount of time, which reorders datagrams.
+	 * @param jitter
+	 * the maximal additional delay; zero to disable the jitter.
+	 * @param unit
+	 * the unit of the delay.
+	 * @param random
+	 * the source of the delays, a seeded random repeats the same delays.
+	 * @return
+	 * this.
+	 */
+	public UMemoryChannel setJitter( final long jitter, final TimeUnit unit, final Random random ) {
+		if (jitter < 0) throw new IllegalArgumentException("jitter: "+jitter);
+		if (jitter > 0 && random==null) throw new NullPointerException("random");
+		this.jitter = unit.toNanos(jitter);
+		this.random = random;
+		return this;
+	}
+
+	/**
+	 * Limits the amount of bytes the transport accepts per write, so that writes of a stream are partial and the peer
+	 * reads the bytes in pieces of at most that size. Datagrams are never split.
+	 * @param maxWriteSize
+	 * the maximal amount of bytes per write.
+	 * @return
+	 * this.
+	 */
+	public UMemoryChannel setMaxWriteSize( final int maxWriteSize ) {
+		if (maxWriteSize <= 0) throw new IllegalArgumentException("maxWriteSize: "+maxWriteSize);
+		this.maxWriteSize = maxWriteSize;
+		return this;
+	}
+
+	/**
+	 * Keeps this end open, once the peer shut down its output, so that it may still write. Either way the
+	 * {@link #INPUT_SHUTDOWN} event is fired.
+	 * @param allowHalfClosure
+	 * true to stay open; false to close, like a socket that reads the end of the stream.
+	 * @return
+	 * this.
+	 */
+	public UMemoryChannel setAllowHalfClosure( final boolean allowHalfClosure ) {
+		this.allowHalfClosure = allowHalfClosure;
+		return this;
+	}
+
+	/**
+	 * Returns true if the output of this end was shut down.
+	 * @return
+	 * true if the output was shut down.
+	 */
+	public boolean isOutputShutdown() {
+		return outputShutdown;
+	}
+
+	/**
+	 * Shuts the output down, the peer of a stream reads the bytes in flight and then the end of the stream, further
+	 * writes fail. Must be called from the event loop.
+	 */
+	public void shutdownOutput() {
+		if (outputShutdown || !open) return;
+		outputShutdown = true;
+		if (!datagram) send(EOF);
+	}
+
+	/**
+	 * Aborts the connection: this end is closed immediately, the messages in flight are discarded and the peer fails
+	 * with an {@link IOException} once the reset arrives. Must be called from the event loop.
+	 */
+	public void reset() {
+		if (!open) return;
+		resetting = true;
+		closeNow(new UPromise<Void>(null));
+	}
+
+	@Override
+	public boolean isOpen() {
+		return open;
+	}
+
+	@Override
+	public boolean isActive() {
+		return active && open;
+	}
+
+	@Override
+	public SocketAddress localAddress() {
+		return local;
+	}
+
+	@Override
+	public SocketAddress remoteAddress() {
+		return remote;
+	}
+
+	@Override
+	protected boolean isMessageOriented() {
+		return datagram;
+	}
+
+	@Override
+	protected int writeBytes( final ByteBuffer buffer ) throws IOException {
+		if (!active) return 0;
+		if (outputShutdown) throw new ClosedChannelException();
+		if (datagram) return writeDatagram(buffer, remote);
+		final int n = Math.min(buffer.remaining(), maxWriteSize);
+		send(copy(buffer, n));
+		return n;
+	}
+
+	@Override
+	protected int writeDatagram( final ByteBuffer buffer, final SocketAddress address ) throws IOException {
+		if (!active) return 0;
+		if (outputShutdown) throw new ClosedChannelException();
+		if (!datagram) throw new UnsupportedOperationException("Datagrams are not supported by a stream connection");
+		final int n = buffer.remaining();
+		final UBuffer content = copy(buffer, n);
+		if (remote.equals(address)) {
+			send(new UDatagramPacket(content, local));
+		} else {
+			// like UDP, a datagram to an unknown address is silently lost
+			content.release();
+		}
+		return n;
+	}
+
+	/**
+	 * Copies the given amount of bytes into a buffer of the pool of the peer.
+	 */
+	private UBuffer copy( final ByteBuffer buffer, final int length ) {
+		final UBuffer copy = peer.alloc().allocate(length);
+		final ByteBuffer src = buffer.duplicate();
+		src.limit(src.position() + length);
+		copy.nio().put(src).flip();
+		buffer.position(buffer.position() + length);
+		return copy;
+	}
+
+	@Override
+	protected void setWriteInterest( final boolean interested ) {
+		// the transport accepts more bytes right away, the flush continues with the next task
+		if (!interested || flushScheduled) return;
+		flushScheduled = true;
+		loop().execute(new Runnable() {
+			@Override
+			public void run() {
+				flushScheduled = false;
+				flushPending();
+			}
+		});
+	}
+
+	@Override
+	protected void doClose() throws IOException {
+		open = false;
+		if (resetting) {
+			for (final InFlight message : inFlight) UReferences.release(message.msg);
+			inFlight.clear();
+			send(RESET);
+		} else
+		if (!outputShutdown) {
+			outputShutdown = true;
+			// like UDP, the peer of a datagram connection is not told
+			if (!datagram) send(EOF);
+		}
+	}
+
+	/**
+	 * Queues the given message for the delivery to the peer.
+	 */
+	private void send( final Object msg ) {
+		final long now = loop().timers().clock().nanoTime();
+		long delivery = now + latency;
+		if (jitter > 0) delivery += (long)(random.nextDouble() * jitter);
+		// a stream keeps the order, a datagram may overtake others
+		if (!datagram || msg==EOF || msg==RESET) {
+			if (delivery < lastDelivery) delivery = lastDelivery;
+			lastDelivery = delivery;
+		}
+		inFlight.add(new InFlight(msg, delivery, sequence++));
+		scheduleDelivery();
+	}
+
+	/**
+	 * Schedules the delivery of the next message in flight, if it is not yet scheduled.
+	 */
+	private void scheduleDelivery() {
+		final InFlight next = inFlight.peek();
+		if (next==null || next.delivery >= scheduledDelivery) return;
+		final long at = next.delivery;
+		scheduledDelivery = at;
+		final Runnable task = new Runnable() {
+			@Override
+			public void run() {
+				// a delivery for an earlier time may have replaced this one
+				if (scheduledDelivery==at) scheduledDelivery = Long.MAX_VALUE;
+				deliver();
+			}
+		};
+		final long delay = next.delivery - loop().timers().clock().nanoTime();
+		if (delay <= 0) {
+			loop().execute(task);
+		} else {
+			loop().schedule(task, delay, TimeUnit.NANOSECONDS);
+		}
+	}
+
+	/**
+	 * Delivers all messages whose delivery time passed to the peer.
+	 */
+	private void deliver() {
+		final long now = loop().timers().clock().nanoTime();
+		boolean read = false;
+		InFlight next;
+		while ((next = inFlight.peek())!=null && next.delivery <= now) {
+			inFlight.poll();
+			if (next.msg==EOF || next.msg==RESET) {
+				if (read) peer.readComplete();
+				read = false;
+				peer.receiveEnd(next.msg==RESET);
+			} else {
+				read |= peer.receive(next.msg);
+			}
+		}
+		if (read) peer.readComplete();
+		scheduleDelivery();
+	}
+
+	/**
+	 * Passes a received message into the pipeline.
+	 * @return
+	 * true if the message was read.
+	 */
+	private boolean receive( final Object msg ) {
+		if (!isActive()) {
+			UReferences.release(msg);
+			return false;
+		}
+		countRead(msg instanceof UDatagramPacket ? ((UDatagramPacket)msg).content().remaining() : ((UBuffer)msg).remaining());
+		pipeline().fireChannelRead(msg);
+		return true;
+	}
+
+	/**
+	 * Signals that all messages of a batch were read.
+	 */
+	private void readComplete() {
+		if (isActive()) pipeline().fireChannelReadComplete();
+	}
+
+	/**
+	 * Handles the end of the stream or a reset of the peer.
+	 */
+	private void receiveEnd( final boolean reset ) {
+		if (!isActive()) return;
+		if (reset) {
+			pipeline().fireExceptionCaught(new IOException("Connection reset by peer"));
+			closeNow(new UPromise<Void>(null));
+			return;
+		}
+		pipeline().fireUserEvent(INPUT_SHUTDOWN);
+		if (!allowHalfClosure && open) closeNow(new UPromise<Void>(null));
+	}
+
+	/**
+	 * The address of an end of an in-memory connection.
+	 */
+	@SuppressWarnings("serial")
+	public static final class Address extends SocketAddress {
+		Address( final String name ) {
+			this.name = name;
+		}
+
+		/**
+		 * The name of the end.
+		 */
+		private final String name;
+
+		/**
+		 * Returns the name of the end.
+		 * @return
+		 * the name.
+		 */
+		public String name() {
+			return name;
+		}
+
+		@Override
+		public boolean equals( final Object o ) {
+			return o instanceof Address && ((Address)o).name.equals(name);
+		}
+
+		@Override
+		public int hashCode() {
+			return name.hashCode();
+		}
+
+		@Override
+		public String toString() {
+			return "memory:"+name;
+		}
+	}
+
+	/**
+	 * A message in flight.
+	 */
+	private static final class InFlight implements Comparable<InFlight> {
+		InFlight( final Object msg, final long delivery, final long sequence ) {
+			this.msg = msg;
+			this.delivery = delivery;
+			this.sequence = sequence;
+		}
+
+		/**
+		 * The message.
+		 */
+		final Object msg;
+
+		/**
+		 * The delivery time.
+		 */
+		final long delivery;
+
+		/**
+		 * The sequence number.
+		 */
+		final long sequence;
+
+		@Override
+		public int compareTo( final InFlight o ) {
+			if (delivery!=o.delivery) return delivery < o.delivery ? -1 : 1;
+			return sequence < o.sequence ? -1 : sequence > o.sequence ? 1 : 0;
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package com.umpani.aio;
+
+import java.io.Closeable;
+import java.io.IOException;
+import java.net.InetSocketAddress;
+import java.net.ServerSocket;
+import java.net.SocketAddress;
+
+/**
+ * A blocking server socket that accepts {@link UNdjsonSocket}s, for tests and simple tools.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UNdjsonServerSocket implements Closeable {
+	/**
+	 * Create a new server socket bound to the given address.
+	 * @param address
+	 * the local address, use port zero to bind to any free port.
+	 * @throws IOException
+	 * if binding failed.
+	 */
+	public UNdjsonServerSocket( final SocketAddress address ) throws IOException {
+		serverSocket = new ServerSocket();
+		try {
+			serverSocket.setReuseAddress(true);
+			serverSocket.bind(address);
+		} catch (IOException e) {
+			serverSocket.close();
+			throw e;
+		}
+	}
+
+	/**
+	 * Create a new server socket bound to the given port of the loopback interface.
+	 * @param port
+	 * the port, use zero to bind to any free port.
+	 * @throws IOException
+	 * if binding failed.
+	 */
+	public UNdjsonServerSocket( final int port ) throws IOException {
+		this(new InetSocketAddress("127.0.0.1", port));
+	}
+
+	/**
+	 * The server socket.
+	 */
+	private final ServerSocket serverSocket;
+
+	/**
+	 * Returns the bound address.
+	 * @return
+	 * the bound address.
+	 */
+	public InetSocketAddress localAddress() {
+		return (InetSocketAddress)serverSocket.getLocalSocketAddress();
+	}
+
+	/**
+	 * Sets the maximal time to block in {@link #accept()}.
+	 * @param millis
+	 * the timeout in milliseconds, zero to block forever.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if the timeout could not be set.
+	 */
+	public UNdjsonServerSocket setTimeout( final int millis ) throws IOException {
+		serverSocket.setSoTimeout(millis);
+		return this;
+	}
+
+	/**
+	 * Waits for the next connection.
+	 * @return
+	 * the accepted connection.
+	 * @throws IOException
+	 * if accepting failed.
+	 */
+	public UNdjsonSocket accept() throws IOException {
+		return new UNdjsonSocket(serverSocket.accept());
+	}
+
+	@Override
+	public void close() throws IOException {
+		serverSocket.close();
+	}
+
+	@Override
+	public String toString() {
+		return "UNdjsonServerSocket["+localAddress()+"]";
+	}
+}
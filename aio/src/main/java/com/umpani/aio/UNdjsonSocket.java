@@ -0,0 +1,239 @@
+package com.umpani.aio;
+
+import java.io.BufferedInputStream;
+import java.io.BufferedWriter;
+import java.io.Closeable;
+import java.io.EOFException;
+import java.io.IOException;
+import java.io.InputStream;
+import java.io.OutputStreamWriter;
+import java.io.Writer;
+import java.net.InetSocketAddress;
+import java.net.Socket;
+import java.net.SocketAddress;
+import java.nio.charset.StandardCharsets;
+import java.util.Arrays;
+
+import com.umpani.aio.codec.UNdjsonDecoder;
+import com.umpani.aio.exception.UTooLongFrameException;
+import com.umpani.util.json.UJsonReader;
+import com.umpani.util.json.UJsonWriter;
+
+/**
+ * A blocking socket that exchanges newline delimited JSON (NDJSON) values, the counterpart of the
+ * {@link UNdjsonDecoder} and the {@link com.umpani.aio.codec.UNdjsonEncoder} for tests and simple tools, for example:
+ * <pre>
+ * try (UNdjsonSocket socket = UNdjsonSocket.connect("localhost", 4711)) {
+ *   UMap&lt;String,Object&gt; reply = (UMap&lt;String,Object&gt;)socket.request(request);
+ * }
+ * </pre>
+ * Sending and receiving may be done by different threads at the same time.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UNdjsonSocket implements Closeable {
+	/**
+	 * Create a new NDJSON socket.
+	 * @param socket
+	 * the connected socket.
+	 * @throws IOException
+	 * if the streams of the socket could not be opened.
+	 */
+	public UNdjsonSocket( final Socket socket ) throws IOException {
+		this.socket = socket;
+		socket.setTcpNoDelay(true);
+		this.in = new BufferedInputStream(socket.getInputStream());
+		this.out = new BufferedWriter(new OutputStreamWriter(socket.getOutputStream(), StandardCharsets.UTF_8));
+	}
+
+	/**
+	 * Connects to the given address.
+	 * @param address
+	 * the address to connect to.
+	 * @return
+	 * the connected socket.
+	 * @throws IOException
+	 * if connecting failed.
+	 */
+	public static UNdjsonSocket connect( final SocketAddress address ) throws IOException {
+		final Socket socket = new Socket();
+		try {
+			socket.connect(address);
+			return new UNdjsonSocket(socket);
+		} catch (IOException e) {
+			socket.close();
+			throw e;
+		}
+	}
+
+	/**
+	 * Connects to the given host and port.
+	 * @param host
+	 * the host name.
+	 * @param port
+	 * the port.
+	 * @return
+	 * the connected socket.
+	 * @throws IOException
+	 * if connecting failed.
+	 */
+	public static UNdjsonSocket connect( final String host, final int port ) throws IOException {
+		return connect(new InetSocketAddress(host, port));
+	}
+
+	/**
+	 * The socket.
+	 */
+	private final Socket socket;
+
+	/**
+	 * The buffered input of the socket.
+	 */
+	private final InputStream in;
+
+	/**
+	 * The buffered output of the socket.
+	 */
+	private final Writer out;
+
+	/**
+	 * The maximal length of a received line.
+	 */
+	private volatile int maxLineLength = UNdjsonDecoder.DEFAULT_MAX_LINE_LENGTH;
+
+	/**
+	 * The bytes of the current line.
+	 */
+	private byte[] line = new byte[256];
+
+	/**
+	 * Returns the socket.
+	 * @return
+	 * the socket.
+	 */
+	public final Socket socket() {
+		return socket;
+	}
+
+	/**
+	 * Sets the maximal length of received lines.
+	 * @param maxLineLength
+	 * the maximal length in bytes, not counting the line terminator.
+	 * @return
+	 * this.
+	 */
+	public UNdjsonSocket setMaxLineLength( final int maxLineLength ) {
+		if (maxLineLength <= 0) throw new IllegalArgumentException("maxLineLength: "+maxLineLength);
+		this.maxLineLength = maxLineLength;
+		return this;
+	}
+
+	/**
+	 * Sets the maximal time to block in {@link #receive()}.
+	 * @param millis
+	 * the timeout in milliseconds, zero to block forever.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if the timeout could not be set.
+	 */
+	public UNdjsonSocket setTimeout( final int millis ) throws IOException {
+		socket.setSoTimeout(millis);
+		return this;
+	}
+
+	/**
+	 * Sends the given value as one line.
+	 * @param value
+	 * the value, usually a {@link com.umpani.util.UMap}.
+	 * @throws IOException
+	 * if sending failed.
+	 */
+	public void send( final Object value ) throws IOException {
+		synchronized (out) {
+			new UJsonWriter(out).value(value);
+			out.write('\n');
+			out.flush();
+		}
+	}
+
+	/**
+	 * Receives the next value, empty lines are skipped.
+	 * @return
+	 * the value or null, if the remote peer closed the connection.
+	 * @throws java.net.SocketTimeoutException
+	 * if the timeout elapsed.
+	 * @throws com.umpani.util.exception.UJsonException
+	 * if the line is no valid JSON.
+	 * @throws UTooLongFrameException
+	 * if the line exceeds the maximal length, the line is skipped.
+	 * @throws IOException
+	 * if receiving failed.
+	 */
+	public Object receive() throws IOException {
+		synchronized (in) {
+			for (;;) {
+				final int length = readLine();
+				if (length < 0) return null;
+				if (length > 0) return UJsonReader.parse(new String(line, 0, length, StandardCharsets.UTF_8));
+			}
+		}
+	}
+
+	/**
+	 * Sends the given value and receives the reply.
+	 * @param value
+	 * the value to send.
+	 * @return
+	 * the reply.
+	 * @throws EOFException
+	 * if the remote peer closed the connection instead of replying.
+	 * @throws IOException
+	 * if sending or receiving failed.
+	 */
+	public Object request( final Object value ) throws IOException {
+		send(value);
+		final Object reply = receive();
+		if (reply==null) throw new EOFException("Connection closed by remote peer");
+		return reply;
+	}
+
+	/**
+	 * Reads the next line into the line buffer.
+	 * @return
+	 * the length of the line without terminator or -1, if the end of the stream was reached.
+	 */
+	private int readLine() throws IOException {
+		final int maxLineLength = this.maxLineLength;
+		int length = 0;
+		boolean tooLong = false;
+		int b;
+		while ((b = in.read())!='\n') {
+			if (b < 0) {
+				if (length==0 && !tooLong) return -1;
+				throw new EOFException("Unterminated line");
+			}
+			if (tooLong) continue;
+			// one byte more than the maximum for the carriage return
+			if (length > maxLineLength) {
+				tooLong = true;
+				continue;
+			}
+			if (length==line.length) line = Arrays.copyOf(line, Math.min(line.length << 1, maxLineLength + 1));
+			line[length++] = (byte)b;
+		}
+		if (length > 0 && line[length - 1]=='\r') length--;
+		if (tooLong || length > maxLineLength) throw new UTooLongFrameException("Line length exceeds "+maxLineLength);
+		return length;
+	}
+
+	@Override
+	public void close() throws IOException {
+		socket.close();
+	}
+
+	@Override
+	public String toString() {
+		return "UNdjsonSocket["+socket.getRemoteSocketAddress()+"]";
+	}
+}
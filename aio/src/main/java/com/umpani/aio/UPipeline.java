@@ -0,0 +1,553 @@
+package com.umpani.aio;
+
+import java.util.ArrayList;
+import java.util.List;
+import java.util.NoSuchElementException;
+
+import com.umpani.util.log.ULogger;
+
+/**
+ * The pipeline of a {@link UChannel}, a doubly linked list of {@link UChannelHandler}s. Inbound events start at the
+ * head and travel towards the tail, outbound operations start at the tail and travel towards the head. The head
+ * passes outbound operations to the channel, the tail releases inbound messages and reports exceptions that no
+ * handler terminated.
+ *
+ * </p><p>The pipeline may be modified at any time from any thread, even from within a handler. The handlerAdded and
+ * handlerRemoved notifications are always delivered by the event loop of the channel.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UPipeline {
+	/**
+	 * The logger of the pipelines.
+	 */
+	private static final ULogger LOG = new ULogger(UPipeline.class.getName());
+
+	/**
+	 * Create a new pipeline.
+	 * @param channel
+	 * the channel the pipeline belongs to.
+	 */
+	UPipeline( final UChannel channel ) {
+		this.channel = channel;
+		head = new UHandlerContext(this, "head", new HeadHandler());
+		tail = new UHandlerContext(this, "tail", new TailHandler());
+		head.next = tail;
+		tail.prev = head;
+	}
+
+	/**
+	 * The channel.
+	 */
+	private final UChannel channel;
+
+	/**
+	 * The head of the pipeline, which passes outbound operations to the channel.
+	 */
+	private final UHandlerContext head;
+
+	/**
+	 * The tail of the pipeline, which terminates inbound events.
+	 */
+	private final UHandlerContext tail;
+
+	/**
+	 * Used to generate names.
+	 */
+	private int counter;
+
+	/**
+	 * Returns the channel this pipeline belongs to.
+	 * @return
+	 * the channel.
+	 */
+	public UChannel channel() {
+		return channel;
+	}
+
+	/**
+	 * Adds the given handler as first handler.
+	 * @param name
+	 * the unique name of the handler, if null a name is generated.
+	 * @param handler
+	 * the handler.
+	 * @return
+	 * this.
+	 * @throws IllegalArgumentException
+	 * if the name is already used.
+	 */
+	public UPipeline addFirst( final String name, final UChannelHandler handler ) {
+		final UHandlerContext ctx;
+		synchronized (this) {
+			ctx = newContext(name, handler);
+			link(head, ctx);
+		}
+		added(ctx);
+		return this;
+	}
+
+	/**
+	 * Adds the given handler as last handler.
+	 * @param name
+	 * the unique name of the handler, if null a name is generated.
+	 * @param handler
+	 * the handler.
+	 * @return
+	 * this.
+	 * @throws IllegalArgumentException
+	 * if the name is already used.
+	 */
+	public UPipeline addLast( final String name, final UChannelHandler handler ) {
+		final UHandlerContext ctx;
+		synchronized (this) {
+			ctx = newContext(name, handler);
+			link(tail.prev, ctx);
+		}
+		added(ctx);
+		return this;
+	}
+
+	/**
+	 * Adds the given handlers at the end of the pipeline, with generated names.
+	 * @param handlers
+	 * the handlers to add.
+	 * @return
+	 * this.
+	 */
+	public UPipeline addLast( final UChannelHandler... handlers ) {
+		for (final UChannelHandler handler : handlers) addLast(null, handler);
+		return this;
+	}
+
+	/**
+	 * Adds the given handler in front of another handler.
+	 * @param baseName
+	 * the name of the handler before which to add.
+	 * @param name
+	 * the unique name of the handler, if null a name is generated.
+	 * @param handler
+	 * the handler.
+	 * @return
+	 * this.
+	 * @throws IllegalArgumentException
+	 * if the name is already used.
+	 * @throws NoSuchElementException
+	 * if there is no handler with the given base name.
+	 */
+	public UPipeline addBefore( final String baseName, final String name, final UChannelHandler handler ) {
+		final UHandlerContext ctx;
+		synchronized (this) {
+			final UHandlerContext base = getContext(baseName);
+			ctx = newContext(name, handler);
+			link(base.prev, ctx);
+		}
+		added(ctx);
+		return this;
+	}
+
+	/**
+	 * Adds the given handler behind another handler.
+	 * @param baseName
+	 * the name of the handler behind which to add.
+	 * @param name
+	 * the unique name of the handler, if null a name is generated.
+	 * @param handler
+	 * the handler.
+	 * @return
+	 * this.
+	 * @throws IllegalArgumentException
+	 * if the name is already used.
+	 * @throws NoSuchElementException
+	 * if there is no handler with the given base name.
+	 */
+	public UPipeline addAfter( final String baseName, final String name, final UChannelHandler handler ) {
+		final UHandlerContext ctx;
+		synchronized (this) {
+			final UHandlerContext base = getContext(baseName);
+			ctx = newContext(name, handler);
+			link(base, ctx);
+		}
+		added(ctx);
+		return this;
+	}
+
+	/**
+	 * Removes the handler with the given name.
+	 * @param name
+	 * the name of the handler.
+	 * @return
+	 * the removed handler.
+	 * @throws NoSuchElementException
+	 * if there is no handler with the given name.
+	 */
+	public UChannelHandler remove( final String name ) {
+		final UHandlerContext ctx;
+		synchronized (this) {
+			ctx = getContext(name);
+			unlink(ctx);
+		}
+		removed(ctx);
+		return ctx.handler();
+	}
+
+	/**
+	 * Removes the given handler.
+	 * @param handler
+	 * the handler.
+	 * @return
+	 * this.
+	 * @throws NoSuchElementException
+	 * if the handler is not part of this pipeline.
+	 */
+	public UPipeline remove( final UChannelHandler handler ) {
+		final UHandlerContext ctx;
+		synchronized (this) {
+			ctx = context(handler);
+			if (ctx==null) throw new NoSuchElementException(handler.getClass().getName());
+			unlink(ctx);
+		}
+		removed(ctx);
+		return this;
+	}
+
+	/**
+	 * Replaces the handler with the given name, the new handler takes over the position.
+	 * @param oldName
+	 * the name of the handler to replace.
+	 * @param newName
+	 * the unique name of the new handler, if null a name is generated.
+	 * @param handler
+	 * the new handler.
+	 * @return
+	 * the replaced handler.
+	 * @throws NoSuchElementException
+	 * if there is no handler with the given name.
+	 */
+	public UChannelHandler replace( final String oldName, final String newName, final UChannelHandler handler ) {
+		final UHandlerContext oldCtx, newCtx;
+		synchronized (this) {
+			oldCtx = getContext(oldName);
+			final UHandlerContext prev = oldCtx.prev;
+			unlink(oldCtx);
+			newCtx = newContext(newName, handler);
+			link(prev, newCtx);
+		}
+		added(newCtx);
+		removed(oldCtx);
+		return oldCtx.handler();
+	}
+
+	/**
+	 * Returns the handler with the given name.
+	 * @param name
+	 * the name of the handler.
+	 * @return
+	 * the handler or null, if there is no such handler.
+	 */
+	public synchronized UChannelHandler get( final String name ) {
+		final UHandlerContext ctx = context(name);
+		return ctx!=null ? ctx.handler() : null;
+	}
+
+	/**
+	 * Returns the first handler of the given type.
+	 * @param type
+	 * the type of the handler.
+	 * @return
+	 * the handler or null, if there is no such handler.
+	 */
+	public synchronized <T extends UChannelHandler> T get( final Class<T> type ) {
+		for (UHandlerContext ctx = head.next; ctx!=tail; ctx = ctx.next) {
+			if (type.isInstance(ctx.handler())) return type.cast(ctx.handler());
+		}
+		return null;
+	}
+
+	/**
+	 * Returns the context of the handler with the given name.
+	 * @param name
+	 * the name of the handler.
+	 * @return
+	 * the context or null, if there is no such handler.
+	 */
+	public synchronized UHandlerContext context( final String name ) {
+		for (UHandlerContext ctx = head.next; ctx!=tail; ctx = ctx.next) {
+			if (ctx.name().equals(name)) return ctx;
+		}
+		return null;
+	}
+
+	/**
+	 * Returns the context of the given handler.
+	 * @param handler
+	 * the handler.
+	 * @return
+	 * the context or null, if the handler is not part of this pipeline.
+	 */
+	public synchronized UHandlerContext context( final UChannelHandler handler ) {
+		for (UHandlerContext ctx = head.next; ctx!=tail; ctx = ctx.next) {
+			if (ctx.handler()==handler) return ctx;
+		}
+		return null;
+	}
+
+	/**
+	 * Returns the names of all handlers from head to tail.
+	 * @return
+	 * the names of all handlers.
+	 */
+	public synchronized List<String> names() {
+		final ArrayList<String> names = new ArrayList<>();
+		for (UHandlerContext ctx = head.next; ctx!=tail; ctx = ctx.next) names.add(ctx.name());
+		return names;
+	}
+
+	/**
+	 * Sends the activation of the channel through the pipeline.
+	 * @return
+	 * this.
+	 */
+	public UPipeline fireChannelActive() {
+		head.invokeChannelActive();
+		return this;
+	}
+
+	/**
+	 * Sends the deactivation of the channel through the pipeline.
+	 * @return
+	 * this.
+	 */
+	public UPipeline fireChannelInactive() {
+		head.invokeChannelInactive();
+		return this;
+	}
+
+	/**
+	 * Sends the given message through the pipeline.
+	 * @param msg
+	 * the message.
+	 * @return
+	 * this.
+	 */
+	public UPipeline fireChannelRead( final Object msg ) {
+		head.invokeChannelRead(msg);
+		return this;
+	}
+
+	/**
+	 * Sends the end of a read through the pipeline.
+	 * @return
+	 * this.
+	 */
+	public UPipeline fireChannelReadComplete() {
+		head.invokeChannelReadComplete();
+		return this;
+	}
+
+	/**
+	 * Sends a writability change through the pipeline.
+	 * @return
+	 * this.
+	 */
+	public UPipeline fireChannelWritabilityChanged() {
+		head.invokeChannelWritabilityChanged();
+		return this;
+	}
+
+	/**
+	 * Sends the given user event through the pipeline.
+	 * @param event
+	 * the event.
+	 * @return
+	 * this.
+	 */
+	public UPipeline fireUserEvent( final Object event ) {
+		head.invokeUserEvent(event);
+		return this;
+	}
+
+	/**
+	 * Sends the given exception through the pipeline.
+	 * @param cause
+	 * the exception.
+	 * @return
+	 * this.
+	 */
+	public UPipeline fireExceptionCaught( final Throwable cause ) {
+		head.invokeExceptionCaught(cause);
+		return this;
+	}
+
+	/**
+	 * Writes the given message, starting at the tail.
+	 * @param msg
+	 * the message.
+	 * @param promise
+	 * the promise to complete once the message was written.
+	 * @return
+	 * the given promise.
+	 */
+	public UFuture<Void> write( final Object msg, final UPromise<Void> promise ) {
+		return tail.write(msg, promise);
+	}
+
+	/**
+	 * Flushes all written messages, starting at the tail.
+	 * @return
+	 * this.
+	 */
+	public UPipeline flush() {
+		tail.flush();
+		return this;
+	}
+
+	/**
+	 * Closes the channel, starting at the tail.
+	 * @param promise
+	 * the promise to complete once the channel was closed.
+	 * @return
+	 * the given promise.
+	 */
+	public UFuture<Void> close( final UPromise<Void> promise ) {
+		return tail.close(promise);
+	}
+
+	/**
+	 * Returns the context with the given name or throws an exception, must hold the lock.
+	 */
+	private UHandlerContext getContext( final String name ) {
+		final UHandlerContext ctx = context(name);
+		if (ctx==null) throw new NoSuchElementException(name);
+		return ctx;
+	}
+
+	/**
+	 * Creates a new context, must hold the lock.
+	 */
+	private UHandlerContext newContext( String name, final UChannelHandler handler ) {
+		if (handler==null) throw new NullPointerException("handler");
+		if (name==null) {
+			do {
+				name = handler.getClass().getSimpleName()+"#"+(counter++);
+			} while (context(name)!=null);
+		} else
+		if (context(name)!=null) {
+			throw new IllegalArgumentException("Duplicate handler name: "+name);
+		}
+		return new UHandlerContext(this, name, handler);
+	}
+
+	/**
+	 * Links the given context behind the given one, must hold the lock.
+	 */
+	private void link( final UHandlerContext prev, final UHandlerContext ctx ) {
+		final UHandlerContext next = prev.next;
+		ctx.prev = prev;
+		ctx.next = next;
+		next.prev = ctx;
+		prev.next = ctx;
+	}
+
+	/**
+	 * Unlinks the given context, must hold the lock. The links of the context itself are kept, so that events that
+	 * are currently processed by the removed handler are still passed on.
+	 */
+	private void unlink( final UHandlerContext ctx ) {
+		final UHandlerContext prev = ctx.prev;
+		final UHandlerContext next = ctx.next;
+		prev.next = next;
+		next.prev = prev;
+		ctx.removed = true;
+	}
+
+	/**
+	 * Delivers the handlerAdded notification from the event loop.
+	 */
+	private void added( final UHandlerContext ctx ) {
+		final UEventLoop loop = channel.loop();
+		if (loop.inEventLoop()) {
+			ctx.invokeHandlerAdded();
+			return;
+		}
+		loop.execute(new Runnable() {
+			@Override
+			public void run() {
+				ctx.invokeHandlerAdded();
+			}
+		});
+	}
+
+	/**
+	 * Delivers the handlerRemoved notification from the event loop.
+	 */
+	private void removed( final UHandlerContext ctx ) {
+		final UEventLoop loop = channel.loop();
+		if (loop.inEventLoop()) {
+			ctx.invokeHandlerRemoved();
+			return;
+		}
+		loop.execute(new Runnable() {
+			@Override
+			public void run() {
+				ctx.invokeHandlerRemoved();
+			}
+		});
+	}
+
+	@Override
+	public synchronized String toString() {
+		return "UPipeline"+names();
+	}
+
+	/**
+	 * The head of the pipeline, which passes outbound operations to the channel.
+	 */
+	private final class HeadHandler extends UChannelHandlerAdapter {
+		@Override
+		public void write( final UHandlerContext ctx, final Object msg, final UPromise<Void> promise ) throws Exception {
+			channel.enqueue(msg, promise);
+		}
+
+		@Override
+		public void flush( final UHandlerContext ctx ) throws Exception {
+			channel.flushNow();
+		}
+
+		@Override
+		public void close( final UHandlerContext ctx, final UPromise<Void> promise ) throws Exception {
+			channel.closeNow(promise);
+		}
+	}
+
+	/**
+	 * The tail of the pipeline, which terminates inbound events.
+	 */
+	private final class TailHandler extends UChannelHandlerAdapter {
+		@Override
+		public void channelActive( final UHandlerContext ctx ) throws Exception {}
+
+		@Override
+		public void channelInactive( final UHandlerContext ctx ) throws Exception {}
+
+		@Override
+		public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+			UReferences.release(msg);
+		}
+
+		@Override
+		public void channelReadComplete( final UHandlerContext ctx ) throws Exception {}
+
+		@Override
+		public void channelWritabilityChanged( final UHandlerContext ctx ) throws Exception {}
+
+		@Override
+		public void userEvent( final UHandlerContext ctx, final Object event ) throws Exception {
+			UReferences.release(event);
+		}
+
+		@Override
+		public void exceptionCaught( final UHandlerContext ctx, final Throwable cause ) throws Exception {
+			LOG.warn("Unhandled exception in the pipeline", "channel", String.valueOf(channel), cause);
+		}
+	}
+}
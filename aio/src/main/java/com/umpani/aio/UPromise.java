@@ -0,0 +1,83 @@
+package com.umpani.aio;
+
+import java.util.concurrent.Executor;
+
+/**
+ * A future that is completed by its creator. The creator of an asynchronous operation returns the promise as
+ * {@link UFuture} and completes it once the operation finished. A cancel handler can be set to abort the operation,
+ * for example to close a channel, if the promise is cancelled.
+ *
+ * @param <T>
+ * the result type.
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UPromise<T> extends UFuture<T> {
+	/**
+	 * Create a new promise whose listeners are invoked by the event loop of the current thread or, if the current
+	 * thread is no event loop thread, by the thread that completes the promise.
+	 */
+	public UPromise() {
+		super(UEventLoop.current());
+	}
+
+	/**
+	 * Create a new promise.
+	 * @param executor
+	 * the executor used to invoke listeners, if null listeners are invoked by the thread that completes the promise.
+	 */
+	public UPromise( final Executor executor ) {
+		super(executor);
+	}
+
+	/**
+	 * Completes this promise successfully.
+	 * @param value
+	 * the value.
+	 * @return
+	 * true if this promise was completed; false if it was already done.
+	 */
+	public boolean complete( final T value ) {
+		return setValue(value);
+	}
+
+	/**
+	 * Completes this promise with a failure.
+	 * @param cause
+	 * the cause of the failure.
+	 * @return
+	 * true if this promise was completed; false if it was already done.
+	 */
+	public boolean fail( final Throwable cause ) {
+		return setFailure(cause);
+	}
+
+	/**
+	 * Completes this promise with the result of the given future, once that is done.
+	 * @param future
+	 * the future whose result to adopt.
+	 * @return
+	 * this.
+	 */
+	public UPromise<T> completeWith( final UFuture<T> future ) {
+		future.addListener(new UFutureListener<T>() {
+			@Override
+			public void complete( final UFuture<T> future ) {
+				setResultOf(future);
+			}
+		}, null);
+		return this;
+	}
+
+	/**
+	 * Sets the handler that is invoked if this promise is cancelled, replacing the current one. If this promise was
+	 * already cancelled, the handler is invoked immediately.
+	 * @param handler
+	 * the handler.
+	 * @return
+	 * this.
+	 */
+	public UPromise<T> onCancel( final Runnable handler ) {
+		setCancelHandler(handler);
+		return this;
+	}
+}
@@ -0,0 +1,35 @@
+package com.umpani.aio;
+
+/**
+ * An object whose resources are explicitly managed by counting references. A new object has a reference count of
+ * one, every {@link #retain()} increments and every {@link #release()} decrements the count, once it drops to zero the
+ * resources are freed and the object must no longer be used.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface UReferenceCounted {
+	/**
+	 * Returns the current reference count.
+	 * @return
+	 * the current reference count, zero if the object was freed.
+	 */
+	public int refCnt();
+
+	/**
+	 * Increments the reference count by one.
+	 * @return
+	 * this.
+	 * @throws com.umpani.aio.exception.UIllegalReferenceCountException
+	 * if the object was already freed.
+	 */
+	public UReferenceCounted retain();
+
+	/**
+	 * Decrements the reference count by one and frees the resources, if the count dropped to zero.
+	 * @return
+	 * true if the count dropped to zero and the resources were freed.
+	 * @throws com.umpani.aio.exception.UIllegalReferenceCountException
+	 * if the object was already freed.
+	 */
+	public boolean release();
+}
@@ -0,0 +1,33 @@
+package com.umpani.aio;
+
+/**
+ * Helper methods for messages that may be {@link UReferenceCounted}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UReferences {
+	private UReferences() {}
+
+	/**
+	 * Releases the given message, if it is reference counted.
+	 * @param msg
+	 * the message.
+	 * @return
+	 * true if the message was reference counted and its count dropped to zero.
+	 */
+	public static boolean release( final Object msg ) {
+		return msg instanceof UReferenceCounted && ((UReferenceCounted)msg).release();
+	}
+
+	/**
+	 * Retains the given message, if it is reference counted.
+	 * @param msg
+	 * the message.
+	 * @return
+	 * the message.
+	 */
+	public static <T> T retain( final T msg ) {
+		if (msg instanceof UReferenceCounted) ((UReferenceCounted)msg).retain();
+		return msg;
+	}
+}
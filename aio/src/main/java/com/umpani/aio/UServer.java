@@ -0,0 +1,388 @@
+package com.umpani.aio;
+
+import java.io.IOException;
+import java.net.InetSocketAddress;
+import java.net.SocketAddress;
+import java.net.StandardSocketOptions;
+import java.nio.channels.SelectionKey;
+import java.nio.channels.ServerSocketChannel;
+import java.nio.channels.SocketChannel;
+import java.nio.file.Files;
+import java.nio.file.Path;
+import java.nio.file.attribute.PosixFilePermission;
+import java.util.ArrayList;
+import java.util.Collection;
+import java.util.Collections;
+import java.util.EnumSet;
+import java.util.List;
+import java.util.Set;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.RejectedExecutionException;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicInteger;
+
+/**
+ * A TCP server that accepts connections with the first loop of an {@link UEventLoopGroup} and distributes the
+ * accepted channels over all loops of the group. The pipeline of every accepted channel is set up by the
+ * {@link UChannelInitializer} of the server.
+ *
+ * </p><p>With the {@link UTransport#UNIX} transport the server listens on a Unix domain socket instead, the pipelines
+ * are the same. The socket file is created when bound and deleted when unbound, it must not exist before.
+ *
+ * </p><p>A graceful {@link #shutdown(long, TimeUnit)} stops accepting, asks the protocol handlers to finish their
+ * work with an {@link UDrainEvent} and closes the connections that are still open at the deadline. The event loops
+ * are not shut down, that is up to the owner of the group, see
+ * {@link UEventLoopGroup#shutdown(long, TimeUnit, UEventLoopGroup...)}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UServer {
+	/**
+	 * Create a new server that uses the default buffer pool.
+	 * @param group
+	 * the event loops.
+	 * @param initializer
+	 * the initializer of the accepted channels.
+	 */
+	public UServer( final UEventLoopGroup group, final UChannelInitializer initializer ) {
+		this(group, initializer, UBufferPool.DEFAULT);
+	}
+
+	/**
+	 * Create a new server.
+	 * @param group
+	 * the event loops.
+	 * @param initializer
+	 * the initializer of the accepted channels.
+	 * @param alloc
+	 * the buffer pool of the accepted channels.
+	 */
+	public UServer( final UEventLoopGroup group, final UChannelInitializer initializer, final UBufferPool alloc ) {
+		this.group = group;
+		this.initializer = initializer;
+		this.alloc = alloc;
+	}
+
+	/**
+	 * The event loops.
+	 */
+	protected final UEventLoopGroup group;
+
+	/**
+	 * The initializer of accepted channels.
+	 */
+	protected final UChannelInitializer initializer;
+
+	/**
+	 * The buffer pool of accepted channels.
+	 */
+	protected final UBufferPool alloc;
+
+	/**
+	 * The open channels.
+	 */
+	private final Set<UChannel> channels = Collections.newSetFromMap(new ConcurrentHashMap<UChannel, Boolean>());
+
+	/**
+	 * The transport.
+	 */
+	private volatile UTransport transport = UTransport.TCP;
+
+	/**
+	 * The permissions of the socket file of a Unix domain socket or null, to keep the default permissions.
+	 */
+	private volatile Set<PosixFilePermission> permissions;
+
+	/**
+	 * The server channel, once bound.
+	 */
+	private volatile ServerSocketChannel serverChannel;
+
+	/**
+	 * The socket file of a bound Unix domain socket.
+	 */
+	private volatile Path socketFile;
+
+	/**
+	 * Sets the transport, must be called before the server is bound.
+	 * @param transport
+	 * the transport.
+	 * @return
+	 * this.
+	 * @throws UnsupportedOperationException
+	 * if the transport is not available.
+	 */
+	public UServer setTransport( final UTransport transport ) {
+		if (transport==null) throw new NullPointerException("transport");
+		if (!transport.isAvailable()) throw new UnsupportedOperationException(transport+" sockets are not supported by this JDK");
+		this.transport = transport;
+		return this;
+	}
+
+	/**
+	 * Returns the transport.
+	 * @return
+	 * the transport.
+	 */
+	public UTransport getTransport() {
+		return transport;
+	}
+
+	/**
+	 * Sets the permissions of the socket file of a Unix domain socket, which are applied right after binding. Other
+	 * users may connect in between, a directory that only permitted users can access avoids that.
+	 * @param permissions
+	 * the permissions; null to keep the default permissions.
+	 * @return
+	 * this.
+	 */
+	public UServer setSocketFilePermissions( final Set<PosixFilePermission> permissions ) {
+		this.permissions = permissions!=null ? Collections.unmodifiableSet(EnumSet.copyOf(permissions)) : null;
+		return this;
+	}
+
+	/**
+	 * Binds the server to the given address and starts accepting connections.
+	 * @param address
+	 * the local address, use port zero to bind to any free port. With the {@link UTransport#UNIX} transport the
+	 * address of the socket file, see {@link UTransport#unixAddress(Path)}.
+	 * @return
+	 * the bound address; null if bound to a Unix domain socket.
+	 * @throws IOException
+	 * if binding failed.
+	 * @throws IllegalStateException
+	 * if the server is already bound.
+	 */
+	public synchronized InetSocketAddress bind( final SocketAddress address ) throws IOException {
+		if (serverChannel!=null) throw new IllegalStateException("Server already bound");
+		final UTransport transport = this.transport;
+		final ServerSocketChannel serverChannel = transport.openServerChannel();
+		Path socketFile = null;
+		try {
+			if (transport==UTransport.TCP) serverChannel.setOption(StandardSocketOptions.SO_REUSEADDR, true);
+			serverChannel.bind(address);
+			socketFile = UTransport.unixPath(serverChannel.getLocalAddress());
+			final Set<PosixFilePermission> permissions = this.permissions;
+			if (socketFile!=null && permissions!=null) Files.setPosixFilePermissions(socketFile, permissions);
+		} catch (IOException | RuntimeException e) {
+			serverChannel.close();
+			if (socketFile!=null) Files.deleteIfExists(socketFile);
+			throw e;
+		}
+		this.serverChannel = serverChannel;
+		this.socketFile = socketFile;
+		group.get(0).register(serverChannel, SelectionKey.OP_ACCEPT, new Acceptor());
+		return localAddress();
+	}
+
+	/**
+	 * Returns the bound address.
+	 * @return
+	 * the bound address or null, if the server is not bound or bound to a Unix domain socket.
+	 */
+	public InetSocketAddress localAddress() {
+		final SocketAddress address = localSocketAddress();
+		return address instanceof InetSocketAddress ? (InetSocketAddress)address : null;
+	}
+
+	/**
+	 * Returns the bound address of any transport.
+	 * @return
+	 * the bound address or null, if the server is not bound.
+	 */
+	public SocketAddress localSocketAddress() {
+		final ServerSocketChannel serverChannel = this.serverChannel;
+		if (serverChannel==null) return null;
+		try {
+			return serverChannel.getLocalAddress();
+		} catch (IOException e) {
+			return null;
+		}
+	}
+
+	/**
+	 * Returns a snapshot of the open channels.
+	 * @return
+	 * the open channels.
+	 */
+	public List<UChannel> channels() {
+		return new ArrayList<>(channels);
+	}
+
+	/**
+	 * Stops accepting new connections and deletes the socket file of a Unix domain socket.
+	 * @throws IOException
+	 * if closing the server channel or deleting the socket file failed.
+	 */
+	public void unbind() throws IOException {
+		final ServerSocketChannel serverChannel = this.serverChannel;
+		if (serverChannel==null) return;
+		serverChannel.close();
+		final Path socketFile = this.socketFile;
+		if (socketFile!=null) {
+			this.socketFile = null;
+			Files.deleteIfExists(socketFile);
+		}
+	}
+
+	/**
+	 * Stops accepting new connections and closes all open channels.
+	 * @return
+	 * the future that is completed once all channels are closed.
+	 */
+	public UFuture<List<Void>> close() {
+		try {
+			unbind();
+		} catch (IOException e) {
+			// ignore, we close anyway
+		}
+		final ArrayList<UFuture<Void>> futures = new ArrayList<>();
+		for (final UChannel channel : channels) futures.add(channel.close());
+		return UFuture.<Void>all(futures);
+	}
+
+	/**
+	 * Shuts the server down gracefully: stops accepting new connections, fires an {@link UDrainEvent} through the
+	 * pipelines of all open connections and closes the connections that are still open after the given timeout.
+	 * @param timeout
+	 * the maximal time to wait for the connections to close.
+	 * @param unit
+	 * the unit of the timeout.
+	 * @return
+	 * the future that is completed once all connections are closed.
+	 */
+	public UFuture<UDrainResult> shutdown( final long timeout, final TimeUnit unit ) {
+		try {
+			unbind();
+		} catch (IOException e) {
+			// ignore, we shut down anyway
+		}
+		return drain(channels, timeout, unit);
+	}
+
+	/**
+	 * Drains the given channels: an {@link UDrainEvent} is fired through the pipeline of every channel and the
+	 * channels that are still open after the given timeout are closed. The deadlines are timers of the loops of the
+	 * channels, so that the draining can be driven by an {@link UVirtualEventLoop} in tests.
+	 * @param channels
+	 * the channels.
+	 * @param timeout
+	 * the maximal time to wait for the channels to close.
+	 * @param unit
+	 * the unit of the timeout.
+	 * @return
+	 * the future that is completed once all channels are closed.
+	 */
+	public static UFuture<UDrainResult> drain( final Collection<? extends UChannel> channels, final long timeout, final TimeUnit unit ) {
+		final List<UChannel> snapshot = new ArrayList<UChannel>(channels);
+		final UPromise<UDrainResult> promise = new UPromise<UDrainResult>(null);
+		final AtomicInteger remaining = new AtomicInteger(snapshot.size());
+		final AtomicInteger killed = new AtomicInteger();
+		if (snapshot.isEmpty()) {
+			promise.complete(new UDrainResult(0, 0));
+			return promise;
+		}
+		for (final UChannel channel : snapshot) {
+			channel.closeFuture().addListener(new UFutureListener<Void>() {
+				@Override
+				public void complete( final UFuture<Void> future ) {
+					if (remaining.decrementAndGet()==0) promise.complete(new UDrainResult(snapshot.size() - killed.get(), killed.get()));
+				}
+			}, null);
+			try {
+				channel.loop().execute(new Runnable() {
+					@Override
+					public void run() {
+						drain(channel, timeout, unit, killed);
+					}
+				});
+			} catch (RejectedExecutionException e) {
+				// the loop terminates and closes the channel
+			}
+		}
+		return promise;
+	}
+
+	/**
+	 * Drains a single channel from its event loop.
+	 */
+	private static void drain( final UChannel channel, final long timeout, final TimeUnit unit, final AtomicInteger killed ) {
+		if (!channel.isOpen()) return;
+		final UFuture<Void> deadline = channel.loop().schedule(new Runnable() {
+			@Override
+			public void run() {
+				if (!channel.isOpen()) return;
+				killed.incrementAndGet();
+				channel.close();
+			}
+		}, timeout, unit);
+		channel.closeFuture().addListener(new UFutureListener<Void>() {
+			@Override
+			public void complete( final UFuture<Void> future ) {
+				deadline.cancel(false);
+			}
+		}, null);
+		channel.pipeline().fireUserEvent(UDrainEvent.INSTANCE);
+	}
+
+	/**
+	 * Called for every accepted connection, the default implementation creates an {@link USocketChannel}.
+	 * @param loop
+	 * the loop that serves the new channel.
+	 * @param channel
+	 * the accepted socket channel.
+	 * @return
+	 * the new channel.
+	 * @throws IOException
+	 * if the channel could not be created.
+	 */
+	protected USocketChannel newChannel( final UEventLoop loop, final SocketChannel channel ) throws IOException {
+		if (transport==UTransport.TCP) channel.setOption(StandardSocketOptions.TCP_NODELAY, true);
+		return new USocketChannel(loop, alloc, channel);
+	}
+
+	@Override
+	public String toString() {
+		return "UServer["+localSocketAddress()+"]";
+	}
+
+	/**
+	 * Accepts connections.
+	 */
+	private final class Acceptor extends UIoHandlerAdapter {
+		@Override
+		public void accept( final UEventLoop loop, final SelectionKey key ) throws Exception {
+			final ServerSocketChannel serverChannel = (ServerSocketChannel)key.channel();
+			SocketChannel accepted;
+			while ((accepted = serverChannel.accept())!=null) {
+				final UEventLoop child = group.next();
+				final USocketChannel channel;
+				try {
+					channel = newChannel(child, accepted);
+				} catch (Throwable t) {
+					accepted.close();
+					loop.exception(t);
+					continue;
+				}
+				channels.add(channel);
+				channel.closeFuture().addListener(new UFutureListener<Void>() {
+					@Override
+					public void complete( final UFuture<Void> future ) {
+						channels.remove(channel);
+					}
+				}, null);
+				try {
+					child.execute(new Runnable() {
+						@Override
+						public void run() {
+							channel.start(initializer, null, null);
+						}
+					});
+				} catch (Throwable t) {
+					channels.remove(channel);
+					accepted.close();
+				}
+			}
+		}
+	}
+}
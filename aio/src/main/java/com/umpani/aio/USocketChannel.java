@@ -0,0 +1,316 @@
+package com.umpani.aio;
+
+import java.io.IOException;
+import java.net.SocketAddress;
+import java.nio.ByteBuffer;
+import java.nio.channels.SelectionKey;
+import java.nio.channels.SocketChannel;
+
+/**
+ * A TCP connection served by an {@link UEventLoop}. Every read is passed as {@link UBuffer} allocated from the buffer
+ * pool of the channel into the pipeline, after all available bytes were read the read complete event follows. Channels
+ * are created by {@link UServer} for accepted connections and by {@link UClient} for outgoing connections.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class USocketChannel extends UChannel implements UIoHandler {
+	/**
+	 * The default size of the read buffers.
+	 */
+	public static final int DEFAULT_READ_BUFFER_SIZE = 8192;
+
+	/**
+	 * The maximal amount of reads per readiness event, to not starve other channels of the same loop.
+	 */
+	private static final int MAX_READS = 16;
+
+	/**
+	 * Create a new channel.
+	 * @param loop
+	 * the event loop that serves the channel.
+	 * @param alloc
+	 * the buffer pool of the channel.
+	 * @param channel
+	 * the socket channel.
+	 */
+	public USocketChannel( final UEventLoop loop, final UBufferPool alloc, final SocketChannel channel ) {
+		super(loop, alloc);
+		this.channel = channel;
+	}
+
+	/**
+	 * The socket channel.
+	 */
+	private final SocketChannel channel;
+
+	/**
+	 * The selection key, once registered.
+	 */
+	private SelectionKey key;
+
+	/**
+	 * The promise of a pending connect.
+	 */
+	private UPromise<USocketChannel> connectPromise;
+
+	/**
+	 * The size of the read buffers.
+	 */
+	private volatile int readBufferSize = DEFAULT_READ_BUFFER_SIZE;
+
+	/**
+	 * True if the channel reads automatically.
+	 */
+	private volatile boolean autoRead = true;
+
+	/**
+	 * True once the channel was activated.
+	 */
+	private volatile boolean active;
+
+	/**
+	 * Returns the socket channel.
+	 * @return
+	 * the socket channel.
+	 */
+	public final SocketChannel javaChannel() {
+		return channel;
+	}
+
+	/**
+	 * Sets the size of the buffers used for reading.
+	 * @param size
+	 * the size in bytes.
+	 * @return
+	 * this.
+	 */
+	public USocketChannel setReadBufferSize( final int size ) {
+		if (size <= 0) throw new IllegalArgumentException("size: "+size);
+		this.readBufferSize = size;
+		return this;
+	}
+
+	/**
+	 * Returns true if the channel reads automatically.
+	 * @return
+	 * true if the channel reads automatically.
+	 */
+	public boolean isAutoRead() {
+		return autoRead;
+	}
+
+	/**
+	 * Enables or disables automatic reading, disabling it stops reading from the socket, so that the remote peer is
+	 * throttled by TCP flow control.
+	 * @param autoRead
+	 * true to read; false to stop reading.
+	 * @return
+	 * this.
+	 */
+	public USocketChannel setAutoRead( final boolean autoRead ) {
+		this.autoRead = autoRead;
+		final UEventLoop loop = loop();
+		if (loop.inEventLoop()) {
+			updateReadInterest();
+		} else {
+			loop.execute(new Runnable() {
+				@Override
+				public void run() {
+					updateReadInterest();
+				}
+			});
+		}
+		return this;
+	}
+
+	@Override
+	public boolean isOpen() {
+		return channel.isOpen();
+	}
+
+	@Override
+	public boolean isActive() {
+		return active && channel.isOpen();
+	}
+
+	@Override
+	public SocketAddress localAddress() {
+		try {
+			return channel.getLocalAddress();
+		} catch (IOException e) {
+			return null;
+		}
+	}
+
+	@Override
+	public SocketAddress remoteAddress() {
+		try {
+			return channel.getRemoteAddress();
+		} catch (IOException e) {
+			return null;
+		}
+	}
+
+	/**
+	 * Initializes the pipeline, registers the channel and, if a remote address is given, connects it. Must be called
+	 * from the event loop.
+	 * @param initializer
+	 * the initializer of the pipeline, may be null.
+	 * @param remote
+	 * the address to connect to; null if the channel is already connected.
+	 * @param promise
+	 * the promise to complete once the channel is connected, may be null.
+	 */
+	final void start( final UChannelInitializer initializer, final SocketAddress remote, final UPromise<USocketChannel> promise ) {
+		try {
+			if (initializer!=null) initializer.initChannel(this);
+			channel.configureBlocking(false);
+			if (remote!=null && !channel.connect(remote)) {
+				connectPromise = promise;
+				key = loop().registerNow(channel, SelectionKey.OP_CONNECT, this);
+				return;
+			}
+			key = loop().registerNow(channel, 0, this);
+			activate(promise);
+		} catch (Throwable t) {
+			fail(promise, t);
+		}
+	}
+
+	/**
+	 * Activates the channel once connected.
+	 */
+	private void activate( final UPromise<USocketChannel> promise ) {
+		active = true;
+		updateReadInterest();
+		fireChannelActive();
+		if (promise!=null) promise.complete(this);
+		// write what was flushed while connecting
+		flushPending();
+	}
+
+	/**
+	 * Fails the given promise and closes the channel.
+	 */
+	private void fail( final UPromise<USocketChannel> promise, final Throwable cause ) {
+		if (promise!=null) {
+			promise.fail(cause);
+		} else {
+			pipeline().fireExceptionCaught(cause);
+		}
+		closeNow(new UPromise<Void>(null));
+	}
+
+	/**
+	 * Adds or removes read interest according to the auto read flag.
+	 */
+	private void updateReadInterest() {
+		final SelectionKey key = this.key;
+		if (key==null || !key.isValid() || !active) return;
+		final int ops = key.interestOps();
+		key.interestOps(autoRead ? ops | SelectionKey.OP_READ : ops & ~SelectionKey.OP_READ);
+	}
+
+	@Override
+	protected int writeBytes( final ByteBuffer buffer ) throws IOException {
+		if (!active) return 0;
+		return channel.write(buffer);
+	}
+
+	@Override
+	protected long writeRegion( final UFileRegion region ) throws IOException {
+		if (!active) return 0;
+		// zero-copy from the file cache to the socket
+		return region.transferTo(channel);
+	}
+
+	@Override
+	protected void setWriteInterest( final boolean interested ) {
+		final SelectionKey key = this.key;
+		if (key==null || !key.isValid() || !active) return;
+		final int ops = key.interestOps();
+		final int newOps = interested ? ops | SelectionKey.OP_WRITE : ops & ~SelectionKey.OP_WRITE;
+		if (newOps!=ops) key.interestOps(newOps);
+	}
+
+	@Override
+	protected void doClose() throws IOException {
+		if (key!=null) key.cancel();
+		channel.close();
+		final UPromise<USocketChannel> promise = connectPromise;
+		if (promise!=null) {
+			connectPromise = null;
+			promise.fail(new IOException("Channel closed before connected"));
+		}
+	}
+
+	@Override
+	public void accept( final UEventLoop loop, final SelectionKey key ) throws Exception {}
+
+	@Override
+	public void connect( final UEventLoop loop, final SelectionKey key ) throws Exception {
+		final UPromise<USocketChannel> promise = connectPromise;
+		try {
+			if (!channel.finishConnect()) {
+				key.interestOps(key.interestOps() | SelectionKey.OP_CONNECT);
+				return;
+			}
+		} catch (Throwable t) {
+			connectPromise = null;
+			fail(promise, t);
+			return;
+		}
+		connectPromise = null;
+		activate(promise);
+	}
+
+	@Override
+	public void read( final UEventLoop loop, final SelectionKey key ) throws Exception {
+		final UPipeline pipeline = pipeline();
+		final int size = readBufferSize;
+		boolean eof = false;
+		try {
+			for (int i=0; i < MAX_READS && autoRead; i++) {
+				final UBuffer buffer = alloc().allocate(size);
+				final int n;
+				try {
+					n = channel.read(buffer.nio());
+				} catch (Throwable t) {
+					buffer.release();
+					throw t;
+				}
+				if (n <= 0) {
+					buffer.release();
+					eof = n < 0;
+					break;
+				}
+				buffer.nio().flip();
+				countRead(n);
+				pipeline.fireChannelRead(buffer);
+				if (!channel.isOpen()) return;
+				// the socket has no more bytes available
+				if (n < size) break;
+			}
+		} finally {
+			if (channel.isOpen()) pipeline.fireChannelReadComplete();
+		}
+		if (eof) closeNow(new UPromise<Void>(null));
+	}
+
+	@Override
+	public void write( final UEventLoop loop, final SelectionKey key ) throws Exception {
+		flushPending();
+	}
+
+	@Override
+	public void exception( final UEventLoop loop, final SelectionKey key, final Throwable cause ) {
+		final UPromise<USocketChannel> promise = connectPromise;
+		connectPromise = null;
+		fail(promise, cause);
+	}
+
+	@Override
+	public void closed( final UEventLoop loop, final SelectionKey key ) {
+		closeNow(new UPromise<Void>(null));
+	}
+}
@@ -0,0 +1,137 @@
+package com.umpani.aio;
+
+/**
+ * A handle to a task scheduled at a {@link UTimerWheel}. Like the wheel itself, a timeout must only be used from the
+ * thread that owns the wheel.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UTimeout {
+	/**
+	 * The state of a pending timeout.
+	 */
+	static final int ST_PENDING = 0;
+
+	/**
+	 * The state of a cancelled timeout.
+	 */
+	static final int ST_CANCELLED = 1;
+
+	/**
+	 * The state of an expired timeout, whose task was executed.
+	 */
+	static final int ST_EXPIRED = 2;
+
+	UTimeout( final UTimerWheel wheel, final Runnable task, final long deadline, final long deadlineTick ) {
+		this.wheel = wheel;
+		this.task = task;
+		this.deadline = deadline;
+		this.deadlineTick = deadlineTick;
+	}
+
+	/**
+	 * The wheel at which the task is scheduled.
+	 */
+	final UTimerWheel wheel;
+
+	/**
+	 * The scheduled task.
+	 */
+	final Runnable task;
+
+	/**
+	 * The deadline in nanoseconds of the clock of the wheel.
+	 */
+	final long deadline;
+
+	/**
+	 * The tick at which the task expires.
+	 */
+	final long deadlineTick;
+
+	/**
+	 * The state.
+	 */
+	int state = ST_PENDING;
+
+	/**
+	 * The level and slot of the bucket in which the timeout is linked.
+	 */
+	int level, slot;
+
+	/**
+	 * The neighbours in the bucket.
+	 */
+	UTimeout prev, next;
+
+	/**
+	 * Returns the wheel at which the task is scheduled.
+	 * @return
+	 * the wheel at which the task is scheduled.
+	 */
+	public UTimerWheel wheel() {
+		return wheel;
+	}
+
+	/**
+	 * Returns the scheduled task.
+	 * @return
+	 * the scheduled task.
+	 */
+	public Runnable task() {
+		return task;
+	}
+
+	/**
+	 * Returns the deadline.
+	 * @return
+	 * the deadline in nanoseconds of the clock of the wheel.
+	 */
+	public long deadline() {
+		return deadline;
+	}
+
+	/**
+	 * Returns true if the task is neither cancelled nor expired.
+	 * @return
+	 * true if the task is neither cancelled nor expired.
+	 */
+	public boolean isPending() {
+		return state==ST_PENDING;
+	}
+
+	/**
+	 * Returns true if the timeout was cancelled.
+	 * @return
+	 * true if the timeout was cancelled.
+	 */
+	public boolean isCancelled() {
+		return state==ST_CANCELLED;
+	}
+
+	/**
+	 * Returns true if the timeout expired and its task was executed.
+	 * @return
+	 * true if the timeout expired.
+	 */
+	public boolean isExpired() {
+		return state==ST_EXPIRED;
+	}
+
+	/**
+	 * Cancels the timeout and removes it from the wheel in constant time.
+	 * @return
+	 * true if the timeout was cancelled; false if it already expired or was cancelled before.
+	 */
+	public boolean cancel() {
+		if (state!=ST_PENDING) return false;
+		state = ST_CANCELLED;
+		wheel.remove(this);
+		return true;
+	}
+
+	@Override
+	public String toString() {
+		return "UTimeout[deadline="+deadline+", state="+(state==ST_PENDING ? "pending" : (state==ST_CANCELLED ? "cancelled" : "expired"))+"]";
+	}
+}
@@ -0,0 +1,409 @@
+package com.umpani.aio;
+
+import java.util.ArrayList;
+import java.util.List;
+import java.util.concurrent.TimeUnit;
+
+/**
+ * A hierarchical hashed timer wheel. The time is divided into ticks of a fixed duration, each level of the wheel has
+ * the same amount of slots; a slot of the first level covers one tick, a slot of the next level covers all the ticks
+ * of the level below. A timeout is linked into the slot of the lowest level that covers its deadline and cascades down
+ * the levels while the time advances, so scheduling and cancelling are constant time operations, which makes the wheel
+ * suitable for millions of mostly cancelled timeouts, like idle or request timeouts. Timeouts beyond the range of the
+ * highest level are parked in the highest level and re-inserted until their deadline is in range.
+ *
+ * </p><p>A timeout never expires before its deadline, but up to one tick after it. The wheel does not own a thread,
+ * the owner has to call {@link #expire()} regularly, {@link #nextDelayNanos()} tells how long the owner may sleep. The
+ * wheel is not thread-safe, it must only be used by the thread that owns it, normally an {@link UEventLoop}.
+ *
+ * </p><p>The time is taken from an {@link UClock}, use an {@link UManualClock} to drive the wheel deterministically.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UTimerWheel {
+	/**
+	 * The default amount of slots per level.
+	 */
+	public static final int DEFAULT_WHEEL_SIZE = 256;
+
+	/**
+	 * The default amount of levels, with a tick of one millisecond the wheel covers about 49 days.
+	 */
+	public static final int DEFAULT_LEVELS = 4;
+
+	/**
+	 * Create a new timer wheel with the default amount of slots and levels.
+	 * @param clock
+	 * the clock to use.
+	 * @param tickDuration
+	 * the duration of a tick, the resolution of the wheel.
+	 * @param unit
+	 * the unit of the tick duration.
+	 */
+	public UTimerWheel( final UClock clock, final long tickDuration, final TimeUnit unit ) {
+		this(clock, tickDuration, unit, DEFAULT_WHEEL_SIZE, DEFAULT_LEVELS);
+	}
+
+	/**
+	 * Create a new timer wheel.
+	 * @param clock
+	 * the clock to use.
+	 * @param tickDuration
+	 * the duration of a tick, the resolution of the wheel.
+	 * @param unit
+	 * the unit of the tick duration.
+	 * @param wheelSize
+	 * the amount of slots per level, must be a power of two.
+	 * @param levels
+	 * the amount of levels.
+	 * @throws IllegalArgumentException
+	 * if any of the arguments is invalid.
+	 */
+	public UTimerWheel( final UClock clock, final long tickDuration, final TimeUnit unit, final int wheelSize, final int levels ) {
+		if (clock==null) throw new NullPointerException("clock");
+		if (unit.toNanos(tickDuration) <= 0) throw new IllegalArgumentException("The tick duration must be at least one nanosecond");
+		if (wheelSize < 2 || (wheelSize & (wheelSize-1))!=0) throw new IllegalArgumentException("The wheel size must be a power of two");
+		final int bits = Integer.numberOfTrailingZeros(wheelSize);
+		if (levels < 1 || levels*bits > 62) throw new IllegalArgumentException("Invalid amount of levels: "+levels);
+		this.clock = clock;
+		this.tickNanos = unit.toNanos(tickDuration);
+		this.bits = bits;
+		this.mask = wheelSize-1;
+		this.levels = levels;
+		this.range = 1L << (levels*bits);
+		this.buckets = new UTimeout[levels][wheelSize];
+		this.counts = new int[levels];
+		this.start = clock.nanoTime();
+	}
+
+	/**
+	 * The clock.
+	 */
+	private final UClock clock;
+
+	/**
+	 * The duration of a tick in nanoseconds.
+	 */
+	private final long tickNanos;
+
+	/**
+	 * The amount of bits of a slot index.
+	 */
+	private final int bits;
+
+	/**
+	 * The mask to calculate a slot index.
+	 */
+	private final int mask;
+
+	/**
+	 * The amount of levels.
+	 */
+	private final int levels;
+
+	/**
+	 * The amount of ticks covered by all levels.
+	 */
+	private final long range;
+
+	/**
+	 * The heads of the linked lists of timeouts per level and slot.
+	 */
+	private final UTimeout[][] buckets;
+
+	/**
+	 * The amount of timeouts per level.
+	 */
+	private final int[] counts;
+
+	/**
+	 * The time of tick zero.
+	 */
+	private final long start;
+
+	/**
+	 * The next tick to process.
+	 */
+	private long tick;
+
+	/**
+	 * The amount of pending timeouts.
+	 */
+	private int size;
+
+	/**
+	 * Returns the clock of this wheel.
+	 * @return
+	 * the clock of this wheel.
+	 */
+	public UClock clock() {
+		return clock;
+	}
+
+	/**
+	 * Returns the duration of a tick.
+	 * @return
+	 * the duration of a tick in nanoseconds.
+	 */
+	public long tickNanos() {
+		return tickNanos;
+	}
+
+	/**
+	 * Returns the amount of pending timeouts.
+	 * @return
+	 * the amount of pending timeouts.
+	 */
+	public int size() {
+		return size;
+	}
+
+	/**
+	 * Returns true if there are no pending timeouts.
+	 * @return
+	 * true if there are no pending timeouts.
+	 */
+	public boolean isEmpty() {
+		return size==0;
+	}
+
+	/**
+	 * Schedules the given task to be executed after the given delay.
+	 * @param task
+	 * the task.
+	 * @param delay
+	 * the delay, a negative delay is treated as zero.
+	 * @param unit
+	 * the unit of the delay.
+	 * @return
+	 * the timeout.
+	 */
+	public UTimeout schedule( final Runnable task, final long delay, final TimeUnit unit ) {
+		final long now = clock.nanoTime();
+		final long nanos = delay > 0 ? unit.toNanos(delay) : 0L;
+		long deadline = now + nanos;
+		// saturate on overflow
+		if (deadline < now) deadline = Long.MAX_VALUE;
+		return scheduleAt(task, deadline);
+	}
+
+	/**
+	 * Schedules the given task to be executed at the given time.
+	 * @param task
+	 * the task.
+	 * @param deadline
+	 * the time of the clock of this wheel in nanoseconds at which to execute the task.
+	 * @return
+	 * the timeout.
+	 */
+	public UTimeout scheduleAt( final Runnable task, final long deadline ) {
+		if (task==null) throw new NullPointerException("task");
+		final long elapsed = deadline - start;
+		long deadlineTick = elapsed <= 0 ? 0L : elapsed / tickNanos + (elapsed % tickNanos==0 ? 0 : 1);
+		if (deadlineTick < tick) deadlineTick = tick;
+		final UTimeout timeout = new UTimeout(this, task, deadline, deadlineTick);
+		insert(timeout);
+		size++;
+		return timeout;
+	}
+
+	/**
+	 * Links the given timeout into the slot that covers its deadline.
+	 */
+	private void insert( final UTimeout timeout ) {
+		long delta = timeout.deadlineTick - tick;
+		long placement = timeout.deadlineTick;
+		if (delta >= range) {
+			// park at the far end of the wheel, the deadline is checked again on expiry
+			delta = range-1;
+			placement = tick + delta;
+		}
+		int level = 0;
+		while (level < levels-1 && delta >= (1L << ((level+1)*bits))) level++;
+		link(timeout, level, (int)((placement >>> (level*bits)) & mask));
+	}
+
+	/**
+	 * Links the given timeout as head into the given bucket.
+	 */
+	private void link( final UTimeout timeout, final int level, final int slot ) {
+		final UTimeout head = buckets[level][slot];
+		timeout.level = level;
+		timeout.slot = slot;
+		timeout.prev = null;
+		timeout.next = head;
+		if (head!=null) head.prev = timeout;
+		buckets[level][slot] = timeout;
+		counts[level]++;
+	}
+
+	/**
+	 * Unlinks the given timeout from its bucket.
+	 */
+	private void unlink( final UTimeout timeout ) {
+		if (timeout.prev==null) {
+			buckets[timeout.level][timeout.slot] = timeout.next;
+		} else {
+			timeout.prev.next = timeout.next;
+		}
+		if (timeout.next!=null) timeout.next.prev = timeout.prev;
+		timeout.prev = null;
+		timeout.next = null;
+		counts[timeout.level]--;
+	}
+
+	/**
+	 * Removes a cancelled timeout.
+	 */
+	void remove( final UTimeout timeout ) {
+		// a timeout that is about to expire is no longer linked into a bucket
+		if (timeout.level >= 0) unlink(timeout);
+		size--;
+	}
+
+	/**
+	 * Detaches all timeouts of the given bucket.
+	 * @return
+	 * the head of the detached list.
+	 */
+	private UTimeout detach( final int level, final int slot ) {
+		final UTimeout head = buckets[level][slot];
+		buckets[level][slot] = null;
+		for (UTimeout t=head; t!=null; t=t.next) counts[level]--;
+		return head;
+	}
+
+	/**
+	 * Executes the tasks of all timeouts whose deadline passed. If a task throws an exception, the other tasks of the
+	 * same tick are still executed, then the first exception is thrown, the remaining ticks are processed by the next
+	 * call.
+	 * @return
+	 * the amount of expired timeouts.
+	 */
+	public int expire() {
+		final long elapsed = clock.nanoTime() - start;
+		if (elapsed < 0) return 0;
+		final long nowTick = elapsed / tickNanos;
+		int expired = 0;
+		while (tick <= nowTick) {
+			if (size==0) {
+				tick = nowTick+1;
+				break;
+			}
+			if (counts[0]==0 && (tick & mask)!=0) {
+				// nothing to do until the next cascade
+				tick = Math.min((tick | mask) + 1, nowTick+1);
+				continue;
+			}
+			expired += process(tick);
+		}
+		return expired;
+	}
+
+	/**
+	 * Processes the given tick: cascades the timeouts of the higher levels and expires the timeouts of the tick.
+	 * @return
+	 * the amount of expired timeouts.
+	 */
+	private int process( final long current ) {
+		for (int level=1; level < levels; level++) {
+			if ((current & ((1L << (level*bits)) - 1))!=0) break;
+			UTimeout t = detach(level, (int)((current >>> (level*bits)) & mask));
+			while (t!=null) {
+				final UTimeout next = t.next;
+				insert(t);
+				t = next;
+			}
+		}
+		// collect the due timeouts, re-insert the parked ones
+		UTimeout due = null;
+		UTimeout t = detach(0, (int)(current & mask));
+		while (t!=null) {
+			final UTimeout next = t.next;
+			if (t.deadlineTick > current) {
+				insert(t);
+			} else {
+				t.level = -1;
+				t.prev = null;
+				t.next = due;
+				due = t;
+			}
+			t = next;
+		}
+		tick = current+1;
+		// the tasks may schedule or cancel other timeouts
+		int expired = 0;
+		RuntimeException failure = null;
+		while (due!=null) {
+			final UTimeout timeout = due;
+			due = due.next;
+			timeout.next = null;
+			if (timeout.state!=UTimeout.ST_PENDING) continue;
+			timeout.state = UTimeout.ST_EXPIRED;
+			size--;
+			expired++;
+			try {
+				timeout.task.run();
+			} catch (RuntimeException e) {
+				if (failure==null) failure = e;
+			}
+		}
+		if (failure!=null) throw failure;
+		return expired;
+	}
+
+	/**
+	 * Returns the time until the owner has to call {@link #expire()} next.
+	 * @return
+	 * the time in nanoseconds until the next timeout may expire, zero if a timeout is already due or a negative
+	 * value if there are no pending timeouts.
+	 */
+	public long nextDelayNanos() {
+		if (size==0) return -1L;
+		long next = Long.MAX_VALUE;
+		if (counts[0] > 0) {
+			for (int i=0; i <= mask; i++) {
+				if (buckets[0][(int)((tick+i) & mask)]!=null) {
+					next = tick+i;
+					break;
+				}
+			}
+		}
+		if (size > counts[0]) {
+			// higher level timeouts cascade at the next boundary of the first level
+			final long boundary = (tick & mask)==0 ? tick : (tick | mask) + 1;
+			if (boundary < next) next = boundary;
+		}
+		final long delay = start + next*tickNanos - clock.nanoTime();
+		return delay > 0 ? delay : 0L;
+	}
+
+	/**
+	 * Cancels all pending timeouts.
+	 * @return
+	 * the tasks of the cancelled timeouts.
+	 */
+	public List<Runnable> clear() {
+		final ArrayList<Runnable> tasks = new ArrayList<Runnable>(size);
+		for (int level=0; level < levels; level++) {
+			for (int slot=0; slot <= mask; slot++) {
+				UTimeout t = detach(level, slot);
+				while (t!=null) {
+					final UTimeout next = t.next;
+					t.state = UTimeout.ST_CANCELLED;
+					t.prev = null;
+					t.next = null;
+					tasks.add(t.task);
+					t = next;
+				}
+			}
+		}
+		size = 0;
+		return tasks;
+	}
+
+	@Override
+	public String toString() {
+		return "UTimerWheel[tick="+tick+", size="+size+"]";
+	}
+}
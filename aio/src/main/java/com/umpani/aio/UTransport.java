@@ -0,0 +1,207 @@
+package com.umpani.aio;
+
+import java.io.IOException;
+import java.lang.reflect.InvocationTargetException;
+import java.lang.reflect.Method;
+import java.net.InetSocketAddress;
+import java.net.ProtocolFamily;
+import java.net.SocketAddress;
+import java.net.StandardProtocolFamily;
+import java.nio.channels.ServerSocketChannel;
+import java.nio.channels.SocketChannel;
+import java.nio.file.Path;
+
+/**
+ * The stream transports supported by {@link UServer} and {@link UClient}. Unix domain sockets require a JDK that
+ * supports <tt>java.net.UnixDomainSocketAddress</tt> (16 or later), they are accessed by reflection, so that this
+ * library still runs on older JDKs, where {@link #isAvailable()} returns false for them.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public enum UTransport {
+	/**
+	 * TCP over IPv4 or IPv6, addressed by {@link InetSocketAddress}.
+	 */
+	TCP,
+
+	/**
+	 * Unix domain sockets, addressed by a socket file, see {@link #unixAddress(Path)}.
+	 */
+	UNIX;
+
+	/**
+	 * Returns true if the transport is supported by the running JDK.
+	 * @return
+	 * true if the transport is available.
+	 */
+	public boolean isAvailable() {
+		return this==TCP || (UNIX_FAMILY!=null && UNIX_ADDRESS_OF!=null && UNIX_ADDRESS_GET_PATH!=null && OPEN_CHANNEL!=null && OPEN_SERVER_CHANNEL!=null);
+	}
+
+	/**
+	 * Opens an unconnected channel of this transport.
+	 * @return
+	 * the channel.
+	 * @throws IOException
+	 * if opening failed.
+	 * @throws UnsupportedOperationException
+	 * if the transport is not available.
+	 */
+	public SocketChannel openChannel() throws IOException {
+		if (this==TCP) return SocketChannel.open();
+		checkAvailable();
+		return (SocketChannel)invoke(OPEN_CHANNEL, null, UNIX_FAMILY);
+	}
+
+	/**
+	 * Opens an unbound server channel of this transport.
+	 * @return
+	 * the server channel.
+	 * @throws IOException
+	 * if opening failed.
+	 * @throws UnsupportedOperationException
+	 * if the transport is not available.
+	 */
+	public ServerSocketChannel openServerChannel() throws IOException {
+		if (this==TCP) return ServerSocketChannel.open();
+		checkAvailable();
+		return (ServerSocketChannel)invoke(OPEN_SERVER_CHANNEL, null, UNIX_FAMILY);
+	}
+
+	/**
+	 * Throws if the transport is not available.
+	 */
+	private void checkAvailable() {
+		if (!isAvailable()) throw new UnsupportedOperationException(this+" sockets are not supported by this JDK");
+	}
+
+	/**
+	 * Returns the transport of the given address.
+	 * @param address
+	 * the address.
+	 * @return
+	 * {@link #UNIX} for Unix domain socket addresses, otherwise {@link #TCP}.
+	 */
+	public static UTransport of( final SocketAddress address ) {
+		return UNIX_ADDRESS!=null && UNIX_ADDRESS.isInstance(address) ? UNIX : TCP;
+	}
+
+	/**
+	 * Returns the Unix domain socket address of the given socket file.
+	 * @param path
+	 * the path of the socket file.
+	 * @return
+	 * the address.
+	 * @throws UnsupportedOperationException
+	 * if Unix domain sockets are not available.
+	 */
+	public static SocketAddress unixAddress( final Path path ) {
+		if (path==null) throw new NullPointerException("path");
+		UNIX.checkAvailable();
+		try {
+			return (SocketAddress)invoke(UNIX_ADDRESS_OF, null, path);
+		} catch (IOException e) {
+			// of does not throw checked exceptions
+			throw new IllegalStateException(e);
+		}
+	}
+
+	/**
+	 * Returns the socket file of the given Unix domain socket address.
+	 * @param address
+	 * the address.
+	 * @return
+	 * the path of the socket file or null, if the address is no Unix domain socket address or unnamed.
+	 */
+	public static Path unixPath( final SocketAddress address ) {
+		if (of(address)!=UNIX) return null;
+		try {
+			final Path path = (Path)invoke(UNIX_ADDRESS_GET_PATH, address);
+			// unnamed addresses, like those of client sockets, have an empty path
+			return path.toString().isEmpty() ? null : path;
+		} catch (IOException e) {
+			// getPath does not throw checked exceptions
+			throw new IllegalStateException(e);
+		}
+	}
+
+	/**
+	 * <tt>java.net.UnixDomainSocketAddress</tt> or null, if not available.
+	 */
+	private static final Class<?> UNIX_ADDRESS = type("java.net.UnixDomainSocketAddress");
+
+	/**
+	 * <tt>StandardProtocolFamily.UNIX</tt> or null, if not available.
+	 */
+	private static final ProtocolFamily UNIX_FAMILY = unixFamily();
+
+	/**
+	 * <tt>UnixDomainSocketAddress.of(Path)</tt> or null, if not available.
+	 */
+	private static final Method UNIX_ADDRESS_OF = method(UNIX_ADDRESS, "of", Path.class);
+
+	/**
+	 * <tt>UnixDomainSocketAddress.getPath()</tt> or null, if not available.
+	 */
+	private static final Method UNIX_ADDRESS_GET_PATH = method(UNIX_ADDRESS, "getPath");
+
+	/**
+	 * <tt>SocketChannel.open(ProtocolFamily)</tt> or null, if not available.
+	 */
+	private static final Method OPEN_CHANNEL = method(SocketChannel.class, "open", ProtocolFamily.class);
+
+	/**
+	 * <tt>ServerSocketChannel.open(ProtocolFamily)</tt> or null, if not available.
+	 */
+	private static final Method OPEN_SERVER_CHANNEL = method(ServerSocketChannel.class, "open", ProtocolFamily.class);
+
+	/**
+	 * Returns the given class or null, if it does not exist.
+	 */
+	private static Class<?> type( final String name ) {
+		try {
+			return Class.forName(name);
+		} catch (ClassNotFoundException e) {
+			return null;
+		}
+	}
+
+	/**
+	 * Returns the Unix protocol family or null, if it does not exist.
+	 */
+	private static ProtocolFamily unixFamily() {
+		try {
+			return StandardProtocolFamily.valueOf("UNIX");
+		} catch (IllegalArgumentException e) {
+			return null;
+		}
+	}
+
+	/**
+	 * Returns the given public method or null, if it does not exist.
+	 */
+	private static Method method( final Class<?> type, final String name, final Class<?>... parameterTypes ) {
+		if (type==null) return null;
+		try {
+			return type.getMethod(name, parameterTypes);
+		} catch (NoSuchMethodException e) {
+			return null;
+		}
+	}
+
+	/**
+	 * Invokes the given method, an {@link IOException} thrown by the method is rethrown.
+	 */
+	private static Object invoke( final Method method, final Object target, final Object... args ) throws IOException {
+		try {
+			return method.invoke(target, args);
+		} catch (InvocationTargetException e) {
+			final Throwable cause = e.getCause();
+			if (cause instanceof IOException) throw (IOException)cause;
+			if (cause instanceof RuntimeException) throw (RuntimeException)cause;
+			throw new IllegalStateException("Failed to invoke "+method, cause);
+		} catch (ReflectiveOperationException e) {
+			throw new IllegalStateException("Failed to invoke "+method, e);
+		}
+	}
+}
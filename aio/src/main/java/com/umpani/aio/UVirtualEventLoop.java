@@ -0,0 +1,144 @@
+package com.umpani.aio;
+
+import java.io.IOException;
+import java.util.concurrent.TimeUnit;
+
+/**
+ * An event loop without a thread of its own, which is driven by the thread that created it, for deterministic tests.
+ * Tasks and timers only run when {@link #runPending()} or {@link #advance(long, TimeUnit)} is called and the timers
+ * use an {@link UManualClock}, so that time only passes when the test advances it. Together with
+ * {@link UMemoryChannel}s whole conversations run single-threaded and repeat exactly on every run. Channels that are
+ * registered at the selector, like sockets, are not served.
+ *
+ * </p><p>The creating thread is the loop thread, so that blocking waits for futures fail with an
+ * {@link com.umpani.aio.exception.UBlockingOperationException} instead of blocking forever, a test uses
+ * {@link UFuture#getNow()} after running the loop. The loop must be shut down by the creating thread at the end of
+ * the test.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UVirtualEventLoop extends UEventLoop {
+	/**
+	 * Create a new loop whose clock starts at zero.
+	 * @param name
+	 * the name of the loop.
+	 * @throws IOException
+	 * if opening the selector failed.
+	 */
+	public UVirtualEventLoop( final String name ) throws IOException {
+		this(name, new UManualClock());
+	}
+
+	/**
+	 * Create a new loop.
+	 * @param name
+	 * the name of the loop.
+	 * @param clock
+	 * the clock of the timers.
+	 * @throws IOException
+	 * if opening the selector failed.
+	 */
+	public UVirtualEventLoop( final String name, final UManualClock clock ) throws IOException {
+		super(name, clock);
+		this.clock = clock;
+		runInCurrentThread();
+	}
+
+	/**
+	 * The clock of the timers.
+	 */
+	private final UManualClock clock;
+
+	/**
+	 * Returns the clock of the timers.
+	 * @return
+	 * the clock.
+	 */
+	public final UManualClock clock() {
+		return clock;
+	}
+
+	/**
+	 * Always throws, the loop runs in the thread that created it.
+	 * @throws IllegalStateException
+	 * always.
+	 */
+	@Override
+	public synchronized UEventLoop start() {
+		throw new IllegalStateException("The virtual event loop "+name+" is driven by the thread that created it");
+	}
+
+	/**
+	 * Executes the submitted tasks and the due timers, until no more tasks are submitted.
+	 * @return
+	 * the amount of executed tasks and timers.
+	 * @throws IllegalStateException
+	 * if not called by the thread that created the loop.
+	 */
+	public int runPending() {
+		checkThread();
+		int count = 0;
+		for (;;) {
+			int n;
+			try {
+				n = timers().expire();
+			} catch (Throwable t) {
+				// the other timers of the tick were executed
+				exception(t);
+				n = 1;
+			}
+			n += runTasks();
+			if (n==0) return count;
+			count += n;
+		}
+	}
+
+	/**
+	 * Advances the clock by the given amount of time, timers expire in the order of their deadlines and the tasks they
+	 * submit are executed before the clock advances further.
+	 * @param amount
+	 * the amount of time.
+	 * @param unit
+	 * the unit of the amount.
+	 * @return
+	 * the amount of executed tasks and timers.
+	 * @throws IllegalArgumentException
+	 * if the amount is negative.
+	 * @throws IllegalStateException
+	 * if not called by the thread that created the loop.
+	 */
+	public int advance( final long amount, final TimeUnit unit ) {
+		if (amount < 0) throw new IllegalArgumentException("A clock must not go backwards");
+		int count = runPending();
+		long remaining = unit.toNanos(amount);
+		while (remaining > 0) {
+			final long next = timers().nextDelayNanos();
+			final long step = next > 0 && next < remaining ? next : remaining;
+			clock.advance(step, TimeUnit.NANOSECONDS);
+			remaining -= step;
+			count += runPending();
+		}
+		return count;
+	}
+
+	/**
+	 * Shuts the loop down: the remaining tasks are executed, then all channels are closed and all timers cancelled.
+	 * @throws IllegalStateException
+	 * if not called by the thread that created the loop.
+	 */
+	@Override
+	public void shutdown() {
+		checkThread();
+		if (isShuttingDown()) return;
+		super.shutdown();
+		runTasks();
+		terminate();
+	}
+
+	/**
+	 * Throws if the current thread is not the thread of the loop.
+	 */
+	private void checkThread() {
+		if (!inEventLoop()) throw new IllegalStateException("The virtual event loop "+name+" must be driven by the thread that created it");
+	}
+}
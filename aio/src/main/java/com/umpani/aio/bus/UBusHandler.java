@@ -0,0 +1,165 @@
+package com.umpani.aio.bus;
+
+import java.util.HashMap;
+import java.util.Map;
+
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.util.UMap;
+import com.umpani.util.bus.UBus;
+import com.umpani.util.bus.UBusFullPolicy;
+import com.umpani.util.bus.UBusListener;
+import com.umpani.util.bus.UBusSubscription;
+import com.umpani.util.exception.UBusFullException;
+
+/**
+ * Bridges an {@link UBus} to remote subscribers, the handler after an {@link com.umpani.aio.codec.UNdjsonDecoder}
+ * and an {@link com.umpani.aio.codec.UNdjsonEncoder} in the pipeline. The remote side sends commands as JSON objects:
+ *
+ * <pre>
+ * {"subscribe":"orders.#"}
+ * {"unsubscribe":"orders.#"}
+ * {"publish":"orders.created","message":{"id":1}}
+ * </pre>
+ *
+ * and receives every message published to a matching topic as <tt>{"topic":"orders.created","message":{"id":1}}</tt>.
+ * Publishing is only accepted if enabled, see {@link #setAllowPublish(boolean)}, invalid commands are answered with
+ * <tt>{"error":"..."}</tt>. The messages are delivered by the event loop of the connection with a bounded queue that
+ * drops messages when full, messages are dropped as well while the channel is not writable, so that a slow subscriber
+ * never blocks the publishers. The subscriptions are cancelled when the connection closes.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UBusHandler extends UChannelHandlerAdapter {
+	/**
+	 * Create a new handler with the default queue capacity.
+	 * @param bus
+	 * the bus.
+	 */
+	public UBusHandler( final UBus bus ) {
+		this(bus, UBus.DEFAULT_CAPACITY);
+	}
+
+	/**
+	 * Create a new handler.
+	 * @param bus
+	 * the bus.
+	 * @param capacity
+	 * the capacity of the queue of every subscription.
+	 */
+	public UBusHandler( final UBus bus, final int capacity ) {
+		if (bus==null) throw new NullPointerException("bus");
+		if (capacity <= 0) throw new IllegalArgumentException("capacity: "+capacity);
+		this.bus = bus;
+		this.capacity = capacity;
+	}
+
+	/**
+	 * The bus.
+	 */
+	protected final UBus bus;
+
+	/**
+	 * The capacity of the queue of every subscription.
+	 */
+	private final int capacity;
+
+	/**
+	 * The subscriptions of the connection by pattern, only accessed from the event loop.
+	 */
+	private final HashMap<String, UBusSubscription> subscriptions = new HashMap<>();
+
+	/**
+	 * True if the remote side may publish messages.
+	 */
+	private volatile boolean allowPublish;
+
+	/**
+	 * The amount of messages dropped, because the channel was not writable.
+	 */
+	private volatile long dropped;
+
+	/**
+	 * Allows or forbids the remote side to publish messages, which is forbidden by default.
+	 * @param allowPublish
+	 * true to accept published messages.
+	 * @return
+	 * this.
+	 */
+	public UBusHandler setAllowPublish( final boolean allowPublish ) {
+		this.allowPublish = allowPublish;
+		return this;
+	}
+
+	/**
+	 * Returns the amount of messages that were dropped, because the channel was not writable. Messages dropped because
+	 * the queue of a subscription was full are counted by the subscription.
+	 * @return
+	 * the amount of dropped messages.
+	 */
+	public long getDropped() {
+		return dropped;
+	}
+
+	@Override
+	public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+		if (!(msg instanceof Map)) {
+			error(ctx, "Command must be an object");
+			return;
+		}
+		final Map<?,?> command = (Map<?,?>)msg;
+		try {
+			if (command.get("subscribe") instanceof String) {
+				subscribe(ctx, (String)command.get("subscribe"));
+			} else
+			if (command.get("unsubscribe") instanceof String) {
+				final UBusSubscription subscription = subscriptions.remove(command.get("unsubscribe"));
+				if (subscription!=null) subscription.cancel();
+			} else
+			if (command.get("publish") instanceof String && command.get("message") instanceof Map) {
+				if (!allowPublish) {
+					error(ctx, "Publishing is not allowed");
+					return;
+				}
+				bus.publish((String)command.get("publish"), (Map<?,?>)command.get("message"));
+			} else {
+				error(ctx, "Unknown command");
+			}
+		} catch (IllegalArgumentException | UBusFullException e) {
+			error(ctx, e.getMessage());
+		}
+	}
+
+	/**
+	 * Subscribes the remote side to the given pattern, unless already subscribed.
+	 */
+	private void subscribe( final UHandlerContext ctx, final String pattern ) {
+		if (subscriptions.containsKey(pattern)) return;
+		final UBusSubscription subscription = bus.subscribe(pattern, ctx.loop(), capacity, UBusFullPolicy.DROP, new UBusListener() {
+			@Override
+			public void onMessage( final String topic, final UMap<String,Object> message ) {
+				if (!ctx.channel().isActive()) return;
+				if (!ctx.channel().isWritable()) {
+					dropped++;
+					return;
+				}
+				ctx.writeAndFlush(UMap.of(String.class, Object.class, "topic", topic, "message", message));
+			}
+		});
+		subscriptions.put(pattern, subscription);
+	}
+
+	/**
+	 * Answers an invalid command.
+	 */
+	private static void error( final UHandlerContext ctx, final String message ) {
+		ctx.writeAndFlush(UMap.of(String.class, Object.class, "error", message));
+	}
+
+	@Override
+	public void channelInactive( final UHandlerContext ctx ) throws Exception {
+		for (final UBusSubscription subscription : subscriptions.values()) subscription.cancel();
+		subscriptions.clear();
+		ctx.fireChannelInactive();
+	}
+}
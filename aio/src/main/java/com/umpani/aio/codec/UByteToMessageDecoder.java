@@ -0,0 +1,144 @@
+package com.umpani.aio.codec;
+
+import java.util.ArrayList;
+import java.util.List;
+
+import com.umpani.aio.UBuffer;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UCompositeBuffer;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.exception.UCodecException;
+
+/**
+ * The base class for inbound handlers that decode bytes into messages. All received {@link UBuffer}s are cumulated
+ * in a {@link UCompositeBuffer} without copying, {@link #decode(UHandlerContext, UCompositeBuffer, List)} is called
+ * as long as it makes progress and every decoded message is passed to the next handler. Bytes that do not yet form a
+ * complete message simply stay in the cumulation until more bytes arrive. Other messages are passed on unchanged.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public abstract class UByteToMessageDecoder extends UChannelHandlerAdapter {
+	/**
+	 * The cumulated bytes.
+	 */
+	private UCompositeBuffer cumulation = new UCompositeBuffer();
+
+	/**
+	 * The decoded messages.
+	 */
+	private final ArrayList<Object> out = new ArrayList<>();
+
+	/**
+	 * Decodes messages from the given bytes. An implementation either reads the bytes of at least one message and
+	 * adds the message to the output, consumes bytes without output (for example to skip them) or returns without
+	 * consuming anything, if more bytes are required.
+	 * @param ctx
+	 * the context of the handler.
+	 * @param in
+	 * the cumulated bytes.
+	 * @param out
+	 * the list to add decoded messages to.
+	 * @throws Exception
+	 * if the bytes are invalid.
+	 */
+	protected abstract void decode( final UHandlerContext ctx, final UCompositeBuffer in, final List<Object> out ) throws Exception;
+
+	/**
+	 * Called once the channel became inactive, after decoding as many messages as possible. The default
+	 * implementation calls {@link #decode(UHandlerContext, UCompositeBuffer, List)} once more, if bytes are left.
+	 * @param ctx
+	 * the context of the handler.
+	 * @param in
+	 * the cumulated bytes.
+	 * @param out
+	 * the list to add decoded messages to.
+	 * @throws Exception
+	 * if the bytes are invalid.
+	 */
+	protected void decodeLast( final UHandlerContext ctx, final UCompositeBuffer in, final List<Object> out ) throws Exception {
+		if (in.isReadable()) decode(ctx, in, out);
+	}
+
+	/**
+	 * Returns the amount of cumulated, not yet decoded bytes.
+	 * @return
+	 * the amount of bytes.
+	 */
+	protected final int actualReadableBytes() {
+		return cumulation.readableBytes();
+	}
+
+	@Override
+	public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+		if (msg instanceof UBuffer) {
+			cumulation.add((UBuffer)msg);
+		} else
+		if (msg instanceof UCompositeBuffer) {
+			cumulation.add((UCompositeBuffer)msg);
+		} else {
+			ctx.fireChannelRead(msg);
+			return;
+		}
+		callDecode(ctx);
+	}
+
+	@Override
+	public void channelInactive( final UHandlerContext ctx ) throws Exception {
+		try {
+			callDecode(ctx);
+			try {
+				decodeLast(ctx, cumulation, out);
+			} finally {
+				fireDecoded(ctx);
+			}
+		} finally {
+			cumulation.release();
+			cumulation = new UCompositeBuffer();
+			ctx.fireChannelInactive();
+		}
+	}
+
+	@Override
+	public void handlerRemoved( final UHandlerContext ctx ) throws Exception {
+		// pass what is left to the next handler
+		final UCompositeBuffer left = cumulation;
+		cumulation = new UCompositeBuffer();
+		if (left.isReadable()) {
+			ctx.fireChannelRead(left);
+			ctx.fireChannelReadComplete();
+		} else {
+			left.release();
+		}
+	}
+
+	/**
+	 * Decodes as long as messages are produced or bytes are consumed.
+	 */
+	private void callDecode( final UHandlerContext ctx ) throws Exception {
+		final UCompositeBuffer in = cumulation;
+		try {
+			while (in.isReadable() && !ctx.isRemoved()) {
+				final int before = in.readableBytes();
+				decode(ctx, in, out);
+				if (out.isEmpty()) {
+					if (before==in.readableBytes()) break;
+					continue;
+				}
+				if (before==in.readableBytes()) throw new UCodecException(getClass().getSimpleName()+".decode() produced a message without reading bytes");
+				fireDecoded(ctx);
+			}
+		} finally {
+			fireDecoded(ctx);
+		}
+	}
+
+	/**
+	 * Passes all decoded messages to the next handler.
+	 */
+	private void fireDecoded( final UHandlerContext ctx ) {
+		if (out.isEmpty()) return;
+		final Object[] messages = out.toArray();
+		out.clear();
+		for (final Object msg : messages) ctx.fireChannelRead(msg);
+	}
+}
@@ -0,0 +1,58 @@
+package com.umpani.aio.codec;
+
+/**
+ * The compression formats supported by {@link UCompressor} and {@link UDecompressor}, named like the HTTP content
+ * codings.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public enum UCompression {
+	/**
+	 * The gzip format of RFC 1952, a deflate stream with a header and a CRC-32 trailer.
+	 */
+	GZIP("gzip"),
+
+	/**
+	 * The zlib format of RFC 1950, a deflate stream with a header and an Adler-32 trailer. Some servers send a raw
+	 * deflate stream instead, which the {@link UDecompressor} accepts as well.
+	 */
+	DEFLATE("deflate");
+
+	/**
+	 * Create a new format.
+	 * @param encoding
+	 * the name of the content coding.
+	 */
+	private UCompression( final String encoding ) {
+		this.encoding = encoding;
+	}
+
+	/**
+	 * The name of the content coding.
+	 */
+	private final String encoding;
+
+	/**
+	 * Returns the name of the content coding.
+	 * @return
+	 * the name, for example <tt>gzip</tt>.
+	 */
+	public String encoding() {
+		return encoding;
+	}
+
+	/**
+	 * Returns the format of the given content coding.
+	 * @param encoding
+	 * the name of the content coding, the case is ignored and <tt>x-gzip</tt> is accepted as alias of <tt>gzip</tt>.
+	 * @return
+	 * the format or null, if the content coding is not supported.
+	 */
+	public static UCompression forEncoding( final String encoding ) {
+		if (encoding==null) return null;
+		final String name = encoding.trim();
+		if (name.equalsIgnoreCase("gzip") || name.equalsIgnoreCase("x-gzip")) return GZIP;
+		if (name.equalsIgnoreCase("deflate")) return DEFLATE;
+		return null;
+	}
+}
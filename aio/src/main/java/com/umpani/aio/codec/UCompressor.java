@@ -0,0 +1,227 @@
+package com.umpani.aio.codec;
+
+import java.util.Arrays;
+import java.util.zip.CRC32;
+import java.util.zip.Deflater;
+
+import com.umpani.aio.UBuffer;
+import com.umpani.aio.UBufferPool;
+
+/**
+ * Compresses a stream of bytes in the gzip or zlib format. The bytes may be passed in any amount of parts, every
+ * part may be flushed, so that the receiver can decompress everything passed so far, which is required for streamed
+ * HTTP bodies like server-sent events. The output of the {@link Deflater} is collected in a buffer of the pool, which
+ * {@link #close()} returns to the pool.
+ *
+ * </p><p>A compressor is not thread safe, it is used by the event loop of its channel.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UCompressor {
+	/**
+	 * The size of the buffer that collects the output of the deflater.
+	 */
+	private static final int BUFFER_SIZE = 8192;
+
+	/**
+	 * The gzip header without file name, modification time and flags.
+	 */
+	private static final byte[] GZIP_HEADER = { 0x1f, (byte)0x8b, Deflater.DEFLATED, 0, 0, 0, 0, 0, 0, (byte)0xff };
+
+	/**
+	 * Create a new compressor.
+	 * @param format
+	 * the format.
+	 * @param level
+	 * the compression level from 0 to 9 or {@link Deflater#DEFAULT_COMPRESSION}.
+	 * @param pool
+	 * the pool of the output buffer.
+	 */
+	public UCompressor( final UCompression format, final int level, final UBufferPool pool ) {
+		if (format==null) throw new NullPointerException("format");
+		if ((level < 0 || level > 9) && level!=Deflater.DEFAULT_COMPRESSION) throw new IllegalArgumentException("level: "+level);
+		this.deflater = new Deflater(level, format==UCompression.GZIP);
+		this.crc = format==UCompression.GZIP ? new CRC32() : null;
+		this.buffer = pool.heapBuffer(BUFFER_SIZE);
+	}
+
+	/**
+	 * The deflater.
+	 */
+	private final Deflater deflater;
+
+	/**
+	 * The checksum of the gzip trailer or null, if the format is zlib.
+	 */
+	private final CRC32 crc;
+
+	/**
+	 * The buffer that collects the output of the deflater.
+	 */
+	private UBuffer buffer;
+
+	/**
+	 * The output collected since the last call.
+	 */
+	private byte[] out = new byte[64];
+
+	/**
+	 * The length of the collected output.
+	 */
+	private int outLength;
+
+	/**
+	 * True once the gzip header was written.
+	 */
+	private boolean started;
+
+	/**
+	 * True once the stream was finished.
+	 */
+	private boolean finished;
+
+	/**
+	 * Compresses a part of the stream.
+	 * @param data
+	 * the bytes.
+	 * @param offset
+	 * the offset of the first byte.
+	 * @param length
+	 * the amount of bytes.
+	 * @param flush
+	 * true to flush the output, so that it can be decompressed completely.
+	 * @return
+	 * the compressed bytes, possibly empty if the part is not flushed.
+	 * @throws IllegalStateException
+	 * if the stream was already finished or the compressor was closed.
+	 */
+	public byte[] compress( final byte[] data, final int offset, final int length, final boolean flush ) {
+		check();
+		start();
+		if (crc!=null) crc.update(data, offset, length);
+		deflater.setInput(data, offset, length);
+		if (flush) {
+			drain(Deflater.SYNC_FLUSH);
+		} else {
+			while (!deflater.needsInput()) drain(Deflater.NO_FLUSH);
+		}
+		return output();
+	}
+
+	/**
+	 * Finishes the stream and closes the compressor.
+	 * @return
+	 * the remaining compressed bytes including the trailer.
+	 * @throws IllegalStateException
+	 * if the stream was already finished or the compressor was closed.
+	 */
+	public byte[] finish() {
+		check();
+		start();
+		deflater.finish();
+		while (!deflater.finished()) drain(Deflater.NO_FLUSH);
+		if (crc!=null) {
+			writeIntLE((int)crc.getValue());
+			writeIntLE(deflater.getTotalIn());
+		}
+		finished = true;
+		final byte[] result = output();
+		close();
+		return result;
+	}
+
+	/**
+	 * Compresses the given bytes completely.
+	 * @param format
+	 * the format.
+	 * @param data
+	 * the bytes.
+	 * @param pool
+	 * the pool of the output buffer.
+	 * @return
+	 * the compressed bytes.
+	 */
+	public static byte[] compress( final UCompression format, final byte[] data, final UBufferPool pool ) {
+		final UCompressor compressor = new UCompressor(format, Deflater.DEFAULT_COMPRESSION, pool);
+		try {
+			final byte[] head = compressor.compress(data, 0, data.length, false);
+			final byte[] tail = compressor.finish();
+			final byte[] result = Arrays.copyOf(head, head.length + tail.length);
+			System.arraycopy(tail, 0, result, head.length, tail.length);
+			return result;
+		} finally {
+			compressor.close();
+		}
+	}
+
+	/**
+	 * Releases the deflater and the buffer, further calls are ignored. A compressor must be closed, if its stream is
+	 * not finished.
+	 */
+	public void close() {
+		if (buffer==null) return;
+		deflater.end();
+		buffer.release();
+		buffer = null;
+	}
+
+	@Override
+	public String toString() {
+		return "UCompressor["+(crc!=null ? UCompression.GZIP : UCompression.DEFLATE)+(finished ? ", finished" : buffer==null ? ", closed" : "")+"]";
+	}
+
+	/**
+	 * Throws if the compressor can't be used anymore.
+	 */
+	private void check() {
+		if (finished || buffer==null) throw new IllegalStateException(finished ? "Stream finished" : "Compressor closed");
+	}
+
+	/**
+	 * Writes the gzip header before the first output.
+	 */
+	private void start() {
+		if (started) return;
+		started = true;
+		if (crc!=null) append(GZIP_HEADER, 0, GZIP_HEADER.length);
+	}
+
+	/**
+	 * Collects the output of the deflater; with a flush until all pending output was collected.
+	 */
+	private void drain( final int flush ) {
+		final byte[] array = buffer.nio().array();
+		final int offset = buffer.nio().arrayOffset();
+		final int size = buffer.nio().limit();
+		int n;
+		do {
+			n = deflater.deflate(array, offset, size, flush);
+			append(array, offset, n);
+		} while (flush!=Deflater.NO_FLUSH && n==size);
+	}
+
+	/**
+	 * Appends bytes to the collected output.
+	 */
+	private void append( final byte[] data, final int offset, final int length ) {
+		if (outLength + length > out.length) out = Arrays.copyOf(out, Math.max(outLength + length, out.length << 1));
+		System.arraycopy(data, offset, out, outLength, length);
+		outLength += length;
+	}
+
+	/**
+	 * Appends an int in little endian byte order.
+	 */
+	private void writeIntLE( final int value ) {
+		append(new byte[] { (byte)value, (byte)(value >>> 8), (byte)(value >>> 16), (byte)(value >>> 24) }, 0, 4);
+	}
+
+	/**
+	 * Returns the collected output and resets it.
+	 */
+	private byte[] output() {
+		final byte[] result = Arrays.copyOf(out, outLength);
+		outLength = 0;
+		return result;
+	}
+}
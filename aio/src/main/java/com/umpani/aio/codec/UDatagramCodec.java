@@ -0,0 +1,108 @@
+package com.umpani.aio.codec;
+
+import java.nio.charset.StandardCharsets;
+
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UDatagramPacket;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.exception.UCodecException;
+import com.umpani.util.UMap;
+import com.umpani.util.cbor.UCborReader;
+import com.umpani.util.cbor.UCborWriter;
+import com.umpani.util.json.UJsonReader;
+import com.umpani.util.json.UJsonWriter;
+
+/**
+ * Maps every datagram to exactly one {@link UMap}, encoded as JSON or CBOR. Received {@link UDatagramPacket}s are
+ * passed on as {@link UMapDatagram} that carries the sender, datagrams that do not hold exactly one map are dropped
+ * and reported as {@link UCodecException}, because every datagram stands on its own. Written {@link UMapDatagram}s
+ * are sent to their address, plain maps to the connected peer, other messages are passed on unchanged.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UDatagramCodec extends UChannelHandlerAdapter {
+	/**
+	 * The encoding of the maps.
+	 */
+	public static enum Format {
+		/**
+		 * UTF-8 encoded JSON.
+		 */
+		JSON,
+
+		/**
+		 * CBOR (RFC 7049).
+		 */
+		CBOR
+	}
+
+	/**
+	 * Create a new codec.
+	 * @param format
+	 * the encoding of the maps.
+	 */
+	public UDatagramCodec( final Format format ) {
+		if (format==null) throw new NullPointerException("format");
+		this.format = format;
+	}
+
+	/**
+	 * The encoding of the maps.
+	 */
+	private final Format format;
+
+	/**
+	 * Returns the encoding of the maps.
+	 * @return
+	 * the format.
+	 */
+	public final Format format() {
+		return format;
+	}
+
+	@Override
+	@SuppressWarnings("unchecked")
+	public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+		if (!(msg instanceof UDatagramPacket)) {
+			ctx.fireChannelRead(msg);
+			return;
+		}
+		final UDatagramPacket packet = (UDatagramPacket)msg;
+		final Object value;
+		try {
+			final byte[] bytes = packet.toByteArray();
+			value = format==Format.JSON ? UJsonReader.parse(new String(bytes, StandardCharsets.UTF_8)) : UCborReader.parse(bytes);
+		} catch (Exception e) {
+			ctx.fireExceptionCaught(new UCodecException("Invalid datagram from "+packet.address()+": "+e.getMessage(), e));
+			return;
+		} finally {
+			packet.release();
+		}
+		if (!(value instanceof UMap)) {
+			ctx.fireExceptionCaught(new UCodecException("Datagram from "+packet.address()+" holds no map"));
+			return;
+		}
+		ctx.fireChannelRead(new UMapDatagram((UMap<String,Object>)value, packet.address()));
+	}
+
+	@Override
+	public void write( final UHandlerContext ctx, final Object msg, final UPromise<Void> promise ) throws Exception {
+		if (msg instanceof UMapDatagram) {
+			final UMapDatagram datagram = (UMapDatagram)msg;
+			ctx.write(new UDatagramPacket(encode(datagram.map()), datagram.address()), promise);
+		} else
+		if (msg instanceof UMap) {
+			ctx.write(new UDatagramPacket(encode((UMap<?,?>)msg), null), promise);
+		} else {
+			ctx.write(msg, promise);
+		}
+	}
+
+	/**
+	 * Encodes the given map.
+	 */
+	private byte[] encode( final UMap<?,?> map ) {
+		return format==Format.JSON ? UJsonWriter.toJson(map).getBytes(StandardCharsets.UTF_8) : UCborWriter.toCbor(map);
+	}
+}
@@ -0,0 +1,367 @@
+package com.umpani.aio.codec;
+
+import java.util.Arrays;
+import java.util.zip.CRC32;
+import java.util.zip.DataFormatException;
+import java.util.zip.Inflater;
+
+import com.umpani.aio.UBuffer;
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.exception.UCodecException;
+
+/**
+ * Decompresses a stream of bytes in the gzip or zlib format, the bytes may be passed in any amount of parts. Gzip
+ * streams with several members are decompressed completely, the deflate format accepts zlib streams as well as raw
+ * deflate streams, which are sent by some servers. The output of the {@link Inflater} is collected in a buffer of the
+ * pool, which {@link #close()} returns to the pool.
+ *
+ * </p><p>The size of the output is limited, so that a small, highly compressed input can't exhaust the memory of the
+ * receiver: the limit is checked while inflating, once it is exceeded the decompression fails before more output is
+ * collected.
+ *
+ * </p><p>A decompressor is not thread safe, it is used by the event loop of its channel.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UDecompressor {
+	/**
+	 * The size of the buffer that collects the output of the inflater.
+	 */
+	private static final int BUFFER_SIZE = 8192;
+
+	/**
+	 * The maximal size of a gzip header including the optional fields.
+	 */
+	private static final int MAX_HEADER_SIZE = 65536;
+
+	/**
+	 * The states of the decompressor.
+	 */
+	private static enum State {
+		HEADER, BODY, TRAILER, DONE
+	}
+
+	/**
+	 * Create a new decompressor.
+	 * @param format
+	 * the format.
+	 * @param maxSize
+	 * the maximal size of the decompressed stream in bytes.
+	 * @param pool
+	 * the pool of the output buffer.
+	 */
+	public UDecompressor( final UCompression format, final long maxSize, final UBufferPool pool ) {
+		if (format==null) throw new NullPointerException("format");
+		if (maxSize < 0) throw new IllegalArgumentException("maxSize: "+maxSize);
+		this.format = format;
+		this.maxSize = maxSize;
+		this.crc = format==UCompression.GZIP ? new CRC32() : null;
+		this.buffer = pool.heapBuffer(BUFFER_SIZE);
+	}
+
+	/**
+	 * The format.
+	 */
+	private final UCompression format;
+
+	/**
+	 * The maximal size of the decompressed stream.
+	 */
+	private final long maxSize;
+
+	/**
+	 * The checksum of the current gzip member or null, if the format is deflate.
+	 */
+	private final CRC32 crc;
+
+	/**
+	 * The buffer that collects the output of the inflater.
+	 */
+	private UBuffer buffer;
+
+	/**
+	 * The inflater, created once the header was read.
+	 */
+	private Inflater inflater;
+
+	/**
+	 * The current state.
+	 */
+	private State state = State.HEADER;
+
+	/**
+	 * The bytes of an incomplete header or trailer.
+	 */
+	private byte[] pending = new byte[16];
+
+	/**
+	 * The length of the pending bytes.
+	 */
+	private int pendingLength;
+
+	/**
+	 * The output collected since the last call.
+	 */
+	private byte[] out = new byte[64];
+
+	/**
+	 * The length of the collected output.
+	 */
+	private int outLength;
+
+	/**
+	 * The size of the decompressed stream so far.
+	 */
+	private long size;
+
+	/**
+	 * True once the size limit was exceeded.
+	 */
+	private boolean limitExceeded;
+
+	/**
+	 * Decompresses a part of the stream.
+	 * @param data
+	 * the bytes.
+	 * @param offset
+	 * the offset of the first byte.
+	 * @param length
+	 * the amount of bytes.
+	 * @return
+	 * the decompressed bytes, possibly empty.
+	 * @throws UCodecException
+	 * if the stream is invalid or the decompressed stream exceeds the maximal size, see {@link #isLimitExceeded()}.
+	 * @throws IllegalStateException
+	 * if the decompressor was closed.
+	 */
+	public byte[] decompress( final byte[] data, final int offset, final int length ) throws UCodecException {
+		if (buffer==null) throw new IllegalStateException("Decompressor closed");
+		byte[] in = data;
+		int off = offset;
+		int end = offset + length;
+		while (off < end) {
+			switch (state) {
+				case HEADER: {
+					appendPending(in, off, end - off);
+					off = end;
+					final int header = format==UCompression.GZIP ? gzipHeader() : zlibHeader();
+					if (header < 0) break;
+					// the bytes after the header belong to the body
+					in = Arrays.copyOfRange(pending, header, pendingLength);
+					off = 0;
+					end = in.length;
+					pendingLength = 0;
+					state = State.BODY;
+					break;
+				}
+				case BODY: {
+					inflater.setInput(in, off, end - off);
+					off = end;
+					inflate();
+					if (inflater.finished()) {
+						off = end - inflater.getRemaining();
+						state = format==UCompression.GZIP ? State.TRAILER : State.DONE;
+					}
+					break;
+				}
+				case TRAILER: {
+					final int n = Math.min(8 - pendingLength, end - off);
+					appendPending(in, off, n);
+					off += n;
+					if (pendingLength==8) {
+						if (readIntLE(0)!=(int)crc.getValue()) throw new UCodecException("Invalid gzip checksum");
+						if (readIntLE(4)!=(int)inflater.getBytesWritten()) throw new UCodecException("Invalid gzip size");
+						pendingLength = 0;
+						state = State.DONE;
+					}
+					break;
+				}
+				default: {
+					if (format!=UCompression.GZIP) {
+						// bytes after the end of a zlib stream are ignored
+						off = end;
+					} else {
+						// the next gzip member
+						inflater.reset();
+						crc.reset();
+						state = State.HEADER;
+					}
+				}
+			}
+		}
+		return output();
+	}
+
+	/**
+	 * Returns true if the stream ended, every complete stream must end.
+	 * @return
+	 * true if the stream ended.
+	 */
+	public boolean isFinished() {
+		return state==State.DONE;
+	}
+
+	/**
+	 * Returns true if the decompression failed, because the decompressed stream exceeded the maximal size.
+	 * @return
+	 * true if the size limit was exceeded.
+	 */
+	public boolean isLimitExceeded() {
+		return limitExceeded;
+	}
+
+	/**
+	 * Returns the size of the decompressed stream so far.
+	 * @return
+	 * the amount of decompressed bytes.
+	 */
+	public long size() {
+		return size;
+	}
+
+	/**
+	 * Decompresses the given bytes completely.
+	 * @param format
+	 * the format.
+	 * @param data
+	 * the compressed bytes.
+	 * @param maxSize
+	 * the maximal size of the decompressed bytes.
+	 * @param pool
+	 * the pool of the output buffer.
+	 * @return
+	 * the decompressed bytes.
+	 * @throws UCodecException
+	 * if the bytes are invalid, incomplete or exceed the maximal size.
+	 */
+	public static byte[] decompress( final UCompression format, final byte[] data, final long maxSize, final UBufferPool pool ) throws UCodecException {
+		final UDecompressor decompressor = new UDecompressor(format, maxSize, pool);
+		try {
+			final byte[] result = decompressor.decompress(data, 0, data.length);
+			if (!decompressor.isFinished()) throw new UCodecException("Truncated "+format.encoding()+" stream");
+			return result;
+		} finally {
+			decompressor.close();
+		}
+	}
+
+	/**
+	 * Releases the inflater and the buffer, further calls are ignored.
+	 */
+	public void close() {
+		if (buffer==null) return;
+		if (inflater!=null) inflater.end();
+		buffer.release();
+		buffer = null;
+	}
+
+	@Override
+	public String toString() {
+		return "UDecompressor["+format+", size="+size+"]";
+	}
+
+	/**
+	 * Parses the pending gzip header and creates the inflater.
+	 * @return
+	 * the length of the header or -1, if the header is incomplete.
+	 */
+	private int gzipHeader() throws UCodecException {
+		final byte[] b = pending;
+		final int length = pendingLength;
+		if (length > MAX_HEADER_SIZE) throw new UCodecException("Gzip header exceeds "+MAX_HEADER_SIZE+" bytes");
+		if (length >= 1 && (b[0] & 0xff)!=0x1f || length >= 2 && (b[1] & 0xff)!=0x8b) throw new UCodecException("Not in gzip format");
+		if (length < 10) return -1;
+		if (b[2]!=8) throw new UCodecException("Unsupported gzip compression method "+b[2]);
+		final int flags = b[3] & 0xff;
+		int i = 10;
+		// FEXTRA
+		if ((flags & 4)!=0) {
+			if (length < i + 2) return -1;
+			i += 2 + ((b[i] & 0xff) | (b[i + 1] & 0xff) << 8);
+			if (length < i) return -1;
+		}
+		// FNAME and FCOMMENT are terminated by zero
+		for (int flag=8; flag <= 16; flag<<=1) {
+			if ((flags & flag)==0) continue;
+			while (i < length && b[i]!=0) i++;
+			if (i++ >= length) return -1;
+		}
+		// FHCRC
+		if ((flags & 2)!=0) {
+			i += 2;
+			if (length < i) return -1;
+		}
+		if (inflater==null) inflater = new Inflater(true);
+		return i;
+	}
+
+	/**
+	 * Decides whether the pending bytes start a zlib or a raw deflate stream and creates the inflater.
+	 * @return
+	 * zero, because the inflater reads the zlib header itself, or -1 if more bytes are required.
+	 */
+	private int zlibHeader() {
+		if (pendingLength < 2) return -1;
+		final int cmf = pending[0] & 0xff;
+		final int flg = pending[1] & 0xff;
+		final boolean zlib = (cmf & 0x0f)==8 && ((cmf << 8) | flg) % 31==0;
+		inflater = new Inflater(!zlib);
+		return 0;
+	}
+
+	/**
+	 * Collects the output of the inflater until it needs more input or the stream ended.
+	 */
+	private void inflate() throws UCodecException {
+		final byte[] array = buffer.nio().array();
+		final int offset = buffer.nio().arrayOffset();
+		final int capacity = buffer.nio().limit();
+		for (;;) {
+			final int n;
+			try {
+				n = inflater.inflate(array, offset, capacity);
+			} catch (DataFormatException e) {
+				throw new UCodecException("Invalid "+format.encoding()+" stream: "+e.getMessage(), e);
+			}
+			if (n > 0) {
+				size += n;
+				if (size > maxSize) {
+					limitExceeded = true;
+					throw new UCodecException("Decompressed stream exceeds "+maxSize+" bytes");
+				}
+				if (crc!=null) crc.update(array, offset, n);
+				if (outLength + n > out.length) out = Arrays.copyOf(out, Math.max(outLength + n, out.length << 1));
+				System.arraycopy(array, offset, out, outLength, n);
+				outLength += n;
+				continue;
+			}
+			if (inflater.needsDictionary()) throw new UCodecException("Unsupported preset dictionary");
+			return;
+		}
+	}
+
+	/**
+	 * Appends bytes to the pending header or trailer.
+	 */
+	private void appendPending( final byte[] data, final int offset, final int length ) {
+		if (pendingLength + length > pending.length) pending = Arrays.copyOf(pending, Math.max(pendingLength + length, pending.length << 1));
+		System.arraycopy(data, offset, pending, pendingLength, length);
+		pendingLength += length;
+	}
+
+	/**
+	 * Reads an int in little endian byte order from the pending bytes.
+	 */
+	private int readIntLE( final int index ) {
+		return (pending[index] & 0xff) | (pending[index + 1] & 0xff) << 8 | (pending[index + 2] & 0xff) << 16 | (pending[index + 3] & 0xff) << 24;
+	}
+
+	/**
+	 * Returns the collected output and resets it.
+	 */
+	private byte[] output() {
+		final byte[] result = Arrays.copyOf(out, outLength);
+		outLength = 0;
+		return result;
+	}
+}
@@ -0,0 +1,132 @@
+package com.umpani.aio.codec;
+
+import java.util.List;
+
+import com.umpani.aio.UCompositeBuffer;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.exception.UTooLongFrameException;
+
+/**
+ * Splits the received bytes into frames at one or more delimiters, each frame is passed on as
+ * {@link com.umpani.aio.UBuffer}. If multiple delimiters are given, the frame ends at the delimiter found first. A
+ * frame that exceeds the maximal length is discarded up to the next delimiter and reported as
+ * {@link UTooLongFrameException}, the exception is thrown as soon as the frame becomes too long.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UDelimiterFrameDecoder extends UByteToMessageDecoder {
+	/**
+	 * Create a new decoder.
+	 * @param maxFrameLength
+	 * the maximal length of a frame, not counting the delimiter.
+	 * @param stripDelimiter
+	 * true to remove the delimiter from the frames.
+	 * @param delimiters
+	 * the delimiters.
+	 */
+	public UDelimiterFrameDecoder( final int maxFrameLength, final boolean stripDelimiter, final byte[]... delimiters ) {
+		if (maxFrameLength <= 0) throw new IllegalArgumentException("maxFrameLength: "+maxFrameLength);
+		if (delimiters.length==0) throw new IllegalArgumentException("No delimiters");
+		int maxDelimiterLength = 0;
+		for (final byte[] delimiter : delimiters) {
+			if (delimiter.length==0) throw new IllegalArgumentException("Empty delimiter");
+			maxDelimiterLength = Math.max(maxDelimiterLength, delimiter.length);
+		}
+		this.maxFrameLength = maxFrameLength;
+		this.stripDelimiter = stripDelimiter;
+		this.delimiters = delimiters.clone();
+		this.maxDelimiterLength = maxDelimiterLength;
+	}
+
+	/**
+	 * The maximal length of a frame.
+	 */
+	private final int maxFrameLength;
+
+	/**
+	 * True to remove the delimiter from the frames.
+	 */
+	private final boolean stripDelimiter;
+
+	/**
+	 * The delimiters.
+	 */
+	private final byte[][] delimiters;
+
+	/**
+	 * The length of the longest delimiter.
+	 */
+	private final int maxDelimiterLength;
+
+	/**
+	 * The index from which to continue searching, the bytes before were already searched.
+	 */
+	private int searchFrom;
+
+	/**
+	 * True while a too long frame is discarded.
+	 */
+	private boolean discarding;
+
+	@Override
+	protected void decode( final UHandlerContext ctx, final UCompositeBuffer in, final List<Object> out ) throws Exception {
+		int frameLength = -1;
+		byte[] found = null;
+		for (final byte[] delimiter : delimiters) {
+			final int index = indexOf(in, delimiter, searchFrom);
+			if (index >= 0 && (frameLength < 0 || index < frameLength)) {
+				frameLength = index;
+				found = delimiter;
+			}
+		}
+		if (found==null) {
+			// keep the bytes that may be the start of a delimiter
+			final int keep = maxDelimiterLength - 1;
+			if (discarding) {
+				in.skipBytes(Math.max(0, in.readableBytes() - keep));
+				searchFrom = 0;
+				return;
+			}
+			if (in.readableBytes() - keep > maxFrameLength) {
+				in.skipBytes(in.readableBytes() - keep);
+				searchFrom = 0;
+				discarding = true;
+				throw new UTooLongFrameException("Frame length exceeds "+maxFrameLength);
+			}
+			searchFrom = Math.max(0, in.readableBytes() - keep);
+			return;
+		}
+		searchFrom = 0;
+		if (discarding) {
+			// the end of the too long frame, which was already reported
+			in.skipBytes(frameLength + found.length);
+			discarding = false;
+			return;
+		}
+		if (frameLength > maxFrameLength) {
+			in.skipBytes(frameLength + found.length);
+			throw new UTooLongFrameException("Frame length "+frameLength+" exceeds "+maxFrameLength);
+		}
+		if (stripDelimiter) {
+			out.add(in.readBuffer(frameLength, ctx.alloc()));
+			in.skipBytes(found.length);
+		} else {
+			out.add(in.readBuffer(frameLength + found.length, ctx.alloc()));
+		}
+	}
+
+	/**
+	 * Returns the index of the given delimiter.
+	 */
+	private static int indexOf( final UCompositeBuffer in, final byte[] delimiter, final int from ) {
+		final int last = in.readableBytes() - delimiter.length;
+		int index = from;
+		while (index <= last && (index = in.indexOf(delimiter[0], index)) >= 0 && index <= last) {
+			int i = 1;
+			while (i < delimiter.length && in.getByte(index + i)==delimiter[i]) i++;
+			if (i==delimiter.length) return index;
+			index++;
+		}
+		return -1;
+	}
+}
@@ -0,0 +1,33 @@
+package com.umpani.aio.codec;
+
+import java.util.List;
+
+import com.umpani.aio.UCompositeBuffer;
+import com.umpani.aio.UHandlerContext;
+
+/**
+ * Splits the received bytes into frames of a fixed length, each frame is passed on as {@link com.umpani.aio.UBuffer}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UFixedLengthFrameDecoder extends UByteToMessageDecoder {
+	/**
+	 * Create a new decoder.
+	 * @param frameLength
+	 * the length of every frame.
+	 */
+	public UFixedLengthFrameDecoder( final int frameLength ) {
+		if (frameLength <= 0) throw new IllegalArgumentException("frameLength: "+frameLength);
+		this.frameLength = frameLength;
+	}
+
+	/**
+	 * The length of every frame.
+	 */
+	private final int frameLength;
+
+	@Override
+	protected void decode( final UHandlerContext ctx, final UCompositeBuffer in, final List<Object> out ) throws Exception {
+		if (in.readableBytes() >= frameLength) out.add(in.readBuffer(frameLength, ctx.alloc()));
+	}
+}
@@ -0,0 +1,149 @@
+package com.umpani.aio.codec;
+
+import java.util.List;
+
+import com.umpani.aio.UCompositeBuffer;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.exception.UCodecException;
+import com.umpani.aio.exception.UTooLongFrameException;
+
+/**
+ * Splits the received bytes into frames by a big-endian length field, each frame is passed on as
+ * {@link com.umpani.aio.UBuffer}. The position and the meaning of the length field are configurable:
+ * <pre>
+ * frame length = lengthFieldOffset + lengthFieldLength + length field value + lengthAdjustment
+ * </pre>
+ * The first initialBytesToStrip bytes of a frame are dropped, for example to remove the length field. Frames that
+ * exceed the maximal frame length are discarded and reported as {@link UTooLongFrameException}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class ULengthFieldFrameDecoder extends UByteToMessageDecoder {
+	/**
+	 * Create a new decoder for frames that start with a length field that counts the bytes following it, the length
+	 * field is stripped.
+	 * @param maxFrameLength
+	 * the maximal length of a frame including the length field.
+	 * @param lengthFieldLength
+	 * the length of the length field, either 1, 2, 3, 4 or 8.
+	 */
+	public ULengthFieldFrameDecoder( final int maxFrameLength, final int lengthFieldLength ) {
+		this(maxFrameLength, 0, lengthFieldLength, 0, lengthFieldLength);
+	}
+
+	/**
+	 * Create a new decoder.
+	 * @param maxFrameLength
+	 * the maximal length of a frame, as computed before stripping.
+	 * @param lengthFieldOffset
+	 * the offset of the length field within the frame.
+	 * @param lengthFieldLength
+	 * the length of the length field, either 1, 2, 3, 4 or 8.
+	 * @param lengthAdjustment
+	 * the value added to the length field value to compute the frame length, for example minus the header length,
+	 * if the length field counts the whole frame.
+	 * @param initialBytesToStrip
+	 * the amount of bytes dropped from the start of every frame.
+	 */
+	public ULengthFieldFrameDecoder( final int maxFrameLength, final int lengthFieldOffset, final int lengthFieldLength, final int lengthAdjustment, final int initialBytesToStrip ) {
+		if (maxFrameLength <= 0) throw new IllegalArgumentException("maxFrameLength: "+maxFrameLength);
+		if (lengthFieldOffset < 0) throw new IllegalArgumentException("lengthFieldOffset: "+lengthFieldOffset);
+		if (lengthFieldLength!=1 && lengthFieldLength!=2 && lengthFieldLength!=3 && lengthFieldLength!=4 && lengthFieldLength!=8) {
+			throw new IllegalArgumentException("lengthFieldLength: "+lengthFieldLength);
+		}
+		if (initialBytesToStrip < 0) throw new IllegalArgumentException("initialBytesToStrip: "+initialBytesToStrip);
+		this.maxFrameLength = maxFrameLength;
+		this.lengthFieldOffset = lengthFieldOffset;
+		this.lengthFieldLength = lengthFieldLength;
+		this.lengthAdjustment = lengthAdjustment;
+		this.initialBytesToStrip = initialBytesToStrip;
+	}
+
+	/**
+	 * The maximal length of a frame.
+	 */
+	private final int maxFrameLength;
+
+	/**
+	 * The offset of the length field.
+	 */
+	private final int lengthFieldOffset;
+
+	/**
+	 * The length of the length field.
+	 */
+	private final int lengthFieldLength;
+
+	/**
+	 * Added to the length field value.
+	 */
+	private final int lengthAdjustment;
+
+	/**
+	 * The amount of bytes dropped from the start of every frame.
+	 */
+	private final int initialBytesToStrip;
+
+	/**
+	 * The remaining bytes of a too long frame to discard.
+	 */
+	private long bytesToDiscard;
+
+	/**
+	 * Reads the length field.
+	 * @param in
+	 * the bytes.
+	 * @param offset
+	 * the offset of the length field.
+	 * @param length
+	 * the length of the length field.
+	 * @return
+	 * the value of the length field.
+	 */
+	protected long getFrameLength( final UCompositeBuffer in, final int offset, final int length ) {
+		switch (length) {
+			case 1:
+				return in.getUnsignedByte(offset);
+			case 2:
+				return in.getUnsignedShort(offset);
+			case 3:
+				return in.getUnsignedMedium(offset);
+			case 4:
+				return in.getUnsignedInt(offset);
+			default:
+				return in.getLong(offset);
+		}
+	}
+
+	@Override
+	protected void decode( final UHandlerContext ctx, final UCompositeBuffer in, final List<Object> out ) throws Exception {
+		if (bytesToDiscard > 0) {
+			final int n = (int)Math.min(bytesToDiscard, in.readableBytes());
+			in.skipBytes(n);
+			bytesToDiscard -= n;
+			return;
+		}
+		final int headerLength = lengthFieldOffset + lengthFieldLength;
+		if (in.readableBytes() < headerLength) return;
+		final long value = getFrameLength(in, lengthFieldOffset, lengthFieldLength);
+		final long frameLength = value + lengthAdjustment + headerLength;
+		if (value < 0 || frameLength < headerLength) {
+			in.skipBytes(headerLength);
+			throw new UCodecException("Invalid frame length: "+frameLength);
+		}
+		if (frameLength > maxFrameLength) {
+			final int n = (int)Math.min(frameLength, in.readableBytes());
+			in.skipBytes(n);
+			bytesToDiscard = frameLength - n;
+			throw new UTooLongFrameException("Frame length "+frameLength+" exceeds "+maxFrameLength);
+		}
+		final int length = (int)frameLength;
+		if (in.readableBytes() < length) return;
+		if (initialBytesToStrip > length) {
+			in.skipBytes(length);
+			throw new UCodecException("Frame length "+length+" is less than initialBytesToStrip "+initialBytesToStrip);
+		}
+		in.skipBytes(initialBytesToStrip);
+		out.add(in.readBuffer(length - initialBytesToStrip, ctx.alloc()));
+	}
+}
@@ -0,0 +1,80 @@
+package com.umpani.aio.codec;
+
+import java.nio.ByteBuffer;
+
+import com.umpani.aio.UBuffer;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UCompositeBuffer;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.UReferences;
+
+/**
+ * Prepends a big-endian length field with the amount of bytes of every written buffer, the counterpart of
+ * {@link ULengthFieldFrameDecoder#ULengthFieldFrameDecoder(int, int)}. The header and the message are passed on as
+ * {@link UCompositeBuffer} without copying the message.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class ULengthFieldPrepender extends UChannelHandlerAdapter {
+	/**
+	 * Create a new prepender.
+	 * @param lengthFieldLength
+	 * the length of the length field, either 1, 2, 3, 4 or 8.
+	 */
+	public ULengthFieldPrepender( final int lengthFieldLength ) {
+		if (lengthFieldLength!=1 && lengthFieldLength!=2 && lengthFieldLength!=3 && lengthFieldLength!=4 && lengthFieldLength!=8) {
+			throw new IllegalArgumentException("lengthFieldLength: "+lengthFieldLength);
+		}
+		this.lengthFieldLength = lengthFieldLength;
+	}
+
+	/**
+	 * The length of the length field.
+	 */
+	private final int lengthFieldLength;
+
+	@Override
+	public void write( final UHandlerContext ctx, final Object msg, final UPromise<Void> promise ) throws Exception {
+		final UCompositeBuffer frame = new UCompositeBuffer();
+		final int length;
+		if (msg instanceof UBuffer) {
+			length = ((UBuffer)msg).remaining();
+		} else
+		if (msg instanceof UCompositeBuffer) {
+			length = ((UCompositeBuffer)msg).readableBytes();
+		} else
+		if (msg instanceof ByteBuffer) {
+			length = ((ByteBuffer)msg).remaining();
+		} else
+		if (msg instanceof byte[]) {
+			length = ((byte[])msg).length;
+		} else {
+			frame.release();
+			ctx.write(msg, promise);
+			return;
+		}
+		if (lengthFieldLength < 8 && length >= 1L << (lengthFieldLength * 8)) {
+			frame.release();
+			UReferences.release(msg);
+			throw new IllegalArgumentException("Length "+length+" does not fit into "+lengthFieldLength+" bytes");
+		}
+		final UBuffer header = ctx.alloc().allocate(lengthFieldLength);
+		final ByteBuffer nio = header.nio();
+		for (int shift=(lengthFieldLength-1)*8; shift >= 0; shift -= 8) nio.put((byte)((long)length >>> shift));
+		nio.flip();
+		frame.add(header);
+		if (msg instanceof UBuffer) {
+			frame.add((UBuffer)msg);
+		} else
+		if (msg instanceof UCompositeBuffer) {
+			frame.add((UCompositeBuffer)msg);
+		} else
+		if (msg instanceof ByteBuffer) {
+			frame.add(UBuffer.wrap((ByteBuffer)msg));
+		} else {
+			frame.add(UBuffer.wrap((byte[])msg));
+		}
+		ctx.write(frame, promise);
+	}
+}
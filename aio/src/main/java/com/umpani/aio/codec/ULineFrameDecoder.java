@@ -0,0 +1,28 @@
+package com.umpani.aio.codec;
+
+/**
+ * Splits the received bytes into lines terminated by either "\n" or "\r\n".
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class ULineFrameDecoder extends UDelimiterFrameDecoder {
+	/**
+	 * Create a new decoder that strips the line terminators.
+	 * @param maxLength
+	 * the maximal length of a line, not counting the terminator.
+	 */
+	public ULineFrameDecoder( final int maxLength ) {
+		this(maxLength, true);
+	}
+
+	/**
+	 * Create a new decoder.
+	 * @param maxLength
+	 * the maximal length of a line, not counting the terminator.
+	 * @param stripDelimiter
+	 * true to remove the line terminators.
+	 */
+	public ULineFrameDecoder( final int maxLength, final boolean stripDelimiter ) {
+		super(maxLength, stripDelimiter, new byte[] { '\r', '\n' }, new byte[] { '\n' });
+	}
+}
@@ -0,0 +1,59 @@
+package com.umpani.aio.codec;
+
+import java.net.SocketAddress;
+
+import com.umpani.util.UMap;
+
+/**
+ * A map exchanged as one datagram by the {@link UDatagramCodec}, together with the address of the sender, if
+ * received, or the recipient, if written.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UMapDatagram {
+	/**
+	 * Create a new datagram.
+	 * @param map
+	 * the map.
+	 * @param address
+	 * the address of the sender or recipient; null to send the map to the connected peer.
+	 */
+	public UMapDatagram( final UMap<String,Object> map, final SocketAddress address ) {
+		if (map==null) throw new NullPointerException("map");
+		this.map = map;
+		this.address = address;
+	}
+
+	/**
+	 * The map.
+	 */
+	private final UMap<String,Object> map;
+
+	/**
+	 * The address of the sender or recipient.
+	 */
+	private final SocketAddress address;
+
+	/**
+	 * Returns the map.
+	 * @return
+	 * the map.
+	 */
+	public UMap<String,Object> map() {
+		return map;
+	}
+
+	/**
+	 * Returns the address of the sender of a received map or of the recipient of a written map.
+	 * @return
+	 * the address, may be null.
+	 */
+	public SocketAddress address() {
+		return address;
+	}
+
+	@Override
+	public String toString() {
+		return "UMapDatagram[address="+address+", map="+map+"]";
+	}
+}
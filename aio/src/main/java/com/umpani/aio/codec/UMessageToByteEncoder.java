@@ -0,0 +1,75 @@
+package com.umpani.aio.codec;
+
+import com.umpani.aio.UBufferOutputStream;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.UReferences;
+
+/**
+ * The base class for outbound handlers that encode messages of a given type into bytes. The bytes are written into
+ * pooled buffers and passed as {@link com.umpani.aio.UCompositeBuffer} to the previous handler, messages of other
+ * types are passed on unchanged. A reference counted message is released after encoding.
+ *
+ * @param <T>
+ * the type of the encoded messages.
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public abstract class UMessageToByteEncoder<T> extends UChannelHandlerAdapter {
+	/**
+	 * Create a new encoder.
+	 * @param type
+	 * the type of the messages to encode.
+	 */
+	protected UMessageToByteEncoder( final Class<? extends T> type ) {
+		this.type = type;
+	}
+
+	/**
+	 * The type of the messages to encode.
+	 */
+	private final Class<? extends T> type;
+
+	/**
+	 * Returns true if the given message is encoded by this encoder, the default implementation tests the type.
+	 * @param msg
+	 * the message.
+	 * @return
+	 * true if the message is encoded by this encoder.
+	 */
+	protected boolean accept( final Object msg ) {
+		return type.isInstance(msg);
+	}
+
+	/**
+	 * Encodes the given message.
+	 * @param ctx
+	 * the context of the handler.
+	 * @param msg
+	 * the message.
+	 * @param out
+	 * the stream to write the bytes to.
+	 * @throws Exception
+	 * if the message can't be encoded.
+	 */
+	protected abstract void encode( final UHandlerContext ctx, final T msg, final UBufferOutputStream out ) throws Exception;
+
+	@Override
+	public void write( final UHandlerContext ctx, final Object msg, final UPromise<Void> promise ) throws Exception {
+		if (!accept(msg)) {
+			ctx.write(msg, promise);
+			return;
+		}
+		final UBufferOutputStream out = new UBufferOutputStream(ctx.alloc());
+		try {
+			encode(ctx, type.cast(msg), out);
+		} catch (Throwable t) {
+			out.close();
+			throw t;
+		} finally {
+			UReferences.release(msg);
+		}
+		ctx.write(out.toBuffer(), promise);
+		out.close();
+	}
+}
@@ -0,0 +1,110 @@
+package com.umpani.aio.codec;
+
+import java.io.IOException;
+import java.util.ArrayList;
+import java.util.List;
+
+import com.umpani.aio.UBuffer;
+import com.umpani.aio.UCompositeBuffer;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.exception.UCodecException;
+import com.umpani.util.exception.UJsonException;
+import com.umpani.util.json.UJsonCallback;
+import com.umpani.util.json.UJsonPushParser;
+
+/**
+ * Decodes newline delimited JSON (NDJSON), every line holds exactly one JSON value, which is passed on as
+ * {@link com.umpani.util.UMap}, {@link com.umpani.util.UList}, string, number or boolean. Empty lines and lines that
+ * only hold null are ignored, because null is no valid message. Invalid lines are reported as {@link UCodecException}
+ * with the {@link UJsonException} as cause, lines that exceed the maximal length as
+ * {@link com.umpani.aio.exception.UTooLongFrameException}, decoding continues with the next line in both cases.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UNdjsonDecoder extends ULineFrameDecoder {
+	/**
+	 * The default maximal length of a line in bytes.
+	 */
+	public static final int DEFAULT_MAX_LINE_LENGTH = 1 << 20;
+
+	/**
+	 * Create a new decoder with the default maximal line length.
+	 */
+	public UNdjsonDecoder() {
+		this(DEFAULT_MAX_LINE_LENGTH);
+	}
+
+	/**
+	 * Create a new decoder.
+	 * @param maxLineLength
+	 * the maximal length of a line in bytes, not counting the line terminator.
+	 */
+	public UNdjsonDecoder( final int maxLineLength ) {
+		super(maxLineLength, true);
+		parser = new UJsonPushParser(new UJsonCallback() {
+			@Override
+			public void value( final Object value ) throws IOException {
+				if (!values.isEmpty()) throw new UCodecException("More than one JSON value in the line");
+				values.add(value);
+			}
+		});
+	}
+
+	/**
+	 * The parser used for every line.
+	 */
+	private final UJsonPushParser parser;
+
+	/**
+	 * The value parsed from the current line.
+	 */
+	private final ArrayList<Object> values = new ArrayList<>(1);
+
+	/**
+	 * The lines produced by the line decoder.
+	 */
+	private final ArrayList<Object> lines = new ArrayList<>(1);
+
+	/**
+	 * Sets the maximal nesting depth of the values.
+	 * @param maxDepth
+	 * the maximal nesting depth.
+	 * @return
+	 * this.
+	 */
+	public final UNdjsonDecoder setMaxDepth( final int maxDepth ) {
+		parser.setMaxDepth(maxDepth);
+		return this;
+	}
+
+	/**
+	 * Sets the maximal length of strings and numbers.
+	 * @param maxStringLength
+	 * the maximal length in characters.
+	 * @return
+	 * this.
+	 */
+	public final UNdjsonDecoder setMaxStringLength( final int maxStringLength ) {
+		parser.setMaxStringLength(maxStringLength);
+		return this;
+	}
+
+	@Override
+	protected void decode( final UHandlerContext ctx, final UCompositeBuffer in, final List<Object> out ) throws Exception {
+		super.decode(ctx, in, lines);
+		if (lines.isEmpty()) return;
+		final UBuffer line = (UBuffer)lines.get(0);
+		lines.clear();
+		try {
+			parser.reset();
+			parser.feed(line.nio());
+			parser.finish();
+			if (!values.isEmpty() && values.get(0)!=null) out.add(values.get(0));
+		} catch (UJsonException e) {
+			throw new UCodecException("Invalid JSON line: "+e.getMessage(), e);
+		} finally {
+			values.clear();
+			line.release();
+		}
+	}
+}
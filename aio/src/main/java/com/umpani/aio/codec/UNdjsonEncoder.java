@@ -0,0 +1,35 @@
+package com.umpani.aio.codec;
+
+import java.util.Collection;
+import java.util.Map;
+
+import com.umpani.aio.UBufferOutputStream;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.util.json.UJsonWriter;
+
+/**
+ * Encodes maps and collections, usually {@link com.umpani.util.UMap} and {@link com.umpani.util.UList}, as newline
+ * delimited JSON (NDJSON). The {@link UJsonWriter} writes directly into pooled buffers, every value is followed by a
+ * line-feed. All other messages are passed on unchanged.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UNdjsonEncoder extends UMessageToByteEncoder<Object> {
+	/**
+	 * Create a new encoder.
+	 */
+	public UNdjsonEncoder() {
+		super(Object.class);
+	}
+
+	@Override
+	protected boolean accept( final Object msg ) {
+		return msg instanceof Map || msg instanceof Collection;
+	}
+
+	@Override
+	protected void encode( final UHandlerContext ctx, final Object msg, final UBufferOutputStream out ) throws Exception {
+		new UJsonWriter(out).value(msg);
+		out.write('\n');
+	}
+}
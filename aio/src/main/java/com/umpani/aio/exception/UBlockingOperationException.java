@@ -0,0 +1,17 @@
+package com.umpani.aio.exception;
+
+/**
+ * An exception that is thrown if a blocking operation is invoked from within an event loop thread, which would
+ * otherwise block the loop and most likely cause a deadlock.
+ */
+@SuppressWarnings("serial")
+public class UBlockingOperationException extends IllegalStateException {
+	/**
+	 * Create a new blocking operation exception.
+	 * @param message
+	 * the detail message.
+	 */
+	public UBlockingOperationException( final String message ) {
+		super(message);
+	}
+}
@@ -0,0 +1,33 @@
+package com.umpani.aio.exception;
+
+import java.util.concurrent.RejectedExecutionException;
+
+/**
+ * Thrown by a {@link com.umpani.aio.resilience.UBulkhead} if the maximal amount of concurrent calls is running and
+ * the queue of waiting calls is full, the call was not executed.
+ */
+@SuppressWarnings("serial")
+public class UBulkheadFullException extends RejectedExecutionException {
+	/**
+	 * Create a new exception.
+	 * @param maxConcurrent
+	 * the maximal amount of concurrent calls.
+	 * @param maxQueued
+	 * the maximal amount of waiting calls.
+	 */
+	public UBulkheadFullException( final int maxConcurrent, final int maxQueued ) {
+		super("The bulkhead is full: "+maxConcurrent+" calls running and "+maxQueued+" waiting");
+		this.maxConcurrent = maxConcurrent;
+		this.maxQueued = maxQueued;
+	}
+
+	/**
+	 * The maximal amount of concurrent calls.
+	 */
+	public final int maxConcurrent;
+
+	/**
+	 * The maximal amount of waiting calls.
+	 */
+	public final int maxQueued;
+}
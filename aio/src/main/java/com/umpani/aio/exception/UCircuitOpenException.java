@@ -0,0 +1,24 @@
+package com.umpani.aio.exception;
+
+import java.util.concurrent.RejectedExecutionException;
+
+/**
+ * Thrown by an open {@link com.umpani.aio.resilience.UCircuitBreaker}, the call was not executed.
+ */
+@SuppressWarnings("serial")
+public class UCircuitOpenException extends RejectedExecutionException {
+	/**
+	 * Create a new exception.
+	 * @param remainingNanos
+	 * the time in nanoseconds until the breaker permits trial calls again.
+	 */
+	public UCircuitOpenException( final long remainingNanos ) {
+		super("The circuit breaker is open");
+		this.remainingNanos = remainingNanos;
+	}
+
+	/**
+	 * The time in nanoseconds until the breaker permits trial calls again, zero if it already permitted all of them.
+	 */
+	public final long remainingNanos;
+}
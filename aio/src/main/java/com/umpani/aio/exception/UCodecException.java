@@ -0,0 +1,29 @@
+package com.umpani.aio.exception;
+
+import java.io.IOException;
+
+/**
+ * An exception that is thrown by a codec if it fails to decode or encode a message.
+ */
+@SuppressWarnings("serial")
+public class UCodecException extends IOException {
+	/**
+	 * Create a new codec exception.
+	 * @param message
+	 * the detail message.
+	 */
+	public UCodecException( final String message ) {
+		super(message);
+	}
+
+	/**
+	 * Create a new codec exception.
+	 * @param message
+	 * the detail message.
+	 * @param cause
+	 * the cause.
+	 */
+	public UCodecException( final String message, final Throwable cause ) {
+		super(message, cause);
+	}
+}
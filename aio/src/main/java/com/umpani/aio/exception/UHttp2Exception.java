@@ -0,0 +1,72 @@
+package com.umpani.aio.exception;
+
+/**
+ * An exception that carries an HTTP/2 error code, thrown if a peer violates the HTTP/2 protocol or exceeds a limit.
+ * A connection error, with stream identifier zero, closes the connection with a GOAWAY frame, a stream error resets
+ * only the stream with a RST_STREAM frame.
+ */
+@SuppressWarnings("serial")
+public class UHttp2Exception extends UCodecException {
+	/**
+	 * Create a new connection error.
+	 * @param errorCode
+	 * the error code, see {@link com.umpani.aio.http2.UHttp2Frame}.
+	 * @param message
+	 * the detail message.
+	 */
+	public UHttp2Exception( final int errorCode, final String message ) {
+		this(0, errorCode, message);
+	}
+
+	/**
+	 * Create a new stream error.
+	 * @param streamId
+	 * the identifier of the stream or zero for a connection error.
+	 * @param errorCode
+	 * the error code, see {@link com.umpani.aio.http2.UHttp2Frame}.
+	 * @param message
+	 * the detail message.
+	 */
+	public UHttp2Exception( final int streamId, final int errorCode, final String message ) {
+		super(message);
+		this.streamId = streamId;
+		this.errorCode = errorCode;
+	}
+
+	/**
+	 * The identifier of the stream or zero.
+	 */
+	private final int streamId;
+
+	/**
+	 * The error code.
+	 */
+	private final int errorCode;
+
+	/**
+	 * Returns the identifier of the failed stream.
+	 * @return
+	 * the identifier or zero, if the connection failed.
+	 */
+	public int getStreamId() {
+		return streamId;
+	}
+
+	/**
+	 * Returns the error code.
+	 * @return
+	 * the error code.
+	 */
+	public int getErrorCode() {
+		return errorCode;
+	}
+
+	/**
+	 * Returns true if the connection failed, not only a single stream.
+	 * @return
+	 * true for a connection error.
+	 */
+	public boolean isConnectionError() {
+		return streamId==0;
+	}
+}
@@ -0,0 +1,48 @@
+package com.umpani.aio.exception;
+
+/**
+ * An exception that carries an HTTP status code, thrown by the HTTP codecs if a message is malformed or exceeds a
+ * limit and by HTTP handlers to answer a request with an error status.
+ */
+@SuppressWarnings("serial")
+public class UHttpException extends UCodecException {
+	/**
+	 * Create a new HTTP exception.
+	 * @param status
+	 * the HTTP status code.
+	 * @param message
+	 * the detail message.
+	 */
+	public UHttpException( final int status, final String message ) {
+		super(message);
+		this.status = status;
+	}
+
+	/**
+	 * Create a new HTTP exception.
+	 * @param status
+	 * the HTTP status code.
+	 * @param message
+	 * the detail message.
+	 * @param cause
+	 * the cause.
+	 */
+	public UHttpException( final int status, final String message, final Throwable cause ) {
+		super(message, cause);
+		this.status = status;
+	}
+
+	/**
+	 * The HTTP status code.
+	 */
+	private final int status;
+
+	/**
+	 * Returns the HTTP status code.
+	 * @return
+	 * the HTTP status code.
+	 */
+	public int getStatus() {
+		return status;
+	}
+}
@@ -0,0 +1,19 @@
+package com.umpani.aio.exception;
+
+/**
+ * An exception that is thrown if a reference counted object is used after it was freed or if it is released more
+ * often than retained.
+ */
+@SuppressWarnings("serial")
+public class UIllegalReferenceCountException extends IllegalStateException {
+	/**
+	 * Create a new illegal reference count exception.
+	 * @param refCnt
+	 * the current reference count.
+	 * @param delta
+	 * the change that was requested.
+	 */
+	public UIllegalReferenceCountException( final int refCnt, final int delta ) {
+		super("Illegal reference count "+refCnt+" for change "+(delta > 0 ? "+"+delta : String.valueOf(delta)));
+	}
+}
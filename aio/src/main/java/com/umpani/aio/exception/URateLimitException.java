@@ -0,0 +1,25 @@
+package com.umpani.aio.exception;
+
+import java.util.concurrent.RejectedExecutionException;
+
+/**
+ * Thrown by a {@link com.umpani.aio.resilience.URateLimiter} if no permit is available within the maximal wait
+ * time, the call was not executed.
+ */
+@SuppressWarnings("serial")
+public class URateLimitException extends RejectedExecutionException {
+	/**
+	 * Create a new exception.
+	 * @param waitNanos
+	 * the time in nanoseconds the call would have had to wait for a permit.
+	 */
+	public URateLimitException( final long waitNanos ) {
+		super("Rate limit exceeded");
+		this.waitNanos = waitNanos;
+	}
+
+	/**
+	 * The time in nanoseconds the call would have had to wait for a permit.
+	 */
+	public final long waitNanos;
+}
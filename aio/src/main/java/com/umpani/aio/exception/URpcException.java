@@ -0,0 +1,97 @@
+package com.umpani.aio.exception;
+
+/**
+ * A JSON-RPC error, either returned by a remote method or raised locally while processing a request. The error code
+ * and the optional data are sent to the caller as error object of the response.
+ */
+@SuppressWarnings("serial")
+public class URpcException extends Exception {
+	/**
+	 * Invalid JSON was received.
+	 */
+	public static final int PARSE_ERROR = -32700;
+
+	/**
+	 * The JSON sent is not a valid request object.
+	 */
+	public static final int INVALID_REQUEST = -32600;
+
+	/**
+	 * The method does not exist.
+	 */
+	public static final int METHOD_NOT_FOUND = -32601;
+
+	/**
+	 * Invalid method parameters.
+	 */
+	public static final int INVALID_PARAMS = -32602;
+
+	/**
+	 * Internal error while executing the method.
+	 */
+	public static final int INTERNAL_ERROR = -32603;
+
+	/**
+	 * The server shuts down and accepts no more requests, the request may be retried with another server.
+	 */
+	public static final int SHUTTING_DOWN = -32000;
+
+	/**
+	 * Create a new RPC exception.
+	 * @param code
+	 * the error code.
+	 * @param message
+	 * the error message.
+	 */
+	public URpcException( final int code, final String message ) {
+		this(code, message, null);
+	}
+
+	/**
+	 * Create a new RPC exception.
+	 * @param code
+	 * the error code.
+	 * @param message
+	 * the error message.
+	 * @param data
+	 * additional information about the error, must be serializable as JSON, may be null.
+	 */
+	public URpcException( final int code, final String message, final Object data ) {
+		super(message);
+		this.code = code;
+		this.data = data;
+	}
+
+	/**
+	 * The error code.
+	 */
+	private final int code;
+
+	/**
+	 * Additional information about the error.
+	 */
+	private final Object data;
+
+	/**
+	 * Returns the error code.
+	 * @return
+	 * the error code.
+	 */
+	public int getCode() {
+		return code;
+	}
+
+	/**
+	 * Returns additional information about the error.
+	 * @return
+	 * the additional information, may be null.
+	 */
+	public Object getData() {
+		return data;
+	}
+
+	@Override
+	public String toString() {
+		return getClass().getName()+": "+code+" "+getMessage();
+	}
+}
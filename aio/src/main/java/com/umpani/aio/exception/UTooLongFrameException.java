@@ -0,0 +1,17 @@
+package com.umpani.aio.exception;
+
+/**
+ * An exception that is thrown by a frame decoder if a frame exceeds the maximal length. The bytes of the frame are
+ * discarded, so that decoding continues with the next frame.
+ */
+@SuppressWarnings("serial")
+public class UTooLongFrameException extends UCodecException {
+	/**
+	 * Create a new too long frame exception.
+	 * @param message
+	 * the detail message.
+	 */
+	public UTooLongFrameException( final String message ) {
+		super(message);
+	}
+}
@@ -0,0 +1,34 @@
+package com.umpani.aio.exception;
+
+/**
+ * An exception that carries a WebSocket close code, thrown if a peer violates the WebSocket protocol or exceeds a
+ * limit. The connection is closed with the close code of the exception.
+ */
+@SuppressWarnings("serial")
+public class UWebSocketException extends UCodecException {
+	/**
+	 * Create a new WebSocket exception.
+	 * @param closeCode
+	 * the close code, see {@link com.umpani.aio.websocket.UWebSocketFrame}.
+	 * @param message
+	 * the detail message.
+	 */
+	public UWebSocketException( final int closeCode, final String message ) {
+		super(message);
+		this.closeCode = closeCode;
+	}
+
+	/**
+	 * The close code.
+	 */
+	private final int closeCode;
+
+	/**
+	 * Returns the close code.
+	 * @return
+	 * the close code.
+	 */
+	public int getCloseCode() {
+		return closeCode;
+	}
+}
@@ -0,0 +1,285 @@
+package com.umpani.aio.file;
+
+import java.io.Closeable;
+import java.io.IOException;
+import java.nio.ByteBuffer;
+import java.nio.channels.AsynchronousFileChannel;
+import java.nio.channels.CompletionHandler;
+import java.nio.file.OpenOption;
+import java.nio.file.Path;
+import java.util.concurrent.Executor;
+
+import com.umpani.aio.UBuffer;
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UPromise;
+
+/**
+ * A file that is read and written asynchronously at explicit positions with an {@link AsynchronousFileChannel}. The
+ * operations are performed by the thread pool of the channel and return {@link UFuture}s, whose listeners are invoked
+ * by the executor given when opening the file, normally the {@link com.umpani.aio.UEventLoop} of the caller, so that
+ * the results are processed without synchronization. Any amount of operations may be pending concurrently.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UAsyncFile implements Closeable {
+	/**
+	 * Create a new file.
+	 * @param channel
+	 * the channel of the file.
+	 * @param executor
+	 * the executor used to invoke the listeners of the futures, if null listeners are invoked by the thread that
+	 * completed the operation.
+	 */
+	public UAsyncFile( final AsynchronousFileChannel channel, final Executor executor ) {
+		if (channel==null) throw new NullPointerException("channel");
+		this.channel = channel;
+		this.executor = executor;
+	}
+
+	/**
+	 * Opens the given file.
+	 * @param path
+	 * the path of the file.
+	 * @param executor
+	 * the executor used to invoke the listeners of the futures or null.
+	 * @param options
+	 * the options, like for {@link AsynchronousFileChannel#open(Path, OpenOption...)}.
+	 * @return
+	 * the file.
+	 * @throws IOException
+	 * if the file could not be opened.
+	 */
+	public static UAsyncFile open( final Path path, final Executor executor, final OpenOption... options ) throws IOException {
+		return new UAsyncFile(AsynchronousFileChannel.open(path, options), executor);
+	}
+
+	/**
+	 * The channel.
+	 */
+	private final AsynchronousFileChannel channel;
+
+	/**
+	 * The executor of the listeners or null.
+	 */
+	private final Executor executor;
+
+	/**
+	 * Returns the channel.
+	 * @return
+	 * the channel.
+	 */
+	public AsynchronousFileChannel channel() {
+		return channel;
+	}
+
+	/**
+	 * Returns the current size of the file.
+	 * @return
+	 * the size in bytes.
+	 * @throws IOException
+	 * if the size could not be read.
+	 */
+	public long size() throws IOException {
+		return channel.size();
+	}
+
+	/**
+	 * Returns true if the file is open.
+	 * @return
+	 * true if the file is open.
+	 */
+	public boolean isOpen() {
+		return channel.isOpen();
+	}
+
+	/**
+	 * Reads bytes at the given position into the given buffer, the buffer must not be used until the read is done.
+	 * @param dst
+	 * the buffer to read into.
+	 * @param position
+	 * the position in the file.
+	 * @return
+	 * the future that is completed with the amount of read bytes, -1 if the position is at or after the end.
+	 */
+	public UFuture<Integer> read( final ByteBuffer dst, final long position ) {
+		final UPromise<Integer> promise = new UPromise<Integer>(executor);
+		try {
+			channel.read(dst, position, promise, new CompletionHandler<Integer,UPromise<Integer>>() {
+				@Override
+				public void completed( final Integer n, final UPromise<Integer> promise ) {
+					promise.complete(n);
+				}
+
+				@Override
+				public void failed( final Throwable cause, final UPromise<Integer> promise ) {
+					promise.fail(cause);
+				}
+			});
+		} catch (Throwable t) {
+			promise.fail(t);
+		}
+		return promise;
+	}
+
+	/**
+	 * Reads the given amount of bytes at the given position into a buffer of the given pool, less bytes are read only
+	 * if the file ends before.
+	 * @param position
+	 * the position in the file.
+	 * @param length
+	 * the amount of bytes to read.
+	 * @param pool
+	 * the pool to allocate the buffer from.
+	 * @return
+	 * the future that is completed with the flipped buffer, which must be released by the caller.
+	 */
+	public UFuture<UBuffer> read( final long position, final int length, final UBufferPool pool ) {
+		if (position < 0 || length < 0) throw new IllegalArgumentException("position: "+position+", length: "+length);
+		final UPromise<UBuffer> promise = new UPromise<UBuffer>(executor);
+		final UBuffer buffer = pool.allocate(length);
+		readFully(buffer, position, promise);
+		return promise;
+	}
+
+	/**
+	 * Continues reading until the buffer is full or the file ends.
+	 */
+	private void readFully( final UBuffer buffer, final long position, final UPromise<UBuffer> promise ) {
+		if (!buffer.nio().hasRemaining()) {
+			buffer.nio().flip();
+			if (!promise.complete(buffer)) buffer.release();
+			return;
+		}
+		try {
+			channel.read(buffer.nio(), position, promise, new CompletionHandler<Integer,UPromise<UBuffer>>() {
+				@Override
+				public void completed( final Integer n, final UPromise<UBuffer> promise ) {
+					if (n < 0) {
+						buffer.nio().flip();
+						if (!promise.complete(buffer)) buffer.release();
+						return;
+					}
+					readFully(buffer, position + n, promise);
+				}
+
+				@Override
+				public void failed( final Throwable cause, final UPromise<UBuffer> promise ) {
+					buffer.release();
+					promise.fail(cause);
+				}
+			});
+		} catch (Throwable t) {
+			buffer.release();
+			promise.fail(t);
+		}
+	}
+
+	/**
+	 * Writes bytes of the given buffer at the given position, the buffer must not be used until the write is done.
+	 * @param src
+	 * the buffer to write.
+	 * @param position
+	 * the position in the file.
+	 * @return
+	 * the future that is completed with the amount of written bytes, which may be less than remaining.
+	 */
+	public UFuture<Integer> write( final ByteBuffer src, final long position ) {
+		final UPromise<Integer> promise = new UPromise<Integer>(executor);
+		try {
+			channel.write(src, position, promise, new CompletionHandler<Integer,UPromise<Integer>>() {
+				@Override
+				public void completed( final Integer n, final UPromise<Integer> promise ) {
+					promise.complete(n);
+				}
+
+				@Override
+				public void failed( final Throwable cause, final UPromise<Integer> promise ) {
+					promise.fail(cause);
+				}
+			});
+		} catch (Throwable t) {
+			promise.fail(t);
+		}
+		return promise;
+	}
+
+	/**
+	 * Writes all remaining bytes of the given buffer at the given position.
+	 * @param src
+	 * the buffer to write.
+	 * @param position
+	 * the position in the file.
+	 * @return
+	 * the future that is completed once all bytes were written.
+	 */
+	public UFuture<Void> writeFully( final ByteBuffer src, final long position ) {
+		final UPromise<Void> promise = new UPromise<Void>(executor);
+		writeFully(src, position, promise);
+		return promise;
+	}
+
+	/**
+	 * Writes the given bytes at the given position.
+	 * @param data
+	 * the bytes to write.
+	 * @param position
+	 * the position in the file.
+	 * @return
+	 * the future that is completed once all bytes were written.
+	 */
+	public UFuture<Void> writeFully( final byte[] data, final long position ) {
+		return writeFully(ByteBuffer.wrap(data), position);
+	}
+
+	/**
+	 * Continues writing until the buffer has no remaining bytes.
+	 */
+	private void writeFully( final ByteBuffer src, final long position, final UPromise<Void> promise ) {
+		if (!src.hasRemaining()) {
+			promise.complete(null);
+			return;
+		}
+		try {
+			channel.write(src, position, promise, new CompletionHandler<Integer,UPromise<Void>>() {
+				@Override
+				public void completed( final Integer n, final UPromise<Void> promise ) {
+					writeFully(src, position + n, promise);
+				}
+
+				@Override
+				public void failed( final Throwable cause, final UPromise<Void> promise ) {
+					promise.fail(cause);
+				}
+			});
+		} catch (Throwable t) {
+			promise.fail(t);
+		}
+	}
+
+	/**
+	 * Forces all written bytes to the storage device, this blocks the calling thread.
+	 * @param metaData
+	 * true to force the meta data, like the modification time, too.
+	 * @throws IOException
+	 * if forcing failed.
+	 */
+	public void force( final boolean metaData ) throws IOException {
+		channel.force(metaData);
+	}
+
+	/**
+	 * Closes the file, pending operations fail.
+	 * @throws IOException
+	 * if closing failed.
+	 */
+	@Override
+	public void close() throws IOException {
+		channel.close();
+	}
+
+	@Override
+	public String toString() {
+		return "UAsyncFile["+channel+"]";
+	}
+}
@@ -0,0 +1,24 @@
+package com.umpani.aio.file;
+
+import java.nio.file.Path;
+import java.nio.file.StandardWatchEventKinds;
+import java.nio.file.WatchEvent;
+
+/**
+ * Receives the changes of the directories watched by an {@link UDirectoryWatcher}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface UDirectoryListener {
+	/**
+	 * Called by the event loop of the watcher for every change.
+	 * @param kind
+	 * the kind of the change, {@link StandardWatchEventKinds#ENTRY_CREATE}, {@link StandardWatchEventKinds#ENTRY_MODIFY},
+	 * {@link StandardWatchEventKinds#ENTRY_DELETE} or {@link StandardWatchEventKinds#OVERFLOW}, if changes were lost.
+	 * @param path
+	 * the changed file, the watched directory for an overflow.
+	 * @throws Exception
+	 * if the change could not be processed, the exception is logged.
+	 */
+	public void onEvent( final WatchEvent.Kind<?> kind, final Path path ) throws Exception;
+}
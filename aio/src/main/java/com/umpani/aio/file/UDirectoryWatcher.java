@@ -0,0 +1,189 @@
+package com.umpani.aio.file;
+
+import java.io.Closeable;
+import java.io.IOException;
+import java.nio.file.ClosedWatchServiceException;
+import java.nio.file.FileSystems;
+import java.nio.file.Path;
+import java.nio.file.StandardWatchEventKinds;
+import java.nio.file.WatchEvent;
+import java.nio.file.WatchKey;
+import java.nio.file.WatchService;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.RejectedExecutionException;
+import java.util.concurrent.atomic.AtomicInteger;
+
+import com.umpani.aio.UEventLoop;
+import com.umpani.util.log.ULogger;
+
+/**
+ * Watches directories of the default file system with a {@link WatchService} and delivers the changes to an
+ * {@link UDirectoryListener} on an {@link UEventLoop}. The watch service blocks while waiting for changes, so it is
+ * polled by a daemon thread of the watcher, which only passes the changes to the loop. Subdirectories are not watched
+ * automatically, a directory that is deleted or no longer accessible is unregistered.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UDirectoryWatcher implements Closeable {
+	/**
+	 * The logger of the directory watchers.
+	 */
+	private static final ULogger LOG = new ULogger(UDirectoryWatcher.class.getName());
+
+	/**
+	 * The counter used to name the threads.
+	 */
+	private static final AtomicInteger COUNT = new AtomicInteger();
+
+	/**
+	 * Create a new watcher and starts its thread.
+	 * @param loop
+	 * the event loop that invokes the listener.
+	 * @param listener
+	 * the listener of the changes.
+	 * @throws IOException
+	 * if the watch service could not be created.
+	 */
+	public UDirectoryWatcher( final UEventLoop loop, final UDirectoryListener listener ) throws IOException {
+		if (loop==null) throw new NullPointerException("loop");
+		if (listener==null) throw new NullPointerException("listener");
+		this.loop = loop;
+		this.listener = listener;
+		this.service = FileSystems.getDefault().newWatchService();
+		final Thread thread = new Thread(new Runnable() {
+			@Override
+			public void run() {
+				poll();
+			}
+		}, "watcher-"+COUNT.incrementAndGet());
+		thread.setDaemon(true);
+		thread.start();
+	}
+
+	/**
+	 * The event loop that invokes the listener.
+	 */
+	private final UEventLoop loop;
+
+	/**
+	 * The listener.
+	 */
+	private final UDirectoryListener listener;
+
+	/**
+	 * The watch service.
+	 */
+	private final WatchService service;
+
+	/**
+	 * The keys of the watched directories.
+	 */
+	private final ConcurrentHashMap<Path,WatchKey> keys = new ConcurrentHashMap<>();
+
+	/**
+	 * True once the watcher was closed.
+	 */
+	private volatile boolean closed;
+
+	/**
+	 * Starts watching the given directory for created, modified and deleted entries.
+	 * @param directory
+	 * the directory.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if the directory could not be watched.
+	 */
+	public UDirectoryWatcher register( final Path directory ) throws IOException {
+		final WatchKey key = directory.register(service, StandardWatchEventKinds.ENTRY_CREATE, StandardWatchEventKinds.ENTRY_MODIFY,
+				StandardWatchEventKinds.ENTRY_DELETE);
+		keys.put(directory, key);
+		return this;
+	}
+
+	/**
+	 * Stops watching the given directory.
+	 * @param directory
+	 * the directory.
+	 * @return
+	 * true if the directory was watched.
+	 */
+	public boolean unregister( final Path directory ) {
+		final WatchKey key = keys.remove(directory);
+		if (key==null) return false;
+		key.cancel();
+		return true;
+	}
+
+	/**
+	 * Returns true if the given directory is watched.
+	 * @param directory
+	 * the directory.
+	 * @return
+	 * true if the directory is watched.
+	 */
+	public boolean isWatched( final Path directory ) {
+		return keys.containsKey(directory);
+	}
+
+	/**
+	 * Stops watching all directories and the thread, changes not yet delivered are dropped.
+	 */
+	@Override
+	public void close() {
+		closed = true;
+		keys.clear();
+		try {
+			service.close();
+		} catch (IOException e) {
+			// nothing to release
+		}
+	}
+
+	/**
+	 * Waits for changes and passes them to the event loop until the watcher is closed.
+	 */
+	private void poll() {
+		while (!closed) {
+			final WatchKey key;
+			try {
+				key = service.take();
+			} catch (ClosedWatchServiceException | InterruptedException e) {
+				return;
+			}
+			final Path directory = (Path)key.watchable();
+			for (final WatchEvent<?> event : key.pollEvents()) {
+				final WatchEvent.Kind<?> kind = event.kind();
+				deliver(kind, kind==StandardWatchEventKinds.OVERFLOW ? directory : directory.resolve((Path)event.context()));
+			}
+			if (!key.reset()) keys.remove(directory, key);
+		}
+	}
+
+	/**
+	 * Invokes the listener with the given change on the event loop.
+	 */
+	private void deliver( final WatchEvent.Kind<?> kind, final Path path ) {
+		try {
+			loop.execute(new Runnable() {
+				@Override
+				public void run() {
+					if (closed) return;
+					try {
+						listener.onEvent(kind, path);
+					} catch (Throwable t) {
+						LOG.error("Failed to process a directory event", "kind", kind.name(), "path", path.toString(), t);
+					}
+				}
+			});
+		} catch (RejectedExecutionException e) {
+			// the loop terminated
+			close();
+		}
+	}
+
+	@Override
+	public String toString() {
+		return "UDirectoryWatcher"+keys.keySet();
+	}
+}
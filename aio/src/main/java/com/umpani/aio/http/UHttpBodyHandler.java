@@ -0,0 +1,27 @@
+package com.umpani.aio.http;
+
+/**
+ * Receives the body of a streamed response, see {@link UHttpClient#send(UHttpRequest, UHttpBodyHandler)}. All methods
+ * are invoked by the event loop of the connection.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface UHttpBodyHandler {
+	/**
+	 * Called once the header of the response was received.
+	 * @param response
+	 * the response without body.
+	 * @throws Exception
+	 * if the response is rejected, the request fails with this exception.
+	 */
+	public void headers( final UHttpResponse response ) throws Exception;
+
+	/**
+	 * Called for every received part of the body.
+	 * @param data
+	 * the bytes.
+	 * @throws Exception
+	 * if the data is rejected, the request fails with this exception.
+	 */
+	public void data( final byte[] data ) throws Exception;
+}
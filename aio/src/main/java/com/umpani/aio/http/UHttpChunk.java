@@ -0,0 +1,63 @@
+package com.umpani.aio.http;
+
+import java.nio.charset.StandardCharsets;
+
+/**
+ * A part of a streamed HTTP body. The encoder writes a chunk with chunked transfer encoding, if the message it belongs
+ * to uses it, otherwise as plain bytes. The {@link #LAST} chunk ends the body.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UHttpChunk {
+	/**
+	 * The chunk that ends a streamed body.
+	 */
+	public static final UHttpChunk LAST = new UHttpChunk(UHttpMessage.EMPTY);
+
+	/**
+	 * Create a new chunk.
+	 * @param data
+	 * the bytes of the chunk.
+	 */
+	public UHttpChunk( final byte[] data ) {
+		if (data==null) throw new NullPointerException("data");
+		this.data = data;
+	}
+
+	/**
+	 * Create a new chunk with the given text encoded as UTF-8.
+	 * @param text
+	 * the text.
+	 */
+	public UHttpChunk( final String text ) {
+		this(text.getBytes(StandardCharsets.UTF_8));
+	}
+
+	/**
+	 * The bytes of the chunk.
+	 */
+	private final byte[] data;
+
+	/**
+	 * Returns the bytes of the chunk.
+	 * @return
+	 * the bytes.
+	 */
+	public byte[] data() {
+		return data;
+	}
+
+	/**
+	 * Returns true if this is the last chunk.
+	 * @return
+	 * true if this is the last chunk.
+	 */
+	public boolean isLast() {
+		return this==LAST;
+	}
+
+	@Override
+	public String toString() {
+		return isLast() ? "UHttpChunk[last]" : "UHttpChunk["+data.length+"]";
+	}
+}
@@ -0,0 +1,1197 @@
+package com.umpani.aio.http;
+
+import java.io.IOException;
+import java.net.InetSocketAddress;
+import java.net.SocketAddress;
+import java.net.SocketTimeoutException;
+import java.net.URI;
+import java.net.URISyntaxException;
+import java.nio.channels.ClosedChannelException;
+import java.nio.file.Path;
+import java.security.GeneralSecurityException;
+import java.util.ArrayDeque;
+import java.util.ArrayList;
+import java.util.Arrays;
+import java.util.HashSet;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.TimeUnit;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UClient;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFunction;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.USocketChannel;
+import com.umpani.aio.UTransport;
+import com.umpani.aio.exception.UCodecException;
+import com.umpani.aio.exception.UHttpException;
+import com.umpani.aio.ssl.USslContext;
+
+/**
+ * A non-blocking HTTP/1.1 client. Requests are sent with an absolute <tt>http</tt> or <tt>https</tt> URL as request
+ * target, <tt>https</tt> connections are encrypted with the client {@link USslContext} of the client or, if none is
+ * set, with the default trust store of the JVM. The client
+ * keeps a pool of connections per host and port, which are reused for following requests as long as the server keeps
+ * them alive. Every connection serves one request at a time, if all connections of a host are busy and the maximal
+ * amount is reached, further requests wait for the next free connection. Idle connections are closed after the idle
+ * timeout.
+ *
+ * </p><p>A request may time out while connecting, while waiting for the next bytes of the response (read timeout) and
+ * as a whole, including redirects. Redirects are only followed if enabled. An idempotent request, that is GET, HEAD,
+ * OPTIONS, PUT, DELETE or TRACE, that fails on a reused connection before any byte of the response was received is
+ * retried once with another connection, because the server may have closed the idle connection at the same time.
+ * Other requests fail, because the server may have processed them already.
+ *
+ * </p><p>Unless disabled, the client accepts gzip and deflate compressed responses and decompresses them
+ * transparently, the limit of a body in memory applies to the decompressed body.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttpClient {
+	/**
+	 * The default maximal amount of connections per host.
+	 */
+	public static final int DEFAULT_MAX_CONNECTIONS_PER_HOST = 8;
+
+	/**
+	 * The default time in milliseconds after which idle connections are closed.
+	 */
+	public static final long DEFAULT_IDLE_TIMEOUT = 60000L;
+
+	/**
+	 * The default connect timeout in milliseconds.
+	 */
+	public static final long DEFAULT_CONNECT_TIMEOUT = 10000L;
+
+	/**
+	 * The default read timeout in milliseconds.
+	 */
+	public static final long DEFAULT_READ_TIMEOUT = 30000L;
+
+	/**
+	 * The default maximal amount of redirects to follow.
+	 */
+	public static final int DEFAULT_MAX_REDIRECTS = 5;
+
+	/**
+	 * Create a new client that uses the default buffer pool.
+	 * @param group
+	 * the event loops.
+	 */
+	public UHttpClient( final UEventLoopGroup group ) {
+		this(group, UBufferPool.DEFAULT);
+	}
+
+	/**
+	 * Create a new client.
+	 * @param group
+	 * the event loops.
+	 * @param alloc
+	 * the buffer pool of the connections.
+	 */
+	public UHttpClient( final UEventLoopGroup group, final UBufferPool alloc ) {
+		this.group = group;
+		this.alloc = alloc;
+	}
+
+	/**
+	 * The event loops.
+	 */
+	protected final UEventLoopGroup group;
+
+	/**
+	 * The buffer pool of the connections.
+	 */
+	protected final UBufferPool alloc;
+
+	/**
+	 * The connection pools by host and port.
+	 */
+	private final ConcurrentHashMap<String,Pool> pools = new ConcurrentHashMap<>();
+
+	/**
+	 * The maximal amount of connections per host.
+	 */
+	private volatile int maxConnectionsPerHost = DEFAULT_MAX_CONNECTIONS_PER_HOST;
+
+	/**
+	 * The time in milliseconds after which idle connections are closed.
+	 */
+	private volatile long idleTimeout = DEFAULT_IDLE_TIMEOUT;
+
+	/**
+	 * The connect timeout in milliseconds.
+	 */
+	private volatile long connectTimeout = DEFAULT_CONNECT_TIMEOUT;
+
+	/**
+	 * The read timeout in milliseconds.
+	 */
+	private volatile long readTimeout = DEFAULT_READ_TIMEOUT;
+
+	/**
+	 * The total timeout of a request in milliseconds.
+	 */
+	private volatile long timeout;
+
+	/**
+	 * True if redirects are followed.
+	 */
+	private volatile boolean followRedirects;
+
+	/**
+	 * The maximal amount of redirects to follow.
+	 */
+	private volatile int maxRedirects = DEFAULT_MAX_REDIRECTS;
+
+	/**
+	 * True if redirects from https to http are followed.
+	 */
+	private volatile boolean insecureRedirects;
+
+	/**
+	 * The maximal size of a response body held in memory.
+	 */
+	private volatile int maxBodySize = UHttpDecoder.DEFAULT_MAX_BODY_SIZE;
+
+	/**
+	 * True if compressed responses are requested and decompressed.
+	 */
+	private volatile boolean compression = true;
+
+	/**
+	 * The TLS configuration of https connections or null.
+	 */
+	private volatile USslContext sslContext;
+
+	/**
+	 * The socket file through which all connections are opened or null, to connect via TCP.
+	 */
+	private volatile Path unixSocket;
+
+	/**
+	 * True once the client was closed.
+	 */
+	private volatile boolean closed;
+
+	/**
+	 * Sets the TLS configuration of https connections opened afterwards.
+	 * @param sslContext
+	 * the client context or null, to use the default trust store of the JVM.
+	 * @return
+	 * this.
+	 */
+	public UHttpClient setSslContext( final USslContext sslContext ) {
+		if (sslContext!=null && !sslContext.isClient()) throw new IllegalArgumentException("Client context required");
+		this.sslContext = sslContext;
+		return this;
+	}
+
+	/**
+	 * Opens the connections to hosts that are first requested afterwards through the given Unix domain socket, the
+	 * host of the URL is then only used for the <tt>Host</tt> header and TLS.
+	 * @param socketFile
+	 * the path of the socket file or null, to connect via TCP.
+	 * @return
+	 * this.
+	 * @throws UnsupportedOperationException
+	 * if Unix domain sockets are not available.
+	 */
+	public UHttpClient setUnixSocket( final Path socketFile ) {
+		if (socketFile!=null && !UTransport.UNIX.isAvailable()) throw new UnsupportedOperationException("UNIX sockets are not supported by this JDK");
+		this.unixSocket = socketFile;
+		return this;
+	}
+
+	/**
+	 * Returns the event loops of the connections.
+	 * @return
+	 * the event loops.
+	 */
+	public UEventLoopGroup group() {
+		return group;
+	}
+
+	/**
+	 * Sets the maximal amount of connections per host and port.
+	 * @param max
+	 * the maximal amount of connections.
+	 * @return
+	 * this.
+	 */
+	public UHttpClient setMaxConnectionsPerHost( final int max ) {
+		if (max <= 0) throw new IllegalArgumentException("max: "+max);
+		this.maxConnectionsPerHost = max;
+		return this;
+	}
+
+	/**
+	 * Sets the time after which idle connections are closed.
+	 * @param millis
+	 * the time in milliseconds, zero or less to never close idle connections.
+	 * @return
+	 * this.
+	 */
+	public UHttpClient setIdleTimeout( final long millis ) {
+		this.idleTimeout = Math.max(0L, millis);
+		return this;
+	}
+
+	/**
+	 * Sets the connect timeout.
+	 * @param millis
+	 * the time in milliseconds, zero or less for no timeout.
+	 * @return
+	 * this.
+	 */
+	public UHttpClient setConnectTimeout( final long millis ) {
+		this.connectTimeout = Math.max(0L, millis);
+		return this;
+	}
+
+	/**
+	 * Sets the read timeout, the maximal time to wait for the next bytes of a response.
+	 * @param millis
+	 * the time in milliseconds, zero or less for no timeout.
+	 * @return
+	 * this.
+	 */
+	public UHttpClient setReadTimeout( final long millis ) {
+		this.readTimeout = Math.max(0L, millis);
+		return this;
+	}
+
+	/**
+	 * Sets the total timeout of a request, including connecting and redirects.
+	 * @param millis
+	 * the time in milliseconds, zero or less for no timeout, which is the default.
+	 * @return
+	 * this.
+	 */
+	public UHttpClient setTimeout( final long millis ) {
+		this.timeout = Math.max(0L, millis);
+		return this;
+	}
+
+	/**
+	 * Enables or disables following redirects, which is disabled by default. If enabled, the responses 301, 302,
+	 * 303, 307 and 308 are followed up to the maximal amount of redirects, a 303 and a 301 or 302 to any request other
+	 * than GET or HEAD is followed with a GET request without body. A redirect to another origin drops the
+	 * <tt>Authorization</tt>, <tt>Proxy-Authorization</tt> and <tt>Cookie</tt> headers, a redirect from https to http
+	 * fails, unless enabled with {@link #setInsecureRedirects(boolean)}.
+	 * @param followRedirects
+	 * true to follow redirects.
+	 * @return
+	 * this.
+	 */
+	public UHttpClient setFollowRedirects( final boolean followRedirects ) {
+		this.followRedirects = followRedirects;
+		return this;
+	}
+
+	/**
+	 * Enables or disables following redirects from https to http, which is disabled by default, so that such a
+	 * redirect fails the request with an {@link UHttpException}.
+	 * @param insecureRedirects
+	 * true to follow redirects from https to http.
+	 * @return
+	 * this.
+	 */
+	public UHttpClient setInsecureRedirects( final boolean insecureRedirects ) {
+		this.insecureRedirects = insecureRedirects;
+		return this;
+	}
+
+	/**
+	 * Sets the maximal amount of redirects to follow, the last redirect response is returned when it is reached.
+	 * @param maxRedirects
+	 * the maximal amount of redirects.
+	 * @return
+	 * this.
+	 */
+	public UHttpClient setMaxRedirects( final int maxRedirects ) {
+		if (maxRedirects < 0) throw new IllegalArgumentException("maxRedirects: "+maxRedirects);
+		this.maxRedirects = maxRedirects;
+		return this;
+	}
+
+	/**
+	 * Sets the maximal size of a response body that is held in memory, streamed bodies are not limited.
+	 * @param maxBodySize
+	 * the maximal size in bytes.
+	 * @return
+	 * this.
+	 */
+	public UHttpClient setMaxBodySize( final int maxBodySize ) {
+		if (maxBodySize < 0) throw new IllegalArgumentException("maxBodySize: "+maxBodySize);
+		this.maxBodySize = maxBodySize;
+		return this;
+	}
+
+	/**
+	 * Enables or disables the transparent decompression of responses, enabled by default. Requests without
+	 * <tt>Accept-Encoding</tt> accept gzip and deflate, compressed responses are decompressed before they are passed
+	 * on, so that the body and the body handler get the decompressed bytes. Should be set before the first request,
+	 * because open connections keep their setting.
+	 * @param compression
+	 * true to request and decompress compressed responses.
+	 * @return
+	 * this.
+	 */
+	public UHttpClient setCompression( final boolean compression ) {
+		this.compression = compression;
+		return this;
+	}
+
+	/**
+	 * Returns the amount of open connections of all hosts.
+	 * @return
+	 * the amount of open connections.
+	 */
+	public int connections() {
+		int count = 0;
+		for (final Pool pool : pools.values()) count += pool.open();
+		return count;
+	}
+
+	/**
+	 * Returns the amount of idle connections of all hosts.
+	 * @return
+	 * the amount of idle connections.
+	 */
+	public int idleConnections() {
+		int count = 0;
+		for (final Pool pool : pools.values()) count += pool.idle();
+		return count;
+	}
+
+	/**
+	 * Sends a GET request.
+	 * @param url
+	 * the absolute URL.
+	 * @return
+	 * the future of the response.
+	 */
+	public UFuture<UHttpResponse> get( final String url ) {
+		return send(new UHttpRequest("GET", url));
+	}
+
+	/**
+	 * Sends a DELETE request.
+	 * @param url
+	 * the absolute URL.
+	 * @return
+	 * the future of the response.
+	 */
+	public UFuture<UHttpResponse> delete( final String url ) {
+		return send(new UHttpRequest("DELETE", url));
+	}
+
+	/**
+	 * Sends a POST request with the given value as JSON body.
+	 * @param url
+	 * the absolute URL.
+	 * @param json
+	 * the body, usually an {@link com.umpani.util.UMap}.
+	 * @return
+	 * the future of the response.
+	 */
+	public UFuture<UHttpResponse> post( final String url, final Object json ) {
+		return send(new UHttpRequest("POST", url).setJson(json));
+	}
+
+	/**
+	 * Sends a PUT request with the given value as JSON body.
+	 * @param url
+	 * the absolute URL.
+	 * @param json
+	 * the body, usually an {@link com.umpani.util.UMap}.
+	 * @return
+	 * the future of the response.
+	 */
+	public UFuture<UHttpResponse> put( final String url, final Object json ) {
+		return send(new UHttpRequest("PUT", url).setJson(json));
+	}
+
+	/**
+	 * Sends a GET request and parses the JSON body of the response.
+	 * @param url
+	 * the absolute URL.
+	 * @return
+	 * the future of the parsed body.
+	 * @see #json(UHttpRequest)
+	 */
+	public UFuture<Object> getJson( final String url ) {
+		return json(new UHttpRequest("GET", url));
+	}
+
+	/**
+	 * Sends a request and parses the JSON body of the response. A response with a status code other than 2xx fails
+	 * the future with an {@link UHttpException}.
+	 * @param request
+	 * the request with an absolute URL.
+	 * @return
+	 * the future of the parsed body, usually an {@link com.umpani.util.UMap} or an {@link com.umpani.util.UList}, null
+	 * if the body is empty.
+	 */
+	public UFuture<Object> json( final UHttpRequest request ) {
+		if (!request.headers().contains(UHttpHeaders.ACCEPT)) request.headers().set(UHttpHeaders.ACCEPT, UHttpMessage.APPLICATION_JSON);
+		return send(request).map(new UFunction<UHttpResponse, Object>() {
+			@Override
+			public Object apply( final UHttpResponse response ) throws Exception {
+				if (response.status() < 200 || response.status() >= 300) throw new UHttpException(response.status(), response.reason());
+				return response.json();
+			}
+		});
+	}
+
+	/**
+	 * Sends a request.
+	 * @param request
+	 * the request with an absolute URL as request target.
+	 * @return
+	 * the future of the response, cancelling it aborts the request.
+	 */
+	public UFuture<UHttpResponse> send( final UHttpRequest request ) {
+		return send(request, null);
+	}
+
+	/**
+	 * Sends a request and streams the body of the response to the given handler, the response passed to the future
+	 * has no body. The future is completed once the body was streamed completely.
+	 * @param request
+	 * the request with an absolute URL as request target.
+	 * @param handler
+	 * the handler of the body or null, to hold the body in memory.
+	 * @return
+	 * the future of the response, cancelling it aborts the request.
+	 */
+	public UFuture<UHttpResponse> send( final UHttpRequest request, final UHttpBodyHandler handler ) {
+		if (closed) return UFuture.failed(new IllegalStateException("Client closed"));
+		final URI uri;
+		try {
+			uri = target(request.uri());
+		} catch (IllegalArgumentException e) {
+			return UFuture.failed(e);
+		}
+		final Call call = new Call(toOrigin(request, uri), uri, handler);
+		if (compression && !call.request.headers().contains(UHttpHeaders.ACCEPT_ENCODING)) call.request.headers().set(UHttpHeaders.ACCEPT_ENCODING, "gzip, deflate");
+		call.promise.onCancel(new Runnable() {
+			@Override
+			public void run() {
+				final Connection connection = call.connection;
+				if (connection!=null) connection.abort(call);
+			}
+		});
+		dispatch(call);
+		final long timeout = this.timeout;
+		return timeout > 0 ? call.promise.withTimeout(timeout, TimeUnit.MILLISECONDS, group.next()) : call.promise;
+	}
+
+	/**
+	 * Closes all connections, requests that are in progress fail and further requests are rejected.
+	 */
+	public void close() {
+		closed = true;
+		for (final Pool pool : pools.values()) pool.close();
+	}
+
+	@Override
+	public String toString() {
+		return "UHttpClient["+pools.keySet()+"]";
+	}
+
+	/**
+	 * Parses and validates the absolute URL of a request.
+	 */
+	private static URI target( final String url ) {
+		final URI uri;
+		try {
+			uri = new URI(url);
+		} catch (URISyntaxException e) {
+			throw new IllegalArgumentException("Invalid URL: "+url, e);
+		}
+		if (!("http".equalsIgnoreCase(uri.getScheme()) || "https".equalsIgnoreCase(uri.getScheme())) || uri.getHost()==null) {
+			throw new IllegalArgumentException("Absolute http or https URL required: "+url);
+		}
+		return uri;
+	}
+
+	/**
+	 * Returns true if the given URL requires TLS.
+	 */
+	private static boolean isSecure( final URI uri ) {
+		return "https".equalsIgnoreCase(uri.getScheme());
+	}
+
+	/**
+	 * Returns true if the given method may be repeated without further effect.
+	 */
+	private static boolean isIdempotent( final String method ) {
+		switch (method) {
+			case "GET": case "HEAD": case "OPTIONS": case "PUT": case "DELETE": case "TRACE":
+				return true;
+			default:
+				return false;
+		}
+	}
+
+	/**
+	 * Returns the port of the given URL or the default port of its scheme.
+	 */
+	private static int port( final URI uri ) {
+		return uri.getPort() >= 0 ? uri.getPort() : isSecure(uri) ? 443 : 80;
+	}
+
+	/**
+	 * Returns a copy of the given request with the path and query of the given URL as request target.
+	 */
+	private static UHttpRequest toOrigin( final UHttpRequest request, final URI uri ) {
+		String target = uri.getRawPath();
+		if (target==null || target.isEmpty()) target = "/";
+		if (uri.getRawQuery()!=null) target += "?"+uri.getRawQuery();
+		final UHttpRequest result = new UHttpRequest(request.method(), target, request.version());
+		final UHttpHeaders headers = request.headers();
+		for (int i=0; i < headers.size(); i++) {
+			if (!headers.name(i).equalsIgnoreCase(UHttpHeaders.HOST)) result.headers().add(headers.name(i), headers.value(i));
+		}
+		result.headers().set(UHttpHeaders.HOST, uri.getPort() < 0 || uri.getPort()==(isSecure(uri) ? 443 : 80) ? uri.getHost() : uri.getHost()+":"+uri.getPort());
+		result.setBody(request.body());
+		result.setStreamer(request.streamer());
+		return result;
+	}
+
+	/**
+	 * Sends the given call with a connection of the pool of its host.
+	 */
+	private void dispatch( final Call call ) {
+		if (closed) {
+			call.promise.fail(new IllegalStateException("Client closed"));
+			return;
+		}
+		final URI uri = call.uri;
+		final int port = port(uri);
+		final String key = uri.getScheme().toLowerCase()+"://"+uri.getHost().toLowerCase()+":"+port;
+		Pool pool = pools.get(key);
+		if (pool==null) {
+			USslContext sslContext = null;
+			if (isSecure(uri)) {
+				sslContext = this.sslContext;
+				try {
+					if (sslContext==null) sslContext = USslContext.forClient();
+				} catch (GeneralSecurityException e) {
+					call.promise.fail(e);
+					return;
+				}
+			}
+			final Pool newPool = new Pool(uri.getHost(), port, sslContext);
+			pool = pools.putIfAbsent(key, newPool);
+			if (pool==null) pool = newPool;
+		}
+		final Pool p = pool;
+		p.acquire().addListener(new UFutureListener<Connection>() {
+			@Override
+			public void complete( final UFuture<Connection> future ) {
+				if (!future.isSuccess()) {
+					call.promise.fail(future.cause());
+				} else
+				if (call.promise.isDone()) {
+					p.release(future.getNow());
+				} else {
+					future.getNow().send(call);
+				}
+			}
+		}, null);
+	}
+
+	/**
+	 * Returns the redirect of the given call, if the response is a redirect that should be followed.
+	 * @return
+	 * the location to redirect to or null.
+	 */
+	private URI redirect( final Call call, final UHttpResponse response ) {
+		if (!followRedirects || call.redirects >= maxRedirects) return null;
+		switch (response.status()) {
+			case 301: case 302: case 303: case 307: case 308: break;
+			default: return null;
+		}
+		final String location = response.headers().get(UHttpHeaders.LOCATION);
+		if (location==null) return null;
+		try {
+			return call.uri.resolve(location);
+		} catch (IllegalArgumentException e) {
+			return null;
+		}
+	}
+
+	/**
+	 * Follows a redirect.
+	 */
+	private void follow( final Call call, final UHttpResponse response, final URI location ) {
+		final String url = location.toString();
+		final URI uri;
+		try {
+			uri = target(url);
+		} catch (IllegalArgumentException e) {
+			call.promise.fail(new UHttpException(response.status(), "Unsupported redirect to "+url, e));
+			return;
+		}
+		if (isSecure(call.uri) && !isSecure(uri) && !insecureRedirects) {
+			call.promise.fail(new UHttpException(response.status(), "Refused redirect from https to "+url));
+			return;
+		}
+		final boolean crossOrigin = !uri.getScheme().equalsIgnoreCase(call.uri.getScheme()) || !uri.getHost().equalsIgnoreCase(call.uri.getHost()) || port(uri)!=port(call.uri);
+		final UHttpRequest request = call.request;
+		final int status = response.status();
+		final boolean toGet = status==303 || ((status==301 || status==302) && !request.method().equals("GET") && !request.method().equals("HEAD"));
+		if (!toGet && request.streamer()!=null) {
+			call.promise.fail(new UHttpException(status, "Can't repeat a streamed request body for the redirect to "+url));
+			return;
+		}
+		final UHttpRequest redirected = new UHttpRequest(toGet ? "GET" : request.method(), url, request.version());
+		final UHttpHeaders headers = request.headers();
+		for (int i=0; i < headers.size(); i++) {
+			final String name = headers.name(i);
+			if (toGet && (name.equalsIgnoreCase(UHttpHeaders.CONTENT_TYPE) || name.equalsIgnoreCase(UHttpHeaders.CONTENT_LENGTH))) continue;
+			// credentials and cookies are not passed to another origin
+			if (crossOrigin && (name.equalsIgnoreCase(UHttpHeaders.AUTHORIZATION) || name.equalsIgnoreCase(UHttpHeaders.PROXY_AUTHORIZATION) || name.equalsIgnoreCase(UHttpHeaders.COOKIE))) continue;
+			redirected.headers().add(name, headers.value(i));
+		}
+		if (!toGet) redirected.setBody(request.body());
+		call.request = toOrigin(redirected, uri);
+		call.uri = uri;
+		call.redirects++;
+		call.retried = false;
+		dispatch(call);
+	}
+
+	/**
+	 * A request, including all its redirects.
+	 */
+	private static final class Call {
+		Call( final UHttpRequest request, final URI uri, final UHttpBodyHandler handler ) {
+			this.request = request;
+			this.uri = uri;
+			this.handler = handler;
+		}
+
+		/**
+		 * The promise of the final response.
+		 */
+		final UPromise<UHttpResponse> promise = new UPromise<UHttpResponse>(null);
+
+		/**
+		 * The handler of a streamed body or null.
+		 */
+		final UHttpBodyHandler handler;
+
+		/**
+		 * The current request.
+		 */
+		volatile UHttpRequest request;
+
+		/**
+		 * The URL of the current request.
+		 */
+		volatile URI uri;
+
+		/**
+		 * The amount of followed redirects.
+		 */
+		volatile int redirects;
+
+		/**
+		 * True if the current request was already retried.
+		 */
+		volatile boolean retried;
+
+		/**
+		 * The connection that serves the current request.
+		 */
+		volatile Connection connection;
+	}
+
+	/**
+	 * The connections of one host and port.
+	 */
+	private final class Pool {
+		Pool( final String host, final int port, final USslContext sslContext ) {
+			final Path unixSocket = UHttpClient.this.unixSocket;
+			this.address = unixSocket!=null ? UTransport.unixAddress(unixSocket) : new InetSocketAddress(host, port);
+			this.client = new UClient(group, new UChannelInitializer() {
+				@Override
+				public void initChannel( final UChannel channel ) {
+					if (sslContext!=null) channel.pipeline().addLast(sslContext.newHandler(host, port));
+					channel.pipeline().addLast(new UHttpClientCodec());
+					// the size of a body in memory is limited by the connection
+					if (compression) channel.pipeline().addLast(new UHttpContentDecompressor(Long.MAX_VALUE));
+					channel.pipeline().addLast(new Connection(Pool.this));
+				}
+			}, alloc);
+			if (unixSocket!=null) client.setTransport(UTransport.UNIX);
+		}
+
+		/**
+		 * The address of the host or of the socket file.
+		 */
+		final SocketAddress address;
+
+		/**
+		 * The client that opens the connections.
+		 */
+		final UClient client;
+
+		/**
+		 * The idle connections, the most recently used last, guarded by this.
+		 */
+		private final ArrayDeque<Connection> idle = new ArrayDeque<>();
+
+		/**
+		 * The promises of requests waiting for a connection, guarded by this.
+		 */
+		private final ArrayDeque<UPromise<Connection>> waiters = new ArrayDeque<>();
+
+		/**
+		 * All connections, guarded by this.
+		 */
+		private final HashSet<Connection> connections = new HashSet<>();
+
+		/**
+		 * The amount of open and opening connections, guarded by this.
+		 */
+		private int open;
+
+		synchronized int open() {
+			return open;
+		}
+
+		synchronized int idle() {
+			return idle.size();
+		}
+
+		/**
+		 * Returns an idle connection, opens a new one or waits for the next free connection.
+		 */
+		UFuture<Connection> acquire() {
+			final UPromise<Connection> promise = new UPromise<Connection>(null);
+			Connection connection;
+			synchronized (this) {
+				while ((connection = idle.pollLast())!=null) {
+					if (connection.isActive()) break;
+				}
+				if (connection==null) {
+					if (open >= maxConnectionsPerHost) {
+						waiters.add(promise);
+						return promise;
+					}
+					open++;
+				}
+			}
+			if (connection!=null) {
+				connection.reuse();
+				promise.complete(connection);
+			} else {
+				connect(promise);
+			}
+			return promise;
+		}
+
+		/**
+		 * Opens a new connection, the connection must already be counted as open.
+		 */
+		void connect( final UPromise<Connection> promise ) {
+			UFuture<USocketChannel> future = client.connect(address);
+			final long connectTimeout = UHttpClient.this.connectTimeout;
+			if (connectTimeout > 0) future = future.withTimeout(connectTimeout, TimeUnit.MILLISECONDS);
+			future.addListener(new UFutureListener<USocketChannel>() {
+				@Override
+				public void complete( final UFuture<USocketChannel> future ) {
+					if (future.isSuccess()) {
+						final Connection connection = future.getNow().pipeline().get(Connection.class);
+						if (!promise.complete(connection)) release(connection);
+						return;
+					}
+					promise.fail(future.cause());
+					UPromise<Connection> waiter;
+					synchronized (Pool.this) {
+						waiter = waiters.poll();
+						if (waiter==null) open--;
+					}
+					// the slot passes to the next waiter, which tries its own connect
+					if (waiter!=null) connect(waiter);
+				}
+			}, null);
+		}
+
+		/**
+		 * Passes a connection that finished its request to the next waiter or adds it to the idle connections.
+		 */
+		void release( final Connection connection ) {
+			final UPromise<Connection> waiter;
+			synchronized (this) {
+				waiter = waiters.poll();
+				if (waiter==null) {
+					if (closed) {
+						connection.close();
+					} else {
+						idle.add(connection);
+						connection.idle(idleTimeout);
+					}
+					return;
+				}
+			}
+			connection.reuse();
+			if (!waiter.complete(connection)) release(connection);
+		}
+
+		/**
+		 * Closes the given connection, if it is still idle.
+		 */
+		void evict( final Connection connection ) {
+			synchronized (this) {
+				if (!idle.remove(connection)) return;
+			}
+			connection.close();
+		}
+
+		/**
+		 * Called once a connection became active.
+		 */
+		synchronized void opened( final Connection connection ) {
+			connections.add(connection);
+		}
+
+		/**
+		 * Called once a connection was closed, the slot passes to the next waiter.
+		 */
+		void closed( final Connection connection ) {
+			UPromise<Connection> waiter = null;
+			synchronized (this) {
+				if (!connections.remove(connection)) return;
+				idle.remove(connection);
+				if (!closed) waiter = waiters.poll();
+				if (waiter==null) open--;
+			}
+			if (waiter!=null) connect(waiter);
+		}
+
+		/**
+		 * Closes all connections and fails all waiters.
+		 */
+		void close() {
+			final ArrayList<Connection> connections;
+			final ArrayList<UPromise<Connection>> waiters;
+			synchronized (this) {
+				connections = new ArrayList<>(this.connections);
+				waiters = new ArrayList<>(this.waiters);
+				this.waiters.clear();
+			}
+			for (final UPromise<Connection> waiter : waiters) waiter.fail(new IllegalStateException("Client closed"));
+			for (final Connection connection : connections) connection.close();
+		}
+	}
+
+	/**
+	 * The handler of a connection, which sends the requests and receives the responses.
+	 */
+	private final class Connection extends UChannelHandlerAdapter {
+		Connection( final Pool pool ) {
+			this.pool = pool;
+		}
+
+		/**
+		 * The pool of the connection.
+		 */
+		final Pool pool;
+
+		/**
+		 * The context of this handler.
+		 */
+		private volatile UHandlerContext ctx;
+
+		/**
+		 * The timer that closes the connection while idle.
+		 */
+		private volatile UFuture<Void> idleTimer;
+
+		/**
+		 * True if the connection served a request before.
+		 */
+		private boolean reused;
+
+		/**
+		 * The call being served, accessed by the event loop only.
+		 */
+		private Call call;
+
+		/**
+		 * The response of the call, once received.
+		 */
+		private UHttpResponse response;
+
+		/**
+		 * The redirect to follow after the response or null.
+		 */
+		private URI redirect;
+
+		/**
+		 * True while an interim response is skipped.
+		 */
+		private boolean interim;
+
+		/**
+		 * The received body.
+		 */
+		private byte[] body = UHttpMessage.EMPTY;
+
+		/**
+		 * The length of the received body.
+		 */
+		private int bodyLength;
+
+		/**
+		 * The read timer.
+		 */
+		private UFuture<Void> readTimer;
+
+		boolean isActive() {
+			final UHandlerContext ctx = this.ctx;
+			return ctx!=null && ctx.channel().isActive();
+		}
+
+		void close() {
+			final UHandlerContext ctx = this.ctx;
+			if (ctx!=null) ctx.close();
+		}
+
+		/**
+		 * Takes the connection out of the idle state.
+		 */
+		void reuse() {
+			final UFuture<Void> idleTimer = this.idleTimer;
+			if (idleTimer!=null) idleTimer.cancel(false);
+			this.idleTimer = null;
+		}
+
+		/**
+		 * Puts the connection into the idle state.
+		 */
+		void idle( final long timeout ) {
+			if (timeout <= 0) return;
+			idleTimer = ctx.loop().schedule(new Runnable() {
+				@Override
+				public void run() {
+					pool.evict(Connection.this);
+				}
+			}, timeout, TimeUnit.MILLISECONDS);
+		}
+
+		/**
+		 * Closes the connection, if it still serves the given call.
+		 */
+		void abort( final Call call ) {
+			ctx.loop().execute(new Runnable() {
+				@Override
+				public void run() {
+					if (Connection.this.call==call) close();
+				}
+			});
+		}
+
+		/**
+		 * Sends the request of the given call, may be invoked by any thread.
+		 */
+		void send( final Call call ) {
+			if (ctx.loop().inEventLoop()) {
+				doSend(call);
+			} else {
+				ctx.loop().execute(new Runnable() {
+					@Override
+					public void run() {
+						doSend(call);
+					}
+				});
+			}
+		}
+
+		private void doSend( final Call call ) {
+			this.call = call;
+			call.connection = this;
+			if (call.promise.isDone() || !ctx.channel().isActive()) {
+				failed(new ClosedChannelException());
+				return;
+			}
+			resetReadTimer();
+			final UHttpRequest request = call.request;
+			ctx.writeAndFlush(request).addListener(new UFutureListener<Void>() {
+				@Override
+				public void complete( final UFuture<Void> future ) {
+					if (!future.isSuccess() && Connection.this.call==call) failed(future.cause());
+				}
+			}, null);
+			final UHttpStreamer streamer = request.streamer();
+			if (streamer!=null) {
+				try {
+					streamer.stream(new UHttpStream(ctx, request, request, false, new Runnable() {
+						@Override
+						public void run() {}
+					}));
+				} catch (Throwable t) {
+					failed(t);
+				}
+			}
+		}
+
+		@Override
+		public void handlerAdded( final UHandlerContext ctx ) throws Exception {
+			this.ctx = ctx;
+		}
+
+		@Override
+		public void channelActive( final UHandlerContext ctx ) throws Exception {
+			pool.opened(this);
+			ctx.fireChannelActive();
+		}
+
+		@Override
+		public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+			final Call call = this.call;
+			if (call==null) return;
+			resetReadTimer();
+			try {
+				if (msg instanceof UHttpResponse) {
+					final UHttpResponse response = (UHttpResponse)msg;
+					if (response.status() < 200 && response.status()!=101) {
+						interim = true;
+						return;
+					}
+					this.response = response;
+					redirect = redirect(call, response);
+					if (redirect==null && call.handler!=null) call.handler.headers(response);
+					return;
+				}
+				final UHttpChunk chunk = (UHttpChunk)msg;
+				if (interim) {
+					if (chunk.isLast()) interim = false;
+					return;
+				}
+				if (chunk.isLast()) {
+					complete();
+				} else
+				if (redirect==null) {
+					if (call.handler!=null) {
+						call.handler.data(chunk.data());
+					} else {
+						append(chunk.data());
+					}
+				}
+			} catch (Throwable t) {
+				failed(t);
+			}
+		}
+
+		/**
+		 * Appends received bytes to the body.
+		 */
+		private void append( final byte[] data ) throws UCodecException {
+			if (bodyLength + data.length > maxBodySize) throw new UCodecException("Response body exceeds "+maxBodySize+" bytes");
+			if (bodyLength + data.length > body.length) body = Arrays.copyOf(body, Math.max(bodyLength + data.length, body.length << 1));
+			System.arraycopy(data, 0, body, bodyLength, data.length);
+			bodyLength += data.length;
+		}
+
+		/**
+		 * Completes the current call once the response was received completely.
+		 */
+		private void complete() {
+			final Call call = this.call;
+			final UHttpResponse response = this.response;
+			final URI redirect = this.redirect;
+			if (redirect==null && call.handler==null) response.setBody(bodyLength==0 ? UHttpMessage.EMPTY : Arrays.copyOf(body, bodyLength));
+			reset();
+			if (response.isKeepAlive() && call.request.isKeepAlive() && response.status()!=101 && ctx.channel().isActive()) {
+				pool.release(this);
+			} else {
+				close();
+			}
+			if (redirect!=null) {
+				follow(call, response, redirect);
+			} else {
+				call.promise.complete(response);
+			}
+		}
+
+		/**
+		 * Fails the current call and closes the connection.
+		 */
+		private void failed( final Throwable cause ) {
+			final Call call = this.call;
+			final boolean retry = reused && response==null && call!=null && !call.retried && !call.promise.isDone()
+			&& isIdempotent(call.request.method()) && call.request.streamer()==null && cause instanceof IOException && !(cause instanceof SocketTimeoutException);
+			reset();
+			close();
+			if (call==null) return;
+			if (retry) {
+				call.retried = true;
+				dispatch(call);
+			} else {
+				call.promise.fail(cause);
+			}
+		}
+
+		/**
+		 * Resets the state of the current call.
+		 */
+		private void reset() {
+			if (readTimer!=null) readTimer.cancel(false);
+			readTimer = null;
+			call = null;
+			response = null;
+			redirect = null;
+			interim = false;
+			body = UHttpMessage.EMPTY;
+			bodyLength = 0;
+			reused = true;
+		}
+
+		/**
+		 * Restarts the read timer.
+		 */
+		private void resetReadTimer() {
+			if (readTimer!=null) readTimer.cancel(false);
+			readTimer = null;
+			final long readTimeout = UHttpClient.this.readTimeout;
+			if (readTimeout <= 0) return;
+			readTimer = ctx.loop().schedule(new Runnable() {
+				@Override
+				public void run() {
+					if (call!=null) failed(new SocketTimeoutException("No response within "+readTimeout+" ms"));
+				}
+			}, readTimeout, TimeUnit.MILLISECONDS);
+		}
+
+		@Override
+		public void exceptionCaught( final UHandlerContext ctx, final Throwable cause ) throws Exception {
+			failed(cause);
+		}
+
+		@Override
+		public void channelInactive( final UHandlerContext ctx ) throws Exception {
+			reuse();
+			if (call!=null) failed(new ClosedChannelException());
+			pool.closed(this);
+			ctx.fireChannelInactive();
+		}
+
+		@Override
+		public String toString() {
+			return "Connection["+pool.address+"]";
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package com.umpani.aio.http;
+
+import java.util.ArrayDeque;
+
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UPromise;
+
+/**
+ * The codec of a client connection, which encodes {@link UHttpRequest}s and decodes the responses in one handler, so
+ * that it knows the request of every response: the response to a HEAD request has no body, even if it has a
+ * <tt>Content-Length</tt>. Responses are always streamed, they are passed on without body, followed by the
+ * {@link UHttpChunk}s of the body.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttpClientCodec extends UHttpResponseDecoder {
+	/**
+	 * Create a new codec with the default header limit.
+	 */
+	public UHttpClientCodec() {
+		this(DEFAULT_MAX_HEADER_SIZE);
+	}
+
+	/**
+	 * Create a new codec.
+	 * @param maxHeaderSize
+	 * the maximal size of the status line and the header fields in bytes.
+	 */
+	public UHttpClientCodec( final int maxHeaderSize ) {
+		super(maxHeaderSize, 0);
+	}
+
+	/**
+	 * The encoder of the requests.
+	 */
+	private final UHttpRequestEncoder encoder = new UHttpRequestEncoder();
+
+	/**
+	 * The methods of the requests whose response was not yet decoded, accessed by the event loop only.
+	 */
+	private final ArrayDeque<String> methods = new ArrayDeque<>();
+
+	@Override
+	public void write( final UHandlerContext ctx, final Object msg, final UPromise<Void> promise ) throws Exception {
+		if (msg instanceof UHttpRequest) methods.add(((UHttpRequest)msg).method());
+		encoder.write(ctx, msg, promise);
+	}
+
+	@Override
+	protected boolean isStreamed( final UHttpMessage message ) {
+		return true;
+	}
+
+	@Override
+	protected boolean isContentAlwaysEmpty( final UHttpMessage message ) {
+		final int status = ((UHttpResponse)message).status();
+		// interim responses are followed by the final response to the same request
+		if (status >= 100 && status < 200 && status!=101) return true;
+		final String method = methods.poll();
+		return "HEAD".equals(method) || super.isContentAlwaysEmpty(message);
+	}
+}
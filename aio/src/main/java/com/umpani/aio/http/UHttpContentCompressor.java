@@ -0,0 +1,228 @@
+package com.umpani.aio.http;
+
+import java.util.ArrayDeque;
+import java.util.zip.Deflater;
+
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.codec.UCompression;
+import com.umpani.aio.codec.UCompressor;
+
+/**
+ * Compresses the bodies of HTTP responses with gzip or deflate, as negotiated with the <tt>Accept-Encoding</tt> of
+ * the request. The handler is added after the {@link UHttpResponseEncoder} and before the
+ * {@link UHttpContentDecompressor}, so that it sees every request, the responses are written in the order of the
+ * requests. A body in memory is compressed if it has at least the minimal size and gets smaller, a streamed body
+ * without <tt>Content-Length</tt> is compressed chunk by chunk and every chunk is flushed, so that streams like
+ * server-sent events arrive without delay. Streamed bodies with a <tt>Content-Length</tt>, like files and ranges, are
+ * never compressed, neither are responses that already have a <tt>Content-Encoding</tt>, responses to HEAD requests
+ * and media types that are compressed already, see {@link #isCompressible(UHttpResponse)}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttpContentCompressor extends UChannelHandlerAdapter {
+	/**
+	 * The default minimal size of a body in memory to compress.
+	 */
+	public static final int DEFAULT_MIN_SIZE = 1024;
+
+	/**
+	 * Create a new compressor with the default minimal size and compression level.
+	 */
+	public UHttpContentCompressor() {
+		this(DEFAULT_MIN_SIZE, Deflater.DEFAULT_COMPRESSION);
+	}
+
+	/**
+	 * Create a new compressor.
+	 * @param minSize
+	 * the minimal size of a body in memory to compress.
+	 * @param level
+	 * the compression level from 0 to 9 or {@link Deflater#DEFAULT_COMPRESSION}.
+	 */
+	public UHttpContentCompressor( final int minSize, final int level ) {
+		if (minSize < 0) throw new IllegalArgumentException("minSize: "+minSize);
+		if ((level < 0 || level > 9) && level!=Deflater.DEFAULT_COMPRESSION) throw new IllegalArgumentException("level: "+level);
+		this.minSize = minSize;
+		this.level = level;
+	}
+
+	/**
+	 * The minimal size of a body in memory to compress.
+	 */
+	protected final int minSize;
+
+	/**
+	 * The compression level.
+	 */
+	protected final int level;
+
+	/**
+	 * The requests whose responses are not yet written, in the order of the requests.
+	 */
+	private final ArrayDeque<UHttpRequest> requests = new ArrayDeque<>();
+
+	/**
+	 * The compressor of the streamed body being written or null.
+	 */
+	private UCompressor compressor;
+
+	/**
+	 * Returns the format preferred by the given <tt>Accept-Encoding</tt>. Gzip is preferred over deflate, if both
+	 * have the same quality.
+	 * @param acceptEncoding
+	 * the value of the header or null.
+	 * @return
+	 * the format or null, if neither gzip nor deflate is acceptable.
+	 */
+	public static UCompression negotiate( final String acceptEncoding ) {
+		if (acceptEncoding==null) return null;
+		double gzip = -1, deflate = -1, any = -1;
+		for (final String part : acceptEncoding.split(",")) {
+			final String[] params = part.split(";");
+			final String coding = params[0].trim();
+			double q = 1d;
+			for (int i=1; i < params.length; i++) {
+				final String param = params[i].trim();
+				if (!param.regionMatches(true, 0, "q=", 0, 2)) continue;
+				try {
+					q = Double.parseDouble(param.substring(2).trim());
+				} catch (NumberFormatException e) {
+					q = 0d;
+				}
+			}
+			if (coding.equals("*")) {
+				any = q;
+			} else
+			if (UCompression.forEncoding(coding)==UCompression.GZIP) {
+				gzip = q;
+			} else
+			if (UCompression.forEncoding(coding)==UCompression.DEFLATE) {
+				deflate = q;
+			}
+		}
+		if (gzip < 0) gzip = any;
+		if (deflate < 0) deflate = any;
+		if (gzip > 0 && gzip >= deflate) return UCompression.GZIP;
+		if (deflate > 0) return UCompression.DEFLATE;
+		return null;
+	}
+
+	/**
+	 * Returns true if the media type of the given response is worth compressing. The default implementation excludes
+	 * images, audio, video and archives, but accepts responses without content type.
+	 * @param response
+	 * the response.
+	 * @return
+	 * true if the body should be compressed.
+	 */
+	protected boolean isCompressible( final UHttpResponse response ) {
+		final String type = response.headers().get(UHttpHeaders.CONTENT_TYPE);
+		if (type==null) return true;
+		final int end = type.indexOf(';');
+		final String mediaType = (end < 0 ? type : type.substring(0, end)).trim().toLowerCase();
+		if (mediaType.equals("image/svg+xml")) return true;
+		if (mediaType.startsWith("image/") || mediaType.startsWith("audio/") || mediaType.startsWith("video/")) return false;
+		switch (mediaType) {
+			case "application/gzip":
+			case "application/x-gzip":
+			case "application/zip":
+			case "application/x-bzip2":
+			case "application/x-7z-compressed":
+			case "application/octet-stream":
+			case "font/woff":
+			case "font/woff2":
+				return false;
+			default:
+				return true;
+		}
+	}
+
+	@Override
+	public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+		if (msg instanceof UHttpRequest) requests.add((UHttpRequest)msg);
+		ctx.fireChannelRead(msg);
+	}
+
+	@Override
+	public void write( final UHandlerContext ctx, final Object msg, final UPromise<Void> promise ) throws Exception {
+		if (msg instanceof UHttpResponse) {
+			final UHttpResponse response = (UHttpResponse)msg;
+			final int status = response.status();
+			// interim responses precede the final response to the same request
+			if (status >= 100 && status < 200 && status!=101) {
+				ctx.write(msg, promise);
+				return;
+			}
+			endStream();
+			final UCompression format = format(requests.poll(), response);
+			if (format!=null) {
+				if (response.streamer()!=null) {
+					compressor = new UCompressor(format, level, ctx.alloc());
+					response.headers().set(UHttpHeaders.CONTENT_ENCODING, format.encoding());
+				} else {
+					final byte[] body = response.body();
+					final byte[] compressed = UCompressor.compress(format, body, ctx.alloc());
+					if (compressed.length < body.length) {
+						response.setBody(compressed);
+						response.headers().set(UHttpHeaders.CONTENT_ENCODING, format.encoding());
+					}
+				}
+			}
+			ctx.write(msg, promise);
+			return;
+		}
+		if (msg instanceof UHttpChunk && compressor!=null) {
+			final UHttpChunk chunk = (UHttpChunk)msg;
+			if (chunk.isLast()) {
+				final byte[] tail = compressor.finish();
+				compressor = null;
+				ctx.write(new UHttpChunk(tail));
+				ctx.write(chunk, promise);
+			} else {
+				ctx.write(new UHttpChunk(compressor.compress(chunk.data(), 0, chunk.data().length, true)), promise);
+			}
+			return;
+		}
+		ctx.write(msg, promise);
+	}
+
+	@Override
+	public void channelInactive( final UHandlerContext ctx ) throws Exception {
+		endStream();
+		requests.clear();
+		ctx.fireChannelInactive();
+	}
+
+	@Override
+	public void handlerRemoved( final UHandlerContext ctx ) throws Exception {
+		endStream();
+	}
+
+	/**
+	 * Returns the format of the body of the given response, adds <tt>Vary: Accept-Encoding</tt> if the response
+	 * could be compressed.
+	 * @return
+	 * the format or null, if the body is not compressed.
+	 */
+	private UCompression format( final UHttpRequest request, final UHttpResponse response ) {
+		if (request==null || request.method().equals("HEAD")) return null;
+		if (UHttpResponse.isContentAlwaysEmpty(response.status()) || response.status()==101) return null;
+		final UHttpHeaders headers = response.headers();
+		if (headers.contains(UHttpHeaders.CONTENT_ENCODING)) return null;
+		if (response.streamer()!=null ? headers.contains(UHttpHeaders.CONTENT_LENGTH) : response.body().length < minSize) return null;
+		if (!isCompressible(response)) return null;
+		if (!headers.contains(UHttpHeaders.VARY, UHttpHeaders.ACCEPT_ENCODING)) headers.add(UHttpHeaders.VARY, UHttpHeaders.ACCEPT_ENCODING);
+		return negotiate(request.headers().get(UHttpHeaders.ACCEPT_ENCODING));
+	}
+
+	/**
+	 * Releases the compressor of a streamed body that did not end.
+	 */
+	private void endStream() {
+		if (compressor==null) return;
+		compressor.close();
+		compressor = null;
+	}
+}
@@ -0,0 +1,165 @@
+package com.umpani.aio.http;
+
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.codec.UCompression;
+import com.umpani.aio.codec.UDecompressor;
+import com.umpani.aio.exception.UCodecException;
+import com.umpani.aio.exception.UHttpException;
+
+/**
+ * Decompresses the bodies of received HTTP messages with a gzip or deflate <tt>Content-Encoding</tt>, the handler is
+ * added after the decoder. A body in memory is replaced by the decompressed body, a streamed body is decompressed
+ * chunk by chunk. The <tt>Content-Encoding</tt> is removed from the message, the <tt>Content-Length</tt> is updated
+ * or, for a streamed body, removed. A message without body, like the response to a HEAD request or a 304, is passed
+ * on unchanged.
+ *
+ * </p><p>The size of a decompressed body is limited, so that a small, highly compressed body can't exhaust the
+ * memory: a body that exceeds the limit fails with an {@link UHttpException} with status 413 and an invalid or
+ * truncated body with status 400. After a failure the rest of the streamed body is discarded. A request with an
+ * unknown content coding fails with status 415, a response with an unknown content coding is passed on unchanged.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttpContentDecompressor extends UChannelHandlerAdapter {
+	/**
+	 * The amount of compressed bytes decompressed at once, which bounds the size of a decompressed chunk.
+	 */
+	private static final int SLICE_SIZE = 1024;
+
+	/**
+	 * Create a new decompressor.
+	 * @param maxSize
+	 * the maximal size of a decompressed body in bytes.
+	 */
+	public UHttpContentDecompressor( final long maxSize ) {
+		if (maxSize < 0) throw new IllegalArgumentException("maxSize: "+maxSize);
+		this.maxSize = maxSize;
+	}
+
+	/**
+	 * The maximal size of a decompressed body.
+	 */
+	protected final long maxSize;
+
+	/**
+	 * The format of the streamed body being received or null.
+	 */
+	private UCompression format;
+
+	/**
+	 * The decompressor of the streamed body, created with the first chunk.
+	 */
+	private UDecompressor decompressor;
+
+	/**
+	 * True if the rest of the streamed body is discarded after a failure.
+	 */
+	private boolean discarding;
+
+	@Override
+	public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+		if (msg instanceof UHttpMessage) {
+			endStream();
+			discarding = false;
+			final UHttpMessage message = (UHttpMessage)msg;
+			final UCompression format = format(message);
+			// a message without body, like the response to HEAD or a 304, keeps the header fields of the entity
+			if (format!=null && (message.bodyFollows || message.body().length > 0)) {
+				final UHttpHeaders headers = message.headers();
+				headers.remove(UHttpHeaders.CONTENT_ENCODING);
+				if (message.bodyFollows) {
+					this.format = format;
+					headers.remove(UHttpHeaders.CONTENT_LENGTH);
+				} else {
+					final UDecompressor decompressor = new UDecompressor(format, maxSize, ctx.alloc());
+					try {
+						final byte[] body = decompressor.decompress(message.body(), 0, message.body().length);
+						if (!decompressor.isFinished()) throw new UCodecException("Truncated "+format.encoding()+" body");
+						message.setBody(body);
+						headers.set(UHttpHeaders.CONTENT_LENGTH, body.length);
+					} catch (UCodecException e) {
+						throw failure(decompressor, e);
+					} finally {
+						decompressor.close();
+					}
+				}
+			}
+			ctx.fireChannelRead(msg);
+			return;
+		}
+		if (msg instanceof UHttpChunk && (format!=null || discarding)) {
+			final UHttpChunk chunk = (UHttpChunk)msg;
+			if (discarding) {
+				if (chunk.isLast()) discarding = false;
+				return;
+			}
+			if (chunk.isLast()) {
+				final UDecompressor decompressor = this.decompressor;
+				final UCompression format = this.format;
+				endStream();
+				if (decompressor!=null && !decompressor.isFinished()) throw new UHttpException(400, "Truncated "+format.encoding()+" body");
+				ctx.fireChannelRead(chunk);
+				return;
+			}
+			if (decompressor==null) decompressor = new UDecompressor(format, maxSize, ctx.alloc());
+			final byte[] data = chunk.data();
+			try {
+				for (int offset=0; offset < data.length; offset+=SLICE_SIZE) {
+					final byte[] out = decompressor.decompress(data, offset, Math.min(SLICE_SIZE, data.length - offset));
+					if (out.length > 0) ctx.fireChannelRead(new UHttpChunk(out));
+				}
+			} catch (UCodecException e) {
+				final UHttpException failure = failure(decompressor, e);
+				endStream();
+				discarding = true;
+				throw failure;
+			}
+			return;
+		}
+		ctx.fireChannelRead(msg);
+	}
+
+	@Override
+	public void channelInactive( final UHandlerContext ctx ) throws Exception {
+		endStream();
+		ctx.fireChannelInactive();
+	}
+
+	@Override
+	public void handlerRemoved( final UHandlerContext ctx ) throws Exception {
+		endStream();
+	}
+
+	/**
+	 * Returns the format of the body of the given message.
+	 * @return
+	 * the format or null, if the body is not encoded or the content coding of a response is unknown.
+	 * @throws UHttpException
+	 * if the content coding of a request is unknown.
+	 */
+	private static UCompression format( final UHttpMessage message ) throws UHttpException {
+		final String encoding = message.headers().get(UHttpHeaders.CONTENT_ENCODING);
+		if (encoding==null || encoding.trim().equalsIgnoreCase("identity")) return null;
+		final UCompression format = UCompression.forEncoding(encoding);
+		if (format==null && message instanceof UHttpRequest) throw new UHttpException(415, "Unsupported content encoding: "+encoding);
+		return format;
+	}
+
+	/**
+	 * Converts a failed decompression into the exception to report.
+	 */
+	private static UHttpException failure( final UDecompressor decompressor, final UCodecException e ) {
+		return new UHttpException(decompressor.isLimitExceeded() ? 413 : 400, e.getMessage(), e);
+	}
+
+	/**
+	 * Releases the decompressor of the current streamed body.
+	 */
+	private void endStream() {
+		format = null;
+		if (decompressor==null) return;
+		decompressor.close();
+		decompressor = null;
+	}
+}
@@ -0,0 +1,478 @@
+package com.umpani.aio.http;
+
+import java.nio.charset.StandardCharsets;
+import java.util.Arrays;
+import java.util.List;
+
+import com.umpani.aio.UCompositeBuffer;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.codec.UByteToMessageDecoder;
+import com.umpani.aio.exception.UHttpException;
+
+/**
+ * The base class of the incremental HTTP/1.x decoders. The decoder parses the start line, the header fields and the
+ * body as the bytes arrive, bodies with a <tt>Content-Length</tt>, with chunked transfer encoding and, if the
+ * sub-class allows it, bodies that end with the connection are supported. Every complete message is passed on as
+ * {@link UHttpMessage} with the body in memory, unless the sub-class streams the message: then the message is passed
+ * on without body as soon as the header is complete, followed by an {@link UHttpChunk} for every part of the body
+ * and the {@link UHttpChunk#LAST} chunk.
+ *
+ * </p><p>The size of the start line plus the header fields and the size of a body in memory are limited. A malformed
+ * message or a message that exceeds a limit is reported as {@link UHttpException} with the status code to answer,
+ * after that all further bytes are discarded, because the start of the next message can't be found reliably.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public abstract class UHttpDecoder extends UByteToMessageDecoder {
+	/**
+	 * The default maximal size of the start line and the header fields in bytes.
+	 */
+	public static final int DEFAULT_MAX_HEADER_SIZE = 8192;
+
+	/**
+	 * The default maximal size of the body in bytes.
+	 */
+	public static final int DEFAULT_MAX_BODY_SIZE = 1 << 20;
+
+	/**
+	 * The states of the decoder.
+	 */
+	private static enum State {
+		START_LINE, HEADERS, BODY, CHUNK_SIZE, CHUNK_DATA, CHUNK_END, TRAILERS, UNTIL_CLOSE, UPGRADED, BAD
+	}
+
+	/**
+	 * Create a new decoder.
+	 * @param maxHeaderSize
+	 * the maximal size of the start line and the header fields in bytes.
+	 * @param maxBodySize
+	 * the maximal size of the body in bytes.
+	 */
+	protected UHttpDecoder( final int maxHeaderSize, final int maxBodySize ) {
+		if (maxHeaderSize <= 0) throw new IllegalArgumentException("maxHeaderSize: "+maxHeaderSize);
+		if (maxBodySize < 0) throw new IllegalArgumentException("maxBodySize: "+maxBodySize);
+		this.maxHeaderSize = maxHeaderSize;
+		this.maxBodySize = maxBodySize;
+	}
+
+	/**
+	 * The maximal size of the start line and the header fields.
+	 */
+	protected final int maxHeaderSize;
+
+	/**
+	 * The maximal size of the body.
+	 */
+	protected final int maxBodySize;
+
+	/**
+	 * The current state.
+	 */
+	private State state = State.START_LINE;
+
+	/**
+	 * The message being decoded.
+	 */
+	private UHttpMessage message;
+
+	/**
+	 * The size of the start line and the header fields read so far.
+	 */
+	private int headerSize;
+
+	/**
+	 * The bytes of the body read so far.
+	 */
+	private byte[] body = UHttpMessage.EMPTY;
+
+	/**
+	 * The length of the body read so far.
+	 */
+	private int bodyLength;
+
+	/**
+	 * The amount of bytes left of the body or the current chunk.
+	 */
+	private long remaining;
+
+	/**
+	 * True if the body of the current message is streamed.
+	 */
+	private boolean streamed;
+
+	/**
+	 * Creates the message from the parts of the start line.
+	 * @param initialLine
+	 * the start line split at the first two spaces, so it has up to three parts.
+	 * @return
+	 * the new message.
+	 * @throws UHttpException
+	 * if the start line is invalid.
+	 */
+	protected abstract UHttpMessage createMessage( final String[] initialLine ) throws UHttpException;
+
+	/**
+	 * Returns true if the given message never has a body, regardless of its header fields. The default implementation
+	 * returns false.
+	 * @param message
+	 * the message.
+	 * @return
+	 * true if the message has no body.
+	 */
+	protected boolean isContentAlwaysEmpty( final UHttpMessage message ) {
+		return false;
+	}
+
+	/**
+	 * Returns true if the body of the given message is streamed instead of held in memory. The default
+	 * implementation returns false.
+	 * @param message
+	 * the message.
+	 * @return
+	 * true if the body is streamed.
+	 */
+	protected boolean isStreamed( final UHttpMessage message ) {
+		return false;
+	}
+
+	/**
+	 * Returns true if the body of the given message, which has neither a <tt>Content-Length</tt> nor chunked transfer
+	 * encoding, ends with the connection. The default implementation returns false, so the body is empty.
+	 * @param message
+	 * the message.
+	 * @return
+	 * true if the body ends with the connection.
+	 */
+	protected boolean isReadUntilClose( final UHttpMessage message ) {
+		return false;
+	}
+
+	/**
+	 * Returns true if the connection switches to another protocol after the given message. Then the decoder stops
+	 * decoding and keeps all following bytes, which are passed to the next handler once the decoder is removed from
+	 * the pipeline. The default implementation returns false.
+	 * @param message
+	 * the message.
+	 * @return
+	 * true if the connection switches to another protocol.
+	 */
+	protected boolean isUpgrade( final UHttpMessage message ) {
+		return false;
+	}
+
+	/**
+	 * Called once the header fields of a message were decoded, before its body. The default implementation does
+	 * nothing.
+	 * @param ctx
+	 * the context of the handler.
+	 * @param message
+	 * the message.
+	 * @param hasBody
+	 * true if a body follows.
+	 * @throws Exception
+	 * if the message must be rejected.
+	 */
+	protected void headersReceived( final UHandlerContext ctx, final UHttpMessage message, final boolean hasBody ) throws Exception {}
+
+	@Override
+	protected void decode( final UHandlerContext ctx, final UCompositeBuffer in, final List<Object> out ) throws Exception {
+		switch (state) {
+			case START_LINE: {
+				final String line = readLine(in, true);
+				if (line==null || line.isEmpty()) return;
+				message = createMessage(line.split(" ", 3));
+				state = State.HEADERS;
+				return;
+			}
+			case HEADERS: {
+				final String line = readLine(in, true);
+				if (line==null) return;
+				if (line.isEmpty()) {
+					headersComplete(ctx, out);
+				} else {
+					addHeader(message.headers(), line);
+				}
+				return;
+			}
+			case BODY: {
+				readBody(in, out);
+				if (remaining==0) complete(out);
+				return;
+			}
+			case CHUNK_SIZE: {
+				final String line = readLine(in, false);
+				if (line==null) return;
+				final long size = parseChunkSize(line);
+				if (size==0) {
+					state = State.TRAILERS;
+				} else {
+					// the size is not added to the length, the sum may overflow
+					if (!streamed && size > maxBodySize - bodyLength) throw fail(413, "Body exceeds "+maxBodySize+" bytes");
+					remaining = size;
+					state = State.CHUNK_DATA;
+				}
+				return;
+			}
+			case CHUNK_DATA: {
+				readBody(in, out);
+				if (remaining==0) state = State.CHUNK_END;
+				return;
+			}
+			case CHUNK_END: {
+				final String line = readLine(in, false);
+				if (line==null) return;
+				if (!line.isEmpty()) throw fail(400, "Missing line break after chunk");
+				state = State.CHUNK_SIZE;
+				return;
+			}
+			case TRAILERS: {
+				final String line = readLine(in, true);
+				if (line==null) return;
+				if (line.isEmpty()) {
+					complete(out);
+				} else {
+					addHeader(message.headers(), line);
+				}
+				return;
+			}
+			case UNTIL_CLOSE: {
+				final int n = in.readableBytes();
+				if (!streamed && bodyLength + (long)n > maxBodySize) throw fail(413, "Body exceeds "+maxBodySize+" bytes");
+				remaining = n;
+				readBody(in, out);
+				return;
+			}
+			case UPGRADED:
+				// the bytes belong to the next protocol
+				return;
+			default:
+				in.skipBytes(in.readableBytes());
+		}
+	}
+
+	@Override
+	protected void decodeLast( final UHandlerContext ctx, final UCompositeBuffer in, final List<Object> out ) throws Exception {
+		super.decodeLast(ctx, in, out);
+		if (state==State.UNTIL_CLOSE) {
+			complete(out);
+		} else
+		if (state!=State.START_LINE && state!=State.UPGRADED && state!=State.BAD) {
+			throw fail(400, "Connection closed before the message was complete");
+		}
+	}
+
+	/**
+	 * Marks whether the body of the current message follows in chunks and calls
+	 * {@link #headersReceived(UHandlerContext, UHttpMessage, boolean)}.
+	 */
+	private void bodyFollows( final UHandlerContext ctx, final boolean hasBody ) throws Exception {
+		message.bodyFollows = streamed && hasBody;
+		headersReceived(ctx, message, hasBody);
+	}
+
+	/**
+	 * Evaluates the header fields and decides how the body is read.
+	 */
+	private void headersComplete( final UHandlerContext ctx, final List<Object> out ) throws Exception {
+		final UHttpHeaders headers = message.headers();
+		headerSize = 0;
+		streamed = isStreamed(message);
+		if (streamed) out.add(message);
+		if (isContentAlwaysEmpty(message)) {
+			bodyFollows(ctx, false);
+			complete(out);
+			return;
+		}
+		final String transferEncoding = headers.get(UHttpHeaders.TRANSFER_ENCODING);
+		if (transferEncoding!=null) {
+			if (message instanceof UHttpRequest) {
+				// a request with both is ambiguous and may smuggle another request past a proxy
+				if (headers.contains(UHttpHeaders.CONTENT_LENGTH)) throw fail(400, "Transfer-Encoding with Content-Length");
+				// the body of a request only ends if chunked is the last coding
+				if (!"chunked".equalsIgnoreCase(lastCoding(headers))) throw fail(400, "Unsupported transfer encoding: "+transferEncoding);
+			} else
+			if (!headers.contains(UHttpHeaders.TRANSFER_ENCODING, "chunked")) {
+				throw fail(501, "Unsupported transfer encoding: "+transferEncoding);
+			}
+			// the length of chunked bodies is given by the chunks
+			headers.remove(UHttpHeaders.CONTENT_LENGTH);
+			bodyFollows(ctx, true);
+			state = State.CHUNK_SIZE;
+			return;
+		}
+		final List<String> lengths = headers.getAll(UHttpHeaders.CONTENT_LENGTH);
+		if (!lengths.isEmpty()) {
+			long length = -1;
+			for (final String value : lengths) {
+				final String digits = value.trim();
+				// only 1*DIGIT, a sign or other lenient forms may be read differently by a proxy
+				if (digits.isEmpty()) throw fail(400, "Invalid Content-Length");
+				for (int i=0; i < digits.length(); i++) {
+					final char c = digits.charAt(i);
+					if (c < '0' || c > '9') throw fail(400, "Invalid Content-Length");
+				}
+				final long l;
+				try {
+					l = Long.parseLong(digits);
+				} catch (NumberFormatException e) {
+					throw fail(400, "Invalid Content-Length");
+				}
+				if (l < 0 || (length >= 0 && l!=length)) throw fail(400, "Invalid Content-Length");
+				length = l;
+			}
+			if (!streamed && length > maxBodySize) throw fail(413, "Body exceeds "+maxBodySize+" bytes");
+			bodyFollows(ctx, length > 0);
+			if (length==0) {
+				complete(out);
+			} else {
+				remaining = length;
+				state = State.BODY;
+			}
+			return;
+		}
+		if (isReadUntilClose(message)) {
+			bodyFollows(ctx, true);
+			state = State.UNTIL_CLOSE;
+			return;
+		}
+		bodyFollows(ctx, false);
+		complete(out);
+	}
+
+	/**
+	 * Returns the last coding of the Transfer-Encoding header fields.
+	 */
+	private static String lastCoding( final UHttpHeaders headers ) {
+		String last = null;
+		for (final String value : headers.getAll(UHttpHeaders.TRANSFER_ENCODING)) {
+			for (final String part : value.split(",")) {
+				if (!part.trim().isEmpty()) last = part.trim();
+			}
+		}
+		return last;
+	}
+
+	/**
+	 * Parses the size of a chunk, up to 16 hexadecimal digits without sign, followed by optional extensions.
+	 */
+	private long parseChunkSize( final String line ) throws UHttpException {
+		final int end = line.indexOf(';');
+		final String hex = (end < 0 ? line : line.substring(0, end)).trim();
+		if (hex.isEmpty() || hex.length() > 16) throw fail(400, "Invalid chunk size");
+		for (int i=0; i < hex.length(); i++) {
+			if (Character.digit(hex.charAt(i), 16) < 0) throw fail(400, "Invalid chunk size");
+		}
+		try {
+			return Long.parseLong(hex, 16);
+		} catch (NumberFormatException e) {
+			// more than 63 bits
+			throw fail(400, "Invalid chunk size");
+		}
+	}
+
+	/**
+	 * Reads up to the remaining amount of body bytes.
+	 */
+	private void readBody( final UCompositeBuffer in, final List<Object> out ) {
+		final int n = (int)Math.min(remaining, in.readableBytes());
+		if (n==0) return;
+		remaining -= n;
+		if (streamed) {
+			final byte[] data = new byte[n];
+			in.readBytes(data, 0, n);
+			out.add(new UHttpChunk(data));
+			return;
+		}
+		if (bodyLength + n > body.length) {
+			body = Arrays.copyOf(body, Math.max(bodyLength + n, Math.min(maxBodySize, Math.max(256, body.length << 1))));
+		}
+		in.readBytes(body, bodyLength, n);
+		bodyLength += n;
+	}
+
+	/**
+	 * Completes the current message and resets the decoder.
+	 */
+	private void complete( final List<Object> out ) {
+		final boolean upgrade = isUpgrade(message);
+		if (streamed) {
+			out.add(UHttpChunk.LAST);
+		} else {
+			message.setBody(bodyLength==0 ? UHttpMessage.EMPTY : Arrays.copyOf(body, bodyLength));
+			out.add(message);
+		}
+		message = null;
+		streamed = false;
+		body = UHttpMessage.EMPTY;
+		bodyLength = 0;
+		remaining = 0;
+		headerSize = 0;
+		state = upgrade ? State.UPGRADED : State.START_LINE;
+	}
+
+	/**
+	 * Reads a line terminated by a line-feed, an optional carriage return is removed.
+	 * @param header
+	 * true if the line counts to the header size.
+	 * @return
+	 * the line or null, if no complete line is available.
+	 */
+	private String readLine( final UCompositeBuffer in, final boolean header ) throws UHttpException {
+		final int limit = header ? maxHeaderSize - headerSize : 1024;
+		final int index = in.indexOf((byte)'\n', 0);
+		if (index < 0) {
+			if (in.readableBytes() > limit) throw tooLarge(header);
+			return null;
+		}
+		if (index + 1 > limit) throw tooLarge(header);
+		if (header) headerSize += index + 1;
+		final byte[] bytes = new byte[index + 1];
+		in.readBytes(bytes, 0, bytes.length);
+		int length = index;
+		if (length > 0 && bytes[length - 1]=='\r') length--;
+		return new String(bytes, 0, length, StandardCharsets.ISO_8859_1);
+	}
+
+	/**
+	 * Returns the exception for a line that exceeds the limit.
+	 */
+	private UHttpException tooLarge( final boolean header ) {
+		if (!header) return fail(400, "Chunk size line too long");
+		if (message==null) return fail(414, "Start line exceeds "+maxHeaderSize+" bytes");
+		return fail(431, "Header exceeds "+maxHeaderSize+" bytes");
+	}
+
+	/**
+	 * Parses a header field and adds it to the given headers.
+	 */
+	private void addHeader( final UHttpHeaders headers, final String line ) throws UHttpException {
+		// obsolete line folding is rejected, as allowed by RFC 7230
+		if (line.charAt(0)==' ' || line.charAt(0)=='\t') throw fail(400, "Invalid header folding");
+		final int colon = line.indexOf(':');
+		if (colon <= 0) throw fail(400, "Invalid header field");
+		final String name = line.substring(0, colon);
+		for (int i=0; i < name.length(); i++) {
+			final char c = name.charAt(i);
+			if (c <= ' ' || c >= 127) throw fail(400, "Invalid header name");
+		}
+		headers.add(name, line.substring(colon + 1).trim());
+	}
+
+	/**
+	 * Switches into the bad state and returns the exception to throw.
+	 * @param status
+	 * the status code to answer.
+	 * @param message
+	 * the message of the exception.
+	 * @return
+	 * the exception to throw.
+	 */
+	protected final UHttpException fail( final int status, final String message ) {
+		state = State.BAD;
+		this.message = null;
+		streamed = false;
+		body = UHttpMessage.EMPTY;
+		bodyLength = 0;
+		return new UHttpException(status, message);
+	}
+}
@@ -0,0 +1,110 @@
+package com.umpani.aio.http;
+
+import com.umpani.aio.UBufferOutputStream;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.codec.UMessageToByteEncoder;
+
+/**
+ * The base class of the HTTP/1.x encoders, which encode {@link UHttpMessage}s and the {@link UHttpChunk}s of streamed
+ * bodies. The framing header fields are set by the encoder: a message with the body in memory gets a
+ * <tt>Content-Length</tt>, a streamed message without <tt>Content-Length</tt> gets chunked transfer encoding, if the
+ * version is HTTP/1.1, otherwise the body ends with the connection.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public abstract class UHttpEncoder extends UMessageToByteEncoder<Object> {
+	/**
+	 * The line terminator.
+	 */
+	private static final String CRLF = "\r\n";
+
+	/**
+	 * Create a new encoder.
+	 */
+	protected UHttpEncoder() {
+		super(Object.class);
+	}
+
+	/**
+	 * True if the chunks of the current message are written with chunked transfer encoding.
+	 */
+	private boolean chunked;
+
+	/**
+	 * Returns true if the given message never has a body. The default implementation returns false.
+	 * @param message
+	 * the message.
+	 * @return
+	 * true if the message never has a body.
+	 */
+	protected boolean isContentAlwaysEmpty( final UHttpMessage message ) {
+		return false;
+	}
+
+	/**
+	 * Writes the start line without line terminator.
+	 * @param message
+	 * the message.
+	 * @param out
+	 * the stream to write to.
+	 * @throws Exception
+	 * if writing failed.
+	 */
+	protected abstract void encodeStartLine( final UHttpMessage message, final UBufferOutputStream out ) throws Exception;
+
+	@Override
+	protected boolean accept( final Object msg ) {
+		return msg instanceof UHttpMessage || msg instanceof UHttpChunk;
+	}
+
+	@Override
+	protected void encode( final UHandlerContext ctx, final Object msg, final UBufferOutputStream out ) throws Exception {
+		if (msg instanceof UHttpChunk) {
+			encodeChunk((UHttpChunk)msg, out);
+			return;
+		}
+		final UHttpMessage message = (UHttpMessage)msg;
+		final UHttpHeaders headers = message.headers();
+		final boolean empty = isContentAlwaysEmpty(message);
+		chunked = false;
+		if (empty) {
+			headers.remove(UHttpHeaders.TRANSFER_ENCODING);
+		} else
+		if (message.streamer()!=null) {
+			if (!headers.contains(UHttpHeaders.CONTENT_LENGTH) && UHttpMessage.HTTP_1_1.equals(message.version())) {
+				headers.set(UHttpHeaders.TRANSFER_ENCODING, "chunked");
+				chunked = true;
+			}
+		} else {
+			headers.remove(UHttpHeaders.TRANSFER_ENCODING);
+			headers.set(UHttpHeaders.CONTENT_LENGTH, message.body().length);
+		}
+		encodeStartLine(message, out);
+		out.append(CRLF);
+		for (int i=0; i < headers.size(); i++) {
+			out.append(headers.name(i)).append(": ").append(headers.value(i)).append(CRLF);
+		}
+		out.append(CRLF);
+		if (!empty && !message.omitBody && message.streamer()==null) out.write(message.body(), 0, message.body().length);
+	}
+
+	/**
+	 * Writes a chunk of a streamed body.
+	 */
+	private void encodeChunk( final UHttpChunk chunk, final UBufferOutputStream out ) {
+		if (!chunked) {
+			out.write(chunk.data(), 0, chunk.data().length);
+			return;
+		}
+		if (chunk.isLast()) {
+			chunked = false;
+			out.append("0").append(CRLF).append(CRLF);
+			return;
+		}
+		final byte[] data = chunk.data();
+		if (data.length==0) return;
+		out.append(Integer.toHexString(data.length)).append(CRLF);
+		out.write(data, 0, data.length);
+		out.append(CRLF);
+	}
+}
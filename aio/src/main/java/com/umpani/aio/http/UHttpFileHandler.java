@@ -0,0 +1,428 @@
+package com.umpani.aio.http;
+
+import java.io.IOException;
+import java.nio.file.Files;
+import java.nio.file.NoSuchFileException;
+import java.nio.file.Path;
+import java.nio.file.attribute.BasicFileAttributes;
+import java.text.SimpleDateFormat;
+import java.util.Date;
+import java.util.HashMap;
+import java.util.Locale;
+import java.util.Map;
+import java.util.TimeZone;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.Executor;
+import java.util.concurrent.ExecutorService;
+import java.util.concurrent.Executors;
+import java.util.concurrent.ThreadFactory;
+import java.util.concurrent.atomic.AtomicInteger;
+
+import com.umpani.aio.UFileRegion;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.exception.UHttpException;
+import com.umpani.util.log.ULogger;
+
+/**
+ * Serves the files below a root directory. The file is selected by the rest of the path matched by the wildcard of
+ * an {@link UHttpRouter} route like <tt>/static/*</tt> or, without wildcard, by the whole path; paths that leave the
+ * root directory, hidden files and missing files are answered with <tt>404 Not Found</tt>, for a directory its index
+ * file is served. The body is sent as {@link UFileRegion}, so that it is transferred without copying. The attributes of
+ * the file are read and the file is opened by an executor, see {@link #setExecutor(Executor)}, because these calls
+ * block and must not delay the event loop.
+ *
+ * </p><p>Every response has an <tt>ETag</tt>, derived from the size and the modification time of the file, and a
+ * <tt>Last-Modified</tt> header. A request whose <tt>If-None-Match</tt> matches the tag is answered with
+ * <tt>304 Not Modified</tt>. A single byte range requested with <tt>Range</tt> is answered with
+ * <tt>206 Partial Content</tt>, unless an <tt>If-Range</tt> does not match the tag, and a range outside of the file
+ * with <tt>416 Range Not Satisfiable</tt>. Requests for multiple ranges are answered with the whole file.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttpFileHandler implements UHttpHandler {
+	/**
+	 * The logger of the file handlers.
+	 */
+	private static final ULogger LOG = new ULogger(UHttpFileHandler.class.getName());
+
+	/**
+	 * The default name of the index file of directories.
+	 */
+	public static final String DEFAULT_INDEX = "index.html";
+
+	/**
+	 * The default content type of unknown extensions.
+	 */
+	public static final String DEFAULT_CONTENT_TYPE = "application/octet-stream";
+
+	/**
+	 * The result of {@link #parseRange(String, long)} for a range outside of the file.
+	 */
+	private static final long[] UNSATISFIABLE = new long[0];
+
+	/**
+	 * The content types of the known extensions.
+	 */
+	private static final Map<String,String> CONTENT_TYPES = new HashMap<>();
+	static {
+		CONTENT_TYPES.put("html", "text/html; charset=utf-8");
+		CONTENT_TYPES.put("htm", "text/html; charset=utf-8");
+		CONTENT_TYPES.put("css", "text/css; charset=utf-8");
+		CONTENT_TYPES.put("js", "application/javascript; charset=utf-8");
+		CONTENT_TYPES.put("json", "application/json; charset=utf-8");
+		CONTENT_TYPES.put("txt", "text/plain; charset=utf-8");
+		CONTENT_TYPES.put("csv", "text/csv; charset=utf-8");
+		CONTENT_TYPES.put("xml", "application/xml");
+		CONTENT_TYPES.put("svg", "image/svg+xml");
+		CONTENT_TYPES.put("png", "image/png");
+		CONTENT_TYPES.put("jpg", "image/jpeg");
+		CONTENT_TYPES.put("jpeg", "image/jpeg");
+		CONTENT_TYPES.put("gif", "image/gif");
+		CONTENT_TYPES.put("ico", "image/x-icon");
+		CONTENT_TYPES.put("webp", "image/webp");
+		CONTENT_TYPES.put("woff", "font/woff");
+		CONTENT_TYPES.put("woff2", "font/woff2");
+		CONTENT_TYPES.put("pdf", "application/pdf");
+		CONTENT_TYPES.put("zip", "application/zip");
+		CONTENT_TYPES.put("gz", "application/gzip");
+		CONTENT_TYPES.put("mp4", "video/mp4");
+		CONTENT_TYPES.put("mp3", "audio/mpeg");
+	}
+
+	/**
+	 * Create a new handler.
+	 * @param root
+	 * the root directory.
+	 */
+	public UHttpFileHandler( final Path root ) {
+		if (root==null) throw new NullPointerException("root");
+		this.root = root.toAbsolutePath().normalize();
+	}
+
+	/**
+	 * The root directory.
+	 */
+	private final Path root;
+
+	/**
+	 * The content types added to the known ones, by lower case extension.
+	 */
+	private final ConcurrentHashMap<String,String> contentTypes = new ConcurrentHashMap<>();
+
+	/**
+	 * The name of the index file.
+	 */
+	private volatile String index = DEFAULT_INDEX;
+
+	/**
+	 * The value of the Cache-Control header or null.
+	 */
+	private volatile String cacheControl;
+
+	/**
+	 * The executor of the file system calls or null for the default.
+	 */
+	private volatile Executor executor;
+
+	/**
+	 * Returns the root directory.
+	 * @return
+	 * the absolute root directory.
+	 */
+	public Path root() {
+		return root;
+	}
+
+	/**
+	 * Sets the name of the file that is served for a directory.
+	 * @param index
+	 * the name or null, if directories are not served.
+	 * @return
+	 * this.
+	 */
+	public UHttpFileHandler setIndex( final String index ) {
+		this.index = index;
+		return this;
+	}
+
+	/**
+	 * Sets the Cache-Control header of all responses.
+	 * @param cacheControl
+	 * the value, for example <tt>max-age=3600</tt>, or null for no header.
+	 * @return
+	 * this.
+	 */
+	public UHttpFileHandler setCacheControl( final String cacheControl ) {
+		this.cacheControl = cacheControl;
+		return this;
+	}
+
+	/**
+	 * Sets the executor that reads the attributes of the files and opens them.
+	 * @param executor
+	 * the executor or null for a shared pool of daemon threads.
+	 * @return
+	 * this.
+	 */
+	public UHttpFileHandler setExecutor( final Executor executor ) {
+		this.executor = executor;
+		return this;
+	}
+
+	/**
+	 * Returns the executor of the file system calls.
+	 */
+	private Executor executor() {
+		final Executor executor = this.executor;
+		return executor!=null ? executor : DefaultExecutor.INSTANCE;
+	}
+
+	/**
+	 * Sets the content type of files with the given extension.
+	 * @param extension
+	 * the extension without dot.
+	 * @param contentType
+	 * the content type.
+	 * @return
+	 * this.
+	 */
+	public UHttpFileHandler setContentType( final String extension, final String contentType ) {
+		contentTypes.put(extension.toLowerCase(Locale.ROOT), contentType);
+		return this;
+	}
+
+	/**
+	 * Returns the content type of the given file.
+	 * @param file
+	 * the file.
+	 * @return
+	 * the content type.
+	 */
+	protected String contentType( final Path file ) {
+		final String name = file.getFileName().toString();
+		final int dot = name.lastIndexOf('.');
+		if (dot < 0) return DEFAULT_CONTENT_TYPE;
+		final String extension = name.substring(dot + 1).toLowerCase(Locale.ROOT);
+		String type = contentTypes.get(extension);
+		if (type==null) type = CONTENT_TYPES.get(extension);
+		return type!=null ? type : DEFAULT_CONTENT_TYPE;
+	}
+
+	/**
+	 * Handles the request, the response is created by the executor.
+	 */
+	@Override
+	public UFuture<?> handle( final UHttpRequest request ) throws Exception {
+		final String wildcard = request.getPathParameter("*");
+		final String path = wildcard!=null ? wildcard : UHttpRequest.decode(request.path().replace("+", "%2B"));
+		final Path file = resolve(path);
+		final UPromise<UHttpResponse> promise = new UPromise<UHttpResponse>();
+		executor().execute(new Runnable() {
+			@Override
+			public void run() {
+				try {
+					promise.complete(respond(request, path, file));
+				} catch (Throwable t) {
+					promise.fail(t);
+				}
+			}
+		});
+		return promise;
+	}
+
+	/**
+	 * Creates the response with the given file, blocks while reading the attributes of the file.
+	 */
+	private UHttpResponse respond( final UHttpRequest request, final String path, Path file ) throws Exception {
+		BasicFileAttributes attributes;
+		try {
+			attributes = Files.readAttributes(file, BasicFileAttributes.class);
+			if (attributes.isDirectory()) {
+				final String index = this.index;
+				if (index==null) throw new NoSuchFileException(file.toString());
+				file = file.resolve(index);
+				attributes = Files.readAttributes(file, BasicFileAttributes.class);
+			}
+		} catch (NoSuchFileException e) {
+			throw new UHttpException(404, "Not found: "+path);
+		}
+		if (!attributes.isRegularFile()) throw new UHttpException(404, "Not found: "+path);
+		final long size = attributes.size();
+		final long modified = attributes.lastModifiedTime().toMillis();
+		final String etag = "\""+Long.toHexString(modified)+"-"+Long.toHexString(size)+"\"";
+		final UHttpHeaders headers = request.headers();
+
+		final String ifNoneMatch = headers.get(UHttpHeaders.IF_NONE_MATCH);
+		if (ifNoneMatch!=null && matches(ifNoneMatch, etag)) {
+			final UHttpResponse response = new UHttpResponse(304);
+			setHeaders(response, etag, modified);
+			return response;
+		}
+
+		long start = 0;
+		long length = size;
+		int status = 200;
+		final String range = headers.get(UHttpHeaders.RANGE);
+		final String ifRange = headers.get(UHttpHeaders.IF_RANGE);
+		if (range!=null && (ifRange==null || ifRange.trim().equals(etag))) {
+			final long[] bounds = parseRange(range, size);
+			if (bounds==UNSATISFIABLE) {
+				final UHttpResponse response = UHttpResponse.error(416, "Range not satisfiable: "+range);
+				response.headers().set(UHttpHeaders.CONTENT_RANGE, "bytes */"+size);
+				return response;
+			}
+			if (bounds!=null) {
+				status = 206;
+				start = bounds[0];
+				length = bounds[1] - bounds[0] + 1;
+			}
+		}
+
+		final UHttpResponse response = new UHttpResponse(status);
+		setHeaders(response, etag, modified);
+		response.headers().set(UHttpHeaders.CONTENT_TYPE, contentType(file));
+		response.headers().set(UHttpHeaders.CONTENT_LENGTH, length);
+		if (status==206) response.headers().set(UHttpHeaders.CONTENT_RANGE, "bytes "+start+"-"+(start + length - 1)+"/"+size);
+		final Path source = file;
+		final long position = start;
+		final long count = length;
+		final Executor executor = executor();
+		response.setStreamer(new UHttpStreamer() {
+			@Override
+			public void stream( final UHttpStream stream ) {
+				executor.execute(new Runnable() {
+					@Override
+					public void run() {
+						final UFileRegion region;
+						try {
+							region = UFileRegion.open(source, position, count);
+						} catch (IOException e) {
+							// the header is sent, only closing the connection tells the client
+							LOG.warn("Failed to open a file", "file", source.toString(), e);
+							stream.channel().close();
+							return;
+						}
+						stream.write(region).addListener(new UFutureListener<Void>() {
+							@Override
+							public void complete( final UFuture<Void> future ) {
+								stream.end();
+							}
+						}, null);
+					}
+				});
+			}
+		});
+		return response;
+	}
+
+	/**
+	 * Resolves the given path below the root directory.
+	 */
+	private Path resolve( final String path ) throws UHttpException {
+		final Path file = root.resolve(path.startsWith("/") ? path.substring(1) : path).normalize();
+		if (!file.startsWith(root)) throw new UHttpException(404, "Not found: "+path);
+		// hidden files like .git are never served
+		for (final Path name : root.relativize(file)) {
+			if (name.toString().startsWith(".")) throw new UHttpException(404, "Not found: "+path);
+		}
+		return file;
+	}
+
+	/**
+	 * Sets the validators and the headers common to all responses of a file.
+	 */
+	private void setHeaders( final UHttpResponse response, final String etag, final long modified ) {
+		final UHttpHeaders headers = response.headers();
+		headers.set(UHttpHeaders.ETAG, etag);
+		headers.set(UHttpHeaders.LAST_MODIFIED, formatDate(modified));
+		headers.set(UHttpHeaders.ACCEPT_RANGES, "bytes");
+		final String cacheControl = this.cacheControl;
+		if (cacheControl!=null) headers.set(UHttpHeaders.CACHE_CONTROL, cacheControl);
+	}
+
+	/**
+	 * Returns true if the given If-None-Match value matches the tag, weak tags match as well.
+	 */
+	private static boolean matches( final String ifNoneMatch, final String etag ) {
+		for (String tag : ifNoneMatch.split(",")) {
+			tag = tag.trim();
+			if (tag.equals("*")) return true;
+			if (tag.startsWith("W/")) tag = tag.substring(2);
+			if (tag.equals(etag)) return true;
+		}
+		return false;
+	}
+
+	/**
+	 * Parses a Range header with a single byte range.
+	 * @param range
+	 * the value of the header.
+	 * @param size
+	 * the size of the file.
+	 * @return
+	 * the first and the last position, {@link #UNSATISFIABLE} if the range is outside of the file, or null if the
+	 * header is ignored, because it is invalid or requests multiple ranges.
+	 */
+	private static long[] parseRange( final String range, final long size ) {
+		final String value = range.trim();
+		if (!value.regionMatches(true, 0, "bytes=", 0, 6) || value.indexOf(',') >= 0) return null;
+		final String spec = value.substring(6).trim();
+		final int dash = spec.indexOf('-');
+		if (dash < 0) return null;
+		final long first, last;
+		try {
+			if (dash==0) {
+				// the last n bytes
+				final long n = Long.parseLong(spec.substring(1));
+				if (n <= 0) return UNSATISFIABLE;
+				first = Math.max(0, size - n);
+				last = size - 1;
+			} else {
+				first = Long.parseLong(spec.substring(0, dash));
+				if (dash==spec.length() - 1) {
+					last = size - 1;
+				} else {
+					final long end = Long.parseLong(spec.substring(dash + 1));
+					if (end < first) return null;
+					last = Math.min(size - 1, end);
+				}
+			}
+		} catch (NumberFormatException e) {
+			return null;
+		}
+		if (first >= size || size==0) return UNSATISFIABLE;
+		return new long[] { first, last };
+	}
+
+	/**
+	 * Formats the given time as HTTP date.
+	 */
+	private static String formatDate( final long millis ) {
+		final SimpleDateFormat format = new SimpleDateFormat("EEE, dd MMM yyyy HH:mm:ss 'GMT'", Locale.US);
+		format.setTimeZone(TimeZone.getTimeZone("GMT"));
+		return format.format(new Date(millis));
+	}
+
+	@Override
+	public String toString() {
+		return "UHttpFileHandler["+root+"]";
+	}
+
+	/**
+	 * The shared pool of daemon threads that runs the file system calls, if no executor is configured.
+	 */
+	private static final class DefaultExecutor {
+		static final ExecutorService INSTANCE = Executors.newCachedThreadPool(new ThreadFactory() {
+			private final AtomicInteger count = new AtomicInteger();
+
+			@Override
+			public Thread newThread( final Runnable r ) {
+				final Thread thread = new Thread(r, "file-task-"+count.incrementAndGet());
+				thread.setDaemon(true);
+				return thread;
+			}
+		});
+	}
+}
@@ -0,0 +1,24 @@
+package com.umpani.aio.http;
+
+import com.umpani.aio.UFuture;
+
+/**
+ * Handles HTTP requests, for example an {@link UHttpRouter} or a single route of it.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface UHttpHandler {
+	/**
+	 * Handles a request. The result is converted into the response: an {@link UHttpResponse} is sent as it is, a map
+	 * or a collection, usually an {@link com.umpani.util.UMap} or an {@link com.umpani.util.UList}, is sent as JSON,
+	 * a string as text, a byte array as binary body and null as <tt>204 No Content</tt>. A failure is answered with
+	 * an error response, using the status code of an {@link com.umpani.aio.exception.UHttpException}.
+	 * @param request
+	 * the request.
+	 * @return
+	 * the future of the result, null is the same as a future that succeeded with null.
+	 * @throws Exception
+	 * if handling failed.
+	 */
+	public UFuture<?> handle( final UHttpRequest request ) throws Exception;
+}
@@ -0,0 +1,364 @@
+package com.umpani.aio.http;
+
+import java.util.ArrayList;
+import java.util.List;
+
+/**
+ * The header fields of an HTTP message, a multimap with case-insensitive names. The fields keep the order in which
+ * they were added and the spelling of their names, so a message is written as it was received or built.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttpHeaders {
+	/**
+	 * The name of the Accept header.
+	 */
+	public static final String ACCEPT = "Accept";
+
+	/**
+	 * The name of the Accept-Encoding header.
+	 */
+	public static final String ACCEPT_ENCODING = "Accept-Encoding";
+
+	/**
+	 * The name of the Accept-Ranges header.
+	 */
+	public static final String ACCEPT_RANGES = "Accept-Ranges";
+
+	/**
+	 * The name of the Allow header.
+	 */
+	public static final String ALLOW = "Allow";
+
+	/**
+	 * The name of the Authorization header.
+	 */
+	public static final String AUTHORIZATION = "Authorization";
+
+	/**
+	 * The name of the Cache-Control header.
+	 */
+	public static final String CACHE_CONTROL = "Cache-Control";
+
+	/**
+	 * The name of the Connection header.
+	 */
+	public static final String CONNECTION = "Connection";
+
+	/**
+	 * The name of the Content-Encoding header.
+	 */
+	public static final String CONTENT_ENCODING = "Content-Encoding";
+
+	/**
+	 * The name of the Content-Length header.
+	 */
+	public static final String CONTENT_LENGTH = "Content-Length";
+
+	/**
+	 * The name of the Content-Range header.
+	 */
+	public static final String CONTENT_RANGE = "Content-Range";
+
+	/**
+	 * The name of the Content-Type header.
+	 */
+	public static final String CONTENT_TYPE = "Content-Type";
+
+	/**
+	 * The name of the Cookie header.
+	 */
+	public static final String COOKIE = "Cookie";
+
+	/**
+	 * The name of the ETag header.
+	 */
+	public static final String ETAG = "ETag";
+
+	/**
+	 * The name of the Expect header.
+	 */
+	public static final String EXPECT = "Expect";
+
+	/**
+	 * The name of the Host header.
+	 */
+	public static final String HOST = "Host";
+
+	/**
+	 * The name of the If-None-Match header.
+	 */
+	public static final String IF_NONE_MATCH = "If-None-Match";
+
+	/**
+	 * The name of the If-Range header.
+	 */
+	public static final String IF_RANGE = "If-Range";
+
+	/**
+	 * The name of the Last-Modified header.
+	 */
+	public static final String LAST_MODIFIED = "Last-Modified";
+
+	/**
+	 * The name of the Location header.
+	 */
+	public static final String LOCATION = "Location";
+
+	/**
+	 * The name of the Proxy-Authorization header.
+	 */
+	public static final String PROXY_AUTHORIZATION = "Proxy-Authorization";
+
+	/**
+	 * The name of the Range header.
+	 */
+	public static final String RANGE = "Range";
+
+	/**
+	 * The name of the Transfer-Encoding header.
+	 */
+	public static final String TRANSFER_ENCODING = "Transfer-Encoding";
+
+	/**
+	 * The name of the Upgrade header.
+	 */
+	public static final String UPGRADE = "Upgrade";
+
+	/**
+	 * The name of the Vary header.
+	 */
+	public static final String VARY = "Vary";
+
+
+	/**
+	 * Create new empty headers.
+	 */
+	public UHttpHeaders() {}
+
+	/**
+	 * The names and values, alternating.
+	 */
+	private final ArrayList<String> fields = new ArrayList<>();
+
+	/**
+	 * Returns the amount of fields.
+	 * @return
+	 * the amount of fields.
+	 */
+	public int size() {
+		return fields.size() >> 1;
+	}
+
+	/**
+	 * Returns true if there are no fields.
+	 * @return
+	 * true if there are no fields.
+	 */
+	public boolean isEmpty() {
+		return fields.isEmpty();
+	}
+
+	/**
+	 * Returns the name of the field at the given index.
+	 * @param index
+	 * the index of the field.
+	 * @return
+	 * the name.
+	 */
+	public String name( final int index ) {
+		return fields.get(index << 1);
+	}
+
+	/**
+	 * Returns the value of the field at the given index.
+	 * @param index
+	 * the index of the field.
+	 * @return
+	 * the value.
+	 */
+	public String value( final int index ) {
+		return fields.get((index << 1) + 1);
+	}
+
+	/**
+	 * Adds a field, keeping existing fields with the same name.
+	 * @param name
+	 * the name.
+	 * @param value
+	 * the value.
+	 * @return
+	 * this.
+	 * @throws IllegalArgumentException
+	 * if the name or the value contains line breaks.
+	 */
+	public UHttpHeaders add( final String name, final Object value ) {
+		final String v = String.valueOf(value);
+		if (name.indexOf('\n') >= 0 || name.indexOf('\r') >= 0 || v.indexOf('\n') >= 0 || v.indexOf('\r') >= 0) {
+			throw new IllegalArgumentException("Line break in header "+name);
+		}
+		fields.add(name);
+		fields.add(v);
+		return this;
+	}
+
+	/**
+	 * Sets a field, replacing all existing fields with the same name.
+	 * @param name
+	 * the name.
+	 * @param value
+	 * the value.
+	 * @return
+	 * this.
+	 */
+	public UHttpHeaders set( final String name, final Object value ) {
+		remove(name);
+		return add(name, value);
+	}
+
+	/**
+	 * Removes all fields with the given name.
+	 * @param name
+	 * the name.
+	 * @return
+	 * true if any field was removed.
+	 */
+	public boolean remove( final String name ) {
+		boolean removed = false;
+		for (int i=fields.size() - 2; i >= 0; i-=2) {
+			if (fields.get(i).equalsIgnoreCase(name)) {
+				fields.remove(i + 1);
+				fields.remove(i);
+				removed = true;
+			}
+		}
+		return removed;
+	}
+
+	/**
+	 * Removes all fields.
+	 */
+	public void clear() {
+		fields.clear();
+	}
+
+	/**
+	 * Returns true if there is a field with the given name.
+	 * @param name
+	 * the name.
+	 * @return
+	 * true if there is a field with the given name.
+	 */
+	public boolean contains( final String name ) {
+		return get(name)!=null;
+	}
+
+	/**
+	 * Returns true if any field with the given name holds the given token in its comma separated value, ignoring the
+	 * case, for example <tt>contains("Connection", "close")</tt>.
+	 * @param name
+	 * the name.
+	 * @param token
+	 * the token.
+	 * @return
+	 * true if the token was found.
+	 */
+	public boolean contains( final String name, final String token ) {
+		for (int i=0; i < fields.size(); i+=2) {
+			if (!fields.get(i).equalsIgnoreCase(name)) continue;
+			for (final String part : fields.get(i + 1).split(",")) {
+				if (part.trim().equalsIgnoreCase(token)) return true;
+			}
+		}
+		return false;
+	}
+
+	/**
+	 * Returns the value of the first field with the given name.
+	 * @param name
+	 * the name.
+	 * @return
+	 * the value or null, if there is no such field.
+	 */
+	public String get( final String name ) {
+		for (int i=0; i < fields.size(); i+=2) {
+			if (fields.get(i).equalsIgnoreCase(name)) return fields.get(i + 1);
+		}
+		return null;
+	}
+
+	/**
+	 * Returns the value of the first field with the given name.
+	 * @param name
+	 * the name.
+	 * @param defaultValue
+	 * the value to return if there is no such field.
+	 * @return
+	 * the value or the default value.
+	 */
+	public String get( final String name, final String defaultValue ) {
+		final String value = get(name);
+		return value!=null ? value : defaultValue;
+	}
+
+	/**
+	 * Returns the values of all fields with the given name.
+	 * @param name
+	 * the name.
+	 * @return
+	 * the values, an empty list if there is no such field.
+	 */
+	public List<String> getAll( final String name ) {
+		final ArrayList<String> values = new ArrayList<>(2);
+		for (int i=0; i < fields.size(); i+=2) {
+			if (fields.get(i).equalsIgnoreCase(name)) values.add(fields.get(i + 1));
+		}
+		return values;
+	}
+
+	/**
+	 * Returns the value of the first field with the given name as number.
+	 * @param name
+	 * the name.
+	 * @param defaultValue
+	 * the value to return if there is no such field or the value is no number.
+	 * @return
+	 * the value or the default value.
+	 */
+	public long getLong( final String name, final long defaultValue ) {
+		final String value = get(name);
+		if (value==null) return defaultValue;
+		try {
+			return Long.parseLong(value.trim());
+		} catch (NumberFormatException e) {
+			return defaultValue;
+		}
+	}
+
+	/**
+	 * Returns the distinct names of all fields, in the order of their first occurrence.
+	 * @return
+	 * the names.
+	 */
+	public List<String> names() {
+		final ArrayList<String> names = new ArrayList<>(size());
+		outer:
+		for (int i=0; i < fields.size(); i+=2) {
+			final String name = fields.get(i);
+			for (final String n : names) {
+				if (n.equalsIgnoreCase(name)) continue outer;
+			}
+			names.add(name);
+		}
+		return names;
+	}
+
+	@Override
+	public String toString() {
+		final StringBuilder sb = new StringBuilder();
+		for (int i=0; i < fields.size(); i+=2) {
+			sb.append(fields.get(i)).append(": ").append(fields.get(i + 1)).append("\r\n");
+		}
+		return sb.toString();
+	}
+}
@@ -0,0 +1,260 @@
+package com.umpani.aio.http;
+
+import java.nio.charset.Charset;
+import java.nio.charset.StandardCharsets;
+
+import com.umpani.util.exception.UJsonException;
+import com.umpani.util.json.UJsonReader;
+import com.umpani.util.json.UJsonWriter;
+
+/**
+ * The base class of HTTP requests and responses, which holds the version, the header fields and the body. The body
+ * is either held completely in memory or, if an {@link UHttpStreamer} is set, streamed once the header was written,
+ * which allows to send bodies of unknown length. JSON bodies are converted from and to {@link com.umpani.util.UMap}
+ * and {@link com.umpani.util.UList} with {@link #json()} and {@link #setJson(Object)}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public abstract class UHttpMessage {
+	/**
+	 * The version HTTP/1.0.
+	 */
+	public static final String HTTP_1_0 = "HTTP/1.0";
+
+	/**
+	 * The version HTTP/1.1.
+	 */
+	public static final String HTTP_1_1 = "HTTP/1.1";
+
+	/**
+	 * The version HTTP/2, set for messages received with HTTP/2.
+	 */
+	public static final String HTTP_2 = "HTTP/2.0";
+
+	/**
+	 * The media type of JSON.
+	 */
+	public static final String APPLICATION_JSON = "application/json";
+
+	/**
+	 * An empty body.
+	 */
+	static final byte[] EMPTY = new byte[0];
+
+	/**
+	 * Create a new message.
+	 * @param version
+	 * the protocol version.
+	 */
+	protected UHttpMessage( final String version ) {
+		if (version==null) throw new NullPointerException("version");
+		this.version = version;
+	}
+
+	/**
+	 * The protocol version.
+	 */
+	private String version;
+
+	/**
+	 * The header fields.
+	 */
+	private final UHttpHeaders headers = new UHttpHeaders();
+
+	/**
+	 * The body.
+	 */
+	private byte[] body = EMPTY;
+
+	/**
+	 * The parsed JSON body, cached by {@link #json()}.
+	 */
+	private Object json;
+
+	/**
+	 * The streamer of the body or null.
+	 */
+	private UHttpStreamer streamer;
+
+	/**
+	 * True if the body is not written, because the message answers a HEAD request.
+	 */
+	boolean omitBody;
+
+	/**
+	 * True if the body is not held by the message, but passed on by the decoder in {@link UHttpChunk}s.
+	 */
+	boolean bodyFollows;
+
+	/**
+	 * Returns the protocol version.
+	 * @return
+	 * the protocol version, for example <tt>HTTP/1.1</tt>.
+	 */
+	public String version() {
+		return version;
+	}
+
+	/**
+	 * Sets the protocol version.
+	 * @param version
+	 * the protocol version.
+	 * @return
+	 * this.
+	 */
+	public UHttpMessage setVersion( final String version ) {
+		if (version==null) throw new NullPointerException("version");
+		this.version = version;
+		return this;
+	}
+
+	/**
+	 * Returns the header fields.
+	 * @return
+	 * the header fields.
+	 */
+	public UHttpHeaders headers() {
+		return headers;
+	}
+
+	/**
+	 * Returns true if the connection should be kept alive after this message, which is the default for HTTP/1.1 and
+	 * must be requested explicitly for HTTP/1.0.
+	 * @return
+	 * true if the connection should be kept alive.
+	 */
+	public boolean isKeepAlive() {
+		if (headers.contains(UHttpHeaders.CONNECTION, "close")) return false;
+		if (HTTP_1_0.equals(version)) return headers.contains(UHttpHeaders.CONNECTION, "keep-alive");
+		return true;
+	}
+
+	/**
+	 * Returns the body.
+	 * @return
+	 * the body, an empty array if the message has no body.
+	 */
+	public byte[] body() {
+		return body;
+	}
+
+	/**
+	 * Sets the body.
+	 * @param body
+	 * the body, null for an empty body.
+	 * @return
+	 * this.
+	 */
+	public UHttpMessage setBody( final byte[] body ) {
+		this.body = body!=null ? body : EMPTY;
+		this.json = null;
+		return this;
+	}
+
+	/**
+	 * Sets the body to the given text encoded as UTF-8 and, if no content type is set, the content type to
+	 * <tt>text/plain</tt>.
+	 * @param text
+	 * the text.
+	 * @return
+	 * this.
+	 */
+	public UHttpMessage setBody( final String text ) {
+		if (!headers.contains(UHttpHeaders.CONTENT_TYPE)) headers.set(UHttpHeaders.CONTENT_TYPE, "text/plain; charset=utf-8");
+		return setBody(text.getBytes(StandardCharsets.UTF_8));
+	}
+
+	/**
+	 * Returns the body as text, decoded with the charset of the content type or UTF-8, if none is given.
+	 * @return
+	 * the body as text.
+	 */
+	public String bodyAsString() {
+		return new String(body, charset());
+	}
+
+	/**
+	 * Returns the charset given in the content type.
+	 * @return
+	 * the charset, UTF-8 if the content type has no or an unknown charset.
+	 */
+	public Charset charset() {
+		final String type = headers.get(UHttpHeaders.CONTENT_TYPE);
+		if (type!=null) {
+			for (final String param : type.split(";")) {
+				final String p = param.trim();
+				if (p.regionMatches(true, 0, "charset=", 0, 8)) {
+					try {
+						return Charset.forName(p.substring(8).replace("\"", "").trim());
+					} catch (IllegalArgumentException e) {
+						break;
+					}
+				}
+			}
+		}
+		return StandardCharsets.UTF_8;
+	}
+
+	/**
+	 * Returns true if the content type is JSON, either <tt>application/json</tt> or a type with the <tt>+json</tt>
+	 * suffix.
+	 * @return
+	 * true if the content type is JSON.
+	 */
+	public boolean isJson() {
+		final String type = headers.get(UHttpHeaders.CONTENT_TYPE);
+		if (type==null) return false;
+		final int end = type.indexOf(';');
+		final String mediaType = (end < 0 ? type : type.substring(0, end)).trim().toLowerCase();
+		return mediaType.equals(APPLICATION_JSON) || mediaType.endsWith("+json");
+	}
+
+	/**
+	 * Parses the body as JSON, regardless of the content type.
+	 * @return
+	 * the parsed body, an {@link com.umpani.util.UMap} for an object, an {@link com.umpani.util.UList} for an array or
+	 * null if the body is empty.
+	 * @throws UJsonException
+	 * if the body is no valid JSON.
+	 */
+	public Object json() throws UJsonException {
+		if (json==null && body.length > 0) json = UJsonReader.parse(bodyAsString());
+		return json;
+	}
+
+	/**
+	 * Sets the body to the given value serialized as JSON and the content type to <tt>application/json</tt>.
+	 * @param value
+	 * the value, usually an {@link com.umpani.util.UMap} or an {@link com.umpani.util.UList}.
+	 * @return
+	 * this.
+	 */
+	public UHttpMessage setJson( final Object value ) {
+		headers.set(UHttpHeaders.CONTENT_TYPE, APPLICATION_JSON);
+		setBody(UJsonWriter.toJson(value).getBytes(StandardCharsets.UTF_8));
+		json = value;
+		return this;
+	}
+
+	/**
+	 * Returns the streamer of the body.
+	 * @return
+	 * the streamer or null, if the body is held in memory.
+	 */
+	public UHttpStreamer streamer() {
+		return streamer;
+	}
+
+	/**
+	 * Sets the streamer of the body. If no <tt>Content-Length</tt> is set, the body is sent with chunked transfer
+	 * encoding or, for HTTP/1.0, until the connection is closed.
+	 * @param streamer
+	 * the streamer or null, if the body is held in memory.
+	 * @return
+	 * this.
+	 */
+	public UHttpMessage setStreamer( final UHttpStreamer streamer ) {
+		this.streamer = streamer;
+		return this;
+	}
+}
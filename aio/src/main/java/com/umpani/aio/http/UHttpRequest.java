@@ -0,0 +1,198 @@
+package com.umpani.aio.http;
+
+import java.io.UnsupportedEncodingException;
+import java.net.URLDecoder;
+import java.util.ArrayList;
+import java.util.Collections;
+import java.util.List;
+import java.util.Map;
+
+/**
+ * An HTTP request. The request target is split into the path and the query, the parameters of the query are decoded
+ * on demand. The parameters of the path are set by the {@link UHttpRouter} that matched the request.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttpRequest extends UHttpMessage {
+	/**
+	 * Create a new HTTP/1.1 request.
+	 * @param method
+	 * the method, for example <tt>GET</tt>.
+	 * @param uri
+	 * the request target, for example <tt>/users?name=x</tt>.
+	 */
+	public UHttpRequest( final String method, final String uri ) {
+		this(method, uri, HTTP_1_1);
+	}
+
+	/**
+	 * Create a new request.
+	 * @param method
+	 * the method, for example <tt>GET</tt>.
+	 * @param uri
+	 * the request target, for example <tt>/users?name=x</tt>.
+	 * @param version
+	 * the protocol version.
+	 */
+	public UHttpRequest( final String method, final String uri, final String version ) {
+		super(version);
+		if (method==null) throw new NullPointerException("method");
+		if (uri==null) throw new NullPointerException("uri");
+		this.method = method;
+		this.uri = uri;
+	}
+
+	/**
+	 * The method.
+	 */
+	private final String method;
+
+	/**
+	 * The request target.
+	 */
+	private final String uri;
+
+	/**
+	 * The parameters of the path or null.
+	 */
+	private Map<String,String> pathParameters;
+
+	/**
+	 * Returns the method.
+	 * @return
+	 * the method, for example <tt>GET</tt>.
+	 */
+	public String method() {
+		return method;
+	}
+
+	/**
+	 * Returns the request target.
+	 * @return
+	 * the request target as received.
+	 */
+	public String uri() {
+		return uri;
+	}
+
+	/**
+	 * Returns the path of the request target.
+	 * @return
+	 * the path, still percent-encoded.
+	 */
+	public String path() {
+		final int end = uri.indexOf('?');
+		return end < 0 ? uri : uri.substring(0, end);
+	}
+
+	/**
+	 * Returns the query of the request target.
+	 * @return
+	 * the query without the question mark, still percent-encoded, or null, if the target has no query.
+	 */
+	public String query() {
+		final int start = uri.indexOf('?');
+		return start < 0 ? null : uri.substring(start + 1);
+	}
+
+	/**
+	 * Returns the first value of the given query parameter.
+	 * @param name
+	 * the name of the parameter.
+	 * @return
+	 * the decoded value, an empty string if the parameter has no value, or null if there is no such parameter.
+	 */
+	public String getQueryParameter( final String name ) {
+		final List<String> values = getQueryParameters(name);
+		return values.isEmpty() ? null : values.get(0);
+	}
+
+	/**
+	 * Returns all values of the given query parameter.
+	 * @param name
+	 * the name of the parameter.
+	 * @return
+	 * the decoded values, an empty list if there is no such parameter.
+	 */
+	public List<String> getQueryParameters( final String name ) {
+		final String query = query();
+		if (query==null || query.isEmpty()) return Collections.emptyList();
+		final ArrayList<String> values = new ArrayList<>(1);
+		for (final String pair : query.split("&")) {
+			final int eq = pair.indexOf('=');
+			final String key = decode(eq < 0 ? pair : pair.substring(0, eq));
+			if (key.equals(name)) values.add(eq < 0 ? "" : decode(pair.substring(eq + 1)));
+		}
+		return values;
+	}
+
+	/**
+	 * Returns the value of the given path parameter.
+	 * @param name
+	 * the name of the parameter as given in the route pattern.
+	 * @return
+	 * the decoded value or null, if there is no such parameter.
+	 */
+	public String getPathParameter( final String name ) {
+		final Map<String,String> pathParameters = this.pathParameters;
+		return pathParameters!=null ? pathParameters.get(name) : null;
+	}
+
+	/**
+	 * Sets the parameters of the path, called by the router.
+	 */
+	final void setPathParameters( final Map<String,String> pathParameters ) {
+		this.pathParameters = pathParameters;
+	}
+
+	@Override
+	public UHttpRequest setVersion( final String version ) {
+		super.setVersion(version);
+		return this;
+	}
+
+	@Override
+	public UHttpRequest setBody( final byte[] body ) {
+		super.setBody(body);
+		return this;
+	}
+
+	@Override
+	public UHttpRequest setBody( final String text ) {
+		super.setBody(text);
+		return this;
+	}
+
+	@Override
+	public UHttpRequest setJson( final Object value ) {
+		super.setJson(value);
+		return this;
+	}
+
+	@Override
+	public UHttpRequest setStreamer( final UHttpStreamer streamer ) {
+		super.setStreamer(streamer);
+		return this;
+	}
+
+	/**
+	 * Decodes a percent-encoded part of a query, where a plus is a space.
+	 * @param s
+	 * the encoded string.
+	 * @return
+	 * the decoded string, the string itself, if it is not correctly encoded.
+	 */
+	static String decode( final String s ) {
+		if (s.indexOf('%') < 0 && s.indexOf('+') < 0) return s;
+		try {
+			return URLDecoder.decode(s, "UTF-8");
+		} catch (UnsupportedEncodingException | IllegalArgumentException e) {
+			return s;
+		}
+	}
+
+	@Override
+	public String toString() {
+		return method+" "+uri+" "+version();
+	}
+}
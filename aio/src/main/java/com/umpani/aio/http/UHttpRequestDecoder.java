@@ -0,0 +1,63 @@
+package com.umpani.aio.http;
+
+import java.nio.charset.StandardCharsets;
+
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.exception.UHttpException;
+
+/**
+ * Decodes HTTP/1.x requests into {@link UHttpRequest}s. A request with <tt>Expect: 100-continue</tt> is answered with
+ * an interim <tt>100 Continue</tt> response, once its header was accepted, so that the client sends the body. A
+ * request with <tt>Transfer-Encoding</tt> must have chunked as its last coding and no <tt>Content-Length</tt>,
+ * otherwise it is rejected with status 400.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttpRequestDecoder extends UHttpDecoder {
+	/**
+	 * The interim response that asks the client to send the body.
+	 */
+	private static final byte[] CONTINUE = "HTTP/1.1 100 Continue\r\n\r\n".getBytes(StandardCharsets.ISO_8859_1);
+
+	/**
+	 * Create a new decoder with the default limits.
+	 */
+	public UHttpRequestDecoder() {
+		this(DEFAULT_MAX_HEADER_SIZE, DEFAULT_MAX_BODY_SIZE);
+	}
+
+	/**
+	 * Create a new decoder.
+	 * @param maxHeaderSize
+	 * the maximal size of the request line and the header fields in bytes.
+	 * @param maxBodySize
+	 * the maximal size of the body in bytes.
+	 */
+	public UHttpRequestDecoder( final int maxHeaderSize, final int maxBodySize ) {
+		super(maxHeaderSize, maxBodySize);
+	}
+
+	@Override
+	protected UHttpMessage createMessage( final String[] initialLine ) throws UHttpException {
+		if (initialLine.length < 3) throw fail(400, "Invalid request line");
+		final String method = initialLine[0];
+		for (int i=0; i < method.length(); i++) {
+			final char c = method.charAt(i);
+			if (c <= ' ' || c >= 127) throw fail(400, "Invalid method");
+		}
+		final String uri = initialLine[1];
+		if (uri.isEmpty() || uri.indexOf(' ') >= 0) throw fail(400, "Invalid request target");
+		final String version = initialLine[2];
+		if (!version.startsWith("HTTP/")) throw fail(400, "Invalid version");
+		if (!version.equals(UHttpMessage.HTTP_1_1) && !version.equals(UHttpMessage.HTTP_1_0)) throw fail(505, "Unsupported version "+version);
+		return new UHttpRequest(method, uri, version);
+	}
+
+	@Override
+	protected void headersReceived( final UHandlerContext ctx, final UHttpMessage message, final boolean hasBody ) throws Exception {
+		final String expect = message.headers().get(UHttpHeaders.EXPECT);
+		if (expect==null || UHttpMessage.HTTP_1_0.equals(message.version())) return;
+		if (!expect.trim().equalsIgnoreCase("100-continue")) throw fail(417, "Unsupported expectation: "+expect);
+		if (hasBody) ctx.writeAndFlush(CONTINUE.clone());
+	}
+}
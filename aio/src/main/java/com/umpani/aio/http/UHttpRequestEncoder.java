@@ -0,0 +1,26 @@
+package com.umpani.aio.http;
+
+import com.umpani.aio.UBufferOutputStream;
+
+/**
+ * Encodes {@link UHttpRequest}s and the chunks of streamed request bodies.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttpRequestEncoder extends UHttpEncoder {
+	/**
+	 * Create a new encoder.
+	 */
+	public UHttpRequestEncoder() {}
+
+	@Override
+	protected boolean accept( final Object msg ) {
+		return msg instanceof UHttpRequest || msg instanceof UHttpChunk;
+	}
+
+	@Override
+	protected void encodeStartLine( final UHttpMessage message, final UBufferOutputStream out ) {
+		final UHttpRequest request = (UHttpRequest)message;
+		out.append(request.method()).append(' ').append(request.uri()).append(' ').append(request.version());
+	}
+}
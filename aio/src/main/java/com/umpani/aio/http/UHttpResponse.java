@@ -0,0 +1,311 @@
+package com.umpani.aio.http;
+
+import java.util.Collection;
+import java.util.Map;
+
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.exception.UHttpException;
+import com.umpani.util.UMap;
+import com.umpani.util.exception.UJsonException;
+
+/**
+ * An HTTP response with status code and reason phrase.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttpResponse extends UHttpMessage {
+	/**
+	 * Create a new HTTP/1.1 response with status 200.
+	 */
+	public UHttpResponse() {
+		this(200);
+	}
+
+	/**
+	 * Create a new HTTP/1.1 response with the default reason phrase.
+	 * @param status
+	 * the status code.
+	 */
+	public UHttpResponse( final int status ) {
+		this(status, reasonPhrase(status));
+	}
+
+	/**
+	 * Create a new HTTP/1.1 response.
+	 * @param status
+	 * the status code.
+	 * @param reason
+	 * the reason phrase.
+	 */
+	public UHttpResponse( final int status, final String reason ) {
+		super(HTTP_1_1);
+		setStatus(status, reason);
+	}
+
+	/**
+	 * The status code.
+	 */
+	private int status;
+
+	/**
+	 * The reason phrase.
+	 */
+	private String reason;
+
+	/**
+	 * The initializer of the protocol the connection switches to or null.
+	 */
+	private UChannelInitializer upgrade;
+
+	/**
+	 * Returns a response with the given value as JSON body.
+	 * @param status
+	 * the status code.
+	 * @param value
+	 * the value, usually an {@link UMap} or an {@link com.umpani.util.UList}.
+	 * @return
+	 * the response.
+	 */
+	public static UHttpResponse json( final int status, final Object value ) {
+		return new UHttpResponse(status).setJson(value);
+	}
+
+	/**
+	 * Returns a response with the given text as body.
+	 * @param status
+	 * the status code.
+	 * @param text
+	 * the text.
+	 * @return
+	 * the response.
+	 */
+	public static UHttpResponse text( final int status, final String text ) {
+		return new UHttpResponse(status).setBody(text);
+	}
+
+	/**
+	 * Returns an error response with a JSON body like <tt>{"status":404,"error":"Not Found"}</tt>.
+	 * @param status
+	 * the status code.
+	 * @param message
+	 * the error message or null to use the reason phrase.
+	 * @return
+	 * the response.
+	 */
+	public static UHttpResponse error( final int status, final String message ) {
+		return json(status, UMap.of(String.class, Object.class, "status", status, "error", message!=null ? message : reasonPhrase(status)));
+	}
+
+	/**
+	 * Converts the result of an {@link UHttpHandler} into a response: null is answered with 204, maps and
+	 * collections as JSON, character sequences as text and byte arrays as <tt>application/octet-stream</tt>.
+	 * @param result
+	 * the result.
+	 * @return
+	 * the response.
+	 * @throws IllegalStateException
+	 * if the type of the result is not supported.
+	 */
+	public static UHttpResponse forResult( final Object result ) {
+		if (result==null) return new UHttpResponse(204);
+		if (result instanceof UHttpResponse) return (UHttpResponse)result;
+		if (result instanceof Map || result instanceof Collection) return json(200, result);
+		if (result instanceof CharSequence) return text(200, result.toString());
+		if (result instanceof byte[]) {
+			final UHttpResponse response = new UHttpResponse(200).setBody((byte[])result);
+			response.headers().set(UHttpHeaders.CONTENT_TYPE, "application/octet-stream");
+			return response;
+		}
+		throw new IllegalStateException("Unsupported result type: "+result.getClass().getName());
+	}
+
+	/**
+	 * Converts a failure of an {@link UHttpHandler} into an error response. An {@link UHttpException} is answered
+	 * with its status code, invalid JSON with 400 and any other exception with 500.
+	 * @param cause
+	 * the failure.
+	 * @return
+	 * the response.
+	 */
+	public static UHttpResponse forFailure( final Throwable cause ) {
+		if (cause instanceof UHttpException) return error(((UHttpException)cause).getStatus(), cause.getMessage());
+		if (cause instanceof UJsonException) return error(400, "Invalid JSON: "+cause.getMessage());
+		return error(500, null);
+	}
+
+	/**
+	 * Returns true if the given failure is expected, so that its error response needs no logging.
+	 * @param cause
+	 * the failure.
+	 * @return
+	 * true for an {@link UHttpException} or invalid JSON.
+	 */
+	public static boolean isExpectedFailure( final Throwable cause ) {
+		return cause instanceof UHttpException || cause instanceof UJsonException;
+	}
+
+	/**
+	 * Returns the status code.
+	 * @return
+	 * the status code.
+	 */
+	public int status() {
+		return status;
+	}
+
+	/**
+	 * Returns the reason phrase.
+	 * @return
+	 * the reason phrase.
+	 */
+	public String reason() {
+		return reason;
+	}
+
+	/**
+	 * Sets the status code and the default reason phrase.
+	 * @param status
+	 * the status code.
+	 * @return
+	 * this.
+	 */
+	public UHttpResponse setStatus( final int status ) {
+		return setStatus(status, reasonPhrase(status));
+	}
+
+	/**
+	 * Sets the status code and the reason phrase.
+	 * @param status
+	 * the status code.
+	 * @param reason
+	 * the reason phrase.
+	 * @return
+	 * this.
+	 */
+	public UHttpResponse setStatus( final int status, final String reason ) {
+		if (status < 100 || status > 999) throw new IllegalArgumentException("status: "+status);
+		this.status = status;
+		this.reason = reason!=null ? reason : "";
+		return this;
+	}
+
+	/**
+	 * Returns the initializer of the protocol the connection switches to.
+	 * @return
+	 * the initializer or null.
+	 */
+	public UChannelInitializer upgrade() {
+		return upgrade;
+	}
+
+	/**
+	 * Switches the connection to another protocol once this response was written, the status is set to 101. The
+	 * HTTP handlers are removed from the pipeline and the given initializer adds the handlers of the new protocol,
+	 * bytes received after the request are passed to them.
+	 * @param upgrade
+	 * the initializer of the new protocol.
+	 * @return
+	 * this.
+	 */
+	public UHttpResponse setUpgrade( final UChannelInitializer upgrade ) {
+		this.upgrade = upgrade;
+		if (upgrade!=null) setStatus(101);
+		return this;
+	}
+
+	/**
+	 * Returns true if a response with the given status never has a body.
+	 * @param status
+	 * the status code.
+	 * @return
+	 * true for informational responses, 204 and 304.
+	 */
+	public static boolean isContentAlwaysEmpty( final int status ) {
+		return status < 200 || status==204 || status==304;
+	}
+
+	@Override
+	public UHttpResponse setVersion( final String version ) {
+		super.setVersion(version);
+		return this;
+	}
+
+	@Override
+	public UHttpResponse setBody( final byte[] body ) {
+		super.setBody(body);
+		return this;
+	}
+
+	@Override
+	public UHttpResponse setBody( final String text ) {
+		super.setBody(text);
+		return this;
+	}
+
+	@Override
+	public UHttpResponse setJson( final Object value ) {
+		super.setJson(value);
+		return this;
+	}
+
+	@Override
+	public UHttpResponse setStreamer( final UHttpStreamer streamer ) {
+		super.setStreamer(streamer);
+		return this;
+	}
+
+	/**
+	 * Returns the default reason phrase of the given status code.
+	 * @param status
+	 * the status code.
+	 * @return
+	 * the reason phrase, an empty string for unknown codes.
+	 */
+	public static String reasonPhrase( final int status ) {
+		switch (status) {
+			case 100: return "Continue";
+			case 101: return "Switching Protocols";
+			case 200: return "OK";
+			case 201: return "Created";
+			case 202: return "Accepted";
+			case 204: return "No Content";
+			case 206: return "Partial Content";
+			case 301: return "Moved Permanently";
+			case 302: return "Found";
+			case 303: return "See Other";
+			case 304: return "Not Modified";
+			case 307: return "Temporary Redirect";
+			case 308: return "Permanent Redirect";
+			case 400: return "Bad Request";
+			case 401: return "Unauthorized";
+			case 403: return "Forbidden";
+			case 404: return "Not Found";
+			case 405: return "Method Not Allowed";
+			case 406: return "Not Acceptable";
+			case 408: return "Request Timeout";
+			case 409: return "Conflict";
+			case 410: return "Gone";
+			case 411: return "Length Required";
+			case 413: return "Payload Too Large";
+			case 414: return "URI Too Long";
+			case 415: return "Unsupported Media Type";
+			case 416: return "Range Not Satisfiable";
+			case 417: return "Expectation Failed";
+			case 426: return "Upgrade Required";
+			case 429: return "Too Many Requests";
+			case 431: return "Request Header Fields Too Large";
+			case 500: return "Internal Server Error";
+			case 501: return "Not Implemented";
+			case 502: return "Bad Gateway";
+			case 503: return "Service Unavailable";
+			case 504: return "Gateway Timeout";
+			case 505: return "HTTP Version Not Supported";
+			default: return "";
+		}
+	}
+
+	@Override
+	public String toString() {
+		return version()+" "+status+" "+reason;
+	}
+}
@@ -0,0 +1,61 @@
+package com.umpani.aio.http;
+
+import com.umpani.aio.exception.UHttpException;
+
+/**
+ * Decodes HTTP/1.x responses into {@link UHttpResponse}s. A response without <tt>Content-Length</tt> and without
+ * chunked transfer encoding ends with the connection.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttpResponseDecoder extends UHttpDecoder {
+	/**
+	 * Create a new decoder with the default limits.
+	 */
+	public UHttpResponseDecoder() {
+		this(DEFAULT_MAX_HEADER_SIZE, DEFAULT_MAX_BODY_SIZE);
+	}
+
+	/**
+	 * Create a new decoder.
+	 * @param maxHeaderSize
+	 * the maximal size of the status line and the header fields in bytes.
+	 * @param maxBodySize
+	 * the maximal size of a body held in memory in bytes.
+	 */
+	public UHttpResponseDecoder( final int maxHeaderSize, final int maxBodySize ) {
+		super(maxHeaderSize, maxBodySize);
+	}
+
+	@Override
+	protected UHttpMessage createMessage( final String[] initialLine ) throws UHttpException {
+		final String version = initialLine[0];
+		if (!version.equals(UHttpMessage.HTTP_1_1) && !version.equals(UHttpMessage.HTTP_1_0)) throw fail(505, "Unsupported version "+version);
+		if (initialLine.length < 2) throw fail(400, "Invalid status line");
+		final int status;
+		try {
+			status = Integer.parseInt(initialLine[1]);
+		} catch (NumberFormatException e) {
+			throw fail(400, "Invalid status code");
+		}
+		if (status < 100 || status > 999) throw fail(400, "Invalid status code");
+		final UHttpResponse response = new UHttpResponse(status, initialLine.length > 2 ? initialLine[2] : "");
+		response.setVersion(version);
+		return response;
+	}
+
+	@Override
+	protected boolean isContentAlwaysEmpty( final UHttpMessage message ) {
+		return UHttpResponse.isContentAlwaysEmpty(((UHttpResponse)message).status());
+	}
+
+	@Override
+	protected boolean isUpgrade( final UHttpMessage message ) {
+		return ((UHttpResponse)message).status()==101;
+	}
+
+	@Override
+	protected boolean isReadUntilClose( final UHttpMessage message ) {
+		return true;
+	}
+}
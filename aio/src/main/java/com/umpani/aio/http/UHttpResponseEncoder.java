@@ -0,0 +1,31 @@
+package com.umpani.aio.http;
+
+import com.umpani.aio.UBufferOutputStream;
+
+/**
+ * Encodes {@link UHttpResponse}s and the chunks of streamed response bodies.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttpResponseEncoder extends UHttpEncoder {
+	/**
+	 * Create a new encoder.
+	 */
+	public UHttpResponseEncoder() {}
+
+	@Override
+	protected boolean accept( final Object msg ) {
+		return msg instanceof UHttpResponse || msg instanceof UHttpChunk;
+	}
+
+	@Override
+	protected boolean isContentAlwaysEmpty( final UHttpMessage message ) {
+		return UHttpResponse.isContentAlwaysEmpty(((UHttpResponse)message).status());
+	}
+
+	@Override
+	protected void encodeStartLine( final UHttpMessage message, final UBufferOutputStream out ) {
+		final UHttpResponse response = (UHttpResponse)message;
+		out.append(response.version()).append(' ').append(Integer.toString(response.status())).append(' ').append(response.reason());
+	}
+}
@@ -0,0 +1,221 @@
+package com.umpani.aio.http;
+
+import java.util.ArrayList;
+import java.util.HashMap;
+import java.util.concurrent.CopyOnWriteArrayList;
+
+import com.umpani.aio.UFuture;
+import com.umpani.aio.exception.UHttpException;
+
+/**
+ * Routes requests by method and path to handlers. A pattern is a path whose segments are either literals, parameters
+ * in braces like <tt>/users/{id}</tt>, which match exactly one segment, or a final <tt>*</tt>, which matches the rest
+ * of the path. The values of the parameters are available with {@link UHttpRequest#getPathParameter(String)}, the
+ * rest of the path by the name <tt>*</tt>. Routes are matched in the order in which they were added.
+ *
+ * </p><p>A request for which no route matches is answered with <tt>404 Not Found</tt>; if routes match the path, but
+ * not the method, it is answered with <tt>405 Method Not Allowed</tt>. HEAD requests are served by GET routes, if no
+ * HEAD route matches.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttpRouter implements UHttpHandler {
+	/**
+	 * Create a new router without routes.
+	 */
+	public UHttpRouter() {}
+
+	/**
+	 * The routes.
+	 */
+	private final CopyOnWriteArrayList<Route> routes = new CopyOnWriteArrayList<>();
+
+	/**
+	 * Adds a route.
+	 * @param method
+	 * the method, for example <tt>GET</tt>.
+	 * @param pattern
+	 * the path pattern, for example <tt>/users/{id}</tt>.
+	 * @param handler
+	 * the handler.
+	 * @return
+	 * this.
+	 * @throws IllegalArgumentException
+	 * if the pattern is invalid.
+	 */
+	public UHttpRouter add( final String method, final String pattern, final UHttpHandler handler ) {
+		if (method==null) throw new NullPointerException("method");
+		if (handler==null) throw new NullPointerException("handler");
+		routes.add(new Route(method, pattern, handler));
+		return this;
+	}
+
+	/**
+	 * Adds a GET route.
+	 * @param pattern
+	 * the path pattern.
+	 * @param handler
+	 * the handler.
+	 * @return
+	 * this.
+	 */
+	public UHttpRouter get( final String pattern, final UHttpHandler handler ) {
+		return add("GET", pattern, handler);
+	}
+
+	/**
+	 * Adds a POST route.
+	 * @param pattern
+	 * the path pattern.
+	 * @param handler
+	 * the handler.
+	 * @return
+	 * this.
+	 */
+	public UHttpRouter post( final String pattern, final UHttpHandler handler ) {
+		return add("POST", pattern, handler);
+	}
+
+	/**
+	 * Adds a PUT route.
+	 * @param pattern
+	 * the path pattern.
+	 * @param handler
+	 * the handler.
+	 * @return
+	 * this.
+	 */
+	public UHttpRouter put( final String pattern, final UHttpHandler handler ) {
+		return add("PUT", pattern, handler);
+	}
+
+	/**
+	 * Adds a DELETE route.
+	 * @param pattern
+	 * the path pattern.
+	 * @param handler
+	 * the handler.
+	 * @return
+	 * this.
+	 */
+	public UHttpRouter delete( final String pattern, final UHttpHandler handler ) {
+		return add("DELETE", pattern, handler);
+	}
+
+	@Override
+	public UFuture<?> handle( final UHttpRequest request ) throws Exception {
+		final String[] segments = split(request.path());
+		if (segments==null) throw new UHttpException(400, "Invalid path");
+		final ArrayList<String> allowed = new ArrayList<>(2);
+		Route fallback = null;
+		HashMap<String,String> fallbackParameters = null;
+		for (final Route route : routes) {
+			final HashMap<String,String> parameters = route.match(segments);
+			if (parameters==null) continue;
+			if (route.method.equals(request.method())) {
+				request.setPathParameters(parameters);
+				return route.handler.handle(request);
+			}
+			if (fallback==null && route.method.equals("GET") && request.method().equals("HEAD")) {
+				fallback = route;
+				fallbackParameters = parameters;
+			}
+			if (!allowed.contains(route.method)) allowed.add(route.method);
+		}
+		if (fallback!=null) {
+			request.setPathParameters(fallbackParameters);
+			return fallback.handler.handle(request);
+		}
+		if (allowed.isEmpty()) throw new UHttpException(404, "No route for "+request.path());
+		final StringBuilder allow = new StringBuilder();
+		for (final String method : allowed) {
+			if (allow.length() > 0) allow.append(", ");
+			allow.append(method);
+		}
+		final UHttpResponse response = UHttpResponse.error(405, null);
+		response.headers().set(UHttpHeaders.ALLOW, allow);
+		return UFuture.succeeded(response);
+	}
+
+	/**
+	 * Splits a path into its decoded segments.
+	 * @return
+	 * the segments or null, if the path is not absolute.
+	 */
+	private static String[] split( final String path ) {
+		if (!path.startsWith("/")) return null;
+		if (path.length()==1) return new String[0];
+		final String[] segments = path.substring(1).split("/", -1);
+		for (int i=0; i < segments.length; i++) segments[i] = decodePath(segments[i]);
+		return segments;
+	}
+
+	/**
+	 * Percent-decodes a path segment, where unlike in a query a plus is no space.
+	 */
+	private static String decodePath( final String segment ) {
+		if (segment.indexOf('%') < 0) return segment;
+		return UHttpRequest.decode(segment.replace("+", "%2B"));
+	}
+
+	/**
+	 * A route.
+	 */
+	private static final class Route {
+		Route( final String method, final String pattern, final UHttpHandler handler ) {
+			final String[] segments = split(pattern);
+			if (segments==null) throw new IllegalArgumentException("Pattern must start with a slash: "+pattern);
+			for (int i=0; i < segments.length; i++) {
+				if (segments[i].equals("*") && i < segments.length - 1) throw new IllegalArgumentException("Wildcard must be the last segment: "+pattern);
+			}
+			this.method = method;
+			this.segments = segments;
+			this.handler = handler;
+		}
+
+		/**
+		 * The method.
+		 */
+		final String method;
+
+		/**
+		 * The segments of the pattern.
+		 */
+		final String[] segments;
+
+		/**
+		 * The handler.
+		 */
+		final UHttpHandler handler;
+
+		/**
+		 * Matches the given path segments.
+		 * @return
+		 * the path parameters or null, if the path does not match.
+		 */
+		HashMap<String,String> match( final String[] path ) {
+			final HashMap<String,String> parameters = new HashMap<>();
+			for (int i=0; i < segments.length; i++) {
+				final String segment = segments[i];
+				if (segment.equals("*")) {
+					final StringBuilder rest = new StringBuilder();
+					for (int j=i; j < path.length; j++) {
+						if (j > i) rest.append('/');
+						rest.append(path[j]);
+					}
+					parameters.put("*", rest.toString());
+					return parameters;
+				}
+				if (i >= path.length) return null;
+				if (segment.length() > 2 && segment.charAt(0)=='{' && segment.charAt(segment.length() - 1)=='}') {
+					if (path[i].isEmpty()) return null;
+					parameters.put(segment.substring(1, segment.length() - 1), path[i]);
+				} else
+				if (!segment.equals(path[i])) {
+					return null;
+				}
+			}
+			return segments.length==path.length ? parameters : null;
+		}
+	}
+}
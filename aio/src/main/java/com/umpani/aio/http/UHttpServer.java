@@ -0,0 +1,404 @@
+package com.umpani.aio.http;
+
+import java.io.IOException;
+import java.net.InetSocketAddress;
+import java.net.SocketAddress;
+import java.nio.file.attribute.PosixFilePermission;
+import java.util.ArrayList;
+import java.util.List;
+import java.util.Set;
+import java.util.concurrent.TimeUnit;
+import java.util.zip.Deflater;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelHandler;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UCompositeBuffer;
+import com.umpani.aio.UDrainResult;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UServer;
+import com.umpani.aio.UTransport;
+import com.umpani.aio.codec.UByteToMessageDecoder;
+import com.umpani.aio.http2.UHttp2Frame;
+import com.umpani.aio.http2.UHttp2FrameDecoder;
+import com.umpani.aio.http2.UHttp2FrameEncoder;
+import com.umpani.aio.http2.UHttp2ServerHandler;
+import com.umpani.aio.http2.UHttp2Settings;
+import com.umpani.aio.ssl.USslContext;
+import com.umpani.aio.ssl.USslHandler;
+import com.umpani.aio.ssl.USslHandshakeEvent;
+
+/**
+ * An HTTP/1.1 server, which sets up the pipeline of every accepted connection with an {@link UHttpRequestDecoder},
+ * an {@link UHttpResponseEncoder} and an {@link UHttpServerHandler} that serves the requests with the given handler,
+ * usually an {@link UHttpRouter}. Compressed request bodies are decompressed up to the maximal body size and, unless
+ * disabled, responses are compressed with gzip or deflate as accepted by the client, see
+ * {@link UHttpContentCompressor}. With a server {@link USslContext} the connections are encrypted with TLS. The server
+ * listens on TCP or, with the {@link UTransport#UNIX} transport, on a Unix domain socket.
+ *
+ * </p><p>With {@link #setHttp2(boolean)} the server speaks HTTP/2 as well, the requests are served by the same handler
+ * with an {@link UHttp2ServerHandler}. Plain connections that start with the HTTP/2 connection preface (prior
+ * knowledge h2c) use HTTP/2, all others HTTP/1.1. Encrypted connections use HTTP/2 if the client selected
+ * <tt>h2</tt> with ALPN, which requires the application protocols <tt>h2</tt> and <tt>http/1.1</tt> to be set on the
+ * {@link USslContext}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttpServer {
+	/**
+	 * Create a new server that uses the default buffer pool.
+	 * @param group
+	 * the event loops.
+	 * @param handler
+	 * the handler of the requests.
+	 */
+	public UHttpServer( final UEventLoopGroup group, final UHttpHandler handler ) {
+		this(group, handler, UBufferPool.DEFAULT);
+	}
+
+	/**
+	 * Create a new server.
+	 * @param group
+	 * the event loops.
+	 * @param handler
+	 * the handler of the requests.
+	 * @param alloc
+	 * the buffer pool of the connections.
+	 */
+	public UHttpServer( final UEventLoopGroup group, final UHttpHandler handler, final UBufferPool alloc ) {
+		if (handler==null) throw new NullPointerException("handler");
+		this.handler = handler;
+		this.server = new UServer(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) throws Exception {
+				UHttpServer.this.initChannel(channel);
+			}
+		}, alloc);
+	}
+
+	/**
+	 * The handler of the requests.
+	 */
+	protected final UHttpHandler handler;
+
+	/**
+	 * The server that accepts the connections.
+	 */
+	private final UServer server;
+
+	/**
+	 * The maximal size of the request line and the header fields.
+	 */
+	private volatile int maxHeaderSize = UHttpDecoder.DEFAULT_MAX_HEADER_SIZE;
+
+	/**
+	 * The maximal size of a request body.
+	 */
+	private volatile int maxBodySize = UHttpDecoder.DEFAULT_MAX_BODY_SIZE;
+
+	/**
+	 * The TLS configuration or null.
+	 */
+	private volatile USslContext sslContext;
+
+	/**
+	 * True if responses are compressed.
+	 */
+	private volatile boolean compression = true;
+
+	/**
+	 * The minimal size of a response body in memory to compress.
+	 */
+	private volatile int compressionThreshold = UHttpContentCompressor.DEFAULT_MIN_SIZE;
+
+	/**
+	 * True if HTTP/2 is accepted.
+	 */
+	private volatile boolean http2;
+
+	/**
+	 * Sets the maximal size of the request line and the header fields of a request, larger requests are answered with
+	 * status 431. Only affects connections accepted afterwards.
+	 * @param maxHeaderSize
+	 * the maximal size in bytes.
+	 * @return
+	 * this.
+	 */
+	public UHttpServer setMaxHeaderSize( final int maxHeaderSize ) {
+		if (maxHeaderSize <= 0) throw new IllegalArgumentException("maxHeaderSize: "+maxHeaderSize);
+		this.maxHeaderSize = maxHeaderSize;
+		return this;
+	}
+
+	/**
+	 * Sets the maximal size of a request body, larger bodies are answered with status 413. Only affects connections
+	 * accepted afterwards.
+	 * @param maxBodySize
+	 * the maximal size in bytes.
+	 * @return
+	 * this.
+	 */
+	public UHttpServer setMaxBodySize( final int maxBodySize ) {
+		if (maxBodySize < 0) throw new IllegalArgumentException("maxBodySize: "+maxBodySize);
+		this.maxBodySize = maxBodySize;
+		return this;
+	}
+
+	/**
+	 * Enables or disables the compression of responses, enabled by default. Only affects connections accepted
+	 * afterwards.
+	 * @param compression
+	 * true to compress responses as accepted by the client.
+	 * @return
+	 * this.
+	 */
+	public UHttpServer setCompression( final boolean compression ) {
+		this.compression = compression;
+		return this;
+	}
+
+	/**
+	 * Sets the minimal size of a response body in memory to compress, smaller bodies are sent as they are. Only
+	 * affects connections accepted afterwards.
+	 * @param threshold
+	 * the minimal size in bytes.
+	 * @return
+	 * this.
+	 */
+	public UHttpServer setCompressionThreshold( final int threshold ) {
+		if (threshold < 0) throw new IllegalArgumentException("threshold: "+threshold);
+		this.compressionThreshold = threshold;
+		return this;
+	}
+
+	/**
+	 * Enables or disables HTTP/2, disabled by default. Only affects connections accepted afterwards.
+	 * @param http2
+	 * true to accept HTTP/2 with prior knowledge on plain connections and as negotiated with ALPN on encrypted
+	 * connections.
+	 * @return
+	 * this.
+	 */
+	public UHttpServer setHttp2( final boolean http2 ) {
+		this.http2 = http2;
+		return this;
+	}
+
+	/**
+	 * Enables TLS for connections accepted afterwards.
+	 * @param sslContext
+	 * the server context or null, to accept plain connections.
+	 * @return
+	 * this.
+	 */
+	public UHttpServer setSslContext( final USslContext sslContext ) {
+		if (sslContext!=null && sslContext.isClient()) throw new IllegalArgumentException("Server context required");
+		this.sslContext = sslContext;
+		return this;
+	}
+
+	/**
+	 * Sets the transport, must be called before the server is bound.
+	 * @param transport
+	 * the transport.
+	 * @return
+	 * this.
+	 * @throws UnsupportedOperationException
+	 * if the transport is not available.
+	 */
+	public UHttpServer setTransport( final UTransport transport ) {
+		server.setTransport(transport);
+		return this;
+	}
+
+	/**
+	 * Sets the permissions of the socket file of a Unix domain socket.
+	 * @param permissions
+	 * the permissions; null to keep the default permissions.
+	 * @return
+	 * this.
+	 * @see UServer#setSocketFilePermissions(Set)
+	 */
+	public UHttpServer setSocketFilePermissions( final Set<PosixFilePermission> permissions ) {
+		server.setSocketFilePermissions(permissions);
+		return this;
+	}
+
+	/**
+	 * Sets up the pipeline of an accepted connection, may be overridden to add further handlers. If HTTP/2 is enabled,
+	 * the protocol handlers are added once the protocol is known.
+	 * @param channel
+	 * the accepted channel.
+	 * @throws Exception
+	 * if the pipeline can't be set up.
+	 */
+	protected void initChannel( final UChannel channel ) throws Exception {
+		final USslContext sslContext = this.sslContext;
+		if (sslContext!=null) channel.pipeline().addLast(sslContext.newHandler());
+		if (http2) {
+			channel.pipeline().addLast(new Negotiator(sslContext!=null));
+		} else {
+			channel.pipeline().addLast(newHttp1Handlers());
+		}
+	}
+
+	/**
+	 * Creates the handlers of an HTTP/1.1 connection.
+	 * @return
+	 * the handlers in the order of the pipeline.
+	 */
+	protected UChannelHandler[] newHttp1Handlers() {
+		final ArrayList<UChannelHandler> handlers = new ArrayList<>();
+		handlers.add(new UHttpRequestDecoder(maxHeaderSize, maxBodySize));
+		handlers.add(new UHttpResponseEncoder());
+		// the compressor sees every request, also those whose body can't be decompressed
+		if (compression) handlers.add(new UHttpContentCompressor(compressionThreshold, Deflater.DEFAULT_COMPRESSION));
+		handlers.add(new UHttpContentDecompressor(maxBodySize));
+		handlers.add(new UHttpServerHandler(handler));
+		return handlers.toArray(new UChannelHandler[handlers.size()]);
+	}
+
+	/**
+	 * Creates the handlers of an HTTP/2 connection.
+	 * @return
+	 * the handlers in the order of the pipeline.
+	 */
+	protected UChannelHandler[] newHttp2Handlers() {
+		final UHttp2Settings settings = new UHttp2Settings()
+			.setMaxConcurrentStreams(UHttp2ServerHandler.DEFAULT_MAX_CONCURRENT_STREAMS)
+			.setMaxHeaderListSize(maxHeaderSize);
+		return new UChannelHandler[] {
+			new UHttp2FrameDecoder(true, settings.getMaxFrameSize()),
+			new UHttp2FrameEncoder(false),
+			new UHttp2ServerHandler(handler, settings, maxBodySize)
+		};
+	}
+
+	/**
+	 * Binds the server to the given address and starts accepting connections.
+	 * @param address
+	 * the local address, use port zero to bind to any free port. With the {@link UTransport#UNIX} transport the
+	 * address of the socket file.
+	 * @return
+	 * the bound address; null if bound to a Unix domain socket.
+	 * @throws IOException
+	 * if binding failed.
+	 */
+	public InetSocketAddress bind( final SocketAddress address ) throws IOException {
+		return server.bind(address);
+	}
+
+	/**
+	 * Returns the bound address.
+	 * @return
+	 * the bound address or null, if the server is not bound or bound to a Unix domain socket.
+	 */
+	public InetSocketAddress localAddress() {
+		return server.localAddress();
+	}
+
+	/**
+	 * Returns the bound address of any transport.
+	 * @return
+	 * the bound address or null, if the server is not bound.
+	 */
+	public SocketAddress localSocketAddress() {
+		return server.localSocketAddress();
+	}
+
+	/**
+	 * Returns a snapshot of the open connections.
+	 * @return
+	 * the open connections.
+	 */
+	public List<UChannel> channels() {
+		return server.channels();
+	}
+
+	/**
+	 * Stops accepting new connections and closes all open connections.
+	 * @return
+	 * the future that is completed once all connections are closed.
+	 */
+	public UFuture<List<Void>> close() {
+		return server.close();
+	}
+
+	/**
+	 * Shuts the server down gracefully: stops accepting, answers the requests in progress with
+	 * <tt>Connection: close</tt>, sends a GOAWAY frame on HTTP/2 connections, closes WebSockets with a close frame and
+	 * closes the connections that are still open after the given timeout.
+	 * @param timeout
+	 * the maximal time to wait for the connections to close.
+	 * @param unit
+	 * the unit of the timeout.
+	 * @return
+	 * the future that is completed once all connections are closed.
+	 * @see UServer#shutdown(long, TimeUnit)
+	 */
+	public UFuture<UDrainResult> shutdown( final long timeout, final TimeUnit unit ) {
+		return server.shutdown(timeout, unit);
+	}
+
+	@Override
+	public String toString() {
+		return "UHttpServer["+localSocketAddress()+"]";
+	}
+
+	/**
+	 * Selects the protocol of a connection, HTTP/2 if the client sends the connection preface or selected <tt>h2</tt>
+	 * with ALPN, otherwise HTTP/1.1. The handlers of the protocol replace the negotiator, the bytes received so far are
+	 * passed on to them.
+	 */
+	private final class Negotiator extends UByteToMessageDecoder {
+		Negotiator( final boolean encrypted ) {
+			this.encrypted = encrypted;
+		}
+
+		/**
+		 * True if the protocol is negotiated with ALPN.
+		 */
+		private final boolean encrypted;
+
+		@Override
+		protected void decode( final UHandlerContext ctx, final UCompositeBuffer in, final List<Object> out ) throws Exception {
+			// encrypted connections wait for the handshake
+			if (encrypted) return;
+			final byte[] preface = UHttp2Frame.PREFACE;
+			final int readable = in.readableBytes();
+			for (int i=0; i < preface.length && i < readable; i++) {
+				if (in.getByte(i)!=preface[i]) {
+					select(ctx, false);
+					return;
+				}
+			}
+			if (readable >= preface.length) select(ctx, true);
+		}
+
+		@Override
+		public void userEvent( final UHandlerContext ctx, final Object event ) throws Exception {
+			if (encrypted && event instanceof USslHandshakeEvent && ((USslHandshakeEvent)event).isSuccess()) {
+				final USslHandler ssl = ctx.pipeline().get(USslHandler.class);
+				select(ctx, ssl!=null && "h2".equals(ssl.applicationProtocol()));
+			}
+			ctx.fireUserEvent(event);
+		}
+
+		/**
+		 * Adds the handlers of the selected protocol and removes the negotiator.
+		 */
+		private void select( final UHandlerContext ctx, final boolean http2 ) {
+			final UChannelHandler[] handlers = http2 ? newHttp2Handlers() : newHttp1Handlers();
+			for (int i=handlers.length - 1; i >= 0; i--) ctx.pipeline().addAfter(ctx.name(), null, handlers[i]);
+			ctx.pipeline().remove(this);
+		}
+
+		@Override
+		public String toString() {
+			return "Negotiator["+(encrypted ? "ALPN" : "preface")+"]";
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package com.umpani.aio.http;
+
+import java.util.ArrayDeque;
+
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UDrainEvent;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UPipeline;
+import com.umpani.aio.USocketChannel;
+import com.umpani.aio.exception.UHttpException;
+import com.umpani.util.log.ULogger;
+
+/**
+ * Serves the {@link UHttpRequest}s decoded by an {@link UHttpRequestDecoder} with an {@link UHttpHandler}. Pipelined
+ * requests are handled concurrently, but the responses are written in the order of the requests, a streamed
+ * response delays all following responses until its stream ended. The connection is kept alive as requested by the
+ * client and closed after the response to a request that does not keep the connection alive. A request that could
+ * not be decoded is answered with the status code of the {@link UHttpException} and the connection is closed. After
+ * a response with an upgrade, see {@link UHttpResponse#setUpgrade(com.umpani.aio.UChannelInitializer)}, the
+ * connection is taken over by the handlers of the new protocol.
+ *
+ * </p><p>Once the maximal amount of pipelined requests wait for their responses, the handler stops reading from the
+ * connection until a response was written, so that the client is throttled. Requests already received are still
+ * served.
+ *
+ * </p><p>Once the server shuts down, see {@link UDrainEvent}, an idle connection is closed at once, otherwise the
+ * last pending response is sent with <tt>Connection: close</tt> and the connection is closed after it.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttpServerHandler extends UChannelHandlerAdapter {
+	/**
+	 * The logger of the HTTP servers.
+	 */
+	private static final ULogger LOG = new ULogger(UHttpServerHandler.class.getName());
+
+	/**
+	 * The default maximal amount of requests waiting for their responses.
+	 */
+	public static final int DEFAULT_MAX_PENDING_REQUESTS = 32;
+
+	/**
+	 * Create a new handler that reads up to {@link #DEFAULT_MAX_PENDING_REQUESTS} pipelined requests.
+	 * @param handler
+	 * the handler of the requests, may be shared by any amount of channels.
+	 */
+	public UHttpServerHandler( final UHttpHandler handler ) {
+		this(handler, DEFAULT_MAX_PENDING_REQUESTS);
+	}
+
+	/**
+	 * Create a new handler.
+	 * @param handler
+	 * the handler of the requests, may be shared by any amount of channels.
+	 * @param maxPendingRequests
+	 * the maximal amount of requests waiting for their responses before the handler stops reading.
+	 */
+	public UHttpServerHandler( final UHttpHandler handler, final int maxPendingRequests ) {
+		if (handler==null) throw new NullPointerException("handler");
+		if (maxPendingRequests <= 0) throw new IllegalArgumentException("maxPendingRequests: "+maxPendingRequests);
+		this.handler = handler;
+		this.maxPendingRequests = maxPendingRequests;
+	}
+
+	/**
+	 * The handler of the requests.
+	 */
+	protected final UHttpHandler handler;
+
+	/**
+	 * The maximal amount of requests waiting for their responses.
+	 */
+	private final int maxPendingRequests;
+
+	/**
+	 * The requests whose responses are not yet written, in the order of the requests.
+	 */
+	private final ArrayDeque<Exchange> exchanges = new ArrayDeque<>();
+
+	/**
+	 * True while a streamed response is written.
+	 */
+	private boolean streaming;
+
+	/**
+	 * True once a request closes the connection, all following requests are ignored.
+	 */
+	private boolean closing;
+
+	/**
+	 * True once the server shuts down.
+	 */
+	private boolean draining;
+
+	/**
+	 * True while reading is stopped, because too many requests wait for their responses.
+	 */
+	private boolean paused;
+
+	@Override
+	public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+		if (!(msg instanceof UHttpRequest)) {
+			ctx.fireChannelRead(msg);
+			return;
+		}
+		if (closing) return;
+		final UHttpRequest request = (UHttpRequest)msg;
+		final Exchange exchange = new Exchange(request, request.isKeepAlive());
+		if (!exchange.keepAlive) closing = true;
+		exchanges.add(exchange);
+		if (exchanges.size() >= maxPendingRequests && !paused) {
+			paused = true;
+			setAutoRead(ctx, false);
+		}
+		UFuture<?> result;
+		try {
+			result = handler.handle(request);
+			if (result==null) result = UFuture.succeeded(null);
+		} catch (Throwable t) {
+			result = UFuture.failed(t);
+		}
+		complete(ctx, exchange, result);
+	}
+
+	/**
+	 * Stores the response of the given exchange once the result is done and writes all responses that are ready.
+	 */
+	private <T> void complete( final UHandlerContext ctx, final Exchange exchange, final UFuture<T> result ) {
+		result.addListener(new UFutureListener<T>() {
+			@Override
+			public void complete( final UFuture<T> future ) {
+				UHttpResponse response;
+				try {
+					response = future.isSuccess() ? toResponse(future.getNow()) : toErrorResponse(exchange.request, future.cause());
+				} catch (Throwable t) {
+					response = toErrorResponse(exchange.request, t);
+				}
+				exchange.response = response;
+				writeResponses(ctx);
+			}
+		}, ctx.loop());
+	}
+
+	@Override
+	public void exceptionCaught( final UHandlerContext ctx, final Throwable cause ) throws Exception {
+		if (!(cause instanceof UHttpException)) {
+			ctx.fireExceptionCaught(cause);
+			return;
+		}
+		if (closing) return;
+		closing = true;
+		final Exchange exchange = new Exchange(null, false);
+		exchange.response = UHttpResponse.error(((UHttpException)cause).getStatus(), cause.getMessage());
+		exchanges.add(exchange);
+		writeResponses(ctx);
+	}
+
+	@Override
+	public void userEvent( final UHandlerContext ctx, final Object event ) throws Exception {
+		if (event==UDrainEvent.INSTANCE && !draining) {
+			draining = true;
+			// a closing connection closes after its last response anyway
+			if (!closing && !streaming && exchanges.isEmpty()) ctx.close();
+		}
+		ctx.fireUserEvent(event);
+	}
+
+	@Override
+	public void channelInactive( final UHandlerContext ctx ) throws Exception {
+		exchanges.clear();
+		closing = true;
+		ctx.fireChannelInactive();
+	}
+
+	/**
+	 * Converts the result of the handler into a response.
+	 * @param result
+	 * the result.
+	 * @return
+	 * the response.
+	 * @throws Exception
+	 * if the result can't be converted.
+	 */
+	protected UHttpResponse toResponse( final Object result ) throws Exception {
+		return UHttpResponse.forResult(result);
+	}
+
+	/**
+	 * Converts a failure of the handler into a response. An {@link UHttpException} is answered with its status code,
+	 * invalid JSON with 400 and any other exception with 500, in which case the exception is logged.
+	 * @param request
+	 * the request.
+	 * @param cause
+	 * the failure.
+	 * @return
+	 * the response.
+	 */
+	protected UHttpResponse toErrorResponse( final UHttpRequest request, final Throwable cause ) {
+		if (!UHttpResponse.isExpectedFailure(cause)) {
+			LOG.error("Failed to handle a request", "request", String.valueOf(request), cause);
+		}
+		return UHttpResponse.forFailure(cause);
+	}
+
+	/**
+	 * Writes all responses that are ready, in the order of the requests.
+	 */
+	private void writeResponses( final UHandlerContext ctx ) {
+		Exchange exchange;
+		while (!streaming && (exchange = exchanges.peek())!=null && exchange.response!=null) {
+			exchanges.poll();
+			if (write(ctx, exchange)) {
+				// the connection ends with this response, the following requests are not answered
+				exchanges.clear();
+				return;
+			}
+		}
+		if (paused && exchanges.size() < maxPendingRequests) {
+			paused = false;
+			setAutoRead(ctx, true);
+		}
+	}
+
+	/**
+	 * Starts or stops reading from the channel, if it supports it.
+	 */
+	private static void setAutoRead( final UHandlerContext ctx, final boolean autoRead ) {
+		final UChannel channel = ctx.channel();
+		if (channel instanceof USocketChannel) ((USocketChannel)channel).setAutoRead(autoRead);
+	}
+
+	/**
+	 * Writes the response of the given exchange.
+	 * @return
+	 * true if the connection is closed after the response.
+	 */
+	private boolean write( final UHandlerContext ctx, final Exchange exchange ) {
+		final UHttpRequest request = exchange.request;
+		final UHttpResponse response = exchange.response;
+		final UHttpHeaders headers = response.headers();
+		final boolean http10 = request!=null && UHttpMessage.HTTP_1_0.equals(request.version());
+		response.setVersion(http10 ? UHttpMessage.HTTP_1_0 : UHttpMessage.HTTP_1_1);
+		final UHttpStreamer streamer = response.streamer();
+		boolean keepAlive = exchange.keepAlive && !headers.contains(UHttpHeaders.CONNECTION, "close");
+		// the last response of a draining connection ends it
+		if (draining && exchanges.isEmpty()) keepAlive = false;
+		// a streamed body without length and chunked encoding ends with the connection
+		if (streamer!=null && http10 && !headers.contains(UHttpHeaders.CONTENT_LENGTH)) keepAlive = false;
+		if (!keepAlive) {
+			headers.set(UHttpHeaders.CONNECTION, "close");
+			closing = true;
+		} else
+		if (http10) {
+			headers.set(UHttpHeaders.CONNECTION, "keep-alive");
+		}
+		response.omitBody = request!=null && request.method().equals("HEAD");
+		final boolean close = !keepAlive;
+		if (response.upgrade()!=null && response.status()==101 && !close) {
+			upgrade(ctx, response);
+			return true;
+		}
+		if (streamer==null) {
+			final UFuture<Void> written = ctx.writeAndFlush(response);
+			if (close) closeAfter(ctx, written);
+			return close;
+		}
+		streaming = true;
+		ctx.writeAndFlush(response);
+		final UHttpStream stream = new UHttpStream(ctx, request, response, response.omitBody, new Runnable() {
+			@Override
+			public void run() {
+				streaming = false;
+				if (close || (draining && exchanges.isEmpty())) {
+					ctx.close();
+				} else {
+					writeResponses(ctx);
+				}
+			}
+		});
+		try {
+			streamer.stream(stream);
+		} catch (Throwable t) {
+			LOG.error("Failed to stream a response", "request", String.valueOf(request), t);
+			ctx.close();
+			return true;
+		}
+		return close;
+	}
+
+	/**
+	 * Writes a response that switches protocols and replaces the HTTP handlers with the handlers of the new protocol.
+	 */
+	private void upgrade( final UHandlerContext ctx, final UHttpResponse response ) {
+		closing = true;
+		exchanges.clear();
+		// the handlers of the new protocol expect to read
+		if (paused) setAutoRead(ctx, true);
+		ctx.writeAndFlush(response);
+		final UPipeline pipeline = ctx.pipeline();
+		try {
+			pipeline.remove(this);
+			final UHttpContentDecompressor decompressor = pipeline.get(UHttpContentDecompressor.class);
+			if (decompressor!=null) pipeline.remove(decompressor);
+			final UHttpContentCompressor compressor = pipeline.get(UHttpContentCompressor.class);
+			if (compressor!=null) pipeline.remove(compressor);
+			final UHttpResponseEncoder encoder = pipeline.get(UHttpResponseEncoder.class);
+			if (encoder!=null) pipeline.remove(encoder);
+			response.upgrade().initChannel(ctx.channel());
+			// the decoder passes the bytes received after the request to the new handlers
+			final UHttpRequestDecoder decoder = pipeline.get(UHttpRequestDecoder.class);
+			if (decoder!=null) pipeline.remove(decoder);
+		} catch (Throwable t) {
+			LOG.error("Failed to switch the protocol", "channel", String.valueOf(ctx.channel()), t);
+			ctx.close();
+		}
+	}
+
+	/**
+	 * Closes the channel once the given write is done.
+	 */
+	private static void closeAfter( final UHandlerContext ctx, final UFuture<Void> written ) {
+		written.addListener(new UFutureListener<Void>() {
+			@Override
+			public void complete( final UFuture<Void> future ) {
+				ctx.close();
+			}
+		}, null);
+	}
+
+	/**
+	 * A request and its response.
+	 */
+	private static final class Exchange {
+		Exchange( final UHttpRequest request, final boolean keepAlive ) {
+			this.request = request;
+			this.keepAlive = keepAlive;
+		}
+
+		/**
+		 * The request, null if it could not be decoded.
+		 */
+		final UHttpRequest request;
+
+		/**
+		 * True if the request keeps the connection alive.
+		 */
+		final boolean keepAlive;
+
+		/**
+		 * The response, once known.
+		 */
+		UHttpResponse response;
+	}
+}
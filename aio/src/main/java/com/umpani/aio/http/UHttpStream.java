@@ -0,0 +1,228 @@
+package com.umpani.aio.http;
+
+import java.util.concurrent.atomic.AtomicBoolean;
+
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UEventLoop;
+import com.umpani.aio.UFileRegion;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UHandlerContext;
+
+/**
+ * The body of a streamed {@link UHttpMessage}, passed to the {@link UHttpStreamer} of the message. Every write is
+ * sent as a chunk and flushed immediately, all methods may be called from any thread. With HTTP/1.x the chunks are
+ * written to the pipeline of the connection, protocols that multiplex several messages on one connection, like
+ * HTTP/2, pass a {@link Writer} of their own.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UHttpStream {
+	/**
+	 * Writes the parts of a streamed body.
+	 */
+	public static interface Writer {
+		/**
+		 * Returns the channel the message is written to.
+		 * @return
+		 * the channel.
+		 */
+		public UChannel channel();
+
+		/**
+		 * Writes a part of the body and flushes it, may be invoked by any thread.
+		 * @param msg
+		 * an {@link UHttpChunk}, {@link UHttpChunk#LAST} at the end of the body, or an {@link UFileRegion}, which
+		 * the writer must release.
+		 * @return
+		 * the future that is completed once the part was written.
+		 */
+		public UFuture<Void> write( final Object msg );
+	}
+
+	/**
+	 * Create a new stream that writes to the pipeline of a connection.
+	 * @param ctx
+	 * the context of the handler that writes the message.
+	 * @param request
+	 * the request that is answered by the server or sent by the client.
+	 * @param message
+	 * the streamed message, after its header was encoded.
+	 * @param omitBody
+	 * true if the body is not written, because the request is a HEAD request.
+	 * @param onEnd
+	 * invoked by the event loop once the stream ended.
+	 */
+	UHttpStream( final UHandlerContext ctx, final UHttpRequest request, final UHttpMessage message, final boolean omitBody, final Runnable onEnd ) {
+		this(new Writer() {
+			@Override
+			public UChannel channel() {
+				return ctx.channel();
+			}
+
+			@Override
+			public UFuture<Void> write( final Object msg ) {
+				return ctx.writeAndFlush(msg);
+			}
+		}, request, message, omitBody, onEnd);
+	}
+
+	/**
+	 * Create a new stream that writes with the given writer.
+	 * @param writer
+	 * the writer of the body.
+	 * @param request
+	 * the request that is answered by the server or sent by the client.
+	 * @param message
+	 * the streamed message, after its header was encoded.
+	 * @param omitBody
+	 * true if the body is not written, because the request is a HEAD request.
+	 */
+	public UHttpStream( final Writer writer, final UHttpRequest request, final UHttpMessage message, final boolean omitBody ) {
+		this(writer, request, message, omitBody, null);
+	}
+
+	/**
+	 * Create a new stream.
+	 */
+	private UHttpStream( final Writer writer, final UHttpRequest request, final UHttpMessage message, final boolean omitBody, final Runnable onEnd ) {
+		if (writer==null) throw new NullPointerException("writer");
+		this.writer = writer;
+		this.request = request;
+		this.message = message;
+		this.omitBody = omitBody;
+		this.onEnd = onEnd;
+	}
+
+	/**
+	 * The writer of the body.
+	 */
+	private final Writer writer;
+
+	/**
+	 * The request that is answered or sent.
+	 */
+	private final UHttpRequest request;
+
+	/**
+	 * The streamed message.
+	 */
+	private final UHttpMessage message;
+
+	/**
+	 * True if the body is not written.
+	 */
+	private final boolean omitBody;
+
+	/**
+	 * Invoked once the stream ended or null.
+	 */
+	private final Runnable onEnd;
+
+	/**
+	 * True once the stream ended.
+	 */
+	private final AtomicBoolean ended = new AtomicBoolean();
+
+	/**
+	 * Returns the request that is answered by the server or sent by the client.
+	 * @return
+	 * the request.
+	 */
+	public UHttpRequest request() {
+		return request;
+	}
+
+	/**
+	 * Returns the channel the message is written to.
+	 * @return
+	 * the channel.
+	 */
+	public UChannel channel() {
+		return writer.channel();
+	}
+
+	/**
+	 * Returns true once the stream ended.
+	 * @return
+	 * true once the stream ended.
+	 */
+	public boolean isEnded() {
+		return ended.get();
+	}
+
+	/**
+	 * Writes a part of the body.
+	 * @param data
+	 * the bytes to write.
+	 * @return
+	 * the future that is completed once the bytes were written.
+	 * @throws IllegalStateException
+	 * if the stream already ended.
+	 */
+	public UFuture<Void> write( final byte[] data ) {
+		if (ended.get()) throw new IllegalStateException("Stream ended");
+		if (omitBody || data.length==0) return UFuture.succeeded(null);
+		return writer.write(new UHttpChunk(data));
+	}
+
+	/**
+	 * Writes a part of the body as UTF-8.
+	 * @param text
+	 * the text to write.
+	 * @return
+	 * the future that is completed once the text was written.
+	 * @throws IllegalStateException
+	 * if the stream already ended.
+	 */
+	public UFuture<Void> write( final String text ) {
+		if (ended.get()) throw new IllegalStateException("Stream ended");
+		if (omitBody || text.isEmpty()) return UFuture.succeeded(null);
+		return writer.write(new UHttpChunk(text));
+	}
+
+	/**
+	 * Writes a part of the body from a file, the bytes are transferred without copying them, if the connection is not
+	 * encrypted. The bytes are written as they are, so the message must have a <tt>Content-Length</tt> or be sent with
+	 * HTTP/1.0. The region is released once written.
+	 * @param region
+	 * the region of the file to write.
+	 * @return
+	 * the future that is completed once the region was written.
+	 * @throws IllegalStateException
+	 * if the stream already ended or the body is chunked.
+	 */
+	public UFuture<Void> write( final UFileRegion region ) {
+		if (ended.get() || message.headers().contains(UHttpHeaders.TRANSFER_ENCODING, "chunked")) {
+			region.release();
+			throw new IllegalStateException(ended.get() ? "Stream ended" : "A chunked body can't contain a file region");
+		}
+		if (omitBody || region.remaining()==0) {
+			region.release();
+			return UFuture.succeeded(null);
+		}
+		return writer.write(region);
+	}
+
+	/**
+	 * Ends the body, further calls are ignored.
+	 * @return
+	 * the future that is completed once the end was written.
+	 */
+	public UFuture<Void> end() {
+		if (!ended.compareAndSet(false, true)) return UFuture.succeeded(null);
+		final UFuture<Void> future = omitBody ? UFuture.<Void>succeeded(null) : writer.write(UHttpChunk.LAST);
+		if (onEnd==null) return future;
+		final UEventLoop loop = writer.channel().loop();
+		if (loop.inEventLoop()) {
+			onEnd.run();
+		} else {
+			loop.execute(onEnd);
+		}
+		return future;
+	}
+
+	@Override
+	public String toString() {
+		return "UHttpStream["+request+"]";
+	}
+}
@@ -0,0 +1,19 @@
+package com.umpani.aio.http;
+
+/**
+ * Produces the body of a streamed {@link UHttpMessage}, a response sent by the server or a request sent by the client.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface UHttpStreamer {
+	/**
+	 * Called by the event loop of the connection once the header of the message was written. The streamer may write
+	 * the body immediately or later from any thread, but must end the stream once the body is complete, because no
+	 * further message is written on the connection before.
+	 * @param stream
+	 * the stream to write the body to.
+	 * @throws Exception
+	 * if streaming failed, the connection is closed.
+	 */
+	public void stream( final UHttpStream stream ) throws Exception;
+}
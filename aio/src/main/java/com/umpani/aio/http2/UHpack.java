@@ -0,0 +1,526 @@
+package com.umpani.aio.http2;
+
+import java.io.ByteArrayOutputStream;
+import java.nio.charset.StandardCharsets;
+
+import com.umpani.aio.exception.UHttp2Exception;
+
+/**
+ * The primitives of HPACK, the header compression of HTTP/2 defined by RFC 7541: the static table, the prefixed
+ * integers and the string literals with the optional Huffman code. The stateful parts are the {@link UHpackEncoder}
+ * and the {@link UHpackDecoder}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UHpack {
+	/**
+	 * The size of the entries of the static table.
+	 */
+	public static final int STATIC_TABLE_LENGTH = 61;
+
+	/**
+	 * The default maximal size of the dynamic table.
+	 */
+	public static final int DEFAULT_TABLE_SIZE = 4096;
+
+	/**
+	 * The overhead of an entry in the dynamic table in addition to the length of its name and value.
+	 */
+	public static final int ENTRY_OVERHEAD = 32;
+
+	/**
+	 * The entries of the static table, the index of an entry is its position plus one.
+	 */
+	private static final String[][] STATIC_TABLE = {
+		{":authority", ""},
+		{":method", "GET"},
+		{":method", "POST"},
+		{":path", "/"},
+		{":path", "/index.html"},
+		{":scheme", "http"},
+		{":scheme", "https"},
+		{":status", "200"},
+		{":status", "204"},
+		{":status", "206"},
+		{":status", "304"},
+		{":status", "400"},
+		{":status", "404"},
+		{":status", "500"},
+		{"accept-charset", ""},
+		{"accept-encoding", "gzip, deflate"},
+		{"accept-language", ""},
+		{"accept-ranges", ""},
+		{"accept", ""},
+		{"access-control-allow-origin", ""},
+		{"age", ""},
+		{"allow", ""},
+		{"authorization", ""},
+		{"cache-control", ""},
+		{"content-disposition", ""},
+		{"content-encoding", ""},
+		{"content-language", ""},
+		{"content-length", ""},
+		{"content-location", ""},
+		{"content-range", ""},
+		{"content-type", ""},
+		{"cookie", ""},
+		{"date", ""},
+		{"etag", ""},
+		{"expect", ""},
+		{"expires", ""},
+		{"from", ""},
+		{"host", ""},
+		{"if-match", ""},
+		{"if-modified-since", ""},
+		{"if-none-match", ""},
+		{"if-range", ""},
+		{"if-unmodified-since", ""},
+		{"last-modified", ""},
+		{"link", ""},
+		{"location", ""},
+		{"max-forwards", ""},
+		{"proxy-authenticate", ""},
+		{"proxy-authorization", ""},
+		{"range", ""},
+		{"referer", ""},
+		{"refresh", ""},
+		{"retry-after", ""},
+		{"server", ""},
+		{"set-cookie", ""},
+		{"strict-transport-security", ""},
+		{"transfer-encoding", ""},
+		{"user-agent", ""},
+		{"vary", ""},
+		{"via", ""},
+		{"www-authenticate", ""}
+	};
+
+	/**
+	 * The Huffman codes of the 256 octets, aligned to the least significant bit.
+	 */
+	private static final int[] CODES = {
+		0x00001ff8, 0x007fffd8, 0x0fffffe2, 0x0fffffe3, 0x0fffffe4, 0x0fffffe5, 0x0fffffe6, 0x0fffffe7,
+		0x0fffffe8, 0x00ffffea, 0x3ffffffc, 0x0fffffe9, 0x0fffffea, 0x3ffffffd, 0x0fffffeb, 0x0fffffec,
+		0x0fffffed, 0x0fffffee, 0x0fffffef, 0x0ffffff0, 0x0ffffff1, 0x0ffffff2, 0x3ffffffe, 0x0ffffff3,
+		0x0ffffff4, 0x0ffffff5, 0x0ffffff6, 0x0ffffff7, 0x0ffffff8, 0x0ffffff9, 0x0ffffffa, 0x0ffffffb,
+		0x00000014, 0x000003f8, 0x000003f9, 0x00000ffa, 0x00001ff9, 0x00000015, 0x000000f8, 0x000007fa,
+		0x000003fa, 0x000003fb, 0x000000f9, 0x000007fb, 0x000000fa, 0x00000016, 0x00000017, 0x00000018,
+		0x00000000, 0x00000001, 0x00000002, 0x00000019, 0x0000001a, 0x0000001b, 0x0000001c, 0x0000001d,
+		0x0000001e, 0x0000001f, 0x0000005c, 0x000000fb, 0x00007ffc, 0x00000020, 0x00000ffb, 0x000003fc,
+		0x00001ffa, 0x00000021, 0x0000005d, 0x0000005e, 0x0000005f, 0x00000060, 0x00000061, 0x00000062,
+		0x00000063, 0x00000064, 0x00000065, 0x00000066, 0x00000067, 0x00000068, 0x00000069, 0x0000006a,
+		0x0000006b, 0x0000006c, 0x0000006d, 0x0000006e, 0x0000006f, 0x00000070, 0x00000071, 0x00000072,
+		0x000000fc, 0x00000073, 0x000000fd, 0x00001ffb, 0x0007fff0, 0x00001ffc, 0x00003ffc, 0x00000022,
+		0x00007ffd, 0x00000003, 0x00000023, 0x00000004, 0x00000024, 0x00000005, 0x00000025, 0x00000026,
+		0x00000027, 0x00000006, 0x00000074, 0x00000075, 0x00000028, 0x00000029, 0x0000002a, 0x00000007,
+		0x0000002b, 0x00000076, 0x0000002c, 0x00000008, 0x00000009, 0x0000002d, 0x00000077, 0x00000078,
+		0x00000079, 0x0000007a, 0x0000007b, 0x00007ffe, 0x000007fc, 0x00003ffd, 0x00001ffd, 0x0ffffffc,
+		0x000fffe6, 0x003fffd2, 0x000fffe7, 0x000fffe8, 0x003fffd3, 0x003fffd4, 0x003fffd5, 0x007fffd9,
+		0x003fffd6, 0x007fffda, 0x007fffdb, 0x007fffdc, 0x007fffdd, 0x007fffde, 0x00ffffeb, 0x007fffdf,
+		0x00ffffec, 0x00ffffed, 0x003fffd7, 0x007fffe0, 0x00ffffee, 0x007fffe1, 0x007fffe2, 0x007fffe3,
+		0x007fffe4, 0x001fffdc, 0x003fffd8, 0x007fffe5, 0x003fffd9, 0x007fffe6, 0x007fffe7, 0x00ffffef,
+		0x003fffda, 0x001fffdd, 0x000fffe9, 0x003fffdb, 0x003fffdc, 0x007fffe8, 0x007fffe9, 0x001fffde,
+		0x007fffea, 0x003fffdd, 0x003fffde, 0x00fffff0, 0x001fffdf, 0x003fffdf, 0x007fffeb, 0x007fffec,
+		0x001fffe0, 0x001fffe1, 0x003fffe0, 0x001fffe2, 0x007fffed, 0x003fffe1, 0x007fffee, 0x007fffef,
+		0x000fffea, 0x003fffe2, 0x003fffe3, 0x003fffe4, 0x007ffff0, 0x003fffe5, 0x003fffe6, 0x007ffff1,
+		0x03ffffe0, 0x03ffffe1, 0x000fffeb, 0x0007fff1, 0x003fffe7, 0x007ffff2, 0x003fffe8, 0x01ffffec,
+		0x03ffffe2, 0x03ffffe3, 0x03ffffe4, 0x07ffffde, 0x07ffffdf, 0x03ffffe5, 0x00fffff1, 0x01ffffed,
+		0x0007fff2, 0x001fffe3, 0x03ffffe6, 0x07ffffe0, 0x07ffffe1, 0x03ffffe7, 0x07ffffe2, 0x00fffff2,
+		0x001fffe4, 0x001fffe5, 0x03ffffe8, 0x03ffffe9, 0x0ffffffd, 0x07ffffe3, 0x07ffffe4, 0x07ffffe5,
+		0x000fffec, 0x00fffff3, 0x000fffed, 0x001fffe6, 0x003fffe9, 0x001fffe7, 0x001fffe8, 0x007ffff3,
+		0x003fffea, 0x003fffeb, 0x01ffffee, 0x01ffffef, 0x00fffff4, 0x00fffff5, 0x03ffffea, 0x007ffff4,
+		0x03ffffeb, 0x07ffffe6, 0x03ffffec, 0x03ffffed, 0x07ffffe7, 0x07ffffe8, 0x07ffffe9, 0x07ffffea,
+		0x07ffffeb, 0x0ffffffe, 0x07ffffec, 0x07ffffed, 0x07ffffee, 0x07ffffef, 0x07fffff0, 0x03ffffee
+	};
+
+	/**
+	 * The lengths of the Huffman codes in bits.
+	 */
+	private static final byte[] LENGTHS = {
+		13, 23, 28, 28, 28, 28, 28, 28, 28, 24, 30, 28, 28, 30, 28, 28,
+		28, 28, 28, 28, 28, 28, 30, 28, 28, 28, 28, 28, 28, 28, 28, 28,
+		6, 10, 10, 12, 13, 6, 8, 11, 10, 10, 8, 11, 8, 6, 6, 6,
+		5, 5, 5, 6, 6, 6, 6, 6, 6, 6, 7, 8, 15, 6, 12, 10,
+		13, 6, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7,
+		7, 7, 7, 7, 7, 7, 7, 7, 8, 7, 8, 13, 19, 13, 14, 6,
+		15, 5, 6, 5, 6, 5, 6, 6, 6, 5, 7, 7, 6, 6, 6, 5,
+		6, 7, 6, 5, 5, 6, 7, 7, 7, 7, 7, 15, 11, 14, 13, 28,
+		20, 22, 20, 20, 22, 22, 22, 23, 22, 23, 23, 23, 23, 23, 24, 23,
+		24, 24, 22, 23, 24, 23, 23, 23, 23, 21, 22, 23, 22, 23, 23, 24,
+		22, 21, 20, 22, 22, 23, 23, 21, 23, 22, 22, 24, 21, 22, 23, 23,
+		21, 21, 22, 21, 23, 22, 23, 23, 20, 22, 22, 22, 23, 22, 22, 23,
+		26, 26, 20, 19, 22, 23, 22, 25, 26, 26, 26, 27, 27, 26, 24, 25,
+		19, 21, 26, 27, 27, 26, 27, 24, 21, 21, 26, 26, 28, 27, 27, 27,
+		20, 24, 20, 21, 22, 21, 21, 23, 22, 22, 25, 25, 24, 24, 26, 23,
+		26, 27, 26, 26, 27, 27, 27, 27, 27, 28, 27, 27, 27, 27, 27, 26
+	};
+
+	/**
+	 * The end of string symbol, whose code is only used as padding.
+	 */
+	private static final int EOS = 256;
+
+	/**
+	 * The decoding tree of the Huffman code, the children of node n are at 2n and 2n+1, a leaf stores the negated
+	 * symbol minus one.
+	 */
+	private static final int[] TREE;
+
+	static {
+		final int[] tree = new int[2 * EOS];
+		int nodes = 1;
+		for (int symbol=0; symbol <= EOS; symbol++) {
+			final int code = symbol==EOS ? 0x3fffffff : CODES[symbol];
+			final int length = symbol==EOS ? 30 : LENGTHS[symbol];
+			int node = 0;
+			for (int i=length - 1; i > 0; i--) {
+				final int child = 2 * node + ((code >>> i) & 1);
+				if (tree[child]==0) tree[child] = nodes++;
+				node = tree[child];
+			}
+			tree[2 * node + (code & 1)] = -symbol - 1;
+		}
+		TREE = tree;
+	}
+
+	private UHpack() {}
+
+	/**
+	 * Returns the name of the entry of the static table with the given index.
+	 * @param index
+	 * the index from 1 to {@link #STATIC_TABLE_LENGTH}.
+	 * @return
+	 * the name.
+	 */
+	public static String staticName( final int index ) {
+		return STATIC_TABLE[index - 1][0];
+	}
+
+	/**
+	 * Returns the value of the entry of the static table with the given index.
+	 * @param index
+	 * the index from 1 to {@link #STATIC_TABLE_LENGTH}.
+	 * @return
+	 * the value, an empty string if the entry has no value.
+	 */
+	public static String staticValue( final int index ) {
+		return STATIC_TABLE[index - 1][1];
+	}
+
+	/**
+	 * Returns the index of the entry of the static table with the given name and value.
+	 * @param name
+	 * the lower case name.
+	 * @param value
+	 * the value.
+	 * @return
+	 * the index of the entry with the name and the value, the negated index of the first entry with the name or zero.
+	 */
+	public static int staticIndex( final String name, final String value ) {
+		int nameIndex = 0;
+		for (int i=0; i < STATIC_TABLE_LENGTH; i++) {
+			if (!STATIC_TABLE[i][0].equals(name)) continue;
+			if (STATIC_TABLE[i][1].equals(value)) return i + 1;
+			if (nameIndex==0) nameIndex = -(i + 1);
+		}
+		return nameIndex;
+	}
+
+	/**
+	 * Writes an integer with the given prefix length.
+	 * @param out
+	 * the stream to write to.
+	 * @param mask
+	 * the bits before the prefix in the first octet.
+	 * @param prefixBits
+	 * the length of the prefix, from 1 to 8.
+	 * @param value
+	 * the non-negative integer.
+	 */
+	public static void writeInt( final ByteArrayOutputStream out, final int mask, final int prefixBits, final int value ) {
+		final int max = (1 << prefixBits) - 1;
+		if (value < max) {
+			out.write(mask | value);
+			return;
+		}
+		out.write(mask | max);
+		int rest = value - max;
+		while (rest >= 0x80) {
+			out.write((rest & 0x7f) | 0x80);
+			rest >>>= 7;
+		}
+		out.write(rest);
+	}
+
+	/**
+	 * Reads an integer with the given prefix length.
+	 * @param in
+	 * the bytes.
+	 * @param pos
+	 * the position of the first octet, updated to the position after the integer.
+	 * @param prefixBits
+	 * the length of the prefix, from 1 to 8.
+	 * @return
+	 * the integer.
+	 * @throws UHttp2Exception
+	 * if the integer is truncated or exceeds 2^31-1.
+	 */
+	public static int readInt( final byte[] in, final int[] pos, final int prefixBits ) throws UHttp2Exception {
+		if (pos[0] >= in.length) throw new UHttp2Exception(UHttp2Frame.COMPRESSION_ERROR, "Truncated integer");
+		final int max = (1 << prefixBits) - 1;
+		long value = in[pos[0]++] & max;
+		if (value < max) return (int)value;
+		for (int shift=0; ; shift+=7) {
+			if (pos[0] >= in.length) throw new UHttp2Exception(UHttp2Frame.COMPRESSION_ERROR, "Truncated integer");
+			final int b = in[pos[0]++] & 0xff;
+			value += (long)(b & 0x7f) << shift;
+			if (value > Integer.MAX_VALUE || shift > 28) throw new UHttp2Exception(UHttp2Frame.COMPRESSION_ERROR, "Integer overflow");
+			if ((b & 0x80)==0) return (int)value;
+		}
+	}
+
+	/**
+	 * Writes a string literal, Huffman coded if that is shorter.
+	 * @param out
+	 * the stream to write to.
+	 * @param s
+	 * the string, whose characters must be octets.
+	 */
+	public static void writeString( final ByteArrayOutputStream out, final String s ) {
+		final byte[] raw = toBytes(s);
+		final int huffmanLength = huffmanLength(raw);
+		if (huffmanLength < raw.length) {
+			writeInt(out, 0x80, 7, huffmanLength);
+			final byte[] coded = huffmanEncode(raw);
+			out.write(coded, 0, coded.length);
+		} else {
+			writeInt(out, 0, 7, raw.length);
+			out.write(raw, 0, raw.length);
+		}
+	}
+
+	/**
+	 * Reads a string literal.
+	 * @param in
+	 * the bytes.
+	 * @param pos
+	 * the position of the first octet, updated to the position after the string.
+	 * @return
+	 * the string with one character per octet.
+	 * @throws UHttp2Exception
+	 * if the string is truncated or the Huffman code is invalid.
+	 */
+	public static String readString( final byte[] in, final int[] pos ) throws UHttp2Exception {
+		if (pos[0] >= in.length) throw new UHttp2Exception(UHttp2Frame.COMPRESSION_ERROR, "Truncated string");
+		final boolean huffman = (in[pos[0]] & 0x80)!=0;
+		final int length = readInt(in, pos, 7);
+		if (length > in.length - pos[0]) throw new UHttp2Exception(UHttp2Frame.COMPRESSION_ERROR, "Truncated string");
+		final int offset = pos[0];
+		pos[0] += length;
+		if (huffman) return new String(huffmanDecode(in, offset, length), StandardCharsets.ISO_8859_1);
+		return new String(in, offset, length, StandardCharsets.ISO_8859_1);
+	}
+
+	/**
+	 * Returns the length of the Huffman code of the given octets.
+	 * @param data
+	 * the octets.
+	 * @return
+	 * the length in bytes, including the padding.
+	 */
+	public static int huffmanLength( final byte[] data ) {
+		long bits = 0;
+		for (final byte b : data) bits += LENGTHS[b & 0xff];
+		return (int)((bits + 7) >>> 3);
+	}
+
+	/**
+	 * Encodes the given octets with the Huffman code, the last octet is padded with the most significant bits of the
+	 * end of string symbol.
+	 * @param data
+	 * the octets.
+	 * @return
+	 * the code.
+	 */
+	public static byte[] huffmanEncode( final byte[] data ) {
+		final byte[] out = new byte[huffmanLength(data)];
+		long current = 0;
+		int bits = 0, pos = 0;
+		for (final byte b : data) {
+			final int length = LENGTHS[b & 0xff];
+			current = (current << length) | CODES[b & 0xff];
+			bits += length;
+			while (bits >= 8) {
+				bits -= 8;
+				out[pos++] = (byte)(current >>> bits);
+			}
+		}
+		if (bits > 0) out[pos] = (byte)((current << (8 - bits)) | (0xff >>> bits));
+		return out;
+	}
+
+	/**
+	 * Decodes a Huffman code.
+	 * @param in
+	 * the bytes.
+	 * @param offset
+	 * the offset of the code.
+	 * @param length
+	 * the length of the code.
+	 * @return
+	 * the octets.
+	 * @throws UHttp2Exception
+	 * if the code contains the end of string symbol or the padding is longer than 7 bits or not all ones.
+	 */
+	public static byte[] huffmanDecode( final byte[] in, final int offset, final int length ) throws UHttp2Exception {
+		final ByteArrayOutputStream out = new ByteArrayOutputStream(length * 8 / 5 + 1);
+		int node = 0, depth = 0;
+		boolean ones = true;
+		for (int i=offset; i < offset + length; i++) {
+			final int b = in[i] & 0xff;
+			for (int bit=7; bit >= 0; bit--) {
+				final int value = (b >>> bit) & 1;
+				final int next = TREE[2 * node + value];
+				if (next < 0) {
+					if (-next - 1==EOS) throw new UHttp2Exception(UHttp2Frame.COMPRESSION_ERROR, "End of string symbol in Huffman code");
+					out.write(-next - 1);
+					node = 0;
+					depth = 0;
+					ones = true;
+				} else {
+					node = next;
+					depth++;
+					ones &= value==1;
+				}
+			}
+		}
+		if (depth > 7 || !ones) throw new UHttp2Exception(UHttp2Frame.COMPRESSION_ERROR, "Invalid Huffman padding");
+		return out.toByteArray();
+	}
+
+	/**
+	 * Converts a string into octets, one octet per character.
+	 */
+	static byte[] toBytes( final String s ) {
+		return s.getBytes(StandardCharsets.ISO_8859_1);
+	}
+
+	/**
+	 * The dynamic table shared by the encoder and the decoder of a direction, the newest entry has the lowest index.
+	 */
+	static final class DynamicTable {
+		/**
+		 * Create a new table.
+		 * @param capacity
+		 * the maximal size in bytes.
+		 */
+		DynamicTable( final int capacity ) {
+			this.capacity = capacity;
+		}
+
+		/**
+		 * The entries as circular buffer, name and value alternating.
+		 */
+		private String[] entries = new String[32];
+
+		/**
+		 * The position of the newest entry in the circular buffer.
+		 */
+		private int head;
+
+		/**
+		 * The amount of entries.
+		 */
+		private int length;
+
+		/**
+		 * The size in bytes as defined by RFC 7541.
+		 */
+		private int size;
+
+		/**
+		 * The maximal size in bytes.
+		 */
+		private int capacity;
+
+		/**
+		 * Returns the amount of entries.
+		 */
+		int length() {
+			return length;
+		}
+
+		/**
+		 * Returns the maximal size in bytes.
+		 */
+		int capacity() {
+			return capacity;
+		}
+
+		/**
+		 * Returns the name of the entry with the given index, starting at zero.
+		 */
+		String name( final int index ) {
+			return entries[slot(index)];
+		}
+
+		/**
+		 * Returns the value of the entry with the given index, starting at zero.
+		 */
+		String value( final int index ) {
+			return entries[slot(index) + 1];
+		}
+
+		/**
+		 * Adds an entry, evicts the oldest entries until it fits. An entry larger than the capacity empties the table.
+		 */
+		void add( final String name, final String value ) {
+			final int entrySize = name.length() + value.length() + ENTRY_OVERHEAD;
+			evict(capacity - entrySize);
+			if (entrySize > capacity) return;
+			if (2 * length==entries.length) {
+				final String[] grown = new String[entries.length * 2];
+				for (int i=0; i < length; i++) {
+					grown[2 * (length - 1 - i)] = name(i);
+					grown[2 * (length - 1 - i) + 1] = value(i);
+				}
+				entries = grown;
+				head = length - 1;
+			}
+			head = (head + 1) % (entries.length / 2);
+			entries[2 * head] = name;
+			entries[2 * head + 1] = value;
+			length++;
+			size += entrySize;
+		}
+
+		/**
+		 * Changes the maximal size, evicts the oldest entries until the table fits.
+		 */
+		void setCapacity( final int capacity ) {
+			this.capacity = capacity;
+			evict(capacity);
+		}
+
+		/**
+		 * Evicts the oldest entries until the size is at most the given size.
+		 */
+		private void evict( final int maxSize ) {
+			while (length > 0 && size > maxSize) {
+				final int slot = slot(length - 1);
+				size -= entries[slot].length() + entries[slot + 1].length() + ENTRY_OVERHEAD;
+				entries[slot] = null;
+				entries[slot + 1] = null;
+				length--;
+			}
+		}
+
+		/**
+		 * Returns the position of the name of the entry with the given index.
+		 */
+		private int slot( final int index ) {
+			final int slots = entries.length / 2;
+			return 2 * ((head - index + slots) % slots);
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package com.umpani.aio.http2;
+
+import com.umpani.aio.exception.UHttp2Exception;
+import com.umpani.aio.http.UHttpHeaders;
+
+/**
+ * Decodes HPACK header blocks, one decoder per connection, as the decoded blocks update its dynamic table. The
+ * pseudo-header fields like <tt>:method</tt> are decoded into the headers as well. A header list that exceeds the
+ * maximal size is still decoded completely, so that the dynamic table stays in sync with the peer, but the fields
+ * beyond the limit are dropped and {@link #decode(byte[], UHttpHeaders)} returns false. A block that can't be
+ * decoded is a connection error of type COMPRESSION_ERROR.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHpackDecoder {
+	/**
+	 * Create a new decoder.
+	 * @param maxTableSize
+	 * the maximal size of the dynamic table, as announced in the own settings.
+	 * @param maxHeaderListSize
+	 * the maximal size of a decoded header list, the sum of the lengths of the names and values plus 32 per field.
+	 */
+	public UHpackDecoder( final int maxTableSize, final long maxHeaderListSize ) {
+		if (maxTableSize < 0) throw new IllegalArgumentException("maxTableSize: "+maxTableSize);
+		if (maxHeaderListSize < 0) throw new IllegalArgumentException("maxHeaderListSize: "+maxHeaderListSize);
+		this.maxTableSize = maxTableSize;
+		this.maxHeaderListSize = maxHeaderListSize;
+		this.table = new UHpack.DynamicTable(maxTableSize);
+	}
+
+	/**
+	 * The maximal size of the dynamic table the peer may use.
+	 */
+	private final int maxTableSize;
+
+	/**
+	 * The maximal size of a header list.
+	 */
+	private final long maxHeaderListSize;
+
+	/**
+	 * The dynamic table.
+	 */
+	private final UHpack.DynamicTable table;
+
+	/**
+	 * Decodes a header block and adds the fields to the given headers.
+	 * @param block
+	 * the header block, assembled from a HEADERS frame and its CONTINUATION frames.
+	 * @param headers
+	 * the headers to add the fields to.
+	 * @return
+	 * false if the header list exceeds the maximal size and not all fields were added.
+	 * @throws UHttp2Exception
+	 * if the block can't be decoded.
+	 */
+	public boolean decode( final byte[] block, final UHttpHeaders headers ) throws UHttp2Exception {
+		final int[] pos = {0};
+		long listSize = 0;
+		boolean fieldSeen = false;
+		while (pos[0] < block.length) {
+			final int b = block[pos[0]] & 0xff;
+			final String name, value;
+			if ((b & 0x80)!=0) {
+				final int index = UHpack.readInt(block, pos, 7);
+				name = name(index);
+				value = value(index);
+			} else
+			if ((b & 0xe0)==0x20) {
+				if (fieldSeen) throw new UHttp2Exception(UHttp2Frame.COMPRESSION_ERROR, "Dynamic table size update after a header field");
+				final int size = UHpack.readInt(block, pos, 5);
+				if (size > maxTableSize) throw new UHttp2Exception(UHttp2Frame.COMPRESSION_ERROR, "Dynamic table size "+size+" exceeds "+maxTableSize);
+				table.setCapacity(size);
+				continue;
+			} else {
+				// literal with incremental indexing (01), without indexing (0000) or never indexed (0001)
+				final boolean indexing = (b & 0xc0)==0x40;
+				final int index = UHpack.readInt(block, pos, indexing ? 6 : 4);
+				name = index==0 ? UHpack.readString(block, pos) : name(index);
+				value = UHpack.readString(block, pos);
+				if (indexing) table.add(name, value);
+			}
+			fieldSeen = true;
+			listSize += name.length() + value.length() + UHpack.ENTRY_OVERHEAD;
+			if (listSize <= maxHeaderListSize) headers.add(name, value);
+		}
+		return listSize <= maxHeaderListSize;
+	}
+
+	/**
+	 * Returns the name of the entry with the given index of the static or dynamic table.
+	 */
+	private String name( final int index ) throws UHttp2Exception {
+		if (index > 0 && index <= UHpack.STATIC_TABLE_LENGTH) return UHpack.staticName(index);
+		return table.name(dynamicIndex(index));
+	}
+
+	/**
+	 * Returns the value of the entry with the given index of the static or dynamic table.
+	 */
+	private String value( final int index ) throws UHttp2Exception {
+		if (index > 0 && index <= UHpack.STATIC_TABLE_LENGTH) return UHpack.staticValue(index);
+		return table.value(dynamicIndex(index));
+	}
+
+	/**
+	 * Converts an index into an index of the dynamic table.
+	 */
+	private int dynamicIndex( final int index ) throws UHttp2Exception {
+		final int dynamic = index - UHpack.STATIC_TABLE_LENGTH - 1;
+		if (index==0 || dynamic >= table.length()) throw new UHttp2Exception(UHttp2Frame.COMPRESSION_ERROR, "Invalid index "+index);
+		return dynamic;
+	}
+}
@@ -0,0 +1,111 @@
+package com.umpani.aio.http2;
+
+import java.io.ByteArrayOutputStream;
+
+import com.umpani.aio.http.UHttpHeaders;
+
+/**
+ * Encodes header lists into HPACK header blocks, one encoder per connection. A field is encoded as index if the
+ * static or the dynamic table contains it, otherwise as literal that is added to the dynamic table. Sensitive fields,
+ * like credentials and cookies, are never indexed, so they can't be guessed by probing the compression. Names are
+ * written in lower case as required by HTTP/2, strings are Huffman coded if that is shorter.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHpackEncoder {
+	/**
+	 * Create a new encoder with the default size of the dynamic table.
+	 */
+	public UHpackEncoder() {
+		this.table = new UHpack.DynamicTable(UHpack.DEFAULT_TABLE_SIZE);
+	}
+
+	/**
+	 * The dynamic table.
+	 */
+	private final UHpack.DynamicTable table;
+
+	/**
+	 * True if a dynamic table size update must be written at the start of the next block.
+	 */
+	private boolean sizeUpdatePending;
+
+	/**
+	 * Changes the maximal size of the dynamic table, called when the settings of the peer change. The encoder never
+	 * uses more than the default size of 4096 bytes.
+	 * @param maxTableSize
+	 * the maximal size announced by the peer.
+	 */
+	public void setMaxTableSize( final int maxTableSize ) {
+		final int capacity = Math.min(maxTableSize, UHpack.DEFAULT_TABLE_SIZE);
+		if (capacity==table.capacity()) return;
+		table.setCapacity(capacity);
+		sizeUpdatePending = true;
+	}
+
+	/**
+	 * Returns true if the field with the given name is never indexed.
+	 * @param name
+	 * the lower case name.
+	 * @param value
+	 * the value.
+	 * @return
+	 * true for sensitive fields.
+	 */
+	protected boolean isSensitive( final String name, final String value ) {
+		switch (name) {
+			case "authorization":
+			case "proxy-authorization":
+			case "cookie":
+			case "set-cookie":
+				return true;
+			default:
+				return false;
+		}
+	}
+
+	/**
+	 * Encodes the given header list.
+	 * @param headers
+	 * the headers, the pseudo-header fields must come first.
+	 * @return
+	 * the header block.
+	 */
+	public byte[] encode( final UHttpHeaders headers ) {
+		final ByteArrayOutputStream out = new ByteArrayOutputStream();
+		if (sizeUpdatePending) {
+			UHpack.writeInt(out, 0x20, 5, table.capacity());
+			sizeUpdatePending = false;
+		}
+		for (int i=0; i < headers.size(); i++) {
+			final String name = headers.name(i).toLowerCase();
+			final String value = headers.value(i);
+			final boolean sensitive = isSensitive(name, value);
+			int nameIndex = UHpack.staticIndex(name, value);
+			if (nameIndex > 0 && sensitive) nameIndex = -nameIndex;
+			if (nameIndex > 0) {
+				UHpack.writeInt(out, 0x80, 7, nameIndex);
+				continue;
+			}
+			for (int j=0; j < table.length() && nameIndex <= 0; j++) {
+				if (!table.name(j).equals(name)) continue;
+				final int index = UHpack.STATIC_TABLE_LENGTH + 1 + j;
+				if (!sensitive && table.value(j).equals(value)) nameIndex = index;
+				else if (nameIndex==0) nameIndex = -index;
+			}
+			if (nameIndex > 0) {
+				UHpack.writeInt(out, 0x80, 7, nameIndex);
+				continue;
+			}
+			if (sensitive) {
+				UHpack.writeInt(out, 0x10, 4, -nameIndex);
+			} else {
+				UHpack.writeInt(out, 0x40, 6, -nameIndex);
+				table.add(name, value);
+			}
+			if (nameIndex==0) UHpack.writeString(out, name);
+			UHpack.writeString(out, value);
+		}
+		return out.toByteArray();
+	}
+}
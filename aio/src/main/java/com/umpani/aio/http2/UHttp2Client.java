@@ -0,0 +1,581 @@
+package com.umpani.aio.http2;
+
+import java.io.IOException;
+import java.net.InetSocketAddress;
+import java.net.URI;
+import java.net.URISyntaxException;
+import java.nio.channels.ClosedChannelException;
+import java.security.GeneralSecurityException;
+import java.util.ArrayDeque;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.TimeUnit;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UClient;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.USocketChannel;
+import com.umpani.aio.exception.UHttp2Exception;
+import com.umpani.aio.exception.UHttpException;
+import com.umpani.aio.http.UHttpDecoder;
+import com.umpani.aio.http.UHttpHeaders;
+import com.umpani.aio.http.UHttpMessage;
+import com.umpani.aio.http.UHttpRequest;
+import com.umpani.aio.http.UHttpResponse;
+import com.umpani.aio.ssl.USslContext;
+import com.umpani.aio.ssl.USslHandler;
+
+/**
+ * A non-blocking HTTP/2 client. Requests are sent with an absolute <tt>http</tt> or <tt>https</tt> URL as request
+ * target, all requests to the same host and port are multiplexed on one connection. <tt>http</tt> connections use
+ * HTTP/2 with prior knowledge (h2c), so the server must accept it without upgrade; <tt>https</tt> connections
+ * negotiate <tt>h2</tt> with ALPN and fail if the server does not select it. Requests beyond the limit of concurrent
+ * streams of the server wait for a free stream.
+ *
+ * </p><p>Once the server sends a GOAWAY frame, the following requests open a new connection. Requests that the server
+ * refused without processing them are retried once.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttp2Client {
+	/**
+	 * The default connect timeout in milliseconds.
+	 */
+	public static final long DEFAULT_CONNECT_TIMEOUT = 10000L;
+
+	/**
+	 * Create a new client that uses the default buffer pool.
+	 * @param group
+	 * the event loops.
+	 */
+	public UHttp2Client( final UEventLoopGroup group ) {
+		this(group, UBufferPool.DEFAULT);
+	}
+
+	/**
+	 * Create a new client.
+	 * @param group
+	 * the event loops.
+	 * @param alloc
+	 * the buffer pool of the connections.
+	 */
+	public UHttp2Client( final UEventLoopGroup group, final UBufferPool alloc ) {
+		this.group = group;
+		this.alloc = alloc;
+	}
+
+	/**
+	 * The event loops.
+	 */
+	protected final UEventLoopGroup group;
+
+	/**
+	 * The buffer pool of the connections.
+	 */
+	protected final UBufferPool alloc;
+
+	/**
+	 * The connections by scheme, host and port.
+	 */
+	private final ConcurrentHashMap<String,UFuture<Connection>> connections = new ConcurrentHashMap<>();
+
+	/**
+	 * The connect timeout in milliseconds.
+	 */
+	private volatile long connectTimeout = DEFAULT_CONNECT_TIMEOUT;
+
+	/**
+	 * The maximal size of a response body.
+	 */
+	private volatile int maxBodySize = UHttpDecoder.DEFAULT_MAX_BODY_SIZE;
+
+	/**
+	 * The TLS configuration or null.
+	 */
+	private volatile USslContext sslContext;
+
+	/**
+	 * True once the client was closed.
+	 */
+	private volatile boolean closed;
+
+	/**
+	 * Sets the TLS configuration of https connections opened afterwards, it must offer <tt>h2</tt> with ALPN.
+	 * @param sslContext
+	 * the client context or null, to use the default trust store of the JVM.
+	 * @return
+	 * this.
+	 */
+	public UHttp2Client setSslContext( final USslContext sslContext ) {
+		if (sslContext!=null && !sslContext.isClient()) throw new IllegalArgumentException("Client context required");
+		this.sslContext = sslContext;
+		return this;
+	}
+
+	/**
+	 * Sets the connect timeout of connections opened afterwards.
+	 * @param millis
+	 * the timeout in milliseconds, zero for no timeout.
+	 * @return
+	 * this.
+	 */
+	public UHttp2Client setConnectTimeout( final long millis ) {
+		if (millis < 0) throw new IllegalArgumentException("millis: "+millis);
+		this.connectTimeout = millis;
+		return this;
+	}
+
+	/**
+	 * Sets the maximal size of a response body of connections opened afterwards, requests with larger responses fail
+	 * with status 413.
+	 * @param maxBodySize
+	 * the maximal size in bytes.
+	 * @return
+	 * this.
+	 */
+	public UHttp2Client setMaxBodySize( final int maxBodySize ) {
+		if (maxBodySize < 0) throw new IllegalArgumentException("maxBodySize: "+maxBodySize);
+		this.maxBodySize = maxBodySize;
+		return this;
+	}
+
+	/**
+	 * Returns the amount of open connections.
+	 * @return
+	 * the amount of open connections.
+	 */
+	public int connections() {
+		int count = 0;
+		for (final UFuture<Connection> future : connections.values()) {
+			if (future.isSuccess() && future.getNow().isUsable()) count++;
+		}
+		return count;
+	}
+
+	/**
+	 * Sends a GET request.
+	 * @param url
+	 * the absolute URL.
+	 * @return
+	 * the future of the response.
+	 */
+	public UFuture<UHttpResponse> get( final String url ) {
+		return send(new UHttpRequest("GET", url));
+	}
+
+	/**
+	 * Sends a request.
+	 * @param request
+	 * the request with an absolute URL as request target.
+	 * @return
+	 * the future of the response, cancelling it resets the stream.
+	 */
+	public UFuture<UHttpResponse> send( final UHttpRequest request ) {
+		if (closed) return UFuture.failed(new IllegalStateException("Client closed"));
+		final URI uri;
+		try {
+			uri = target(request.uri());
+		} catch (IllegalArgumentException e) {
+			return UFuture.failed(e);
+		}
+		final Call call = new Call(request, uri);
+		call.promise.onCancel(new Runnable() {
+			@Override
+			public void run() {
+				final Connection connection = call.connection;
+				if (connection!=null) connection.cancel(call);
+			}
+		});
+		dispatch(call);
+		return call.promise;
+	}
+
+	/**
+	 * Closes all connections, requests that are in progress fail and further requests are rejected.
+	 */
+	public void close() {
+		closed = true;
+		for (final UFuture<Connection> future : connections.values()) {
+			future.addListener(new UFutureListener<Connection>() {
+				@Override
+				public void complete( final UFuture<Connection> future ) {
+					if (future.isSuccess()) future.getNow().close();
+				}
+			}, null);
+		}
+		connections.clear();
+	}
+
+	@Override
+	public String toString() {
+		return "UHttp2Client["+connections.keySet()+"]";
+	}
+
+	/**
+	 * Parses and validates the absolute URL of a request.
+	 */
+	private static URI target( final String url ) {
+		final URI uri;
+		try {
+			uri = new URI(url);
+		} catch (URISyntaxException e) {
+			throw new IllegalArgumentException("Invalid URL: "+url, e);
+		}
+		if (!("http".equalsIgnoreCase(uri.getScheme()) || "https".equalsIgnoreCase(uri.getScheme())) || uri.getHost()==null) {
+			throw new IllegalArgumentException("Absolute http or https URL required: "+url);
+		}
+		return uri;
+	}
+
+	/**
+	 * Returns true if the given URL requires TLS.
+	 */
+	private static boolean isSecure( final URI uri ) {
+		return "https".equalsIgnoreCase(uri.getScheme());
+	}
+
+	/**
+	 * Returns the port of the given URL or the default port of its scheme.
+	 */
+	private static int port( final URI uri ) {
+		return uri.getPort() >= 0 ? uri.getPort() : isSecure(uri) ? 443 : 80;
+	}
+
+	/**
+	 * Sends the given call with the connection of its host, opens a new connection if there is none or the current
+	 * one goes away.
+	 */
+	private void dispatch( final Call call ) {
+		if (closed) {
+			call.promise.fail(new IllegalStateException("Client closed"));
+			return;
+		}
+		final URI uri = call.uri;
+		final String key = uri.getScheme().toLowerCase()+"://"+uri.getHost().toLowerCase()+":"+port(uri);
+		UFuture<Connection> future;
+		for (;;) {
+			final UFuture<Connection> current = connections.get(key);
+			if (current!=null && !(current.isDone() && !(current.isSuccess() && current.getNow().isUsable()))) {
+				future = current;
+				break;
+			}
+			final UPromise<Connection> promise = new UPromise<Connection>(null);
+			if (current==null ? connections.putIfAbsent(key, promise)==null : connections.replace(key, current, promise)) {
+				connect(uri, promise);
+				future = promise;
+				break;
+			}
+		}
+		future.addListener(new UFutureListener<Connection>() {
+			@Override
+			public void complete( final UFuture<Connection> future ) {
+				if (future.isSuccess()) {
+					future.getNow().send(call);
+				} else {
+					call.promise.fail(future.cause());
+				}
+			}
+		}, null);
+	}
+
+	/**
+	 * Opens a connection to the host of the given URL, encrypted connections must negotiate <tt>h2</tt>.
+	 */
+	private void connect( final URI uri, final UPromise<Connection> promise ) {
+		final String host = uri.getHost();
+		final int port = port(uri);
+		USslContext sslContext = null;
+		if (isSecure(uri)) {
+			sslContext = this.sslContext;
+			try {
+				if (sslContext==null) sslContext = USslContext.forClient().setApplicationProtocols("h2");
+			} catch (GeneralSecurityException | UnsupportedOperationException e) {
+				promise.fail(e);
+				return;
+			}
+		}
+		final USslContext ssl = sslContext;
+		final int maxBodySize = this.maxBodySize;
+		final UClient client = new UClient(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				if (ssl!=null) channel.pipeline().addLast(ssl.newHandler(host, port));
+				channel.pipeline().addLast(new UHttp2FrameDecoder(false, UHttp2Frame.DEFAULT_MAX_FRAME_SIZE), new UHttp2FrameEncoder(true), new Connection(maxBodySize));
+			}
+		}, alloc);
+		UFuture<USocketChannel> future = client.connect(new InetSocketAddress(host, port));
+		final long connectTimeout = this.connectTimeout;
+		if (connectTimeout > 0) future = future.withTimeout(connectTimeout, TimeUnit.MILLISECONDS);
+		future.addListener(new UFutureListener<USocketChannel>() {
+			@Override
+			public void complete( final UFuture<USocketChannel> future ) {
+				if (!future.isSuccess()) {
+					promise.fail(future.cause());
+					return;
+				}
+				final USocketChannel channel = future.getNow();
+				final Connection connection = channel.pipeline().get(Connection.class);
+				final USslHandler handler = channel.pipeline().get(USslHandler.class);
+				if (handler==null) {
+					promise.complete(connection);
+					return;
+				}
+				handler.handshakeFuture().addListener(new UFutureListener<USslHandler>() {
+					@Override
+					public void complete( final UFuture<USslHandler> future ) {
+						if (!future.isSuccess()) {
+							promise.fail(future.cause());
+							channel.close();
+						} else
+						if (!"h2".equals(handler.applicationProtocol())) {
+							promise.fail(new IOException("Server "+host+":"+port+" did not negotiate h2"));
+							channel.close();
+						} else {
+							promise.complete(connection);
+						}
+					}
+				}, null);
+			}
+		}, null);
+	}
+
+	/**
+	 * A request.
+	 */
+	private static final class Call {
+		Call( final UHttpRequest request, final URI uri ) {
+			this.request = request;
+			this.uri = uri;
+		}
+
+		/**
+		 * The request as given by the user.
+		 */
+		final UHttpRequest request;
+
+		/**
+		 * The URL of the request.
+		 */
+		final URI uri;
+
+		/**
+		 * The promise of the response.
+		 */
+		final UPromise<UHttpResponse> promise = new UPromise<UHttpResponse>(null);
+
+		/**
+		 * The connection that sends the request or null.
+		 */
+		volatile Connection connection;
+
+		/**
+		 * The stream of the request, accessed by the event loop of the connection only.
+		 */
+		UHttp2Stream stream;
+
+		/**
+		 * True once the request was retried after it was refused.
+		 */
+		volatile boolean retried;
+	}
+
+	/**
+	 * The handler of a connection.
+	 */
+	private final class Connection extends UHttp2ConnectionHandler {
+		Connection( final int maxBodySize ) {
+			super(false, new UHttp2Settings().setEnablePush(false), maxBodySize);
+		}
+
+		/**
+		 * The calls waiting for a stream, accessed by the event loop only.
+		 */
+		private final ArrayDeque<Call> queued = new ArrayDeque<>();
+
+		/**
+		 * True once the settings of the server were received, accessed by the event loop only.
+		 */
+		private boolean ready;
+
+		/**
+		 * False once the connection goes away.
+		 */
+		private volatile boolean usable = true;
+
+		/**
+		 * Returns true if new requests may be sent with this connection.
+		 */
+		boolean isUsable() {
+			return usable;
+		}
+
+		/**
+		 * Sends a call, may be invoked by any thread.
+		 */
+		void send( final Call call ) {
+			final UHandlerContext ctx = context();
+			if (ctx.loop().inEventLoop()) {
+				doSend(call);
+				return;
+			}
+			ctx.loop().execute(new Runnable() {
+				@Override
+				public void run() {
+					doSend(call);
+				}
+			});
+		}
+
+		/**
+		 * Cancels a call, may be invoked by any thread.
+		 */
+		void cancel( final Call call ) {
+			context().loop().execute(new Runnable() {
+				@Override
+				public void run() {
+					if (call.stream==null) {
+						queued.remove(call);
+						return;
+					}
+					reset(call.stream, UHttp2Frame.CANCEL, "Cancelled");
+					context().flush();
+				}
+			});
+		}
+
+		/**
+		 * Closes the connection.
+		 */
+		void close() {
+			usable = false;
+			context().close();
+		}
+
+		/**
+		 * Opens a stream for the given call and sends its request, queues it if no stream can be opened yet.
+		 */
+		private void doSend( final Call call ) {
+			if (call.promise.isDone()) return;
+			if (isGoingAway()) {
+				// the request was not sent, so it may use the next connection
+				usable = false;
+				dispatch(call);
+				return;
+			}
+			if (!ready || !canOpenStream()) {
+				queued.add(call);
+				return;
+			}
+			final UHttp2Stream stream = newStream();
+			stream.setAttachment(call);
+			call.connection = this;
+			call.stream = stream;
+			final URI uri = call.uri;
+			String path = uri.getRawPath();
+			if (path==null || path.isEmpty()) path = "/";
+			if (uri.getRawQuery()!=null) path += "?"+uri.getRawQuery();
+			final UHttpRequest request = new UHttpRequest(call.request.method(), path, UHttpMessage.HTTP_2);
+			final UHttpHeaders headers = call.request.headers();
+			for (int i=0; i < headers.size(); i++) {
+				if (!headers.name(i).equalsIgnoreCase(UHttpHeaders.HOST)) request.headers().add(headers.name(i), headers.value(i));
+			}
+			request.setBody(call.request.body());
+			request.setStreamer(call.request.streamer());
+			final UHttpHeaders pseudo = new UHttpHeaders()
+				.add(":method", request.method())
+				.add(":scheme", uri.getScheme().toLowerCase())
+				.add(":authority", uri.getPort() < 0 ? uri.getHost() : uri.getHost()+":"+uri.getPort())
+				.add(":path", path);
+			writeMessage(stream, pseudo, request, request, false);
+		}
+
+		/**
+		 * Sends the queued calls as far as streams are available.
+		 */
+		private void drain() {
+			while (!queued.isEmpty() && (isGoingAway() || (ready && canOpenStream()))) doSend(queued.poll());
+		}
+
+		@Override
+		protected UHttpMessage newMessage( final UHttp2Stream stream, final UHttpHeaders headers ) throws UHttp2Exception {
+			String status = null;
+			for (int i=0; i < headers.size(); i++) {
+				final String name = headers.name(i);
+				if (!name.startsWith(":")) break;
+				if (!name.equals(":status") || status!=null) throw new UHttp2Exception(stream.id(), UHttp2Frame.PROTOCOL_ERROR, "Unexpected pseudo-header field "+name);
+				status = headers.value(i);
+			}
+			if (status==null) throw new UHttp2Exception(stream.id(), UHttp2Frame.PROTOCOL_ERROR, "Missing :status");
+			final int code;
+			try {
+				code = Integer.parseInt(status);
+			} catch (NumberFormatException e) {
+				throw new UHttp2Exception(stream.id(), UHttp2Frame.PROTOCOL_ERROR, "Invalid :status "+status);
+			}
+			if (code < 100 || code > 999 || code==101) throw new UHttp2Exception(stream.id(), UHttp2Frame.PROTOCOL_ERROR, "Invalid :status "+status);
+			// interim responses are skipped
+			if (code < 200) return null;
+			final UHttpResponse response = new UHttpResponse(code);
+			response.setVersion(UHttpMessage.HTTP_2);
+			for (int i=0; i < headers.size(); i++) {
+				final String name = headers.name(i);
+				if (!name.startsWith(":")) response.headers().add(name, headers.value(i));
+			}
+			return response;
+		}
+
+		@Override
+		protected void messageReceived( final UHttp2Stream stream, final UHttpMessage message ) {
+			final Call call = (Call)stream.getAttachment();
+			if (call!=null) call.promise.complete((UHttpResponse)message);
+		}
+
+		@Override
+		protected void messageFailed( final UHttp2Stream stream, final UHttpException cause ) {
+			final Call call = (Call)stream.getAttachment();
+			if (call!=null) call.promise.fail(cause);
+			reset(stream, UHttp2Frame.CANCEL, cause.getMessage());
+		}
+
+		@Override
+		protected void streamClosed( final UHttp2Stream stream, final Throwable cause ) {
+			if (isGoingAway()) usable = false;
+			final Call call = (Call)stream.getAttachment();
+			if (call!=null && !call.promise.isDone()) {
+				call.stream = null;
+				if (cause instanceof UHttp2Exception && ((UHttp2Exception)cause).getErrorCode()==UHttp2Frame.REFUSED_STREAM && !call.retried) {
+					// the server did not process the request
+					call.retried = true;
+					dispatch(call);
+				} else {
+					call.promise.fail(cause!=null ? cause : new ClosedChannelException());
+				}
+			}
+			drain();
+		}
+
+		@Override
+		protected void settingsReceived() {
+			ready = true;
+			drain();
+		}
+
+		@Override
+		public void channelInactive( final UHandlerContext ctx ) throws Exception {
+			usable = false;
+			super.channelInactive(ctx);
+			drain();
+		}
+
+		@Override
+		public String toString() {
+			final UHandlerContext ctx = context();
+			return "Connection["+(ctx!=null ? ctx.channel() : null)+"]";
+		}
+	}
+}
@@ -0,0 +1,996 @@
+package com.umpani.aio.http2;
+
+import java.io.ByteArrayOutputStream;
+import java.io.IOException;
+import java.nio.ByteBuffer;
+import java.nio.channels.ClosedChannelException;
+import java.util.ArrayList;
+import java.util.Arrays;
+import java.util.LinkedHashMap;
+
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UDrainEvent;
+import com.umpani.aio.UFileRegion;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.exception.UHttp2Exception;
+import com.umpani.aio.exception.UHttpException;
+import com.umpani.aio.http.UHttpChunk;
+import com.umpani.aio.http.UHttpHeaders;
+import com.umpani.aio.http.UHttpMessage;
+import com.umpani.aio.http.UHttpRequest;
+import com.umpani.aio.http.UHttpResponse;
+import com.umpani.aio.http.UHttpStream;
+import com.umpani.aio.http.UHttpStreamer;
+import com.umpani.util.log.ULogger;
+
+/**
+ * The base class of the handlers of HTTP/2 connections, added after an {@link UHttp2FrameDecoder} and an
+ * {@link UHttp2FrameEncoder}. The handler implements the connection management that is the same for client and
+ * server: the exchange of the settings, PING, the assembly of header blocks from HEADERS and CONTINUATION frames, the
+ * states of the streams, the limit of concurrent streams and the flow control in both directions. Received messages
+ * are assembled with their body in memory and passed to {@link #messageReceived(UHttp2Stream, UHttpMessage)}, sent
+ * messages are written with {@link #writeMessage(UHttp2Stream, UHttpHeaders, UHttpMessage, UHttpRequest, boolean)},
+ * which splits the body into DATA frames as the send windows allow.
+ *
+ * </p><p>A violation of the protocol that affects the whole connection is answered with a GOAWAY frame and the
+ * connection is closed, a violation that affects a single stream only resets the stream with a RST_STREAM frame.
+ * Once the server shuts down, see {@link UDrainEvent}, or the peer sent a GOAWAY frame, no new streams are accepted
+ * and the connection is closed once the streams in progress are done. Priorities and padding are parsed, but ignored,
+ * server push is not supported.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public abstract class UHttp2ConnectionHandler extends UChannelHandlerAdapter {
+	/**
+	 * The logger of the HTTP/2 connections.
+	 */
+	private static final ULogger LOG = new ULogger(UHttp2ConnectionHandler.class.getName());
+
+	/**
+	 * An empty body.
+	 */
+	private static final byte[] EMPTY = new byte[0];
+
+	/**
+	 * Create a new handler.
+	 * @param server
+	 * true for the server side of a connection.
+	 * @param settings
+	 * the own settings, announced to the peer.
+	 * @param maxBodySize
+	 * the maximal size of a received body.
+	 */
+	protected UHttp2ConnectionHandler( final boolean server, final UHttp2Settings settings, final long maxBodySize ) {
+		if (settings==null) throw new NullPointerException("settings");
+		if (maxBodySize < 0) throw new IllegalArgumentException("maxBodySize: "+maxBodySize);
+		this.server = server;
+		this.localSettings = settings;
+		this.maxBodySize = maxBodySize;
+		this.decoder = new UHpackDecoder(settings.getHeaderTableSize(), settings.getMaxHeaderListSize());
+		this.nextStreamId = server ? 2 : 1;
+	}
+
+	/**
+	 * True for the server side of a connection.
+	 */
+	protected final boolean server;
+
+	/**
+	 * The own settings.
+	 */
+	protected final UHttp2Settings localSettings;
+
+	/**
+	 * The maximal size of a received body.
+	 */
+	protected final long maxBodySize;
+
+	/**
+	 * The settings of the peer.
+	 */
+	private final UHttp2Settings remoteSettings = new UHttp2Settings();
+
+	/**
+	 * The encoder of the sent header blocks.
+	 */
+	private final UHpackEncoder encoder = new UHpackEncoder();
+
+	/**
+	 * The decoder of the received header blocks.
+	 */
+	private final UHpackDecoder decoder;
+
+	/**
+	 * The open streams by identifier, in the order they were opened.
+	 */
+	private final LinkedHashMap<Integer,UHttp2Stream> streams = new LinkedHashMap<>();
+
+	/**
+	 * The context of the handler.
+	 */
+	private UHandlerContext ctx;
+
+	/**
+	 * The future of the last write.
+	 */
+	private UFuture<Void> lastWrite = UFuture.succeeded(null);
+
+	/**
+	 * True once the own settings were sent.
+	 */
+	private boolean settingsSent;
+
+	/**
+	 * True once the first settings of the peer were received.
+	 */
+	private boolean settingsReceived;
+
+	/**
+	 * The identifier of the next stream opened by this side.
+	 */
+	private int nextStreamId;
+
+	/**
+	 * The identifier of the last stream opened by the peer.
+	 */
+	private int lastRemoteStreamId;
+
+	/**
+	 * The send window of the connection.
+	 */
+	private long sendWindow = UHttp2Frame.DEFAULT_WINDOW_SIZE;
+
+	/**
+	 * The receive window of the connection.
+	 */
+	private int receiveWindow = UHttp2Frame.DEFAULT_WINDOW_SIZE;
+
+	/**
+	 * The amount of bytes received on the connection and not yet announced with a WINDOW_UPDATE.
+	 */
+	private int unacknowledged;
+
+	/**
+	 * The header block being assembled from CONTINUATION frames or null.
+	 */
+	private ByteArrayOutputStream headerBlock;
+
+	/**
+	 * The stream of the header block being assembled.
+	 */
+	private int headerBlockStreamId;
+
+	/**
+	 * True if the header block being assembled ends its stream.
+	 */
+	private boolean headerBlockEndStream;
+
+	/**
+	 * True once a GOAWAY frame was sent.
+	 */
+	private boolean goAwaySent;
+
+	/**
+	 * True once a GOAWAY frame was received.
+	 */
+	private boolean goAwayReceived;
+
+	/**
+	 * True once the connection is closed or failed.
+	 */
+	private boolean closing;
+
+	/**
+	 * True once the connection is closed after the last write.
+	 */
+	private boolean closeScheduled;
+
+	/**
+	 * Creates the message of a received header block, the first of a stream.
+	 * @param stream
+	 * the stream.
+	 * @param headers
+	 * the header fields, including the pseudo-header fields.
+	 * @return
+	 * the message or null, if the header block is an interim response that is skipped.
+	 * @throws UHttp2Exception
+	 * if the header fields are malformed.
+	 */
+	protected abstract UHttpMessage newMessage( final UHttp2Stream stream, final UHttpHeaders headers ) throws UHttp2Exception;
+
+	/**
+	 * Called once a message including its body was received.
+	 * @param stream
+	 * the stream.
+	 * @param message
+	 * the message created by {@link #newMessage(UHttp2Stream, UHttpHeaders)}.
+	 */
+	protected abstract void messageReceived( final UHttp2Stream stream, final UHttpMessage message );
+
+	/**
+	 * Called if a message can't be received, because its header list or its body exceeds the limit. The rest of the
+	 * message is discarded.
+	 * @param stream
+	 * the stream.
+	 * @param cause
+	 * the failure with status 413 or 431.
+	 */
+	protected abstract void messageFailed( final UHttp2Stream stream, final UHttpException cause );
+
+	/**
+	 * Called once a stream was closed, the default implementation does nothing.
+	 * @param stream
+	 * the stream.
+	 * @param cause
+	 * null if the stream ended normally, otherwise the reason why it was reset or the connection closed.
+	 */
+	protected void streamClosed( final UHttp2Stream stream, final Throwable cause ) {}
+
+	/**
+	 * Called once settings of the peer were received, the default implementation does nothing.
+	 */
+	protected void settingsReceived() {}
+
+	/**
+	 * Returns the context of the handler.
+	 * @return
+	 * the context, null before the handler was added.
+	 */
+	protected final UHandlerContext context() {
+		return ctx;
+	}
+
+	/**
+	 * Returns the settings of the peer.
+	 * @return
+	 * the settings.
+	 */
+	protected final UHttp2Settings remoteSettings() {
+		return remoteSettings;
+	}
+
+	/**
+	 * Returns true if a GOAWAY frame was sent or received or the connection is closed, so no new streams are opened.
+	 * @return
+	 * true if the connection goes away.
+	 */
+	protected final boolean isGoingAway() {
+		return closing || goAwaySent || goAwayReceived;
+	}
+
+	/**
+	 * Returns true if this side may open another stream.
+	 * @return
+	 * true unless the connection goes away, the stream identifiers are exhausted or the peer's limit of concurrent
+	 * streams is reached.
+	 */
+	protected final boolean canOpenStream() {
+		return !isGoingAway() && nextStreamId > 0 && countStreams(true) < remoteSettings.getMaxConcurrentStreams();
+	}
+
+	/**
+	 * Opens a new stream initiated by this side, must be called by the event loop of the connection.
+	 * @return
+	 * the stream.
+	 * @throws IllegalStateException
+	 * if no stream can be opened, see {@link #canOpenStream()}.
+	 */
+	protected final UHttp2Stream newStream() {
+		if (!canOpenStream()) throw new IllegalStateException("Can't open a stream on "+ctx.channel());
+		final UHttp2Stream stream = new UHttp2Stream(nextStreamId, remoteSettings.getInitialWindowSize(), localSettings.getInitialWindowSize());
+		nextStreamId += 2;
+		streams.put(stream.id(), stream);
+		return stream;
+	}
+
+	@Override
+	public void handlerAdded( final UHandlerContext ctx ) throws Exception {
+		this.ctx = ctx;
+		// added by the protocol negotiation of a server after the connection became active
+		if (ctx.channel().isActive()) sendSettings();
+	}
+
+	@Override
+	public void channelActive( final UHandlerContext ctx ) throws Exception {
+		sendSettings();
+		ctx.fireChannelActive();
+	}
+
+	@Override
+	public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+		if (!(msg instanceof UHttp2Frame)) {
+			ctx.fireChannelRead(msg);
+			return;
+		}
+		if (closing) return;
+		try {
+			read((UHttp2Frame)msg);
+		} catch (UHttp2Exception e) {
+			fail(e);
+		}
+		ctx.flush();
+	}
+
+	@Override
+	public void exceptionCaught( final UHandlerContext ctx, final Throwable cause ) throws Exception {
+		if (!(cause instanceof UHttp2Exception)) {
+			ctx.fireExceptionCaught(cause);
+			return;
+		}
+		fail((UHttp2Exception)cause);
+		ctx.flush();
+	}
+
+	@Override
+	public void userEvent( final UHandlerContext ctx, final Object event ) throws Exception {
+		if (event==UDrainEvent.INSTANCE && !closing) {
+			goAway(UHttp2Frame.NO_ERROR, null);
+			ctx.flush();
+			closeIfIdle();
+		}
+		ctx.fireUserEvent(event);
+	}
+
+	@Override
+	public void channelInactive( final UHandlerContext ctx ) throws Exception {
+		closing = true;
+		for (final UHttp2Stream stream : new ArrayList<>(streams.values())) close(stream, new ClosedChannelException());
+		ctx.fireChannelInactive();
+	}
+
+	/**
+	 * Writes a message on the given stream, must be called by the event loop of the connection. The header fields of
+	 * the message that are specific to HTTP/1.x connections are removed. A body in memory is sent with a
+	 * <tt>Content-Length</tt>, a streamed body is passed to the {@link UHttpStreamer} of the message, its parts are
+	 * sent as DATA frames as the send windows allow.
+	 * @param stream
+	 * the stream.
+	 * @param pseudo
+	 * the pseudo-header fields.
+	 * @param message
+	 * the message.
+	 * @param request
+	 * the request that is answered by the server or sent by the client, passed to the {@link UHttpStream}.
+	 * @param omitBody
+	 * true if the body is not sent, because the request is a HEAD request.
+	 */
+	protected final void writeMessage( final UHttp2Stream stream, final UHttpHeaders pseudo, final UHttpMessage message, final UHttpRequest request, final boolean omitBody ) {
+		if (stream.closed || stream.localEnded) return;
+		final UHttpHeaders fields = new UHttpHeaders();
+		for (int i=0; i < pseudo.size(); i++) fields.add(pseudo.name(i), pseudo.value(i));
+		final UHttpHeaders headers = message.headers();
+		for (int i=0; i < headers.size(); i++) {
+			final String name = headers.name(i);
+			if (isConnectionHeader(name) || (name.equalsIgnoreCase("te") && !headers.value(i).equalsIgnoreCase("trailers"))) continue;
+			fields.add(name, headers.value(i));
+		}
+		final UHttpStreamer streamer = message.streamer();
+		final boolean alwaysEmpty = message instanceof UHttpResponse && UHttpResponse.isContentAlwaysEmpty(((UHttpResponse)message).status());
+		if (streamer==null && !alwaysEmpty) fields.set(UHttpHeaders.CONTENT_LENGTH, message.body().length);
+		final boolean noBody = omitBody || alwaysEmpty || (streamer==null && message.body().length==0);
+		writeHeaders(stream.id(), fields, noBody);
+		if (noBody) {
+			localEnd(stream);
+		} else
+		if (streamer==null) {
+			enqueue(stream, new UHttp2Stream.Data(message.body(), null, true, null));
+		}
+		ctx.flush();
+		if (streamer==null) return;
+		try {
+			streamer.stream(new UHttpStream(new StreamWriter(stream), request, message, noBody));
+		} catch (Throwable t) {
+			LOG.error("Failed to stream a message", "message", String.valueOf(message), "stream", String.valueOf(stream), t);
+			reset(stream, UHttp2Frame.INTERNAL_ERROR, "Streaming failed");
+			ctx.flush();
+		}
+	}
+
+	/**
+	 * Resets the given stream, must be called by the event loop of the connection.
+	 * @param stream
+	 * the stream.
+	 * @param errorCode
+	 * the error code.
+	 * @param message
+	 * the reason.
+	 */
+	protected final void reset( final UHttp2Stream stream, final int errorCode, final String message ) {
+		if (stream.closed) return;
+		write(UHttp2Frame.rstStream(stream.id(), errorCode));
+		close(stream, errorCode==UHttp2Frame.NO_ERROR ? null : new UHttp2Exception(stream.id(), errorCode, message));
+	}
+
+	/**
+	 * Returns true if the header field with the given name is specific to HTTP/1.x connections and must not be sent
+	 * with HTTP/2.
+	 * @param name
+	 * the name.
+	 * @return
+	 * true for <tt>Connection</tt>, <tt>Keep-Alive</tt>, <tt>Proxy-Connection</tt>, <tt>Transfer-Encoding</tt> and
+	 * <tt>Upgrade</tt>.
+	 */
+	public static boolean isConnectionHeader( final String name ) {
+		switch (name.toLowerCase()) {
+			case "connection":
+			case "keep-alive":
+			case "proxy-connection":
+			case "transfer-encoding":
+			case "upgrade":
+				return true;
+			default:
+				return false;
+		}
+	}
+
+	/**
+	 * Processes a received frame.
+	 */
+	private void read( final UHttp2Frame frame ) throws UHttp2Exception {
+		final int type = frame.type();
+		if (!settingsReceived && type!=UHttp2Frame.SETTINGS) throw new UHttp2Exception(UHttp2Frame.PROTOCOL_ERROR, "Expected SETTINGS as first frame");
+		if (headerBlock!=null && (type!=UHttp2Frame.CONTINUATION || frame.streamId()!=headerBlockStreamId)) {
+			throw new UHttp2Exception(UHttp2Frame.PROTOCOL_ERROR, "Expected CONTINUATION of stream "+headerBlockStreamId);
+		}
+		switch (type) {
+			case UHttp2Frame.DATA:
+				readData(frame);
+				break;
+			case UHttp2Frame.HEADERS:
+				readHeaders(frame);
+				break;
+			case UHttp2Frame.CONTINUATION:
+				readContinuation(frame);
+				break;
+			case UHttp2Frame.RST_STREAM:
+				readRstStream(frame);
+				break;
+			case UHttp2Frame.SETTINGS:
+				readSettings(frame);
+				break;
+			case UHttp2Frame.PUSH_PROMISE:
+				throw new UHttp2Exception(UHttp2Frame.PROTOCOL_ERROR, "Server push is not enabled");
+			case UHttp2Frame.PING:
+				if (!frame.hasFlag(UHttp2Frame.ACK)) write(UHttp2Frame.ping(frame.payload(), true));
+				break;
+			case UHttp2Frame.GOAWAY:
+				readGoAway(frame);
+				break;
+			case UHttp2Frame.WINDOW_UPDATE:
+				readWindowUpdate(frame);
+				break;
+			default:
+				// priorities are ignored, as are frames of unknown types
+				break;
+		}
+	}
+
+	/**
+	 * Processes a DATA frame.
+	 */
+	private void readData( final UHttp2Frame frame ) throws UHttp2Exception {
+		// flow control covers the whole payload, including the padding
+		final int length = frame.payload().length;
+		if (length > receiveWindow) throw new UHttp2Exception(UHttp2Frame.FLOW_CONTROL_ERROR, "Connection window exceeded");
+		receiveWindow -= length;
+		unacknowledged += length;
+		if (unacknowledged > 0 && unacknowledged >= UHttp2Frame.DEFAULT_WINDOW_SIZE / 2) {
+			write(UHttp2Frame.windowUpdate(0, unacknowledged));
+			receiveWindow += unacknowledged;
+			unacknowledged = 0;
+		}
+		final int streamId = frame.streamId();
+		final UHttp2Stream stream = streams.get(streamId);
+		if (stream==null) {
+			// frames may still arrive after a stream was reset
+			checkIdle(streamId);
+			return;
+		}
+		if (stream.remoteEnded) throw new UHttp2Exception(streamId, UHttp2Frame.STREAM_CLOSED, "DATA after end of stream "+streamId);
+		if (stream.message==null && !stream.discarding) throw new UHttp2Exception(streamId, UHttp2Frame.PROTOCOL_ERROR, "DATA before HEADERS on stream "+streamId);
+		if (length > stream.receiveWindow) throw new UHttp2Exception(streamId, UHttp2Frame.FLOW_CONTROL_ERROR, "Window of stream "+streamId+" exceeded");
+		stream.receiveWindow -= length;
+		final boolean endStream = frame.hasFlag(UHttp2Frame.END_STREAM);
+		if (!endStream) {
+			stream.unacknowledged += length;
+			if (stream.unacknowledged > 0 && stream.unacknowledged >= localSettings.getInitialWindowSize() / 2) {
+				write(UHttp2Frame.windowUpdate(streamId, stream.unacknowledged));
+				stream.receiveWindow += stream.unacknowledged;
+				stream.unacknowledged = 0;
+			}
+		}
+		append(stream, unpad(frame, 0));
+		if (endStream) remoteEnd(stream);
+	}
+
+	/**
+	 * Processes a HEADERS frame.
+	 */
+	private void readHeaders( final UHttp2Frame frame ) throws UHttp2Exception {
+		final byte[] fragment = unpad(frame, frame.hasFlag(UHttp2Frame.PRIORITY_FLAG) ? 5 : 0);
+		final boolean endStream = frame.hasFlag(UHttp2Frame.END_STREAM);
+		if (frame.hasFlag(UHttp2Frame.END_HEADERS)) {
+			headers(frame.streamId(), fragment, endStream);
+			return;
+		}
+		headerBlock = new ByteArrayOutputStream();
+		headerBlock.write(fragment, 0, fragment.length);
+		headerBlockStreamId = frame.streamId();
+		headerBlockEndStream = endStream;
+	}
+
+	/**
+	 * Processes a CONTINUATION frame.
+	 */
+	private void readContinuation( final UHttp2Frame frame ) throws UHttp2Exception {
+		if (headerBlock==null) throw new UHttp2Exception(UHttp2Frame.PROTOCOL_ERROR, "CONTINUATION without HEADERS");
+		final byte[] fragment = frame.payload();
+		headerBlock.write(fragment, 0, fragment.length);
+		// a compressed header block is never much larger than the decoded header list
+		final long maxHeaderListSize = localSettings.getMaxHeaderListSize();
+		if (maxHeaderListSize!=UHttp2Settings.UNLIMITED && headerBlock.size() > 4 * maxHeaderListSize) {
+			throw new UHttp2Exception(UHttp2Frame.ENHANCE_YOUR_CALM, "Header block exceeds "+4 * maxHeaderListSize+" bytes");
+		}
+		if (!frame.hasFlag(UHttp2Frame.END_HEADERS)) return;
+		final byte[] block = headerBlock.toByteArray();
+		headerBlock = null;
+		headers(headerBlockStreamId, block, headerBlockEndStream);
+	}
+
+	/**
+	 * Processes a complete header block.
+	 */
+	private void headers( final int streamId, final byte[] block, final boolean endStream ) throws UHttp2Exception {
+		// every block is decoded to keep the dynamic table in sync, even if the stream is ignored
+		final UHttpHeaders headers = new UHttpHeaders();
+		final boolean complete = decoder.decode(block, headers);
+		UHttp2Stream stream = streams.get(streamId);
+		if (stream==null) {
+			if (isLocal(streamId) || streamId <= lastRemoteStreamId) {
+				checkIdle(streamId);
+				return;
+			}
+			if (!server) throw new UHttp2Exception(UHttp2Frame.PROTOCOL_ERROR, "Stream "+streamId+" opened by the server");
+			lastRemoteStreamId = streamId;
+			// streams opened after the GOAWAY are not processed
+			if (goAwaySent) return;
+			if (countStreams(false) >= localSettings.getMaxConcurrentStreams()) throw new UHttp2Exception(streamId, UHttp2Frame.REFUSED_STREAM, "Too many concurrent streams");
+			stream = new UHttp2Stream(streamId, remoteSettings.getInitialWindowSize(), localSettings.getInitialWindowSize());
+			streams.put(streamId, stream);
+		} else
+		if (stream.remoteEnded) {
+			throw new UHttp2Exception(streamId, UHttp2Frame.STREAM_CLOSED, "HEADERS after end of stream "+streamId);
+		}
+		if (stream.message!=null || stream.discarding) {
+			// the fields of trailers are ignored
+			if (!endStream) throw new UHttp2Exception(streamId, UHttp2Frame.PROTOCOL_ERROR, "Trailers without END_STREAM on stream "+streamId);
+			remoteEnd(stream);
+			return;
+		}
+		if (!complete) {
+			stream.discarding = true;
+			messageFailed(stream, new UHttpException(431, "Header list exceeds "+localSettings.getMaxHeaderListSize()+" bytes"));
+		} else {
+			validate(streamId, headers);
+			final UHttpMessage message = newMessage(stream, headers);
+			if (message==null) {
+				if (endStream) throw new UHttp2Exception(streamId, UHttp2Frame.PROTOCOL_ERROR, "Interim response with END_STREAM on stream "+streamId);
+				return;
+			}
+			stream.message = message;
+		}
+		if (endStream) remoteEnd(stream);
+	}
+
+	/**
+	 * Processes a RST_STREAM frame.
+	 */
+	private void readRstStream( final UHttp2Frame frame ) throws UHttp2Exception {
+		final int streamId = frame.streamId();
+		final UHttp2Stream stream = streams.get(streamId);
+		if (stream==null) {
+			checkIdle(streamId);
+			return;
+		}
+		final int errorCode = frame.getInt(0);
+		close(stream, new UHttp2Exception(streamId, errorCode, "Stream reset by peer with "+UHttp2Frame.errorName(errorCode)));
+	}
+
+	/**
+	 * Processes a SETTINGS frame.
+	 */
+	private void readSettings( final UHttp2Frame frame ) throws UHttp2Exception {
+		if (frame.hasFlag(UHttp2Frame.ACK)) return;
+		final int initialWindowSize = remoteSettings.getInitialWindowSize();
+		remoteSettings.apply(frame);
+		settingsReceived = true;
+		encoder.setMaxTableSize(remoteSettings.getHeaderTableSize());
+		write(new UHttp2Frame(UHttp2Frame.SETTINGS, UHttp2Frame.ACK, 0, null));
+		// a changed initial window size applies to the send windows of all open streams
+		final int delta = remoteSettings.getInitialWindowSize() - initialWindowSize;
+		if (delta!=0) {
+			for (final UHttp2Stream stream : streams.values()) {
+				stream.sendWindow += delta;
+				if (stream.sendWindow > UHttp2Frame.MAX_WINDOW_SIZE) throw new UHttp2Exception(UHttp2Frame.FLOW_CONTROL_ERROR, "Window of stream "+stream.id()+" overflows");
+			}
+			if (delta > 0) writePending();
+		}
+		settingsReceived();
+	}
+
+	/**
+	 * Processes a GOAWAY frame.
+	 */
+	private void readGoAway( final UHttp2Frame frame ) {
+		goAwayReceived = true;
+		final int lastStreamId = frame.getInt(0) & 0x7fffffff;
+		// the streams after the last stream were not processed and may be retried on another connection
+		for (final UHttp2Stream stream : new ArrayList<>(streams.values())) {
+			if (isLocal(stream.id()) && stream.id() > lastStreamId) {
+				close(stream, new UHttp2Exception(stream.id(), UHttp2Frame.REFUSED_STREAM, "Stream refused by GOAWAY"));
+			}
+		}
+		closeIfIdle();
+	}
+
+	/**
+	 * Processes a WINDOW_UPDATE frame.
+	 */
+	private void readWindowUpdate( final UHttp2Frame frame ) throws UHttp2Exception {
+		final int streamId = frame.streamId();
+		final int increment = frame.getInt(0) & 0x7fffffff;
+		if (streamId==0) {
+			if (increment==0) throw new UHttp2Exception(UHttp2Frame.PROTOCOL_ERROR, "WINDOW_UPDATE without increment");
+			sendWindow += increment;
+			if (sendWindow > UHttp2Frame.MAX_WINDOW_SIZE) throw new UHttp2Exception(UHttp2Frame.FLOW_CONTROL_ERROR, "Connection window overflows");
+			writePending();
+			return;
+		}
+		final UHttp2Stream stream = streams.get(streamId);
+		if (stream==null) {
+			checkIdle(streamId);
+			return;
+		}
+		if (increment==0) throw new UHttp2Exception(streamId, UHttp2Frame.PROTOCOL_ERROR, "WINDOW_UPDATE without increment");
+		stream.sendWindow += increment;
+		if (stream.sendWindow > UHttp2Frame.MAX_WINDOW_SIZE) throw new UHttp2Exception(streamId, UHttp2Frame.FLOW_CONTROL_ERROR, "Window of stream "+streamId+" overflows");
+		writePending(stream);
+	}
+
+	/**
+	 * Appends received bytes to the body of the message of the given stream.
+	 */
+	private void append( final UHttp2Stream stream, final byte[] data ) {
+		if (stream.discarding || data.length==0) return;
+		if (stream.body==null) stream.body = new ByteArrayOutputStream();
+		if (stream.body.size() + (long)data.length > maxBodySize) {
+			stream.discarding = true;
+			stream.body = null;
+			messageFailed(stream, new UHttpException(413, "Body exceeds "+maxBodySize+" bytes"));
+			return;
+		}
+		stream.body.write(data, 0, data.length);
+	}
+
+	/**
+	 * Called once the peer ended the given stream.
+	 */
+	private void remoteEnd( final UHttp2Stream stream ) throws UHttp2Exception {
+		stream.remoteEnded = true;
+		if (stream.closed) return;
+		final UHttpMessage message = stream.message;
+		if (message!=null && !stream.discarding) {
+			final byte[] body = stream.body!=null ? stream.body.toByteArray() : EMPTY;
+			stream.body = null;
+			final long contentLength = message.headers().getLong(UHttpHeaders.CONTENT_LENGTH, -1);
+			if (message instanceof UHttpRequest && contentLength >= 0 && contentLength!=body.length) {
+				throw new UHttp2Exception(stream.id(), UHttp2Frame.PROTOCOL_ERROR, "Content-Length "+contentLength+" differs from the body of "+body.length+" bytes");
+			}
+			message.setBody(body);
+			messageReceived(stream, message);
+		}
+		if (stream.localEnded) close(stream, null);
+	}
+
+	/**
+	 * Called once this side ended the given stream.
+	 */
+	private void localEnd( final UHttp2Stream stream ) {
+		stream.localEnded = true;
+		if (stream.remoteEnded) {
+			close(stream, null);
+		} else
+		if (server) {
+			// the response is complete, the rest of the request is not needed
+			reset(stream, UHttp2Frame.NO_ERROR, null);
+		}
+	}
+
+	/**
+	 * Closes the given stream.
+	 */
+	private void close( final UHttp2Stream stream, final Throwable cause ) {
+		if (stream.closed) return;
+		stream.closed = true;
+		stream.body = null;
+		streams.remove(stream.id());
+		UHttp2Stream.Data data;
+		while ((data = stream.pending.poll())!=null) {
+			if (data.region!=null) data.region.release();
+			if (data.promise!=null) data.promise.fail(cause!=null ? cause : new ClosedChannelException());
+		}
+		try {
+			streamClosed(stream, cause);
+		} catch (Throwable t) {
+			LOG.error("Failed to close a stream", "stream", String.valueOf(stream), t);
+		}
+		closeIfIdle();
+	}
+
+	/**
+	 * Sends a GOAWAY frame, once.
+	 */
+	private void goAway( final int errorCode, final String message ) {
+		if (goAwaySent) return;
+		goAwaySent = true;
+		write(UHttp2Frame.goAway(lastRemoteStreamId, errorCode, message));
+	}
+
+	/**
+	 * Closes the connection once the last write is done, if it goes away and no stream is open.
+	 */
+	private void closeIfIdle() {
+		if (closeScheduled || !(goAwaySent || goAwayReceived) || !streams.isEmpty() || !ctx.channel().isActive()) return;
+		closeScheduled = true;
+		ctx.flush();
+		lastWrite.addListener(new UFutureListener<Void>() {
+			@Override
+			public void complete( final UFuture<Void> future ) {
+				ctx.close();
+			}
+		}, null);
+	}
+
+	/**
+	 * Handles a connection or stream error.
+	 */
+	private void fail( final UHttp2Exception e ) {
+		if (!e.isConnectionError()) {
+			final UHttp2Stream stream = streams.get(e.getStreamId());
+			if (stream!=null) {
+				reset(stream, e.getErrorCode(), e.getMessage());
+			} else {
+				write(UHttp2Frame.rstStream(e.getStreamId(), e.getErrorCode()));
+			}
+			return;
+		}
+		if (closing) return;
+		closing = true;
+		goAway(e.getErrorCode(), e.getMessage());
+		for (final UHttp2Stream stream : new ArrayList<>(streams.values())) close(stream, e);
+		closeIfIdle();
+	}
+
+	/**
+	 * Fails with a connection error if the given stream was never opened.
+	 */
+	private void checkIdle( final int streamId ) throws UHttp2Exception {
+		if (isLocal(streamId) ? streamId >= nextStreamId : streamId > lastRemoteStreamId) {
+			throw new UHttp2Exception(UHttp2Frame.PROTOCOL_ERROR, "Frame on idle stream "+streamId);
+		}
+	}
+
+	/**
+	 * Fails with a stream error if the given header fields are malformed.
+	 */
+	private static void validate( final int streamId, final UHttpHeaders headers ) throws UHttp2Exception {
+		boolean regular = false;
+		for (int i=0; i < headers.size(); i++) {
+			final String name = headers.name(i);
+			String error = null;
+			if (!name.equals(name.toLowerCase())) {
+				error = "Upper case header field "+name;
+			} else
+			if (name.startsWith(":")) {
+				if (regular) error = "Pseudo-header field "+name+" after regular header fields";
+			} else
+			if (isConnectionHeader(name) || (name.equals("te") && !headers.value(i).equals("trailers"))) {
+				error = "Connection-specific header field "+name;
+			} else {
+				regular = true;
+			}
+			if (error!=null) throw new UHttp2Exception(streamId, UHttp2Frame.PROTOCOL_ERROR, error);
+		}
+	}
+
+	/**
+	 * Returns true if the given stream is initiated by this side.
+	 */
+	private boolean isLocal( final int streamId ) {
+		return ((streamId & 1)==0)==server;
+	}
+
+	/**
+	 * Returns the amount of open streams initiated by this side or by the peer.
+	 */
+	private int countStreams( final boolean local ) {
+		int count = 0;
+		for (final UHttp2Stream stream : streams.values()) {
+			if (isLocal(stream.id())==local) count++;
+		}
+		return count;
+	}
+
+	/**
+	 * Returns the payload of the given frame without padding and without the given amount of fixed fields.
+	 */
+	private static byte[] unpad( final UHttp2Frame frame, final int fixed ) throws UHttp2Exception {
+		final byte[] payload = frame.payload();
+		int offset = fixed, padding = 0;
+		if (frame.hasFlag(UHttp2Frame.PADDED)) {
+			if (payload.length==0) throw new UHttp2Exception(UHttp2Frame.PROTOCOL_ERROR, "Padded frame without pad length");
+			padding = payload[0] & 0xff;
+			offset++;
+		}
+		if (offset + padding > payload.length) throw new UHttp2Exception(UHttp2Frame.PROTOCOL_ERROR, "Padding exceeds the payload");
+		if (offset==0 && padding==0) return payload;
+		return Arrays.copyOfRange(payload, offset, payload.length - padding);
+	}
+
+	/**
+	 * Sends our settings, once.
+	 */
+	private void sendSettings() {
+		if (settingsSent) return;
+		settingsSent = true;
+		write(localSettings.toFrame());
+		ctx.flush();
+	}
+
+	/**
+	 * Writes a frame without flushing it.
+	 */
+	private UFuture<Void> write( final UHttp2Frame frame ) {
+		return lastWrite = ctx.write(frame);
+	}
+
+	/**
+	 * Writes a header block as HEADERS frame and as many CONTINUATION frames as the maximal frame size of the peer
+	 * requires.
+	 */
+	private void writeHeaders( final int streamId, final UHttpHeaders fields, final boolean endStream ) {
+		final byte[] block = encoder.encode(fields);
+		final int maxFrameSize = remoteSettings.getMaxFrameSize();
+		int offset = 0;
+		do {
+			final int length = Math.min(maxFrameSize, block.length - offset);
+			final byte[] fragment = Arrays.copyOfRange(block, offset, offset + length);
+			final int type = offset==0 ? UHttp2Frame.HEADERS : UHttp2Frame.CONTINUATION;
+			offset += length;
+			int flags = offset==block.length ? UHttp2Frame.END_HEADERS : 0;
+			if (type==UHttp2Frame.HEADERS && endStream) flags |= UHttp2Frame.END_STREAM;
+			write(new UHttp2Frame(type, flags, streamId, fragment));
+		} while (offset < block.length);
+	}
+
+	/**
+	 * Queues a part of the body of the given stream and sends as much as the windows allow.
+	 */
+	private void enqueue( final UHttp2Stream stream, final UHttp2Stream.Data data ) {
+		if (stream.closed || stream.localEnded) {
+			if (data.region!=null) data.region.release();
+			if (data.promise!=null) data.promise.fail(new ClosedChannelException());
+			return;
+		}
+		stream.pending.add(data);
+		writePending(stream);
+	}
+
+	/**
+	 * Sends the queued parts of all streams as the windows allow, in the order the streams were opened.
+	 */
+	private void writePending() {
+		for (final UHttp2Stream stream : new ArrayList<>(streams.values())) {
+			if (sendWindow <= 0) return;
+			writePending(stream);
+		}
+	}
+
+	/**
+	 * Sends the queued parts of the given stream as the windows allow.
+	 */
+	private void writePending( final UHttp2Stream stream ) {
+		UHttp2Stream.Data data;
+		while (!stream.closed && (data = stream.pending.peek())!=null) {
+			final long remaining = data.remaining();
+			final int length = remaining==0 ? 0 : (int)Math.min(Math.min(remaining, remoteSettings.getMaxFrameSize()), Math.min(stream.sendWindow, sendWindow));
+			if (remaining > 0 && length <= 0) return;
+			final byte[] payload;
+			if (data.region!=null) {
+				payload = new byte[length];
+				try {
+					final ByteBuffer dst = ByteBuffer.wrap(payload);
+					while (dst.hasRemaining()) {
+						if (data.region.read(dst)==0) break;
+					}
+				} catch (IOException e) {
+					LOG.error("Failed to read a file region", "region", String.valueOf(data.region), "stream", String.valueOf(stream), e);
+					reset(stream, UHttp2Frame.INTERNAL_ERROR, e.getMessage());
+					return;
+				}
+			} else {
+				payload = data.offset==0 && length==data.data.length ? data.data : Arrays.copyOfRange(data.data, data.offset, data.offset + length);
+				data.offset += length;
+			}
+			stream.sendWindow -= length;
+			sendWindow -= length;
+			final boolean last = length==remaining;
+			final UFuture<Void> written = write(new UHttp2Frame(UHttp2Frame.DATA, last && data.end ? UHttp2Frame.END_STREAM : 0, stream.id(), payload));
+			if (!last) continue;
+			stream.pending.poll();
+			if (data.region!=null) data.region.release();
+			if (data.promise!=null) data.promise.completeWith(written);
+			if (data.end) {
+				localEnd(stream);
+				return;
+			}
+		}
+	}
+
+	/**
+	 * Writes the parts of a streamed body to a stream, in the event loop of the connection.
+	 */
+	private final class StreamWriter implements UHttpStream.Writer {
+		StreamWriter( final UHttp2Stream stream ) {
+			this.stream = stream;
+		}
+
+		/**
+		 * The stream.
+		 */
+		private final UHttp2Stream stream;
+
+		@Override
+		public UChannel channel() {
+			return ctx.channel();
+		}
+
+		@Override
+		public UFuture<Void> write( final Object msg ) {
+			final UPromise<Void> promise = ctx.newPromise();
+			if (ctx.loop().inEventLoop()) {
+				doWrite(msg, promise);
+			} else {
+				ctx.loop().execute(new Runnable() {
+					@Override
+					public void run() {
+						doWrite(msg, promise);
+					}
+				});
+			}
+			return promise;
+		}
+
+		/**
+		 * Queues a part of the body.
+		 */
+		private void doWrite( final Object msg, final UPromise<Void> promise ) {
+			if (msg instanceof UFileRegion) {
+				enqueue(stream, new UHttp2Stream.Data(null, (UFileRegion)msg, false, promise));
+			} else {
+				final UHttpChunk chunk = (UHttpChunk)msg;
+				enqueue(stream, new UHttp2Stream.Data(chunk.data(), null, chunk.isLast(), promise));
+			}
+			ctx.flush();
+		}
+
+		@Override
+		public String toString() {
+			return "StreamWriter["+stream+"]";
+		}
+	}
+}
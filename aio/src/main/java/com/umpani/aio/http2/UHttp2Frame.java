@@ -0,0 +1,447 @@
+package com.umpani.aio.http2;
+
+import java.nio.charset.StandardCharsets;
+
+/**
+ * An HTTP/2 frame as defined by RFC 7540: a type, flags, a stream identifier and the payload. The frame holds the
+ * raw payload, padding and the fields of the payload are interpreted by the {@link UHttp2ConnectionHandler}. The
+ * class also defines the error codes and the identifiers of the settings.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UHttp2Frame {
+	/**
+	 * The type of a DATA frame.
+	 */
+	public static final int DATA = 0x0;
+
+	/**
+	 * The type of a HEADERS frame.
+	 */
+	public static final int HEADERS = 0x1;
+
+	/**
+	 * The type of a PRIORITY frame.
+	 */
+	public static final int PRIORITY = 0x2;
+
+	/**
+	 * The type of a RST_STREAM frame.
+	 */
+	public static final int RST_STREAM = 0x3;
+
+	/**
+	 * The type of a SETTINGS frame.
+	 */
+	public static final int SETTINGS = 0x4;
+
+	/**
+	 * The type of a PUSH_PROMISE frame.
+	 */
+	public static final int PUSH_PROMISE = 0x5;
+
+	/**
+	 * The type of a PING frame.
+	 */
+	public static final int PING = 0x6;
+
+	/**
+	 * The type of a GOAWAY frame.
+	 */
+	public static final int GOAWAY = 0x7;
+
+	/**
+	 * The type of a WINDOW_UPDATE frame.
+	 */
+	public static final int WINDOW_UPDATE = 0x8;
+
+	/**
+	 * The type of a CONTINUATION frame.
+	 */
+	public static final int CONTINUATION = 0x9;
+
+	/**
+	 * The flag of the last frame of a stream, on DATA and HEADERS frames.
+	 */
+	public static final int END_STREAM = 0x1;
+
+	/**
+	 * The flag that acknowledges a SETTINGS or PING frame.
+	 */
+	public static final int ACK = 0x1;
+
+	/**
+	 * The flag of the last frame of a header block, on HEADERS, PUSH_PROMISE and CONTINUATION frames.
+	 */
+	public static final int END_HEADERS = 0x4;
+
+	/**
+	 * The flag of a padded DATA, HEADERS or PUSH_PROMISE frame.
+	 */
+	public static final int PADDED = 0x8;
+
+	/**
+	 * The flag of a HEADERS frame with priority fields.
+	 */
+	public static final int PRIORITY_FLAG = 0x20;
+
+	/**
+	 * The error code of a graceful shutdown.
+	 */
+	public static final int NO_ERROR = 0x0;
+
+	/**
+	 * The error code of a protocol error.
+	 */
+	public static final int PROTOCOL_ERROR = 0x1;
+
+	/**
+	 * The error code of an unexpected internal error.
+	 */
+	public static final int INTERNAL_ERROR = 0x2;
+
+	/**
+	 * The error code of a violated flow control.
+	 */
+	public static final int FLOW_CONTROL_ERROR = 0x3;
+
+	/**
+	 * The error code of settings that were not acknowledged in time.
+	 */
+	public static final int SETTINGS_TIMEOUT = 0x4;
+
+	/**
+	 * The error code of a frame received on a closed stream.
+	 */
+	public static final int STREAM_CLOSED = 0x5;
+
+	/**
+	 * The error code of a frame with an invalid size.
+	 */
+	public static final int FRAME_SIZE_ERROR = 0x6;
+
+	/**
+	 * The error code of a stream refused before any processing.
+	 */
+	public static final int REFUSED_STREAM = 0x7;
+
+	/**
+	 * The error code of a stream that is no longer needed.
+	 */
+	public static final int CANCEL = 0x8;
+
+	/**
+	 * The error code of a header block that can't be decompressed.
+	 */
+	public static final int COMPRESSION_ERROR = 0x9;
+
+	/**
+	 * The error code of a failed CONNECT request.
+	 */
+	public static final int CONNECT_ERROR = 0xa;
+
+	/**
+	 * The error code of a peer that generates excessive load.
+	 */
+	public static final int ENHANCE_YOUR_CALM = 0xb;
+
+	/**
+	 * The error code of a connection without the required security.
+	 */
+	public static final int INADEQUATE_SECURITY = 0xc;
+
+	/**
+	 * The error code of a request that requires HTTP/1.1.
+	 */
+	public static final int HTTP_1_1_REQUIRED = 0xd;
+
+	/**
+	 * The identifier of the setting of the maximal size of the header compression table.
+	 */
+	public static final int SETTINGS_HEADER_TABLE_SIZE = 0x1;
+
+	/**
+	 * The identifier of the setting that enables server push.
+	 */
+	public static final int SETTINGS_ENABLE_PUSH = 0x2;
+
+	/**
+	 * The identifier of the setting of the maximal amount of concurrent streams.
+	 */
+	public static final int SETTINGS_MAX_CONCURRENT_STREAMS = 0x3;
+
+	/**
+	 * The identifier of the setting of the initial flow control window of a stream.
+	 */
+	public static final int SETTINGS_INITIAL_WINDOW_SIZE = 0x4;
+
+	/**
+	 * The identifier of the setting of the maximal payload size of a frame.
+	 */
+	public static final int SETTINGS_MAX_FRAME_SIZE = 0x5;
+
+	/**
+	 * The identifier of the setting of the maximal size of a header list.
+	 */
+	public static final int SETTINGS_MAX_HEADER_LIST_SIZE = 0x6;
+
+	/**
+	 * The size of the frame header.
+	 */
+	public static final int HEADER_SIZE = 9;
+
+	/**
+	 * The default and minimal maximal payload size of a frame.
+	 */
+	public static final int DEFAULT_MAX_FRAME_SIZE = 16384;
+
+	/**
+	 * The largest allowed maximal payload size of a frame.
+	 */
+	public static final int MAX_FRAME_SIZE_LIMIT = (1 << 24) - 1;
+
+	/**
+	 * The initial size of the flow control windows.
+	 */
+	public static final int DEFAULT_WINDOW_SIZE = 65535;
+
+	/**
+	 * The largest flow control window.
+	 */
+	public static final int MAX_WINDOW_SIZE = Integer.MAX_VALUE;
+
+	/**
+	 * The connection preface sent by a client before its first frame.
+	 */
+	public static final byte[] PREFACE = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n".getBytes(StandardCharsets.US_ASCII);
+
+	/**
+	 * An empty payload.
+	 */
+	private static final byte[] EMPTY = new byte[0];
+
+	/**
+	 * Create a new frame.
+	 * @param type
+	 * the type.
+	 * @param flags
+	 * the flags.
+	 * @param streamId
+	 * the stream identifier or zero for frames of the connection.
+	 * @param payload
+	 * the payload or null for an empty payload.
+	 */
+	public UHttp2Frame( final int type, final int flags, final int streamId, final byte[] payload ) {
+		if (type < 0 || type > 0xff) throw new IllegalArgumentException("type: "+type);
+		if (flags < 0 || flags > 0xff) throw new IllegalArgumentException("flags: "+flags);
+		if (streamId < 0) throw new IllegalArgumentException("streamId: "+streamId);
+		this.type = type;
+		this.flags = flags;
+		this.streamId = streamId;
+		this.payload = payload!=null ? payload : EMPTY;
+	}
+
+	/**
+	 * The type.
+	 */
+	private final int type;
+
+	/**
+	 * The flags.
+	 */
+	private final int flags;
+
+	/**
+	 * The stream identifier.
+	 */
+	private final int streamId;
+
+	/**
+	 * The payload.
+	 */
+	private final byte[] payload;
+
+	/**
+	 * Returns a SETTINGS frame with the given settings.
+	 * @param settings
+	 * pairs of identifier and value.
+	 * @return
+	 * the frame.
+	 */
+	public static UHttp2Frame settings( final int... settings ) {
+		if ((settings.length & 1)!=0) throw new IllegalArgumentException("Pairs of identifier and value required");
+		final byte[] payload = new byte[settings.length * 3];
+		for (int i=0; i < settings.length; i+=2) {
+			final int offset = i * 3;
+			payload[offset] = (byte)(settings[i] >>> 8);
+			payload[offset + 1] = (byte)settings[i];
+			writeInt(payload, offset + 2, settings[i + 1]);
+		}
+		return new UHttp2Frame(SETTINGS, 0, 0, payload);
+	}
+
+	/**
+	 * Returns a PING frame.
+	 * @param data
+	 * the opaque data of 8 bytes.
+	 * @param ack
+	 * true to acknowledge a received ping.
+	 * @return
+	 * the frame.
+	 */
+	public static UHttp2Frame ping( final byte[] data, final boolean ack ) {
+		if (data.length!=8) throw new IllegalArgumentException("Ping data must have 8 bytes");
+		return new UHttp2Frame(PING, ack ? ACK : 0, 0, data);
+	}
+
+	/**
+	 * Returns a GOAWAY frame.
+	 * @param lastStreamId
+	 * the identifier of the last stream that was or might be processed.
+	 * @param errorCode
+	 * the error code.
+	 * @param message
+	 * the debug message or null.
+	 * @return
+	 * the frame.
+	 */
+	public static UHttp2Frame goAway( final int lastStreamId, final int errorCode, final String message ) {
+		final byte[] debug = message!=null ? message.getBytes(StandardCharsets.UTF_8) : EMPTY;
+		final byte[] payload = new byte[8 + Math.min(debug.length, 256)];
+		writeInt(payload, 0, lastStreamId);
+		writeInt(payload, 4, errorCode);
+		System.arraycopy(debug, 0, payload, 8, payload.length - 8);
+		return new UHttp2Frame(GOAWAY, 0, 0, payload);
+	}
+
+	/**
+	 * Returns a RST_STREAM frame.
+	 * @param streamId
+	 * the identifier of the stream to reset.
+	 * @param errorCode
+	 * the error code.
+	 * @return
+	 * the frame.
+	 */
+	public static UHttp2Frame rstStream( final int streamId, final int errorCode ) {
+		final byte[] payload = new byte[4];
+		writeInt(payload, 0, errorCode);
+		return new UHttp2Frame(RST_STREAM, 0, streamId, payload);
+	}
+
+	/**
+	 * Returns a WINDOW_UPDATE frame.
+	 * @param streamId
+	 * the identifier of the stream or zero for the window of the connection.
+	 * @param increment
+	 * the amount of bytes the window grows, between 1 and 2^31-1.
+	 * @return
+	 * the frame.
+	 */
+	public static UHttp2Frame windowUpdate( final int streamId, final int increment ) {
+		if (increment <= 0) throw new IllegalArgumentException("increment: "+increment);
+		final byte[] payload = new byte[4];
+		writeInt(payload, 0, increment);
+		return new UHttp2Frame(WINDOW_UPDATE, 0, streamId, payload);
+	}
+
+	/**
+	 * Returns the name of the given error code.
+	 * @param errorCode
+	 * the error code.
+	 * @return
+	 * the name, for example <tt>PROTOCOL_ERROR</tt>.
+	 */
+	public static String errorName( final int errorCode ) {
+		switch (errorCode) {
+			case NO_ERROR: return "NO_ERROR";
+			case PROTOCOL_ERROR: return "PROTOCOL_ERROR";
+			case INTERNAL_ERROR: return "INTERNAL_ERROR";
+			case FLOW_CONTROL_ERROR: return "FLOW_CONTROL_ERROR";
+			case SETTINGS_TIMEOUT: return "SETTINGS_TIMEOUT";
+			case STREAM_CLOSED: return "STREAM_CLOSED";
+			case FRAME_SIZE_ERROR: return "FRAME_SIZE_ERROR";
+			case REFUSED_STREAM: return "REFUSED_STREAM";
+			case CANCEL: return "CANCEL";
+			case COMPRESSION_ERROR: return "COMPRESSION_ERROR";
+			case CONNECT_ERROR: return "CONNECT_ERROR";
+			case ENHANCE_YOUR_CALM: return "ENHANCE_YOUR_CALM";
+			case INADEQUATE_SECURITY: return "INADEQUATE_SECURITY";
+			case HTTP_1_1_REQUIRED: return "HTTP_1_1_REQUIRED";
+			default: return "0x"+Integer.toHexString(errorCode);
+		}
+	}
+
+	/**
+	 * Returns the type.
+	 * @return
+	 * the type, for example {@link #HEADERS}.
+	 */
+	public int type() {
+		return type;
+	}
+
+	/**
+	 * Returns the flags.
+	 * @return
+	 * the flags.
+	 */
+	public int flags() {
+		return flags;
+	}
+
+	/**
+	 * Returns true if the given flag is set.
+	 * @param flag
+	 * the flag, for example {@link #END_STREAM}.
+	 * @return
+	 * true if the flag is set.
+	 */
+	public boolean hasFlag( final int flag ) {
+		return (flags & flag)!=0;
+	}
+
+	/**
+	 * Returns the stream identifier.
+	 * @return
+	 * the stream identifier or zero for frames of the connection.
+	 */
+	public int streamId() {
+		return streamId;
+	}
+
+	/**
+	 * Returns the payload.
+	 * @return
+	 * the payload, an empty array if the frame has no payload.
+	 */
+	public byte[] payload() {
+		return payload;
+	}
+
+	/**
+	 * Reads a 32 bit integer in network byte order from the payload.
+	 * @param offset
+	 * the offset of the integer.
+	 * @return
+	 * the integer.
+	 */
+	public int getInt( final int offset ) {
+		return (payload[offset] & 0xff) << 24 | (payload[offset + 1] & 0xff) << 16 | (payload[offset + 2] & 0xff) << 8 | (payload[offset + 3] & 0xff);
+	}
+
+	@Override
+	public String toString() {
+		return "UHttp2Frame[type="+type+", flags=0x"+Integer.toHexString(flags)+", stream="+streamId+", length="+payload.length+"]";
+	}
+
+	/**
+	 * Writes a 32 bit integer in network byte order.
+	 */
+	private static void writeInt( final byte[] b, final int offset, final int value ) {
+		b[offset] = (byte)(value >>> 24);
+		b[offset + 1] = (byte)(value >>> 16);
+		b[offset + 2] = (byte)(value >>> 8);
+		b[offset + 3] = (byte)value;
+	}
+}
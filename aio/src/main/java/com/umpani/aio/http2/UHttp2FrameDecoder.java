@@ -0,0 +1,119 @@
+package com.umpani.aio.http2;
+
+import java.util.List;
+
+import com.umpani.aio.UCompositeBuffer;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.codec.UByteToMessageDecoder;
+import com.umpani.aio.exception.UHttp2Exception;
+
+/**
+ * Decodes HTTP/2 frames into {@link UHttp2Frame}s. On the server side the decoder first expects the connection
+ * preface of the client. The decoder checks everything that can be checked per frame: the payload length, the fixed
+ * payload lengths of control frames and whether a frame belongs to a stream or to the connection. A violation is
+ * reported as {@link UHttp2Exception}; after a connection error all further bytes are discarded, a stream error only
+ * skips the frame. Frames of unknown types are passed on and must be ignored.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttp2FrameDecoder extends UByteToMessageDecoder {
+	/**
+	 * Create a new decoder.
+	 * @param expectPreface
+	 * true to decode frames sent by a client, which starts with the connection preface.
+	 * @param maxFrameSize
+	 * the maximal payload length of a frame, as announced in the own settings.
+	 */
+	public UHttp2FrameDecoder( final boolean expectPreface, final int maxFrameSize ) {
+		if (maxFrameSize < UHttp2Frame.DEFAULT_MAX_FRAME_SIZE || maxFrameSize > UHttp2Frame.MAX_FRAME_SIZE_LIMIT) throw new IllegalArgumentException("maxFrameSize: "+maxFrameSize);
+		this.prefaceExpected = expectPreface;
+		this.maxFrameSize = maxFrameSize;
+	}
+
+	/**
+	 * The maximal payload length of a frame.
+	 */
+	private final int maxFrameSize;
+
+	/**
+	 * True as long as the connection preface was not yet received.
+	 */
+	private boolean prefaceExpected;
+
+	/**
+	 * True once a connection error was detected.
+	 */
+	private boolean bad;
+
+	@Override
+	protected void decode( final UHandlerContext ctx, final UCompositeBuffer in, final List<Object> out ) throws Exception {
+		if (bad) {
+			in.skipBytes(in.readableBytes());
+			return;
+		}
+		final int readable = in.readableBytes();
+		if (prefaceExpected) {
+			final byte[] preface = UHttp2Frame.PREFACE;
+			for (int i=0; i < preface.length && i < readable; i++) {
+				if (in.getByte(i)!=preface[i]) throw fail(UHttp2Frame.PROTOCOL_ERROR, "Invalid connection preface");
+			}
+			if (readable < preface.length) return;
+			in.skipBytes(preface.length);
+			prefaceExpected = false;
+			return;
+		}
+		if (readable < UHttp2Frame.HEADER_SIZE) return;
+		final int length = in.getUnsignedMedium(0);
+		final int type = in.getUnsignedByte(3);
+		final int flags = in.getUnsignedByte(4);
+		final int streamId = in.getInt(5) & 0x7fffffff;
+		if (length > maxFrameSize) throw fail(UHttp2Frame.FRAME_SIZE_ERROR, "Frame payload exceeds "+maxFrameSize+" bytes");
+		switch (type) {
+			case UHttp2Frame.DATA: case UHttp2Frame.HEADERS: case UHttp2Frame.PUSH_PROMISE: case UHttp2Frame.CONTINUATION:
+				if (streamId==0) throw fail(UHttp2Frame.PROTOCOL_ERROR, "Frame of type "+type+" without stream");
+				break;
+			case UHttp2Frame.PRIORITY:
+				if (streamId==0) throw fail(UHttp2Frame.PROTOCOL_ERROR, "PRIORITY without stream");
+				if (length!=5) {
+					if (readable < UHttp2Frame.HEADER_SIZE + length) return;
+					in.skipBytes(UHttp2Frame.HEADER_SIZE + length);
+					throw new UHttp2Exception(streamId, UHttp2Frame.FRAME_SIZE_ERROR, "PRIORITY with "+length+" bytes");
+				}
+				break;
+			case UHttp2Frame.RST_STREAM:
+				if (streamId==0) throw fail(UHttp2Frame.PROTOCOL_ERROR, "RST_STREAM without stream");
+				if (length!=4) throw fail(UHttp2Frame.FRAME_SIZE_ERROR, "RST_STREAM with "+length+" bytes");
+				break;
+			case UHttp2Frame.SETTINGS:
+				if (streamId!=0) throw fail(UHttp2Frame.PROTOCOL_ERROR, "SETTINGS on stream "+streamId);
+				if ((flags & UHttp2Frame.ACK)!=0 ? length!=0 : length % 6!=0) throw fail(UHttp2Frame.FRAME_SIZE_ERROR, "SETTINGS with "+length+" bytes");
+				break;
+			case UHttp2Frame.PING:
+				if (streamId!=0) throw fail(UHttp2Frame.PROTOCOL_ERROR, "PING on stream "+streamId);
+				if (length!=8) throw fail(UHttp2Frame.FRAME_SIZE_ERROR, "PING with "+length+" bytes");
+				break;
+			case UHttp2Frame.GOAWAY:
+				if (streamId!=0) throw fail(UHttp2Frame.PROTOCOL_ERROR, "GOAWAY on stream "+streamId);
+				if (length < 8) throw fail(UHttp2Frame.FRAME_SIZE_ERROR, "GOAWAY with "+length+" bytes");
+				break;
+			case UHttp2Frame.WINDOW_UPDATE:
+				if (length!=4) throw fail(UHttp2Frame.FRAME_SIZE_ERROR, "WINDOW_UPDATE with "+length+" bytes");
+				break;
+			default:
+				break;
+		}
+		if (readable < UHttp2Frame.HEADER_SIZE + length) return;
+		in.skipBytes(UHttp2Frame.HEADER_SIZE);
+		final byte[] payload = new byte[length];
+		in.readBytes(payload, 0, length);
+		out.add(new UHttp2Frame(type, flags, streamId, payload));
+	}
+
+	/**
+	 * Switches into the bad state and returns the exception to throw.
+	 */
+	private UHttp2Exception fail( final int errorCode, final String message ) {
+		bad = true;
+		return new UHttp2Exception(errorCode, message);
+	}
+}
@@ -0,0 +1,48 @@
+package com.umpani.aio.http2;
+
+import com.umpani.aio.UBufferOutputStream;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.codec.UMessageToByteEncoder;
+
+/**
+ * Encodes {@link UHttp2Frame}s. On the client side the connection preface is written before the first frame.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttp2FrameEncoder extends UMessageToByteEncoder<UHttp2Frame> {
+	/**
+	 * Create a new encoder.
+	 * @param sendPreface
+	 * true to write the connection preface before the first frame, which is required for a client.
+	 */
+	public UHttp2FrameEncoder( final boolean sendPreface ) {
+		super(UHttp2Frame.class);
+		this.prefacePending = sendPreface;
+	}
+
+	/**
+	 * True as long as the connection preface was not yet written.
+	 */
+	private boolean prefacePending;
+
+	@Override
+	protected void encode( final UHandlerContext ctx, final UHttp2Frame frame, final UBufferOutputStream out ) throws Exception {
+		if (prefacePending) {
+			out.write(UHttp2Frame.PREFACE, 0, UHttp2Frame.PREFACE.length);
+			prefacePending = false;
+		}
+		final byte[] payload = frame.payload();
+		final int length = payload.length;
+		out.write(length >>> 16);
+		out.write(length >>> 8);
+		out.write(length);
+		out.write(frame.type());
+		out.write(frame.flags());
+		final int streamId = frame.streamId();
+		out.write(streamId >>> 24);
+		out.write(streamId >>> 16);
+		out.write(streamId >>> 8);
+		out.write(streamId);
+		out.write(payload, 0, length);
+	}
+}
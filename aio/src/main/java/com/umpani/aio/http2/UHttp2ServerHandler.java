@@ -0,0 +1,201 @@
+package com.umpani.aio.http2;
+
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.exception.UHttp2Exception;
+import com.umpani.aio.exception.UHttpException;
+import com.umpani.aio.http.UHttpHandler;
+import com.umpani.aio.http.UHttpHeaders;
+import com.umpani.aio.http.UHttpMessage;
+import com.umpani.aio.http.UHttpRequest;
+import com.umpani.aio.http.UHttpResponse;
+import com.umpani.util.log.ULogger;
+
+/**
+ * Serves the requests of an HTTP/2 connection with an {@link UHttpHandler}, the same handlers that serve HTTP/1.1,
+ * usually an {@link com.umpani.aio.http.UHttpRouter}. The requests of the streams are handled concurrently and every
+ * response is written as soon as it is ready, independent of the other streams. A request has the version
+ * {@link UHttpMessage#HTTP_2}, its <tt>:authority</tt> is passed as <tt>Host</tt> header and the results and failures
+ * of the handler are converted into responses like with HTTP/1.1.
+ *
+ * </p><p>A request whose header list or body exceeds the limits is answered with status 431 or 413. A response that
+ * switches protocols, like the upgrade to a WebSocket, is not possible with HTTP/2, its stream is reset with
+ * HTTP_1_1_REQUIRED, so that the client repeats the request with HTTP/1.1. The bodies of responses are not compressed
+ * with a content coding.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttp2ServerHandler extends UHttp2ConnectionHandler {
+	/**
+	 * The logger of the HTTP/2 servers.
+	 */
+	private static final ULogger LOG = new ULogger(UHttp2ServerHandler.class.getName());
+
+	/**
+	 * The default maximal amount of concurrent streams of a client.
+	 */
+	public static final int DEFAULT_MAX_CONCURRENT_STREAMS = 100;
+
+	/**
+	 * Create a new handler.
+	 * @param handler
+	 * the handler of the requests, may be shared by any amount of channels.
+	 * @param settings
+	 * the settings announced to the client.
+	 * @param maxBodySize
+	 * the maximal size of a request body.
+	 */
+	public UHttp2ServerHandler( final UHttpHandler handler, final UHttp2Settings settings, final long maxBodySize ) {
+		super(true, settings, maxBodySize);
+		if (handler==null) throw new NullPointerException("handler");
+		this.handler = handler;
+	}
+
+	/**
+	 * The handler of the requests.
+	 */
+	protected final UHttpHandler handler;
+
+	@Override
+	protected UHttpMessage newMessage( final UHttp2Stream stream, final UHttpHeaders headers ) throws UHttp2Exception {
+		String method = null, scheme = null, path = null, authority = null;
+		for (int i=0; i < headers.size(); i++) {
+			final String name = headers.name(i);
+			if (!name.startsWith(":")) break;
+			final String value = headers.value(i);
+			final String previous;
+			switch (name) {
+				case ":method":
+					previous = method;
+					method = value;
+					break;
+				case ":scheme":
+					previous = scheme;
+					scheme = value;
+					break;
+				case ":path":
+					previous = path;
+					path = value;
+					break;
+				case ":authority":
+					previous = authority;
+					authority = value;
+					break;
+				default:
+					throw new UHttp2Exception(stream.id(), UHttp2Frame.PROTOCOL_ERROR, "Unknown pseudo-header field "+name);
+			}
+			if (previous!=null) throw new UHttp2Exception(stream.id(), UHttp2Frame.PROTOCOL_ERROR, "Duplicate pseudo-header field "+name);
+		}
+		if (method==null) throw new UHttp2Exception(stream.id(), UHttp2Frame.PROTOCOL_ERROR, "Missing :method");
+		if (method.equals("CONNECT")) {
+			if (authority==null || scheme!=null || path!=null) throw new UHttp2Exception(stream.id(), UHttp2Frame.PROTOCOL_ERROR, "Malformed CONNECT request");
+			path = authority;
+		} else
+		if (scheme==null || path==null || path.isEmpty()) {
+			throw new UHttp2Exception(stream.id(), UHttp2Frame.PROTOCOL_ERROR, "Missing :scheme or :path");
+		}
+		final UHttpRequest request = new UHttpRequest(method, path, UHttpMessage.HTTP_2);
+		final UHttpHeaders requestHeaders = request.headers();
+		if (authority!=null) requestHeaders.add(UHttpHeaders.HOST, authority);
+		// the cookie may be split into several fields for a better compression
+		StringBuilder cookie = null;
+		for (int i=0; i < headers.size(); i++) {
+			final String name = headers.name(i);
+			if (name.startsWith(":")) continue;
+			if (name.equals("cookie")) {
+				if (cookie==null) {
+					cookie = new StringBuilder(headers.value(i));
+				} else {
+					cookie.append("; ").append(headers.value(i));
+				}
+			} else
+			if (!name.equals("host") || authority==null) {
+				requestHeaders.add(name, headers.value(i));
+			}
+		}
+		if (cookie!=null) requestHeaders.add("cookie", cookie.toString());
+		return request;
+	}
+
+	@Override
+	protected void messageReceived( final UHttp2Stream stream, final UHttpMessage message ) {
+		final UHttpRequest request = (UHttpRequest)message;
+		stream.setAttachment(request);
+		UFuture<?> result;
+		try {
+			result = handler.handle(request);
+			if (result==null) result = UFuture.succeeded(null);
+		} catch (Throwable t) {
+			result = UFuture.failed(t);
+		}
+		complete(stream, request, result);
+	}
+
+	@Override
+	protected void messageFailed( final UHttp2Stream stream, final UHttpException cause ) {
+		write(stream, null, UHttpResponse.error(cause.getStatus(), cause.getMessage()));
+	}
+
+	/**
+	 * Converts the result of the handler into a response.
+	 * @param result
+	 * the result.
+	 * @return
+	 * the response.
+	 * @throws Exception
+	 * if the result can't be converted.
+	 */
+	protected UHttpResponse toResponse( final Object result ) throws Exception {
+		return UHttpResponse.forResult(result);
+	}
+
+	/**
+	 * Converts a failure of the handler into a response. An {@link UHttpException} is answered with its status code,
+	 * invalid JSON with 400 and any other exception with 500, in which case the exception is logged.
+	 * @param request
+	 * the request.
+	 * @param cause
+	 * the failure.
+	 * @return
+	 * the response.
+	 */
+	protected UHttpResponse toErrorResponse( final UHttpRequest request, final Throwable cause ) {
+		if (!UHttpResponse.isExpectedFailure(cause)) {
+			LOG.error("Failed to handle a request", "request", String.valueOf(request), cause);
+		}
+		return UHttpResponse.forFailure(cause);
+	}
+
+	/**
+	 * Writes the response to the request of the given stream once the result is done.
+	 */
+	private <T> void complete( final UHttp2Stream stream, final UHttpRequest request, final UFuture<T> result ) {
+		result.addListener(new UFutureListener<T>() {
+			@Override
+			public void complete( final UFuture<T> future ) {
+				UHttpResponse response;
+				try {
+					response = future.isSuccess() ? toResponse(future.getNow()) : toErrorResponse(request, future.cause());
+				} catch (Throwable t) {
+					response = toErrorResponse(request, t);
+				}
+				write(stream, request, response);
+			}
+		}, context().loop());
+	}
+
+	/**
+	 * Writes a response, unless the stream was reset in the meantime.
+	 */
+	private void write( final UHttp2Stream stream, final UHttpRequest request, final UHttpResponse response ) {
+		if (stream.isClosed()) return;
+		if (response.upgrade()!=null || response.status()==101) {
+			reset(stream, UHttp2Frame.HTTP_1_1_REQUIRED, "Switching protocols requires HTTP/1.1");
+			context().flush();
+			return;
+		}
+		response.setVersion(UHttpMessage.HTTP_2);
+		final UHttpHeaders pseudo = new UHttpHeaders().add(":status", response.status());
+		writeMessage(stream, pseudo, response, request, request!=null && request.method().equals("HEAD"));
+	}
+}
@@ -0,0 +1,267 @@
+package com.umpani.aio.http2;
+
+import com.umpani.aio.exception.UHttp2Exception;
+
+/**
+ * The settings of one side of an HTTP/2 connection. A new instance has the initial values defined by RFC 7540,
+ * {@link #apply(UHttp2Frame)} updates it with the values of a received SETTINGS frame and
+ * {@link #toFrame()} creates the SETTINGS frame that announces the own settings.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHttp2Settings {
+	/**
+	 * The value of unlimited settings.
+	 */
+	public static final int UNLIMITED = Integer.MAX_VALUE;
+
+	/**
+	 * Create new settings with the initial values.
+	 */
+	public UHttp2Settings() {}
+
+	/**
+	 * The maximal size of the dynamic table of the header compression.
+	 */
+	private int headerTableSize = UHpack.DEFAULT_TABLE_SIZE;
+
+	/**
+	 * True if server push is enabled.
+	 */
+	private boolean enablePush = true;
+
+	/**
+	 * The maximal amount of concurrent streams.
+	 */
+	private int maxConcurrentStreams = UNLIMITED;
+
+	/**
+	 * The initial flow control window of a stream.
+	 */
+	private int initialWindowSize = UHttp2Frame.DEFAULT_WINDOW_SIZE;
+
+	/**
+	 * The maximal payload size of a frame.
+	 */
+	private int maxFrameSize = UHttp2Frame.DEFAULT_MAX_FRAME_SIZE;
+
+	/**
+	 * The maximal size of a header list.
+	 */
+	private int maxHeaderListSize = UNLIMITED;
+
+	/**
+	 * Returns the maximal size of the dynamic table of the header compression.
+	 * @return
+	 * the size in bytes.
+	 */
+	public int getHeaderTableSize() {
+		return headerTableSize;
+	}
+
+	/**
+	 * Sets the maximal size of the dynamic table of the header compression.
+	 * @param headerTableSize
+	 * the size in bytes.
+	 * @return
+	 * this.
+	 */
+	public UHttp2Settings setHeaderTableSize( final int headerTableSize ) {
+		if (headerTableSize < 0) throw new IllegalArgumentException("headerTableSize: "+headerTableSize);
+		this.headerTableSize = headerTableSize;
+		return this;
+	}
+
+	/**
+	 * Returns true if server push is enabled.
+	 * @return
+	 * true if server push is enabled.
+	 */
+	public boolean isEnablePush() {
+		return enablePush;
+	}
+
+	/**
+	 * Enables or disables server push.
+	 * @param enablePush
+	 * true to enable server push.
+	 * @return
+	 * this.
+	 */
+	public UHttp2Settings setEnablePush( final boolean enablePush ) {
+		this.enablePush = enablePush;
+		return this;
+	}
+
+	/**
+	 * Returns the maximal amount of concurrent streams.
+	 * @return
+	 * the amount or {@link #UNLIMITED}.
+	 */
+	public int getMaxConcurrentStreams() {
+		return maxConcurrentStreams;
+	}
+
+	/**
+	 * Sets the maximal amount of concurrent streams the peer may open.
+	 * @param maxConcurrentStreams
+	 * the amount or {@link #UNLIMITED}.
+	 * @return
+	 * this.
+	 */
+	public UHttp2Settings setMaxConcurrentStreams( final int maxConcurrentStreams ) {
+		if (maxConcurrentStreams < 0) throw new IllegalArgumentException("maxConcurrentStreams: "+maxConcurrentStreams);
+		this.maxConcurrentStreams = maxConcurrentStreams;
+		return this;
+	}
+
+	/**
+	 * Returns the initial flow control window of a stream.
+	 * @return
+	 * the size in bytes.
+	 */
+	public int getInitialWindowSize() {
+		return initialWindowSize;
+	}
+
+	/**
+	 * Sets the initial flow control window of a stream.
+	 * @param initialWindowSize
+	 * the size in bytes, at most 2^31-1.
+	 * @return
+	 * this.
+	 */
+	public UHttp2Settings setInitialWindowSize( final int initialWindowSize ) {
+		if (initialWindowSize < 0) throw new IllegalArgumentException("initialWindowSize: "+initialWindowSize);
+		this.initialWindowSize = initialWindowSize;
+		return this;
+	}
+
+	/**
+	 * Returns the maximal payload size of a frame.
+	 * @return
+	 * the size in bytes.
+	 */
+	public int getMaxFrameSize() {
+		return maxFrameSize;
+	}
+
+	/**
+	 * Sets the maximal payload size of a frame.
+	 * @param maxFrameSize
+	 * the size in bytes, from 16384 to 2^24-1.
+	 * @return
+	 * this.
+	 */
+	public UHttp2Settings setMaxFrameSize( final int maxFrameSize ) {
+		if (maxFrameSize < UHttp2Frame.DEFAULT_MAX_FRAME_SIZE || maxFrameSize > UHttp2Frame.MAX_FRAME_SIZE_LIMIT) throw new IllegalArgumentException("maxFrameSize: "+maxFrameSize);
+		this.maxFrameSize = maxFrameSize;
+		return this;
+	}
+
+	/**
+	 * Returns the maximal size of a header list.
+	 * @return
+	 * the size in bytes or {@link #UNLIMITED}.
+	 */
+	public int getMaxHeaderListSize() {
+		return maxHeaderListSize;
+	}
+
+	/**
+	 * Sets the maximal size of a header list.
+	 * @param maxHeaderListSize
+	 * the size in bytes or {@link #UNLIMITED}.
+	 * @return
+	 * this.
+	 */
+	public UHttp2Settings setMaxHeaderListSize( final int maxHeaderListSize ) {
+		if (maxHeaderListSize < 0) throw new IllegalArgumentException("maxHeaderListSize: "+maxHeaderListSize);
+		this.maxHeaderListSize = maxHeaderListSize;
+		return this;
+	}
+
+	/**
+	 * Updates the settings with the values of the given SETTINGS frame, unknown settings are ignored.
+	 * @param frame
+	 * the SETTINGS frame without ACK flag.
+	 * @throws UHttp2Exception
+	 * if a value is invalid.
+	 */
+	public void apply( final UHttp2Frame frame ) throws UHttp2Exception {
+		final byte[] payload = frame.payload();
+		for (int offset=0; offset + 6 <= payload.length; offset+=6) {
+			final int id = (payload[offset] & 0xff) << 8 | (payload[offset + 1] & 0xff);
+			final long value = frame.getInt(offset + 2) & 0xffffffffL;
+			final int limited = (int)Math.min(value, UNLIMITED);
+			switch (id) {
+				case UHttp2Frame.SETTINGS_HEADER_TABLE_SIZE:
+					headerTableSize = limited;
+					break;
+				case UHttp2Frame.SETTINGS_ENABLE_PUSH:
+					if (value > 1) throw new UHttp2Exception(UHttp2Frame.PROTOCOL_ERROR, "Invalid SETTINGS_ENABLE_PUSH "+value);
+					enablePush = value==1;
+					break;
+				case UHttp2Frame.SETTINGS_MAX_CONCURRENT_STREAMS:
+					maxConcurrentStreams = limited;
+					break;
+				case UHttp2Frame.SETTINGS_INITIAL_WINDOW_SIZE:
+					if (value > UHttp2Frame.MAX_WINDOW_SIZE) throw new UHttp2Exception(UHttp2Frame.FLOW_CONTROL_ERROR, "Invalid SETTINGS_INITIAL_WINDOW_SIZE "+value);
+					initialWindowSize = (int)value;
+					break;
+				case UHttp2Frame.SETTINGS_MAX_FRAME_SIZE:
+					if (value < UHttp2Frame.DEFAULT_MAX_FRAME_SIZE || value > UHttp2Frame.MAX_FRAME_SIZE_LIMIT) throw new UHttp2Exception(UHttp2Frame.PROTOCOL_ERROR, "Invalid SETTINGS_MAX_FRAME_SIZE "+value);
+					maxFrameSize = (int)value;
+					break;
+				case UHttp2Frame.SETTINGS_MAX_HEADER_LIST_SIZE:
+					maxHeaderListSize = limited;
+					break;
+				default:
+					break;
+			}
+		}
+	}
+
+	/**
+	 * Returns the SETTINGS frame that announces these settings, values equal to the initial values are omitted.
+	 * @return
+	 * the frame.
+	 */
+	public UHttp2Frame toFrame() {
+		final int[] values = new int[12];
+		int length = 0;
+		if (headerTableSize!=UHpack.DEFAULT_TABLE_SIZE) {
+			values[length++] = UHttp2Frame.SETTINGS_HEADER_TABLE_SIZE;
+			values[length++] = headerTableSize;
+		}
+		if (!enablePush) {
+			values[length++] = UHttp2Frame.SETTINGS_ENABLE_PUSH;
+			values[length++] = 0;
+		}
+		if (maxConcurrentStreams!=UNLIMITED) {
+			values[length++] = UHttp2Frame.SETTINGS_MAX_CONCURRENT_STREAMS;
+			values[length++] = maxConcurrentStreams;
+		}
+		if (initialWindowSize!=UHttp2Frame.DEFAULT_WINDOW_SIZE) {
+			values[length++] = UHttp2Frame.SETTINGS_INITIAL_WINDOW_SIZE;
+			values[length++] = initialWindowSize;
+		}
+		if (maxFrameSize!=UHttp2Frame.DEFAULT_MAX_FRAME_SIZE) {
+			values[length++] = UHttp2Frame.SETTINGS_MAX_FRAME_SIZE;
+			values[length++] = maxFrameSize;
+		}
+		if (maxHeaderListSize!=UNLIMITED) {
+			values[length++] = UHttp2Frame.SETTINGS_MAX_HEADER_LIST_SIZE;
+			values[length++] = maxHeaderListSize;
+		}
+		final int[] settings = new int[length];
+		System.arraycopy(values, 0, settings, 0, length);
+		return UHttp2Frame.settings(settings);
+	}
+
+	@Override
+	public String toString() {
+		return "UHttp2Settings[headerTableSize="+headerTableSize+", enablePush="+enablePush+", maxConcurrentStreams="+maxConcurrentStreams
+			+", initialWindowSize="+initialWindowSize+", maxFrameSize="+maxFrameSize+", maxHeaderListSize="+maxHeaderListSize+"]";
+	}
+}
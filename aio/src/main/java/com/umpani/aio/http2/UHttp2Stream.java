@@ -0,0 +1,181 @@
+package com.umpani.aio.http2;
+
+import java.io.ByteArrayOutputStream;
+import java.util.ArrayDeque;
+
+import com.umpani.aio.UFileRegion;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.http.UHttpMessage;
+
+/**
+ * A stream of an HTTP/2 connection, which carries one request and its response. The state of the stream is managed by
+ * the {@link UHttp2ConnectionHandler} in the event loop of the connection: a stream is open until both sides ended it
+ * or it was reset. The attachment may be used by the handler to associate its own state with the stream.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UHttp2Stream {
+	/**
+	 * Create a new stream.
+	 * @param id
+	 * the identifier, odd for streams initiated by the client.
+	 * @param sendWindow
+	 * the initial send window, the initial window size of the peer.
+	 * @param receiveWindow
+	 * the initial receive window, the own initial window size.
+	 */
+	UHttp2Stream( final int id, final int sendWindow, final int receiveWindow ) {
+		this.id = id;
+		this.sendWindow = sendWindow;
+		this.receiveWindow = receiveWindow;
+	}
+
+	/**
+	 * The identifier.
+	 */
+	private final int id;
+
+	/**
+	 * The attachment or null.
+	 */
+	private volatile Object attachment;
+
+	/**
+	 * The amount of bytes that may be sent, may become negative if the peer shrinks its initial window.
+	 */
+	long sendWindow;
+
+	/**
+	 * The amount of bytes the peer may send.
+	 */
+	int receiveWindow;
+
+	/**
+	 * The amount of received bytes not yet announced with a WINDOW_UPDATE.
+	 */
+	int unacknowledged;
+
+	/**
+	 * The DATA waiting for the send window, in the order of the writes.
+	 */
+	final ArrayDeque<Data> pending = new ArrayDeque<>();
+
+	/**
+	 * True once the own side ended the stream.
+	 */
+	boolean localEnded;
+
+	/**
+	 * True once the peer ended the stream.
+	 */
+	boolean remoteEnded;
+
+	/**
+	 * True once the stream was closed or reset.
+	 */
+	volatile boolean closed;
+
+	/**
+	 * The received message, once its header block was received.
+	 */
+	UHttpMessage message;
+
+	/**
+	 * The received body of the message.
+	 */
+	ByteArrayOutputStream body;
+
+	/**
+	 * True if the rest of the received body is discarded, because the message failed.
+	 */
+	boolean discarding;
+
+	/**
+	 * Returns the identifier.
+	 * @return
+	 * the identifier.
+	 */
+	public int id() {
+		return id;
+	}
+
+	/**
+	 * Returns true once the stream was closed or reset.
+	 * @return
+	 * true if the stream is closed.
+	 */
+	public boolean isClosed() {
+		return closed;
+	}
+
+	/**
+	 * Returns the attachment.
+	 * @return
+	 * the attachment or null.
+	 */
+	public Object getAttachment() {
+		return attachment;
+	}
+
+	/**
+	 * Sets the attachment.
+	 * @param attachment
+	 * the attachment or null.
+	 * @return
+	 * this.
+	 */
+	public UHttp2Stream setAttachment( final Object attachment ) {
+		this.attachment = attachment;
+		return this;
+	}
+
+	@Override
+	public String toString() {
+		return "UHttp2Stream["+id+"]";
+	}
+
+	/**
+	 * A part of the body waiting for the send window, either bytes or a region of a file, which is read once it can be
+	 * sent.
+	 */
+	static final class Data {
+		Data( final byte[] data, final UFileRegion region, final boolean end, final UPromise<Void> promise ) {
+			this.data = data;
+			this.region = region;
+			this.end = end;
+			this.promise = promise;
+		}
+
+		/**
+		 * The bytes or null.
+		 */
+		final byte[] data;
+
+		/**
+		 * The region of a file or null.
+		 */
+		final UFileRegion region;
+
+		/**
+		 * True if the part ends the stream.
+		 */
+		final boolean end;
+
+		/**
+		 * The promise completed once the part was written or null.
+		 */
+		final UPromise<Void> promise;
+
+		/**
+		 * The amount of bytes already sent.
+		 */
+		int offset;
+
+		/**
+		 * Returns the amount of bytes not yet sent.
+		 */
+		long remaining() {
+			return region!=null ? region.remaining() : data.length - offset;
+		}
+	}
+}
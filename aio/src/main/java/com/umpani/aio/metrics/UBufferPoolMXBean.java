@@ -0,0 +1,50 @@
+package com.umpani.aio.metrics;
+
+/**
+ * The JMX view of an {@link com.umpani.aio.UBufferPool}, registered by {@link UMetrics}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface UBufferPoolMXBean {
+	/**
+	 * Returns the amount of buffers in use.
+	 * @return
+	 * the amount of allocated, but not yet released buffers.
+	 */
+	public long getActive();
+
+	/**
+	 * Returns the memory in use.
+	 * @return
+	 * the capacity of the allocated, but not yet released buffers in bytes.
+	 */
+	public long getActiveBytes();
+
+	/**
+	 * Returns the amount of allocations.
+	 * @return
+	 * the amount of buffers allocated since the pool was created.
+	 */
+	public long getAllocations();
+
+	/**
+	 * Returns the amount of tracked buffers that were not yet released.
+	 * @return
+	 * the amount of unreleased tracked buffers, always zero if the leak detection is disabled.
+	 */
+	public int getTracked();
+
+	/**
+	 * Returns the amount of tracked buffers that were garbage collected without being released.
+	 * @return
+	 * the amount of leaked buffers.
+	 */
+	public long getLeaked();
+
+	/**
+	 * Returns the leak detection sampling interval.
+	 * @return
+	 * the sampling interval, zero if the leak detection is disabled.
+	 */
+	public int getLeakDetection();
+}
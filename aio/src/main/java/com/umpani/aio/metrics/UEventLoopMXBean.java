@@ -0,0 +1,86 @@
+package com.umpani.aio.metrics;
+
+/**
+ * The JMX view of an {@link com.umpani.aio.UEventLoop} and its connections, registered by {@link UMetrics}. The
+ * latencies are in nanoseconds.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface UEventLoopMXBean {
+	/**
+	 * Returns the name of the loop.
+	 * @return
+	 * the name of the loop.
+	 */
+	public String getName();
+
+	/**
+	 * Returns the amount of submitted tasks that were not yet executed.
+	 * @return
+	 * the depth of the task queue.
+	 */
+	public int getQueuedTasks();
+
+	/**
+	 * Returns the amount of times another thread woke up the loop.
+	 * @return
+	 * the amount of wake-ups.
+	 */
+	public long getWakeups();
+
+	/**
+	 * Returns the amount of iterations of the loop.
+	 * @return
+	 * the amount of iterations.
+	 */
+	public long getIterations();
+
+	/**
+	 * Returns the mean latency of an iteration.
+	 * @return
+	 * the mean latency in nanoseconds.
+	 */
+	public double getIterationLatencyMean();
+
+	/**
+	 * Returns the 99th percentile of the latency of an iteration.
+	 * @return
+	 * the upper bound of the percentile in nanoseconds.
+	 */
+	public long getIterationLatencyP99();
+
+	/**
+	 * Returns the biggest latency of an iteration.
+	 * @return
+	 * the biggest latency in nanoseconds.
+	 */
+	public long getIterationLatencyMax();
+
+	/**
+	 * Returns the amount of open connections.
+	 * @return
+	 * the amount of active channels.
+	 */
+	public int getOpenChannels();
+
+	/**
+	 * Returns the amount of bytes read by the connections.
+	 * @return
+	 * the amount of bytes read.
+	 */
+	public long getBytesRead();
+
+	/**
+	 * Returns the amount of bytes written by the connections.
+	 * @return
+	 * the amount of bytes written.
+	 */
+	public long getBytesWritten();
+
+	/**
+	 * Returns the amount of bytes the connections queued, but not yet written.
+	 * @return
+	 * the amount of pending write bytes.
+	 */
+	public long getPendingWriteBytes();
+}
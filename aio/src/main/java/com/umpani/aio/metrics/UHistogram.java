@@ -0,0 +1,147 @@
+package com.umpani.aio.metrics;
+
+import java.util.concurrent.atomic.AtomicLong;
+import java.util.concurrent.atomic.AtomicLongArray;
+
+import com.umpani.util.UMap;
+
+/**
+ * A lock-free histogram of non-negative values, like latencies in nanoseconds. The values are counted in buckets of
+ * powers of two, so that recording is a few atomic increments without any allocation, and percentiles are exact up to
+ * a factor of two, which is good enough to tell a healthy from a stalled event loop. Values may be recorded and read
+ * concurrently by any threads, a snapshot is not atomic.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UHistogram {
+	/**
+	 * The amount of buckets, bucket <tt>i</tt> counts the values less than <tt>2^i</tt> and not less than
+	 * <tt>2^(i-1)</tt>, bucket zero counts the zeros.
+	 */
+	private static final int BUCKETS = 64;
+
+	/**
+	 * Create a new empty histogram.
+	 */
+	public UHistogram() {}
+
+	/**
+	 * The counts of the buckets.
+	 */
+	private final AtomicLongArray buckets = new AtomicLongArray(BUCKETS);
+
+	/**
+	 * The amount of recorded values.
+	 */
+	private final AtomicLong count = new AtomicLong();
+
+	/**
+	 * The sum of the recorded values.
+	 */
+	private final AtomicLong sum = new AtomicLong();
+
+	/**
+	 * The biggest recorded value.
+	 */
+	private final AtomicLong max = new AtomicLong();
+
+	/**
+	 * Records a value.
+	 * @param value
+	 * the value, negative values are recorded as zero.
+	 */
+	public void record( final long value ) {
+		final long v = value > 0 ? value : 0L;
+		buckets.incrementAndGet(64 - Long.numberOfLeadingZeros(v));
+		count.incrementAndGet();
+		sum.addAndGet(v);
+		long m;
+		while (v > (m = max.get()) && !max.compareAndSet(m, v)) {
+			// retry, another thread recorded a bigger value meanwhile
+		}
+	}
+
+	/**
+	 * Returns the amount of recorded values.
+	 * @return
+	 * the amount of recorded values.
+	 */
+	public long getCount() {
+		return count.get();
+	}
+
+	/**
+	 * Returns the sum of the recorded values.
+	 * @return
+	 * the sum of the recorded values.
+	 */
+	public long getSum() {
+		return sum.get();
+	}
+
+	/**
+	 * Returns the biggest recorded value.
+	 * @return
+	 * the biggest recorded value or zero, if nothing was recorded.
+	 */
+	public long getMax() {
+		return max.get();
+	}
+
+	/**
+	 * Returns the mean of the recorded values.
+	 * @return
+	 * the mean or zero, if nothing was recorded.
+	 */
+	public double getMean() {
+		final long n = count.get();
+		return n > 0 ? (double)sum.get() / n : 0d;
+	}
+
+	/**
+	 * Returns an upper bound of the given percentile, which is at most twice the exact value and never more than the
+	 * biggest recorded value.
+	 * @param percentile
+	 * the percentile between zero and one, for example 0.99.
+	 * @return
+	 * the upper bound or zero, if nothing was recorded.
+	 * @throws IllegalArgumentException
+	 * if the percentile is not between zero and one.
+	 */
+	public long getPercentile( final double percentile ) {
+		if (!(percentile >= 0d && percentile <= 1d)) throw new IllegalArgumentException("percentile: "+percentile);
+		long total = 0;
+		for (int i=0; i < BUCKETS; i++) total += buckets.get(i);
+		if (total==0) return 0L;
+		final long rank = Math.max(1L, (long)Math.ceil(percentile * total));
+		long seen = 0;
+		for (int i=0; i < BUCKETS; i++) {
+			seen += buckets.get(i);
+			if (seen >= rank) return Math.min((1L << i) - 1, max.get());
+		}
+		return max.get();
+	}
+
+	/**
+	 * Returns a snapshot of the count, the mean, the maximum and the percentiles 50, 90, 99 and 99.9.
+	 * @return
+	 * the snapshot with the keys <tt>count</tt>, <tt>mean</tt>, <tt>max</tt>, <tt>p50</tt>, <tt>p90</tt>,
+	 * <tt>p99</tt> and <tt>p999</tt>.
+	 */
+	public UMap<String,Object> snapshot() {
+		final UMap<String,Object> snapshot = new UMap<String,Object>();
+		snapshot.put("count", getCount());
+		snapshot.put("mean", getMean());
+		snapshot.put("max", getMax());
+		snapshot.put("p50", getPercentile(0.5));
+		snapshot.put("p90", getPercentile(0.9));
+		snapshot.put("p99", getPercentile(0.99));
+		snapshot.put("p999", getPercentile(0.999));
+		return snapshot;
+	}
+
+	@Override
+	public String toString() {
+		return "UHistogram[count="+getCount()+", max="+getMax()+"]";
+	}
+}
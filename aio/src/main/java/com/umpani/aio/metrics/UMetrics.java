@@ -0,0 +1,366 @@
+package com.umpani.aio.metrics;
+
+import java.lang.management.ManagementFactory;
+import java.util.ArrayList;
+import java.util.LinkedHashMap;
+import java.util.Map;
+
+import javax.management.JMException;
+import javax.management.MBeanServer;
+import javax.management.ObjectName;
+import javax.management.StandardMBean;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UEventLoop;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.http.UHttpHandler;
+import com.umpani.aio.http.UHttpRequest;
+import com.umpani.util.UMap;
+
+/**
+ * Collects the metrics of event loops, their connections and buffer pools. The metrics are counted by the loops,
+ * channels and pools themselves without locks, this class only reads them: as JMX MBeans, see
+ * {@link #registerMBeans()}, and as snapshot, which is served as JSON when the metrics are used as handler of an
+ * {@link com.umpani.aio.http.UHttpRouter} route, for example <tt>router.get("/metrics", metrics)</tt>.
+ *
+ * </p><p>The snapshot looks like:
+ * <pre>
+ * {
+ *   "loops": {"io-0": {"queuedTasks": 0, "wakeups": 17, "iterations": 52, "iterationLatency": {"count": 52, ...},
+ *     "openChannels": 2, "bytesRead": 1024, "bytesWritten": 4096, "pendingWriteBytes": 0}},
+ *   "connections": {"open": 2, "bytesRead": 1024, "bytesWritten": 4096, "pendingWriteBytes": 0},
+ *   "pools": {"default": {"active": 3, "activeBytes": 768, "allocations": 120, "tracked": 0, "leaked": 0}}
+ * }
+ * </pre>
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UMetrics implements UHttpHandler {
+	/**
+	 * The default JMX domain.
+	 */
+	public static final String DEFAULT_DOMAIN = "com.umpani.aio";
+
+	/**
+	 * Create new metrics that register the MBeans in the default domain.
+	 */
+	public UMetrics() {
+		this(DEFAULT_DOMAIN);
+	}
+
+	/**
+	 * Create new metrics.
+	 * @param domain
+	 * the JMX domain of the MBeans.
+	 */
+	public UMetrics( final String domain ) {
+		if (domain==null) throw new NullPointerException("domain");
+		this.domain = domain;
+	}
+
+	/**
+	 * The JMX domain.
+	 */
+	private final String domain;
+
+	/**
+	 * The loops by name.
+	 */
+	private final LinkedHashMap<String, UEventLoop> loops = new LinkedHashMap<>();
+
+	/**
+	 * The pools by name.
+	 */
+	private final LinkedHashMap<String, UBufferPool> pools = new LinkedHashMap<>();
+
+	/**
+	 * The names of the registered MBeans.
+	 */
+	private final ArrayList<ObjectName> registered = new ArrayList<>();
+
+	/**
+	 * The server at which the MBeans are registered or null.
+	 */
+	private MBeanServer server;
+
+	/**
+	 * Adds an event loop, replacing a loop with the same name.
+	 * @param loop
+	 * the loop.
+	 * @return
+	 * this.
+	 */
+	public synchronized UMetrics add( final UEventLoop loop ) {
+		if (loop==null) throw new NullPointerException("loop");
+		loops.put(loop.getName(), loop);
+		return this;
+	}
+
+	/**
+	 * Adds all event loops of the given group.
+	 * @param group
+	 * the group.
+	 * @return
+	 * this.
+	 */
+	public UMetrics add( final UEventLoopGroup group ) {
+		for (int i=0; i < group.size(); i++) add(group.get(i));
+		return this;
+	}
+
+	/**
+	 * Adds a buffer pool, replacing a pool with the same name.
+	 * @param name
+	 * the name of the pool.
+	 * @param pool
+	 * the pool.
+	 * @return
+	 * this.
+	 */
+	public synchronized UMetrics add( final String name, final UBufferPool pool ) {
+		if (name==null) throw new NullPointerException("name");
+		if (pool==null) throw new NullPointerException("pool");
+		pools.put(name, pool);
+		return this;
+	}
+
+	/**
+	 * Returns a snapshot of all metrics, the values of the single metrics are read one after another, so the
+	 * snapshot is not atomic.
+	 * @return
+	 * the snapshot.
+	 */
+	public synchronized UMap<String,Object> snapshot() {
+		final UMap<String,Object> loops = new UMap<String,Object>();
+		long open = 0, bytesRead = 0, bytesWritten = 0, pendingWriteBytes = 0;
+		for (final Map.Entry<String, UEventLoop> entry : this.loops.entrySet()) {
+			final UEventLoop loop = entry.getValue();
+			final UMap<String,Object> metrics = new UMap<String,Object>();
+			metrics.put("queuedTasks", loop.getQueuedTasks());
+			metrics.put("wakeups", loop.getWakeups());
+			metrics.put("iterations", loop.getIterations());
+			metrics.put("iterationLatency", loop.iterationLatency().snapshot());
+			metrics.put("openChannels", loop.getOpenChannels());
+			metrics.put("bytesRead", loop.getBytesRead());
+			metrics.put("bytesWritten", loop.getBytesWritten());
+			metrics.put("pendingWriteBytes", loop.getPendingWriteBytes());
+			loops.put(entry.getKey(), metrics);
+			open += loop.getOpenChannels();
+			bytesRead += loop.getBytesRead();
+			bytesWritten += loop.getBytesWritten();
+			pendingWriteBytes += loop.getPendingWriteBytes();
+		}
+		final UMap<String,Object> connections = new UMap<String,Object>();
+		connections.put("open", open);
+		connections.put("bytesRead", bytesRead);
+		connections.put("bytesWritten", bytesWritten);
+		connections.put("pendingWriteBytes", pendingWriteBytes);
+		final UMap<String,Object> pools = new UMap<String,Object>();
+		for (final Map.Entry<String, UBufferPool> entry : this.pools.entrySet()) {
+			final UBufferPool pool = entry.getValue();
+			final UMap<String,Object> metrics = new UMap<String,Object>();
+			metrics.put("active", pool.getActive());
+			metrics.put("activeBytes", pool.getActiveBytes());
+			metrics.put("allocations", pool.getAllocations());
+			metrics.put("tracked", pool.getTracked());
+			metrics.put("leaked", pool.getLeaked());
+			pools.put(entry.getKey(), metrics);
+		}
+		return UMap.of(String.class, Object.class, "loops", loops, "connections", connections, "pools", pools);
+	}
+
+	/**
+	 * Serves the snapshot as JSON.
+	 */
+	@Override
+	public UFuture<?> handle( final UHttpRequest request ) throws Exception {
+		return UFuture.succeeded(snapshot());
+	}
+
+	/**
+	 * Registers the MBeans of the added loops and pools at the platform MBean server.
+	 * @return
+	 * this.
+	 * @throws JMException
+	 * if the registration failed.
+	 * @see #registerMBeans(MBeanServer)
+	 */
+	public UMetrics registerMBeans() throws JMException {
+		return registerMBeans(ManagementFactory.getPlatformMBeanServer());
+	}
+
+	/**
+	 * Registers the MBeans of the added loops and pools as <tt>domain:type=EventLoop,name=...</tt> and
+	 * <tt>domain:type=BufferPool,name=...</tt>. Previously registered MBeans are unregistered first, so that this
+	 * method may be called again after further loops or pools were added.
+	 * @param server
+	 * the MBean server.
+	 * @return
+	 * this.
+	 * @throws JMException
+	 * if the registration failed, then no MBean is registered.
+	 */
+	public synchronized UMetrics registerMBeans( final MBeanServer server ) throws JMException {
+		if (server==null) throw new NullPointerException("server");
+		unregisterMBeans();
+		this.server = server;
+		try {
+			for (final UEventLoop loop : loops.values()) register(name("EventLoop", loop.getName()), new StandardMBean(new LoopBean(loop), UEventLoopMXBean.class, true));
+			for (final Map.Entry<String, UBufferPool> entry : pools.entrySet()) register(name("BufferPool", entry.getKey()), new StandardMBean(new PoolBean(entry.getValue()), UBufferPoolMXBean.class, true));
+		} catch (JMException e) {
+			unregisterMBeans();
+			throw e;
+		}
+		return this;
+	}
+
+	/**
+	 * Unregisters all MBeans registered by {@link #registerMBeans(MBeanServer)}.
+	 */
+	public synchronized void unregisterMBeans() {
+		if (server==null) return;
+		for (final ObjectName name : registered) {
+			try {
+				server.unregisterMBean(name);
+			} catch (JMException e) {
+				// already unregistered by someone else
+			}
+		}
+		registered.clear();
+		server = null;
+	}
+
+	/**
+	 * Registers an MBean.
+	 */
+	private void register( final ObjectName name, final StandardMBean bean ) throws JMException {
+		server.registerMBean(bean, name);
+		registered.add(name);
+	}
+
+	/**
+	 * Returns the name of an MBean.
+	 */
+	private ObjectName name( final String type, final String name ) throws JMException {
+		return new ObjectName(domain+":type="+type+",name="+ObjectName.quote(name));
+	}
+
+	@Override
+	public synchronized String toString() {
+		return "UMetrics[loops="+loops.keySet()+", pools="+pools.keySet()+"]";
+	}
+
+	/**
+	 * The MBean of an event loop.
+	 */
+	private static final class LoopBean implements UEventLoopMXBean {
+		LoopBean( final UEventLoop loop ) {
+			this.loop = loop;
+		}
+
+		/**
+		 * The loop.
+		 */
+		private final UEventLoop loop;
+
+		@Override
+		public String getName() {
+			return loop.getName();
+		}
+
+		@Override
+		public int getQueuedTasks() {
+			return loop.getQueuedTasks();
+		}
+
+		@Override
+		public long getWakeups() {
+			return loop.getWakeups();
+		}
+
+		@Override
+		public long getIterations() {
+			return loop.getIterations();
+		}
+
+		@Override
+		public double getIterationLatencyMean() {
+			return loop.iterationLatency().getMean();
+		}
+
+		@Override
+		public long getIterationLatencyP99() {
+			return loop.iterationLatency().getPercentile(0.99);
+		}
+
+		@Override
+		public long getIterationLatencyMax() {
+			return loop.iterationLatency().getMax();
+		}
+
+		@Override
+		public int getOpenChannels() {
+			return loop.getOpenChannels();
+		}
+
+		@Override
+		public long getBytesRead() {
+			return loop.getBytesRead();
+		}
+
+		@Override
+		public long getBytesWritten() {
+			return loop.getBytesWritten();
+		}
+
+		@Override
+		public long getPendingWriteBytes() {
+			return loop.getPendingWriteBytes();
+		}
+	}
+
+	/**
+	 * The MBean of a buffer pool.
+	 */
+	private static final class PoolBean implements UBufferPoolMXBean {
+		PoolBean( final UBufferPool pool ) {
+			this.pool = pool;
+		}
+
+		/**
+		 * The pool.
+		 */
+		private final UBufferPool pool;
+
+		@Override
+		public long getActive() {
+			return pool.getActive();
+		}
+
+		@Override
+		public long getActiveBytes() {
+			return pool.getActiveBytes();
+		}
+
+		@Override
+		public long getAllocations() {
+			return pool.getAllocations();
+		}
+
+		@Override
+		public int getTracked() {
+			return pool.getTracked();
+		}
+
+		@Override
+		public long getLeaked() {
+			return pool.getLeaked();
+		}
+
+		@Override
+		public int getLeakDetection() {
+			return pool.getLeakDetection();
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package com.umpani.aio.resilience;
+
+import java.util.ArrayDeque;
+import java.util.concurrent.Callable;
+
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.exception.UBulkheadFullException;
+import com.umpani.util.UMap;
+
+/**
+ * A bulkhead that limits the amount of concurrent calls, so that a slow service can't consume all connections or
+ * memory of its callers. Calls beyond the limit wait in a queue and are started by the thread that completes a
+ * running call, calls beyond the queue are rejected with an {@link UBulkheadFullException}. Cancelling a waiting call
+ * removes it from the queue.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UBulkhead extends UPolicy {
+	/**
+	 * Create a new bulkhead.
+	 * @param maxConcurrent
+	 * the maximal amount of concurrent calls.
+	 * @param maxQueued
+	 * the maximal amount of waiting calls, zero to reject calls beyond the limit immediately.
+	 */
+	public UBulkhead( final int maxConcurrent, final int maxQueued ) {
+		if (maxConcurrent < 1) throw new IllegalArgumentException("maxConcurrent: "+maxConcurrent);
+		if (maxQueued < 0) throw new IllegalArgumentException("maxQueued: "+maxQueued);
+		this.maxConcurrent = maxConcurrent;
+		this.maxQueued = maxQueued;
+	}
+
+	/**
+	 * The maximal amount of concurrent calls.
+	 */
+	private final int maxConcurrent;
+
+	/**
+	 * The maximal amount of waiting calls.
+	 */
+	private final int maxQueued;
+
+	/**
+	 * The waiting calls.
+	 */
+	private final ArrayDeque<Runnable> queue = new ArrayDeque<>();
+
+	/**
+	 * The amount of running calls.
+	 */
+	private int active;
+
+	/**
+	 * The amount of rejected calls.
+	 */
+	private long rejected;
+
+	/**
+	 * Returns the amount of running calls.
+	 * @return
+	 * the amount of running calls.
+	 */
+	public synchronized int getActive() {
+		return active;
+	}
+
+	/**
+	 * Returns the amount of waiting calls.
+	 * @return
+	 * the amount of waiting calls.
+	 */
+	public synchronized int getQueued() {
+		return queue.size();
+	}
+
+	@Override
+	public <T> UFuture<T> execute( final Callable<? extends UFuture<T>> call ) {
+		final UPromise<T> promise = new UPromise<T>();
+		final Runnable task = new Runnable() {
+			@Override
+			public void run() {
+				if (promise.isDone()) {
+					release();
+					return;
+				}
+				final UFuture<T> future = start(call);
+				cancelWith(promise, future);
+				promise.completeWith(future);
+			}
+		};
+		promise.onCancel(new Runnable() {
+			@Override
+			public void run() {
+				synchronized (UBulkhead.this) {
+					queue.remove(task);
+				}
+			}
+		});
+		final boolean queued;
+		synchronized (this) {
+			if (active < maxConcurrent) {
+				active++;
+				queued = false;
+			} else if (queue.size() < maxQueued) {
+				queue.add(task);
+				queued = true;
+			} else {
+				rejected++;
+				return UFuture.failed(new UBulkheadFullException(maxConcurrent, maxQueued));
+			}
+		}
+		if (!queued) return start(call);
+		return promise;
+	}
+
+	@Override
+	public synchronized UMap<String,Object> snapshot() {
+		final UMap<String,Object> snapshot = new UMap<String,Object>();
+		snapshot.put("type", "bulkhead");
+		snapshot.put("active", active);
+		snapshot.put("queued", queue.size());
+		snapshot.put("maxConcurrent", maxConcurrent);
+		snapshot.put("maxQueued", maxQueued);
+		snapshot.put("rejected", rejected);
+		return snapshot;
+	}
+
+	@Override
+	public synchronized String toString() {
+		return "UBulkhead[active="+active+", queued="+queue.size()+"]";
+	}
+
+	/**
+	 * Invokes a call for which a slot was taken and releases the slot, once the call is done.
+	 */
+	private <T> UFuture<T> start( final Callable<? extends UFuture<T>> call ) {
+		final UFuture<T> future = invoke(call);
+		future.addListener(new UFutureListener<T>() {
+			@Override
+			public void complete( final UFuture<T> future ) {
+				release();
+			}
+		}, null);
+		return future;
+	}
+
+	/**
+	 * Passes the slot of a finished call to the next waiting call or frees it.
+	 */
+	private void release() {
+		final Runnable next;
+		synchronized (this) {
+			next = queue.poll();
+			if (next==null) active--;
+		}
+		if (next!=null) next.run();
+	}
+}
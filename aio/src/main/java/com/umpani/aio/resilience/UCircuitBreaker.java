@@ -0,0 +1,379 @@
+package com.umpani.aio.resilience;
+
+import java.util.concurrent.Callable;
+import java.util.concurrent.CancellationException;
+import java.util.concurrent.TimeUnit;
+
+import com.umpani.aio.UClock;
+import com.umpani.aio.UFunction;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.exception.UCircuitOpenException;
+import com.umpani.util.UMap;
+
+/**
+ * A circuit breaker that stops calling a failing service. The outcomes of the calls are recorded in a sliding window
+ * of the last calls, once the window holds the minimal amount of calls and the failure rate reaches the threshold,
+ * the breaker opens and rejects all calls with an {@link UCircuitOpenException}. After the open duration the breaker
+ * is half open and executes a limited amount of trial calls; if all of them succeed, the breaker closes with an
+ * empty window, otherwise it opens again.
+ *
+ * </p><p>By default all failures except cancellations count, a predicate given to {@link #setFailureOn(UFunction)}
+ * may restrict that, for example to ignore failures caused by invalid requests. Cancelled calls are not recorded.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UCircuitBreaker extends UPolicy {
+	/**
+	 * Create a new circuit breaker that uses the system clock.
+	 */
+	public UCircuitBreaker() {
+		this(UClock.SYSTEM);
+	}
+
+	/**
+	 * Create a new circuit breaker with a window of 100 calls, of which at least 10 are required to open the
+	 * breaker, the failure rate threshold 0.5, an open duration of 30 seconds and 3 trial calls.
+	 * @param clock
+	 * the clock that measures the open duration, for example the clock of the timer wheel of an event loop.
+	 */
+	public UCircuitBreaker( final UClock clock ) {
+		if (clock==null) throw new NullPointerException("clock");
+		this.clock = clock;
+	}
+
+	/**
+	 * The clock.
+	 */
+	private final UClock clock;
+
+	/**
+	 * The outcomes in the window, true for a failure.
+	 */
+	private boolean[] window = new boolean[100];
+
+	/**
+	 * The index of the next outcome in the window.
+	 */
+	private int windowIndex;
+
+	/**
+	 * The amount of outcomes in the window.
+	 */
+	private int windowCalls;
+
+	/**
+	 * The amount of failures in the window.
+	 */
+	private int windowFailures;
+
+	/**
+	 * The minimal amount of calls in the window before the breaker opens.
+	 */
+	private int minCalls = 10;
+
+	/**
+	 * The failure rate at which the breaker opens.
+	 */
+	private double threshold = 0.5d;
+
+	/**
+	 * The time in nanoseconds the breaker stays open.
+	 */
+	private long openDuration = TimeUnit.SECONDS.toNanos(30);
+
+	/**
+	 * The amount of trial calls in the half open state.
+	 */
+	private int trialCalls = 3;
+
+	/**
+	 * The predicate that decides whether a failure counts or null, to count all failures.
+	 */
+	private volatile UFunction<? super Throwable, Boolean> failureOn;
+
+	/**
+	 * The state.
+	 */
+	private UCircuitState state = UCircuitState.CLOSED;
+
+	/**
+	 * Incremented with every state change, so that outcomes of calls permitted in an earlier state are not recorded.
+	 */
+	private int generation;
+
+	/**
+	 * The clock time at which the breaker opened.
+	 */
+	private long openedAt;
+
+	/**
+	 * The amount of trial calls started in the half open state.
+	 */
+	private int trialsStarted;
+
+	/**
+	 * The amount of trial calls that succeeded in the half open state.
+	 */
+	private int trialsSucceeded;
+
+	/**
+	 * The amount of executed calls.
+	 */
+	private long calls;
+
+	/**
+	 * The amount of failed calls.
+	 */
+	private long failures;
+
+	/**
+	 * The amount of rejected calls.
+	 */
+	private long rejected;
+
+	/**
+	 * Sets the size of the sliding window, this clears the window.
+	 * @param size
+	 * the amount of last calls whose outcomes are recorded.
+	 * @param minCalls
+	 * the minimal amount of calls in the window before the breaker opens.
+	 * @return
+	 * this.
+	 */
+	public synchronized UCircuitBreaker setWindow( final int size, final int minCalls ) {
+		if (size < 1) throw new IllegalArgumentException("size: "+size);
+		if (minCalls < 1 || minCalls > size) throw new IllegalArgumentException("minCalls: "+minCalls);
+		this.window = new boolean[size];
+		this.minCalls = minCalls;
+		clearWindow();
+		return this;
+	}
+
+	/**
+	 * Sets the failure rate at which the breaker opens.
+	 * @param threshold
+	 * the failure rate, greater than zero and at most one.
+	 * @return
+	 * this.
+	 */
+	public synchronized UCircuitBreaker setFailureRateThreshold( final double threshold ) {
+		if (!(threshold > 0d && threshold <= 1d)) throw new IllegalArgumentException("threshold: "+threshold);
+		this.threshold = threshold;
+		return this;
+	}
+
+	/**
+	 * Sets the time the breaker stays open before trial calls are executed.
+	 * @param duration
+	 * the duration.
+	 * @param unit
+	 * the unit of the duration.
+	 * @return
+	 * this.
+	 */
+	public synchronized UCircuitBreaker setOpenDuration( final long duration, final TimeUnit unit ) {
+		if (duration < 0) throw new IllegalArgumentException("duration: "+duration);
+		this.openDuration = unit.toNanos(duration);
+		return this;
+	}
+
+	/**
+	 * Sets the amount of trial calls in the half open state.
+	 * @param trialCalls
+	 * the amount of trial calls that must succeed to close the breaker.
+	 * @return
+	 * this.
+	 */
+	public synchronized UCircuitBreaker setTrialCalls( final int trialCalls ) {
+		if (trialCalls < 1) throw new IllegalArgumentException("trialCalls: "+trialCalls);
+		this.trialCalls = trialCalls;
+		return this;
+	}
+
+	/**
+	 * Sets the predicate that decides whether a failure counts, cancellations never count.
+	 * @param failureOn
+	 * the predicate, which returns true if the failure counts, or null to count all failures.
+	 * @return
+	 * this.
+	 */
+	public UCircuitBreaker setFailureOn( final UFunction<? super Throwable, Boolean> failureOn ) {
+		this.failureOn = failureOn;
+		return this;
+	}
+
+	/**
+	 * Returns the state, an open breaker whose open duration elapsed is half open.
+	 * @return
+	 * the state.
+	 */
+	public synchronized UCircuitState getState() {
+		update();
+		return state;
+	}
+
+	/**
+	 * Returns the failure rate of the calls in the sliding window.
+	 * @return
+	 * the failure rate between zero and one, zero if the window is empty.
+	 */
+	public synchronized double getFailureRate() {
+		return windowCalls==0 ? 0d : (double)windowFailures / windowCalls;
+	}
+
+	/**
+	 * Closes the breaker and clears the window.
+	 */
+	public synchronized void reset() {
+		transition(UCircuitState.CLOSED);
+	}
+
+	/**
+	 * Opens the breaker, for example because a health check failed.
+	 */
+	public synchronized void open() {
+		transition(UCircuitState.OPEN);
+	}
+
+	@Override
+	public <T> UFuture<T> execute( final Callable<? extends UFuture<T>> call ) {
+		final int generation;
+		try {
+			generation = acquire();
+		} catch (UCircuitOpenException e) {
+			return UFuture.failed(e);
+		}
+		final UFuture<T> future = invoke(call);
+		future.addListener(new UFutureListener<T>() {
+			@Override
+			public void complete( final UFuture<T> future ) {
+				if (future.isSuccess()) {
+					record(generation, Boolean.FALSE);
+				} else {
+					record(generation, counts(future.cause()));
+				}
+			}
+		}, null);
+		return future;
+	}
+
+	@Override
+	public synchronized UMap<String,Object> snapshot() {
+		update();
+		final UMap<String,Object> snapshot = new UMap<String,Object>();
+		snapshot.put("type", "circuitBreaker");
+		snapshot.put("state", state.name());
+		snapshot.put("failureRate", getFailureRate());
+		snapshot.put("windowCalls", windowCalls);
+		snapshot.put("calls", calls);
+		snapshot.put("failures", failures);
+		snapshot.put("rejected", rejected);
+		return snapshot;
+	}
+
+	@Override
+	public synchronized String toString() {
+		return "UCircuitBreaker[state="+state+", failureRate="+getFailureRate()+"]";
+	}
+
+	/**
+	 * Returns true if the given failure counts, null if the outcome is not recorded at all.
+	 */
+	private Boolean counts( final Throwable cause ) {
+		if (cause instanceof CancellationException) return null;
+		final UFunction<? super Throwable, Boolean> failureOn = this.failureOn;
+		if (failureOn==null) return Boolean.TRUE;
+		try {
+			return Boolean.valueOf(Boolean.TRUE.equals(failureOn.apply(cause)));
+		} catch (Throwable t) {
+			return Boolean.TRUE;
+		}
+	}
+
+	/**
+	 * Permits a call or throws the exception with which the call is rejected.
+	 * @return
+	 * the generation in which the call was permitted.
+	 */
+	private synchronized int acquire() throws UCircuitOpenException {
+		update();
+		switch (state) {
+			case OPEN:
+				rejected++;
+				throw new UCircuitOpenException(Math.max(0L, openDuration - (clock.nanoTime() - openedAt)));
+			case HALF_OPEN:
+				if (trialsStarted >= trialCalls) {
+					rejected++;
+					throw new UCircuitOpenException(0L);
+				}
+				trialsStarted++;
+				break;
+			default:
+				break;
+		}
+		calls++;
+		return generation;
+	}
+
+	/**
+	 * Records the outcome of a call.
+	 * @param generation
+	 * the generation in which the call was permitted.
+	 * @param failed
+	 * true if the call failed, false if it succeeded and null if the outcome is ignored.
+	 */
+	private synchronized void record( final int generation, final Boolean failed ) {
+		if (Boolean.TRUE.equals(failed)) failures++;
+		if (generation!=this.generation) return;
+		if (state==UCircuitState.HALF_OPEN) {
+			if (failed==null) {
+				// the trial is repeated by the next call
+				trialsStarted--;
+			} else if (failed.booleanValue()) {
+				transition(UCircuitState.OPEN);
+			} else if (++trialsSucceeded >= trialCalls) {
+				transition(UCircuitState.CLOSED);
+			}
+			return;
+		}
+		if (state!=UCircuitState.CLOSED || failed==null) return;
+		if (windowCalls==window.length) {
+			if (window[windowIndex]) windowFailures--;
+		} else {
+			windowCalls++;
+		}
+		window[windowIndex] = failed.booleanValue();
+		if (failed.booleanValue()) windowFailures++;
+		windowIndex = (windowIndex + 1) % window.length;
+		if (windowCalls >= minCalls && getFailureRate() >= threshold) transition(UCircuitState.OPEN);
+	}
+
+	/**
+	 * Moves an open breaker whose open duration elapsed into the half open state.
+	 */
+	private void update() {
+		if (state==UCircuitState.OPEN && clock.nanoTime() - openedAt >= openDuration) transition(UCircuitState.HALF_OPEN);
+	}
+
+	/**
+	 * Changes the state.
+	 */
+	private void transition( final UCircuitState state ) {
+		this.state = state;
+		generation++;
+		trialsStarted = 0;
+		trialsSucceeded = 0;
+		if (state==UCircuitState.OPEN) openedAt = clock.nanoTime();
+		if (state==UCircuitState.CLOSED) clearWindow();
+	}
+
+	/**
+	 * Clears the sliding window.
+	 */
+	private void clearWindow() {
+		windowIndex = 0;
+		windowCalls = 0;
+		windowFailures = 0;
+	}
+}
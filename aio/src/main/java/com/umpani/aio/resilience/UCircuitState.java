@@ -0,0 +1,24 @@
+package com.umpani.aio.resilience;
+
+/**
+ * The states of an {@link UCircuitBreaker}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public enum UCircuitState {
+	/**
+	 * All calls are executed, their outcomes are recorded in the sliding window.
+	 */
+	CLOSED,
+
+	/**
+	 * The failure rate exceeded the threshold, all calls are rejected until the open duration elapsed.
+	 */
+	OPEN,
+
+	/**
+	 * The open duration elapsed, a limited amount of trial calls is executed to decide whether the breaker closes
+	 * again or opens again.
+	 */
+	HALF_OPEN
+}
@@ -0,0 +1,138 @@
+package com.umpani.aio.resilience;
+
+import java.util.concurrent.Callable;
+
+import com.umpani.aio.UFunction;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UPromise;
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+
+/**
+ * A policy that protects asynchronous calls, like {@link URetry}, {@link UCircuitBreaker}, {@link URateLimiter} and
+ * {@link UBulkhead}. A policy executes any call that returns an {@link UFuture} without blocking, waits are scheduled
+ * at the timer wheel of an event loop. Policies are thread safe and may be shared by any amount of callers.
+ *
+ * </p><p>Policies compose with {@link #and(UPolicy)}, the outer policy sees every execution of the inner one, so
+ * <tt>retry.and(breaker).and(bulkhead)</tt> retries calls that were rejected by the breaker or the bulkhead, while
+ * <tt>breaker.and(retry)</tt> counts a call with all its retries as one call.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public abstract class UPolicy {
+	/**
+	 * Executes the given call under this policy.
+	 * @param call
+	 * the call that starts the asynchronous operation and returns its future; the call may be invoked several times,
+	 * later or never.
+	 * @return
+	 * the future of the result, which fails with a {@link java.util.concurrent.RejectedExecutionException} if this
+	 * policy rejected the call. Cancelling the future cancels the current operation.
+	 */
+	public abstract <T> UFuture<T> execute( final Callable<? extends UFuture<T>> call );
+
+	/**
+	 * Returns the state of this policy.
+	 * @return
+	 * the state with at least the key <tt>type</tt>.
+	 */
+	public abstract UMap<String,Object> snapshot();
+
+	/**
+	 * Returns a function that executes the given function under this policy.
+	 * @param fn
+	 * the function that starts an asynchronous operation.
+	 * @return
+	 * the protected function.
+	 */
+	public <A,R> UFunction<A, UFuture<R>> wrap( final UFunction<? super A, ? extends UFuture<R>> fn ) {
+		if (fn==null) throw new NullPointerException("fn");
+		return new UFunction<A, UFuture<R>>() {
+			@Override
+			public UFuture<R> apply( final A value ) {
+				return execute(new Callable<UFuture<R>>() {
+					@Override
+					public UFuture<R> call() throws Exception {
+						return fn.apply(value);
+					}
+				});
+			}
+		};
+	}
+
+	/**
+	 * Returns a policy that executes the calls under this policy and, within that, under the given inner policy.
+	 * @param inner
+	 * the inner policy.
+	 * @return
+	 * the composed policy.
+	 */
+	public UPolicy and( final UPolicy inner ) {
+		if (inner==null) throw new NullPointerException("inner");
+		final UPolicy outer = this;
+		return new UPolicy() {
+			@Override
+			public <T> UFuture<T> execute( final Callable<? extends UFuture<T>> call ) {
+				return outer.execute(new Callable<UFuture<T>>() {
+					@Override
+					public UFuture<T> call() {
+						return inner.execute(call);
+					}
+				});
+			}
+
+			@Override
+			public UMap<String,Object> snapshot() {
+				final UList<Object> policies = new UList<Object>();
+				addTo(policies, outer);
+				addTo(policies, inner);
+				return UMap.of(String.class, Object.class, "type", "composite", "policies", policies);
+			}
+		};
+	}
+
+	/**
+	 * Adds the snapshot of the given policy to the list, the policies of a composite are added one by one.
+	 */
+	private static void addTo( final UList<Object> policies, final UPolicy policy ) {
+		final UMap<String,Object> snapshot = policy.snapshot();
+		if (!"composite".equals(snapshot.get("type"))) {
+			policies.add(snapshot);
+			return;
+		}
+		final UList<Object> nested = snapshot.getList("policies");
+		policies.addAll(nested);
+	}
+
+	/**
+	 * Invokes the given call, exceptions and null are converted into a failed future.
+	 * @param call
+	 * the call.
+	 * @return
+	 * the future returned by the call.
+	 */
+	protected static <T> UFuture<T> invoke( final Callable<? extends UFuture<T>> call ) {
+		try {
+			final UFuture<T> future = call.call();
+			return future!=null ? future : UFuture.<T>failed(new NullPointerException("The call returned null"));
+		} catch (Throwable t) {
+			return UFuture.failed(t);
+		}
+	}
+
+	/**
+	 * Cancels the given future, if the given promise is cancelled.
+	 * @param promise
+	 * the promise.
+	 * @param future
+	 * the future of the operation.
+	 */
+	protected static void cancelWith( final UPromise<?> promise, final UFuture<?> future ) {
+		promise.onCancel(new Runnable() {
+			@Override
+			public void run() {
+				future.cancel(false);
+			}
+		});
+	}
+}
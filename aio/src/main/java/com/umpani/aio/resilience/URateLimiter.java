@@ -0,0 +1,216 @@
+package com.umpani.aio.resilience;
+
+import java.util.concurrent.Callable;
+import java.util.concurrent.RejectedExecutionException;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicReference;
+
+import com.umpani.aio.UEventLoop;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.exception.URateLimitException;
+import com.umpani.util.UMap;
+
+/**
+ * A token bucket rate limiter. The bucket is refilled continuously with the given amount of permits per period, up
+ * to the burst size, every call takes one permit. If no permit is available, the call may wait for the next one up
+ * to the maximal wait time, the wait is scheduled at the timer wheel of the event loop, so no thread blocks. A waiting
+ * call reserves its permit, later calls wait behind it. Calls that would wait longer are rejected with an
+ * {@link URateLimitException}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class URateLimiter extends UPolicy {
+	/**
+	 * Create a new rate limiter whose burst size is the amount of permits per period and that does not wait.
+	 * @param loop
+	 * the event loop whose timer wheel delays waiting calls and whose clock refills the bucket.
+	 * @param permits
+	 * the amount of permits per period.
+	 * @param period
+	 * the period.
+	 * @param unit
+	 * the unit of the period.
+	 */
+	public URateLimiter( final UEventLoop loop, final int permits, final long period, final TimeUnit unit ) {
+		if (loop==null) throw new NullPointerException("loop");
+		if (permits < 1) throw new IllegalArgumentException("permits: "+permits);
+		if (period < 1) throw new IllegalArgumentException("period: "+period);
+		this.loop = loop;
+		this.nanosPerPermit = (double)unit.toNanos(period) / permits;
+		this.burst = permits;
+		this.tokens = permits;
+		this.refilledAt = loop.timers().clock().nanoTime();
+	}
+
+	/**
+	 * The event loop.
+	 */
+	private final UEventLoop loop;
+
+	/**
+	 * The time in nanoseconds it takes to refill one permit.
+	 */
+	private final double nanosPerPermit;
+
+	/**
+	 * The maximal amount of permits in the bucket.
+	 */
+	private int burst;
+
+	/**
+	 * The maximal time in nanoseconds a call waits for a permit.
+	 */
+	private long maxWait;
+
+	/**
+	 * The permits in the bucket, negative if calls reserved permits that are not yet refilled.
+	 */
+	private double tokens;
+
+	/**
+	 * The clock time of the last refill.
+	 */
+	private long refilledAt;
+
+	/**
+	 * The amount of calls executed without waiting.
+	 */
+	private long permitted;
+
+	/**
+	 * The amount of calls that waited for their permit.
+	 */
+	private long delayed;
+
+	/**
+	 * The amount of rejected calls.
+	 */
+	private long rejected;
+
+	/**
+	 * Sets the maximal amount of permits in the bucket, which is the amount of calls that may be executed at once
+	 * after an idle time.
+	 * @param burst
+	 * the burst size.
+	 * @return
+	 * this.
+	 */
+	public synchronized URateLimiter setBurst( final int burst ) {
+		if (burst < 1) throw new IllegalArgumentException("burst: "+burst);
+		this.burst = burst;
+		tokens = Math.min(tokens, burst);
+		return this;
+	}
+
+	/**
+	 * Sets the maximal time a call waits for a permit.
+	 * @param maxWait
+	 * the maximal wait time, zero to reject calls if no permit is available.
+	 * @param unit
+	 * the unit of the wait time.
+	 * @return
+	 * this.
+	 */
+	public synchronized URateLimiter setMaxWait( final long maxWait, final TimeUnit unit ) {
+		if (maxWait < 0) throw new IllegalArgumentException("maxWait: "+maxWait);
+		this.maxWait = unit.toNanos(maxWait);
+		return this;
+	}
+
+	/**
+	 * Returns the amount of permits available without waiting.
+	 * @return
+	 * the amount of permits in the bucket.
+	 */
+	public synchronized int getAvailablePermits() {
+		refill();
+		return tokens > 0 ? (int)tokens : 0;
+	}
+
+	@Override
+	public <T> UFuture<T> execute( final Callable<? extends UFuture<T>> call ) {
+		final long wait;
+		try {
+			wait = reserve();
+		} catch (URateLimitException e) {
+			return UFuture.failed(e);
+		}
+		if (wait==0) return invoke(call);
+		final UPromise<T> promise = new UPromise<T>();
+		// the timer or the started call, whichever is cancelled with the promise
+		final AtomicReference<UFuture<?>> current = new AtomicReference<>();
+		promise.onCancel(new Runnable() {
+			@Override
+			public void run() {
+				final UFuture<?> future = current.get();
+				if (future!=null) future.cancel(false);
+			}
+		});
+		final UFuture<Void> timer;
+		try {
+			timer = loop.schedule(new Runnable() {
+				@Override
+				public void run() {
+					if (promise.isDone()) return;
+					final UFuture<T> future = invoke(call);
+					current.set(future);
+					promise.completeWith(future);
+				}
+			}, wait, TimeUnit.NANOSECONDS);
+		} catch (RejectedExecutionException e) {
+			return UFuture.failed(e);
+		}
+		current.compareAndSet(null, timer);
+		return promise;
+	}
+
+	@Override
+	public synchronized UMap<String,Object> snapshot() {
+		final UMap<String,Object> snapshot = new UMap<String,Object>();
+		snapshot.put("type", "rateLimiter");
+		snapshot.put("availablePermits", getAvailablePermits());
+		snapshot.put("permitted", permitted);
+		snapshot.put("delayed", delayed);
+		snapshot.put("rejected", rejected);
+		return snapshot;
+	}
+
+	@Override
+	public synchronized String toString() {
+		return "URateLimiter[availablePermits="+getAvailablePermits()+", burst="+burst+"]";
+	}
+
+	/**
+	 * Takes a permit.
+	 * @return
+	 * the time in nanoseconds until the permit is available, zero if it is available now.
+	 * @throws URateLimitException
+	 * if the call would have to wait longer than the maximal wait time.
+	 */
+	private synchronized long reserve() throws URateLimitException {
+		refill();
+		if (tokens >= 1d) {
+			tokens -= 1d;
+			permitted++;
+			return 0L;
+		}
+		final long wait = (long)Math.ceil((1d - tokens) * nanosPerPermit);
+		if (wait > maxWait) {
+			rejected++;
+			throw new URateLimitException(wait);
+		}
+		tokens -= 1d;
+		delayed++;
+		return wait;
+	}
+
+	/**
+	 * Adds the permits refilled since the last refill.
+	 */
+	private void refill() {
+		final long now = loop.timers().clock().nanoTime();
+		tokens = Math.min(burst, tokens + (now - refilledAt) / nanosPerPermit);
+		refilledAt = now;
+	}
+}
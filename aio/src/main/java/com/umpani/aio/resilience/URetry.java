@@ -0,0 +1,274 @@
+package com.umpani.aio.resilience;
+
+import java.util.concurrent.Callable;
+import java.util.concurrent.CancellationException;
+import java.util.concurrent.RejectedExecutionException;
+import java.util.concurrent.ThreadLocalRandom;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicLong;
+
+import com.umpani.aio.UEventLoop;
+import com.umpani.aio.UFunction;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.UPromise;
+import com.umpani.util.UMap;
+
+/**
+ * Retries failed calls with exponential backoff. The delay before the retry <tt>n</tt> is
+ * <tt>initialDelay * multiplier^(n-1)</tt>, limited to the maximal delay, of which a random part of up to the jitter
+ * factor is subtracted, so that clients that failed together do not retry together. The first attempt is invoked by
+ * the calling thread, the retries by the event loop whose timer wheel schedules the delays.
+ *
+ * </p><p>By default all failures except cancellations are retried, a predicate given to
+ * {@link #setRetryOn(UFunction)} may restrict that, for example to {@link java.io.IOException}s.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class URetry extends UPolicy {
+	/**
+	 * Create a new retry policy with an initial delay of 100 milliseconds, a maximal delay of 10 seconds, the
+	 * multiplier two and the jitter factor 0.5.
+	 * @param loop
+	 * the event loop that schedules the delays.
+	 * @param maxAttempts
+	 * the maximal amount of attempts, including the first one.
+	 */
+	public URetry( final UEventLoop loop, final int maxAttempts ) {
+		if (loop==null) throw new NullPointerException("loop");
+		if (maxAttempts < 1) throw new IllegalArgumentException("maxAttempts: "+maxAttempts);
+		this.loop = loop;
+		this.maxAttempts = maxAttempts;
+	}
+
+	/**
+	 * The event loop that schedules the delays.
+	 */
+	private final UEventLoop loop;
+
+	/**
+	 * The maximal amount of attempts.
+	 */
+	private final int maxAttempts;
+
+	/**
+	 * The delay before the first retry in nanoseconds.
+	 */
+	private volatile long initialDelay = TimeUnit.MILLISECONDS.toNanos(100);
+
+	/**
+	 * The maximal delay in nanoseconds.
+	 */
+	private volatile long maxDelay = TimeUnit.SECONDS.toNanos(10);
+
+	/**
+	 * The factor by which the delay grows with every retry.
+	 */
+	private volatile double multiplier = 2d;
+
+	/**
+	 * The maximal part of the delay that is randomly subtracted.
+	 */
+	private volatile double jitter = 0.5d;
+
+	/**
+	 * The predicate that decides whether a failure is retried or null, to retry all failures.
+	 */
+	private volatile UFunction<? super Throwable, Boolean> retryOn;
+
+	/**
+	 * The amount of executed calls.
+	 */
+	private final AtomicLong calls = new AtomicLong();
+
+	/**
+	 * The amount of retries.
+	 */
+	private final AtomicLong retries = new AtomicLong();
+
+	/**
+	 * The amount of calls that failed after all attempts.
+	 */
+	private final AtomicLong failures = new AtomicLong();
+
+	/**
+	 * Sets the delays.
+	 * @param initialDelay
+	 * the delay before the first retry.
+	 * @param maxDelay
+	 * the maximal delay.
+	 * @param unit
+	 * the unit of the delays.
+	 * @return
+	 * this.
+	 */
+	public URetry setBackoff( final long initialDelay, final long maxDelay, final TimeUnit unit ) {
+		if (initialDelay < 0 || maxDelay < initialDelay) throw new IllegalArgumentException("initialDelay: "+initialDelay+", maxDelay: "+maxDelay);
+		this.initialDelay = unit.toNanos(initialDelay);
+		this.maxDelay = unit.toNanos(maxDelay);
+		return this;
+	}
+
+	/**
+	 * Sets the factor by which the delay grows with every retry.
+	 * @param multiplier
+	 * the factor, one for a constant delay.
+	 * @return
+	 * this.
+	 */
+	public URetry setMultiplier( final double multiplier ) {
+		if (!(multiplier >= 1d)) throw new IllegalArgumentException("multiplier: "+multiplier);
+		this.multiplier = multiplier;
+		return this;
+	}
+
+	/**
+	 * Sets the maximal part of the delay that is randomly subtracted.
+	 * @param jitter
+	 * the factor between zero for no jitter and one.
+	 * @return
+	 * this.
+	 */
+	public URetry setJitter( final double jitter ) {
+		if (!(jitter >= 0d && jitter <= 1d)) throw new IllegalArgumentException("jitter: "+jitter);
+		this.jitter = jitter;
+		return this;
+	}
+
+	/**
+	 * Sets the predicate that decides whether a failure is retried, cancellations are never retried.
+	 * @param retryOn
+	 * the predicate, which returns true to retry the failure, or null to retry all failures.
+	 * @return
+	 * this.
+	 */
+	public URetry setRetryOn( final UFunction<? super Throwable, Boolean> retryOn ) {
+		this.retryOn = retryOn;
+		return this;
+	}
+
+	/**
+	 * Returns the delay before the given retry, including the random jitter.
+	 * @param retry
+	 * the number of the retry, starting with one.
+	 * @return
+	 * the delay in nanoseconds.
+	 */
+	public long getDelayNanos( final int retry ) {
+		final double delay = Math.min(initialDelay * Math.pow(multiplier, retry - 1), maxDelay);
+		final double jitter = this.jitter;
+		return (long)(jitter > 0 ? delay * (1d - jitter * ThreadLocalRandom.current().nextDouble()) : delay);
+	}
+
+	/**
+	 * Returns true if the given failure should be retried.
+	 */
+	private boolean shouldRetry( final Throwable cause ) {
+		if (cause instanceof CancellationException) return false;
+		final UFunction<? super Throwable, Boolean> retryOn = this.retryOn;
+		if (retryOn==null) return true;
+		try {
+			return Boolean.TRUE.equals(retryOn.apply(cause));
+		} catch (Throwable t) {
+			return false;
+		}
+	}
+
+	@Override
+	public <T> UFuture<T> execute( final Callable<? extends UFuture<T>> call ) {
+		calls.incrementAndGet();
+		final Execution<T> execution = new Execution<T>(call);
+		execution.promise.onCancel(new Runnable() {
+			@Override
+			public void run() {
+				final UFuture<?> current = execution.current;
+				if (current!=null) current.cancel(false);
+			}
+		});
+		execution.attempt();
+		return execution.promise;
+	}
+
+	@Override
+	public UMap<String,Object> snapshot() {
+		final UMap<String,Object> snapshot = new UMap<String,Object>();
+		snapshot.put("type", "retry");
+		snapshot.put("maxAttempts", maxAttempts);
+		snapshot.put("calls", calls.get());
+		snapshot.put("retries", retries.get());
+		snapshot.put("failures", failures.get());
+		return snapshot;
+	}
+
+	@Override
+	public String toString() {
+		return "URetry[maxAttempts="+maxAttempts+", calls="+calls.get()+", retries="+retries.get()+"]";
+	}
+
+	/**
+	 * The execution of a call with all its attempts.
+	 */
+	private final class Execution<T> implements UFutureListener<T> {
+		Execution( final Callable<? extends UFuture<T>> call ) {
+			this.call = call;
+		}
+
+		/**
+		 * The call.
+		 */
+		final Callable<? extends UFuture<T>> call;
+
+		/**
+		 * The promise of the result.
+		 */
+		final UPromise<T> promise = new UPromise<T>();
+
+		/**
+		 * The amount of attempts so far.
+		 */
+		private volatile int attempts;
+
+		/**
+		 * The future of the current attempt or the timer of the next one.
+		 */
+		volatile UFuture<?> current;
+
+		/**
+		 * Invokes the call.
+		 */
+		void attempt() {
+			attempts++;
+			final UFuture<T> future = invoke(call);
+			current = future;
+			future.addListener(this, null);
+		}
+
+		@Override
+		public void complete( final UFuture<T> future ) {
+			if (promise.isDone()) return;
+			if (future.isSuccess()) {
+				promise.complete(future.getNow());
+				return;
+			}
+			final Throwable cause = future.cause();
+			if (attempts >= maxAttempts || !shouldRetry(cause)) {
+				if (!(cause instanceof CancellationException)) failures.incrementAndGet();
+				promise.fail(cause);
+				return;
+			}
+			try {
+				current = loop.schedule(new Runnable() {
+					@Override
+					public void run() {
+						if (!promise.isDone()) attempt();
+					}
+				}, getDelayNanos(attempts), TimeUnit.NANOSECONDS);
+				retries.incrementAndGet();
+			} catch (RejectedExecutionException e) {
+				// the loop shuts down, we can't wait any longer
+				failures.incrementAndGet();
+				promise.fail(cause);
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package com.umpani.aio.resp;
+
+/**
+ * Constants of the Redis serialization protocol (RESP).
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UResp {
+	/**
+	 * RESP version 2, the default.
+	 */
+	public static final int RESP2 = 2;
+
+	/**
+	 * RESP version 3, which a client selects with <tt>HELLO 3</tt>.
+	 */
+	public static final int RESP3 = 3;
+
+	/**
+	 * The null reply, which is decoded from and encoded as null bulk string or array (RESP2) or null (RESP3). Within
+	 * arrays and maps nulls are represented by null itself, but null can't be passed through a pipeline.
+	 */
+	public static final Object NULL = new Object() {
+		@Override
+		public String toString() {
+			return "(nil)";
+		}
+	};
+
+	/**
+	 * This is a constant class.
+	 */
+	private UResp() {}
+}
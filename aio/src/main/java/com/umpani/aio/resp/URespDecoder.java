@@ -0,0 +1,291 @@
+package com.umpani.aio.resp;
+
+import java.math.BigInteger;
+import java.nio.charset.StandardCharsets;
+import java.util.List;
+
+import com.umpani.aio.UCompositeBuffer;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.codec.UByteToMessageDecoder;
+import com.umpani.aio.exception.UCodecException;
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+
+/**
+ * Decodes RESP2 and RESP3 values, as sent by Redis clients and servers. The values are mapped as follows:
+ *
+ * <ul>
+ * <li>simple, bulk and verbatim strings: {@link String}, bulk strings optionally as <tt>byte[]</tt></li>
+ * <li>errors and blob errors: {@link URespError}</li>
+ * <li>integers: {@link Long}, big numbers: {@link BigInteger}, doubles: {@link Double}, booleans: {@link Boolean}</li>
+ * <li>arrays, sets and pushes: {@link UList}</li>
+ * <li>maps: {@link UMap} with string keys</li>
+ * <li>null, null bulk strings and null arrays: {@link UResp#NULL} at the top level, null within arrays and maps</li>
+ * </ul>
+ *
+ * Attributes are skipped. A line that does not start with a type byte is an inline command, like typed into telnet,
+ * which is split at whitespace into a list of strings. Malformed input fails with an {@link UCodecException} and
+ * all received bytes are discarded, the connection should be closed.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class URespDecoder extends UByteToMessageDecoder {
+	/**
+	 * The default maximal length of a bulk string.
+	 */
+	public static final int DEFAULT_MAX_BULK_LENGTH = 16 << 20;
+
+	/**
+	 * The maximal length of a line, like an inline command or the header of a value.
+	 */
+	private static final int MAX_LINE_LENGTH = 65536;
+
+	/**
+	 * The maximal nesting depth of arrays and maps.
+	 */
+	private static final int MAX_DEPTH = 64;
+
+	/**
+	 * Returned by the parse methods, if more bytes are needed.
+	 */
+	private static final Object INCOMPLETE = new Object();
+
+	/**
+	 * Returned by the parse methods for an empty inline command, which is skipped.
+	 */
+	private static final Object SKIP = new Object();
+
+	/**
+	 * Create a new decoder with the default maximal bulk length that decodes bulk strings as strings.
+	 */
+	public URespDecoder() {
+		this(DEFAULT_MAX_BULK_LENGTH, false);
+	}
+
+	/**
+	 * Create a new decoder.
+	 * @param maxBulkLength
+	 * the maximal length of a bulk string in bytes, the maximal amount of elements of an array or map as well.
+	 * @param binary
+	 * true to decode bulk strings as <tt>byte[]</tt>; false to decode them as UTF-8 strings.
+	 */
+	public URespDecoder( final int maxBulkLength, final boolean binary ) {
+		if (maxBulkLength <= 0) throw new IllegalArgumentException("maxBulkLength: "+maxBulkLength);
+		this.maxBulkLength = maxBulkLength;
+		this.binary = binary;
+	}
+
+	/**
+	 * The maximal length of a bulk string.
+	 */
+	private final int maxBulkLength;
+
+	/**
+	 * True to decode bulk strings as byte arrays.
+	 */
+	private final boolean binary;
+
+	/**
+	 * The index of the next byte to parse, relative to the read position.
+	 */
+	private int index;
+
+	@Override
+	protected void decode( final UHandlerContext ctx, final UCompositeBuffer in, final List<Object> out ) throws Exception {
+		index = 0;
+		final Object value;
+		try {
+			value = parse(in, 0);
+		} catch (UCodecException e) {
+			in.skipBytes(in.readableBytes());
+			throw e;
+		}
+		if (value==INCOMPLETE) return;
+		in.skipBytes(index);
+		if (value==SKIP) return;
+		out.add(value!=null ? value : UResp.NULL);
+	}
+
+	/**
+	 * Parses the value at the current index.
+	 */
+	private Object parse( final UCompositeBuffer in, final int depth ) throws UCodecException {
+		if (depth > MAX_DEPTH) throw new UCodecException("RESP values nested deeper than "+MAX_DEPTH);
+		if (index >= in.readableBytes()) return INCOMPLETE;
+		final byte type = in.getByte(index);
+		if (depth==0 && !isType(type)) return parseInline(in);
+		final String line = readLine(in);
+		if (line==null) return INCOMPLETE;
+		switch (type) {
+			case '+':
+				return line;
+			case '-':
+				return new URespError(line);
+			case ':':
+				return parseLong(line);
+			case ',':
+				return parseDouble(line);
+			case '(':
+				try {
+					return new BigInteger(line);
+				} catch (NumberFormatException e) {
+					throw new UCodecException("Invalid big number: "+line);
+				}
+			case '#':
+				if (line.equals("t")) return Boolean.TRUE;
+				if (line.equals("f")) return Boolean.FALSE;
+				throw new UCodecException("Invalid boolean: "+line);
+			case '_':
+				if (!line.isEmpty()) throw new UCodecException("Invalid null: "+line);
+				return null;
+			case '$':
+			case '!':
+			case '=': {
+				final int length = parseLength(line);
+				if (length < 0) return null;
+				final byte[] bytes = readBulk(in, length);
+				if (bytes==null) return INCOMPLETE;
+				if (type=='!') return new URespError(new String(bytes, StandardCharsets.UTF_8));
+				// a verbatim string starts with its format, like "txt:"
+				if (type=='=') return bytes.length >= 4 ? new String(bytes, 4, bytes.length - 4, StandardCharsets.UTF_8) : "";
+				return binary ? bytes : new String(bytes, StandardCharsets.UTF_8);
+			}
+			case '*':
+			case '~':
+			case '>': {
+				final int length = parseLength(line);
+				if (length < 0) return null;
+				final UList<Object> list = new UList<Object>();
+				for (int i=0; i < length; i++) {
+					final Object element = parse(in, depth + 1);
+					if (element==INCOMPLETE) return INCOMPLETE;
+					list.add(element);
+				}
+				return list;
+			}
+			case '%':
+			case '|': {
+				final int length = parseLength(line);
+				if (length < 0) return null;
+				final UMap<String,Object> map = new UMap<String,Object>();
+				for (int i=0; i < length; i++) {
+					final Object key = parse(in, depth + 1);
+					if (key==INCOMPLETE) return INCOMPLETE;
+					final Object value = parse(in, depth + 1);
+					if (value==INCOMPLETE) return INCOMPLETE;
+					map.put(key instanceof byte[] ? new String((byte[])key, StandardCharsets.UTF_8) : String.valueOf(key), value);
+				}
+				// attributes describe the following value
+				return type=='|' ? parse(in, depth) : map;
+			}
+			default:
+				throw new UCodecException("Invalid RESP type: "+(char)type);
+		}
+	}
+
+	/**
+	 * Returns true if the given byte starts a RESP value.
+	 */
+	private static boolean isType( final byte type ) {
+		switch (type) {
+			case '+': case '-': case ':': case ',': case '(': case '#': case '_':
+			case '$': case '!': case '=': case '*': case '~': case '>': case '%': case '|':
+				return true;
+			default:
+				return false;
+		}
+	}
+
+	/**
+	 * Parses an inline command, a line of words separated by whitespace.
+	 */
+	private Object parseInline( final UCompositeBuffer in ) throws UCodecException {
+		final int end = in.indexOf((byte)'\n', index);
+		if (end < 0) {
+			if (in.readableBytes() - index > MAX_LINE_LENGTH) throw new UCodecException("Inline command exceeds "+MAX_LINE_LENGTH+" bytes");
+			return INCOMPLETE;
+		}
+		final byte[] bytes = new byte[end - index];
+		in.getBytes(index, bytes, 0, bytes.length);
+		index = end + 1;
+		final UList<Object> command = new UList<Object>();
+		for (final String word : new String(bytes, StandardCharsets.UTF_8).trim().split("\\s+")) {
+			if (!word.isEmpty()) command.add(word);
+		}
+		return command.isEmpty() ? SKIP : command;
+	}
+
+	/**
+	 * Reads the rest of the line after the type byte, the index is moved behind the line.
+	 * @return
+	 * the line without type byte and line break or null, if the line is incomplete.
+	 */
+	private String readLine( final UCompositeBuffer in ) throws UCodecException {
+		final int end = in.indexOf((byte)'\n', index);
+		if (end < 0) {
+			if (in.readableBytes() - index > MAX_LINE_LENGTH) throw new UCodecException("Line exceeds "+MAX_LINE_LENGTH+" bytes");
+			return null;
+		}
+		if (end==index || in.getByte(end - 1)!='\r') throw new UCodecException("Line not terminated by CRLF");
+		final byte[] bytes = new byte[end - index - 2];
+		in.getBytes(index + 1, bytes, 0, bytes.length);
+		index = end + 1;
+		return new String(bytes, StandardCharsets.UTF_8);
+	}
+
+	/**
+	 * Reads the bytes of a bulk string and the following line break.
+	 * @return
+	 * the bytes or null, if they are not yet received.
+	 */
+	private byte[] readBulk( final UCompositeBuffer in, final int length ) throws UCodecException {
+		if (in.readableBytes() - index < (long)length + 2) return null;
+		final byte[] bytes = new byte[length];
+		in.getBytes(index, bytes, 0, length);
+		if (in.getByte(index + length)!='\r' || in.getByte(index + length + 1)!='\n') throw new UCodecException("Bulk string not terminated by CRLF");
+		index += length + 2;
+		return bytes;
+	}
+
+	/**
+	 * Parses the length of a bulk string, an array or a map.
+	 * @return
+	 * the length or -1 for null.
+	 */
+	private int parseLength( final String line ) throws UCodecException {
+		final long length = parseLong(line);
+		if (length < -1 || length > maxBulkLength) throw new UCodecException("Invalid length: "+line);
+		return (int)length;
+	}
+
+	/**
+	 * Parses an integer.
+	 */
+	private static long parseLong( final String line ) throws UCodecException {
+		try {
+			return Long.parseLong(line);
+		} catch (NumberFormatException e) {
+			throw new UCodecException("Invalid integer: "+line);
+		}
+	}
+
+	/**
+	 * Parses a double, including <tt>inf</tt>, <tt>-inf</tt> and <tt>nan</tt>.
+	 */
+	private static double parseDouble( final String line ) throws UCodecException {
+		switch (line) {
+			case "inf":
+				return Double.POSITIVE_INFINITY;
+			case "-inf":
+				return Double.NEGATIVE_INFINITY;
+			case "nan":
+				return Double.NaN;
+			default:
+				try {
+					return Double.parseDouble(line);
+				} catch (NumberFormatException e) {
+					throw new UCodecException("Invalid double: "+line);
+				}
+		}
+	}
+}
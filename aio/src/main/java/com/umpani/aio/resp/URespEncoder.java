@@ -0,0 +1,163 @@
+package com.umpani.aio.resp;
+
+import java.math.BigDecimal;
+import java.math.BigInteger;
+import java.nio.charset.StandardCharsets;
+import java.util.Collection;
+import java.util.Map;
+import java.util.Set;
+
+import com.umpani.aio.UBufferOutputStream;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.codec.UMessageToByteEncoder;
+import com.umpani.aio.exception.UCodecException;
+
+/**
+ * Encodes values as RESP2 or RESP3, the counterpart of the {@link URespDecoder}. Strings and byte arrays are encoded
+ * as bulk strings, {@link URespStatus} as simple string, {@link URespError} as error, integral numbers as integers,
+ * collections as arrays and maps as maps, {@link UResp#NULL} and nested nulls as null. RESP2 has no maps, booleans,
+ * doubles and big numbers: maps are written as arrays of alternating keys and values, booleans as the integers 1 and
+ * 0 and the other numbers as bulk strings. All other messages are passed on unchanged.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class URespEncoder extends UMessageToByteEncoder<Object> {
+	/**
+	 * The line break.
+	 */
+	private static final byte[] CRLF = { '\r', '\n' };
+
+	/**
+	 * Create a new encoder that writes RESP2.
+	 */
+	public URespEncoder() {
+		this(UResp.RESP2);
+	}
+
+	/**
+	 * Create a new encoder.
+	 * @param protocol
+	 * the protocol version, {@link UResp#RESP2} or {@link UResp#RESP3}.
+	 */
+	public URespEncoder( final int protocol ) {
+		super(Object.class);
+		setProtocol(protocol);
+	}
+
+	/**
+	 * The protocol version, only accessed from the event loop.
+	 */
+	private int protocol;
+
+	/**
+	 * Sets the protocol version of the following messages, for example after the client sent <tt>HELLO 3</tt>.
+	 * @param protocol
+	 * the protocol version, {@link UResp#RESP2} or {@link UResp#RESP3}.
+	 * @return
+	 * this.
+	 */
+	public URespEncoder setProtocol( final int protocol ) {
+		if (protocol!=UResp.RESP2 && protocol!=UResp.RESP3) throw new IllegalArgumentException("protocol: "+protocol);
+		this.protocol = protocol;
+		return this;
+	}
+
+	/**
+	 * Returns the protocol version.
+	 * @return
+	 * the protocol version.
+	 */
+	public int getProtocol() {
+		return protocol;
+	}
+
+	@Override
+	protected boolean accept( final Object msg ) {
+		return msg==UResp.NULL || msg instanceof CharSequence || msg instanceof byte[] || msg instanceof Number
+		|| msg instanceof Boolean || msg instanceof Map || msg instanceof Collection || msg instanceof URespStatus
+		|| msg instanceof URespError;
+	}
+
+	@Override
+	protected void encode( final UHandlerContext ctx, final Object msg, final UBufferOutputStream out ) throws Exception {
+		write(out, msg);
+	}
+
+	/**
+	 * Writes the given value.
+	 */
+	private void write( final UBufferOutputStream out, final Object value ) throws UCodecException {
+		final boolean resp3 = protocol==UResp.RESP3;
+		if (value==null || value==UResp.NULL) {
+			out.append(resp3 ? "_" : "$-1").write(CRLF, 0, 2);
+		} else
+		if (value instanceof CharSequence) {
+			writeBulk(out, value.toString().getBytes(StandardCharsets.UTF_8));
+		} else
+		if (value instanceof byte[]) {
+			writeBulk(out, (byte[])value);
+		} else
+		if (value instanceof URespStatus) {
+			writeLine(out, '+', value.toString());
+		} else
+		if (value instanceof URespError) {
+			writeLine(out, '-', ((URespError)value).message().replace('\r', ' ').replace('\n', ' '));
+		} else
+		if (value instanceof Long || value instanceof Integer || value instanceof Short || value instanceof Byte) {
+			writeLine(out, ':', value.toString());
+		} else
+		if (value instanceof Boolean) {
+			final boolean b = (Boolean)value;
+			writeLine(out, resp3 ? '#' : ':', resp3 ? (b ? "t" : "f") : (b ? "1" : "0"));
+		} else
+		if (value instanceof BigInteger && resp3) {
+			writeLine(out, '(', value.toString());
+		} else
+		if ((value instanceof Double || value instanceof Float || value instanceof BigDecimal) && resp3) {
+			writeLine(out, ',', formatDouble(((Number)value).doubleValue()));
+		} else
+		if (value instanceof Number) {
+			writeBulk(out, value.toString().getBytes(StandardCharsets.UTF_8));
+		} else
+		if (value instanceof Map) {
+			final Map<?,?> map = (Map<?,?>)value;
+			writeLine(out, resp3 ? '%' : '*', Integer.toString(resp3 ? map.size() : map.size() << 1));
+			for (final Map.Entry<?,?> entry : map.entrySet()) {
+				write(out, entry.getKey());
+				write(out, entry.getValue());
+			}
+		} else
+		if (value instanceof Collection) {
+			final Collection<?> collection = (Collection<?>)value;
+			writeLine(out, resp3 && value instanceof Set ? '~' : '*', Integer.toString(collection.size()));
+			for (final Object element : collection) write(out, element);
+		} else {
+			throw new UCodecException("Unsupported RESP value: "+value.getClass().getName());
+		}
+	}
+
+	/**
+	 * Writes a line of the given type.
+	 */
+	private static void writeLine( final UBufferOutputStream out, final char type, final String line ) {
+		out.append(type).append(line).write(CRLF, 0, 2);
+	}
+
+	/**
+	 * Writes a bulk string.
+	 */
+	private static void writeBulk( final UBufferOutputStream out, final byte[] bytes ) {
+		writeLine(out, '$', Integer.toString(bytes.length));
+		out.write(bytes, 0, bytes.length);
+		out.write(CRLF, 0, 2);
+	}
+
+	/**
+	 * Formats a RESP3 double.
+	 */
+	private static String formatDouble( final double d ) {
+		if (Double.isNaN(d)) return "nan";
+		if (Double.isInfinite(d)) return d > 0 ? "inf" : "-inf";
+		return Double.toString(d);
+	}
+}
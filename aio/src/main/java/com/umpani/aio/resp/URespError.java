@@ -0,0 +1,58 @@
+package com.umpani.aio.resp;
+
+/**
+ * A RESP error reply, like <tt>-ERR unknown command</tt>. By convention the message starts with an upper case error
+ * code, like <tt>ERR</tt> or <tt>WRONGTYPE</tt>, followed by a space and a description.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class URespError {
+	/**
+	 * Create a new error.
+	 * @param message
+	 * the message, line breaks are replaced by spaces when encoded.
+	 */
+	public URespError( final String message ) {
+		if (message==null) throw new NullPointerException("message");
+		this.message = message;
+	}
+
+	/**
+	 * The message.
+	 */
+	private final String message;
+
+	/**
+	 * Returns the message.
+	 * @return
+	 * the message, including the error code.
+	 */
+	public String message() {
+		return message;
+	}
+
+	/**
+	 * Returns the error code, the first word of the message.
+	 * @return
+	 * the error code.
+	 */
+	public String code() {
+		final int space = message.indexOf(' ');
+		return space < 0 ? message : message.substring(0, space);
+	}
+
+	@Override
+	public boolean equals( final Object other ) {
+		return other instanceof URespError && ((URespError)other).message.equals(message);
+	}
+
+	@Override
+	public int hashCode() {
+		return message.hashCode();
+	}
+
+	@Override
+	public String toString() {
+		return "-"+message;
+	}
+}
@@ -0,0 +1,363 @@
+package com.umpani.aio.resp;
+
+import java.nio.charset.StandardCharsets;
+import java.util.ArrayList;
+import java.util.HashMap;
+import java.util.List;
+import java.util.Locale;
+import java.util.concurrent.RejectedExecutionException;
+import java.util.concurrent.TimeUnit;
+
+import com.umpani.aio.UEventLoop;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UPromise;
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+
+/**
+ * An in-memory keyspace that executes a subset of the Redis commands, served by the {@link URespServerHandler}. The
+ * keys are kept in an {@link UMap}, string values as strings and hashes as nested maps. The keyspace is owned by one
+ * event loop, which executes all commands one after another, so that they are atomic. Keys with a time to live are
+ * removed by a timer of the loop, so that expiration can be tested with an {@link com.umpani.aio.UVirtualEventLoop}.
+ *
+ * </p><p>Supported are <tt>PING</tt>, <tt>ECHO</tt>, <tt>GET</tt>, <tt>SET</tt> with the options <tt>EX</tt>,
+ * <tt>PX</tt>, <tt>NX</tt> and <tt>XX</tt>, <tt>DEL</tt>, <tt>EXISTS</tt>, <tt>EXPIRE</tt>, <tt>TTL</tt>,
+ * <tt>PTTL</tt>, <tt>HGET</tt>, <tt>HSET</tt>, <tt>HDEL</tt>, <tt>HGETALL</tt>, <tt>DBSIZE</tt>, <tt>FLUSHALL</tt>
+ * and <tt>COMMAND</tt>, which returns an empty list, so that command line clients can connect. Subclasses may add
+ * further commands by overriding {@link #call(String, List)}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class URespKeyspace {
+	/**
+	 * The error of a command applied to a key of the wrong type.
+	 */
+	public static final URespError WRONGTYPE = new URespError("WRONGTYPE Operation against a key holding the wrong kind of value");
+
+	/**
+	 * The error of an invalid option.
+	 */
+	public static final URespError SYNTAX_ERROR = new URespError("ERR syntax error");
+
+	/**
+	 * The error of an invalid integer.
+	 */
+	public static final URespError NOT_AN_INTEGER = new URespError("ERR value is not an integer or out of range");
+
+	/**
+	 * Create a new keyspace.
+	 * @param loop
+	 * the event loop that owns the keyspace.
+	 */
+	public URespKeyspace( final UEventLoop loop ) {
+		if (loop==null) throw new NullPointerException("loop");
+		this.loop = loop;
+	}
+
+	/**
+	 * The loop that owns the keyspace.
+	 */
+	protected final UEventLoop loop;
+
+	/**
+	 * The keys and values, only accessed from the loop.
+	 */
+	private final UMap<String,Object> data = new UMap<String,Object>();
+
+	/**
+	 * The expiration of the keys with a time to live, only accessed from the loop.
+	 */
+	private final HashMap<String, Expiration> expirations = new HashMap<>();
+
+	/**
+	 * Returns the loop that owns the keyspace.
+	 * @return
+	 * the loop.
+	 */
+	public final UEventLoop loop() {
+		return loop;
+	}
+
+	/**
+	 * Executes a command, may be called by any thread.
+	 * @param command
+	 * the name of the command followed by its arguments, as decoded by the {@link URespDecoder}.
+	 * @return
+	 * the future of the reply, which is a value for the {@link URespEncoder}; null for the null reply.
+	 */
+	public UFuture<Object> execute( final List<?> command ) {
+		if (loop.inEventLoop()) return UFuture.succeeded(executeNow(command));
+		final UPromise<Object> promise = new UPromise<Object>(null);
+		try {
+			loop.execute(new Runnable() {
+				@Override
+				public void run() {
+					promise.complete(executeNow(command));
+				}
+			});
+		} catch (RejectedExecutionException e) {
+			promise.fail(e);
+		}
+		return promise;
+	}
+
+	/**
+	 * Executes a command in the loop.
+	 */
+	private Object executeNow( final List<?> command ) {
+		if (command.isEmpty()) return new URespError("ERR empty command");
+		final ArrayList<String> args = new ArrayList<>(command.size() - 1);
+		for (int i=1; i < command.size(); i++) args.add(toString(command.get(i)));
+		final String name = toString(command.get(0)).toUpperCase(Locale.ROOT);
+		try {
+			return call(name, args);
+		} catch (Throwable t) {
+			return new URespError("ERR "+t.getMessage());
+		}
+	}
+
+	/**
+	 * Converts an argument into a string.
+	 */
+	private static String toString( final Object arg ) {
+		return arg instanceof byte[] ? new String((byte[])arg, StandardCharsets.UTF_8) : String.valueOf(arg);
+	}
+
+	/**
+	 * Executes a command in the event loop.
+	 * @param name
+	 * the name of the command in upper case.
+	 * @param args
+	 * the arguments.
+	 * @return
+	 * the reply; null for the null reply.
+	 * @throws Exception
+	 * if the command failed, which is answered with an error.
+	 */
+	protected Object call( final String name, final List<String> args ) throws Exception {
+		switch (name) {
+			case "PING":
+				if (args.size() > 1) return arity(name);
+				return args.isEmpty() ? URespStatus.PONG : args.get(0);
+			case "ECHO":
+				return args.size()!=1 ? arity(name) : args.get(0);
+			case "GET": {
+				if (args.size()!=1) return arity(name);
+				final Object value = lookup(args.get(0));
+				return value==null || value instanceof String ? value : WRONGTYPE;
+			}
+			case "SET":
+				return set(args);
+			case "DEL":
+			case "EXISTS": {
+				if (args.isEmpty()) return arity(name);
+				long count = 0;
+				for (final String key : args) {
+					if (lookup(key)==null) continue;
+					count++;
+					if (name.equals("DEL")) remove(key);
+				}
+				return count;
+			}
+			case "EXPIRE": {
+				if (args.size()!=2) return arity(name);
+				final Long seconds = parseLong(args.get(1));
+				if (seconds==null) return NOT_AN_INTEGER;
+				final String key = args.get(0);
+				if (lookup(key)==null) return 0L;
+				if (seconds <= 0) {
+					remove(key);
+				} else {
+					expire(key, TimeUnit.SECONDS.toMillis(seconds));
+				}
+				return 1L;
+			}
+			case "TTL":
+			case "PTTL": {
+				if (args.size()!=1) return arity(name);
+				if (lookup(args.get(0))==null) return -2L;
+				final Expiration expiration = expirations.get(args.get(0));
+				if (expiration==null) return -1L;
+				final long millis = TimeUnit.NANOSECONDS.toMillis(expiration.deadline - now());
+				return name.equals("TTL") ? (millis + 500) / 1000 : millis;
+			}
+			case "HGET": {
+				if (args.size()!=2) return arity(name);
+				final Object hash = lookup(args.get(0));
+				if (hash==null) return null;
+				return hash instanceof UMap ? ((UMap<?,?>)hash).get(args.get(1)) : WRONGTYPE;
+			}
+			case "HSET": {
+				if (args.size() < 3 || (args.size() & 1)==0) return arity(name);
+				final String key = args.get(0);
+				Object hash = lookup(key);
+				if (hash!=null && !(hash instanceof UMap)) return WRONGTYPE;
+				if (hash==null) {
+					hash = new UMap<String,Object>();
+					data.put(key, hash);
+				}
+				@SuppressWarnings("unchecked")
+				final UMap<String,Object> fields = (UMap<String,Object>)hash;
+				long added = 0;
+				for (int i=1; i < args.size(); i += 2) {
+					if (fields.put(args.get(i), args.get(i + 1))==null) added++;
+				}
+				return added;
+			}
+			case "HDEL": {
+				if (args.size() < 2) return arity(name);
+				final Object hash = lookup(args.get(0));
+				if (hash==null) return 0L;
+				if (!(hash instanceof UMap)) return WRONGTYPE;
+				final UMap<?,?> fields = (UMap<?,?>)hash;
+				long removed = 0;
+				for (int i=1; i < args.size(); i++) {
+					if (fields.remove(args.get(i))!=null) removed++;
+				}
+				if (fields.isEmpty()) remove(args.get(0));
+				return removed;
+			}
+			case "HGETALL": {
+				if (args.size()!=1) return arity(name);
+				final Object hash = lookup(args.get(0));
+				if (hash==null) return new UMap<String,Object>();
+				return hash instanceof UMap ? new UMap<String,Object>().copy((UMap<?,?>)hash) : WRONGTYPE;
+			}
+			case "DBSIZE":
+				if (!args.isEmpty()) return arity(name);
+				purge();
+				return (long)data.size();
+			case "FLUSHALL":
+				for (final Expiration expiration : expirations.values()) expiration.timer.cancel(false);
+				expirations.clear();
+				data.clear();
+				return URespStatus.OK;
+			case "COMMAND":
+				return new UList<Object>();
+			default:
+				return new URespError("ERR unknown command '"+name.toLowerCase(Locale.ROOT)+"'");
+		}
+	}
+
+	/**
+	 * Executes <tt>SET key value [EX seconds|PX milliseconds] [NX|XX]</tt>.
+	 */
+	private Object set( final List<String> args ) {
+		if (args.size() < 2) return arity("SET");
+		final String key = args.get(0);
+		long ttl = -1;
+		boolean nx = false;
+		boolean xx = false;
+		for (int i=2; i < args.size(); i++) {
+			final String option = args.get(i).toUpperCase(Locale.ROOT);
+			if ((option.equals("EX") || option.equals("PX")) && i + 1 < args.size() && ttl < 0) {
+				final Long amount = parseLong(args.get(++i));
+				if (amount==null) return NOT_AN_INTEGER;
+				if (amount <= 0) return new URespError("ERR invalid expire time in 'set' command");
+				ttl = option.equals("EX") ? TimeUnit.SECONDS.toMillis(amount) : amount;
+			} else
+			if (option.equals("NX") && !xx) {
+				nx = true;
+			} else
+			if (option.equals("XX") && !nx) {
+				xx = true;
+			} else {
+				return SYNTAX_ERROR;
+			}
+		}
+		final boolean exists = lookup(key)!=null;
+		if ((nx && exists) || (xx && !exists)) return null;
+		remove(key);
+		data.put(key, args.get(1));
+		if (ttl > 0) expire(key, ttl);
+		return URespStatus.OK;
+	}
+
+	/**
+	 * Returns the value of the given key or null, if it does not exist or expired.
+	 */
+	private Object lookup( final String key ) {
+		final Expiration expiration = expirations.get(key);
+		// the timer may not yet have run in this iteration of the loop
+		if (expiration!=null && expiration.deadline - now() <= 0) remove(key);
+		return data.get(key);
+	}
+
+	/**
+	 * Removes the given key and its expiration.
+	 */
+	private void remove( final String key ) {
+		data.remove(key);
+		final Expiration expiration = expirations.remove(key);
+		if (expiration!=null) expiration.timer.cancel(false);
+	}
+
+	/**
+	 * Removes all expired keys.
+	 */
+	private void purge() {
+		for (final String key : new ArrayList<>(expirations.keySet())) lookup(key);
+	}
+
+	/**
+	 * Sets the time to live of the given existing key.
+	 */
+	private void expire( final String key, final long millis ) {
+		final Expiration old = expirations.remove(key);
+		if (old!=null) old.timer.cancel(false);
+		final Expiration expiration = new Expiration(now() + TimeUnit.MILLISECONDS.toNanos(millis));
+		expiration.timer = loop.schedule(new Runnable() {
+			@Override
+			public void run() {
+				if (expirations.get(key)==expiration) remove(key);
+			}
+		}, millis, TimeUnit.MILLISECONDS);
+		expirations.put(key, expiration);
+	}
+
+	/**
+	 * Returns the current time of the clock of the loop.
+	 */
+	private long now() {
+		return loop.timers().clock().nanoTime();
+	}
+
+	/**
+	 * Parses an integer argument.
+	 * @return
+	 * the integer or null, if invalid.
+	 */
+	private static Long parseLong( final String arg ) {
+		try {
+			return Long.parseLong(arg);
+		} catch (NumberFormatException e) {
+			return null;
+		}
+	}
+
+	/**
+	 * Returns the error of a wrong amount of arguments.
+	 */
+	private static URespError arity( final String name ) {
+		return new URespError("ERR wrong number of arguments for '"+name.toLowerCase(Locale.ROOT)+"' command");
+	}
+
+	/**
+	 * The time to live of a key.
+	 */
+	private static final class Expiration {
+		Expiration( final long deadline ) {
+			this.deadline = deadline;
+		}
+
+		/**
+		 * The deadline in nanoseconds of the clock of the loop.
+		 */
+		final long deadline;
+
+		/**
+		 * The timer that removes the key.
+		 */
+		UFuture<Void> timer;
+	}
+}
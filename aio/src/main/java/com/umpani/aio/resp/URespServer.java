@@ -0,0 +1,145 @@
+package com.umpani.aio.resp;
+
+import java.io.IOException;
+import java.net.InetSocketAddress;
+import java.net.SocketAddress;
+import java.util.List;
+import java.util.concurrent.TimeUnit;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UDrainResult;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UServer;
+
+/**
+ * A small embedded server that speaks the Redis protocol, so that Redis clients and tools like <tt>redis-cli</tt>
+ * can be used against an in-memory {@link URespKeyspace}, for example in tests. The pipeline of every accepted
+ * connection is set up with an {@link URespDecoder}, an {@link URespEncoder} and an {@link URespServerHandler}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class URespServer {
+	/**
+	 * Create a new server with a new keyspace owned by the first event loop of the group.
+	 * @param group
+	 * the event loops.
+	 * @param alloc
+	 * the buffer pool of the connections.
+	 */
+	public URespServer( final UEventLoopGroup group, final UBufferPool alloc ) {
+		this(group, new URespKeyspace(group.get(0)), alloc);
+	}
+
+	/**
+	 * Create a new server.
+	 * @param group
+	 * the event loops.
+	 * @param keyspace
+	 * the keyspace to serve.
+	 * @param alloc
+	 * the buffer pool of the connections.
+	 */
+	public URespServer( final UEventLoopGroup group, final URespKeyspace keyspace, final UBufferPool alloc ) {
+		if (keyspace==null) throw new NullPointerException("keyspace");
+		this.keyspace = keyspace;
+		this.server = new UServer(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) throws Exception {
+				URespServer.this.initChannel(channel);
+			}
+		}, alloc);
+	}
+
+	/**
+	 * The keyspace.
+	 */
+	protected final URespKeyspace keyspace;
+
+	/**
+	 * The server that accepts the connections.
+	 */
+	private final UServer server;
+
+	/**
+	 * Returns the keyspace.
+	 * @return
+	 * the keyspace.
+	 */
+	public URespKeyspace keyspace() {
+		return keyspace;
+	}
+
+	/**
+	 * Sets up the pipeline of an accepted connection, may be overridden to add further handlers.
+	 * @param channel
+	 * the accepted channel.
+	 * @throws Exception
+	 * if the pipeline can't be set up.
+	 */
+	protected void initChannel( final UChannel channel ) throws Exception {
+		channel.pipeline().addLast(new URespDecoder(), new URespEncoder(), new URespServerHandler(keyspace));
+	}
+
+	/**
+	 * Binds the server to the given address and starts accepting connections.
+	 * @param address
+	 * the local address, use port zero to bind to any free port.
+	 * @return
+	 * the bound address; null if bound to a Unix domain socket.
+	 * @throws IOException
+	 * if binding failed.
+	 */
+	public InetSocketAddress bind( final SocketAddress address ) throws IOException {
+		return server.bind(address);
+	}
+
+	/**
+	 * Returns the bound address.
+	 * @return
+	 * the bound address or null, if the server is not bound.
+	 */
+	public InetSocketAddress localAddress() {
+		return server.localAddress();
+	}
+
+	/**
+	 * Returns a snapshot of the open connections.
+	 * @return
+	 * the open connections.
+	 */
+	public List<UChannel> channels() {
+		return server.channels();
+	}
+
+	/**
+	 * Stops accepting new connections and closes all open connections.
+	 * @return
+	 * the future that is completed once all connections are closed.
+	 */
+	public UFuture<List<Void>> close() {
+		return server.close();
+	}
+
+	/**
+	 * Shuts the server down gracefully: stops accepting, answers the commands in progress and closes the connections
+	 * that are still open after the given timeout.
+	 * @param timeout
+	 * the maximal time to wait for the connections to close.
+	 * @param unit
+	 * the unit of the timeout.
+	 * @return
+	 * the future that is completed once all connections are closed.
+	 * @see UServer#shutdown(long, TimeUnit)
+	 */
+	public UFuture<UDrainResult> shutdown( final long timeout, final TimeUnit unit ) {
+		return server.shutdown(timeout, unit);
+	}
+
+	@Override
+	public String toString() {
+		return "URespServer["+localAddress()+"]";
+	}
+}
@@ -0,0 +1,211 @@
+package com.umpani.aio.resp;
+
+import java.nio.charset.StandardCharsets;
+import java.util.ArrayDeque;
+import java.util.List;
+import java.util.Locale;
+
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UDrainEvent;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.exception.UCodecException;
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+
+/**
+ * Serves an {@link URespKeyspace} over a channel whose pipeline contains an {@link URespDecoder} and an
+ * {@link URespEncoder}. Every read list is a command, the replies are written in the order of the commands, even if
+ * the keyspace is owned by another event loop, so that clients may pipeline their commands.
+ *
+ * </p><p>The handler answers <tt>HELLO</tt> itself and switches the encoder to RESP3, if requested, and closes the
+ * channel after answering <tt>QUIT</tt>. Protocol errors are answered with an error and the channel is closed. Once
+ * the server shuts down, see {@link UDrainEvent}, the channel is closed after the replies of the commands in progress
+ * were written.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class URespServerHandler extends UChannelHandlerAdapter {
+	/**
+	 * Create a new handler.
+	 * @param keyspace
+	 * the keyspace to serve, may be shared by any amount of channels.
+	 */
+	public URespServerHandler( final URespKeyspace keyspace ) {
+		if (keyspace==null) throw new NullPointerException("keyspace");
+		this.keyspace = keyspace;
+	}
+
+	/**
+	 * The keyspace.
+	 */
+	protected final URespKeyspace keyspace;
+
+	/**
+	 * The replies in the order of the commands, only accessed from the event loop.
+	 */
+	private final ArrayDeque<Reply> replies = new ArrayDeque<>();
+
+	/**
+	 * True once the channel is closed after <tt>QUIT</tt> or a protocol error.
+	 */
+	private boolean closing;
+
+	/**
+	 * True once the server shuts down.
+	 */
+	private boolean draining;
+
+	@Override
+	public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+		if (closing) return;
+		final Reply reply = new Reply();
+		replies.add(reply);
+		if (!(msg instanceof List) || ((List<?>)msg).isEmpty()) {
+			reply.complete(ctx, new URespError("ERR Protocol error: expected an array of bulk strings"));
+			return;
+		}
+		final List<?> command = (List<?>)msg;
+		final Object first = command.get(0);
+		final String name = (first instanceof byte[] ? new String((byte[])first, StandardCharsets.UTF_8) : String.valueOf(first)).toUpperCase(Locale.ROOT);
+		if (name.equals("HELLO")) {
+			hello(ctx, reply, command);
+		} else
+		if (name.equals("QUIT")) {
+			reply.close = true;
+			reply.complete(ctx, URespStatus.OK);
+		} else {
+			keyspace.execute(command).addListener(new UFutureListener<Object>() {
+				@Override
+				public void complete( final UFuture<Object> future ) {
+					reply.complete(ctx, future.isSuccess() ? future.getNow() : new URespError("ERR "+future.cause().getMessage()));
+				}
+			}, ctx.loop());
+		}
+	}
+
+	/**
+	 * Answers <tt>HELLO [protover]</tt>, authentication and client names are ignored.
+	 */
+	private void hello( final UHandlerContext ctx, final Reply reply, final List<?> command ) {
+		final URespEncoder encoder = ctx.pipeline().get(URespEncoder.class);
+		int protocol = encoder!=null ? encoder.getProtocol() : UResp.RESP2;
+		if (command.size() > 1) {
+			final Object version = command.get(1);
+			final String text = version instanceof byte[] ? new String((byte[])version, StandardCharsets.UTF_8) : String.valueOf(version);
+			if (!text.equals("2") && !text.equals("3")) {
+				reply.complete(ctx, new URespError("NOPROTO unsupported protocol version"));
+				return;
+			}
+			protocol = Integer.parseInt(text);
+		}
+		final UMap<String,Object> info = new UMap<String,Object>();
+		info.put("server", "umpani");
+		info.put("version", "1.0.0");
+		info.put("proto", protocol);
+		info.put("mode", "standalone");
+		info.put("role", "master");
+		info.put("modules", new UList<Object>());
+		reply.protocol = protocol;
+		reply.complete(ctx, info);
+	}
+
+	@Override
+	public void exceptionCaught( final UHandlerContext ctx, final Throwable cause ) throws Exception {
+		if (cause instanceof UCodecException && !closing) {
+			final Reply reply = new Reply();
+			reply.close = true;
+			replies.add(reply);
+			reply.complete(ctx, new URespError("ERR Protocol error: "+cause.getMessage()));
+		} else {
+			ctx.fireExceptionCaught(cause);
+		}
+	}
+
+	@Override
+	public void userEvent( final UHandlerContext ctx, final Object event ) throws Exception {
+		if (event==UDrainEvent.INSTANCE && !draining) {
+			draining = true;
+			if (replies.isEmpty()) {
+				closing = true;
+				ctx.close();
+			}
+		}
+		ctx.fireUserEvent(event);
+	}
+
+	@Override
+	public void channelInactive( final UHandlerContext ctx ) throws Exception {
+		replies.clear();
+		ctx.fireChannelInactive();
+	}
+
+	/**
+	 * Writes the completed replies at the head of the queue.
+	 */
+	private void writeReady( final UHandlerContext ctx ) {
+		if (closing) return;
+		UFuture<Void> written = null;
+		Reply reply;
+		while ((reply = replies.peek())!=null && reply.done) {
+			replies.poll();
+			if (reply.protocol!=0) {
+				final URespEncoder encoder = ctx.pipeline().get(URespEncoder.class);
+				// the reply to HELLO is already encoded with the requested protocol
+				if (encoder!=null) encoder.setProtocol(reply.protocol);
+			}
+			written = ctx.write(reply.value!=null ? reply.value : UResp.NULL);
+			if (reply.close) {
+				closing = true;
+				break;
+			}
+		}
+		if (written==null) return;
+		ctx.flush();
+		if (closing || (draining && replies.isEmpty())) {
+			closing = true;
+			replies.clear();
+			written.addListener(new UFutureListener<Void>() {
+				@Override
+				public void complete( final UFuture<Void> future ) {
+					ctx.close();
+				}
+			}, null);
+		}
+	}
+
+	/**
+	 * The reply to a command.
+	 */
+	private final class Reply {
+		/**
+		 * The value, null for the null reply.
+		 */
+		Object value;
+
+		/**
+		 * True once the value is known.
+		 */
+		boolean done;
+
+		/**
+		 * The protocol to switch to before the value is written or zero.
+		 */
+		int protocol;
+
+		/**
+		 * True to close the channel after the value was written.
+		 */
+		boolean close;
+
+		/**
+		 * Completes the reply and writes all completed replies in order.
+		 */
+		void complete( final UHandlerContext ctx, final Object value ) {
+			this.value = value;
+			this.done = true;
+			writeReady(ctx);
+		}
+	}
+}
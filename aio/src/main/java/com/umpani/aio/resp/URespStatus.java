@@ -0,0 +1,61 @@
+package com.umpani.aio.resp;
+
+/**
+ * A RESP simple string, like <tt>+OK</tt>, as written by the {@link URespEncoder}. Strings are encoded as bulk
+ * strings, a status must be used for replies that clients expect as simple string. The {@link URespDecoder} decodes
+ * simple strings into plain strings.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class URespStatus {
+	/**
+	 * The status <tt>OK</tt>.
+	 */
+	public static final URespStatus OK = new URespStatus("OK");
+
+	/**
+	 * The status <tt>PONG</tt>.
+	 */
+	public static final URespStatus PONG = new URespStatus("PONG");
+
+	/**
+	 * Create a new status.
+	 * @param text
+	 * the text, which must not contain line breaks.
+	 * @throws IllegalArgumentException
+	 * if the text contains a line break.
+	 */
+	public URespStatus( final String text ) {
+		if (text.indexOf('\r') >= 0 || text.indexOf('\n') >= 0) throw new IllegalArgumentException("Line break in status: "+text);
+		this.text = text;
+	}
+
+	/**
+	 * The text.
+	 */
+	private final String text;
+
+	/**
+	 * Returns the text.
+	 * @return
+	 * the text.
+	 */
+	public String text() {
+		return text;
+	}
+
+	@Override
+	public boolean equals( final Object other ) {
+		return other instanceof URespStatus && ((URespStatus)other).text.equals(text);
+	}
+
+	@Override
+	public int hashCode() {
+		return text.hashCode();
+	}
+
+	@Override
+	public String toString() {
+		return text;
+	}
+}
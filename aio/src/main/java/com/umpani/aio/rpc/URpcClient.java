@@ -0,0 +1,338 @@
+package com.umpani.aio.rpc;
+
+import java.util.ArrayList;
+import java.util.List;
+import java.util.Map;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicLong;
+
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.exception.URpcException;
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+
+/**
+ * A JSON-RPC 2.0 client. Every call gets a unique numeric id, responses received by the transport are correlated with
+ * the pending calls by this id, so any amount of calls can be pending concurrently. A call that is not answered within
+ * the timeout fails with a {@link java.util.concurrent.TimeoutException}, an error response fails the call with an
+ * {@link URpcException}. Cancelling the future of a call only stops waiting for the response.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class URpcClient {
+	/**
+	 * The default timeout of calls in milliseconds.
+	 */
+	public static final long DEFAULT_TIMEOUT = 30000L;
+
+	/**
+	 * Create a new client.
+	 * @param transport
+	 * the transport used to send requests.
+	 */
+	public URpcClient( final URpcTransport transport ) {
+		if (transport==null) throw new NullPointerException("transport");
+		this.transport = transport;
+	}
+
+	/**
+	 * The transport.
+	 */
+	protected final URpcTransport transport;
+
+	/**
+	 * The id of the last call.
+	 */
+	private final AtomicLong lastId = new AtomicLong();
+
+	/**
+	 * The pending calls by id.
+	 */
+	private final ConcurrentHashMap<Long,UPromise<Object>> pending = new ConcurrentHashMap<>();
+
+	/**
+	 * The timeout of calls in milliseconds.
+	 */
+	private volatile long timeout = DEFAULT_TIMEOUT;
+
+	/**
+	 * Returns the timeout of calls.
+	 * @return
+	 * the timeout in milliseconds, zero if calls never time out.
+	 */
+	public long getTimeout() {
+		return timeout;
+	}
+
+	/**
+	 * Sets the timeout of calls that are made without an explicit timeout.
+	 * @param timeout
+	 * the timeout in milliseconds, zero or less if calls should never time out.
+	 * @return
+	 * this.
+	 */
+	public URpcClient setTimeout( final long timeout ) {
+		this.timeout = Math.max(0L, timeout);
+		return this;
+	}
+
+	/**
+	 * Returns the amount of calls waiting for their response.
+	 * @return
+	 * the amount of pending calls.
+	 */
+	public int pending() {
+		return pending.size();
+	}
+
+	/**
+	 * Calls a remote method using the default timeout.
+	 * @param method
+	 * the name of the method.
+	 * @param params
+	 * the parameters, a map for named parameters, a list for positional parameters or null.
+	 * @return
+	 * the future of the result.
+	 */
+	public UFuture<Object> call( final String method, final Object params ) {
+		return call(method, params, timeout, TimeUnit.MILLISECONDS);
+	}
+
+	/**
+	 * Calls a remote method.
+	 * @param method
+	 * the name of the method.
+	 * @param params
+	 * the parameters, a map for named parameters, a list for positional parameters or null.
+	 * @param timeout
+	 * the timeout, zero or less if the call should never time out.
+	 * @param unit
+	 * the unit of the timeout.
+	 * @return
+	 * the future of the result.
+	 */
+	public UFuture<Object> call( final String method, final Object params, final long timeout, final TimeUnit unit ) {
+		final long id = lastId.incrementAndGet();
+		final UMap<String,Object> request = request(id, method, params);
+		final UFuture<Object> result = expect(id, timeout, unit);
+		send(request, new long[] { id });
+		return result;
+	}
+
+	/**
+	 * Sends a notification, which is a request without response.
+	 * @param method
+	 * the name of the method.
+	 * @param params
+	 * the parameters, a map for named parameters, a list for positional parameters or null.
+	 * @return
+	 * the future that is completed once the notification was sent.
+	 */
+	public UFuture<Void> sendNotification( final String method, final Object params ) {
+		return transport.send(request(-1L, method, params));
+	}
+
+	/**
+	 * Starts a new batch, the calls of the batch are sent together as soon as {@link Batch#send()} is invoked.
+	 * @return
+	 * the new batch.
+	 */
+	public Batch batch() {
+		return new Batch();
+	}
+
+	/**
+	 * Passes a received message to the client, which completes the pending calls it answers.
+	 * @param message
+	 * a response object or a list of response objects.
+	 * @return
+	 * true if the message was a response or batch response; false if it is no response.
+	 */
+	public boolean receive( final Object message ) {
+		if (message instanceof List) {
+			final List<?> responses = (List<?>)message;
+			boolean result = !responses.isEmpty();
+			for (int i=0; i < responses.size(); i++) result &= receive(responses.get(i));
+			return result;
+		}
+		if (!(message instanceof Map)) return false;
+		final Map<?,?> response = (Map<?,?>)message;
+		if (!response.containsKey("result") && !response.containsKey("error")) return false;
+		final Object id = response.get("id");
+		// errors without id answer requests that the server could not parse, nothing we can correlate
+		if (!(id instanceof Number)) return true;
+		final UPromise<Object> promise = pending.remove(((Number)id).longValue());
+		if (promise==null) return true;
+		final Object error = response.get("error");
+		if (error instanceof Map) {
+			promise.fail(toException((Map<?,?>)error));
+		} else {
+			promise.complete(response.get("result"));
+		}
+		return true;
+	}
+
+	/**
+	 * Fails all pending calls, must be invoked by the transport once it was closed.
+	 * @param cause
+	 * the cause of the failure.
+	 */
+	public void close( final Throwable cause ) {
+		for (final Long id : pending.keySet()) {
+			final UPromise<Object> promise = pending.remove(id);
+			if (promise!=null) promise.fail(cause);
+		}
+	}
+
+	/**
+	 * Creates a request object.
+	 * @param id
+	 * the id, negative for notifications.
+	 */
+	private static UMap<String,Object> request( final long id, final String method, final Object params ) {
+		if (method==null) throw new NullPointerException("method");
+		if (params!=null && !(params instanceof Map) && !(params instanceof List)) {
+			throw new IllegalArgumentException("params must be a map or a list");
+		}
+		final UMap<String,Object> request = new UMap<String,Object>();
+		request.put("jsonrpc", URpcServer.VERSION);
+		request.put("method", method);
+		if (params!=null) request.put("params", params);
+		if (id >= 0) request.put("id", id);
+		return request;
+	}
+
+	/**
+	 * Registers a pending call.
+	 */
+	private UFuture<Object> expect( final long id, final long timeout, final TimeUnit unit ) {
+		final UPromise<Object> promise = new UPromise<Object>(transport.loop());
+		promise.onCancel(new Runnable() {
+			@Override
+			public void run() {
+				pending.remove(id, promise);
+			}
+		});
+		pending.put(id, promise);
+		return timeout > 0 ? promise.withTimeout(timeout, unit, transport.loop()) : promise;
+	}
+
+	/**
+	 * Sends the given message and fails the calls with the given ids if sending failed.
+	 */
+	private UFuture<Void> send( final Object message, final long[] ids ) {
+		final UFuture<Void> sent;
+		try {
+			sent = transport.send(message);
+		} catch (Throwable t) {
+			fail(ids, t);
+			return UFuture.failed(t);
+		}
+		return sent.addListener(new UFutureListener<Void>() {
+			@Override
+			public void complete( final UFuture<Void> future ) {
+				if (!future.isSuccess()) fail(ids, future.cause());
+			}
+		}, null);
+	}
+
+	/**
+	 * Fails the pending calls with the given ids.
+	 */
+	private void fail( final long[] ids, final Throwable cause ) {
+		for (final long id : ids) {
+			final UPromise<Object> promise = pending.remove(id);
+			if (promise!=null) promise.fail(cause);
+		}
+	}
+
+	/**
+	 * Converts a received error object into an exception.
+	 */
+	private static URpcException toException( final Map<?,?> error ) {
+		final Object code = error.get("code");
+		final Object message = error.get("message");
+		return new URpcException(
+			code instanceof Number ? ((Number)code).intValue() : URpcException.INTERNAL_ERROR,
+			message!=null ? message.toString() : "Unknown error",
+			error.get("data")
+		);
+	}
+
+	/**
+	 * A batch of calls and notifications that are sent together.
+	 */
+	public final class Batch {
+		Batch() {}
+
+		/**
+		 * The request objects.
+		 */
+		private final UList<Object> requests = new UList<Object>();
+
+		/**
+		 * The ids of the calls.
+		 */
+		private final ArrayList<Long> ids = new ArrayList<>();
+
+		/**
+		 * True once the batch was sent.
+		 */
+		private boolean sent;
+
+		/**
+		 * Adds a call that uses the default timeout.
+		 * @param method
+		 * the name of the method.
+		 * @param params
+		 * the parameters, a map for named parameters, a list for positional parameters or null.
+		 * @return
+		 * the future of the result.
+		 * @throws IllegalStateException
+		 * if the batch was already sent.
+		 */
+		public UFuture<Object> call( final String method, final Object params ) {
+			if (sent) throw new IllegalStateException("Batch already sent");
+			final long id = lastId.incrementAndGet();
+			requests.add(request(id, method, params));
+			ids.add(id);
+			return expect(id, timeout, TimeUnit.MILLISECONDS);
+		}
+
+		/**
+		 * Adds a notification.
+		 * @param method
+		 * the name of the method.
+		 * @param params
+		 * the parameters, a map for named parameters, a list for positional parameters or null.
+		 * @return
+		 * this.
+		 * @throws IllegalStateException
+		 * if the batch was already sent.
+		 */
+		public Batch notification( final String method, final Object params ) {
+			if (sent) throw new IllegalStateException("Batch already sent");
+			requests.add(request(-1L, method, params));
+			return this;
+		}
+
+		/**
+		 * Sends the batch, if sending fails, all calls of the batch fail.
+		 * @return
+		 * the future that is completed once the batch was sent.
+		 * @throws IllegalStateException
+		 * if the batch is empty or was already sent.
+		 */
+		public UFuture<Void> send() {
+			if (sent) throw new IllegalStateException("Batch already sent");
+			if (requests.isEmpty()) throw new IllegalStateException("Empty batch");
+			sent = true;
+			final long[] ids = new long[this.ids.size()];
+			for (int i=0; i < ids.length; i++) ids[i] = this.ids.get(i);
+			return URpcClient.this.send(requests, ids);
+		}
+	}
+}
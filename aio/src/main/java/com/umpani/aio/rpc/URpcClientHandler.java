@@ -0,0 +1,74 @@
+package com.umpani.aio.rpc;
+
+import java.nio.channels.ClosedChannelException;
+
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UEventLoop;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UHandlerContext;
+
+/**
+ * Uses a channel as transport of an {@link URpcClient}. The pipeline in front of this handler must decode messages
+ * into JSON values and encode request objects, for example with the {@link com.umpani.aio.codec.UNdjsonDecoder} and
+ * the {@link com.umpani.aio.codec.UNdjsonEncoder}. Read responses complete the pending calls, all other messages are
+ * passed on. Once the channel becomes inactive, all pending calls fail.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class URpcClientHandler extends UChannelHandlerAdapter implements URpcTransport {
+	/**
+	 * Create a new handler.
+	 */
+	public URpcClientHandler() {
+		this.client = new URpcClient(this);
+	}
+
+	/**
+	 * The client.
+	 */
+	private final URpcClient client;
+
+	/**
+	 * The context of this handler, once added to a pipeline.
+	 */
+	private volatile UHandlerContext ctx;
+
+	/**
+	 * Returns the client that uses this handler as transport.
+	 * @return
+	 * the client.
+	 */
+	public final URpcClient client() {
+		return client;
+	}
+
+	@Override
+	public UEventLoop loop() {
+		final UHandlerContext ctx = this.ctx;
+		if (ctx==null) throw new IllegalStateException("Handler not added to a pipeline");
+		return ctx.loop();
+	}
+
+	@Override
+	public UFuture<Void> send( final Object message ) {
+		final UHandlerContext ctx = this.ctx;
+		if (ctx==null) return UFuture.failed(new IllegalStateException("Handler not added to a pipeline"));
+		return ctx.writeAndFlush(message);
+	}
+
+	@Override
+	public void handlerAdded( final UHandlerContext ctx ) throws Exception {
+		this.ctx = ctx;
+	}
+
+	@Override
+	public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+		if (!client.receive(msg)) ctx.fireChannelRead(msg);
+	}
+
+	@Override
+	public void channelInactive( final UHandlerContext ctx ) throws Exception {
+		client.close(new ClosedChannelException());
+		ctx.fireChannelInactive();
+	}
+}
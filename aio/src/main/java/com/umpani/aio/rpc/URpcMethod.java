@@ -0,0 +1,23 @@
+package com.umpani.aio.rpc;
+
+import com.umpani.aio.UFuture;
+
+/**
+ * A method that can be called remotely using JSON-RPC, registered at an {@link URpcServer}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface URpcMethod {
+	/**
+	 * Invokes the method. The result must be serializable as JSON, the method should throw or fail with an
+	 * {@link com.umpani.aio.exception.URpcException} to return a specific error to the caller.
+	 * @param params
+	 * the parameters, a {@link com.umpani.util.UMap} for named parameters, an {@link com.umpani.util.UList} for
+	 * positional parameters or null, if the request had no parameters.
+	 * @return
+	 * the future of the result, null is the same as a future that succeeded with null.
+	 * @throws Exception
+	 * if the method failed.
+	 */
+	public UFuture<?> invoke( final Object params ) throws Exception;
+}
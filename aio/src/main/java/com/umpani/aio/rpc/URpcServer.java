@@ -0,0 +1,224 @@
+package com.umpani.aio.rpc;
+
+import java.util.ArrayList;
+import java.util.List;
+import java.util.Map;
+import java.util.concurrent.ConcurrentHashMap;
+
+import com.umpani.aio.UFunction;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.exception.URpcException;
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+import com.umpani.util.exception.UJsonException;
+import com.umpani.util.json.UJsonReader;
+
+/**
+ * A JSON-RPC 2.0 server, which dispatches request objects to the registered methods and produces the response
+ * objects. The server does not depend on a transport, it only converts requests into responses: the
+ * {@link URpcServerHandler} serves it over a channel, for example with NDJSON framing, other transports like HTTP pass
+ * the request body to {@link #handle(CharSequence)} and send the response back.
+ *
+ * </p><p>Batches are processed concurrently, the response of a batch holds the responses of all requests that are
+ * no notifications. Notifications never produce a response, not even if they fail.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class URpcServer {
+	/**
+	 * The protocol version.
+	 */
+	public static final String VERSION = "2.0";
+
+	/**
+	 * Create a new server without methods.
+	 */
+	public URpcServer() {}
+
+	/**
+	 * The registered methods by name.
+	 */
+	private final ConcurrentHashMap<String,URpcMethod> methods = new ConcurrentHashMap<>();
+
+	/**
+	 * Registers a method.
+	 * @param name
+	 * the name of the method.
+	 * @param method
+	 * the method.
+	 * @return
+	 * this.
+	 * @throws IllegalArgumentException
+	 * if a method with the given name is already registered.
+	 */
+	public URpcServer register( final String name, final URpcMethod method ) {
+		if (name==null) throw new NullPointerException("name");
+		if (method==null) throw new NullPointerException("method");
+		if (methods.putIfAbsent(name, method)!=null) throw new IllegalArgumentException("Duplicate method: "+name);
+		return this;
+	}
+
+	/**
+	 * Removes a method.
+	 * @param name
+	 * the name of the method.
+	 * @return
+	 * the removed method or null, if no such method is registered.
+	 */
+	public URpcMethod unregister( final String name ) {
+		return methods.remove(name);
+	}
+
+	/**
+	 * Returns the method with the given name.
+	 * @param name
+	 * the name of the method.
+	 * @return
+	 * the method or null, if no such method is registered.
+	 */
+	public URpcMethod get( final String name ) {
+		return methods.get(name);
+	}
+
+	/**
+	 * Parses the given JSON text and handles the request or batch it holds.
+	 * @param json
+	 * the JSON text.
+	 * @return
+	 * the future of the response, which succeeds with null if no response must be sent.
+	 */
+	public UFuture<Object> handle( final CharSequence json ) {
+		final Object message;
+		try {
+			message = UJsonReader.parse(json);
+		} catch (UJsonException e) {
+			return UFuture.<Object>succeeded(error(null, URpcException.PARSE_ERROR, "Parse error", e.getMessage()));
+		}
+		return handle(message);
+	}
+
+	/**
+	 * Handles a parsed request or batch.
+	 * @param message
+	 * the request object or the list of request objects.
+	 * @return
+	 * the future of the response, which succeeds with a response object, with a list of response objects or, if no
+	 * response must be sent, with null.
+	 */
+	public UFuture<Object> handle( final Object message ) {
+		if (!(message instanceof List)) return handleRequest(message);
+		final List<?> batch = (List<?>)message;
+		if (batch.isEmpty()) {
+			return UFuture.<Object>succeeded(error(null, URpcException.INVALID_REQUEST, "Invalid Request", "Empty batch"));
+		}
+		final ArrayList<UFuture<Object>> futures = new ArrayList<>(batch.size());
+		for (int i=0; i < batch.size(); i++) futures.add(handleRequest(batch.get(i)));
+		return UFuture.<Object>all(futures).map(new UFunction<List<Object>, Object>() {
+			@Override
+			public Object apply( final List<Object> responses ) {
+				final UList<Object> result = new UList<Object>();
+				for (final Object response : responses) {
+					if (response!=null) result.add(response);
+				}
+				return result.isEmpty() ? null : result;
+			}
+		});
+	}
+
+	/**
+	 * Handles a single request object.
+	 */
+	private UFuture<Object> handleRequest( final Object message ) {
+		if (!(message instanceof Map)) {
+			return UFuture.<Object>succeeded(error(null, URpcException.INVALID_REQUEST, "Invalid Request", null));
+		}
+		final Map<?,?> request = (Map<?,?>)message;
+		final boolean notification = !request.containsKey("id");
+		final Object id = request.get("id");
+		final Object name = request.get("method");
+		final Object params = request.get("params");
+		final boolean validId = id==null || id instanceof String || id instanceof Number;
+		if (!validId || !VERSION.equals(request.get("jsonrpc")) || !(name instanceof String)
+		|| (params!=null && !(params instanceof Map) && !(params instanceof List))) {
+			return UFuture.<Object>succeeded(error(validId ? id : null, URpcException.INVALID_REQUEST, "Invalid Request", null));
+		}
+		final URpcMethod method = methods.get(name);
+		UFuture<?> result;
+		if (method==null) {
+			result = UFuture.failed(new URpcException(URpcException.METHOD_NOT_FOUND, "Method not found", name));
+		} else {
+			try {
+				result = method.invoke(params);
+				if (result==null) result = UFuture.succeeded(null);
+			} catch (Throwable t) {
+				result = UFuture.failed(t);
+			}
+		}
+		return respond(id, notification, result);
+	}
+
+	/**
+	 * Converts the result of a method into the response object.
+	 */
+	private <T> UFuture<Object> respond( final Object id, final boolean notification, final UFuture<T> result ) {
+		return result.then(new UFunction<T, Object>() {
+			@Override
+			public Object apply( final T value ) {
+				if (notification) return null;
+				final UMap<String,Object> response = new UMap<String,Object>();
+				response.put("jsonrpc", VERSION);
+				response.put("result", value);
+				response.put("id", id);
+				return response;
+			}
+		}, new UFunction<Throwable, Object>() {
+			@Override
+			public Object apply( final Throwable cause ) {
+				if (notification) return null;
+				final URpcException e = toRpcException(cause);
+				return error(id, e.getCode(), e.getMessage(), e.getData());
+			}
+		});
+	}
+
+	/**
+	 * Converts the failure of a method into an RPC exception. By default an {@link IllegalArgumentException} is
+	 * reported as invalid parameters and any other exception as internal error.
+	 * @param cause
+	 * the failure.
+	 * @return
+	 * the RPC exception to report.
+	 */
+	protected URpcException toRpcException( final Throwable cause ) {
+		if (cause instanceof URpcException) return (URpcException)cause;
+		if (cause instanceof IllegalArgumentException) {
+			return new URpcException(URpcException.INVALID_PARAMS, "Invalid params", cause.getMessage());
+		}
+		return new URpcException(URpcException.INTERNAL_ERROR, "Internal error", cause.toString());
+	}
+
+	/**
+	 * Creates an error response.
+	 * @param id
+	 * the id of the request, null if it could not be detected.
+	 * @param code
+	 * the error code.
+	 * @param message
+	 * the error message.
+	 * @param data
+	 * additional information or null.
+	 * @return
+	 * the response object.
+	 */
+	public static UMap<String,Object> error( final Object id, final int code, final String message, final Object data ) {
+		final UMap<String,Object> error = new UMap<String,Object>();
+		error.put("code", code);
+		error.put("message", message);
+		if (data!=null) error.put("data", data);
+		final UMap<String,Object> response = new UMap<String,Object>();
+		response.put("jsonrpc", VERSION);
+		response.put("error", error);
+		response.put("id", id);
+		return response;
+	}
+}
@@ -0,0 +1,135 @@
+package com.umpani.aio.rpc;
+
+import java.util.List;
+import java.util.Map;
+
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UDrainEvent;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.exception.UCodecException;
+import com.umpani.aio.exception.URpcException;
+import com.umpani.util.UList;
+
+/**
+ * Serves an {@link URpcServer} over a channel whose pipeline decodes messages into JSON values and encodes response
+ * objects, for example with the {@link com.umpani.aio.codec.UNdjsonDecoder} and the
+ * {@link com.umpani.aio.codec.UNdjsonEncoder}. Every read value is handled as request or batch, decode errors are
+ * answered with a parse error. Responses are written in the order in which the methods complete.
+ *
+ * </p><p>Once the server shuts down, see {@link UDrainEvent}, further requests are answered with
+ * {@link URpcException#SHUTTING_DOWN} and the channel is closed after the responses of the requests in progress
+ * were written.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class URpcServerHandler extends UChannelHandlerAdapter {
+	/**
+	 * Create a new handler.
+	 * @param server
+	 * the server to serve, may be shared by any amount of channels.
+	 */
+	public URpcServerHandler( final URpcServer server ) {
+		if (server==null) throw new NullPointerException("server");
+		this.server = server;
+	}
+
+	/**
+	 * The server.
+	 */
+	protected final URpcServer server;
+
+	/**
+	 * The amount of requests in progress, only accessed from the event loop.
+	 */
+	private int pending;
+
+	/**
+	 * True once the server shuts down.
+	 */
+	private boolean draining;
+
+	@Override
+	public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+		if (draining) {
+			reject(ctx, msg);
+			return;
+		}
+		pending++;
+		server.handle(msg).addListener(new UFutureListener<Object>() {
+			@Override
+			public void complete( final UFuture<Object> future ) {
+				pending--;
+				UFuture<Void> written = null;
+				if (!future.isSuccess()) {
+					ctx.fireExceptionCaught(future.cause());
+				} else
+				if (future.getNow()!=null) {
+					written = ctx.writeAndFlush(future.getNow());
+				}
+				if (draining && pending==0) closeAfter(ctx, written);
+			}
+		}, ctx.loop());
+	}
+
+	@Override
+	public void exceptionCaught( final UHandlerContext ctx, final Throwable cause ) throws Exception {
+		if (cause instanceof UCodecException) {
+			ctx.writeAndFlush(URpcServer.error(null, URpcException.PARSE_ERROR, "Parse error", cause.getMessage()));
+		} else {
+			ctx.fireExceptionCaught(cause);
+		}
+	}
+
+	@Override
+	public void userEvent( final UHandlerContext ctx, final Object event ) throws Exception {
+		if (event==UDrainEvent.INSTANCE && !draining) {
+			draining = true;
+			if (pending==0) ctx.close();
+		}
+		ctx.fireUserEvent(event);
+	}
+
+	/**
+	 * Answers a request received during the shutdown with an error, notifications are dropped.
+	 */
+	private static void reject( final UHandlerContext ctx, final Object msg ) {
+		if (msg instanceof List) {
+			final UList<Object> responses = new UList<Object>();
+			for (final Object request : (List<?>)msg) {
+				final Object response = rejection(request);
+				if (response!=null) responses.add(response);
+			}
+			if (!responses.isEmpty()) ctx.writeAndFlush(responses);
+			return;
+		}
+		final Object response = rejection(msg);
+		if (response!=null) ctx.writeAndFlush(response);
+	}
+
+	/**
+	 * Returns the error response to a single request or null, if it is a notification.
+	 */
+	private static Object rejection( final Object request ) {
+		if (request instanceof Map && !((Map<?,?>)request).containsKey("id")) return null;
+		final Object id = request instanceof Map ? ((Map<?,?>)request).get("id") : null;
+		return URpcServer.error(id, URpcException.SHUTTING_DOWN, "Server shutting down", null);
+	}
+
+	/**
+	 * Closes the channel once the given write is done or at once, if nothing was written.
+	 */
+	private static void closeAfter( final UHandlerContext ctx, final UFuture<Void> written ) {
+		if (written==null) {
+			ctx.close();
+			return;
+		}
+		written.addListener(new UFutureListener<Void>() {
+			@Override
+			public void complete( final UFuture<Void> future ) {
+				ctx.close();
+			}
+		}, null);
+	}
+}
@@ -0,0 +1,28 @@
+package com.umpani.aio.rpc;
+
+import com.umpani.aio.UEventLoop;
+import com.umpani.aio.UFuture;
+
+/**
+ * The transport used by an {@link URpcClient} to send requests. The transport must pass every response it receives
+ * to {@link URpcClient#receive(Object)}, so that the client can correlate it with the pending request.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface URpcTransport {
+	/**
+	 * Returns the event loop used to complete calls and to schedule their timeouts.
+	 * @return
+	 * the event loop.
+	 */
+	public UEventLoop loop();
+
+	/**
+	 * Sends a request object or a batch of request objects.
+	 * @param message
+	 * the {@link com.umpani.util.UMap} or the {@link com.umpani.util.UList} to send.
+	 * @return
+	 * the future that is completed once the message was sent.
+	 */
+	public UFuture<Void> send( final Object message );
+}
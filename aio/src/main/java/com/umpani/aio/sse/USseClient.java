@@ -0,0 +1,272 @@
+package com.umpani.aio.sse;
+
+import java.util.concurrent.RejectedExecutionException;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicBoolean;
+import java.util.concurrent.atomic.AtomicInteger;
+
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.exception.UHttpException;
+import com.umpani.aio.http.UHttpBodyHandler;
+import com.umpani.aio.http.UHttpClient;
+import com.umpani.aio.http.UHttpHeaders;
+import com.umpani.aio.http.UHttpRequest;
+import com.umpani.aio.http.UHttpResponse;
+
+/**
+ * A client of an event stream, that uses an {@link UHttpClient} to open the stream and an {@link USseParser} to parse
+ * it. If the stream ends or the connection is lost, the client reconnects after the reconnection time and sends the id
+ * of the last received event as <tt>Last-Event-ID</tt>, so that the server can resume the stream. The server may
+ * change the reconnection time with the <tt>retry</tt> field.
+ *
+ * </p><p>The client stops without reconnecting, if it is closed, if the server answers with 204 No Content or if the
+ * server rejects the request with another status than 200 or a response that is no event stream. The listener is
+ * invoked by the event loop of the connection, an exception thrown by the listener drops the connection and the client
+ * reconnects.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class USseClient {
+	/**
+	 * The default reconnection time in milliseconds.
+	 */
+	public static final long DEFAULT_RETRY = 3000L;
+
+	/**
+	 * Create a new client, call {@link #start()} to open the stream.
+	 * @param client
+	 * the HTTP client used to open the stream.
+	 * @param url
+	 * the absolute URL of the stream.
+	 * @param listener
+	 * the listener of the events.
+	 */
+	public USseClient( final UHttpClient client, final String url, final USseListener listener ) {
+		this.client = client;
+		this.url = url;
+		this.listener = listener;
+		this.parser = new USseParser(new USseListener() {
+			@Override
+			public void onEvent( final USseEvent event ) throws Exception {
+				if (event.id()!=null) lastEventId = event.id();
+				listener.onEvent(event);
+			}
+		});
+	}
+
+	/**
+	 * The HTTP client.
+	 */
+	protected final UHttpClient client;
+
+	/**
+	 * The URL of the stream.
+	 */
+	protected final String url;
+
+	/**
+	 * The listener of the events.
+	 */
+	protected final USseListener listener;
+
+	/**
+	 * The parser, used by one connection at a time.
+	 */
+	private final USseParser parser;
+
+	/**
+	 * The promise that is completed once the client stopped.
+	 */
+	private final UPromise<Void> closePromise = new UPromise<Void>(null);
+
+	/**
+	 * True once the client was started.
+	 */
+	private final AtomicBoolean started = new AtomicBoolean();
+
+	/**
+	 * The amount of connection attempts.
+	 */
+	private final AtomicInteger connects = new AtomicInteger();
+
+	/**
+	 * The id of the last received event or null.
+	 */
+	private volatile String lastEventId;
+
+	/**
+	 * The reconnection time in milliseconds.
+	 */
+	private volatile long retry = DEFAULT_RETRY;
+
+	/**
+	 * The pending request or reconnect.
+	 */
+	private volatile UFuture<?> pending;
+
+	/**
+	 * Sets the reconnection time, until the server sends another one.
+	 * @param millis
+	 * the time in milliseconds.
+	 * @return
+	 * this.
+	 */
+	public USseClient setRetry( final long millis ) {
+		this.retry = Math.max(0L, millis);
+		return this;
+	}
+
+	/**
+	 * Returns the current reconnection time.
+	 * @return
+	 * the time in milliseconds.
+	 */
+	public long retry() {
+		return retry;
+	}
+
+	/**
+	 * Sets the id of the last received event, to resume a stream received before.
+	 * @param id
+	 * the id or null.
+	 * @return
+	 * this.
+	 */
+	public USseClient setLastEventId( final String id ) {
+		this.lastEventId = id;
+		return this;
+	}
+
+	/**
+	 * Returns the id of the last received event.
+	 * @return
+	 * the id or null.
+	 */
+	public String lastEventId() {
+		return lastEventId;
+	}
+
+	/**
+	 * Returns the amount of connection attempts so far, including the first one.
+	 * @return
+	 * the amount of connection attempts.
+	 */
+	public int connects() {
+		return connects.get();
+	}
+
+	/**
+	 * Returns true once the client stopped.
+	 * @return
+	 * true once the client stopped.
+	 */
+	public boolean isClosed() {
+		return closePromise.isDone();
+	}
+
+	/**
+	 * Returns the future that is completed once the client stopped, it fails if the server rejected the stream.
+	 * @return
+	 * the close future.
+	 */
+	public UFuture<Void> closeFuture() {
+		return closePromise;
+	}
+
+	/**
+	 * Opens the stream.
+	 * @return
+	 * this.
+	 * @throws IllegalStateException
+	 * if the client was already started.
+	 */
+	public USseClient start() {
+		if (!started.compareAndSet(false, true)) throw new IllegalStateException("Client already started");
+		connect();
+		return this;
+	}
+
+	/**
+	 * Closes the stream and stops reconnecting.
+	 */
+	public void close() {
+		if (!closePromise.complete(null)) return;
+		final UFuture<?> pending = this.pending;
+		if (pending!=null) pending.cancel(false);
+	}
+
+	/**
+	 * Opens the stream.
+	 */
+	private void connect() {
+		if (isClosed()) return;
+		connects.incrementAndGet();
+		final UHttpRequest request = new UHttpRequest("GET", url);
+		request.headers().set(UHttpHeaders.ACCEPT, USseResponse.TEXT_EVENT_STREAM);
+		request.headers().set(UHttpHeaders.CACHE_CONTROL, "no-cache");
+		final String lastEventId = this.lastEventId;
+		if (lastEventId!=null) request.headers().set(USseResponse.LAST_EVENT_ID, lastEventId);
+		final UFuture<UHttpResponse> future = client.send(request, new UHttpBodyHandler() {
+			@Override
+			public void headers( final UHttpResponse response ) throws Exception {
+				final int status = response.status();
+				if (status==204) return;
+				if (status!=200) throw new UHttpException(status, "Event stream rejected: "+response);
+				final String type = response.headers().get(UHttpHeaders.CONTENT_TYPE, "");
+				if (!type.toLowerCase().startsWith(USseResponse.TEXT_EVENT_STREAM)) throw new UHttpException(status, "Not an event stream: "+type);
+				parser.reset();
+			}
+
+			@Override
+			public void data( final byte[] data ) throws Exception {
+				try {
+					parser.feed(data);
+				} finally {
+					if (parser.retry() >= 0) retry = parser.retry();
+				}
+			}
+		});
+		pending = future;
+		future.addListener(new UFutureListener<UHttpResponse>() {
+			@Override
+			public void complete( final UFuture<UHttpResponse> future ) {
+				if (isClosed()) return;
+				if (future.isSuccess() && future.getNow().status()==204) {
+					closePromise.complete(null);
+				} else
+				if (!future.isSuccess() && (future.cause() instanceof UHttpException || future.cause() instanceof IllegalStateException)) {
+					closePromise.fail(future.cause());
+				} else {
+					reconnect();
+				}
+			}
+		}, null);
+		// closed while the request was sent
+		if (isClosed()) future.cancel(false);
+	}
+
+	/**
+	 * Reconnects after the reconnection time.
+	 */
+	private void reconnect() {
+		try {
+			pending = client.group().next().schedule(new Runnable() {
+				@Override
+				public void run() {
+					connect();
+				}
+			}, retry, TimeUnit.MILLISECONDS);
+		} catch (RejectedExecutionException e) {
+			closePromise.fail(e);
+			return;
+		}
+		if (isClosed()) pending.cancel(false);
+	}
+
+	@Override
+	public String toString() {
+		return "USseClient["+url+"]";
+	}
+}
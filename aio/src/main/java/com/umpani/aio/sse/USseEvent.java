@@ -0,0 +1,209 @@
+package com.umpani.aio.sse;
+
+import com.umpani.util.exception.UJsonException;
+import com.umpani.util.json.UJsonReader;
+import com.umpani.util.json.UJsonWriter;
+
+/**
+ * A server-sent event with optional id, type and reconnection time. The data is text that may span multiple lines,
+ * it is sent as one <tt>data</tt> field per line. An event without any field may be used to send only a reconnection
+ * time to the client.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class USseEvent {
+	/**
+	 * Create a new event without data.
+	 */
+	public USseEvent() {}
+
+	/**
+	 * Create a new event.
+	 * @param data
+	 * the data, may be null.
+	 */
+	public USseEvent( final String data ) {
+		this.data = data;
+	}
+
+	/**
+	 * The id or null.
+	 */
+	private String id;
+
+	/**
+	 * The type or null.
+	 */
+	private String event;
+
+	/**
+	 * The data or null.
+	 */
+	private String data;
+
+	/**
+	 * The reconnection time in milliseconds or -1.
+	 */
+	private long retry = -1L;
+
+	/**
+	 * Returns an event with the given value serialized as JSON as data.
+	 * @param value
+	 * the value, usually an {@link com.umpani.util.UMap}.
+	 * @return
+	 * the event.
+	 */
+	public static USseEvent json( final Object value ) {
+		return new USseEvent(UJsonWriter.toJson(value));
+	}
+
+	/**
+	 * Returns the id, which the client sends as <tt>Last-Event-ID</tt> when it reconnects.
+	 * @return
+	 * the id or null.
+	 */
+	public String id() {
+		return id;
+	}
+
+	/**
+	 * Sets the id.
+	 * @param id
+	 * the id or null.
+	 * @return
+	 * this.
+	 * @throws IllegalArgumentException
+	 * if the id contains a line break or a null character.
+	 */
+	public USseEvent setId( final String id ) {
+		if (id!=null && (isMultiLine(id) || id.indexOf('\0') >= 0)) throw new IllegalArgumentException("Invalid id: "+id);
+		this.id = id;
+		return this;
+	}
+
+	/**
+	 * Returns the type.
+	 * @return
+	 * the type or null, if the event has the default type <tt>message</tt>.
+	 */
+	public String event() {
+		return event;
+	}
+
+	/**
+	 * Sets the type.
+	 * @param event
+	 * the type or null.
+	 * @return
+	 * this.
+	 * @throws IllegalArgumentException
+	 * if the type contains a line break.
+	 */
+	public USseEvent setEvent( final String event ) {
+		if (event!=null && isMultiLine(event)) throw new IllegalArgumentException("Invalid event: "+event);
+		this.event = event;
+		return this;
+	}
+
+	/**
+	 * Returns the data.
+	 * @return
+	 * the data or null.
+	 */
+	public String data() {
+		return data;
+	}
+
+	/**
+	 * Sets the data.
+	 * @param data
+	 * the data or null.
+	 * @return
+	 * this.
+	 */
+	public USseEvent setData( final String data ) {
+		this.data = data;
+		return this;
+	}
+
+	/**
+	 * Parses the data as JSON.
+	 * @return
+	 * the parsed data, usually an {@link com.umpani.util.UMap}, or null if the event has no data.
+	 * @throws UJsonException
+	 * if the data is no valid JSON.
+	 */
+	public Object json() throws UJsonException {
+		return data!=null ? UJsonReader.parse(data) : null;
+	}
+
+	/**
+	 * Sets the data to the given value serialized as JSON.
+	 * @param value
+	 * the value, usually an {@link com.umpani.util.UMap}.
+	 * @return
+	 * this.
+	 */
+	public USseEvent setJson( final Object value ) {
+		this.data = UJsonWriter.toJson(value);
+		return this;
+	}
+
+	/**
+	 * Returns the reconnection time.
+	 * @return
+	 * the time in milliseconds or -1, if not set.
+	 */
+	public long retry() {
+		return retry;
+	}
+
+	/**
+	 * Sets the reconnection time the client waits before it reconnects after the stream was lost.
+	 * @param millis
+	 * the time in milliseconds or -1, to not send it.
+	 * @return
+	 * this.
+	 */
+	public USseEvent setRetry( final long millis ) {
+		this.retry = millis < 0 ? -1L : millis;
+		return this;
+	}
+
+	/**
+	 * Returns the event in the wire format, terminated by an empty line.
+	 * @return
+	 * the encoded event.
+	 */
+	public String encode() {
+		final StringBuilder sb = new StringBuilder();
+		if (id!=null) sb.append("id: ").append(id).append('\n');
+		if (event!=null) sb.append("event: ").append(event).append('\n');
+		if (retry >= 0) sb.append("retry: ").append(retry).append('\n');
+		if (data!=null) {
+			int start = 0;
+			final int length = data.length();
+			for (int i=0; i < length; i++) {
+				final char c = data.charAt(i);
+				if (c!='\r' && c!='\n') continue;
+				sb.append("data: ").append(data, start, i).append('\n');
+				if (c=='\r' && i + 1 < length && data.charAt(i + 1)=='\n') i++;
+				start = i + 1;
+			}
+			sb.append("data: ").append(data, start, length).append('\n');
+		}
+		return sb.append('\n').toString();
+	}
+
+	/**
+	 * Returns true if the given text contains a line break.
+	 */
+	private static boolean isMultiLine( final String text ) {
+		return text.indexOf('\n') >= 0 || text.indexOf('\r') >= 0;
+	}
+
+	@Override
+	public String toString() {
+		return "USseEvent[id="+id+", event="+event+", data="+data+"]";
+	}
+}
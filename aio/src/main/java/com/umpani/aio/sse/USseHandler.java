@@ -0,0 +1,18 @@
+package com.umpani.aio.sse;
+
+/**
+ * Serves an event stream opened by an {@link USseResponse}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface USseHandler {
+	/**
+	 * Called by the event loop of the connection once the header of the response was written. The handler may send
+	 * events immediately or later from any thread, the stream stays open until it is closed or the client disconnects.
+	 * @param stream
+	 * the stream to send the events to.
+	 * @throws Exception
+	 * if the stream can not be served, the connection is closed.
+	 */
+	public void open( final USseStream stream ) throws Exception;
+}
@@ -0,0 +1,17 @@
+package com.umpani.aio.sse;
+
+/**
+ * Receives the events parsed by an {@link USseParser}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface USseListener {
+	/**
+	 * Called for every complete event.
+	 * @param event
+	 * the event, its id is the last event id seen in the stream.
+	 * @throws Exception
+	 * if the event is rejected, the exception is thrown by {@link USseParser#feed(byte[], int, int)}.
+	 */
+	public void onEvent( final USseEvent event ) throws Exception;
+}
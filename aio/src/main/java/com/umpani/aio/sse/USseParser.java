@@ -0,0 +1,246 @@
+package com.umpani.aio.sse;
+
+import java.nio.charset.StandardCharsets;
+import java.util.Arrays;
+
+import com.umpani.aio.exception.UTooLongFrameException;
+
+/**
+ * An incremental parser of an event stream as specified for <tt>text/event-stream</tt>. The stream is fed in arbitrary
+ * parts, lines may be terminated by CR, LF or CRLF, even if the terminator is split between two parts. Comments and
+ * unknown fields are ignored, an event is dispatched to the listener at the empty line that terminates it, if it has
+ * data. An incomplete event at the end of the stream is discarded.
+ *
+ * </p><p>The parser remembers the last event id and the last reconnection time sent by the server, so that a client
+ * can resume the stream after a reconnect. A parser is not thread safe.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class USseParser {
+	/**
+	 * The default maximal length of a line in bytes.
+	 */
+	public static final int DEFAULT_MAX_LINE_LENGTH = 1024*1024;
+
+	/**
+	 * Create a new parser with the default maximal line length.
+	 * @param listener
+	 * the listener of the events.
+	 */
+	public USseParser( final USseListener listener ) {
+		this(listener, DEFAULT_MAX_LINE_LENGTH);
+	}
+
+	/**
+	 * Create a new parser.
+	 * @param listener
+	 * the listener of the events.
+	 * @param maxLineLength
+	 * the maximal length of a line in bytes.
+	 */
+	public USseParser( final USseListener listener, final int maxLineLength ) {
+		if (maxLineLength <= 0) throw new IllegalArgumentException("maxLineLength: "+maxLineLength);
+		this.listener = listener;
+		this.maxLineLength = maxLineLength;
+	}
+
+	/**
+	 * The listener of the events.
+	 */
+	private final USseListener listener;
+
+	/**
+	 * The maximal length of a line in bytes.
+	 */
+	private final int maxLineLength;
+
+	/**
+	 * The bytes of the current line.
+	 */
+	private byte[] line = new byte[128];
+
+	/**
+	 * The amount of bytes in the current line.
+	 */
+	private int length;
+
+	/**
+	 * True if the last byte was a CR, so that a following LF is skipped.
+	 */
+	private boolean cr;
+
+	/**
+	 * True until the first line was parsed, to skip a byte order mark.
+	 */
+	private boolean first = true;
+
+	/**
+	 * The data of the current event or null, if the event has no data yet.
+	 */
+	private StringBuilder data;
+
+	/**
+	 * The type of the current event or null.
+	 */
+	private String event;
+
+	/**
+	 * The last event id.
+	 */
+	private String lastEventId;
+
+	/**
+	 * The last reconnection time in milliseconds or -1.
+	 */
+	private long retry = -1L;
+
+	/**
+	 * Returns the last event id received.
+	 * @return
+	 * the last event id or null, if none was received or it was reset by an empty id.
+	 */
+	public String lastEventId() {
+		return lastEventId!=null && !lastEventId.isEmpty() ? lastEventId : null;
+	}
+
+	/**
+	 * Returns the last reconnection time received.
+	 * @return
+	 * the time in milliseconds or -1, if none was received.
+	 */
+	public long retry() {
+		return retry;
+	}
+
+	/**
+	 * Parses the given part of the stream.
+	 * @param bytes
+	 * the bytes.
+	 * @throws Exception
+	 * if a line is too long or the listener failed.
+	 */
+	public void feed( final byte[] bytes ) throws Exception {
+		feed(bytes, 0, bytes.length);
+	}
+
+	/**
+	 * Parses the given part of the stream.
+	 * @param bytes
+	 * the bytes.
+	 * @param off
+	 * the offset of the first byte.
+	 * @param len
+	 * the amount of bytes.
+	 * @throws UTooLongFrameException
+	 * if a line is too long, the remainder of the line is parsed as new line.
+	 * @throws Exception
+	 * if the listener failed.
+	 */
+	public void feed( final byte[] bytes, final int off, final int len ) throws Exception {
+		if (off < 0 || len < 0 || off + len > bytes.length) throw new IndexOutOfBoundsException();
+		final int end = off + len;
+		for (int i=off; i < end; i++) {
+			final byte b = bytes[i];
+			if (b=='\n' && cr) {
+				cr = false;
+				continue;
+			}
+			cr = b=='\r';
+			if (b=='\r' || b=='\n') {
+				final String text = new String(line, 0, length, StandardCharsets.UTF_8);
+				length = 0;
+				line(text);
+				continue;
+			}
+			if (length==maxLineLength) {
+				length = 0;
+				throw new UTooLongFrameException("Line length exceeds "+maxLineLength);
+			}
+			if (length==line.length) line = Arrays.copyOf(line, Math.min(line.length << 1, maxLineLength));
+			line[length++] = b;
+		}
+	}
+
+	/**
+	 * Discards the incomplete line and event, so that the parser can be used for the next connection. The last event
+	 * id and the reconnection time are kept.
+	 */
+	public void reset() {
+		length = 0;
+		cr = false;
+		first = true;
+		data = null;
+		event = null;
+	}
+
+	/**
+	 * Processes a complete line.
+	 */
+	private void line( String text ) throws Exception {
+		if (first) {
+			first = false;
+			if (!text.isEmpty() && text.charAt(0)=='\uFEFF') text = text.substring(1);
+		}
+		if (text.isEmpty()) {
+			dispatch();
+			return;
+		}
+		if (text.charAt(0)==':') return;
+		final int colon = text.indexOf(':');
+		final String field;
+		String value;
+		if (colon < 0) {
+			field = text;
+			value = "";
+		} else {
+			field = text.substring(0, colon);
+			value = text.substring(colon + 1);
+			if (value.startsWith(" ")) value = value.substring(1);
+		}
+		switch (field) {
+			case "event":
+				event = value;
+				break;
+			case "data":
+				if (data==null) {
+					data = new StringBuilder(value);
+				} else {
+					data.append('\n').append(value);
+				}
+				break;
+			case "id":
+				if (value.indexOf('\0') < 0) lastEventId = value;
+				break;
+			case "retry":
+				if (!value.isEmpty() && value.length() < 19 && isDigits(value)) retry = Long.parseLong(value);
+				break;
+			default:
+				// unknown fields are ignored
+		}
+	}
+
+	/**
+	 * Dispatches the current event, if it has data.
+	 */
+	private void dispatch() throws Exception {
+		final StringBuilder data = this.data;
+		final String event = this.event;
+		this.data = null;
+		this.event = null;
+		if (data==null) return;
+		final USseEvent e = new USseEvent(data.toString()).setId(lastEventId());
+		if (event!=null && !event.isEmpty()) e.setEvent(event);
+		listener.onEvent(e);
+	}
+
+	/**
+	 * Returns true if the given text consists only of ASCII digits.
+	 */
+	private static boolean isDigits( final String text ) {
+		for (int i=0; i < text.length(); i++) {
+			final char c = text.charAt(i);
+			if (c < '0' || c > '9') return false;
+		}
+		return true;
+	}
+}
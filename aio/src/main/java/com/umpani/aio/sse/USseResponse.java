@@ -0,0 +1,76 @@
+package com.umpani.aio.sse;
+
+import com.umpani.aio.http.UHttpHeaders;
+import com.umpani.aio.http.UHttpResponse;
+import com.umpani.aio.http.UHttpStream;
+import com.umpani.aio.http.UHttpStreamer;
+
+/**
+ * A response that opens a stream of server-sent events, returned by an {@link com.umpani.aio.http.UHttpHandler}.
+ * Once the header was written, the {@link USseHandler} is invoked with the {@link USseStream} to send the events to.
+ * The stream keeps the connection busy until it is closed, a client that reconnects sends the id of the last event it
+ * received, see {@link USseStream#lastEventId()}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class USseResponse extends UHttpResponse {
+	/**
+	 * The media type of an event stream.
+	 */
+	public static final String TEXT_EVENT_STREAM = "text/event-stream";
+
+	/**
+	 * The name of the header that carries the id of the last received event.
+	 */
+	public static final String LAST_EVENT_ID = "Last-Event-ID";
+
+	/**
+	 * The default interval of the heartbeats in milliseconds.
+	 */
+	public static final long DEFAULT_HEARTBEAT = 15000L;
+
+	/**
+	 * Create a new event stream response with status 200.
+	 * @param handler
+	 * the handler that sends the events.
+	 */
+	public USseResponse( final USseHandler handler ) {
+		super(200);
+		headers().set(UHttpHeaders.CONTENT_TYPE, TEXT_EVENT_STREAM+"; charset=utf-8");
+		headers().set(UHttpHeaders.CACHE_CONTROL, "no-cache");
+		setStreamer(new UHttpStreamer() {
+			@Override
+			public void stream( final UHttpStream stream ) throws Exception {
+				final USseStream sse = new USseStream(stream, heartbeat);
+				sse.start();
+				handler.open(sse);
+			}
+		});
+	}
+
+	/**
+	 * The interval of the heartbeats in milliseconds.
+	 */
+	private volatile long heartbeat = DEFAULT_HEARTBEAT;
+
+	/**
+	 * Returns the interval of the heartbeats.
+	 * @return
+	 * the interval in milliseconds, zero if no heartbeats are sent.
+	 */
+	public long heartbeat() {
+		return heartbeat;
+	}
+
+	/**
+	 * Sets the interval in which a comment is sent while no event is sent.
+	 * @param millis
+	 * the interval in milliseconds, zero or less to not send heartbeats.
+	 * @return
+	 * this.
+	 */
+	public USseResponse setHeartbeat( final long millis ) {
+		this.heartbeat = Math.max(0L, millis);
+		return this;
+	}
+}
@@ -0,0 +1,211 @@
+package com.umpani.aio.sse;
+
+import java.nio.channels.ClosedChannelException;
+import java.util.concurrent.TimeUnit;
+
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UEventLoop;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.UTimeout;
+import com.umpani.aio.http.UHttpRequest;
+import com.umpani.aio.http.UHttpStream;
+
+/**
+ * An open event stream, passed to the {@link USseHandler} of an {@link USseResponse}. All methods may be called from
+ * any thread. While no event is sent, a comment is sent as heartbeat in the interval of the response, so that proxies
+ * and clients do not drop the idle connection. The heartbeats are driven by the timer wheel of the event loop of the
+ * connection.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class USseStream {
+	/**
+	 * Create a new stream.
+	 * @param stream
+	 * the body of the response.
+	 * @param heartbeat
+	 * the interval of the heartbeats in milliseconds, zero or less to not send heartbeats.
+	 */
+	USseStream( final UHttpStream stream, final long heartbeat ) {
+		this.stream = stream;
+		this.heartbeat = heartbeat;
+	}
+
+	/**
+	 * The body of the response.
+	 */
+	private final UHttpStream stream;
+
+	/**
+	 * The interval of the heartbeats in milliseconds.
+	 */
+	private final long heartbeat;
+
+	/**
+	 * The pending heartbeat or null, only used by the event loop.
+	 */
+	private UTimeout timeout;
+
+	/**
+	 * True if something was sent since the last heartbeat.
+	 */
+	private volatile boolean sent;
+
+	/**
+	 * Starts the heartbeats, called by the event loop of the connection.
+	 */
+	void start() {
+		channel().closeFuture().addListener(new UFutureListener<Void>() {
+			@Override
+			public void complete( final UFuture<Void> future ) {
+				stopHeartbeat();
+			}
+		}, channel().loop());
+		scheduleHeartbeat();
+	}
+
+	/**
+	 * Returns the request that opened the stream.
+	 * @return
+	 * the request.
+	 */
+	public UHttpRequest request() {
+		return stream.request();
+	}
+
+	/**
+	 * Returns the id of the last event the client received, sent when it reconnects.
+	 * @return
+	 * the value of the <tt>Last-Event-ID</tt> header or null.
+	 */
+	public String lastEventId() {
+		final String id = stream.request().headers().get(USseResponse.LAST_EVENT_ID);
+		return id!=null && !id.isEmpty() ? id : null;
+	}
+
+	/**
+	 * Returns the channel of the connection.
+	 * @return
+	 * the channel.
+	 */
+	public UChannel channel() {
+		return stream.channel();
+	}
+
+	/**
+	 * Returns true while events can be sent, until the stream is closed or the client disconnected.
+	 * @return
+	 * true while the stream is open.
+	 */
+	public boolean isOpen() {
+		return !stream.isEnded() && channel().isActive();
+	}
+
+	/**
+	 * Returns the future that is completed once the client disconnected.
+	 * @return
+	 * the close future of the channel.
+	 */
+	public UFuture<Void> closeFuture() {
+		return channel().closeFuture();
+	}
+
+	/**
+	 * Sends an event.
+	 * @param event
+	 * the event.
+	 * @return
+	 * the future that is completed once the event was written, it fails if the stream is not open.
+	 */
+	public UFuture<Void> send( final USseEvent event ) {
+		return write(event.encode());
+	}
+
+	/**
+	 * Sends an event with the given value serialized as JSON as data.
+	 * @param value
+	 * the value, usually an {@link com.umpani.util.UMap}.
+	 * @return
+	 * the future that is completed once the event was written, it fails if the stream is not open.
+	 */
+	public UFuture<Void> sendJson( final Object value ) {
+		return send(USseEvent.json(value));
+	}
+
+	/**
+	 * Sends a comment, which is ignored by clients.
+	 * @param text
+	 * the text of the comment, every line is sent as separate comment.
+	 * @return
+	 * the future that is completed once the comment was written, it fails if the stream is not open.
+	 */
+	public UFuture<Void> comment( final String text ) {
+		final StringBuilder sb = new StringBuilder();
+		for (final String line : text.split("\r\n|\r|\n", -1)) sb.append(':').append(line.isEmpty() ? "" : " ").append(line).append('\n');
+		return write(sb.append('\n').toString());
+	}
+
+	/**
+	 * Ends the stream, the connection stays open for further requests. Further calls are ignored.
+	 * @return
+	 * the future that is completed once the end was written.
+	 */
+	public UFuture<Void> close() {
+		final UEventLoop loop = channel().loop();
+		if (loop.inEventLoop()) {
+			stopHeartbeat();
+		} else {
+			loop.execute(new Runnable() {
+				@Override
+				public void run() {
+					stopHeartbeat();
+				}
+			});
+		}
+		return stream.end();
+	}
+
+	/**
+	 * Writes the given text if the stream is open.
+	 */
+	private UFuture<Void> write( final String text ) {
+		if (!isOpen()) return UFuture.failed(new ClosedChannelException());
+		sent = true;
+		try {
+			return stream.write(text);
+		} catch (IllegalStateException e) {
+			return UFuture.failed(new ClosedChannelException());
+		}
+	}
+
+	/**
+	 * Schedules the next heartbeat, called by the event loop.
+	 */
+	private void scheduleHeartbeat() {
+		if (heartbeat <= 0 || !isOpen()) return;
+		timeout = channel().loop().timers().schedule(new Runnable() {
+			@Override
+			public void run() {
+				timeout = null;
+				if (!isOpen()) return;
+				if (!sent) write(":\n\n");
+				sent = false;
+				scheduleHeartbeat();
+			}
+		}, heartbeat, TimeUnit.MILLISECONDS);
+	}
+
+	/**
+	 * Cancels the pending heartbeat, called by the event loop.
+	 */
+	private void stopHeartbeat() {
+		if (timeout!=null) timeout.cancel();
+		timeout = null;
+	}
+
+	@Override
+	public String toString() {
+		return "USseStream["+stream.request()+"]";
+	}
+}
@@ -0,0 +1,453 @@
+package com.umpani.aio.ssl;
+
+import java.io.File;
+import java.io.FileInputStream;
+import java.io.IOException;
+import java.io.InputStream;
+import java.lang.reflect.Method;
+import java.security.GeneralSecurityException;
+import java.security.KeyStore;
+import java.util.concurrent.Executor;
+
+import javax.net.ssl.KeyManager;
+import javax.net.ssl.KeyManagerFactory;
+import javax.net.ssl.SSLContext;
+import javax.net.ssl.SSLEngine;
+import javax.net.ssl.SSLParameters;
+import javax.net.ssl.TrustManager;
+import javax.net.ssl.TrustManagerFactory;
+
+/**
+ * The configuration of TLS connections, wraps a {@link SSLContext} and creates the {@link USslHandler} of every
+ * connection. A context is either a server or a client context, the options are read whenever a handler is created,
+ * so changing them affects only new connections.
+ *
+ * </p><p>Application protocol negotiation (ALPN) uses the API of the running JVM, which is available since Java 8u252.
+ * A server selects the first of its own protocols that the client offers.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class USslContext {
+	/**
+	 * The default handshake timeout in milliseconds.
+	 */
+	public static final long DEFAULT_HANDSHAKE_TIMEOUT = 10000L;
+
+	/**
+	 * Whether a server requests a certificate from its clients.
+	 */
+	public static enum ClientAuth {
+		/**
+		 * No client certificate is requested.
+		 */
+		NONE,
+		/**
+		 * A client certificate is requested, but the client may connect without.
+		 */
+		OPTIONAL,
+		/**
+		 * A client certificate is required.
+		 */
+		REQUIRE
+	}
+
+	/**
+	 * Create a new context.
+	 * @param context
+	 * the JSSE context.
+	 * @param client
+	 * true for a client context; false for a server context.
+	 */
+	public USslContext( final SSLContext context, final boolean client ) {
+		if (context==null) throw new NullPointerException("context");
+		this.context = context;
+		this.client = client;
+	}
+
+	/**
+	 * The JSSE context.
+	 */
+	private final SSLContext context;
+
+	/**
+	 * True for a client context.
+	 */
+	private final boolean client;
+
+	/**
+	 * The enabled protocols or null for the defaults.
+	 */
+	private volatile String[] protocols;
+
+	/**
+	 * The enabled cipher suites or null for the defaults.
+	 */
+	private volatile String[] cipherSuites;
+
+	/**
+	 * The application protocols in the order of preference or null.
+	 */
+	private volatile String[] applicationProtocols;
+
+	/**
+	 * Whether a server requests client certificates.
+	 */
+	private volatile ClientAuth clientAuth = ClientAuth.NONE;
+
+	/**
+	 * True if a client verifies that the certificate of the server matches the host name.
+	 */
+	private volatile boolean verifyHostname = true;
+
+	/**
+	 * The handshake timeout in milliseconds.
+	 */
+	private volatile long handshakeTimeout = DEFAULT_HANDSHAKE_TIMEOUT;
+
+	/**
+	 * The executor of delegated tasks or null for the default.
+	 */
+	private volatile Executor executor;
+
+	/**
+	 * Returns a server context with the key and certificate of the given key store.
+	 * @param keyStore
+	 * the key store with the private key and the certificate chain of the server.
+	 * @param password
+	 * the password of the key.
+	 * @return
+	 * the server context.
+	 * @throws GeneralSecurityException
+	 * if the key can't be read.
+	 */
+	public static USslContext forServer( final KeyStore keyStore, final char[] password ) throws GeneralSecurityException {
+		return forServer(keyStore, password, null);
+	}
+
+	/**
+	 * Returns a server context with the key and certificate of the given key store.
+	 * @param keyStore
+	 * the key store with the private key and the certificate chain of the server.
+	 * @param password
+	 * the password of the key.
+	 * @param trustStore
+	 * the certificates trusted to verify client certificates or null, to use the default trust store.
+	 * @return
+	 * the server context.
+	 * @throws GeneralSecurityException
+	 * if the key can't be read.
+	 */
+	public static USslContext forServer( final KeyStore keyStore, final char[] password, final KeyStore trustStore ) throws GeneralSecurityException {
+		return new USslContext(newContext(keyManagers(keyStore, password), trustManagers(trustStore)), false);
+	}
+
+	/**
+	 * Returns a client context that uses the default trust store of the JVM.
+	 * @return
+	 * the client context.
+	 * @throws GeneralSecurityException
+	 * if the default context is not available.
+	 */
+	public static USslContext forClient() throws GeneralSecurityException {
+		return new USslContext(SSLContext.getDefault(), true);
+	}
+
+	/**
+	 * Returns a client context that trusts the certificates of the given trust store.
+	 * @param trustStore
+	 * the trusted certificates or null, to use the default trust store.
+	 * @return
+	 * the client context.
+	 * @throws GeneralSecurityException
+	 * if the trust store can't be read.
+	 */
+	public static USslContext forClient( final KeyStore trustStore ) throws GeneralSecurityException {
+		return forClient(trustStore, null, null);
+	}
+
+	/**
+	 * Returns a client context that authenticates with a client certificate.
+	 * @param trustStore
+	 * the trusted certificates or null, to use the default trust store.
+	 * @param keyStore
+	 * the key store with the private key and the certificate chain of the client or null.
+	 * @param password
+	 * the password of the key.
+	 * @return
+	 * the client context.
+	 * @throws GeneralSecurityException
+	 * if a store can't be read.
+	 */
+	public static USslContext forClient( final KeyStore trustStore, final KeyStore keyStore, final char[] password ) throws GeneralSecurityException {
+		return new USslContext(newContext(keyStore!=null ? keyManagers(keyStore, password) : null, trustManagers(trustStore)), true);
+	}
+
+	/**
+	 * Loads a key store from a file, files ending with <tt>.p12</tt> or <tt>.pfx</tt> are read as PKCS12, all others
+	 * with the default type of the JVM.
+	 * @param file
+	 * the file.
+	 * @param password
+	 * the password of the store or null.
+	 * @return
+	 * the key store.
+	 * @throws IOException
+	 * if the file can't be read.
+	 * @throws GeneralSecurityException
+	 * if the store is invalid.
+	 */
+	public static KeyStore loadKeyStore( final File file, final char[] password ) throws IOException, GeneralSecurityException {
+		final String name = file.getName().toLowerCase();
+		final String type = name.endsWith(".p12") || name.endsWith(".pfx") ? "PKCS12" : KeyStore.getDefaultType();
+		try (InputStream in = new FileInputStream(file)) {
+			final KeyStore keyStore = KeyStore.getInstance(type);
+			keyStore.load(in, password);
+			return keyStore;
+		}
+	}
+
+	/**
+	 * Returns true if the running JVM supports application protocol negotiation.
+	 * @return
+	 * true if ALPN is supported.
+	 */
+	public static boolean isAlpnSupported() {
+		return SET_APPLICATION_PROTOCOLS!=null && GET_APPLICATION_PROTOCOL!=null;
+	}
+
+	/**
+	 * Returns the JSSE context.
+	 * @return
+	 * the JSSE context.
+	 */
+	public SSLContext context() {
+		return context;
+	}
+
+	/**
+	 * Returns true for a client context.
+	 * @return
+	 * true for a client context; false for a server context.
+	 */
+	public boolean isClient() {
+		return client;
+	}
+
+	/**
+	 * Sets the enabled protocols, like <tt>TLSv1.2</tt>.
+	 * @param protocols
+	 * the protocols or null for the defaults of the JVM.
+	 * @return
+	 * this.
+	 */
+	public USslContext setProtocols( final String... protocols ) {
+		this.protocols = protocols!=null ? protocols.clone() : null;
+		return this;
+	}
+
+	/**
+	 * Sets the enabled cipher suites.
+	 * @param cipherSuites
+	 * the cipher suites or null for the defaults of the JVM.
+	 * @return
+	 * this.
+	 */
+	public USslContext setCipherSuites( final String... cipherSuites ) {
+		this.cipherSuites = cipherSuites!=null ? cipherSuites.clone() : null;
+		return this;
+	}
+
+	/**
+	 * Sets the application protocols negotiated with ALPN, like <tt>h2</tt> and <tt>http/1.1</tt>.
+	 * @param protocols
+	 * the protocols in the order of preference or null, to not negotiate.
+	 * @return
+	 * this.
+	 * @throws UnsupportedOperationException
+	 * if the JVM does not support ALPN.
+	 */
+	public USslContext setApplicationProtocols( final String... protocols ) {
+		if (protocols!=null && !isAlpnSupported()) throw new UnsupportedOperationException("ALPN is not supported by this JVM");
+		this.applicationProtocols = protocols!=null && protocols.length > 0 ? protocols.clone() : null;
+		return this;
+	}
+
+	/**
+	 * Sets whether a server requests client certificates.
+	 * @param clientAuth
+	 * the client authentication.
+	 * @return
+	 * this.
+	 */
+	public USslContext setClientAuth( final ClientAuth clientAuth ) {
+		if (clientAuth==null) throw new NullPointerException("clientAuth");
+		this.clientAuth = clientAuth;
+		return this;
+	}
+
+	/**
+	 * Sets whether a client verifies that the certificate of the server matches the host name it connects to, which
+	 * is enabled by default.
+	 * @param verifyHostname
+	 * true to verify the host name.
+	 * @return
+	 * this.
+	 */
+	public USslContext setVerifyHostname( final boolean verifyHostname ) {
+		this.verifyHostname = verifyHostname;
+		return this;
+	}
+
+	/**
+	 * Sets the time after which a connection is closed, if the handshake did not complete.
+	 * @param millis
+	 * the time in milliseconds, zero or less for no timeout.
+	 * @return
+	 * this.
+	 */
+	public USslContext setHandshakeTimeout( final long millis ) {
+		this.handshakeTimeout = Math.max(0L, millis);
+		return this;
+	}
+
+	/**
+	 * Sets the executor that runs the delegated tasks of the engines, like certificate validation and key exchange,
+	 * so that they do not block the event loops.
+	 * @param executor
+	 * the executor or null for a shared pool of daemon threads.
+	 * @return
+	 * this.
+	 */
+	public USslContext setExecutor( final Executor executor ) {
+		this.executor = executor;
+		return this;
+	}
+
+	/**
+	 * Creates a configured engine.
+	 * @param host
+	 * the host name of the peer or null; a client uses it for server name indication and host name verification.
+	 * @param port
+	 * the port of the peer or -1.
+	 * @return
+	 * the engine.
+	 */
+	public SSLEngine newEngine( final String host, final int port ) {
+		final SSLEngine engine = host!=null ? context.createSSLEngine(host, port) : context.createSSLEngine();
+		engine.setUseClientMode(client);
+		final String[] protocols = this.protocols;
+		if (protocols!=null) engine.setEnabledProtocols(protocols);
+		final String[] cipherSuites = this.cipherSuites;
+		if (cipherSuites!=null) engine.setEnabledCipherSuites(cipherSuites);
+		final SSLParameters parameters = engine.getSSLParameters();
+		if (client) {
+			if (verifyHostname && host!=null) parameters.setEndpointIdentificationAlgorithm("HTTPS");
+		} else
+		if (clientAuth==ClientAuth.REQUIRE) {
+			parameters.setNeedClientAuth(true);
+		} else
+		if (clientAuth==ClientAuth.OPTIONAL) {
+			parameters.setWantClientAuth(true);
+		}
+		final String[] applicationProtocols = this.applicationProtocols;
+		if (applicationProtocols!=null) invoke(SET_APPLICATION_PROTOCOLS, parameters, (Object)applicationProtocols);
+		engine.setSSLParameters(parameters);
+		return engine;
+	}
+
+	/**
+	 * Creates the handler of a server connection.
+	 * @return
+	 * the handler, which must be the first handler of the pipeline.
+	 */
+	public USslHandler newHandler() {
+		return newHandler(null, -1);
+	}
+
+	/**
+	 * Creates the handler of a connection.
+	 * @param host
+	 * the host name of the peer or null; a client uses it for server name indication and host name verification.
+	 * @param port
+	 * the port of the peer or -1.
+	 * @return
+	 * the handler, which must be the first handler of the pipeline.
+	 */
+	public USslHandler newHandler( final String host, final int port ) {
+		return new USslHandler(newEngine(host, port), executor, handshakeTimeout);
+	}
+
+	@Override
+	public String toString() {
+		return "USslContext["+(client ? "client" : "server")+", "+context.getProtocol()+"]";
+	}
+
+	/**
+	 * Returns the negotiated application protocol of the given engine.
+	 */
+	static String applicationProtocol( final SSLEngine engine ) {
+		if (GET_APPLICATION_PROTOCOL==null) return null;
+		final String protocol = (String)invoke(GET_APPLICATION_PROTOCOL, engine);
+		return protocol!=null && !protocol.isEmpty() ? protocol : null;
+	}
+
+	/**
+	 * <tt>SSLParameters.setApplicationProtocols(String[])</tt> or null, if not available.
+	 */
+	private static final Method SET_APPLICATION_PROTOCOLS = method(SSLParameters.class, "setApplicationProtocols", String[].class);
+
+	/**
+	 * <tt>SSLEngine.getApplicationProtocol()</tt> or null, if not available.
+	 */
+	private static final Method GET_APPLICATION_PROTOCOL = method(SSLEngine.class, "getApplicationProtocol");
+
+	/**
+	 * Returns the given public method or null, if it does not exist.
+	 */
+	private static Method method( final Class<?> type, final String name, final Class<?>... parameterTypes ) {
+		try {
+			return type.getMethod(name, parameterTypes);
+		} catch (NoSuchMethodException e) {
+			return null;
+		}
+	}
+
+	/**
+	 * Invokes the given method.
+	 */
+	private static Object invoke( final Method method, final Object target, final Object... args ) {
+		try {
+			return method.invoke(target, args);
+		} catch (ReflectiveOperationException e) {
+			throw new IllegalStateException("Failed to invoke "+method, e);
+		}
+	}
+
+	/**
+	 * Creates a TLS context.
+	 */
+	private static SSLContext newContext( final KeyManager[] keyManagers, final TrustManager[] trustManagers ) throws GeneralSecurityException {
+		final SSLContext context = SSLContext.getInstance("TLS");
+		context.init(keyManagers, trustManagers, null);
+		return context;
+	}
+
+	/**
+	 * Returns the key managers of the given key store.
+	 */
+	private static KeyManager[] keyManagers( final KeyStore keyStore, final char[] password ) throws GeneralSecurityException {
+		final KeyManagerFactory factory = KeyManagerFactory.getInstance(KeyManagerFactory.getDefaultAlgorithm());
+		factory.init(keyStore, password);
+		return factory.getKeyManagers();
+	}
+
+	/**
+	 * Returns the trust managers of the given trust store or null, to use the default trust store.
+	 */
+	private static TrustManager[] trustManagers( final KeyStore trustStore ) throws GeneralSecurityException {
+		if (trustStore==null) return null;
+		final TrustManagerFactory factory = TrustManagerFactory.getInstance(TrustManagerFactory.getDefaultAlgorithm());
+		factory.init(trustStore);
+		return factory.getTrustManagers();
+	}
+}
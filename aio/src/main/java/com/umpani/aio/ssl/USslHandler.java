@@ -0,0 +1,752 @@
+package com.umpani.aio.ssl;
+
+import java.io.IOException;
+import java.nio.ByteBuffer;
+import java.nio.channels.ClosedChannelException;
+import java.util.ArrayDeque;
+import java.util.ArrayList;
+import java.util.concurrent.Executor;
+import java.util.concurrent.ExecutorService;
+import java.util.concurrent.Executors;
+import java.util.concurrent.RejectedExecutionException;
+import java.util.concurrent.ThreadFactory;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicInteger;
+
+import javax.net.ssl.SSLEngine;
+import javax.net.ssl.SSLEngineResult;
+import javax.net.ssl.SSLEngineResult.HandshakeStatus;
+import javax.net.ssl.SSLEngineResult.Status;
+import javax.net.ssl.SSLException;
+import javax.net.ssl.SSLSession;
+
+import com.umpani.aio.UBuffer;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UCompositeBuffer;
+import com.umpani.aio.UFileRegion;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.UReferences;
+import com.umpani.aio.UTimeout;
+
+/**
+ * Encrypts a connection with a {@link SSLEngine}, must be the first handler of the pipeline. Received bytes are
+ * decrypted and passed as {@link UBuffer} to the next handler, written {@link UBuffer}s, {@link UCompositeBuffer}s,
+ * byte arrays and {@link ByteBuffer}s are encrypted. The handshake starts once the channel is active and is driven by
+ * the event loop, writes are held back until it completed. The delegated tasks of the engine, which may block for a
+ * while, are run by a worker executor and the handshake continues on the event loop once they are done.
+ *
+ * </p><p>The engine decrypts one record at a time, so bytes are cumulated until a record was received completely
+ * instead of retrying on a buffer underflow. If a record does not fit into the pooled buffer, a larger buffer is used.
+ * Closing the channel sends a close_notify alert first, a close_notify received from the peer is answered and closes
+ * the channel.
+ *
+ * </p><p>A written {@link UFileRegion} can't be transferred without copying, because it must be encrypted. Its bytes
+ * are read in chunks of the maximal record size and only while the channel is writable, so that a large file is not
+ * buffered completely.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class USslHandler extends UChannelHandlerAdapter {
+	/**
+	 * The length of the header of a TLS record.
+	 */
+	private static final int RECORD_HEADER_LENGTH = 5;
+
+	/**
+	 * An empty buffer to wrap handshake messages.
+	 */
+	private static final ByteBuffer EMPTY = ByteBuffer.allocate(0);
+
+	/**
+	 * The size of the chunks read from a file region, the maximal plaintext of a record.
+	 */
+	private static final int FILE_CHUNK_SIZE = 16 * 1024;
+
+	/**
+	 * Create a new handler that runs delegated tasks with a shared pool and has no handshake timeout.
+	 * @param engine
+	 * the configured engine.
+	 */
+	public USslHandler( final SSLEngine engine ) {
+		this(engine, null, 0L);
+	}
+
+	/**
+	 * Create a new handler.
+	 * @param engine
+	 * the configured engine.
+	 * @param executor
+	 * the executor of delegated tasks or null for a shared pool of daemon threads.
+	 * @param handshakeTimeout
+	 * the time in milliseconds after which the connection is closed, if the handshake did not complete; zero or less
+	 * for no timeout.
+	 */
+	public USslHandler( final SSLEngine engine, final Executor executor, final long handshakeTimeout ) {
+		if (engine==null) throw new NullPointerException("engine");
+		this.engine = engine;
+		this.executor = executor;
+		this.handshakeTimeout = handshakeTimeout;
+		final SSLSession session = engine.getSession();
+		this.packetBufferSize = session.getPacketBufferSize();
+		this.applicationBufferSize = session.getApplicationBufferSize();
+	}
+
+	/**
+	 * The engine.
+	 */
+	private final SSLEngine engine;
+
+	/**
+	 * The executor of delegated tasks or null.
+	 */
+	private final Executor executor;
+
+	/**
+	 * The handshake timeout in milliseconds.
+	 */
+	private final long handshakeTimeout;
+
+	/**
+	 * The promise of the handshake.
+	 */
+	private final UPromise<USslHandler> handshakePromise = new UPromise<USslHandler>(null);
+
+	/**
+	 * The received bytes that do not yet form a complete record.
+	 */
+	private UCompositeBuffer cumulation = new UCompositeBuffer();
+
+	/**
+	 * The writes held back until the handshake completed or until flushed.
+	 */
+	private final ArrayDeque<PendingWrite> pendingWrites = new ArrayDeque<>();
+
+	/**
+	 * The size of the buffers for encrypted records.
+	 */
+	private int packetBufferSize;
+
+	/**
+	 * The size of the buffers for decrypted data.
+	 */
+	private int applicationBufferSize;
+
+	/**
+	 * The context of this handler, once added.
+	 */
+	private UHandlerContext ctx;
+
+	/**
+	 * The pending handshake timeout or null.
+	 */
+	private UTimeout timeout;
+
+	/**
+	 * True once the handshake started.
+	 */
+	private boolean started;
+
+	/**
+	 * True while delegated tasks are running.
+	 */
+	private boolean taskRunning;
+
+	/**
+	 * True if a flush was requested before the handshake completed.
+	 */
+	private boolean flushRequested;
+
+	/**
+	 * True once decrypted data was passed on since the last read complete.
+	 */
+	private boolean readData;
+
+	/**
+	 * True if encrypting a file region was suspended until the channel becomes writable again.
+	 */
+	private boolean suspended;
+
+	/**
+	 * Returns the engine.
+	 * @return
+	 * the engine.
+	 */
+	public SSLEngine engine() {
+		return engine;
+	}
+
+	/**
+	 * Returns the future of the handshake.
+	 * @return
+	 * the future that is completed with this handler once the handshake succeeded.
+	 */
+	public UFuture<USslHandler> handshakeFuture() {
+		return handshakePromise;
+	}
+
+	/**
+	 * Returns the application protocol negotiated with ALPN.
+	 * @return
+	 * the protocol or null, if none was negotiated or the handshake did not yet complete.
+	 */
+	public String applicationProtocol() {
+		return USslContext.applicationProtocol(engine);
+	}
+
+	@Override
+	public void handlerAdded( final UHandlerContext ctx ) throws Exception {
+		this.ctx = ctx;
+		if (ctx.channel().isActive()) handshake(ctx);
+	}
+
+	@Override
+	public void handlerRemoved( final UHandlerContext ctx ) throws Exception {
+		cumulation.release();
+		cumulation = new UCompositeBuffer();
+		failPendingWrites(new ClosedChannelException());
+		cancelTimeout();
+	}
+
+	@Override
+	public void channelActive( final UHandlerContext ctx ) throws Exception {
+		ctx.fireChannelActive();
+		handshake(ctx);
+	}
+
+	@Override
+	public void channelInactive( final UHandlerContext ctx ) throws Exception {
+		try {
+			cancelTimeout();
+			failPendingWrites(new ClosedChannelException());
+			if (!handshakePromise.isDone()) handshakeFailed(ctx, new SSLException("Connection closed during the handshake"));
+			try {
+				engine.closeInbound();
+			} catch (SSLException e) {
+				// the peer did not send close_notify
+			}
+			engine.closeOutbound();
+		} finally {
+			cumulation.release();
+			cumulation = new UCompositeBuffer();
+			ctx.fireChannelInactive();
+		}
+	}
+
+	@Override
+	public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+		if (msg instanceof UBuffer) {
+			cumulation.add((UBuffer)msg);
+		} else
+		if (msg instanceof UCompositeBuffer) {
+			cumulation.add((UCompositeBuffer)msg);
+		} else {
+			ctx.fireChannelRead(msg);
+			return;
+		}
+		try {
+			unwrap(ctx);
+		} catch (SSLException e) {
+			fail(ctx, e);
+		}
+	}
+
+	@Override
+	public void channelReadComplete( final UHandlerContext ctx ) throws Exception {
+		if (!readData) return;
+		readData = false;
+		ctx.fireChannelReadComplete();
+	}
+
+	@Override
+	public void channelWritabilityChanged( final UHandlerContext ctx ) throws Exception {
+		if (suspended && ctx.channel().isWritable()) {
+			suspended = false;
+			try {
+				wrapPending(ctx);
+			} catch (SSLException e) {
+				fail(ctx, e);
+			}
+		}
+		ctx.fireChannelWritabilityChanged();
+	}
+
+	@Override
+	public void write( final UHandlerContext ctx, final Object msg, final UPromise<Void> promise ) throws Exception {
+		final ByteBuffer[] buffers;
+		if (msg instanceof UFileRegion) {
+			// filled with the chunks of the region while encrypting
+			final ByteBuffer chunk = ByteBuffer.allocate((int)Math.min(((UFileRegion)msg).remaining(), FILE_CHUNK_SIZE));
+			chunk.flip();
+			buffers = new ByteBuffer[] { chunk };
+		} else
+		if (msg instanceof UBuffer) {
+			buffers = new ByteBuffer[] { ((UBuffer)msg).nio() };
+		} else
+		if (msg instanceof UCompositeBuffer) {
+			buffers = ((UCompositeBuffer)msg).nioBuffers();
+		} else
+		if (msg instanceof byte[]) {
+			buffers = new ByteBuffer[] { ByteBuffer.wrap((byte[])msg) };
+		} else
+		if (msg instanceof ByteBuffer) {
+			buffers = new ByteBuffer[] { (ByteBuffer)msg };
+		} else {
+			UReferences.release(msg);
+			promise.fail(new IllegalArgumentException("Unsupported message type: "+(msg!=null ? msg.getClass().getName() : null)));
+			return;
+		}
+		if (engine.isOutboundDone()) {
+			UReferences.release(msg);
+			promise.fail(new ClosedChannelException());
+			return;
+		}
+		pendingWrites.add(new PendingWrite(msg, buffers, promise));
+	}
+
+	@Override
+	public void flush( final UHandlerContext ctx ) throws Exception {
+		if (!handshakePromise.isSuccess()) {
+			flushRequested = true;
+			return;
+		}
+		try {
+			wrapPending(ctx);
+		} catch (SSLException e) {
+			fail(ctx, e);
+		}
+	}
+
+	@Override
+	public void close( final UHandlerContext ctx, final UPromise<Void> promise ) throws Exception {
+		failPendingWrites(new ClosedChannelException());
+		if (!engine.isOutboundDone() && ctx.channel().isActive()) {
+			engine.closeOutbound();
+			try {
+				wrapHandshake(ctx);
+			} catch (SSLException e) {
+				// close anyway
+			}
+		}
+		ctx.close(promise);
+	}
+
+	/**
+	 * Starts the handshake.
+	 */
+	private void handshake( final UHandlerContext ctx ) {
+		if (started) return;
+		started = true;
+		if (handshakeTimeout > 0) {
+			timeout = ctx.loop().timers().schedule(new Runnable() {
+				@Override
+				public void run() {
+					timeout = null;
+					if (!handshakePromise.isDone()) fail(ctx, new SSLException("Handshake timed out"));
+				}
+			}, handshakeTimeout, TimeUnit.MILLISECONDS);
+		}
+		try {
+			engine.beginHandshake();
+			process(ctx, engine.getHandshakeStatus());
+		} catch (SSLException e) {
+			fail(ctx, e);
+		}
+	}
+
+	/**
+	 * Decrypts all complete records.
+	 */
+	private void unwrap( final UHandlerContext ctx ) throws SSLException {
+		final UCompositeBuffer in = cumulation;
+		while (!taskRunning && !ctx.isRemoved() && !engine.isInboundDone()) {
+			final int readable = in.readableBytes();
+			if (readable < RECORD_HEADER_LENGTH) return;
+			final int type = in.getUnsignedByte(0);
+			if (type < 20 || type > 24 || in.getUnsignedByte(1)!=3) throw new SSLException("Not an SSL/TLS record");
+			final int length = RECORD_HEADER_LENGTH + in.getUnsignedShort(3);
+			// an underflow, wait for the rest of the record
+			if (readable < length) return;
+			if (length > packetBufferSize) packetBufferSize = length;
+			final UBuffer record = in.readBuffer(length, ctx.alloc());
+			try {
+				unwrapRecord(ctx, record.nio());
+			} finally {
+				record.release();
+			}
+		}
+	}
+
+	/**
+	 * Decrypts one record, the engine consumes it completely.
+	 */
+	private void unwrapRecord( final UHandlerContext ctx, final ByteBuffer record ) throws SSLException {
+		while (true) {
+			final UBuffer out = ctx.alloc().allocate(applicationBufferSize);
+			final SSLEngineResult result;
+			try {
+				result = engine.unwrap(record, out.nio());
+			} catch (SSLException e) {
+				out.release();
+				throw e;
+			}
+			final Status status = result.getStatus();
+			if (status==Status.BUFFER_OVERFLOW) {
+				out.release();
+				applicationBufferSize = grow(applicationBufferSize, engine.getSession().getApplicationBufferSize());
+				continue;
+			}
+			if (result.bytesProduced() > 0) {
+				out.nio().flip();
+				readData = true;
+				ctx.fireChannelRead(out);
+			} else {
+				out.release();
+			}
+			if (status==Status.BUFFER_UNDERFLOW) throw new SSLException("Truncated record");
+			if (status==Status.CLOSED) {
+				closeNotifyReceived(ctx);
+				return;
+			}
+			if (!process(ctx, result.getHandshakeStatus())) return;
+			if (!record.hasRemaining()) return;
+		}
+	}
+
+	/**
+	 * Continues the handshake according to the given status.
+	 * @return
+	 * true if reading may continue; false if delegated tasks are running.
+	 */
+	private boolean process( final UHandlerContext ctx, HandshakeStatus status ) throws SSLException {
+		while (true) {
+			switch (status) {
+				case NEED_TASK:
+					runTasks(ctx);
+					return false;
+				case NEED_WRAP:
+					status = wrapHandshake(ctx);
+					break;
+				case FINISHED:
+					handshakeSucceeded(ctx);
+					return true;
+				case NOT_HANDSHAKING:
+					// some engines do not report FINISHED for the last step
+					if (started && !handshakePromise.isDone()) handshakeSucceeded(ctx);
+					return true;
+				default:
+					// NEED_UNWRAP, wait for the next record
+					return true;
+			}
+		}
+	}
+
+	/**
+	 * Wraps handshake and alert messages and flushes them.
+	 * @return
+	 * the handshake status after wrapping.
+	 */
+	private HandshakeStatus wrapHandshake( final UHandlerContext ctx ) throws SSLException {
+		while (true) {
+			final UBuffer out = ctx.alloc().allocate(packetBufferSize);
+			final SSLEngineResult result;
+			try {
+				result = engine.wrap(EMPTY, out.nio());
+			} catch (SSLException e) {
+				out.release();
+				throw e;
+			}
+			if (result.getStatus()==Status.BUFFER_OVERFLOW) {
+				out.release();
+				packetBufferSize = grow(packetBufferSize, engine.getSession().getPacketBufferSize());
+				continue;
+			}
+			if (result.bytesProduced() > 0) {
+				out.nio().flip();
+				ctx.write(out);
+				ctx.flush();
+			} else {
+				out.release();
+			}
+			// once closed, nothing more is wrapped
+			if (result.getStatus()==Status.CLOSED && result.getHandshakeStatus()==HandshakeStatus.NEED_WRAP) return HandshakeStatus.NOT_HANDSHAKING;
+			return result.getHandshakeStatus();
+		}
+	}
+
+	/**
+	 * Encrypts the held back writes and flushes them.
+	 */
+	private void wrapPending( final UHandlerContext ctx ) throws SSLException {
+		PendingWrite write;
+		while ((write = pendingWrites.peekFirst())!=null && !taskRunning) {
+			final ByteBuffer[] src = write.buffers;
+			for (;;) {
+				if (!hasRemaining(src)) {
+					if (!write.hasRemaining()) break;
+					if (!ctx.channel().isWritable()) {
+						suspended = true;
+						break;
+					}
+					try {
+						write.readChunk();
+					} catch (IOException e) {
+						fail(ctx, e);
+						return;
+					}
+				}
+				final UBuffer out = ctx.alloc().allocate(packetBufferSize);
+				final SSLEngineResult result;
+				try {
+					result = engine.wrap(src, out.nio());
+				} catch (SSLException e) {
+					out.release();
+					throw e;
+				}
+				final Status status = result.getStatus();
+				if (status==Status.BUFFER_OVERFLOW) {
+					out.release();
+					packetBufferSize = grow(packetBufferSize, engine.getSession().getPacketBufferSize());
+					continue;
+				}
+				if (status==Status.CLOSED) {
+					out.release();
+					failPendingWrites(new ClosedChannelException());
+					ctx.flush();
+					return;
+				}
+				if (result.bytesProduced() > 0) {
+					out.nio().flip();
+					ctx.write(out, write.hasRemaining() ? ctx.newPromise() : write.promise);
+				} else {
+					out.release();
+				}
+				// a renegotiation or key update
+				final HandshakeStatus handshakeStatus = result.getHandshakeStatus();
+				if (handshakeStatus!=HandshakeStatus.NOT_HANDSHAKING && handshakeStatus!=HandshakeStatus.FINISHED && !process(ctx, handshakeStatus)) break;
+			}
+			if (write.hasRemaining()) break;
+			pendingWrites.pollFirst();
+			UReferences.release(write.msg);
+			// an empty message did not produce a record
+			if (!write.promise.isDone()) write.promise.complete(null);
+		}
+		ctx.flush();
+	}
+
+	/**
+	 * Runs the delegated tasks with the executor and continues the handshake afterwards.
+	 */
+	private void runTasks( final UHandlerContext ctx ) {
+		final ArrayList<Runnable> tasks = new ArrayList<>();
+		Runnable task;
+		while ((task = engine.getDelegatedTask())!=null) tasks.add(task);
+		taskRunning = true;
+		final Runnable runner = new Runnable() {
+			@Override
+			public void run() {
+				Throwable failure = null;
+				try {
+					for (final Runnable task : tasks) task.run();
+				} catch (Throwable t) {
+					failure = t;
+				}
+				final Throwable cause = failure;
+				try {
+					ctx.loop().execute(new Runnable() {
+						@Override
+						public void run() {
+							taskRunning = false;
+							if (cause!=null) {
+								fail(ctx, cause);
+							} else {
+								resume(ctx);
+							}
+						}
+					});
+				} catch (RejectedExecutionException e) {
+					// the loop terminates and closes the channel
+				}
+			}
+		};
+		try {
+			(executor!=null ? executor : DefaultExecutor.INSTANCE).execute(runner);
+		} catch (RejectedExecutionException e) {
+			taskRunning = false;
+			fail(ctx, e);
+		}
+	}
+
+	/**
+	 * Continues after the delegated tasks ran.
+	 */
+	private void resume( final UHandlerContext ctx ) {
+		if (ctx.isRemoved() || !ctx.channel().isOpen()) return;
+		try {
+			if (!process(ctx, engine.getHandshakeStatus())) return;
+			unwrap(ctx);
+			if (handshakePromise.isSuccess() && !taskRunning && !pendingWrites.isEmpty()) wrapPending(ctx);
+		} catch (SSLException e) {
+			fail(ctx, e);
+			return;
+		}
+		if (readData) {
+			readData = false;
+			ctx.fireChannelReadComplete();
+		}
+	}
+
+	/**
+	 * Completes the handshake and writes what was held back.
+	 */
+	private void handshakeSucceeded( final UHandlerContext ctx ) throws SSLException {
+		if (handshakePromise.isDone()) return;
+		cancelTimeout();
+		handshakePromise.complete(this);
+		ctx.fireUserEvent(USslHandshakeEvent.SUCCESS);
+		if (flushRequested) {
+			flushRequested = false;
+			wrapPending(ctx);
+		}
+	}
+
+	/**
+	 * Fails the handshake.
+	 */
+	private void handshakeFailed( final UHandlerContext ctx, final Throwable cause ) {
+		cancelTimeout();
+		if (handshakePromise.fail(cause)) ctx.fireUserEvent(new USslHandshakeEvent(cause));
+	}
+
+	/**
+	 * Answers a received close_notify and closes the channel.
+	 */
+	private void closeNotifyReceived( final UHandlerContext ctx ) throws SSLException {
+		if (!handshakePromise.isDone()) handshakeFailed(ctx, new SSLException("Connection closed during the handshake"));
+		if (!engine.isOutboundDone()) {
+			engine.closeOutbound();
+			wrapHandshake(ctx);
+		}
+		ctx.close();
+	}
+
+	/**
+	 * Sends the alert of the engine, if any, passes the cause to the next handler and closes the channel.
+	 */
+	private void fail( final UHandlerContext ctx, final Throwable cause ) {
+		taskRunning = false;
+		handshakeFailed(ctx, cause);
+		failPendingWrites(cause);
+		if (!engine.isOutboundDone()) {
+			engine.closeOutbound();
+			try {
+				wrapHandshake(ctx);
+			} catch (Throwable t) {
+				// the alert is optional
+			}
+		}
+		ctx.fireExceptionCaught(cause);
+		ctx.close();
+	}
+
+	/**
+	 * Fails all held back writes.
+	 */
+	private void failPendingWrites( final Throwable cause ) {
+		PendingWrite write;
+		while ((write = pendingWrites.pollFirst())!=null) {
+			UReferences.release(write.msg);
+			write.promise.fail(cause);
+		}
+	}
+
+	/**
+	 * Cancels the handshake timeout.
+	 */
+	private void cancelTimeout() {
+		if (timeout!=null) timeout.cancel();
+		timeout = null;
+	}
+
+	/**
+	 * Returns the size of the next buffer after an overflow.
+	 */
+	private static int grow( final int size, final int required ) {
+		return required > size ? required : size << 1;
+	}
+
+	/**
+	 * Returns true if any of the given buffers has remaining bytes.
+	 */
+	private static boolean hasRemaining( final ByteBuffer[] buffers ) {
+		for (final ByteBuffer buffer : buffers) {
+			if (buffer.hasRemaining()) return true;
+		}
+		return false;
+	}
+
+	@Override
+	public String toString() {
+		return "USslHandler["+(engine.getUseClientMode() ? "client" : "server")+", "+engine.getSession().getProtocol()+"]";
+	}
+
+	/**
+	 * A held back write.
+	 */
+	private static final class PendingWrite {
+		PendingWrite( final Object msg, final ByteBuffer[] buffers, final UPromise<Void> promise ) {
+			this.msg = msg;
+			this.buffers = buffers;
+			this.promise = promise;
+		}
+
+		/**
+		 * The message, released once encrypted.
+		 */
+		final Object msg;
+
+		/**
+		 * The bytes of the message.
+		 */
+		final ByteBuffer[] buffers;
+
+		/**
+		 * The promise of the write.
+		 */
+		final UPromise<Void> promise;
+
+		/**
+		 * Returns true if bytes of the message are not yet encrypted.
+		 */
+		boolean hasRemaining() {
+			return USslHandler.hasRemaining(buffers) || msg instanceof UFileRegion && ((UFileRegion)msg).remaining() > 0;
+		}
+
+		/**
+		 * Reads the next chunk of a file region into the buffer.
+		 */
+		void readChunk() throws IOException {
+			final ByteBuffer chunk = buffers[0];
+			chunk.clear();
+			((UFileRegion)msg).read(chunk);
+			chunk.flip();
+		}
+	}
+
+	/**
+	 * The shared pool of daemon threads that runs delegated tasks, if no executor is configured.
+	 */
+	private static final class DefaultExecutor {
+		static final ExecutorService INSTANCE = Executors.newCachedThreadPool(new ThreadFactory() {
+			private final AtomicInteger count = new AtomicInteger();
+
+			@Override
+			public Thread newThread( final Runnable r ) {
+				final Thread thread = new Thread(r, "ssl-task-"+count.incrementAndGet());
+				thread.setDaemon(true);
+				return thread;
+			}
+		});
+	}
+}
@@ -0,0 +1,50 @@
+package com.umpani.aio.ssl;
+
+/**
+ * The user event fired by an {@link USslHandler} once the handshake completed or failed.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class USslHandshakeEvent {
+	/**
+	 * The event of a successful handshake.
+	 */
+	public static final USslHandshakeEvent SUCCESS = new USslHandshakeEvent(null);
+
+	/**
+	 * Create a new event.
+	 * @param cause
+	 * the cause of the failure or null, if the handshake succeeded.
+	 */
+	public USslHandshakeEvent( final Throwable cause ) {
+		this.cause = cause;
+	}
+
+	/**
+	 * The cause of the failure or null.
+	 */
+	private final Throwable cause;
+
+	/**
+	 * Returns true if the handshake succeeded.
+	 * @return
+	 * true if the handshake succeeded.
+	 */
+	public boolean isSuccess() {
+		return cause==null;
+	}
+
+	/**
+	 * Returns the cause of the failure.
+	 * @return
+	 * the cause or null, if the handshake succeeded.
+	 */
+	public Throwable cause() {
+		return cause;
+	}
+
+	@Override
+	public String toString() {
+		return "USslHandshakeEvent["+(cause==null ? "success" : cause)+"]";
+	}
+}
@@ -0,0 +1,597 @@
+package com.umpani.aio.websocket;
+
+import java.io.IOException;
+import java.nio.ByteBuffer;
+import java.nio.channels.ClosedChannelException;
+import java.nio.charset.CharacterCodingException;
+import java.nio.charset.CodingErrorAction;
+import java.nio.charset.StandardCharsets;
+import java.util.Arrays;
+import java.util.concurrent.TimeUnit;
+
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UDrainEvent;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.USocketChannel;
+import com.umpani.aio.exception.UWebSocketException;
+import com.umpani.util.exception.UJsonException;
+import com.umpani.util.json.UJsonReader;
+import com.umpani.util.json.UJsonWriter;
+import com.umpani.util.log.ULogger;
+
+/**
+ * A WebSocket connection, the handler after the {@link UWebSocketFrameDecoder} and {@link UWebSocketFrameEncoder} in
+ * the pipeline. It reassembles fragmented messages, validates that text messages are UTF-8, answers pings, performs
+ * the close handshake and passes the messages to an {@link UWebSocketListener}. By default text messages carry JSON,
+ * they are parsed and passed on as {@link com.umpani.util.UMap} or other JSON value, text that is not valid JSON
+ * closes the connection with {@link UWebSocketFrame#INVALID_PAYLOAD}.
+ *
+ * </p><p>The send methods may be invoked by any thread, messages larger than the fragment size are sent as multiple
+ * frames. Senders should respect the writability, see {@link #isWritable()}, to not buffer unlimited amounts of data
+ * for a slow peer, a receiver may stop reading with {@link #setAutoRead(boolean)}, so that the peer is throttled.
+ * Connections are created by the {@link UWebSocketServerHandler} and the {@link UWebSocketClient}. Once the server
+ * shuts down, see {@link UDrainEvent}, the close handshake is started with {@link UWebSocketFrame#GOING_AWAY}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UWebSocket extends UChannelHandlerAdapter {
+	/**
+	 * The logger of the WebSockets.
+	 */
+	private static final ULogger LOG = new ULogger(UWebSocket.class.getName());
+
+	/**
+	 * The default maximal size of a received message.
+	 */
+	public static final int DEFAULT_MAX_MESSAGE_SIZE = 1 << 20;
+
+	/**
+	 * The default maximal payload length of a sent frame.
+	 */
+	public static final int DEFAULT_FRAGMENT_SIZE = 65536;
+
+	/**
+	 * The default time in milliseconds to wait for the close frame of the peer.
+	 */
+	public static final long DEFAULT_CLOSE_TIMEOUT = 5000L;
+
+	/**
+	 * An empty message.
+	 */
+	private static final byte[] EMPTY = new byte[0];
+
+	/**
+	 * Create a new connection.
+	 * @param listener
+	 * the listener of the connection.
+	 * @param client
+	 * true for the client side of the connection, which masks the frames.
+	 * @param maxMessageSize
+	 * the maximal size of a received message in bytes.
+	 * @param json
+	 * true if text messages carry JSON.
+	 */
+	public UWebSocket( final UWebSocketListener listener, final boolean client, final int maxMessageSize, final boolean json ) {
+		if (listener==null) throw new NullPointerException("listener");
+		if (maxMessageSize < UWebSocketFrame.MAX_CONTROL_PAYLOAD) throw new IllegalArgumentException("maxMessageSize: "+maxMessageSize);
+		this.listener = listener;
+		this.client = client;
+		this.maxMessageSize = maxMessageSize;
+		this.json = json;
+	}
+
+	/**
+	 * The listener.
+	 */
+	private final UWebSocketListener listener;
+
+	/**
+	 * True for the client side.
+	 */
+	private final boolean client;
+
+	/**
+	 * The maximal size of a received message.
+	 */
+	private final int maxMessageSize;
+
+	/**
+	 * True if text messages carry JSON.
+	 */
+	private final boolean json;
+
+	/**
+	 * The context of this handler, once added.
+	 */
+	private volatile UHandlerContext ctx;
+
+	/**
+	 * The maximal payload length of a sent frame.
+	 */
+	private volatile int fragmentSize = DEFAULT_FRAGMENT_SIZE;
+
+	/**
+	 * The time to wait for the close frame of the peer.
+	 */
+	private volatile long closeTimeout = DEFAULT_CLOSE_TIMEOUT;
+
+	/**
+	 * True once a close frame was sent, written by the event loop only.
+	 */
+	private volatile boolean closeSent;
+
+	/**
+	 * True once a close frame was received.
+	 */
+	private boolean closeReceived;
+
+	/**
+	 * True once the listener was notified about the open connection.
+	 */
+	private boolean opened;
+
+	/**
+	 * The close code reported to the listener.
+	 */
+	private int closeCode = UWebSocketFrame.ABNORMAL_CLOSURE;
+
+	/**
+	 * The close reason reported to the listener.
+	 */
+	private String closeReason = "";
+
+	/**
+	 * The timer that closes the connection if the peer does not answer the close frame.
+	 */
+	private UFuture<Void> closeTimer;
+
+	/**
+	 * The opcode of the message being received or -1.
+	 */
+	private int messageOpcode = -1;
+
+	/**
+	 * The bytes of the message being received.
+	 */
+	private byte[] message = EMPTY;
+
+	/**
+	 * The length of the message being received.
+	 */
+	private int messageLength;
+
+	/**
+	 * Adds the frame codec and this handler to the pipeline of the given channel.
+	 * @param channel
+	 * the channel.
+	 */
+	void install( final UChannel channel ) {
+		channel.pipeline().addLast(new UWebSocketFrameDecoder(!client, maxMessageSize), new UWebSocketFrameEncoder(client), this);
+	}
+
+	/**
+	 * Returns the channel.
+	 * @return
+	 * the channel or null, if the connection is not yet set up.
+	 */
+	public UChannel channel() {
+		final UHandlerContext ctx = this.ctx;
+		return ctx!=null ? ctx.channel() : null;
+	}
+
+	/**
+	 * Returns true for the client side of the connection.
+	 * @return
+	 * true for the client side.
+	 */
+	public boolean isClient() {
+		return client;
+	}
+
+	/**
+	 * Returns true if the connection is open and the close handshake was not started.
+	 * @return
+	 * true if messages can be sent.
+	 */
+	public boolean isOpen() {
+		final UHandlerContext ctx = this.ctx;
+		return ctx!=null && ctx.channel().isActive() && !closeSent;
+	}
+
+	/**
+	 * Returns true if the channel is writable, which is false while more bytes wait to be written than the high water
+	 * mark of the channel allows, see {@link UChannel#isWritable()}.
+	 * @return
+	 * true if the connection is writable.
+	 */
+	public boolean isWritable() {
+		final UHandlerContext ctx = this.ctx;
+		return ctx!=null && ctx.channel().isWritable();
+	}
+
+	/**
+	 * Enables or disables reading, disabling it stops the delivery of messages and throttles the peer.
+	 * @param autoRead
+	 * true to read; false to stop reading.
+	 * @return
+	 * this.
+	 */
+	public UWebSocket setAutoRead( final boolean autoRead ) {
+		final UChannel channel = channel();
+		if (channel instanceof USocketChannel) ((USocketChannel)channel).setAutoRead(autoRead);
+		return this;
+	}
+
+	/**
+	 * Sets the maximal payload length of sent frames, larger messages are fragmented.
+	 * @param fragmentSize
+	 * the maximal payload length in bytes, zero to never fragment messages.
+	 * @return
+	 * this.
+	 */
+	public UWebSocket setFragmentSize( final int fragmentSize ) {
+		if (fragmentSize < 0) throw new IllegalArgumentException("fragmentSize: "+fragmentSize);
+		this.fragmentSize = fragmentSize;
+		return this;
+	}
+
+	/**
+	 * Sets the time to wait for the close frame of the peer after sending a close frame.
+	 * @param millis
+	 * the time in milliseconds.
+	 * @return
+	 * this.
+	 */
+	public UWebSocket setCloseTimeout( final long millis ) {
+		this.closeTimeout = millis;
+		return this;
+	}
+
+	/**
+	 * Sends the given value as JSON text message.
+	 * @param value
+	 * the value, usually an {@link com.umpani.util.UMap}.
+	 * @return
+	 * the future that is completed once the message was written.
+	 */
+	public UFuture<Void> send( final Object value ) {
+		return sendText(UJsonWriter.toJson(value));
+	}
+
+	/**
+	 * Sends a text message.
+	 * @param text
+	 * the text.
+	 * @return
+	 * the future that is completed once the message was written.
+	 */
+	public UFuture<Void> sendText( final String text ) {
+		return sendFrames(UWebSocketFrame.TEXT, text.getBytes(StandardCharsets.UTF_8));
+	}
+
+	/**
+	 * Sends a binary message.
+	 * @param data
+	 * the bytes.
+	 * @return
+	 * the future that is completed once the message was written.
+	 */
+	public UFuture<Void> sendBinary( final byte[] data ) {
+		return sendFrames(UWebSocketFrame.BINARY, data);
+	}
+
+	/**
+	 * Sends a ping, the peer answers with a pong.
+	 * @param data
+	 * the application data, at most 125 bytes, may be null.
+	 * @return
+	 * the future that is completed once the ping was written.
+	 */
+	public UFuture<Void> ping( final byte[] data ) {
+		if (data!=null && data.length > UWebSocketFrame.MAX_CONTROL_PAYLOAD) throw new IllegalArgumentException("Ping payload exceeds "+UWebSocketFrame.MAX_CONTROL_PAYLOAD+" bytes");
+		return sendFrames(UWebSocketFrame.PING, data!=null ? data : EMPTY);
+	}
+
+	/**
+	 * Starts the close handshake with a normal closure.
+	 * @return
+	 * the future that is completed once the connection is closed.
+	 */
+	public UFuture<Void> close() {
+		return close(UWebSocketFrame.NORMAL_CLOSURE, null);
+	}
+
+	/**
+	 * Starts the close handshake, the connection is closed once the peer answered the close frame or the close timeout
+	 * elapsed.
+	 * @param code
+	 * the close code.
+	 * @param reason
+	 * the reason or null.
+	 * @return
+	 * the future that is completed once the connection is closed.
+	 */
+	public UFuture<Void> close( final int code, final String reason ) {
+		final UWebSocketFrame frame = UWebSocketFrame.close(code, reason);
+		final UHandlerContext ctx = this.ctx;
+		if (ctx==null) throw new IllegalStateException("WebSocket not set up");
+		if (ctx.loop().inEventLoop()) {
+			sendClose(frame, code, reason);
+		} else {
+			ctx.loop().execute(new Runnable() {
+				@Override
+				public void run() {
+					sendClose(frame, code, reason);
+				}
+			});
+		}
+		return ctx.channel().closeFuture();
+	}
+
+	/**
+	 * Writes a message, may be invoked by any thread.
+	 */
+	private UFuture<Void> sendFrames( final int opcode, final byte[] data ) {
+		final UHandlerContext ctx = this.ctx;
+		if (ctx==null) return UFuture.failed(new IllegalStateException("WebSocket not set up"));
+		final UPromise<Void> promise = new UPromise<Void>(null);
+		if (ctx.loop().inEventLoop()) {
+			writeFrames(ctx, opcode, data, promise);
+		} else {
+			ctx.loop().execute(new Runnable() {
+				@Override
+				public void run() {
+					writeFrames(ctx, opcode, data, promise);
+				}
+			});
+		}
+		return promise;
+	}
+
+	/**
+	 * Writes a message from the event loop, the frames of a message are written at once, so that they are not
+	 * interleaved with the frames of other messages.
+	 */
+	private void writeFrames( final UHandlerContext ctx, final int opcode, final byte[] data, final UPromise<Void> promise ) {
+		if (closeSent || !ctx.channel().isActive()) {
+			promise.fail(new ClosedChannelException());
+			return;
+		}
+		final int fragmentSize = this.fragmentSize;
+		if (opcode==UWebSocketFrame.PING || fragmentSize==0 || data.length <= fragmentSize) {
+			promise.completeWith(ctx.writeAndFlush(new UWebSocketFrame(true, 0, opcode, data)));
+			return;
+		}
+		UFuture<Void> written = null;
+		for (int off=0; off < data.length; off += fragmentSize) {
+			final int end = Math.min(data.length, off + fragmentSize);
+			written = ctx.write(new UWebSocketFrame(end==data.length, 0, off==0 ? opcode : UWebSocketFrame.CONTINUATION, Arrays.copyOfRange(data, off, end)));
+		}
+		ctx.flush();
+		promise.completeWith(written);
+	}
+
+	/**
+	 * Sends a close frame, unless one was sent before.
+	 */
+	private void sendClose( final UWebSocketFrame frame, final int code, final String reason ) {
+		final UHandlerContext ctx = this.ctx;
+		if (closeSent) return;
+		closeSent = true;
+		final UFuture<Void> written = ctx.writeAndFlush(frame);
+		if (closeReceived) {
+			closeAfter(ctx, written);
+			return;
+		}
+		if (!ctx.channel().isActive()) return;
+		closeCode = code;
+		closeReason = reason!=null ? reason : "";
+		closeTimer = ctx.loop().schedule(new Runnable() {
+			@Override
+			public void run() {
+				ctx.close();
+			}
+		}, closeTimeout, TimeUnit.MILLISECONDS);
+	}
+
+	/**
+	 * Closes the connection because of an error, after sending a close frame with the given code.
+	 */
+	private void fail( final UHandlerContext ctx, final int code, final String reason ) {
+		if (closeSent) {
+			ctx.close();
+			return;
+		}
+		closeSent = true;
+		closeCode = code;
+		closeReason = reason!=null ? reason : "";
+		closeAfter(ctx, ctx.writeAndFlush(UWebSocketFrame.close(code, reason)));
+	}
+
+	/**
+	 * Closes the channel once the given write is done.
+	 */
+	private static void closeAfter( final UHandlerContext ctx, final UFuture<Void> written ) {
+		written.addListener(new UFutureListener<Void>() {
+			@Override
+			public void complete( final UFuture<Void> future ) {
+				ctx.close();
+			}
+		}, null);
+	}
+
+	@Override
+	public void handlerAdded( final UHandlerContext ctx ) throws Exception {
+		this.ctx = ctx;
+		if (ctx.channel().isActive()) open(ctx);
+	}
+
+	@Override
+	public void channelActive( final UHandlerContext ctx ) throws Exception {
+		open(ctx);
+		ctx.fireChannelActive();
+	}
+
+	/**
+	 * Notifies the listener about the open connection.
+	 */
+	private void open( final UHandlerContext ctx ) {
+		if (opened) return;
+		opened = true;
+		try {
+			listener.onOpen(this);
+		} catch (Throwable t) {
+			exceptionCaught(ctx, t);
+		}
+	}
+
+	@Override
+	public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+		if (!(msg instanceof UWebSocketFrame)) {
+			ctx.fireChannelRead(msg);
+			return;
+		}
+		// nothing may follow the close frame of the peer
+		if (closeReceived) return;
+		final UWebSocketFrame frame = (UWebSocketFrame)msg;
+		switch (frame.opcode()) {
+			case UWebSocketFrame.PING:
+				if (!closeSent) ctx.writeAndFlush(UWebSocketFrame.pong(frame.payload()));
+				return;
+			case UWebSocketFrame.PONG:
+				return;
+			case UWebSocketFrame.CLOSE:
+				closeReceived(ctx, frame);
+				return;
+			case UWebSocketFrame.CONTINUATION:
+				if (messageOpcode < 0) throw new UWebSocketException(UWebSocketFrame.PROTOCOL_ERROR, "Continuation frame without message");
+				break;
+			default:
+				if (messageOpcode >= 0) throw new UWebSocketException(UWebSocketFrame.PROTOCOL_ERROR, "Expected continuation frame");
+				messageOpcode = frame.opcode();
+		}
+		append(frame.payload());
+		if (!frame.isFinal()) return;
+		final int opcode = messageOpcode;
+		final byte[] bytes = Arrays.copyOf(message, messageLength);
+		messageOpcode = -1;
+		message = EMPTY;
+		messageLength = 0;
+		if (opcode==UWebSocketFrame.BINARY) {
+			listener.onMessage(this, bytes);
+			return;
+		}
+		final String text = decodeUtf8(bytes, 0, bytes.length);
+		if (!json) {
+			listener.onMessage(this, text);
+			return;
+		}
+		final Object value;
+		try {
+			value = UJsonReader.parse(text);
+		} catch (UJsonException e) {
+			throw new UWebSocketException(UWebSocketFrame.INVALID_PAYLOAD, "Invalid JSON: "+e.getMessage());
+		}
+		listener.onMessage(this, value);
+	}
+
+	/**
+	 * Appends the payload of a frame to the message being received.
+	 */
+	private void append( final byte[] payload ) throws UWebSocketException {
+		if ((long)messageLength + payload.length > maxMessageSize) throw new UWebSocketException(UWebSocketFrame.MESSAGE_TOO_BIG, "Message exceeds "+maxMessageSize+" bytes");
+		if (messageLength + payload.length > message.length) {
+			message = Arrays.copyOf(message, Math.min(maxMessageSize, Math.max(messageLength + payload.length, message.length << 1)));
+		}
+		System.arraycopy(payload, 0, message, messageLength, payload.length);
+		messageLength += payload.length;
+	}
+
+	/**
+	 * Handles the close frame of the peer.
+	 */
+	private void closeReceived( final UHandlerContext ctx, final UWebSocketFrame frame ) throws UWebSocketException {
+		closeReceived = true;
+		final byte[] payload = frame.payload();
+		if (payload.length==1) throw new UWebSocketException(UWebSocketFrame.PROTOCOL_ERROR, "Invalid close frame");
+		final int code = frame.closeCode();
+		if (code!=UWebSocketFrame.NO_STATUS && !UWebSocketFrame.isValidCloseCode(code)) throw new UWebSocketException(UWebSocketFrame.PROTOCOL_ERROR, "Invalid close code "+code);
+		final String reason = payload.length > 2 ? decodeUtf8(payload, 2, payload.length - 2) : "";
+		closeCode = code;
+		closeReason = reason;
+		if (closeSent) {
+			ctx.close();
+			return;
+		}
+		closeSent = true;
+		closeAfter(ctx, ctx.writeAndFlush(UWebSocketFrame.close(code, null)));
+	}
+
+	/**
+	 * Decodes UTF-8 and rejects invalid bytes.
+	 */
+	private static String decodeUtf8( final byte[] bytes, final int off, final int len ) throws UWebSocketException {
+		try {
+			return StandardCharsets.UTF_8.newDecoder()
+				.onMalformedInput(CodingErrorAction.REPORT)
+				.onUnmappableCharacter(CodingErrorAction.REPORT)
+				.decode(ByteBuffer.wrap(bytes, off, len)).toString();
+		} catch (CharacterCodingException e) {
+			throw new UWebSocketException(UWebSocketFrame.INVALID_PAYLOAD, "Invalid UTF-8");
+		}
+	}
+
+	@Override
+	public void channelWritabilityChanged( final UHandlerContext ctx ) throws Exception {
+		listener.onWritabilityChanged(this, ctx.channel().isWritable());
+		ctx.fireChannelWritabilityChanged();
+	}
+
+	@Override
+	public void exceptionCaught( final UHandlerContext ctx, final Throwable cause ) {
+		if (cause instanceof UWebSocketException) {
+			fail(ctx, ((UWebSocketException)cause).getCloseCode(), cause.getMessage());
+		} else
+		if (cause instanceof IOException) {
+			ctx.close();
+		} else {
+			LOG.error("WebSocket failure", "channel", String.valueOf(ctx.channel()), cause);
+			fail(ctx, UWebSocketFrame.INTERNAL_ERROR, null);
+		}
+	}
+
+	@Override
+	public void userEvent( final UHandlerContext ctx, final Object event ) throws Exception {
+		if (event==UDrainEvent.INSTANCE && ctx.channel().isActive()) {
+			sendClose(UWebSocketFrame.close(UWebSocketFrame.GOING_AWAY, "Server shutting down"), UWebSocketFrame.GOING_AWAY, "Server shutting down");
+		}
+		ctx.fireUserEvent(event);
+	}
+
+	@Override
+	public void channelInactive( final UHandlerContext ctx ) throws Exception {
+		if (closeTimer!=null) closeTimer.cancel(false);
+		closeTimer = null;
+		closeSent = true;
+		message = EMPTY;
+		messageLength = 0;
+		if (opened) {
+			opened = false;
+			try {
+				listener.onClose(this, closeCode, closeReason);
+			} catch (Throwable t) {
+				LOG.error("WebSocket listener failed on close", "channel", String.valueOf(ctx.channel()), t);
+			}
+		}
+		ctx.fireChannelInactive();
+	}
+
+	@Override
+	public String toString() {
+		return "UWebSocket["+channel()+"]";
+	}
+}
@@ -0,0 +1,317 @@
+package com.umpani.aio.websocket;
+
+import java.net.InetSocketAddress;
+import java.net.URI;
+import java.net.URISyntaxException;
+import java.nio.channels.ClosedChannelException;
+import java.security.GeneralSecurityException;
+import java.util.concurrent.TimeUnit;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UClient;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UPipeline;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.USocketChannel;
+import com.umpani.aio.exception.UHttpException;
+import com.umpani.aio.http.UHttpClientCodec;
+import com.umpani.aio.http.UHttpHeaders;
+import com.umpani.aio.http.UHttpRequest;
+import com.umpani.aio.http.UHttpResponse;
+import com.umpani.aio.ssl.USslContext;
+
+/**
+ * Opens WebSocket connections. The client connects, sends the opening handshake and, once the server accepted it,
+ * replaces the HTTP codec with the WebSocket codec and an {@link UWebSocket}. URLs use the scheme <tt>ws</tt> or
+ * <tt>http</tt>, the schemes <tt>wss</tt> and <tt>https</tt> encrypt the connection with the client {@link USslContext}
+ * of the client or, if none is set, with the default trust store of the JVM.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UWebSocketClient {
+	/**
+	 * The default time in milliseconds to connect and complete the opening handshake.
+	 */
+	public static final long DEFAULT_TIMEOUT = 10000L;
+
+	/**
+	 * Create a new client that uses the default buffer pool.
+	 * @param group
+	 * the event loops.
+	 */
+	public UWebSocketClient( final UEventLoopGroup group ) {
+		this(group, UBufferPool.DEFAULT);
+	}
+
+	/**
+	 * Create a new client.
+	 * @param group
+	 * the event loops.
+	 * @param alloc
+	 * the buffer pool of the connections.
+	 */
+	public UWebSocketClient( final UEventLoopGroup group, final UBufferPool alloc ) {
+		this.group = group;
+		this.alloc = alloc;
+	}
+
+	/**
+	 * The event loops.
+	 */
+	protected final UEventLoopGroup group;
+
+	/**
+	 * The buffer pool of the connections.
+	 */
+	protected final UBufferPool alloc;
+
+	/**
+	 * The maximal size of a received message.
+	 */
+	private volatile int maxMessageSize = UWebSocket.DEFAULT_MAX_MESSAGE_SIZE;
+
+	/**
+	 * True if text messages carry JSON.
+	 */
+	private volatile boolean json = true;
+
+	/**
+	 * The time to connect and complete the opening handshake.
+	 */
+	private volatile long timeout = DEFAULT_TIMEOUT;
+
+	/**
+	 * The TLS configuration of secure connections or null.
+	 */
+	private volatile USslContext sslContext;
+
+	/**
+	 * Sets the maximal size of a received message, larger messages close the connection with
+	 * {@link UWebSocketFrame#MESSAGE_TOO_BIG}.
+	 * @param maxMessageSize
+	 * the maximal size in bytes.
+	 * @return
+	 * this.
+	 */
+	public UWebSocketClient setMaxMessageSize( final int maxMessageSize ) {
+		if (maxMessageSize < UWebSocketFrame.MAX_CONTROL_PAYLOAD) throw new IllegalArgumentException("maxMessageSize: "+maxMessageSize);
+		this.maxMessageSize = maxMessageSize;
+		return this;
+	}
+
+	/**
+	 * Enables or disables parsing text messages as JSON, which is enabled by default.
+	 * @param json
+	 * true if text messages carry JSON; false to pass them on as string.
+	 * @return
+	 * this.
+	 */
+	public UWebSocketClient setJson( final boolean json ) {
+		this.json = json;
+		return this;
+	}
+
+	/**
+	 * Sets the time to connect and complete the opening handshake.
+	 * @param millis
+	 * the time in milliseconds, zero or less for no timeout.
+	 * @return
+	 * this.
+	 */
+	public UWebSocketClient setTimeout( final long millis ) {
+		this.timeout = Math.max(0L, millis);
+		return this;
+	}
+
+	/**
+	 * Sets the TLS configuration of <tt>wss</tt> connections.
+	 * @param sslContext
+	 * the client context or null, to use the default trust store of the JVM.
+	 * @return
+	 * this.
+	 */
+	public UWebSocketClient setSslContext( final USslContext sslContext ) {
+		if (sslContext!=null && !sslContext.isClient()) throw new IllegalArgumentException("Client context required");
+		this.sslContext = sslContext;
+		return this;
+	}
+
+	/**
+	 * Opens a connection.
+	 * @param url
+	 * the absolute URL of the endpoint.
+	 * @param listener
+	 * the listener of the connection.
+	 * @return
+	 * the future of the connection, which fails with an {@link UHttpException} if the server rejected the handshake.
+	 */
+	public UFuture<UWebSocket> connect( final String url, final UWebSocketListener listener ) {
+		return connect(new UHttpRequest("GET", url), listener);
+	}
+
+	/**
+	 * Opens a connection with the given request as opening handshake, for example to send further header fields.
+	 * @param request
+	 * the GET request with the absolute URL of the endpoint.
+	 * @param listener
+	 * the listener of the connection.
+	 * @return
+	 * the future of the connection, which fails with an {@link UHttpException} if the server rejected the handshake.
+	 */
+	public UFuture<UWebSocket> connect( final UHttpRequest request, final UWebSocketListener listener ) {
+		final URI uri;
+		try {
+			uri = new URI(request.uri());
+		} catch (URISyntaxException e) {
+			return UFuture.failed(new IllegalArgumentException("Invalid URL: "+request.uri(), e));
+		}
+		final String scheme = uri.getScheme();
+		final boolean secure = "wss".equalsIgnoreCase(scheme) || "https".equalsIgnoreCase(scheme);
+		if (uri.getHost()==null || !(secure || "ws".equalsIgnoreCase(scheme) || "http".equalsIgnoreCase(scheme))) {
+			return UFuture.failed(new IllegalArgumentException("Absolute ws URL required: "+request.uri()));
+		}
+		USslContext sslContext = null;
+		if (secure) {
+			sslContext = this.sslContext;
+			try {
+				if (sslContext==null) sslContext = USslContext.forClient();
+			} catch (GeneralSecurityException e) {
+				return UFuture.failed(e);
+			}
+		}
+		final USslContext ssl = sslContext;
+		final int defaultPort = secure ? 443 : 80;
+		final int port = uri.getPort() < 0 ? defaultPort : uri.getPort();
+		String target = uri.getRawPath();
+		if (target==null || target.isEmpty()) target = "/";
+		if (uri.getRawQuery()!=null) target += "?"+uri.getRawQuery();
+		final UHttpRequest handshake = new UHttpRequest("GET", target);
+		final UHttpHeaders headers = request.headers();
+		for (int i=0; i < headers.size(); i++) handshake.headers().add(headers.name(i), headers.value(i));
+		final String key = UWebSocketHandshake.newKey();
+		handshake.headers().set(UHttpHeaders.HOST, port==defaultPort ? uri.getHost() : uri.getHost()+":"+port);
+		handshake.headers().set(UHttpHeaders.UPGRADE, "websocket");
+		handshake.headers().set(UHttpHeaders.CONNECTION, "Upgrade");
+		handshake.headers().set(UWebSocketHandshake.SEC_WEBSOCKET_KEY, key);
+		handshake.headers().set(UWebSocketHandshake.SEC_WEBSOCKET_VERSION, UWebSocketHandshake.VERSION);
+
+		final UWebSocket webSocket = new UWebSocket(listener, true, maxMessageSize, json);
+		final UPromise<UWebSocket> promise = new UPromise<UWebSocket>(null);
+		final UClient client = new UClient(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				if (ssl!=null) channel.pipeline().addLast(ssl.newHandler(uri.getHost(), port));
+				channel.pipeline().addLast(new UHttpClientCodec(), new Handshake(handshake, key, webSocket, promise));
+			}
+		}, alloc);
+		final UFuture<USocketChannel> connected = client.connect(new InetSocketAddress(uri.getHost(), port));
+		connected.addListener(new UFutureListener<USocketChannel>() {
+			@Override
+			public void complete( final UFuture<USocketChannel> future ) {
+				if (!future.isSuccess()) promise.fail(future.cause());
+			}
+		}, null);
+		promise.onCancel(new Runnable() {
+			@Override
+			public void run() {
+				if (!connected.cancel(false) && connected.isSuccess()) connected.getNow().close();
+			}
+		});
+		final long timeout = this.timeout;
+		return timeout > 0 ? promise.withTimeout(timeout, TimeUnit.MILLISECONDS, group.next()) : promise;
+	}
+
+	/**
+	 * Sends the opening handshake and switches the protocol once the server accepted it.
+	 */
+	private static final class Handshake extends UChannelHandlerAdapter {
+		Handshake( final UHttpRequest request, final String key, final UWebSocket webSocket, final UPromise<UWebSocket> promise ) {
+			this.request = request;
+			this.key = key;
+			this.webSocket = webSocket;
+			this.promise = promise;
+		}
+
+		/**
+		 * The request of the opening handshake.
+		 */
+		private final UHttpRequest request;
+
+		/**
+		 * The key of the opening handshake.
+		 */
+		private final String key;
+
+		/**
+		 * The connection to set up.
+		 */
+		private final UWebSocket webSocket;
+
+		/**
+		 * The promise of the connection.
+		 */
+		private final UPromise<UWebSocket> promise;
+
+		/**
+		 * True once the server accepted the handshake.
+		 */
+		private boolean accepted;
+
+		@Override
+		public void channelActive( final UHandlerContext ctx ) throws Exception {
+			ctx.writeAndFlush(request);
+			ctx.fireChannelActive();
+		}
+
+		@Override
+		public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+			if (msg instanceof UHttpResponse) {
+				final UHttpResponse response = (UHttpResponse)msg;
+				if (response.status()!=101) {
+					fail(ctx, new UHttpException(response.status(), "WebSocket handshake rejected: "+response.status()+" "+response.reason()));
+				} else
+				if (!UWebSocketHandshake.isUpgrade(response)) {
+					fail(ctx, new UHttpException(response.status(), "WebSocket handshake without upgrade"));
+				} else
+				if (!UWebSocketHandshake.acceptKey(key).equals(response.headers().get(UWebSocketHandshake.SEC_WEBSOCKET_ACCEPT))) {
+					fail(ctx, new UHttpException(response.status(), "Invalid "+UWebSocketHandshake.SEC_WEBSOCKET_ACCEPT));
+				} else {
+					accepted = true;
+				}
+				return;
+			}
+			// the end of the response, the decoder keeps the following bytes for the new protocol
+			if (!accepted || promise.isDone()) return;
+			final UPipeline pipeline = ctx.pipeline();
+			webSocket.install(ctx.channel());
+			pipeline.remove(this);
+			pipeline.remove(pipeline.get(UHttpClientCodec.class));
+			if (!promise.complete(webSocket)) ctx.channel().close();
+		}
+
+		/**
+		 * Fails the handshake and closes the connection.
+		 */
+		private void fail( final UHandlerContext ctx, final Throwable cause ) {
+			promise.fail(cause);
+			ctx.close();
+		}
+
+		@Override
+		public void exceptionCaught( final UHandlerContext ctx, final Throwable cause ) throws Exception {
+			fail(ctx, cause);
+		}
+
+		@Override
+		public void channelInactive( final UHandlerContext ctx ) throws Exception {
+			promise.fail(new ClosedChannelException());
+			ctx.fireChannelInactive();
+		}
+	}
+}
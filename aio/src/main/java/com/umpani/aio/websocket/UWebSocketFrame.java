@@ -0,0 +1,314 @@
+package com.umpani.aio.websocket;
+
+import java.nio.charset.StandardCharsets;
+
+/**
+ * A WebSocket frame as defined by RFC 6455. Data frames carry a text or binary message or a fragment of it, a
+ * fragmented message starts with a text or binary frame that is not final, followed by continuation frames up to the
+ * final one. Control frames are never fragmented and have a payload of at most 125 bytes. The masking of frames sent
+ * by clients is done by the codec, frames always hold the unmasked payload.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UWebSocketFrame {
+	/**
+	 * The opcode of a continuation frame.
+	 */
+	public static final int CONTINUATION = 0x0;
+
+	/**
+	 * The opcode of a text frame.
+	 */
+	public static final int TEXT = 0x1;
+
+	/**
+	 * The opcode of a binary frame.
+	 */
+	public static final int BINARY = 0x2;
+
+	/**
+	 * The opcode of a close frame.
+	 */
+	public static final int CLOSE = 0x8;
+
+	/**
+	 * The opcode of a ping frame.
+	 */
+	public static final int PING = 0x9;
+
+	/**
+	 * The opcode of a pong frame.
+	 */
+	public static final int PONG = 0xA;
+
+	/**
+	 * The close code of a normal closure.
+	 */
+	public static final int NORMAL_CLOSURE = 1000;
+
+	/**
+	 * The close code of an endpoint that goes away, like a server that shuts down.
+	 */
+	public static final int GOING_AWAY = 1001;
+
+	/**
+	 * The close code of a protocol error.
+	 */
+	public static final int PROTOCOL_ERROR = 1002;
+
+	/**
+	 * The close code of a message with a type the endpoint can't accept.
+	 */
+	public static final int UNSUPPORTED_DATA = 1003;
+
+	/**
+	 * The close code reported if a close frame had no close code, never sent.
+	 */
+	public static final int NO_STATUS = 1005;
+
+	/**
+	 * The close code reported if the connection closed without close frame, never sent.
+	 */
+	public static final int ABNORMAL_CLOSURE = 1006;
+
+	/**
+	 * The close code of a message with invalid data, like a text that is not valid UTF-8.
+	 */
+	public static final int INVALID_PAYLOAD = 1007;
+
+	/**
+	 * The close code of a message that violates the policy of the endpoint.
+	 */
+	public static final int POLICY_VIOLATION = 1008;
+
+	/**
+	 * The close code of a message that exceeds the size limit.
+	 */
+	public static final int MESSAGE_TOO_BIG = 1009;
+
+	/**
+	 * The close code of an unexpected failure.
+	 */
+	public static final int INTERNAL_ERROR = 1011;
+
+	/**
+	 * The maximal payload length of a control frame.
+	 */
+	public static final int MAX_CONTROL_PAYLOAD = 125;
+
+	/**
+	 * An empty payload.
+	 */
+	private static final byte[] EMPTY = new byte[0];
+
+	/**
+	 * Create a new frame.
+	 * @param fin
+	 * true if this is the final frame of a message.
+	 * @param rsv
+	 * the three reserved bits, zero unless an extension defines them.
+	 * @param opcode
+	 * the opcode.
+	 * @param payload
+	 * the unmasked payload.
+	 */
+	public UWebSocketFrame( final boolean fin, final int rsv, final int opcode, final byte[] payload ) {
+		if (opcode < 0 || opcode > 0xF) throw new IllegalArgumentException("opcode: "+opcode);
+		if (rsv < 0 || rsv > 7) throw new IllegalArgumentException("rsv: "+rsv);
+		this.fin = fin;
+		this.rsv = rsv;
+		this.opcode = opcode;
+		this.payload = payload!=null ? payload : EMPTY;
+	}
+
+	/**
+	 * True if this is the final frame of a message.
+	 */
+	private final boolean fin;
+
+	/**
+	 * The reserved bits.
+	 */
+	private final int rsv;
+
+	/**
+	 * The opcode.
+	 */
+	private final int opcode;
+
+	/**
+	 * The unmasked payload.
+	 */
+	private final byte[] payload;
+
+	/**
+	 * Returns a final text frame.
+	 * @param text
+	 * the text.
+	 * @return
+	 * the frame.
+	 */
+	public static UWebSocketFrame text( final String text ) {
+		return new UWebSocketFrame(true, 0, TEXT, text.getBytes(StandardCharsets.UTF_8));
+	}
+
+	/**
+	 * Returns a final binary frame.
+	 * @param data
+	 * the bytes.
+	 * @return
+	 * the frame.
+	 */
+	public static UWebSocketFrame binary( final byte[] data ) {
+		return new UWebSocketFrame(true, 0, BINARY, data);
+	}
+
+	/**
+	 * Returns a ping frame.
+	 * @param data
+	 * the application data, at most 125 bytes, may be null.
+	 * @return
+	 * the frame.
+	 */
+	public static UWebSocketFrame ping( final byte[] data ) {
+		return control(PING, data);
+	}
+
+	/**
+	 * Returns a pong frame.
+	 * @param data
+	 * the application data of the ping, at most 125 bytes, may be null.
+	 * @return
+	 * the frame.
+	 */
+	public static UWebSocketFrame pong( final byte[] data ) {
+		return control(PONG, data);
+	}
+
+	/**
+	 * Returns a close frame.
+	 * @param code
+	 * the close code or {@link #NO_STATUS} to send a close frame without payload.
+	 * @param reason
+	 * the reason or null, the UTF-8 encoded reason is cut to fit into the payload.
+	 * @return
+	 * the frame.
+	 */
+	public static UWebSocketFrame close( final int code, final String reason ) {
+		if (code==NO_STATUS) return control(CLOSE, null);
+		if (!isValidCloseCode(code)) throw new IllegalArgumentException("code: "+code);
+		byte[] text = reason!=null ? reason.getBytes(StandardCharsets.UTF_8) : EMPTY;
+		int length = Math.min(text.length, MAX_CONTROL_PAYLOAD - 2);
+		// do not cut a multi-byte character
+		while (length < text.length && length > 0 && (text[length] & 0xC0)==0x80) length--;
+		final byte[] payload = new byte[2 + length];
+		payload[0] = (byte)(code >>> 8);
+		payload[1] = (byte)code;
+		System.arraycopy(text, 0, payload, 2, length);
+		return new UWebSocketFrame(true, 0, CLOSE, payload);
+	}
+
+	/**
+	 * Returns a control frame.
+	 */
+	private static UWebSocketFrame control( final int opcode, final byte[] data ) {
+		if (data!=null && data.length > MAX_CONTROL_PAYLOAD) throw new IllegalArgumentException("Control frame payload exceeds "+MAX_CONTROL_PAYLOAD+" bytes");
+		return new UWebSocketFrame(true, 0, opcode, data);
+	}
+
+	/**
+	 * Returns true if the given close code may be sent in a close frame.
+	 * @param code
+	 * the close code.
+	 * @return
+	 * true for the codes defined by RFC 6455 that may be sent and for the codes 3000 to 4999.
+	 */
+	public static boolean isValidCloseCode( final int code ) {
+		if (code >= 3000 && code <= 4999) return true;
+		switch (code) {
+			case 1000: case 1001: case 1002: case 1003: case 1007: case 1008: case 1009: case 1010: case 1011: case 1012: case 1013: case 1014:
+				return true;
+			default:
+				return false;
+		}
+	}
+
+	/**
+	 * Returns true if this is the final frame of a message.
+	 * @return
+	 * true if this is the final frame.
+	 */
+	public boolean isFinal() {
+		return fin;
+	}
+
+	/**
+	 * Returns the reserved bits.
+	 * @return
+	 * the reserved bits.
+	 */
+	public int rsv() {
+		return rsv;
+	}
+
+	/**
+	 * Returns the opcode.
+	 * @return
+	 * the opcode.
+	 */
+	public int opcode() {
+		return opcode;
+	}
+
+	/**
+	 * Returns true if this is a control frame.
+	 * @return
+	 * true for close, ping and pong frames.
+	 */
+	public boolean isControl() {
+		return (opcode & 0x8)!=0;
+	}
+
+	/**
+	 * Returns the unmasked payload.
+	 * @return
+	 * the payload.
+	 */
+	public byte[] payload() {
+		return payload;
+	}
+
+	/**
+	 * Returns the payload decoded as UTF-8, invalid bytes are replaced.
+	 * @return
+	 * the text.
+	 */
+	public String text() {
+		return new String(payload, StandardCharsets.UTF_8);
+	}
+
+	/**
+	 * Returns the close code of a close frame.
+	 * @return
+	 * the close code or {@link #NO_STATUS}, if the frame has no payload.
+	 */
+	public int closeCode() {
+		if (payload.length < 2) return NO_STATUS;
+		return ((payload[0] & 0xff) << 8) | (payload[1] & 0xff);
+	}
+
+	/**
+	 * Returns the reason of a close frame.
+	 * @return
+	 * the reason, empty if there is none.
+	 */
+	public String closeReason() {
+		if (payload.length <= 2) return "";
+		return new String(payload, 2, payload.length - 2, StandardCharsets.UTF_8);
+	}
+
+	@Override
+	public String toString() {
+		return "UWebSocketFrame[opcode="+opcode+", fin="+fin+", length="+payload.length+"]";
+	}
+}
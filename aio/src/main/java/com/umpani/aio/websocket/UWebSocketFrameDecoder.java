@@ -0,0 +1,107 @@
+package com.umpani.aio.websocket;
+
+import java.util.List;
+
+import com.umpani.aio.UCompositeBuffer;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.codec.UByteToMessageDecoder;
+import com.umpani.aio.exception.UWebSocketException;
+
+/**
+ * Decodes WebSocket frames into {@link UWebSocketFrame}s. The decoder checks everything that can be checked per frame:
+ * the reserved bits, the opcode, the size and fragmentation of control frames, the masking, which is required for
+ * frames sent by clients and forbidden for frames sent by servers, and the maximal payload length. A violation is
+ * reported as {@link UWebSocketException} with the close code to send, after that all further bytes are discarded.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UWebSocketFrameDecoder extends UByteToMessageDecoder {
+	/**
+	 * Create a new decoder.
+	 * @param expectMasked
+	 * true to decode frames sent by a client, which are masked; false to decode frames sent by a server.
+	 * @param maxPayloadLength
+	 * the maximal payload length of a frame.
+	 */
+	public UWebSocketFrameDecoder( final boolean expectMasked, final int maxPayloadLength ) {
+		if (maxPayloadLength < UWebSocketFrame.MAX_CONTROL_PAYLOAD) throw new IllegalArgumentException("maxPayloadLength: "+maxPayloadLength);
+		this.expectMasked = expectMasked;
+		this.maxPayloadLength = maxPayloadLength;
+	}
+
+	/**
+	 * True if frames must be masked.
+	 */
+	private final boolean expectMasked;
+
+	/**
+	 * The maximal payload length of a frame.
+	 */
+	private final int maxPayloadLength;
+
+	/**
+	 * True once a violation was detected.
+	 */
+	private boolean bad;
+
+	@Override
+	protected void decode( final UHandlerContext ctx, final UCompositeBuffer in, final List<Object> out ) throws Exception {
+		if (bad) {
+			in.skipBytes(in.readableBytes());
+			return;
+		}
+		final int readable = in.readableBytes();
+		if (readable < 2) return;
+		final int b0 = in.getUnsignedByte(0);
+		final int b1 = in.getUnsignedByte(1);
+		final boolean fin = (b0 & 0x80)!=0;
+		final int rsv = (b0 >>> 4) & 0x7;
+		final int opcode = b0 & 0xF;
+		final boolean masked = (b1 & 0x80)!=0;
+		final int length7 = b1 & 0x7F;
+		if (rsv!=0) throw fail(UWebSocketFrame.PROTOCOL_ERROR, "Reserved bits set without extension");
+		switch (opcode) {
+			case UWebSocketFrame.CONTINUATION: case UWebSocketFrame.TEXT: case UWebSocketFrame.BINARY:
+				break;
+			case UWebSocketFrame.CLOSE: case UWebSocketFrame.PING: case UWebSocketFrame.PONG:
+				if (!fin) throw fail(UWebSocketFrame.PROTOCOL_ERROR, "Fragmented control frame");
+				if (length7 > UWebSocketFrame.MAX_CONTROL_PAYLOAD) throw fail(UWebSocketFrame.PROTOCOL_ERROR, "Control frame payload exceeds "+UWebSocketFrame.MAX_CONTROL_PAYLOAD+" bytes");
+				break;
+			default:
+				throw fail(UWebSocketFrame.PROTOCOL_ERROR, "Unknown opcode "+opcode);
+		}
+		if (masked!=expectMasked) throw fail(UWebSocketFrame.PROTOCOL_ERROR, expectMasked ? "Unmasked client frame" : "Masked server frame");
+		int headerLength = 2;
+		long length = length7;
+		if (length7==126) {
+			if (readable < 4) return;
+			length = in.getUnsignedShort(2);
+			headerLength = 4;
+		} else
+		if (length7==127) {
+			if (readable < 10) return;
+			length = in.getLong(2);
+			headerLength = 10;
+			if (length < 0) throw fail(UWebSocketFrame.PROTOCOL_ERROR, "Invalid payload length");
+		}
+		if (length > maxPayloadLength) throw fail(UWebSocketFrame.MESSAGE_TOO_BIG, "Frame payload exceeds "+maxPayloadLength+" bytes");
+		if (readable < headerLength + (masked ? 4 : 0) + length) return;
+		in.skipBytes(headerLength);
+		final byte[] mask = new byte[4];
+		if (masked) in.readBytes(mask, 0, 4);
+		final byte[] payload = new byte[(int)length];
+		in.readBytes(payload, 0, payload.length);
+		if (masked) {
+			for (int i=0; i < payload.length; i++) payload[i] ^= mask[i & 3];
+		}
+		out.add(new UWebSocketFrame(fin, rsv, opcode, payload));
+	}
+
+	/**
+	 * Switches into the bad state and returns the exception to throw.
+	 */
+	private UWebSocketException fail( final int closeCode, final String message ) {
+		bad = true;
+		return new UWebSocketException(closeCode, message);
+	}
+}
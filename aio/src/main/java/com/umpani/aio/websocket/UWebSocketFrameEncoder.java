@@ -0,0 +1,67 @@
+package com.umpani.aio.websocket;
+
+import java.security.SecureRandom;
+
+import com.umpani.aio.UBufferOutputStream;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.codec.UMessageToByteEncoder;
+
+/**
+ * Encodes {@link UWebSocketFrame}s. Frames sent by a client are masked with a random key per frame, as required by
+ * RFC 6455, frames sent by a server are not masked.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UWebSocketFrameEncoder extends UMessageToByteEncoder<UWebSocketFrame> {
+	/**
+	 * The source of the masking keys.
+	 */
+	private static final SecureRandom RANDOM = new SecureRandom();
+
+	/**
+	 * Create a new encoder.
+	 * @param mask
+	 * true to mask the frames, which is required for frames sent by a client.
+	 */
+	public UWebSocketFrameEncoder( final boolean mask ) {
+		super(UWebSocketFrame.class);
+		this.mask = mask;
+	}
+
+	/**
+	 * True if frames are masked.
+	 */
+	private final boolean mask;
+
+	@Override
+	protected void encode( final UHandlerContext ctx, final UWebSocketFrame frame, final UBufferOutputStream out ) throws Exception {
+		final byte[] payload = frame.payload();
+		final int length = payload.length;
+		out.write((frame.isFinal() ? 0x80 : 0) | (frame.rsv() << 4) | frame.opcode());
+		final int maskBit = mask ? 0x80 : 0;
+		if (length < 126) {
+			out.write(maskBit | length);
+		} else
+		if (length <= 0xFFFF) {
+			out.write(maskBit | 126);
+			out.write(length >>> 8);
+			out.write(length);
+		} else {
+			out.write(maskBit | 127);
+			for (int shift=56; shift >= 0; shift -= 8) out.write((int)((long)length >>> shift));
+		}
+		if (!mask) {
+			out.write(payload, 0, length);
+			return;
+		}
+		final byte[] key = new byte[4];
+		RANDOM.nextBytes(key);
+		out.write(key, 0, 4);
+		final byte[] masked = new byte[Math.min(length, 8192)];
+		for (int off=0; off < length; off += masked.length) {
+			final int n = Math.min(masked.length, length - off);
+			for (int i=0; i < n; i++) masked[i] = (byte)(payload[off + i] ^ key[(off + i) & 3]);
+			out.write(masked, 0, n);
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package com.umpani.aio.websocket;
+
+import java.nio.charset.StandardCharsets;
+import java.security.MessageDigest;
+import java.security.NoSuchAlgorithmException;
+import java.security.SecureRandom;
+
+import javax.xml.bind.DatatypeConverter;
+
+import com.umpani.aio.http.UHttpHeaders;
+import com.umpani.aio.http.UHttpMessage;
+
+/**
+ * The header fields and keys of the WebSocket opening handshake.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UWebSocketHandshake {
+	/**
+	 * The header field with the key of the client.
+	 */
+	public static final String SEC_WEBSOCKET_KEY = "Sec-WebSocket-Key";
+
+	/**
+	 * The header field with the accept key of the server.
+	 */
+	public static final String SEC_WEBSOCKET_ACCEPT = "Sec-WebSocket-Accept";
+
+	/**
+	 * The header field with the protocol version.
+	 */
+	public static final String SEC_WEBSOCKET_VERSION = "Sec-WebSocket-Version";
+
+	/**
+	 * The supported protocol version.
+	 */
+	public static final String VERSION = "13";
+
+	/**
+	 * The GUID appended to the key of the client to compute the accept key.
+	 */
+	private static final String GUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11";
+
+	/**
+	 * The source of the client keys.
+	 */
+	private static final SecureRandom RANDOM = new SecureRandom();
+
+	private UWebSocketHandshake() {}
+
+	/**
+	 * Returns a new random key of a client.
+	 * @return
+	 * the base64 encoded key.
+	 */
+	public static String newKey() {
+		final byte[] bytes = new byte[16];
+		RANDOM.nextBytes(bytes);
+		return DatatypeConverter.printBase64Binary(bytes);
+	}
+
+	/**
+	 * Returns the accept key the server answers to the given key of a client.
+	 * @param key
+	 * the key of the client.
+	 * @return
+	 * the base64 encoded accept key.
+	 */
+	public static String acceptKey( final String key ) {
+		try {
+			final MessageDigest sha1 = MessageDigest.getInstance("SHA-1");
+			return DatatypeConverter.printBase64Binary(sha1.digest((key.trim()+GUID).getBytes(StandardCharsets.ISO_8859_1)));
+		} catch (NoSuchAlgorithmException e) {
+			// every Java platform supports SHA-1
+			throw new IllegalStateException(e);
+		}
+	}
+
+	/**
+	 * Returns true if the given message requests or confirms the upgrade to WebSocket.
+	 * @param message
+	 * the request or response.
+	 * @return
+	 * true if the message has the header fields <tt>Upgrade: websocket</tt> and <tt>Connection: Upgrade</tt>.
+	 */
+	public static boolean isUpgrade( final UHttpMessage message ) {
+		final UHttpHeaders headers = message.headers();
+		return headers.contains(UHttpHeaders.UPGRADE, "websocket") && headers.contains(UHttpHeaders.CONNECTION, "upgrade");
+	}
+}
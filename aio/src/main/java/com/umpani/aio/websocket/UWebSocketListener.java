@@ -0,0 +1,56 @@
+package com.umpani.aio.websocket;
+
+/**
+ * Receives the events of a {@link UWebSocket}. All methods are invoked by the event loop of the connection, so they
+ * must not block. An exception thrown by a listener closes the connection with {@link UWebSocketFrame#INTERNAL_ERROR}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ * @see UWebSocketListenerAdapter
+ */
+public interface UWebSocketListener {
+	/**
+	 * Called once the connection is open.
+	 * @param webSocket
+	 * the connection.
+	 * @throws Exception
+	 * if the connection must be closed.
+	 */
+	public void onOpen( final UWebSocket webSocket ) throws Exception;
+
+	/**
+	 * Called for every received message.
+	 * @param webSocket
+	 * the connection.
+	 * @param message
+	 * the parsed JSON value of a text message, usually an {@link com.umpani.util.UMap}, the text itself if JSON is
+	 * disabled and the bytes of a binary message.
+	 * @throws Exception
+	 * if the connection must be closed.
+	 */
+	public void onMessage( final UWebSocket webSocket, final Object message ) throws Exception;
+
+	/**
+	 * Called if the connection became writable or not writable, see {@link UWebSocket#isWritable()}.
+	 * @param webSocket
+	 * the connection.
+	 * @param writable
+	 * true if the connection became writable.
+	 * @throws Exception
+	 * if the connection must be closed.
+	 */
+	public void onWritabilityChanged( final UWebSocket webSocket, final boolean writable ) throws Exception;
+
+	/**
+	 * Called once the connection is closed.
+	 * @param webSocket
+	 * the connection.
+	 * @param code
+	 * the close code sent by the peer or, if the connection was closed because of an error, the code sent to the
+	 * peer; {@link UWebSocketFrame#ABNORMAL_CLOSURE} if the connection closed without close handshake.
+	 * @param reason
+	 * the reason, empty if there is none.
+	 * @throws Exception
+	 * ignored.
+	 */
+	public void onClose( final UWebSocket webSocket, final int code, final String reason ) throws Exception;
+}
@@ -0,0 +1,20 @@
+package com.umpani.aio.websocket;
+
+/**
+ * A {@link UWebSocketListener} that ignores all events, sub-classes override the methods of interest.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public abstract class UWebSocketListenerAdapter implements UWebSocketListener {
+	@Override
+	public void onOpen( final UWebSocket webSocket ) throws Exception {}
+
+	@Override
+	public void onMessage( final UWebSocket webSocket, final Object message ) throws Exception {}
+
+	@Override
+	public void onWritabilityChanged( final UWebSocket webSocket, final boolean writable ) throws Exception {}
+
+	@Override
+	public void onClose( final UWebSocket webSocket, final int code, final String reason ) throws Exception {}
+}
@@ -0,0 +1,121 @@
+package com.umpani.aio.websocket;
+
+import javax.xml.bind.DatatypeConverter;
+
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.http.UHttpHandler;
+import com.umpani.aio.http.UHttpHeaders;
+import com.umpani.aio.http.UHttpRequest;
+import com.umpani.aio.http.UHttpResponse;
+
+/**
+ * An {@link UHttpHandler} that upgrades requests to WebSocket connections, for example registered at an
+ * {@link com.umpani.aio.http.UHttpRouter} for the path of the WebSocket endpoint. A valid opening handshake is
+ * answered with status 101 and the connection is taken over by a new {@link UWebSocket}, a GET request without
+ * upgrade is answered with 426 and an unsupported protocol version with 426 and the supported version.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UWebSocketServerHandler implements UHttpHandler {
+	/**
+	 * Create a new handler.
+	 * @param listener
+	 * the listener of all connections.
+	 */
+	public UWebSocketServerHandler( final UWebSocketListener listener ) {
+		if (listener==null) throw new NullPointerException("listener");
+		this.listener = listener;
+	}
+
+	/**
+	 * The listener of all connections.
+	 */
+	protected final UWebSocketListener listener;
+
+	/**
+	 * The maximal size of a received message.
+	 */
+	private volatile int maxMessageSize = UWebSocket.DEFAULT_MAX_MESSAGE_SIZE;
+
+	/**
+	 * True if text messages carry JSON.
+	 */
+	private volatile boolean json = true;
+
+	/**
+	 * Sets the maximal size of a received message, larger messages close the connection with
+	 * {@link UWebSocketFrame#MESSAGE_TOO_BIG}.
+	 * @param maxMessageSize
+	 * the maximal size in bytes.
+	 * @return
+	 * this.
+	 */
+	public UWebSocketServerHandler setMaxMessageSize( final int maxMessageSize ) {
+		if (maxMessageSize < UWebSocketFrame.MAX_CONTROL_PAYLOAD) throw new IllegalArgumentException("maxMessageSize: "+maxMessageSize);
+		this.maxMessageSize = maxMessageSize;
+		return this;
+	}
+
+	/**
+	 * Enables or disables parsing text messages as JSON, which is enabled by default.
+	 * @param json
+	 * true if text messages carry JSON; false to pass them on as string.
+	 * @return
+	 * this.
+	 */
+	public UWebSocketServerHandler setJson( final boolean json ) {
+		this.json = json;
+		return this;
+	}
+
+	@Override
+	public UFuture<?> handle( final UHttpRequest request ) throws Exception {
+		if (!request.method().equals("GET")) {
+			final UHttpResponse response = UHttpResponse.error(405, null);
+			response.headers().set(UHttpHeaders.ALLOW, "GET");
+			return UFuture.succeeded(response);
+		}
+		if (!UWebSocketHandshake.isUpgrade(request)) {
+			final UHttpResponse response = UHttpResponse.error(426, "WebSocket upgrade required");
+			response.headers().set(UHttpHeaders.UPGRADE, "websocket");
+			response.headers().set(UHttpHeaders.CONNECTION, "Upgrade");
+			return UFuture.succeeded(response);
+		}
+		if (!UWebSocketHandshake.VERSION.equals(request.headers().get(UWebSocketHandshake.SEC_WEBSOCKET_VERSION))) {
+			final UHttpResponse response = UHttpResponse.error(426, "Unsupported WebSocket version");
+			response.headers().set(UWebSocketHandshake.SEC_WEBSOCKET_VERSION, UWebSocketHandshake.VERSION);
+			return UFuture.succeeded(response);
+		}
+		final String key = request.headers().get(UWebSocketHandshake.SEC_WEBSOCKET_KEY);
+		if (key==null || DatatypeConverter.parseBase64Binary(key.trim()).length!=16) {
+			return UFuture.succeeded(UHttpResponse.error(400, "Invalid "+UWebSocketHandshake.SEC_WEBSOCKET_KEY));
+		}
+		final UWebSocket webSocket = newWebSocket(request);
+		final UHttpResponse response = new UHttpResponse(101).setUpgrade(new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				webSocket.install(channel);
+			}
+		});
+		response.headers().set(UHttpHeaders.UPGRADE, "websocket");
+		response.headers().set(UHttpHeaders.CONNECTION, "Upgrade");
+		response.headers().set(UWebSocketHandshake.SEC_WEBSOCKET_ACCEPT, UWebSocketHandshake.acceptKey(key));
+		return UFuture.succeeded(response);
+	}
+
+	/**
+	 * Creates the connection for an accepted opening handshake, may be overridden to use a listener per connection,
+	 * for example depending on the path of the request.
+	 * @param request
+	 * the request of the opening handshake.
+	 * @return
+	 * the new connection.
+	 * @throws Exception
+	 * if the request is rejected, like by the {@link UHttpHandler}.
+	 */
+	protected UWebSocket newWebSocket( final UHttpRequest request ) throws Exception {
+		return new UWebSocket(listener, false, maxMessageSize, json);
+	}
+}
@@ -0,0 +1,151 @@
+import static org.junit.Assert.*;
+
+import java.nio.ByteBuffer;
+import java.nio.charset.StandardCharsets;
+
+import org.junit.Test;
+
+import com.umpani.aio.UBuffer;
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UCompositeBuffer;
+import com.umpani.aio.exception.UIllegalReferenceCountException;
+
+public class TBuffer {
+	/**
+	 * Allocates a heap buffer containing the given text, ready to be read.
+	 */
+	private static UBuffer buffer( final UBufferPool pool, final String text ) {
+		final byte[] bytes = text.getBytes(StandardCharsets.UTF_8);
+		final UBuffer buffer = pool.heapBuffer(bytes.length);
+		buffer.nio().put(bytes).flip();
+		return buffer;
+	}
+
+	@Test
+	public void sizeClassesAndReuse() {
+		final UBufferPool pool = new UBufferPool(false, 64, 1024, 4, 4);
+		final UBuffer a = pool.allocate(100);
+		assertEquals(128, a.capacity());
+		assertEquals(100, a.nio().limit());
+		assertFalse(a.isDirect());
+		final ByteBuffer memory = a.nio();
+		assertTrue(a.release());
+		assertEquals(0, a.refCnt());
+		// the same thread gets the cached memory back
+		final UBuffer b = pool.allocate(128);
+		assertSame(memory, b.nio());
+		assertEquals(0, b.nio().position());
+		b.release();
+
+		final UBuffer big = pool.allocate(5000);
+		assertEquals(5000, big.capacity());
+		big.release();
+
+		final UBuffer direct = pool.directBuffer(10);
+		assertTrue(direct.isDirect());
+		assertEquals(64, direct.capacity());
+		direct.release();
+		assertEquals(0L, pool.getActive());
+	}
+
+	@Test
+	public void referenceCounting() {
+		final UBufferPool pool = new UBufferPool(false);
+		final UBuffer buffer = pool.allocate(10);
+		buffer.retain();
+		assertEquals(2, buffer.refCnt());
+		assertFalse(buffer.release());
+		assertTrue(buffer.release());
+		try {
+			buffer.release();
+			fail();
+		} catch (UIllegalReferenceCountException e) {
+			// expected
+		}
+		try {
+			buffer.nio();
+			fail();
+		} catch (UIllegalReferenceCountException e) {
+			// expected
+		}
+	}
+
+	@Test
+	public void sliceKeepsParentAlive() {
+		final UBufferPool pool = new UBufferPool(false);
+		final UBuffer buffer = buffer(pool, "hello world");
+		final UBuffer slice = buffer.retainedSlice(6, 5);
+		assertTrue(slice.isSlice());
+		assertFalse(buffer.release());
+		assertEquals(1L, pool.getActive());
+		assertEquals('w', slice.nio().get(0));
+		assertEquals(5, slice.remaining());
+		assertTrue(slice.release());
+		assertEquals(0, buffer.refCnt());
+		assertEquals(0L, pool.getActive());
+	}
+
+	@Test
+	public void leakDetection() {
+		final UBufferPool pool = new UBufferPool(false).setLeakDetection(1);
+		final UBuffer released = pool.allocate(10);
+		final UBuffer leaked = pool.allocate(10);
+		released.release();
+		assertEquals(1, pool.getUnreleased().size());
+		boolean found = false;
+		for (final StackTraceElement element : pool.getUnreleased().get(0).getStackTrace()) {
+			if ("leakDetection".equals(element.getMethodName())) found = true;
+		}
+		assertTrue("the allocation site is recorded", found);
+		leaked.release();
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	@Test
+	public void compositeAcrossComponents() {
+		final UBufferPool pool = new UBufferPool(false).setLeakDetection(1);
+		final UCompositeBuffer composite = new UCompositeBuffer();
+		composite.add(buffer(pool, "\u0000\u0000")).add(buffer(pool, "\u0000\u0005ab")).add(buffer(pool, "cde\nrest"));
+		assertEquals(14, composite.readableBytes());
+		assertEquals(3, composite.components());
+		assertEquals(5, composite.getInt(0));
+		assertEquals(9, composite.indexOf((byte)'\n', 0));
+		assertEquals(-1, composite.indexOf((byte)'x', 0));
+
+		assertEquals(5, composite.getInt(0));
+		composite.skipBytes(4);
+		// the first component is released as soon as it was read
+		assertEquals(2, composite.components());
+		final UCompositeBuffer frame = composite.readRetainedSlice(5);
+		assertEquals(2, frame.components());
+		final byte[] bytes = new byte[5];
+		frame.readBytes(bytes, 0, 5);
+		assertEquals("abcde", new String(bytes, StandardCharsets.UTF_8));
+		assertFalse(frame.isReadable());
+		frame.release();
+
+		assertEquals('\n', composite.readByte());
+		final UBuffer rest = composite.readBuffer(4, pool);
+		assertTrue(rest.isSlice());
+		assertEquals("rest", StandardCharsets.UTF_8.decode(rest.nio()).toString());
+		rest.release();
+		assertFalse(composite.isReadable());
+		composite.release();
+		assertTrue(pool.getUnreleased().isEmpty());
+		assertEquals(0L, pool.getActive());
+	}
+
+	@Test
+	public void readBufferCopiesSplitBytes() {
+		final UBufferPool pool = new UBufferPool(false).setLeakDetection(1);
+		final UCompositeBuffer composite = new UCompositeBuffer();
+		composite.add(buffer(pool, "ab")).add(buffer(pool, "cd"));
+		final UBuffer copy = composite.readBuffer(3, pool);
+		assertFalse(copy.isSlice());
+		assertEquals("abc", StandardCharsets.UTF_8.decode(copy.nio()).toString());
+		copy.release();
+		assertEquals(1, composite.readableBytes());
+		composite.release();
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+}
@@ -0,0 +1,127 @@
+import static org.junit.Assert.*;
+
+import java.util.ArrayList;
+import java.util.List;
+
+import org.junit.After;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UMemoryChannel;
+import com.umpani.aio.UVirtualEventLoop;
+import com.umpani.aio.bus.UBusHandler;
+import com.umpani.aio.codec.UNdjsonDecoder;
+import com.umpani.aio.codec.UNdjsonEncoder;
+import com.umpani.util.UMap;
+import com.umpani.util.bus.UBus;
+
+@SuppressWarnings("unchecked")
+public class TBusBridge {
+	private UVirtualEventLoop loop;
+	private UBufferPool pool;
+	private UBus bus;
+
+	@Before
+	public void setUp() throws Exception {
+		loop = new UVirtualEventLoop("test");
+		pool = new UBufferPool(false).setLeakDetection(1);
+		bus = new UBus();
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		loop.shutdown();
+		assertTrue(loop.isTerminated());
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	/**
+	 * Connects a remote subscriber that collects the received objects.
+	 */
+	private UMemoryChannel connect( final List<UMap<String,Object>> received, final UBusHandler handler ) {
+		final UFuture<UMemoryChannel> opened = UMemoryChannel.openStream(loop, pool, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new UNdjsonDecoder(), new UNdjsonEncoder(), new UChannelHandlerAdapter() {
+					@Override
+					public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+						received.add((UMap<String,Object>)msg);
+					}
+				});
+			}
+		}, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new UNdjsonDecoder(), new UNdjsonEncoder(), handler);
+			}
+		});
+		loop.runPending();
+		return opened.getNow();
+	}
+
+	@Test
+	public void remoteSubscriber() throws Exception {
+		final ArrayList<UMap<String,Object>> received = new ArrayList<>();
+		final UMemoryChannel client = connect(received, new UBusHandler(bus));
+		client.writeAndFlush(UMap.of(String.class, Object.class, "subscribe", "orders.*"));
+		loop.runPending();
+		assertEquals(1, bus.subscriptions().size());
+
+		bus.publish("orders.created", UMap.of(String.class, Object.class, "id", 1));
+		bus.publish("users.created", UMap.of(String.class, Object.class, "id", 2));
+		loop.runPending();
+		assertEquals(1, received.size());
+		assertEquals("orders.created", received.get(0).getString("topic"));
+		final UMap<String,Object> message = received.get(0).getMap("message");
+		assertEquals(1L, message.getLong("id"));
+
+		// publishing is not allowed by default
+		client.writeAndFlush(UMap.of(String.class, Object.class, "publish", "orders.created", "message", UMap.of(String.class, Object.class)));
+		client.writeAndFlush(UMap.of(String.class, Object.class, "subscribe", "orders..created"));
+		loop.runPending();
+		assertEquals("Publishing is not allowed", received.get(1).getString("error"));
+		assertNotNull(received.get(2).getString("error"));
+
+		client.writeAndFlush(UMap.of(String.class, Object.class, "unsubscribe", "orders.*"));
+		loop.runPending();
+		assertTrue(bus.subscriptions().isEmpty());
+		assertEquals(0, bus.publish("orders.created", UMap.of(String.class, Object.class, "id", 3)));
+
+		// closing the connection cancels the subscriptions
+		client.writeAndFlush(UMap.of(String.class, Object.class, "subscribe", "#"));
+		loop.runPending();
+		assertEquals(1, bus.subscriptions().size());
+		client.close();
+		loop.runPending();
+		assertTrue(bus.subscriptions().isEmpty());
+	}
+
+	@Test
+	public void remotePublisher() throws Exception {
+		final ArrayList<UMap<String,Object>> subscriber = new ArrayList<>();
+		final ArrayList<UMap<String,Object>> publisher = new ArrayList<>();
+		final UMemoryChannel first = connect(subscriber, new UBusHandler(bus));
+		final UMemoryChannel second = connect(publisher, new UBusHandler(bus).setAllowPublish(true));
+		first.writeAndFlush(UMap.of(String.class, Object.class, "subscribe", "orders.#"));
+		loop.runPending();
+		second.writeAndFlush(UMap.of(String.class, Object.class, "publish", "orders.eu.created", "message", UMap.of(String.class, Object.class, "id", 7)));
+		second.writeAndFlush(UMap.of(String.class, Object.class, "publish", "orders.*", "message", UMap.of(String.class, Object.class)));
+		loop.runPending();
+		assertEquals(1, subscriber.size());
+		assertEquals("orders.eu.created", subscriber.get(0).getString("topic"));
+		final UMap<String,Object> message = subscriber.get(0).getMap("message");
+		assertEquals(7L, message.getLong("id"));
+		// the topic with a wildcard is rejected
+		assertEquals(1, publisher.size());
+		assertNotNull(publisher.get(0).getString("error"));
+		first.close();
+		second.close();
+		loop.runPending();
+	}
+}
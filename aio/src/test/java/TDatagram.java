@@ -0,0 +1,231 @@
+import static org.junit.Assert.*;
+
+import java.net.Inet4Address;
+import java.net.InetAddress;
+import java.net.InetSocketAddress;
+import java.net.NetworkInterface;
+import java.net.StandardProtocolFamily;
+import java.net.StandardSocketOptions;
+import java.nio.charset.StandardCharsets;
+import java.util.Collections;
+import java.util.concurrent.BlockingQueue;
+import java.util.concurrent.ExecutionException;
+import java.util.concurrent.LinkedBlockingQueue;
+import java.util.concurrent.TimeUnit;
+
+import org.junit.After;
+import org.junit.Assume;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UDatagram;
+import com.umpani.aio.UDatagramChannel;
+import com.umpani.aio.UDatagramPacket;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.codec.UDatagramCodec;
+import com.umpani.aio.codec.UMapDatagram;
+import com.umpani.aio.exception.UCodecException;
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+
+public class TDatagram {
+	private UEventLoopGroup group;
+	private UBufferPool pool;
+
+	@Before
+	public void setUp() throws Exception {
+		group = new UEventLoopGroup("test", 2);
+		pool = new UBufferPool(false).setLeakDetection(1);
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		group.shutdown();
+		assertTrue(group.awaitTermination(5, TimeUnit.SECONDS));
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	/**
+	 * Creates an initializer that copies every received datagram as "sender text" into the given queue.
+	 */
+	private static UChannelInitializer collect( final BlockingQueue<String> received ) {
+		return new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new UChannelHandlerAdapter() {
+					@Override
+					public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+						final UDatagramPacket packet = (UDatagramPacket)msg;
+						received.add(packet.address()+" "+new String(packet.toByteArray(), StandardCharsets.UTF_8));
+						packet.release();
+					}
+				});
+			}
+		};
+	}
+
+	@Test
+	public void sendAndReceive() throws Exception {
+		final BlockingQueue<String> received = new LinkedBlockingQueue<>();
+		final UDatagramChannel receiver = new UDatagram(group, collect(received), pool).bind(new InetSocketAddress("127.0.0.1", 0)).get(5, TimeUnit.SECONDS);
+		final UDatagramChannel sender = new UDatagram(group, null, pool).bind(new InetSocketAddress("127.0.0.1", 0)).get(5, TimeUnit.SECONDS);
+		assertTrue(receiver.isActive());
+		assertNull(sender.remoteAddress());
+
+		for (int i=0; i < 10; i++) sender.write(new UDatagramPacket(("datagram "+i).getBytes(StandardCharsets.UTF_8), receiver.localAddress()));
+		sender.flush();
+		for (int i=0; i < 10; i++) assertEquals(sender.localAddress()+" datagram "+i, received.poll(5, TimeUnit.SECONDS));
+
+		// a failed datagram fails its own future only
+		try {
+			sender.writeAndFlush(new UDatagramPacket(new byte[1], InetSocketAddress.createUnresolved("unresolved.invalid", 1))).get(5, TimeUnit.SECONDS);
+			fail("Expected an ExecutionException");
+		} catch (ExecutionException e) {
+			// expected
+		}
+		try {
+			// an unconnected channel does not know where to send plain bytes
+			sender.writeAndFlush(new byte[1]).get(5, TimeUnit.SECONDS);
+			fail("Expected an ExecutionException");
+		} catch (ExecutionException e) {
+			// expected
+		}
+		assertTrue(sender.isActive());
+		sender.writeAndFlush(new UDatagramPacket("still open".getBytes(StandardCharsets.UTF_8), receiver.localAddress())).get(5, TimeUnit.SECONDS);
+		assertEquals(sender.localAddress()+" still open", received.poll(5, TimeUnit.SECONDS));
+
+		sender.close().get(5, TimeUnit.SECONDS);
+		receiver.close().get(5, TimeUnit.SECONDS);
+		assertFalse(receiver.javaChannel().isOpen());
+	}
+
+	@Test
+	public void connected() throws Exception {
+		final BlockingQueue<String> received = new LinkedBlockingQueue<>();
+		final UDatagramChannel receiver = new UDatagram(group, collect(received), pool).bind(new InetSocketAddress("127.0.0.1", 0)).get(5, TimeUnit.SECONDS);
+		final UDatagramChannel sender = new UDatagram(group, null, pool).connect(receiver.localAddress()).get(5, TimeUnit.SECONDS);
+		assertEquals(receiver.localAddress(), sender.remoteAddress());
+		sender.writeAndFlush("connected".getBytes(StandardCharsets.UTF_8)).get(5, TimeUnit.SECONDS);
+		assertEquals(sender.localAddress()+" connected", received.poll(5, TimeUnit.SECONDS));
+		sender.close().get(5, TimeUnit.SECONDS);
+		receiver.close().get(5, TimeUnit.SECONDS);
+	}
+
+	/**
+	 * Exchanges maps with the given format, the receiver echoes every map to its sender.
+	 */
+	@SuppressWarnings("unchecked")
+	private void exchangeMaps( final UDatagramCodec.Format format ) throws Exception {
+		final UDatagramChannel echo = new UDatagram(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new UDatagramCodec(format), new UChannelHandlerAdapter() {
+					@Override
+					public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+						final UMapDatagram datagram = (UMapDatagram)msg;
+						ctx.writeAndFlush(new UMapDatagram(UMap.of(String.class, Object.class, "echo", datagram.map()), datagram.address()));
+					}
+
+					@Override
+					public void exceptionCaught( final UHandlerContext ctx, final Throwable cause ) throws Exception {
+						if (!(cause instanceof UCodecException)) ctx.fireExceptionCaught(cause);
+					}
+				});
+			}
+		}, pool).bind(new InetSocketAddress("127.0.0.1", 0)).get(5, TimeUnit.SECONDS);
+
+		final BlockingQueue<UMapDatagram> replies = new LinkedBlockingQueue<>();
+		final UDatagramChannel client = new UDatagram(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new UDatagramCodec(format), new UChannelHandlerAdapter() {
+					@Override
+					public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+						replies.add((UMapDatagram)msg);
+					}
+				});
+			}
+		}, pool).connect(echo.localAddress()).get(5, TimeUnit.SECONDS);
+
+		final UMap<String,Object> map = UMap.of(String.class, Object.class, "metric", "cpu", "value", 0.75d, "tags", UList.of(Object.class, "a", "b"));
+		client.writeAndFlush(map).get(5, TimeUnit.SECONDS);
+		UMapDatagram reply = replies.poll(5, TimeUnit.SECONDS);
+		assertEquals(echo.localAddress(), reply.address());
+		assertEquals(map, reply.map().getMap("echo"));
+
+		// invalid datagrams are dropped, the next one is decoded
+		client.writeAndFlush(new byte[] { (byte)0xff, 0x00 }).get(5, TimeUnit.SECONDS);
+		client.writeAndFlush(UMap.of(String.class, Object.class, "n", 1L)).get(5, TimeUnit.SECONDS);
+		reply = replies.poll(5, TimeUnit.SECONDS);
+		assertEquals(1L, ((UMap<String,Object>)reply.map().get("echo")).getLong("n"));
+
+		client.close().get(5, TimeUnit.SECONDS);
+		echo.close().get(5, TimeUnit.SECONDS);
+	}
+
+	@Test
+	public void jsonCodec() throws Exception {
+		exchangeMaps(UDatagramCodec.Format.JSON);
+	}
+
+	@Test
+	public void cborCodec() throws Exception {
+		exchangeMaps(UDatagramCodec.Format.CBOR);
+	}
+
+	/**
+	 * Returns an interface that is up, supports multicast and has an IPv4 address, loopback interfaces are preferred.
+	 */
+	private static NetworkInterface findMulticastInterface() throws Exception {
+		NetworkInterface found = null;
+		for (final NetworkInterface ni : Collections.list(NetworkInterface.getNetworkInterfaces())) {
+			if (!ni.isUp() || !ni.supportsMulticast()) continue;
+			boolean ipv4 = false;
+			for (final InetAddress address : Collections.list(ni.getInetAddresses())) ipv4 |= address instanceof Inet4Address;
+			if (!ipv4) continue;
+			if (ni.isLoopback()) return ni;
+			if (found==null) found = ni;
+		}
+		return found;
+	}
+
+	@Test
+	public void multicast() throws Exception {
+		final NetworkInterface ni = findMulticastInterface();
+		Assume.assumeNotNull(ni);
+		final InetAddress groupAddress = InetAddress.getByName("239.255.42.99");
+
+		final BlockingQueue<String> received = new LinkedBlockingQueue<>();
+		final UDatagramChannel receiver = new UDatagram(group, collect(received), pool)
+				.setFamily(StandardProtocolFamily.INET)
+				.setOption(StandardSocketOptions.SO_REUSEADDR, true)
+				.bind(new InetSocketAddress(0)).get(5, TimeUnit.SECONDS);
+		receiver.joinGroup(groupAddress, ni);
+		final int port = ((InetSocketAddress)receiver.localAddress()).getPort();
+
+		final UDatagramChannel sender = new UDatagram(group, null, pool)
+				.setFamily(StandardProtocolFamily.INET)
+				.setOption(StandardSocketOptions.IP_MULTICAST_IF, ni)
+				.setOption(StandardSocketOptions.IP_MULTICAST_LOOP, true)
+				.bind(new InetSocketAddress(0)).get(5, TimeUnit.SECONDS);
+		final InetSocketAddress target = new InetSocketAddress(groupAddress, port);
+		sender.writeAndFlush(new UDatagramPacket("beacon".getBytes(StandardCharsets.UTF_8), target)).get(5, TimeUnit.SECONDS);
+		final String beacon = received.poll(5, TimeUnit.SECONDS);
+		assertNotNull(beacon);
+		assertTrue(beacon, beacon.endsWith(":"+((InetSocketAddress)sender.localAddress()).getPort()+" beacon"));
+
+		// once the group was left, no more datagrams arrive
+		assertTrue(receiver.leaveGroup(groupAddress, ni));
+		assertFalse(receiver.leaveGroup(groupAddress, ni));
+		sender.writeAndFlush(new UDatagramPacket("gone".getBytes(StandardCharsets.UTF_8), target)).get(5, TimeUnit.SECONDS);
+		assertNull(received.poll(500, TimeUnit.MILLISECONDS));
+
+		sender.close().get(5, TimeUnit.SECONDS);
+		receiver.close().get(5, TimeUnit.SECONDS);
+	}
+}
@@ -0,0 +1,227 @@
+import static org.junit.Assert.*;
+
+import java.io.InputStream;
+import java.io.OutputStream;
+import java.net.InetSocketAddress;
+import java.net.Socket;
+import java.nio.ByteBuffer;
+import java.nio.channels.SelectionKey;
+import java.nio.channels.ServerSocketChannel;
+import java.nio.channels.SocketChannel;
+import java.nio.charset.StandardCharsets;
+import java.util.concurrent.CountDownLatch;
+import java.util.concurrent.RejectedExecutionException;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicInteger;
+import java.util.concurrent.atomic.AtomicReference;
+
+import org.junit.After;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UEventLoop;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UIoHandlerAdapter;
+
+public class TEventLoop {
+	private UEventLoopGroup group;
+
+	@Before
+	public void setUp() throws Exception {
+		group = new UEventLoopGroup("test", 2);
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		group.shutdown();
+		assertTrue(group.awaitTermination(5, TimeUnit.SECONDS));
+	}
+
+	/**
+	 * A handler that echoes everything it reads.
+	 */
+	static class EchoHandler extends UIoHandlerAdapter {
+		final ByteBuffer buffer = ByteBuffer.allocate(1024);
+
+		@Override
+		public void read( final UEventLoop loop, final SelectionKey key ) throws Exception {
+			final SocketChannel channel = (SocketChannel)key.channel();
+			if (channel.read(buffer) < 0) {
+				channel.close();
+				return;
+			}
+			buffer.flip();
+			channel.write(buffer);
+			if (buffer.hasRemaining()) {
+				key.interestOps(SelectionKey.OP_WRITE);
+			}
+			buffer.compact();
+		}
+
+		@Override
+		public void write( final UEventLoop loop, final SelectionKey key ) throws Exception {
+			buffer.flip();
+			((SocketChannel)key.channel()).write(buffer);
+			if (!buffer.hasRemaining()) key.interestOps(SelectionKey.OP_READ);
+			buffer.compact();
+		}
+	}
+
+	/**
+	 * Starts an echo server at the loopback interface and returns its address.
+	 */
+	private InetSocketAddress startEchoServer( final AtomicInteger closed ) throws Exception {
+		final ServerSocketChannel server = ServerSocketChannel.open();
+		server.bind(new InetSocketAddress("127.0.0.1", 0));
+		group.next().register(server, SelectionKey.OP_ACCEPT, new UIoHandlerAdapter() {
+			@Override
+			public void accept( final UEventLoop loop, final SelectionKey key ) throws Exception {
+				final SocketChannel channel = server.accept();
+				if (channel==null) return;
+				group.next().register(channel, SelectionKey.OP_READ, new EchoHandler() {
+					@Override
+					public void closed( final UEventLoop loop, final SelectionKey key ) {
+						closed.incrementAndGet();
+					}
+				});
+			}
+		});
+		return (InetSocketAddress)server.getLocalAddress();
+	}
+
+	@Test
+	public void executeTasksInOrder() throws Exception {
+		final UEventLoop loop = group.get(0);
+		assertFalse(loop.inEventLoop());
+		final StringBuffer order = new StringBuffer();
+		final CountDownLatch done = new CountDownLatch(1);
+		for (int i=0; i < 10; i++) {
+			final int n = i;
+			loop.execute(new Runnable() {
+				@Override
+				public void run() {
+					assertTrue(loop.inEventLoop());
+					assertSame(loop, UEventLoop.current());
+					order.append(n);
+					if (n==9) done.countDown();
+				}
+			});
+		}
+		assertTrue(done.await(5, TimeUnit.SECONDS));
+		assertEquals("0123456789", order.toString());
+	}
+
+	@Test
+	public void echoOverLoopback() throws Exception {
+		final InetSocketAddress address = startEchoServer(new AtomicInteger());
+		try (Socket socket = new Socket(address.getAddress(), address.getPort())) {
+			socket.setSoTimeout(5000);
+			final OutputStream out = socket.getOutputStream();
+			final InputStream in = socket.getInputStream();
+			final byte[] data = "Hello event loop".getBytes(StandardCharsets.UTF_8);
+			out.write(data);
+			out.flush();
+			final byte[] echo = new byte[data.length];
+			int read = 0;
+			while (read < echo.length) {
+				final int n = in.read(echo, read, echo.length-read);
+				assertTrue(n > 0);
+				read += n;
+			}
+			assertArrayEquals(data, echo);
+		}
+	}
+
+	@Test
+	public void nonBlockingConnect() throws Exception {
+		final InetSocketAddress address = startEchoServer(new AtomicInteger());
+		final CountDownLatch echoed = new CountDownLatch(1);
+		final AtomicReference<String> result = new AtomicReference<String>();
+		final SocketChannel client = SocketChannel.open();
+		client.configureBlocking(false);
+		client.connect(address);
+		group.next().register(client, SelectionKey.OP_CONNECT, new UIoHandlerAdapter() {
+			final ByteBuffer buffer = ByteBuffer.allocate(16);
+
+			@Override
+			public void connect( final UEventLoop loop, final SelectionKey key ) throws Exception {
+				assertTrue(client.finishConnect());
+				client.write(ByteBuffer.wrap("ping".getBytes(StandardCharsets.UTF_8)));
+				key.interestOps(SelectionKey.OP_READ);
+			}
+
+			@Override
+			public void read( final UEventLoop loop, final SelectionKey key ) throws Exception {
+				client.read(buffer);
+				if (buffer.position()==4) {
+					result.set(new String(buffer.array(), 0, 4, StandardCharsets.UTF_8));
+					echoed.countDown();
+				}
+			}
+		});
+		assertTrue(echoed.await(5, TimeUnit.SECONDS));
+		assertEquals("ping", result.get());
+	}
+
+	@Test
+	public void shutdownClosesChannels() throws Exception {
+		final AtomicInteger closed = new AtomicInteger();
+		final InetSocketAddress address = startEchoServer(closed);
+		final Socket socket = new Socket(address.getAddress(), address.getPort());
+		socket.setSoTimeout(5000);
+		// ensure the connection was accepted and registered
+		socket.getOutputStream().write(1);
+		assertEquals(1, socket.getInputStream().read());
+
+		group.shutdown();
+		assertTrue(group.awaitTermination(5, TimeUnit.SECONDS));
+		assertEquals(1, closed.get());
+		assertEquals(-1, socket.getInputStream().read());
+		socket.close();
+		try {
+			group.next().execute(new Runnable() {
+				@Override
+				public void run() {}
+			});
+			fail();
+		} catch (RejectedExecutionException e) {
+			// expected
+		}
+	}
+
+	@Test
+	public void acceptedTasksRunDuringShutdown() throws Exception {
+		for (int round=0; round < 20; round++) {
+			final UEventLoopGroup racing = new UEventLoopGroup("race", 1);
+			final UEventLoop loop = racing.get(0);
+			final AtomicInteger executed = new AtomicInteger();
+			final AtomicInteger accepted = new AtomicInteger();
+			final Runnable task = new Runnable() {
+				@Override
+				public void run() {
+					executed.incrementAndGet();
+				}
+			};
+			final Thread submitter = new Thread() {
+				@Override
+				public void run() {
+					try {
+						while (true) {
+							loop.execute(task);
+							accepted.incrementAndGet();
+						}
+					} catch (RejectedExecutionException e) {
+						// the loop shuts down
+					}
+				}
+			};
+			submitter.start();
+			Thread.sleep(1);
+			racing.shutdown();
+			submitter.join(5000);
+			assertTrue(racing.awaitTermination(5, TimeUnit.SECONDS));
+			// every accepted task was executed, none was lost
+			assertEquals(accepted.get(), executed.get());
+		}
+	}
+}
@@ -0,0 +1,315 @@
+import static org.junit.Assert.*;
+
+import java.io.ByteArrayOutputStream;
+import java.io.InputStream;
+import java.net.InetSocketAddress;
+import java.net.Socket;
+import java.nio.ByteBuffer;
+import java.nio.channels.FileChannel;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.nio.file.NoSuchFileException;
+import java.nio.file.Path;
+import java.nio.file.StandardOpenOption;
+import java.nio.file.StandardWatchEventKinds;
+import java.nio.file.WatchEvent;
+import java.security.KeyStore;
+import java.util.Arrays;
+import java.util.Random;
+import java.util.concurrent.CountDownLatch;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicBoolean;
+
+import org.junit.After;
+import org.junit.Before;
+import org.junit.Rule;
+import org.junit.Test;
+import org.junit.rules.TemporaryFolder;
+
+import com.umpani.aio.UBuffer;
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UClient;
+import com.umpani.aio.UEventLoop;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UServer;
+import com.umpani.aio.file.UAsyncFile;
+import com.umpani.aio.file.UDirectoryListener;
+import com.umpani.aio.file.UDirectoryWatcher;
+import com.umpani.aio.http.UHttpClient;
+import com.umpani.aio.http.UHttpFileHandler;
+import com.umpani.aio.http.UHttpHeaders;
+import com.umpani.aio.http.UHttpRequest;
+import com.umpani.aio.http.UHttpResponse;
+import com.umpani.aio.http.UHttpRouter;
+import com.umpani.aio.http.UHttpServer;
+import com.umpani.aio.ssl.USslContext;
+
+public class TFile {
+	@Rule
+	public final TemporaryFolder folder = new TemporaryFolder();
+	private UEventLoopGroup group;
+	private UBufferPool pool;
+
+	@Before
+	public void setUp() throws Exception {
+		group = new UEventLoopGroup("test", 2);
+		pool = new UBufferPool(false).setLeakDetection(1);
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		group.shutdown();
+		assertTrue(group.awaitTermination(5, TimeUnit.SECONDS));
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	/**
+	 * Creates a file with random content.
+	 */
+	private Path createFile( final String name, final int size ) throws Exception {
+		final byte[] data = new byte[size];
+		new Random(size).nextBytes(data);
+		return Files.write(folder.getRoot().toPath().resolve(name), data);
+	}
+
+	@Test
+	public void asyncFile() throws Exception {
+		final UEventLoop loop = group.next();
+		final Path path = folder.getRoot().toPath().resolve("async.bin");
+		final byte[] data = new byte[100000];
+		new Random(3).nextBytes(data);
+		try (UAsyncFile file = UAsyncFile.open(path, loop, StandardOpenOption.CREATE, StandardOpenOption.READ, StandardOpenOption.WRITE)) {
+			final CountDownLatch latch = new CountDownLatch(1);
+			final AtomicBoolean onLoop = new AtomicBoolean();
+			file.writeFully(data, 10).addListener(new UFutureListener<Void>() {
+				@Override
+				public void complete( final UFuture<Void> future ) {
+					onLoop.set(loop.inEventLoop());
+					latch.countDown();
+				}
+			});
+			assertTrue(latch.await(5, TimeUnit.SECONDS));
+			assertTrue(onLoop.get());
+			assertEquals(data.length + 10, file.size());
+
+			final UBuffer buffer = file.read(10, data.length, pool).get(5, TimeUnit.SECONDS);
+			try {
+				final byte[] read = new byte[buffer.remaining()];
+				buffer.nio().get(read);
+				assertArrayEquals(data, read);
+			} finally {
+				buffer.release();
+			}
+			// the file ends before the requested length
+			final UBuffer tail = file.read(data.length, 100, pool).get(5, TimeUnit.SECONDS);
+			assertEquals(10, tail.remaining());
+			tail.release();
+			assertEquals(-1, file.read(ByteBuffer.allocate(10), data.length + 10).get(5, TimeUnit.SECONDS).intValue());
+			assertEquals(4, file.write(ByteBuffer.wrap("abcd".getBytes(StandardCharsets.US_ASCII)), 0).get(5, TimeUnit.SECONDS).intValue());
+		}
+		try {
+			UAsyncFile.open(folder.getRoot().toPath().resolve("missing"), null);
+			fail("Expected a failure");
+		} catch (NoSuchFileException e) {
+			// expected
+		}
+	}
+
+	/**
+	 * Starts a server that sends a region of the given file to every client and closes the connection.
+	 */
+	private UServer startFileServer( final Path path, final long position, final long count, final USslContext ssl ) throws Exception {
+		final UServer server = new UServer(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				if (ssl!=null) channel.pipeline().addLast(ssl.newHandler());
+				channel.pipeline().addLast(new UChannelHandlerAdapter() {
+					@Override
+					public void channelActive( final UHandlerContext ctx ) throws Exception {
+						ctx.fireChannelActive();
+						final FileChannel file = FileChannel.open(path, StandardOpenOption.READ);
+						ctx.channel().sendFile(file, position, count).addListener(new UFutureListener<Void>() {
+							@Override
+							public void complete( final UFuture<Void> future ) {
+								try {
+									file.close();
+								} catch (Exception e) {
+									// read only
+								}
+								ctx.close();
+							}
+						});
+					}
+
+					@Override
+					public void exceptionCaught( final UHandlerContext ctx, final Throwable cause ) {
+						// the client closes the connection
+					}
+				});
+			}
+		}, pool);
+		server.bind(new InetSocketAddress("127.0.0.1", 0));
+		return server;
+	}
+
+	@Test
+	public void sendFile() throws Exception {
+		final Path path = createFile("send.bin", 3000000);
+		final byte[] data = Files.readAllBytes(path);
+		final UServer server = startFileServer(path, 100, data.length - 200, null);
+		final ByteArrayOutputStream received = new ByteArrayOutputStream();
+		try (Socket socket = new Socket("127.0.0.1", server.localAddress().getPort())) {
+			socket.setSoTimeout(5000);
+			final InputStream in = socket.getInputStream();
+			final byte[] buffer = new byte[65536];
+			int n;
+			while ((n = in.read(buffer)) >= 0) received.write(buffer, 0, n);
+		}
+		assertArrayEquals(Arrays.copyOfRange(data, 100, data.length - 100), received.toByteArray());
+		server.close().get(5, TimeUnit.SECONDS);
+	}
+
+	@Test
+	public void sendFileWithTls() throws Exception {
+		final char[] password = "changeit".toCharArray();
+		final KeyStore keys = TSsl.generate("server", "CN=localhost");
+		final Path path = createFile("tls.bin", 1000000);
+		final byte[] data = Files.readAllBytes(path);
+		final UServer server = startFileServer(path, 0, data.length, USslContext.forServer(keys, password));
+		final USslContext ssl = USslContext.forClient(keys);
+		final ByteArrayOutputStream received = new ByteArrayOutputStream();
+		final CountDownLatch closed = new CountDownLatch(1);
+		final UClient client = new UClient(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(ssl.newHandler("127.0.0.1", server.localAddress().getPort()), new UChannelHandlerAdapter() {
+					@Override
+					public void channelRead( final UHandlerContext ctx, final Object msg ) {
+						final UBuffer buffer = (UBuffer)msg;
+						final byte[] bytes = new byte[buffer.remaining()];
+						buffer.nio().get(bytes);
+						buffer.release();
+						received.write(bytes, 0, bytes.length);
+					}
+
+					@Override
+					public void channelInactive( final UHandlerContext ctx ) {
+						closed.countDown();
+					}
+				});
+			}
+		}, pool);
+		client.connect(server.localAddress()).get(5, TimeUnit.SECONDS);
+		// the region is encrypted in chunks, while the channel is writable
+		assertTrue(closed.await(10, TimeUnit.SECONDS));
+		assertArrayEquals(data, received.toByteArray());
+		server.close().get(5, TimeUnit.SECONDS);
+	}
+
+	@Test
+	public void staticFiles() throws Exception {
+		final Path path = createFile("data.bin", 5000);
+		final byte[] data = Files.readAllBytes(path);
+		Files.write(folder.getRoot().toPath().resolve("index.html"), "<h1>index</h1>".getBytes(StandardCharsets.UTF_8));
+		Files.write(folder.getRoot().toPath().resolve(".secret"), "secret".getBytes(StandardCharsets.UTF_8));
+		final UHttpRouter router = new UHttpRouter();
+		router.get("/static/*", new UHttpFileHandler(folder.getRoot().toPath()).setCacheControl("max-age=60"));
+		final UHttpServer server = new UHttpServer(group, router, pool);
+		final String url = "http://127.0.0.1:"+server.bind(new InetSocketAddress("127.0.0.1", 0)).getPort()+"/static/";
+		final UHttpClient client = new UHttpClient(group, pool);
+		try {
+			UHttpResponse response = client.get(url+"data.bin").get(5, TimeUnit.SECONDS);
+			assertEquals(200, response.status());
+			assertArrayEquals(data, response.body());
+			assertEquals("application/octet-stream", response.headers().get(UHttpHeaders.CONTENT_TYPE));
+			assertEquals("bytes", response.headers().get(UHttpHeaders.ACCEPT_RANGES));
+			assertEquals("max-age=60", response.headers().get(UHttpHeaders.CACHE_CONTROL));
+			assertNotNull(response.headers().get(UHttpHeaders.LAST_MODIFIED));
+			final String etag = response.headers().get(UHttpHeaders.ETAG);
+			assertTrue(etag.startsWith("\""));
+
+			UHttpRequest request = new UHttpRequest("GET", url+"data.bin");
+			request.headers().set(UHttpHeaders.IF_NONE_MATCH, "\"other\", W/"+etag);
+			response = client.send(request).get(5, TimeUnit.SECONDS);
+			assertEquals(304, response.status());
+			assertEquals(etag, response.headers().get(UHttpHeaders.ETAG));
+
+			request = new UHttpRequest("GET", url+"data.bin");
+			request.headers().set(UHttpHeaders.RANGE, "bytes=10-19");
+			response = client.send(request).get(5, TimeUnit.SECONDS);
+			assertEquals(206, response.status());
+			assertEquals("bytes 10-19/5000", response.headers().get(UHttpHeaders.CONTENT_RANGE));
+			assertArrayEquals(Arrays.copyOfRange(data, 10, 20), response.body());
+
+			request = new UHttpRequest("GET", url+"data.bin");
+			request.headers().set(UHttpHeaders.RANGE, "bytes=-5");
+			response = client.send(request).get(5, TimeUnit.SECONDS);
+			assertEquals(206, response.status());
+			assertArrayEquals(Arrays.copyOfRange(data, 4995, 5000), response.body());
+
+			request = new UHttpRequest("GET", url+"data.bin");
+			request.headers().set(UHttpHeaders.RANGE, "bytes=4990-9999");
+			request.headers().set(UHttpHeaders.IF_RANGE, etag);
+			response = client.send(request).get(5, TimeUnit.SECONDS);
+			assertEquals(206, response.status());
+			assertEquals("bytes 4990-4999/5000", response.headers().get(UHttpHeaders.CONTENT_RANGE));
+
+			// the file changed, so the whole file is sent
+			request.headers().set(UHttpHeaders.IF_RANGE, "\"old\"");
+			response = client.send(request).get(5, TimeUnit.SECONDS);
+			assertEquals(200, response.status());
+			assertArrayEquals(data, response.body());
+
+			request = new UHttpRequest("GET", url+"data.bin");
+			request.headers().set(UHttpHeaders.RANGE, "bytes=5000-");
+			response = client.send(request).get(5, TimeUnit.SECONDS);
+			assertEquals(416, response.status());
+			assertEquals("bytes */5000", response.headers().get(UHttpHeaders.CONTENT_RANGE));
+
+			response = client.get(url).get(5, TimeUnit.SECONDS);
+			assertEquals(200, response.status());
+			assertEquals("<h1>index</h1>", response.bodyAsString());
+			assertTrue(response.headers().get(UHttpHeaders.CONTENT_TYPE).startsWith("text/html"));
+
+			assertEquals(404, client.get(url+"missing.bin").get(5, TimeUnit.SECONDS).status());
+			assertEquals(404, client.get(url+".secret").get(5, TimeUnit.SECONDS).status());
+			assertEquals(404, client.get(url+"..%2F..%2Fetc%2Fpasswd").get(5, TimeUnit.SECONDS).status());
+		} finally {
+			client.close();
+			server.close().get(5, TimeUnit.SECONDS);
+		}
+	}
+
+	@Test
+	public void directoryWatcher() throws Exception {
+		final UEventLoop loop = group.next();
+		final Path directory = folder.newFolder("watched").toPath();
+		final CountDownLatch latch = new CountDownLatch(1);
+		final AtomicBoolean onLoop = new AtomicBoolean();
+		final Path created = directory.resolve("created.txt");
+		try (UDirectoryWatcher watcher = new UDirectoryWatcher(loop, new UDirectoryListener() {
+			@Override
+			public void onEvent( final WatchEvent.Kind<?> kind, final Path path ) {
+				if (kind==StandardWatchEventKinds.ENTRY_CREATE && path.equals(created)) {
+					onLoop.set(loop.inEventLoop());
+					latch.countDown();
+				}
+			}
+		})) {
+			watcher.register(directory);
+			assertTrue(watcher.isWatched(directory));
+			Files.write(created, "hello".getBytes(StandardCharsets.UTF_8));
+			// some platforms poll the file system every few seconds
+			assertTrue(latch.await(15, TimeUnit.SECONDS));
+			assertTrue(onLoop.get());
+			assertTrue(watcher.unregister(directory));
+			assertFalse(watcher.isWatched(directory));
+		}
+	}
+}
@@ -0,0 +1,231 @@
+import static org.junit.Assert.*;
+
+import java.util.List;
+import java.util.concurrent.CancellationException;
+import java.util.concurrent.CountDownLatch;
+import java.util.concurrent.ExecutionException;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.TimeoutException;
+import java.util.concurrent.atomic.AtomicBoolean;
+import java.util.concurrent.atomic.AtomicInteger;
+import java.util.concurrent.atomic.AtomicReference;
+
+import org.junit.After;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UEventLoop;
+import com.umpani.aio.UFunction;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UFutureListener;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.exception.UBlockingOperationException;
+
+public class TFuture {
+	private UEventLoop loop;
+
+	@Before
+	public void setUp() throws Exception {
+		loop = new UEventLoop("future").start();
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		loop.shutdown();
+		assertTrue(loop.awaitTermination(5, TimeUnit.SECONDS));
+	}
+
+	@Test
+	public void listenersRunInLoop() throws Exception {
+		final UPromise<String> promise = new UPromise<String>(loop);
+		final CountDownLatch done = new CountDownLatch(2);
+		final AtomicBoolean inLoop = new AtomicBoolean(true);
+		final UFutureListener<String> listener = new UFutureListener<String>() {
+			@Override
+			public void complete( final UFuture<String> future ) {
+				if (!loop.inEventLoop() || !"x".equals(future.getNow())) inLoop.set(false);
+				done.countDown();
+			}
+		};
+		promise.addListener(listener);
+		assertTrue(promise.complete("x"));
+		assertFalse(promise.complete("y"));
+		// added after completion
+		promise.addListener(listener);
+		assertTrue(done.await(5, TimeUnit.SECONDS));
+		assertTrue(inLoop.get());
+		assertEquals("x", promise.get());
+	}
+
+	@Test
+	public void mapFlatMapRecover() throws Exception {
+		final UPromise<Integer> promise = new UPromise<Integer>(loop);
+		final UFuture<String> result = promise.map(new UFunction<Integer,Integer>() {
+			@Override
+			public Integer apply( final Integer value ) {
+				return value * 2;
+			}
+		}).flatMap(new UFunction<Integer,UFuture<String>>() {
+			@Override
+			public UFuture<String> apply( final Integer value ) {
+				return UFuture.succeeded("v" + value);
+			}
+		});
+		promise.complete(21);
+		assertEquals("v42", result.get(5, TimeUnit.SECONDS));
+
+		final UFuture<String> recovered = UFuture.<String>failed(new IllegalStateException("boom")).recover(new UFunction<Throwable,String>() {
+			@Override
+			public String apply( final Throwable cause ) {
+				return cause.getMessage();
+			}
+		});
+		assertEquals("boom", recovered.get());
+
+		final UFuture<Integer> failed = UFuture.succeeded(1).map(new UFunction<Integer,Integer>() {
+			@Override
+			public Integer apply( final Integer value ) throws Exception {
+				throw new IllegalArgumentException("map");
+			}
+		});
+		try {
+			failed.get();
+			fail();
+		} catch (ExecutionException e) {
+			assertTrue(e.getCause() instanceof IllegalArgumentException);
+		}
+	}
+
+	@Test
+	public void cancelPropagates() throws Exception {
+		final AtomicBoolean aborted = new AtomicBoolean();
+		final UPromise<Integer> source = new UPromise<Integer>(loop).onCancel(new Runnable() {
+			@Override
+			public void run() {
+				aborted.set(true);
+			}
+		});
+		final UFuture<Integer> derived = source.map(new UFunction<Integer,Integer>() {
+			@Override
+			public Integer apply( final Integer value ) {
+				return value;
+			}
+		});
+		assertTrue(derived.cancel(false));
+		assertTrue(derived.isCancelled());
+		assertTrue(source.isCancelled());
+		assertTrue(aborted.get());
+		assertFalse(source.complete(1));
+		try {
+			source.get();
+			fail();
+		} catch (CancellationException e) {
+			// expected
+		}
+	}
+
+	@Test
+	public void cancelHandlerNeverLost() throws Exception {
+		for (int round=0; round < 1000; round++) {
+			final UPromise<Integer> promise = new UPromise<Integer>();
+			final AtomicInteger aborted = new AtomicInteger();
+			final CountDownLatch start = new CountDownLatch(1);
+			final Thread canceller = new Thread() {
+				@Override
+				public void run() {
+					try {
+						start.await();
+					} catch (InterruptedException e) {
+						return;
+					}
+					promise.cancel(false);
+				}
+			};
+			canceller.start();
+			start.countDown();
+			promise.onCancel(new Runnable() {
+				@Override
+				public void run() {
+					aborted.incrementAndGet();
+				}
+			});
+			canceller.join(5000);
+			assertTrue(promise.isCancelled());
+			// the handler runs exactly once, whether it was set before or after the cancellation
+			assertEquals(1, aborted.get());
+		}
+	}
+
+	@Test
+	public void timeout() throws Exception {
+		final UPromise<String> never = new UPromise<String>(loop);
+		final UFuture<String> timed = never.withTimeout(50, TimeUnit.MILLISECONDS);
+		try {
+			timed.get(5, TimeUnit.SECONDS);
+			fail();
+		} catch (ExecutionException e) {
+			assertTrue(e.getCause() instanceof TimeoutException);
+		}
+		assertTrue(never.isCancelled());
+
+		final UPromise<String> fast = new UPromise<String>(loop);
+		final UFuture<String> ok = fast.withTimeout(5, TimeUnit.SECONDS);
+		fast.complete("ok");
+		assertEquals("ok", ok.get(5, TimeUnit.SECONDS));
+	}
+
+	@Test
+	public void allAndAny() throws Exception {
+		final UPromise<Integer> a = new UPromise<Integer>(loop);
+		final UPromise<Integer> b = new UPromise<Integer>(loop);
+		final UFuture<List<Integer>> all = UFuture.all(a, b);
+		final UFuture<Integer> any = UFuture.any(a, b);
+		b.complete(2);
+		assertEquals(Integer.valueOf(2), any.get(5, TimeUnit.SECONDS));
+		assertFalse(all.isDone());
+		a.complete(1);
+		assertEquals(2, all.get(5, TimeUnit.SECONDS).size());
+		assertEquals(Integer.valueOf(1), all.get().get(0));
+
+		final UFuture<List<Integer>> failed = UFuture.all(UFuture.succeeded(1), UFuture.<Integer>failed(new IllegalStateException()));
+		assertTrue(failed.cause() instanceof IllegalStateException);
+	}
+
+	@Test
+	public void blockingInLoopThrows() throws Exception {
+		final AtomicReference<Throwable> error = new AtomicReference<Throwable>();
+		final CountDownLatch done = new CountDownLatch(1);
+		loop.execute(new Runnable() {
+			@Override
+			public void run() {
+				try {
+					new UPromise<Void>().await();
+				} catch (Throwable t) {
+					error.set(t);
+				}
+				done.countDown();
+			}
+		});
+		assertTrue(done.await(5, TimeUnit.SECONDS));
+		assertTrue(error.get() instanceof UBlockingOperationException);
+	}
+
+	@Test
+	public void scheduleRunsAfterDelay() throws Exception {
+		final long start = System.nanoTime();
+		final UFuture<Void> first = loop.schedule(new Runnable() {
+			@Override
+			public void run() {}
+		}, 50, TimeUnit.MILLISECONDS);
+		final UFuture<Void> cancelled = loop.schedule(new Runnable() {
+			@Override
+			public void run() {
+				fail();
+			}
+		}, 10, TimeUnit.MILLISECONDS);
+		cancelled.cancel(false);
+		first.get(5, TimeUnit.SECONDS);
+		assertTrue(System.nanoTime() - start >= TimeUnit.MILLISECONDS.toNanos(50));
+		assertTrue(cancelled.isCancelled());
+	}
+}
@@ -0,0 +1,400 @@
+import static org.junit.Assert.*;
+
+import java.io.BufferedInputStream;
+import java.io.ByteArrayOutputStream;
+import java.io.IOException;
+import java.io.InputStream;
+import java.io.OutputStream;
+import java.net.InetSocketAddress;
+import java.net.Socket;
+import java.nio.charset.StandardCharsets;
+import java.util.concurrent.TimeUnit;
+
+import org.junit.After;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UEventLoop;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.exception.UHttpException;
+import com.umpani.aio.http.UHttpHandler;
+import com.umpani.aio.http.UHttpHeaders;
+import com.umpani.aio.http.UHttpRequest;
+import com.umpani.aio.http.UHttpResponse;
+import com.umpani.aio.http.UHttpRouter;
+import com.umpani.aio.http.UHttpServer;
+import com.umpani.aio.http.UHttpServerHandler;
+import com.umpani.aio.http.UHttpStream;
+import com.umpani.aio.http.UHttpStreamer;
+import com.umpani.util.UMap;
+import com.umpani.util.json.UJsonReader;
+
+@SuppressWarnings("unchecked")
+public class THttp {
+	private UEventLoopGroup group;
+	private UBufferPool pool;
+	private UHttpServer server;
+	private InetSocketAddress address;
+
+	@Before
+	public void setUp() throws Exception {
+		group = new UEventLoopGroup("test", 2);
+		pool = new UBufferPool(false).setLeakDetection(1);
+		final UHttpRouter router = new UHttpRouter();
+		router.get("/users/{id}", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				final String id = request.getPathParameter("id");
+				if (id.equals("0")) return UFuture.failed(new UHttpException(404, "No such user"));
+				return UFuture.succeeded(UMap.of(String.class, Object.class, "id", id, "fields", request.getQueryParameter("fields")));
+			}
+		});
+		router.post("/users", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) throws Exception {
+				final UMap<String,Object> user = (UMap<String,Object>)request.json();
+				user.put("id", "42");
+				return UFuture.succeeded(UHttpResponse.json(201, user));
+			}
+		});
+		router.get("/slow", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				final UPromise<Object> promise = new UPromise<Object>(null);
+				UEventLoop.current().schedule(new Runnable() {
+					@Override
+					public void run() {
+						promise.complete("slow");
+					}
+				}, 100, TimeUnit.MILLISECONDS);
+				return promise;
+			}
+		});
+		router.get("/fast", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return UFuture.succeeded("fast");
+			}
+		});
+		router.get("/bye", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				final UHttpResponse response = UHttpResponse.text(200, "bye");
+				response.headers().set(UHttpHeaders.CONNECTION, "close");
+				return UFuture.succeeded(response);
+			}
+		});
+		router.get("/stream", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return UFuture.succeeded(new UHttpResponse(200).setStreamer(new UHttpStreamer() {
+					@Override
+					public void stream( final UHttpStream stream ) {
+						new Thread() {
+							@Override
+							public void run() {
+								for (int i=0; i < 3; i++) stream.write("part"+i+";");
+								stream.end();
+							}
+						}.start();
+					}
+				}));
+			}
+		});
+		router.get("/files/*", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return UFuture.succeeded(request.getPathParameter("*"));
+			}
+		});
+		router.delete("/users/{id}", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return null;
+			}
+		});
+		router.get("/fail", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				throw new IllegalStateException("expected failure");
+			}
+		});
+		server = new UHttpServer(group, router, pool).setMaxHeaderSize(1024).setMaxBodySize(1024);
+		address = server.bind(new InetSocketAddress("127.0.0.1", 0));
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		server.close().get(5, TimeUnit.SECONDS);
+		group.shutdown();
+		assertTrue(group.awaitTermination(5, TimeUnit.SECONDS));
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	/**
+	 * A response as read by the test client.
+	 */
+	static class Response {
+		String statusLine;
+		int status;
+		final UHttpHeaders headers = new UHttpHeaders();
+		String body;
+
+		UMap<String,Object> json() throws IOException {
+			return (UMap<String,Object>)UJsonReader.parse(body);
+		}
+	}
+
+	private static String readLine( final InputStream in ) throws IOException {
+		final StringBuilder sb = new StringBuilder();
+		int c;
+		while ((c = in.read())!='\n') {
+			if (c < 0) return sb.length()==0 ? null : sb.toString();
+			if (c!='\r') sb.append((char)c);
+		}
+		return sb.toString();
+	}
+
+	private static Response read( final InputStream in, final boolean head ) throws IOException {
+		final Response response = new Response();
+		response.statusLine = readLine(in);
+		if (response.statusLine==null) return null;
+		response.status = Integer.parseInt(response.statusLine.split(" ")[1]);
+		String line;
+		while (!(line = readLine(in)).isEmpty()) {
+			final int colon = line.indexOf(':');
+			response.headers.add(line.substring(0, colon), line.substring(colon + 1).trim());
+		}
+		final ByteArrayOutputStream body = new ByteArrayOutputStream();
+		if (head || response.status==204 || response.status==100) {
+			// no body
+		} else
+		if (response.headers.contains(UHttpHeaders.TRANSFER_ENCODING, "chunked")) {
+			int size;
+			while ((size = Integer.parseInt(readLine(in), 16)) > 0) {
+				for (int i=0; i < size; i++) body.write(in.read());
+				assertEquals("", readLine(in));
+			}
+			assertEquals("", readLine(in));
+		} else
+		if (response.headers.contains(UHttpHeaders.CONTENT_LENGTH)) {
+			final long length = response.headers.getLong(UHttpHeaders.CONTENT_LENGTH, 0);
+			for (int i=0; i < length; i++) body.write(in.read());
+		} else {
+			int c;
+			while ((c = in.read()) >= 0) body.write(c);
+		}
+		response.body = new String(body.toByteArray(), StandardCharsets.UTF_8);
+		return response;
+	}
+
+	private Socket connect() throws IOException {
+		final Socket socket = new Socket(address.getAddress(), address.getPort());
+		socket.setSoTimeout(5000);
+		return socket;
+	}
+
+	private static void send( final Socket socket, final String request ) throws IOException {
+		final OutputStream out = socket.getOutputStream();
+		out.write(request.getBytes(StandardCharsets.UTF_8));
+		out.flush();
+	}
+
+	@Test
+	public void routesAndJson() throws Exception {
+		try (Socket socket = connect()) {
+			final InputStream in = new BufferedInputStream(socket.getInputStream());
+			send(socket, "GET /users/a%20b?fields=name+mail HTTP/1.1\r\nHost: test\r\n\r\n");
+			Response response = read(in, false);
+			assertEquals(200, response.status);
+			assertEquals("application/json", response.headers.get("content-type"));
+			assertEquals("a b", response.json().getString("id"));
+			assertEquals("name mail", response.json().getString("fields"));
+
+			final String json = "{\"name\":\"Jürgen\"}";
+			send(socket, "POST /users HTTP/1.1\r\nHost: test\r\nContent-Type: application/json\r\nContent-Length: "+json.getBytes(StandardCharsets.UTF_8).length+"\r\n\r\n"+json);
+			response = read(in, false);
+			assertEquals(201, response.status);
+			assertEquals("Jürgen", response.json().getString("name"));
+			assertEquals("42", response.json().getString("id"));
+
+			send(socket, "POST /users HTTP/1.1\r\nContent-Length: 3\r\n\r\n{x}");
+			response = read(in, false);
+			assertEquals(400, response.status);
+
+			send(socket, "GET /users/0 HTTP/1.1\r\n\r\n");
+			response = read(in, false);
+			assertEquals(404, response.status);
+			assertEquals("No such user", response.json().getString("error"));
+
+			send(socket, "GET /nothing HTTP/1.1\r\n\r\n");
+			assertEquals(404, read(in, false).status);
+
+			send(socket, "PUT /users/1 HTTP/1.1\r\nContent-Length: 0\r\n\r\n");
+			response = read(in, false);
+			assertEquals(405, response.status);
+			assertEquals("GET, DELETE", response.headers.get(UHttpHeaders.ALLOW));
+
+			send(socket, "DELETE /users/1 HTTP/1.1\r\n\r\n");
+			assertEquals(204, read(in, false).status);
+
+			send(socket, "HEAD /users/1 HTTP/1.1\r\n\r\n");
+			response = read(in, true);
+			assertEquals(200, response.status);
+			assertTrue(response.headers.getLong(UHttpHeaders.CONTENT_LENGTH, 0) > 0);
+
+			send(socket, "GET /files/a/b%2Fc/d.txt HTTP/1.1\r\n\r\n");
+			assertEquals("a/b/c/d.txt", read(in, false).body);
+
+			send(socket, "GET /fail HTTP/1.1\r\n\r\n");
+			assertEquals(500, read(in, false).status);
+		}
+	}
+
+	@Test
+	public void pipeliningKeepsOrder() throws Exception {
+		try (Socket socket = connect()) {
+			final InputStream in = new BufferedInputStream(socket.getInputStream());
+			send(socket, "GET /slow HTTP/1.1\r\n\r\nGET /fast HTTP/1.1\r\n\r\nGET /stream HTTP/1.1\r\n\r\nGET /fast HTTP/1.1\r\nConnection: close\r\n\r\nGET /fast HTTP/1.1\r\n\r\n");
+			assertEquals("slow", read(in, false).body);
+			assertEquals("fast", read(in, false).body);
+			final Response streamed = read(in, false);
+			assertEquals("chunked", streamed.headers.get(UHttpHeaders.TRANSFER_ENCODING));
+			assertEquals("part0;part1;part2;", streamed.body);
+			final Response last = read(in, false);
+			assertEquals("fast", last.body);
+			assertEquals("close", last.headers.get(UHttpHeaders.CONNECTION));
+			// the request after the closing one is ignored
+			assertEquals(-1, in.read());
+		}
+	}
+
+	@Test
+	public void pipeliningStopsAtClosingResponse() throws Exception {
+		try (Socket socket = connect()) {
+			final InputStream in = new BufferedInputStream(socket.getInputStream());
+			// the slow request delays the closing response until the following requests are handled
+			send(socket, "GET /slow HTTP/1.1\r\n\r\nGET /bye HTTP/1.1\r\n\r\nGET /fast HTTP/1.1\r\n\r\nGET /fast HTTP/1.1\r\n\r\n");
+			assertEquals("slow", read(in, false).body);
+			final Response bye = read(in, false);
+			assertEquals("bye", bye.body);
+			assertEquals("close", bye.headers.get(UHttpHeaders.CONNECTION));
+			assertEquals(-1, in.read());
+		}
+	}
+
+	@Test
+	public void pipeliningBeyondPendingLimit() throws Exception {
+		try (Socket socket = connect()) {
+			final InputStream in = new BufferedInputStream(socket.getInputStream());
+			final int n = UHttpServerHandler.DEFAULT_MAX_PENDING_REQUESTS * 3;
+			final StringBuilder sb = new StringBuilder("GET /slow HTTP/1.1\r\n\r\n");
+			for (int i=1; i < n; i++) sb.append("GET /fast HTTP/1.1\r\n\r\n");
+			send(socket, sb.toString());
+			assertEquals("slow", read(in, false).body);
+			for (int i=1; i < n; i++) assertEquals("fast", read(in, false).body);
+		}
+	}
+
+	@Test
+	public void http10() throws Exception {
+		try (Socket socket = connect()) {
+			final InputStream in = new BufferedInputStream(socket.getInputStream());
+			send(socket, "GET /fast HTTP/1.0\r\nConnection: keep-alive\r\n\r\n");
+			Response response = read(in, false);
+			assertEquals("HTTP/1.0 200 OK", response.statusLine);
+			assertEquals("keep-alive", response.headers.get(UHttpHeaders.CONNECTION));
+			// a streamed body ends with the connection
+			send(socket, "GET /stream HTTP/1.0\r\nConnection: keep-alive\r\n\r\n");
+			response = read(in, false);
+			assertEquals("close", response.headers.get(UHttpHeaders.CONNECTION));
+			assertEquals("part0;part1;part2;", response.body);
+		}
+	}
+
+	@Test
+	public void chunkedRequestWithContinue() throws Exception {
+		try (Socket socket = connect()) {
+			final InputStream in = new BufferedInputStream(socket.getInputStream());
+			send(socket, "POST /users HTTP/1.1\r\nTransfer-Encoding: chunked\r\nExpect: 100-continue\r\n\r\n");
+			assertEquals(100, read(in, false).status);
+			send(socket, "5;ext=1\r\n{\"nam\r\n9\r\ne\":\"chunk\r\n2\r\n\"}\r\n0\r\nX-Trailer: 1\r\n\r\n");
+			final Response response = read(in, false);
+			assertEquals(201, response.status);
+			assertEquals("chunk", response.json().getString("name"));
+		}
+	}
+
+	@Test
+	public void chunkSizeLimits() throws Exception {
+		try (Socket socket = connect()) {
+			final InputStream in = new BufferedInputStream(socket.getInputStream());
+			// the sum of the sizes overflows
+			send(socket, "POST /users HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n1\r\na\r\n7fffffffffffffff\r\n");
+			assertEquals(413, read(in, false).status);
+			assertEquals(-1, in.read());
+		}
+		for (final String size : new String[] { "+5", "-1", "00000000000000005", "" }) {
+			try (Socket socket = connect()) {
+				final InputStream in = new BufferedInputStream(socket.getInputStream());
+				send(socket, "POST /users HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n"+size+";ext\r\n");
+				assertEquals(size, 400, read(in, false).status);
+			}
+		}
+	}
+
+	@Test
+	public void ambiguousRequestBodies() throws Exception {
+		final String[] requests = {
+			"POST /users HTTP/1.1\r\nTransfer-Encoding: chunked\r\nContent-Length: 5\r\n\r\n0\r\n\r\n",
+			"POST /users HTTP/1.1\r\nTransfer-Encoding: chunked, gzip\r\n\r\n0\r\n\r\n",
+			"POST /users HTTP/1.1\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: identity\r\n\r\n0\r\n\r\n",
+			"POST /users HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n",
+			"POST /users HTTP/1.1\r\nContent-Length: +5\r\n\r\n{\"a\":1}",
+			"POST /users HTTP/1.1\r\nContent-Length: -0\r\n\r\n",
+			"POST /users HTTP/1.1\r\nContent-Length: 0x5\r\n\r\n",
+			"POST /users HTTP/1.1\r\nContent-Length: \r\n\r\n"
+		};
+		for (final String request : requests) {
+			try (Socket socket = connect()) {
+				final InputStream in = new BufferedInputStream(socket.getInputStream());
+				send(socket, request);
+				assertEquals(request, 400, read(in, false).status);
+				assertEquals(-1, in.read());
+			}
+		}
+	}
+
+	@Test
+	public void limits() throws Exception {
+		try (Socket socket = connect()) {
+			final InputStream in = new BufferedInputStream(socket.getInputStream());
+			final StringBuilder sb = new StringBuilder("GET /fast HTTP/1.1\r\n");
+			for (int i=0; i < 100; i++) sb.append("X-Header-"+i+": value\r\n");
+			send(socket, sb.append("\r\n").toString());
+			final Response response = read(in, false);
+			assertEquals(431, response.status);
+			assertEquals("close", response.headers.get(UHttpHeaders.CONNECTION));
+			assertEquals(-1, in.read());
+		}
+		try (Socket socket = connect()) {
+			final InputStream in = new BufferedInputStream(socket.getInputStream());
+			send(socket, "POST /users HTTP/1.1\r\nContent-Length: 2000\r\n\r\n");
+			assertEquals(413, read(in, false).status);
+			assertEquals(-1, in.read());
+		}
+		try (Socket socket = connect()) {
+			final InputStream in = new BufferedInputStream(socket.getInputStream());
+			send(socket, "GARBAGE\r\n\r\n");
+			assertEquals(400, read(in, false).status);
+		}
+		try (Socket socket = connect()) {
+			final InputStream in = new BufferedInputStream(socket.getInputStream());
+			send(socket, "GET / HTTP/2.0\r\n\r\n");
+			assertEquals(505, read(in, false).status);
+		}
+	}
+}
@@ -0,0 +1,346 @@
+import static org.junit.Assert.*;
+
+import java.io.DataInputStream;
+import java.io.EOFException;
+import java.io.OutputStream;
+import java.net.InetSocketAddress;
+import java.net.Socket;
+import java.nio.ByteBuffer;
+import java.security.KeyStore;
+import java.util.ArrayList;
+import java.util.List;
+import java.util.concurrent.TimeUnit;
+
+import org.junit.After;
+import org.junit.Assume;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.http.UHttpClient;
+import com.umpani.aio.http.UHttpHandler;
+import com.umpani.aio.http.UHttpHeaders;
+import com.umpani.aio.http.UHttpMessage;
+import com.umpani.aio.http.UHttpRequest;
+import com.umpani.aio.http.UHttpResponse;
+import com.umpani.aio.http.UHttpRouter;
+import com.umpani.aio.http.UHttpServer;
+import com.umpani.aio.http.UHttpStream;
+import com.umpani.aio.http.UHttpStreamer;
+import com.umpani.aio.http2.UHpackDecoder;
+import com.umpani.aio.http2.UHpackEncoder;
+import com.umpani.aio.http2.UHttp2Client;
+import com.umpani.aio.http2.UHttp2Frame;
+import com.umpani.aio.http2.UHttp2Settings;
+import com.umpani.aio.ssl.USslContext;
+
+public class THttp2 {
+	private static final char[] PASSWORD = "changeit".toCharArray();
+	private UEventLoopGroup group;
+	private UBufferPool pool;
+	private UHttpRouter router;
+	private UHttpServer server;
+	private UHttp2Client client;
+	private int port;
+	private String url;
+
+	@Before
+	public void setUp() throws Exception {
+		group = new UEventLoopGroup("test", 2);
+		pool = new UBufferPool(false).setLeakDetection(1);
+		router = new UHttpRouter();
+		router.get("/hello/{name}", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return UFuture.succeeded("hello "+request.getPathParameter("name")+" with "+request.version()+" from "+request.headers().get(UHttpHeaders.HOST));
+			}
+		});
+		router.post("/echo", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return UFuture.succeeded(new UHttpResponse(200).setBody(request.body()));
+			}
+		});
+		router.get("/stream", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return UFuture.succeeded(new UHttpResponse(200).setStreamer(new UHttpStreamer() {
+					@Override
+					public void stream( final UHttpStream stream ) {
+						for (int i=0; i < 3; i++) stream.write("part"+i+";");
+						stream.end();
+					}
+				}));
+			}
+		});
+		server = new UHttpServer(group, router, pool).setHttp2(true).setMaxBodySize(300000);
+		port = server.bind(new InetSocketAddress("127.0.0.1", 0)).getPort();
+		url = "http://127.0.0.1:"+port;
+		client = new UHttp2Client(group, pool);
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		client.close();
+		server.close().get(5, TimeUnit.SECONDS);
+		group.shutdown();
+		assertTrue(group.awaitTermination(5, TimeUnit.SECONDS));
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	private static byte[] hex( final String text ) {
+		final String digits = text.replace(" ", "");
+		final byte[] bytes = new byte[digits.length() / 2];
+		for (int i=0; i < bytes.length; i++) bytes[i] = (byte)Integer.parseInt(digits.substring(2 * i, 2 * i + 2), 16);
+		return bytes;
+	}
+
+	private static UHttpHeaders headers( final String... fields ) {
+		final UHttpHeaders headers = new UHttpHeaders();
+		for (int i=0; i < fields.length; i+=2) headers.add(fields[i], fields[i + 1]);
+		return headers;
+	}
+
+	private static void assertHeaders( final UHttpHeaders expected, final UHttpHeaders actual ) {
+		assertEquals(expected.size(), actual.size());
+		for (int i=0; i < expected.size(); i++) {
+			assertEquals(expected.name(i), actual.name(i));
+			assertEquals(expected.value(i), actual.value(i));
+		}
+	}
+
+	private static void writeFrame( final OutputStream out, final int type, final int flags, final int streamId, final byte[] payload ) throws Exception {
+		final ByteBuffer header = ByteBuffer.allocate(UHttp2Frame.HEADER_SIZE);
+		header.put((byte)(payload.length >>> 16)).put((byte)(payload.length >>> 8)).put((byte)payload.length);
+		header.put((byte)type).put((byte)flags).putInt(streamId);
+		out.write(header.array());
+		out.write(payload);
+		out.flush();
+	}
+
+	private static UHttp2Frame readFrame( final DataInputStream in ) throws Exception {
+		final int length = in.readUnsignedByte() << 16 | in.readUnsignedShort();
+		final int type = in.readUnsignedByte();
+		final int flags = in.readUnsignedByte();
+		final int streamId = in.readInt() & 0x7fffffff;
+		final byte[] payload = new byte[length];
+		in.readFully(payload);
+		return new UHttp2Frame(type, flags, streamId, payload);
+	}
+
+	@Test
+	public void hpackRequestExamples() throws Exception {
+		// RFC 7541, C.4: requests with Huffman coding
+		final UHttpHeaders[] requests = {
+			headers(":method", "GET", ":scheme", "http", ":path", "/", ":authority", "www.example.com"),
+			headers(":method", "GET", ":scheme", "http", ":path", "/", ":authority", "www.example.com", "cache-control", "no-cache"),
+			headers(":method", "GET", ":scheme", "https", ":path", "/index.html", ":authority", "www.example.com", "custom-key", "custom-value")
+		};
+		final byte[][] blocks = {
+			hex("8286 8441 8cf1 e3c2 e5f2 3a6b a0ab 90f4 ff"),
+			hex("8286 84be 5886 a8eb 1064 9cbf"),
+			hex("8287 85bf 4088 25a8 49e9 5ba9 7d7f 8925 a849 e95b b8e8 b4bf")
+		};
+		final UHpackEncoder encoder = new UHpackEncoder();
+		final UHpackDecoder decoder = new UHpackDecoder(4096, UHttp2Settings.UNLIMITED);
+		for (int i=0; i < requests.length; i++) {
+			assertArrayEquals(blocks[i], encoder.encode(requests[i]));
+			final UHttpHeaders decoded = new UHttpHeaders();
+			assertTrue(decoder.decode(blocks[i], decoded));
+			assertHeaders(requests[i], decoded);
+		}
+		// RFC 7541, C.3: the same requests without Huffman coding
+		final UHpackDecoder plain = new UHpackDecoder(4096, UHttp2Settings.UNLIMITED);
+		final byte[][] plainBlocks = {
+			hex("8286 8441 0f77 7777 2e65 7861 6d70 6c65 2e63 6f6d"),
+			hex("8286 84be 5808 6e6f 2d63 6163 6865"),
+			hex("8287 85bf 400a 6375 7374 6f6d 2d6b 6579 0c63 7573 746f 6d2d 7661 6c75 65")
+		};
+		for (int i=0; i < requests.length; i++) {
+			final UHttpHeaders decoded = new UHttpHeaders();
+			assertTrue(plain.decode(plainBlocks[i], decoded));
+			assertHeaders(requests[i], decoded);
+		}
+	}
+
+	@Test
+	public void hpackSensitiveAndLimits() throws Exception {
+		final UHpackEncoder encoder = new UHpackEncoder();
+		final UHttpHeaders fields = headers("authorization", "secret", "x-large", new String(new char[200]).replace('\0', 'x'));
+		final byte[] first = encoder.encode(fields);
+		// the sensitive field is never indexed, so the second block repeats its literal
+		final byte[] second = encoder.encode(headers("authorization", "secret"));
+		assertEquals(0x10, second[0] & 0xf0);
+		final UHttpHeaders decoded = new UHttpHeaders();
+		assertTrue(new UHpackDecoder(4096, UHttp2Settings.UNLIMITED).decode(first, decoded));
+		assertHeaders(fields, decoded);
+		// the list exceeds the limit
+		final UHttpHeaders limited = new UHttpHeaders();
+		assertFalse(new UHpackDecoder(4096, 100).decode(first, limited));
+	}
+
+	@Test
+	public void settings() throws Exception {
+		final UHttp2Settings settings = new UHttp2Settings().setMaxConcurrentStreams(10).setInitialWindowSize(1 << 20).setEnablePush(false);
+		final UHttp2Frame frame = settings.toFrame();
+		assertEquals(UHttp2Frame.SETTINGS, frame.type());
+		assertEquals(18, frame.payload().length);
+		final UHttp2Settings applied = new UHttp2Settings();
+		applied.apply(frame);
+		assertEquals(10, applied.getMaxConcurrentStreams());
+		assertEquals(1 << 20, applied.getInitialWindowSize());
+		assertFalse(applied.isEnablePush());
+		assertEquals(UHttp2Frame.DEFAULT_MAX_FRAME_SIZE, applied.getMaxFrameSize());
+		assertEquals(0, new UHttp2Settings().toFrame().payload().length);
+	}
+
+	@Test
+	public void concurrentRequests() throws Exception {
+		final List<UFuture<UHttpResponse>> futures = new ArrayList<>();
+		for (int i=0; i < 50; i++) futures.add(client.get(url+"/hello/user"+i));
+		for (int i=0; i < futures.size(); i++) {
+			final UHttpResponse response = futures.get(i).get(5, TimeUnit.SECONDS);
+			assertEquals(200, response.status());
+			assertEquals(UHttpMessage.HTTP_2, response.version());
+			assertEquals("hello user"+i+" with HTTP/2.0 from 127.0.0.1:"+port, response.bodyAsString());
+		}
+		assertEquals(1, client.connections());
+		assertEquals(1, server.channels().size());
+	}
+
+	@Test
+	public void flowControl() throws Exception {
+		// larger than the initial windows of connection and stream in both directions
+		final byte[] body = new byte[200000];
+		for (int i=0; i < body.length; i++) body[i] = (byte)i;
+		final List<UFuture<UHttpResponse>> futures = new ArrayList<>();
+		for (int i=0; i < 3; i++) {
+			final UHttpRequest request = new UHttpRequest("POST", url+"/echo");
+			request.setBody(body);
+			futures.add(client.send(request));
+		}
+		for (final UFuture<UHttpResponse> future : futures) {
+			final UHttpResponse response = future.get(10, TimeUnit.SECONDS);
+			assertEquals(200, response.status());
+			assertArrayEquals(body, response.body());
+		}
+		// a body beyond the limit is answered with 413, the connection stays usable
+		final UHttpRequest request = new UHttpRequest("POST", url+"/echo");
+		request.setBody(new byte[400000]);
+		assertEquals(413, client.send(request).get(10, TimeUnit.SECONDS).status());
+		assertEquals(200, client.get(url+"/hello/again").get(5, TimeUnit.SECONDS).status());
+		assertEquals(1, client.connections());
+	}
+
+	@Test
+	public void streamingHeadAndNotFound() throws Exception {
+		final UHttpResponse streamed = client.get(url+"/stream").get(5, TimeUnit.SECONDS);
+		assertEquals(200, streamed.status());
+		assertEquals("part0;part1;part2;", streamed.bodyAsString());
+		final UHttpResponse head = client.send(new UHttpRequest("HEAD", url+"/hello/head")).get(5, TimeUnit.SECONDS);
+		assertEquals(200, head.status());
+		assertEquals(0, head.body().length);
+		assertEquals(("hello head with HTTP/2.0 from 127.0.0.1:"+port).length(), head.headers().getLong(UHttpHeaders.CONTENT_LENGTH, -1));
+		assertEquals(404, client.get(url+"/missing").get(5, TimeUnit.SECONDS).status());
+	}
+
+	@Test
+	public void http1OnTheSamePort() throws Exception {
+		final UHttpClient http1 = new UHttpClient(group, pool);
+		try {
+			final UHttpResponse response = http1.get(url+"/hello/old").get(5, TimeUnit.SECONDS);
+			assertEquals(200, response.status());
+			assertEquals("hello old with HTTP/1.1 from 127.0.0.1:"+port, response.bodyAsString());
+		} finally {
+			http1.close();
+		}
+		assertEquals(200, client.get(url+"/hello/new").get(5, TimeUnit.SECONDS).status());
+	}
+
+	@Test
+	public void pingAndGoAway() throws Exception {
+		try (Socket socket = new Socket("127.0.0.1", port)) {
+			socket.setSoTimeout(5000);
+			final OutputStream out = socket.getOutputStream();
+			final DataInputStream in = new DataInputStream(socket.getInputStream());
+			out.write(UHttp2Frame.PREFACE);
+			writeFrame(out, UHttp2Frame.SETTINGS, 0, 0, new byte[0]);
+			writeFrame(out, UHttp2Frame.PING, 0, 0, "12345678".getBytes("US-ASCII"));
+			final UHttp2Frame settings = readFrame(in);
+			assertEquals(UHttp2Frame.SETTINGS, settings.type());
+			assertFalse(settings.hasFlag(UHttp2Frame.ACK));
+			final UHttp2Settings applied = new UHttp2Settings();
+			applied.apply(settings);
+			assertEquals(100, applied.getMaxConcurrentStreams());
+			UHttp2Frame frame = readFrame(in);
+			assertEquals(UHttp2Frame.SETTINGS, frame.type());
+			assertTrue(frame.hasFlag(UHttp2Frame.ACK));
+			frame = readFrame(in);
+			assertEquals(UHttp2Frame.PING, frame.type());
+			assertTrue(frame.hasFlag(UHttp2Frame.ACK));
+			assertArrayEquals("12345678".getBytes("US-ASCII"), frame.payload());
+			// a window update of zero on the connection is a connection error
+			writeFrame(out, UHttp2Frame.WINDOW_UPDATE, 0, 0, new byte[4]);
+			frame = readFrame(in);
+			assertEquals(UHttp2Frame.GOAWAY, frame.type());
+			assertEquals(UHttp2Frame.PROTOCOL_ERROR, frame.getInt(4));
+			try {
+				readFrame(in);
+				fail("Expected the connection to be closed");
+			} catch (EOFException e) {
+				// expected
+			}
+		}
+	}
+
+	@Test
+	public void resetUnknownPseudoHeader() throws Exception {
+		try (Socket socket = new Socket("127.0.0.1", port)) {
+			socket.setSoTimeout(5000);
+			final OutputStream out = socket.getOutputStream();
+			final DataInputStream in = new DataInputStream(socket.getInputStream());
+			out.write(UHttp2Frame.PREFACE);
+			writeFrame(out, UHttp2Frame.SETTINGS, 0, 0, new byte[0]);
+			final byte[] block = new UHpackEncoder().encode(headers(":method", "GET", ":scheme", "http", ":path", "/", ":protocol", "x"));
+			writeFrame(out, UHttp2Frame.HEADERS, UHttp2Frame.END_HEADERS | UHttp2Frame.END_STREAM, 1, block);
+			UHttp2Frame frame;
+			do {
+				frame = readFrame(in);
+			} while (frame.type()==UHttp2Frame.SETTINGS);
+			assertEquals(UHttp2Frame.RST_STREAM, frame.type());
+			assertEquals(1, frame.streamId());
+			assertEquals(UHttp2Frame.PROTOCOL_ERROR, frame.getInt(0));
+		}
+	}
+
+	@Test
+	public void alpn() throws Exception {
+		Assume.assumeTrue(USslContext.isAlpnSupported());
+		final KeyStore keys = TSsl.generate("server", "CN=localhost");
+		final UHttpServer tls = new UHttpServer(group, router, pool).setHttp2(true)
+			.setSslContext(USslContext.forServer(keys, PASSWORD).setApplicationProtocols("h2", "http/1.1"));
+		final int port = tls.bind(new InetSocketAddress("127.0.0.1", 0)).getPort();
+		final UHttp2Client h2 = new UHttp2Client(group, pool).setSslContext(USslContext.forClient(keys).setApplicationProtocols("h2"));
+		final UHttpClient http1 = new UHttpClient(group, pool).setSslContext(USslContext.forClient(keys));
+		try {
+			UHttpResponse response = h2.get("https://127.0.0.1:"+port+"/hello/tls").get(5, TimeUnit.SECONDS);
+			assertEquals("hello tls with HTTP/2.0 from 127.0.0.1:"+port, response.bodyAsString());
+			// without ALPN the connection falls back to HTTP/1.1
+			response = http1.get("https://127.0.0.1:"+port+"/hello/tls").get(5, TimeUnit.SECONDS);
+			assertEquals("hello tls with HTTP/1.1 from 127.0.0.1:"+port, response.bodyAsString());
+		} finally {
+			h2.close();
+			http1.close();
+			tls.close().get(5, TimeUnit.SECONDS);
+		}
+	}
+
+	@Test
+	public void shutdown() throws Exception {
+		assertEquals(200, client.get(url+"/hello/before").get(5, TimeUnit.SECONDS).status());
+		assertTrue(server.shutdown(5, TimeUnit.SECONDS).await(5, TimeUnit.SECONDS));
+		assertTrue(server.channels().isEmpty());
+	}
+}
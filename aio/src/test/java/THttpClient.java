@@ -0,0 +1,388 @@
+import static org.junit.Assert.*;
+
+import java.io.EOFException;
+import java.io.IOException;
+import java.io.InputStream;
+import java.net.ConnectException;
+import java.net.InetSocketAddress;
+import java.net.ServerSocket;
+import java.net.Socket;
+import java.net.SocketTimeoutException;
+import java.nio.charset.StandardCharsets;
+import java.security.KeyStore;
+import java.util.ArrayList;
+import java.util.concurrent.ExecutionException;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.TimeoutException;
+import java.util.concurrent.atomic.AtomicInteger;
+
+import org.junit.After;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UEventLoop;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.exception.UHttpException;
+import com.umpani.aio.http.UHttpBodyHandler;
+import com.umpani.aio.http.UHttpClient;
+import com.umpani.aio.http.UHttpHandler;
+import com.umpani.aio.http.UHttpHeaders;
+import com.umpani.aio.http.UHttpRequest;
+import com.umpani.aio.http.UHttpResponse;
+import com.umpani.aio.http.UHttpRouter;
+import com.umpani.aio.http.UHttpServer;
+import com.umpani.aio.http.UHttpStream;
+import com.umpani.aio.http.UHttpStreamer;
+import com.umpani.aio.ssl.USslContext;
+import com.umpani.util.UMap;
+
+@SuppressWarnings("unchecked")
+public class THttpClient {
+	private UEventLoopGroup group;
+	private UBufferPool pool;
+	private UHttpServer server;
+	private UHttpClient client;
+	private String url;
+	private final AtomicInteger concurrent = new AtomicInteger();
+	private final AtomicInteger maxConcurrent = new AtomicInteger();
+
+	@Before
+	public void setUp() throws Exception {
+		group = new UEventLoopGroup("test", 2);
+		pool = new UBufferPool(false).setLeakDetection(1);
+		final UHttpRouter router = new UHttpRouter();
+		router.get("/users/{id}", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return UFuture.succeeded(UMap.of(String.class, Object.class, "id", request.getPathParameter("id")));
+			}
+		});
+		router.post("/users", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) throws Exception {
+				final UMap<String,Object> user = (UMap<String,Object>)request.json();
+				user.put("id", "42");
+				return UFuture.succeeded(UHttpResponse.json(201, user));
+			}
+		});
+		router.put("/echo", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return UFuture.succeeded(request.bodyAsString());
+			}
+		});
+		router.get("/slow", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				final int n = concurrent.incrementAndGet();
+				int max;
+				while ((max = maxConcurrent.get()) < n && !maxConcurrent.compareAndSet(max, n));
+				final UPromise<Object> promise = new UPromise<Object>(null);
+				UEventLoop.current().schedule(new Runnable() {
+					@Override
+					public void run() {
+						concurrent.decrementAndGet();
+						promise.complete("slow");
+					}
+				}, 100, TimeUnit.MILLISECONDS);
+				return promise;
+			}
+		});
+		router.get("/stream", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return UFuture.succeeded(new UHttpResponse(200).setStreamer(new UHttpStreamer() {
+					@Override
+					public void stream( final UHttpStream stream ) {
+						for (int i=0; i < 3; i++) stream.write("part"+i+";");
+						stream.end();
+					}
+				}));
+			}
+		});
+		router.get("/moved", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				final UHttpResponse response = new UHttpResponse(302);
+				response.headers().set(UHttpHeaders.LOCATION, "/users/7");
+				return UFuture.succeeded(response);
+			}
+		});
+		router.post("/submit", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				final UHttpResponse response = new UHttpResponse(303);
+				response.headers().set(UHttpHeaders.LOCATION, "/users/8");
+				return UFuture.succeeded(response);
+			}
+		});
+		router.put("/temporary", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				final UHttpResponse response = new UHttpResponse(307);
+				response.headers().set(UHttpHeaders.LOCATION, "echo");
+				return UFuture.succeeded(response);
+			}
+		});
+		router.get("/loop", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				final UHttpResponse response = new UHttpResponse(302);
+				response.headers().set(UHttpHeaders.LOCATION, "/loop");
+				return UFuture.succeeded(response);
+			}
+		});
+		router.get("/headers", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				final UHttpHeaders headers = request.headers();
+				return UFuture.succeeded(UMap.of(String.class, Object.class, "authorization", headers.get(UHttpHeaders.AUTHORIZATION, ""),
+					"cookie", headers.get(UHttpHeaders.COOKIE, ""), "custom", headers.get("X-Custom", "")));
+			}
+		});
+		router.get("/to-headers", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				final UHttpResponse response = new UHttpResponse(302);
+				response.headers().set(UHttpHeaders.LOCATION, "/headers");
+				return UFuture.succeeded(response);
+			}
+		});
+		server = new UHttpServer(group, router, pool);
+		final InetSocketAddress address = server.bind(new InetSocketAddress("127.0.0.1", 0));
+		url = "http://127.0.0.1:"+address.getPort();
+		client = new UHttpClient(group, pool);
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		client.close();
+		server.close().get(5, TimeUnit.SECONDS);
+		group.shutdown();
+		assertTrue(group.awaitTermination(5, TimeUnit.SECONDS));
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	private static Throwable cause( final UFuture<?> future ) throws Exception {
+		try {
+			future.get(5, TimeUnit.SECONDS);
+		} catch (ExecutionException e) {
+			return e.getCause();
+		}
+		fail("Expected a failure");
+		return null;
+	}
+
+	@Test
+	public void jsonAndConnectionReuse() throws Exception {
+		final UMap<String,Object> user = (UMap<String,Object>)client.getJson(url+"/users/7").get(5, TimeUnit.SECONDS);
+		assertEquals("7", user.getString("id"));
+		final UHttpResponse created = client.post(url+"/users", UMap.of(String.class, Object.class, "name", "Alex")).get(5, TimeUnit.SECONDS);
+		assertEquals(201, created.status());
+		assertEquals("42", ((UMap<String,Object>)created.json()).getString("id"));
+		assertEquals("Alex", ((UMap<String,Object>)created.json()).getString("name"));
+		final UHttpResponse echo = client.send(new UHttpRequest("PUT", url+"/echo").setBody("hällo")).get(5, TimeUnit.SECONDS);
+		assertEquals("hällo", echo.bodyAsString());
+		final UHttpResponse head = client.send(new UHttpRequest("HEAD", url+"/users/1")).get(5, TimeUnit.SECONDS);
+		assertEquals(200, head.status());
+		assertEquals(0, head.body().length);
+		// all requests were sent one after another, so one connection is enough
+		assertEquals(1, client.connections());
+		assertEquals(1, server.channels().size());
+
+		final Throwable cause = cause(client.json(new UHttpRequest("GET", url+"/nothing")));
+		assertTrue(cause instanceof UHttpException);
+		assertEquals(404, ((UHttpException)cause).getStatus());
+		assertTrue(cause(client.get("ftp://127.0.0.1/")) instanceof IllegalArgumentException);
+	}
+
+	@Test
+	public void streamedBodies() throws Exception {
+		assertEquals("part0;part1;part2;", client.get(url+"/stream").get(5, TimeUnit.SECONDS).bodyAsString());
+		final StringBuilder received = new StringBuilder();
+		final UHttpResponse response = client.send(new UHttpRequest("GET", url+"/stream"), new UHttpBodyHandler() {
+			@Override
+			public void headers( final UHttpResponse response ) {
+				assertTrue(response.headers().contains(UHttpHeaders.TRANSFER_ENCODING, "chunked"));
+			}
+
+			@Override
+			public void data( final byte[] data ) {
+				received.append(new String(data, StandardCharsets.UTF_8));
+			}
+		}).get(5, TimeUnit.SECONDS);
+		assertEquals(200, response.status());
+		assertEquals(0, response.body().length);
+		assertEquals("part0;part1;part2;", received.toString());
+
+		final UHttpRequest upload = new UHttpRequest("PUT", url+"/echo").setStreamer(new UHttpStreamer() {
+			@Override
+			public void stream( final UHttpStream stream ) {
+				stream.write("a");
+				stream.write("b");
+				stream.end();
+			}
+		});
+		assertEquals("ab", client.send(upload).get(5, TimeUnit.SECONDS).bodyAsString());
+		client.setMaxBodySize(4);
+		assertNotNull(cause(client.get(url+"/stream")));
+	}
+
+	@Test
+	public void poolLimitAndIdleEviction() throws Exception {
+		client.setMaxConnectionsPerHost(2).setIdleTimeout(200);
+		final ArrayList<UFuture<UHttpResponse>> futures = new ArrayList<>();
+		for (int i=0; i < 6; i++) futures.add(client.get(url+"/slow"));
+		for (final UFuture<UHttpResponse> future : futures) assertEquals("slow", future.get(5, TimeUnit.SECONDS).bodyAsString());
+		assertEquals(2, maxConcurrent.get());
+		assertEquals(2, client.connections());
+		assertEquals(2, client.idleConnections());
+		// the eviction runs on the event loop, wait for it instead of guessing how long it takes
+		final long deadline = System.nanoTime() + TimeUnit.SECONDS.toNanos(5);
+		while (client.connections() > 0 && System.nanoTime() < deadline) Thread.sleep(10);
+		assertEquals(0, client.connections());
+		// a new connection is opened on demand
+		assertEquals("7", ((UMap<String,Object>)client.getJson(url+"/users/7").get(5, TimeUnit.SECONDS)).getString("id"));
+	}
+
+	@Test
+	public void redirects() throws Exception {
+		assertEquals(302, client.get(url+"/moved").get(5, TimeUnit.SECONDS).status());
+		client.setFollowRedirects(true).setMaxRedirects(3);
+		assertEquals("7", ((UMap<String,Object>)client.getJson(url+"/moved").get(5, TimeUnit.SECONDS)).getString("id"));
+		final UHttpResponse seeOther = client.post(url+"/submit", UMap.of(String.class, Object.class, "a", 1)).get(5, TimeUnit.SECONDS);
+		assertEquals(200, seeOther.status());
+		assertEquals("8", ((UMap<String,Object>)seeOther.json()).getString("id"));
+		// a temporary redirect repeats the method and body
+		assertEquals("body", client.send(new UHttpRequest("PUT", url+"/temporary").setBody("body")).get(5, TimeUnit.SECONDS).bodyAsString());
+		// the last redirect is returned once the limit is reached
+		assertEquals(302, client.get(url+"/loop").get(5, TimeUnit.SECONDS).status());
+	}
+
+	/**
+	 * Returns a router that redirects every GET request to the given URL.
+	 */
+	private static UHttpRouter redirectTo( final String location ) {
+		final UHttpRouter router = new UHttpRouter();
+		router.get("/*", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				final UHttpResponse response = new UHttpResponse(302);
+				response.headers().set(UHttpHeaders.LOCATION, location);
+				return UFuture.succeeded(response);
+			}
+		});
+		return router;
+	}
+
+	@Test
+	public void crossOriginRedirect() throws Exception {
+		client.setFollowRedirects(true);
+		final UHttpRequest sameOrigin = new UHttpRequest("GET", url+"/to-headers");
+		sameOrigin.headers().set(UHttpHeaders.AUTHORIZATION, "Bearer secret").set(UHttpHeaders.COOKIE, "session=1").set("X-Custom", "kept");
+		UMap<String,Object> reply = (UMap<String,Object>)client.json(sameOrigin).get(5, TimeUnit.SECONDS);
+		assertEquals("Bearer secret", reply.getString("authorization"));
+		assertEquals("session=1", reply.getString("cookie"));
+		// another port is another origin
+		final UHttpServer other = new UHttpServer(group, redirectTo(url+"/headers"), pool);
+		final int port = other.bind(new InetSocketAddress("127.0.0.1", 0)).getPort();
+		try {
+			final UHttpRequest crossOrigin = new UHttpRequest("GET", "http://127.0.0.1:"+port+"/start");
+			crossOrigin.headers().set(UHttpHeaders.AUTHORIZATION, "Bearer secret").set(UHttpHeaders.COOKIE, "session=1").set("X-Custom", "kept");
+			reply = (UMap<String,Object>)client.json(crossOrigin).get(5, TimeUnit.SECONDS);
+			assertEquals("", reply.getString("authorization"));
+			assertEquals("", reply.getString("cookie"));
+			assertEquals("kept", reply.getString("custom"));
+		} finally {
+			other.close().get(5, TimeUnit.SECONDS);
+		}
+	}
+
+	@Test
+	public void insecureRedirect() throws Exception {
+		final KeyStore keys = TSsl.generate("server", "CN=localhost");
+		final UHttpServer tls = new UHttpServer(group, redirectTo(url+"/users/7"), pool)
+			.setSslContext(USslContext.forServer(keys, "changeit".toCharArray()));
+		final int port = tls.bind(new InetSocketAddress("127.0.0.1", 0)).getPort();
+		final UHttpClient secure = new UHttpClient(group, pool).setSslContext(USslContext.forClient(keys)).setFollowRedirects(true);
+		try {
+			final Throwable cause = cause(secure.get("https://127.0.0.1:"+port+"/start"));
+			assertTrue(cause instanceof UHttpException);
+			assertEquals(302, ((UHttpException)cause).getStatus());
+			secure.setInsecureRedirects(true);
+			assertEquals("7", ((UMap<String,Object>)secure.getJson("https://127.0.0.1:"+port+"/start").get(5, TimeUnit.SECONDS)).getString("id"));
+		} finally {
+			secure.close();
+			tls.close().get(5, TimeUnit.SECONDS);
+		}
+	}
+
+	/**
+	 * Reads the head of a request.
+	 */
+	private static void readHead( final InputStream in ) throws IOException {
+		int matched = 0;
+		while (matched < 4) {
+			final int b = in.read();
+			if (b < 0) throw new EOFException();
+			matched = b==(matched % 2==0 ? '\r' : '\n') ? matched + 1 : b=='\r' ? 1 : 0;
+		}
+	}
+
+	@Test
+	public void retryOnlyIdempotentRequests() throws Exception {
+		final ServerSocket server = new ServerSocket(0);
+		final byte[] ok = "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok".getBytes(StandardCharsets.US_ASCII);
+		final Thread thread = new Thread() {
+			@Override
+			public void run() {
+				try {
+					// every connection answers one request and closes at the next one without response
+					for (int i=0; i < 3; i++) {
+						try (Socket socket = server.accept()) {
+							final InputStream in = socket.getInputStream();
+							readHead(in);
+							socket.getOutputStream().write(ok);
+							readHead(in);
+						}
+					}
+				} catch (IOException e) {
+					// closed by the test
+				}
+			}
+		};
+		thread.start();
+		try {
+			final String base = "http://127.0.0.1:"+server.getLocalPort();
+			assertEquals("ok", client.get(base+"/").get(5, TimeUnit.SECONDS).bodyAsString());
+			// the server may have processed the POST, so it is not repeated
+			assertTrue(cause(client.post(base+"/", UMap.of(String.class, Object.class, "name", "x"))) instanceof IOException);
+			assertEquals("ok", client.get(base+"/").get(5, TimeUnit.SECONDS).bodyAsString());
+			// the GET is repeated with a new connection
+			assertEquals("ok", client.get(base+"/").get(5, TimeUnit.SECONDS).bodyAsString());
+		} finally {
+			server.close();
+			thread.join(5000);
+		}
+	}
+
+	@Test
+	public void timeouts() throws Exception {
+		client.setReadTimeout(30);
+		assertTrue(cause(client.get(url+"/slow")) instanceof SocketTimeoutException);
+		client.setReadTimeout(0).setTimeout(30);
+		assertTrue(cause(client.get(url+"/slow")) instanceof TimeoutException);
+		client.setTimeout(0);
+		assertEquals("slow", client.get(url+"/slow").get(5, TimeUnit.SECONDS).bodyAsString());
+
+		final int port;
+		try (ServerSocket socket = new ServerSocket(0)) {
+			port = socket.getLocalPort();
+		}
+		client.setConnectTimeout(1000);
+		assertTrue(cause(client.get("http://127.0.0.1:"+port+"/")) instanceof ConnectException);
+	}
+}
@@ -0,0 +1,326 @@
+import static org.junit.Assert.*;
+
+import java.io.ByteArrayInputStream;
+import java.io.ByteArrayOutputStream;
+import java.net.InetSocketAddress;
+import java.nio.charset.StandardCharsets;
+import java.util.ArrayList;
+import java.util.Arrays;
+import java.util.List;
+import java.util.concurrent.ExecutionException;
+import java.util.concurrent.TimeUnit;
+import java.util.zip.Deflater;
+import java.util.zip.GZIPInputStream;
+import java.util.zip.GZIPOutputStream;
+
+import org.junit.After;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.codec.UCompression;
+import com.umpani.aio.codec.UCompressor;
+import com.umpani.aio.codec.UDecompressor;
+import com.umpani.aio.exception.UCodecException;
+import com.umpani.aio.http.UHttpBodyHandler;
+import com.umpani.aio.http.UHttpClient;
+import com.umpani.aio.http.UHttpContentCompressor;
+import com.umpani.aio.http.UHttpHandler;
+import com.umpani.aio.http.UHttpHeaders;
+import com.umpani.aio.http.UHttpRequest;
+import com.umpani.aio.http.UHttpResponse;
+import com.umpani.aio.http.UHttpRouter;
+import com.umpani.aio.http.UHttpServer;
+import com.umpani.aio.http.UHttpStream;
+import com.umpani.aio.http.UHttpStreamer;
+import com.umpani.util.UMap;
+
+public class THttpCompression {
+	private UEventLoopGroup group;
+	private UBufferPool pool;
+	private UHttpServer server;
+	private UHttpClient client;
+	private String url;
+
+	@Before
+	public void setUp() throws Exception {
+		group = new UEventLoopGroup("test", 2);
+		pool = new UBufferPool(false).setLeakDetection(1);
+		final UHttpRouter router = new UHttpRouter();
+		router.get("/users", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				final ArrayList<Object> users = new ArrayList<>();
+				for (int i=0; i < 200; i++) users.add(UMap.of(String.class, Object.class, "id", i, "name", "user"+i));
+				return UFuture.succeeded(users);
+			}
+		});
+		router.get("/small", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return UFuture.succeeded("small");
+			}
+		});
+		router.get("/image", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				final UHttpResponse response = new UHttpResponse(200).setBody(new byte[4096]);
+				response.headers().set(UHttpHeaders.CONTENT_TYPE, "image/png");
+				return UFuture.succeeded(response);
+			}
+		});
+		router.get("/stream", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return UFuture.succeeded(new UHttpResponse(200).setStreamer(new UHttpStreamer() {
+					@Override
+					public void stream( final UHttpStream stream ) {
+						for (int i=0; i < 3; i++) stream.write("part"+i+";");
+						stream.end();
+					}
+				}));
+			}
+		});
+		router.get("/encoded", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				final UHttpResponse response;
+				if ("\"v1\"".equals(request.headers().get(UHttpHeaders.IF_NONE_MATCH))) {
+					response = new UHttpResponse(304);
+				} else {
+					response = new UHttpResponse(200).setBody(UCompressor.compress(UCompression.GZIP, bytes("hello"), pool));
+				}
+				response.headers().set(UHttpHeaders.CONTENT_ENCODING, "gzip");
+				response.headers().set(UHttpHeaders.ETAG, "\"v1\"");
+				return UFuture.succeeded(response);
+			}
+		});
+		router.post("/echo", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return UFuture.succeeded(request.bodyAsString());
+			}
+		});
+		server = new UHttpServer(group, router, pool).setMaxBodySize(65536);
+		final InetSocketAddress address = server.bind(new InetSocketAddress("127.0.0.1", 0));
+		url = "http://127.0.0.1:"+address.getPort();
+		client = new UHttpClient(group, pool);
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		client.close();
+		server.close().get(5, TimeUnit.SECONDS);
+		group.shutdown();
+		assertTrue(group.awaitTermination(5, TimeUnit.SECONDS));
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	private static byte[] bytes( final String text ) {
+		return text.getBytes(StandardCharsets.UTF_8);
+	}
+
+	private static byte[] concat( final byte[] a, final byte[] b ) {
+		final byte[] result = Arrays.copyOf(a, a.length + b.length);
+		System.arraycopy(b, 0, result, a.length, b.length);
+		return result;
+	}
+
+	private UHttpResponse get( final String path, final String acceptEncoding ) throws Exception {
+		final UHttpRequest request = new UHttpRequest("GET", url+path);
+		if (acceptEncoding!=null) request.headers().set(UHttpHeaders.ACCEPT_ENCODING, acceptEncoding);
+		return client.send(request).get(5, TimeUnit.SECONDS);
+	}
+
+	@Test
+	public void codecs() throws Exception {
+		final byte[] text = bytes("Hello compressed world! Hello compressed world! Hello compressed world!");
+		for (final UCompression format : UCompression.values()) {
+			assertArrayEquals(text, UDecompressor.decompress(format, UCompressor.compress(format, text, pool), text.length, pool));
+
+			// every flushed part can be decompressed at once, even if the input arrives byte by byte
+			final UCompressor compressor = new UCompressor(format, Deflater.BEST_SPEED, pool);
+			final UDecompressor decompressor = new UDecompressor(format, 1000, pool);
+			for (int i=0; i < 3; i++) {
+				final byte[] part = compressor.compress(text, 0, text.length, true);
+				final ByteArrayOutputStream out = new ByteArrayOutputStream();
+				for (int j=0; j < part.length; j++) out.write(decompressor.decompress(part, j, 1));
+				assertArrayEquals(text, out.toByteArray());
+			}
+			final byte[] tail = compressor.finish();
+			assertEquals(0, decompressor.decompress(tail, 0, tail.length).length);
+			assertTrue(decompressor.isFinished());
+			assertEquals(3 * text.length, decompressor.size());
+			decompressor.close();
+		}
+
+		// interoperability with the gzip streams of the JDK
+		final byte[] gzip = UCompressor.compress(UCompression.GZIP, text, pool);
+		final ByteArrayOutputStream inflated = new ByteArrayOutputStream();
+		try (GZIPInputStream in = new GZIPInputStream(new ByteArrayInputStream(gzip))) {
+			final byte[] buffer = new byte[256];
+			for (int n; (n = in.read(buffer)) > 0;) inflated.write(buffer, 0, n);
+		}
+		assertArrayEquals(text, inflated.toByteArray());
+		final ByteArrayOutputStream jdk = new ByteArrayOutputStream();
+		try (GZIPOutputStream out = new GZIPOutputStream(jdk)) {
+			out.write(text);
+		}
+		assertArrayEquals(text, UDecompressor.decompress(UCompression.GZIP, jdk.toByteArray(), text.length, pool));
+
+		// several gzip members and raw deflate streams
+		assertArrayEquals(concat(text, text), UDecompressor.decompress(UCompression.GZIP, concat(gzip, jdk.toByteArray()), 1000, pool));
+		final Deflater deflater = new Deflater(Deflater.DEFAULT_COMPRESSION, true);
+		deflater.setInput(text);
+		deflater.finish();
+		final byte[] raw = new byte[1000];
+		final int length = deflater.deflate(raw);
+		deflater.end();
+		assertArrayEquals(text, UDecompressor.decompress(UCompression.DEFLATE, Arrays.copyOf(raw, length), 1000, pool));
+
+		// a small input that expands beyond the limit fails
+		final byte[] bomb = UCompressor.compress(UCompression.GZIP, new byte[1 << 20], pool);
+		assertTrue(bomb.length < 2048);
+		final UDecompressor limited = new UDecompressor(UCompression.GZIP, 65536, pool);
+		try {
+			limited.decompress(bomb, 0, bomb.length);
+			fail("Expected the limit to be exceeded");
+		} catch (UCodecException e) {
+			assertTrue(limited.isLimitExceeded());
+		} finally {
+			limited.close();
+		}
+		try {
+			UDecompressor.decompress(UCompression.GZIP, Arrays.copyOf(gzip, gzip.length - 4), 1000, pool);
+			fail("Expected a truncated stream");
+		} catch (UCodecException e) {
+			assertTrue(e.getMessage().startsWith("Truncated"));
+		}
+		try {
+			UDecompressor.decompress(UCompression.GZIP, text, 1000, pool);
+			fail("Expected an invalid stream");
+		} catch (UCodecException e) {
+			assertEquals("Not in gzip format", e.getMessage());
+		}
+
+		assertEquals(UCompression.GZIP, UHttpContentCompressor.negotiate("gzip, deflate"));
+		assertEquals(UCompression.GZIP, UHttpContentCompressor.negotiate("deflate, x-gzip"));
+		assertEquals(UCompression.DEFLATE, UHttpContentCompressor.negotiate("gzip;q=0.5, deflate"));
+		assertEquals(UCompression.DEFLATE, UHttpContentCompressor.negotiate("gzip;q=0, *"));
+		assertEquals(UCompression.GZIP, UHttpContentCompressor.negotiate("*"));
+		assertNull(UHttpContentCompressor.negotiate("br, identity"));
+		assertNull(UHttpContentCompressor.negotiate(null));
+	}
+
+	@Test
+	public void serverCompression() throws Exception {
+		client.setCompression(false);
+		final UHttpResponse plain = get("/users", null);
+		assertFalse(plain.headers().contains(UHttpHeaders.CONTENT_ENCODING));
+		assertTrue(plain.headers().contains(UHttpHeaders.VARY, UHttpHeaders.ACCEPT_ENCODING));
+		assertTrue(plain.body().length > UHttpContentCompressor.DEFAULT_MIN_SIZE);
+
+		final UHttpResponse gzip = get("/users", "gzip, deflate");
+		assertEquals("gzip", gzip.headers().get(UHttpHeaders.CONTENT_ENCODING));
+		assertEquals(gzip.body().length, gzip.headers().getLong(UHttpHeaders.CONTENT_LENGTH, -1));
+		assertTrue(gzip.body().length < plain.body().length / 2);
+		assertArrayEquals(plain.body(), UDecompressor.decompress(UCompression.GZIP, gzip.body(), 1 << 20, pool));
+		final UHttpResponse deflate = get("/users", "gzip;q=0.5, deflate");
+		assertEquals("deflate", deflate.headers().get(UHttpHeaders.CONTENT_ENCODING));
+		assertArrayEquals(plain.body(), UDecompressor.decompress(UCompression.DEFLATE, deflate.body(), 1 << 20, pool));
+
+		// small bodies, compressed media types and HEAD requests are sent as they are
+		assertFalse(get("/small", "gzip").headers().contains(UHttpHeaders.CONTENT_ENCODING));
+		assertFalse(get("/image", "gzip").headers().contains(UHttpHeaders.CONTENT_ENCODING));
+		final UHttpRequest head = new UHttpRequest("HEAD", url+"/users");
+		head.headers().set(UHttpHeaders.ACCEPT_ENCODING, "gzip");
+		assertFalse(client.send(head).get(5, TimeUnit.SECONDS).headers().contains(UHttpHeaders.CONTENT_ENCODING));
+
+		// a streamed body is compressed with chunked transfer encoding, the connection is kept alive
+		final UHttpResponse streamed = get("/stream", "gzip");
+		assertEquals("gzip", streamed.headers().get(UHttpHeaders.CONTENT_ENCODING));
+		assertTrue(streamed.headers().contains(UHttpHeaders.TRANSFER_ENCODING, "chunked"));
+		assertEquals("part0;part1;part2;", new String(UDecompressor.decompress(UCompression.GZIP, streamed.body(), 1000, pool), StandardCharsets.UTF_8));
+		assertEquals("small", get("/small", "gzip").bodyAsString());
+		assertEquals(1, client.connections());
+		assertEquals(1, server.channels().size());
+	}
+
+	@Test
+	public void clientDecompression() throws Exception {
+		final UHttpResponse response = client.get(url+"/users").get(5, TimeUnit.SECONDS);
+		assertFalse(response.headers().contains(UHttpHeaders.CONTENT_ENCODING));
+		assertEquals(200, ((List<?>)response.json()).size());
+
+		final StringBuilder received = new StringBuilder();
+		client.send(new UHttpRequest("GET", url+"/stream"), new UHttpBodyHandler() {
+			@Override
+			public void headers( final UHttpResponse response ) {
+				assertFalse(response.headers().contains(UHttpHeaders.CONTENT_ENCODING));
+			}
+
+			@Override
+			public void data( final byte[] data ) {
+				received.append(new String(data, StandardCharsets.UTF_8));
+			}
+		}).get(5, TimeUnit.SECONDS);
+		assertEquals("part0;part1;part2;", received.toString());
+		assertEquals(1, client.connections());
+
+		// the limit of the body applies to the decompressed body
+		client.setMaxBodySize(1024);
+		try {
+			client.get(url+"/users").get(5, TimeUnit.SECONDS);
+			fail("Expected the body to exceed the limit");
+		} catch (ExecutionException e) {
+			assertTrue(e.getCause() instanceof UCodecException);
+		}
+	}
+
+	@Test
+	public void emptyBodies() throws Exception {
+		final int length = UCompressor.compress(UCompression.GZIP, bytes("hello"), pool).length;
+		// the header fields of a response without body describe the entity and are passed on unchanged
+		final UHttpResponse head = client.send(new UHttpRequest("HEAD", url+"/encoded")).get(5, TimeUnit.SECONDS);
+		assertEquals(200, head.status());
+		assertEquals("gzip", head.headers().get(UHttpHeaders.CONTENT_ENCODING));
+		assertEquals(length, head.headers().getLong(UHttpHeaders.CONTENT_LENGTH, -1));
+		assertEquals(0, head.body().length);
+
+		final UHttpRequest conditional = new UHttpRequest("GET", url+"/encoded");
+		conditional.headers().set(UHttpHeaders.IF_NONE_MATCH, "\"v1\"");
+		final UHttpResponse notModified = client.send(conditional).get(5, TimeUnit.SECONDS);
+		assertEquals(304, notModified.status());
+		assertEquals("gzip", notModified.headers().get(UHttpHeaders.CONTENT_ENCODING));
+		assertEquals(0, notModified.body().length);
+
+		// the next response on the connection is still decompressed
+		final UHttpResponse response = client.get(url+"/encoded").get(5, TimeUnit.SECONDS);
+		assertFalse(response.headers().contains(UHttpHeaders.CONTENT_ENCODING));
+		assertEquals("hello", response.bodyAsString());
+		assertEquals(1, client.connections());
+	}
+
+	@Test
+	public void requestDecompression() throws Exception {
+		client.setCompression(false);
+		final UHttpRequest echo = new UHttpRequest("POST", url+"/echo").setBody(UCompressor.compress(UCompression.GZIP, bytes("hello"), pool));
+		echo.headers().set(UHttpHeaders.CONTENT_ENCODING, "gzip");
+		assertEquals("hello", client.send(echo).get(5, TimeUnit.SECONDS).bodyAsString());
+
+		// a body that expands beyond the maximal body size of the server is rejected
+		final UHttpRequest bomb = new UHttpRequest("POST", url+"/echo").setBody(UCompressor.compress(UCompression.GZIP, new byte[1 << 20], pool));
+		bomb.headers().set(UHttpHeaders.CONTENT_ENCODING, "gzip");
+		assertEquals(413, client.send(bomb).get(5, TimeUnit.SECONDS).status());
+
+		final UHttpRequest invalid = new UHttpRequest("POST", url+"/echo").setBody("hello");
+		invalid.headers().set(UHttpHeaders.CONTENT_ENCODING, "gzip");
+		assertEquals(400, client.send(invalid).get(5, TimeUnit.SECONDS).status());
+
+		final UHttpRequest unknown = new UHttpRequest("POST", url+"/echo").setBody("hello");
+		unknown.headers().set(UHttpHeaders.CONTENT_ENCODING, "br");
+		assertEquals(415, client.send(unknown).get(5, TimeUnit.SECONDS).status());
+	}
+}
@@ -0,0 +1,277 @@
+import static org.junit.Assert.*;
+
+import java.net.InetSocketAddress;
+import java.nio.charset.StandardCharsets;
+import java.util.ArrayList;
+import java.util.Collections;
+import java.util.Comparator;
+import java.util.List;
+import java.util.Random;
+import java.util.concurrent.TimeUnit;
+
+import org.junit.After;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UBuffer;
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UDatagramPacket;
+import com.umpani.aio.UEventLoop;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UMemoryChannel;
+import com.umpani.aio.UReferenceCounted;
+import com.umpani.aio.UVirtualEventLoop;
+import com.umpani.aio.codec.UNdjsonDecoder;
+import com.umpani.aio.codec.UNdjsonEncoder;
+import com.umpani.aio.exception.UBlockingOperationException;
+import com.umpani.util.UMap;
+
+@SuppressWarnings("unchecked")
+public class TMemory {
+	private UVirtualEventLoop loop;
+	private UBufferPool pool;
+
+	@Before
+	public void setUp() throws Exception {
+		loop = new UVirtualEventLoop("test");
+		pool = new UBufferPool(false).setLeakDetection(1);
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		loop.shutdown();
+		assertTrue(loop.isTerminated());
+		assertNull(UEventLoop.current());
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	/**
+	 * Creates an initializer that records every event as string into the given list.
+	 */
+	private static UChannelInitializer record( final List<String> events ) {
+		return new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new UChannelHandlerAdapter() {
+					@Override
+					public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+						final UBuffer buffer = msg instanceof UDatagramPacket ? ((UDatagramPacket)msg).content() : (UBuffer)msg;
+						final byte[] bytes = new byte[buffer.remaining()];
+						buffer.nio().get(bytes);
+						events.add(new String(bytes, StandardCharsets.UTF_8));
+						((UReferenceCounted)msg).release();
+					}
+
+					@Override
+					public void userEvent( final UHandlerContext ctx, final Object event ) throws Exception {
+						events.add(String.valueOf(event));
+					}
+
+					@Override
+					public void exceptionCaught( final UHandlerContext ctx, final Throwable cause ) throws Exception {
+						events.add(cause.getClass().getSimpleName()+": "+cause.getMessage());
+					}
+
+					@Override
+					public void channelInactive( final UHandlerContext ctx ) throws Exception {
+						events.add("inactive");
+					}
+				});
+			}
+		};
+	}
+
+	@Test
+	public void virtualClock() throws Exception {
+		final ArrayList<Integer> order = new ArrayList<>();
+		for (final int delay : new int[] { 20, 5, 10 }) {
+			loop.schedule(new Runnable() {
+				@Override
+				public void run() {
+					order.add(delay);
+				}
+			}, delay, TimeUnit.MILLISECONDS);
+		}
+		final UFuture<Void> never = loop.schedule(new Runnable() {
+			@Override
+			public void run() {}
+		}, 1, TimeUnit.HOURS);
+		assertEquals(0, loop.runPending());
+		assertEquals(2, loop.advance(15, TimeUnit.MILLISECONDS));
+		assertEquals(15000000L, loop.clock().nanoTime());
+		assertEquals("[5, 10]", order.toString());
+		loop.advance(5, TimeUnit.MILLISECONDS);
+		assertEquals("[5, 10, 20]", order.toString());
+		assertSame(loop, UEventLoop.current());
+		try {
+			never.get();
+			fail("Expected an UBlockingOperationException");
+		} catch (UBlockingOperationException e) {
+			// expected, the test thread is the loop thread
+		}
+		try {
+			loop.start();
+			fail("Expected an IllegalStateException");
+		} catch (IllegalStateException e) {
+			// expected
+		}
+	}
+
+	@Test
+	public void conversationWithLatencyAndPartialWrites() throws Exception {
+		final ArrayList<Integer> reads = new ArrayList<>();
+		final ArrayList<Object> replies = new ArrayList<>();
+		final UFuture<UMemoryChannel> opened = UMemoryChannel.openStream(loop, pool, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new UNdjsonDecoder(), new UNdjsonEncoder(), new UChannelHandlerAdapter() {
+					@Override
+					public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+						replies.add(msg);
+					}
+				});
+			}
+		}, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new UChannelHandlerAdapter() {
+					@Override
+					public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+						reads.add(((UBuffer)msg).remaining());
+						ctx.fireChannelRead(msg);
+					}
+				}, new UNdjsonDecoder(), new UNdjsonEncoder(), new UChannelHandlerAdapter() {
+					@Override
+					public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+						ctx.writeAndFlush(UMap.of(String.class, Object.class, "echo", msg));
+					}
+				});
+			}
+		});
+		assertFalse(opened.isDone());
+		loop.runPending();
+		final UMemoryChannel client = opened.getNow();
+		final UMemoryChannel server = client.peer();
+		assertTrue(client.isActive());
+		assertTrue(server.isActive());
+		assertEquals(client.localAddress(), server.remoteAddress());
+		client.setLatency(10, TimeUnit.MILLISECONDS).setMaxWriteSize(4);
+		server.setLatency(10, TimeUnit.MILLISECONDS);
+
+		final UFuture<Void> written = client.writeAndFlush(UMap.of(String.class, Object.class, "id", 1L, "text", "hello"));
+		loop.runPending();
+		assertTrue(written.isSuccess());
+		assertTrue(reads.isEmpty());
+		loop.advance(9, TimeUnit.MILLISECONDS);
+		assertTrue(reads.isEmpty());
+		// the request arrives in pieces of four bytes, the reply after another 10ms
+		loop.advance(1, TimeUnit.MILLISECONDS);
+		assertTrue(reads.size() > 1);
+		for (final int n : reads) assertTrue(n <= 4);
+		assertTrue(replies.isEmpty());
+		loop.advance(10, TimeUnit.MILLISECONDS);
+		assertEquals(1, replies.size());
+		assertEquals("hello", ((UMap<String,Object>)replies.get(0)).getMap("echo").getString("text"));
+
+		// closing delivers the bytes in flight and then the end of the stream, the server closes as well
+		client.close();
+		loop.runPending();
+		assertFalse(client.isOpen());
+		assertTrue(server.isOpen());
+		loop.advance(10, TimeUnit.MILLISECONDS);
+		assertFalse(server.isOpen());
+		assertTrue(server.closeFuture().isDone());
+	}
+
+	/**
+	 * Sends 20 datagrams with the given seed of the jitter and returns the received datagrams.
+	 */
+	private List<String> sendWithJitter( final long seed ) {
+		final ArrayList<String> received = new ArrayList<>();
+		final UFuture<UMemoryChannel> opened = UMemoryChannel.openDatagram(loop, pool, null, record(received));
+		loop.runPending();
+		final UMemoryChannel client = opened.getNow();
+		client.setLatency(5, TimeUnit.MILLISECONDS).setJitter(50, TimeUnit.MILLISECONDS, new Random(seed));
+		for (int i=0; i < 20; i++) client.write(("datagram "+i).getBytes(StandardCharsets.UTF_8));
+		client.flush();
+		// a datagram to another address is lost
+		client.writeAndFlush(new UDatagramPacket(new byte[1], new InetSocketAddress("127.0.0.1", 9)));
+		loop.advance(4, TimeUnit.MILLISECONDS);
+		assertTrue(received.isEmpty());
+		loop.advance(51, TimeUnit.MILLISECONDS);
+		assertEquals(20, received.size());
+		final ArrayList<String> result = new ArrayList<>(received);
+		// the peer of a datagram connection is not told about the close
+		client.close();
+		loop.advance(100, TimeUnit.MILLISECONDS);
+		assertTrue(client.peer().isOpen());
+		client.peer().close();
+		loop.runPending();
+		return result;
+	}
+
+	@Test
+	public void datagramReordering() throws Exception {
+		final List<String> first = sendWithJitter(42L);
+		final ArrayList<String> sorted = new ArrayList<>(first);
+		Collections.sort(sorted, new Comparator<String>() {
+			@Override
+			public int compare( final String a, final String b ) {
+				return Integer.parseInt(a.substring(9)) - Integer.parseInt(b.substring(9));
+			}
+		});
+		assertNotEquals(sorted, first);
+		for (int i=0; i < 20; i++) assertEquals("datagram "+i, sorted.get(i));
+		// the same seed repeats the same order
+		assertEquals(first, sendWithJitter(42L));
+	}
+
+	@Test
+	public void halfCloseAndReset() throws Exception {
+		final ArrayList<String> clientEvents = new ArrayList<>();
+		final ArrayList<String> serverEvents = new ArrayList<>();
+		final UFuture<UMemoryChannel> opened = UMemoryChannel.openStream(loop, pool, record(clientEvents), record(serverEvents));
+		loop.runPending();
+		final UMemoryChannel client = opened.getNow();
+		final UMemoryChannel server = client.peer().setAllowHalfClosure(true);
+
+		client.writeAndFlush("request".getBytes(StandardCharsets.UTF_8));
+		client.shutdownOutput();
+		assertTrue(client.isOutputShutdown());
+		loop.runPending();
+		assertEquals("[request, INPUT_SHUTDOWN]", serverEvents.toString());
+		assertTrue(server.isActive());
+
+		// writing after the shutdown fails
+		final UFuture<Void> failed = client.writeAndFlush(new byte[1]);
+		loop.runPending();
+		assertFalse(failed.isSuccess());
+		assertFalse(client.isOpen());
+		assertTrue(clientEvents.get(0).startsWith("ClosedChannelException"));
+		clientEvents.clear();
+
+		// the server may still write, but the client is closed now
+		server.writeAndFlush("response".getBytes(StandardCharsets.UTF_8));
+		loop.runPending();
+		assertTrue(clientEvents.toString(), clientEvents.isEmpty());
+		server.close();
+		loop.runPending();
+
+		// a reset is reported to the peer, which closes
+		final UFuture<UMemoryChannel> reopened = UMemoryChannel.openStream(loop, pool, record(clientEvents), record(serverEvents));
+		loop.runPending();
+		serverEvents.clear();
+		final UMemoryChannel other = reopened.getNow();
+		other.setLatency(1, TimeUnit.MILLISECONDS);
+		other.writeAndFlush("lost".getBytes(StandardCharsets.UTF_8));
+		other.reset();
+		assertFalse(other.isOpen());
+		loop.advance(1, TimeUnit.MILLISECONDS);
+		assertEquals("[IOException: Connection reset by peer, inactive]", serverEvents.toString());
+		assertFalse(other.peer().isOpen());
+	}
+}
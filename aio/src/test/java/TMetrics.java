@@ -0,0 +1,172 @@
+import static org.junit.Assert.*;
+
+import java.nio.charset.StandardCharsets;
+import java.util.concurrent.CountDownLatch;
+import java.util.concurrent.TimeUnit;
+
+import javax.management.MBeanServer;
+import javax.management.MBeanServerFactory;
+import javax.management.ObjectName;
+
+import org.junit.After;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UEventLoop;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UMemoryChannel;
+import com.umpani.aio.UReferences;
+import com.umpani.aio.UVirtualEventLoop;
+import com.umpani.aio.metrics.UHistogram;
+import com.umpani.aio.metrics.UMetrics;
+import com.umpani.util.UMap;
+
+public class TMetrics {
+	private UVirtualEventLoop loop;
+	private UBufferPool pool;
+
+	@Before
+	public void setUp() throws Exception {
+		loop = new UVirtualEventLoop("test");
+		pool = new UBufferPool(false).setLeakDetection(1);
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		loop.shutdown();
+		assertTrue(loop.isTerminated());
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	/**
+	 * An initializer whose handler releases every read message.
+	 */
+	private static final UChannelInitializer DISCARD = new UChannelInitializer() {
+		@Override
+		public void initChannel( final UChannel channel ) {
+			channel.pipeline().addLast(new UChannelHandlerAdapter() {
+				@Override
+				public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+					UReferences.release(msg);
+				}
+			});
+		}
+	};
+
+	@Test
+	public void histogram() {
+		final UHistogram histogram = new UHistogram();
+		assertEquals(0L, histogram.getPercentile(0.99));
+		for (int i=1; i <= 100; i++) histogram.record(i);
+		histogram.record(-5);
+		assertEquals(101L, histogram.getCount());
+		assertEquals(5050L, histogram.getSum());
+		assertEquals(100L, histogram.getMax());
+		// the percentiles are upper bounds within a factor of two
+		final long p50 = histogram.getPercentile(0.5);
+		assertTrue(String.valueOf(p50), p50 >= 50 && p50 <= 100);
+		assertEquals(100L, histogram.getPercentile(0.99));
+		assertEquals(0L, histogram.getPercentile(0));
+		final UMap<String,Object> snapshot = histogram.snapshot();
+		assertEquals(101L, snapshot.getLong("count"));
+		assertEquals(100L, snapshot.getLong("max"));
+		try {
+			histogram.getPercentile(1.5);
+			fail("Expected an IllegalArgumentException");
+		} catch (IllegalArgumentException e) {
+			// expected
+		}
+	}
+
+	@Test
+	public void connectionsAndBuffers() throws Exception {
+		final UFuture<UMemoryChannel> opened = UMemoryChannel.openStream(loop, pool, DISCARD, DISCARD);
+		loop.runPending();
+		final UMemoryChannel client = opened.getNow();
+		assertEquals(2, loop.getOpenChannels());
+
+		// written bytes are pending until flushed
+		client.write("hello".getBytes(StandardCharsets.UTF_8));
+		assertEquals(5L, client.getPendingBytes());
+		assertEquals(5L, loop.getPendingWriteBytes());
+		client.flush();
+		loop.runPending();
+		assertEquals(0L, loop.getPendingWriteBytes());
+		assertEquals(5L, client.getBytesWritten());
+		assertEquals(5L, client.peer().getBytesRead());
+		assertEquals(5L, loop.getBytesWritten());
+		assertEquals(5L, loop.getBytesRead());
+		assertTrue(pool.getAllocations() > 0);
+		assertEquals(0L, pool.getActive());
+		assertEquals(0L, pool.getActiveBytes());
+
+		final UMetrics metrics = new UMetrics().add(loop).add("test", pool);
+		final UMap<String,Object> snapshot = metrics.snapshot();
+		final UMap<String,Object> connections = snapshot.getMap("connections");
+		assertEquals(2L, connections.getLong("open"));
+		assertEquals(5L, connections.getLong("bytesRead"));
+		final UMap<String,Object> loops = snapshot.getMap("loops");
+		final UMap<String,Object> test = loops.getMap("test");
+		assertEquals(0L, test.getLong("queuedTasks"));
+		final UMap<String,Object> pools = snapshot.getMap("pools");
+		final UMap<String,Object> testPool = pools.getMap("test");
+		assertEquals(0L, testPool.getLong("leaked"));
+
+		// tasks are queued until the loop runs
+		loop.execute(new Runnable() {
+			@Override
+			public void run() {}
+		});
+		assertEquals(1, loop.getQueuedTasks());
+		loop.runPending();
+		assertEquals(0, loop.getQueuedTasks());
+
+		client.close();
+		loop.runPending();
+		assertEquals(0, loop.getOpenChannels());
+		assertEquals(0L, loop.getPendingWriteBytes());
+	}
+
+	@Test
+	public void mbeans() throws Exception {
+		final MBeanServer server = MBeanServerFactory.newMBeanServer();
+		final UEventLoop running = new UEventLoop("metrics").start();
+		try {
+			final CountDownLatch executed = new CountDownLatch(1);
+			running.execute(new Runnable() {
+				@Override
+				public void run() {
+					executed.countDown();
+				}
+			});
+			assertTrue(executed.await(5, TimeUnit.SECONDS));
+			// the iteration is counted after its tasks were executed
+			final long deadline = System.nanoTime() + TimeUnit.SECONDS.toNanos(5);
+			while (running.getIterations()==0 && System.nanoTime() < deadline) Thread.sleep(1);
+			final UMetrics metrics = new UMetrics("test.metrics").add(running).add("test", pool).registerMBeans(server);
+			final ObjectName loopName = new ObjectName("test.metrics:type=EventLoop,name=\"metrics\"");
+			assertEquals("metrics", server.getAttribute(loopName, "Name"));
+			assertTrue((Long)server.getAttribute(loopName, "Wakeups") >= 1);
+			assertTrue((Long)server.getAttribute(loopName, "Iterations") >= 1);
+			assertEquals(0, server.getAttribute(loopName, "OpenChannels"));
+			final ObjectName poolName = new ObjectName("test.metrics:type=BufferPool,name=\"test\"");
+			assertEquals(0L, server.getAttribute(poolName, "Active"));
+			assertEquals(1, server.getAttribute(poolName, "LeakDetection"));
+
+			// registering again replaces the MBeans
+			metrics.registerMBeans(server);
+			assertTrue(server.isRegistered(loopName));
+			metrics.unregisterMBeans();
+			assertFalse(server.isRegistered(loopName));
+			assertFalse(server.isRegistered(poolName));
+		} finally {
+			running.shutdown();
+			assertTrue(running.awaitTermination(5, TimeUnit.SECONDS));
+		}
+	}
+}
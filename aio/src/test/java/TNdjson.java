@@ -0,0 +1,157 @@
+import static org.junit.Assert.*;
+
+import java.io.OutputStream;
+import java.net.InetSocketAddress;
+import java.nio.charset.StandardCharsets;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicReference;
+
+import org.junit.After;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UBufferOutputStream;
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UCompositeBuffer;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UNdjsonServerSocket;
+import com.umpani.aio.UNdjsonSocket;
+import com.umpani.aio.UServer;
+import com.umpani.aio.codec.UNdjsonDecoder;
+import com.umpani.aio.codec.UNdjsonEncoder;
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+import com.umpani.util.json.UJsonWriter;
+
+@SuppressWarnings("unchecked")
+public class TNdjson {
+	private UEventLoopGroup group;
+	private UBufferPool pool;
+
+	@Before
+	public void setUp() throws Exception {
+		group = new UEventLoopGroup("test", 2);
+		pool = new UBufferPool(false).setLeakDetection(1);
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		group.shutdown();
+		assertTrue(group.awaitTermination(5, TimeUnit.SECONDS));
+	}
+
+	@Test
+	public void bufferOutputStreamEncodesUtf8() throws Exception {
+		final UBufferOutputStream out = new UBufferOutputStream(pool, 4, 8);
+		out.append("aä€😀").append('\ud800').append('x').append("0123456789", 2, 5);
+		final byte[] expected = "aä€😀?x234".getBytes(StandardCharsets.UTF_8);
+		assertEquals(expected.length, out.size());
+		final UCompositeBuffer buffer = out.toBuffer();
+		assertTrue(buffer.components() > 1);
+		final byte[] bytes = new byte[buffer.readableBytes()];
+		buffer.readBytes(bytes, 0, bytes.length);
+		assertArrayEquals(expected, bytes);
+		buffer.release();
+		out.close();
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	/**
+	 * Starts a server that replies to every value with {"echo":value} and to every error with {"error":type}.
+	 */
+	private UServer startEchoServer() throws Exception {
+		final UServer server = new UServer(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new UNdjsonDecoder(64), new UNdjsonEncoder(), new UChannelHandlerAdapter() {
+					@Override
+					public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+						ctx.writeAndFlush(UMap.of(String.class, Object.class, "echo", msg));
+					}
+
+					@Override
+					public void exceptionCaught( final UHandlerContext ctx, final Throwable cause ) throws Exception {
+						ctx.writeAndFlush(UMap.of(String.class, Object.class, "error", cause.getClass().getSimpleName()));
+					}
+				});
+			}
+		}, pool);
+		server.bind(new InetSocketAddress("127.0.0.1", 0));
+		return server;
+	}
+
+	@Test
+	public void codecOverLoopback() throws Exception {
+		final UServer server = startEchoServer();
+		try (UNdjsonSocket socket = UNdjsonSocket.connect(server.localAddress())) {
+			socket.setTimeout(5000);
+			final UMap<String,Object> request = UMap.of(String.class, Object.class, "id", 1L, "text", "hällo 😀\nline");
+			UMap<String,Object> reply = (UMap<String,Object>)socket.request(request);
+			final UMap<String,Object> echo = reply.getMap("echo");
+			assertEquals(1L, echo.getLong("id"));
+			assertEquals("hällo 😀\nline", echo.getString("text"));
+
+			final UList<Object> list = new UList<Object>();
+			list.add(1L);
+			list.add("two");
+			reply = (UMap<String,Object>)socket.request(list);
+			assertEquals(UJsonWriter.toJson(list), UJsonWriter.toJson(reply.get("echo")));
+
+			// invalid and too long lines are reported, but do not break the connection
+			final OutputStream out = socket.socket().getOutputStream();
+			out.write("\n{\"a\":\n".getBytes(StandardCharsets.UTF_8));
+			out.flush();
+			reply = (UMap<String,Object>)socket.receive();
+			assertEquals("UCodecException", reply.getString("error"));
+			final StringBuilder sb = new StringBuilder("[");
+			for (int i=0; i < 100; i++) sb.append(i).append(',');
+			sb.append("0]\r\n");
+			out.write(sb.toString().getBytes(StandardCharsets.UTF_8));
+			out.flush();
+			reply = (UMap<String,Object>)socket.receive();
+			assertEquals("UTooLongFrameException", reply.getString("error"));
+			reply = (UMap<String,Object>)socket.request(request);
+			assertEquals(1L, ((UMap<String,Object>)reply.getMap("echo")).getLong("id"));
+		}
+		server.close().get(5, TimeUnit.SECONDS);
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	@Test
+	public void blockingServerAndClient() throws Exception {
+		final UNdjsonServerSocket server = new UNdjsonServerSocket(0);
+		final AtomicReference<Throwable> failure = new AtomicReference<Throwable>();
+		final Thread thread = new Thread() {
+			@Override
+			public void run() {
+				try (UNdjsonSocket socket = server.accept()) {
+					Object value;
+					while ((value = socket.receive())!=null) {
+						final UMap<String,Object> map = (UMap<String,Object>)value;
+						socket.send(UMap.of(String.class, Object.class, "n", map.getLong("n") + 1));
+					}
+				} catch (Throwable t) {
+					failure.set(t);
+				}
+			}
+		};
+		thread.start();
+		try (UNdjsonSocket socket = UNdjsonSocket.connect(server.localAddress())) {
+			socket.setTimeout(5000);
+			long n = 0;
+			for (int i=0; i < 3; i++) {
+				final UMap<String,Object> reply = (UMap<String,Object>)socket.request(UMap.of(String.class, Object.class, "n", n));
+				assertEquals(n + 1, reply.getLong("n"));
+				n = reply.getLong("n");
+			}
+		}
+		thread.join(5000);
+		assertFalse(thread.isAlive());
+		assertNull(failure.get());
+		server.close();
+	}
+}
@@ -0,0 +1,510 @@
+import static org.junit.Assert.*;
+
+import java.io.BufferedReader;
+import java.io.ByteArrayOutputStream;
+import java.io.InputStreamReader;
+import java.io.OutputStream;
+import java.net.InetSocketAddress;
+import java.net.ServerSocket;
+import java.net.Socket;
+import java.net.SocketAddress;
+import java.nio.ByteBuffer;
+import java.nio.channels.ClosedChannelException;
+import java.nio.charset.StandardCharsets;
+import java.util.ArrayList;
+import java.util.Arrays;
+import java.util.List;
+import java.util.concurrent.BlockingQueue;
+import java.util.concurrent.Callable;
+import java.util.concurrent.ExecutionException;
+import java.util.concurrent.LinkedBlockingQueue;
+import java.util.concurrent.TimeUnit;
+
+import org.junit.After;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UBuffer;
+import com.umpani.aio.UBufferOutputStream;
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UClient;
+import com.umpani.aio.UCompositeBuffer;
+import com.umpani.aio.UEventLoop;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.UServer;
+import com.umpani.aio.USocketChannel;
+import com.umpani.aio.codec.UFixedLengthFrameDecoder;
+import com.umpani.aio.codec.ULengthFieldFrameDecoder;
+import com.umpani.aio.codec.ULengthFieldPrepender;
+import com.umpani.aio.codec.ULineFrameDecoder;
+import com.umpani.aio.codec.UMessageToByteEncoder;
+import com.umpani.aio.exception.UTooLongFrameException;
+
+public class TPipeline {
+	private UEventLoopGroup group;
+	private UBufferPool pool;
+
+	@Before
+	public void setUp() throws Exception {
+		group = new UEventLoopGroup("test", 2);
+		pool = new UBufferPool(false).setLeakDetection(1);
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		group.shutdown();
+		assertTrue(group.awaitTermination(5, TimeUnit.SECONDS));
+	}
+
+	/**
+	 * A channel that writes into memory, accepting only a limited amount of bytes per write.
+	 */
+	static class TestChannel extends UChannel {
+		final ByteArrayOutputStream written = new ByteArrayOutputStream();
+		int accept = Integer.MAX_VALUE;
+		boolean writeInterest;
+		boolean open = true;
+
+		TestChannel( final UEventLoop loop, final UBufferPool pool ) {
+			super(loop, pool);
+		}
+
+		@Override
+		public boolean isOpen() {
+			return open;
+		}
+
+		@Override
+		public boolean isActive() {
+			return open;
+		}
+
+		@Override
+		public SocketAddress localAddress() {
+			return null;
+		}
+
+		@Override
+		public SocketAddress remoteAddress() {
+			return null;
+		}
+
+		@Override
+		protected int writeBytes( final ByteBuffer buffer ) {
+			final int n = Math.min(accept, buffer.remaining());
+			for (int i=0; i < n; i++) written.write(buffer.get());
+			return n;
+		}
+
+		@Override
+		protected void setWriteInterest( final boolean interested ) {
+			writeInterest = interested;
+		}
+
+		@Override
+		protected void doClose() {
+			open = false;
+		}
+
+		/**
+		 * Accepts all bytes, like a transport that became writable again.
+		 */
+		void drain() {
+			accept = Integer.MAX_VALUE;
+			flushPending();
+		}
+	}
+
+	/**
+	 * Terminates all inbound messages, buffers are converted into strings.
+	 */
+	static class Collector extends UChannelHandlerAdapter {
+		final BlockingQueue<Object> messages = new LinkedBlockingQueue<>();
+
+		@Override
+		public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+			if (msg instanceof UBuffer) {
+				final UBuffer buffer = (UBuffer)msg;
+				messages.add(StandardCharsets.UTF_8.decode(buffer.nio()).toString());
+				buffer.release();
+			} else
+			if (msg instanceof UCompositeBuffer) {
+				final UCompositeBuffer buffer = (UCompositeBuffer)msg;
+				final byte[] bytes = new byte[buffer.readableBytes()];
+				buffer.readBytes(bytes, 0, bytes.length);
+				messages.add(new String(bytes, StandardCharsets.UTF_8));
+				buffer.release();
+			} else {
+				messages.add(msg);
+			}
+		}
+
+		@Override
+		public void exceptionCaught( final UHandlerContext ctx, final Throwable cause ) throws Exception {
+			messages.add(cause);
+		}
+
+		Object poll() throws InterruptedException {
+			return messages.poll(5, TimeUnit.SECONDS);
+		}
+	}
+
+	/**
+	 * Records the events that pass it.
+	 */
+	static class Recorder extends UChannelHandlerAdapter {
+		Recorder( final String name, final List<String> events ) {
+			this.name = name;
+			this.events = events;
+		}
+
+		final String name;
+		final List<String> events;
+
+		@Override
+		public void handlerAdded( final UHandlerContext ctx ) throws Exception {
+			events.add(name+":added");
+		}
+
+		@Override
+		public void handlerRemoved( final UHandlerContext ctx ) throws Exception {
+			events.add(name+":removed");
+		}
+
+		@Override
+		public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+			events.add(name+":read");
+			ctx.fireChannelRead(msg);
+		}
+
+		@Override
+		public void channelWritabilityChanged( final UHandlerContext ctx ) throws Exception {
+			events.add(name+":writable="+ctx.channel().isWritable());
+			ctx.fireChannelWritabilityChanged();
+		}
+
+		@Override
+		public void channelInactive( final UHandlerContext ctx ) throws Exception {
+			events.add(name+":inactive");
+			ctx.fireChannelInactive();
+		}
+
+		@Override
+		public void write( final UHandlerContext ctx, final Object msg, final UPromise<Void> promise ) throws Exception {
+			events.add(name+":write");
+			ctx.write(msg, promise);
+		}
+	}
+
+	/**
+	 * Encodes strings as UTF-8.
+	 */
+	static class StringEncoder extends UMessageToByteEncoder<String> {
+		StringEncoder( final String suffix ) {
+			super(String.class);
+			this.suffix = suffix;
+		}
+
+		final String suffix;
+
+		@Override
+		protected void encode( final UHandlerContext ctx, final String msg, final UBufferOutputStream out ) throws Exception {
+			out.write((msg+suffix).getBytes(StandardCharsets.UTF_8));
+		}
+	}
+
+	/**
+	 * Executes the given task in the given loop and waits for its result.
+	 */
+	private static <T> T call( final UEventLoop loop, final Callable<T> task ) throws Exception {
+		final UPromise<T> promise = new UPromise<T>(null);
+		loop.execute(new Runnable() {
+			@Override
+			public void run() {
+				try {
+					promise.complete(task.call());
+				} catch (Throwable t) {
+					promise.fail(t);
+				}
+			}
+		});
+		return promise.get(5, TimeUnit.SECONDS);
+	}
+
+	/**
+	 * Allocates a buffer containing the given bytes.
+	 */
+	private UBuffer buffer( final int... bytes ) {
+		final UBuffer buffer = pool.allocate(bytes.length);
+		for (final int b : bytes) buffer.nio().put((byte)b);
+		buffer.nio().flip();
+		return buffer;
+	}
+
+	/**
+	 * Allocates a buffer containing the given text.
+	 */
+	private UBuffer buffer( final String text ) {
+		final byte[] bytes = text.getBytes(StandardCharsets.UTF_8);
+		final UBuffer buffer = pool.allocate(bytes.length);
+		buffer.nio().put(bytes).flip();
+		return buffer;
+	}
+
+	/**
+	 * Passes the given buffers into the pipeline of the given channel from within its loop.
+	 */
+	private static void feed( final UChannel channel, final UBuffer... buffers ) throws Exception {
+		call(channel.loop(), new Callable<Void>() {
+			@Override
+			public Void call() {
+				for (final UBuffer buffer : buffers) channel.pipeline().fireChannelRead(buffer);
+				return null;
+			}
+		});
+	}
+
+	@Test
+	public void eventOrder() throws Exception {
+		final List<String> events = new ArrayList<>();
+		final TestChannel channel = new TestChannel(group.get(0), pool);
+		final Collector collector = new Collector();
+		call(channel.loop(), new Callable<Void>() {
+			@Override
+			public Void call() {
+				channel.pipeline().addLast("a", new Recorder("a", events)).addLast("b", new Recorder("b", events)).addLast("c", collector);
+				channel.pipeline().addAfter("a", "x", new Recorder("x", events));
+				channel.pipeline().fireChannelRead("msg");
+				channel.pipeline().write("out", new UPromise<Void>(null));
+				channel.pipeline().remove("x");
+				channel.pipeline().fireChannelRead("msg");
+				return null;
+			}
+		});
+		assertEquals(Arrays.asList("a", "b", "c"), channel.pipeline().names());
+		assertEquals(Arrays.asList(
+			"a:added", "b:added", "x:added",
+			"a:read", "x:read", "b:read",
+			"b:write", "x:write", "a:write",
+			"x:removed",
+			"a:read", "b:read"), events);
+		assertEquals("msg", collector.poll());
+		assertEquals("msg", collector.poll());
+		assertEquals("a", channel.pipeline().context(channel.pipeline().get("a")).name());
+		try {
+			channel.pipeline().addLast("a", new Collector());
+			fail();
+		} catch (IllegalArgumentException e) {
+			// expected
+		}
+	}
+
+	@Test
+	public void writabilityFollowsWaterMarks() throws Exception {
+		final List<String> events = new ArrayList<>();
+		final TestChannel channel = new TestChannel(group.get(0), pool);
+		channel.setWriteBufferWaterMark(8, 16);
+		channel.accept = 0;
+		channel.pipeline().addLast("recorder", new Recorder("r", events)).addLast("prepender", new ULengthFieldPrepender(2)).addLast("encoder", new StringEncoder(""));
+		final List<UFuture<Void>> futures = call(channel.loop(), new Callable<List<UFuture<Void>>>() {
+			@Override
+			public List<UFuture<Void>> call() {
+				final List<UFuture<Void>> futures = new ArrayList<>();
+				futures.add(channel.writeAndFlush("0123456789"));
+				assertTrue(channel.isWritable());
+				futures.add(channel.writeAndFlush("abcdef"));
+				assertFalse(channel.isWritable());
+				assertTrue(channel.writeInterest);
+				assertEquals(20L, channel.getPendingBytes());
+				return futures;
+			}
+		});
+		assertFalse(futures.get(0).isDone());
+		call(channel.loop(), new Callable<Void>() {
+			@Override
+			public Void call() {
+				channel.drain();
+				return null;
+			}
+		});
+		assertTrue(channel.isWritable());
+		assertFalse(channel.writeInterest);
+		assertTrue(futures.get(0).isSuccess());
+		assertTrue(futures.get(1).isSuccess());
+		assertEquals(Arrays.asList("r:write", "r:write", "r:writable=false", "r:writable=true"), events);
+		final byte[] expected = "\u0000\n0123456789\u0000\u0006abcdef".getBytes(StandardCharsets.UTF_8);
+		assertArrayEquals(expected, channel.written.toByteArray());
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	@Test
+	public void closeFailsPendingWrites() throws Exception {
+		final List<String> events = new ArrayList<>();
+		final TestChannel channel = new TestChannel(group.get(0), pool);
+		channel.accept = 1;
+		channel.pipeline().addLast("recorder", new Recorder("r", events));
+		final UFuture<Void> write = channel.writeAndFlush(buffer("pending"));
+		channel.close().get(5, TimeUnit.SECONDS);
+		assertTrue(channel.closeFuture().isDone());
+		try {
+			write.get(5, TimeUnit.SECONDS);
+			fail();
+		} catch (ExecutionException e) {
+			assertTrue(e.getCause() instanceof ClosedChannelException);
+		}
+		assertEquals("p", new String(channel.written.toByteArray(), StandardCharsets.UTF_8));
+		assertEquals(Arrays.asList("r:write", "r:inactive"), events);
+		// writing to a closed channel fails immediately
+		assertFalse(channel.writeAndFlush(buffer("late")).await().isSuccess());
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	@Test
+	public void lengthFieldFrames() throws Exception {
+		final TestChannel channel = new TestChannel(group.get(0), pool);
+		final Collector collector = new Collector();
+		channel.pipeline().addLast("frame", new ULengthFieldFrameDecoder(16, 2)).addLast("collector", collector);
+		feed(channel, buffer(0, 5, 'h', 'e'), buffer('l', 'l', 'o', 0, 2, 'a'), buffer('b', 0, 20));
+		assertEquals("hello", collector.poll());
+		assertEquals("ab", collector.poll());
+		assertTrue(collector.poll() instanceof UTooLongFrameException);
+		// the too long frame is discarded
+		feed(channel, buffer(new int[15]), buffer(new int[5]), buffer(0, 1, 'x'));
+		assertEquals("x", collector.poll());
+		assertTrue(collector.messages.isEmpty());
+
+		// a length field that counts the whole frame
+		final TestChannel other = new TestChannel(group.get(1), pool);
+		other.pipeline().addLast("frame", new ULengthFieldFrameDecoder(64, 1, 2, -3, 3)).addLast("collector", collector);
+		feed(other, buffer(9, 0, 6, 'a', 'b', 'c', 9, 0, 3));
+		assertEquals("abc", collector.poll());
+		assertEquals("", collector.poll());
+		channel.close().get(5, TimeUnit.SECONDS);
+		other.close().get(5, TimeUnit.SECONDS);
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	@Test
+	public void lineFrames() throws Exception {
+		final TestChannel channel = new TestChannel(group.get(0), pool);
+		final Collector collector = new Collector();
+		channel.pipeline().addLast("frame", new ULineFrameDecoder(8)).addLast("collector", collector);
+		feed(channel, buffer("one\r\ntw"), buffer("o\nthree-is-too-long\nfour"));
+		assertEquals("one", collector.poll());
+		assertEquals("two", collector.poll());
+		assertTrue(collector.poll() instanceof UTooLongFrameException);
+		feed(channel, buffer("\r\n"));
+		assertEquals("four", collector.poll());
+		// a line without terminator fails as soon as it is too long and is discarded up to the terminator
+		feed(channel, buffer("aaaaaaaaaaaa"));
+		assertTrue(collector.poll() instanceof UTooLongFrameException);
+		feed(channel, buffer("aaa\r"), buffer("\nok\n"));
+		assertEquals("ok", collector.poll());
+		assertTrue(collector.messages.isEmpty());
+		channel.close().get(5, TimeUnit.SECONDS);
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	@Test
+	public void fixedLengthFramesAndRemoval() throws Exception {
+		final TestChannel channel = new TestChannel(group.get(0), pool);
+		final Collector collector = new Collector();
+		channel.pipeline().addLast("frame", new UFixedLengthFrameDecoder(3)).addLast("collector", collector);
+		feed(channel, buffer("abcd"), buffer("efg"));
+		assertEquals("abc", collector.poll());
+		assertEquals("def", collector.poll());
+		// the remaining bytes are passed on, once the decoder is removed
+		channel.pipeline().remove("frame");
+		assertEquals("g", collector.poll());
+		feed(channel, buffer("hij"));
+		assertEquals("hij", collector.poll());
+		channel.close().get(5, TimeUnit.SECONDS);
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	@Test
+	public void lineServerOverLoopback() throws Exception {
+		final UServer server = new UServer(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new ULineFrameDecoder(1024), new StringEncoder("\n"), new UChannelHandlerAdapter() {
+					@Override
+					public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+						final UBuffer buffer = (UBuffer)msg;
+						final String line = StandardCharsets.UTF_8.decode(buffer.nio()).toString();
+						buffer.release();
+						ctx.writeAndFlush(line.toUpperCase());
+					}
+				});
+			}
+		}, pool);
+		final InetSocketAddress address = server.bind(new InetSocketAddress("127.0.0.1", 0));
+		try (Socket socket = new Socket(address.getAddress(), address.getPort())) {
+			socket.setSoTimeout(5000);
+			final OutputStream out = socket.getOutputStream();
+			out.write("hello\nwor".getBytes(StandardCharsets.UTF_8));
+			out.flush();
+			final BufferedReader in = new BufferedReader(new InputStreamReader(socket.getInputStream(), StandardCharsets.UTF_8));
+			assertEquals("HELLO", in.readLine());
+			out.write("ld\r\n".getBytes(StandardCharsets.UTF_8));
+			out.flush();
+			assertEquals("WORLD", in.readLine());
+			assertEquals(1, server.channels().size());
+		}
+		server.close().get(5, TimeUnit.SECONDS);
+		assertTrue(server.channels().isEmpty());
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	@Test
+	public void lengthFieldEchoBetweenClientAndServer() throws Exception {
+		final UServer server = new UServer(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new ULengthFieldFrameDecoder(1 << 20, 4), new ULengthFieldPrepender(4), new UChannelHandlerAdapter() {
+					@Override
+					public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+						ctx.writeAndFlush(msg);
+					}
+				});
+			}
+		}, pool);
+		final InetSocketAddress address = server.bind(new InetSocketAddress("127.0.0.1", 0));
+		final Collector collector = new Collector();
+		final UClient client = new UClient(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new ULengthFieldFrameDecoder(1 << 20, 4), new ULengthFieldPrepender(4), new StringEncoder(""), collector);
+			}
+		}, pool);
+		final USocketChannel channel = client.connect(address).get(5, TimeUnit.SECONDS);
+		assertTrue(channel.isActive());
+		channel.writeAndFlush("ping");
+		final char[] chars = new char[300000];
+		for (int i=0; i < chars.length; i++) chars[i] = (char)('a' + i % 26);
+		final String large = new String(chars);
+		channel.writeAndFlush(large).get(5, TimeUnit.SECONDS);
+		channel.writeAndFlush("pong");
+		assertEquals("ping", collector.poll());
+		assertEquals(large, collector.poll());
+		assertEquals("pong", collector.poll());
+		channel.close().get(5, TimeUnit.SECONDS);
+		assertFalse(channel.isOpen());
+		server.close().get(5, TimeUnit.SECONDS);
+		// a refused connection fails the connect
+		final ServerSocket unused = new ServerSocket(0, 1, address.getAddress());
+		unused.close();
+		try {
+			client.connect(new InetSocketAddress(address.getAddress(), unused.getLocalPort())).get(5, TimeUnit.SECONDS);
+			fail();
+		} catch (ExecutionException e) {
+			// expected
+		}
+	}
+}
@@ -0,0 +1,267 @@
+import static org.junit.Assert.*;
+
+import java.io.IOException;
+import java.util.ArrayList;
+import java.util.concurrent.Callable;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicInteger;
+
+import org.junit.After;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UFunction;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.UVirtualEventLoop;
+import com.umpani.aio.exception.UBulkheadFullException;
+import com.umpani.aio.exception.UCircuitOpenException;
+import com.umpani.aio.exception.URateLimitException;
+import com.umpani.aio.resilience.UBulkhead;
+import com.umpani.aio.resilience.UCircuitBreaker;
+import com.umpani.aio.resilience.UCircuitState;
+import com.umpani.aio.resilience.UPolicy;
+import com.umpani.aio.resilience.URateLimiter;
+import com.umpani.aio.resilience.URetry;
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+
+public class TResilience {
+	private UVirtualEventLoop loop;
+
+	@Before
+	public void setUp() throws Exception {
+		loop = new UVirtualEventLoop("test");
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		loop.shutdown();
+		assertTrue(loop.isTerminated());
+	}
+
+	/**
+	 * A call that returns the given futures one after another and counts its invocations.
+	 */
+	private static final class Call implements Callable<UFuture<String>> {
+		Call( final UFuture<?>... results ) {
+			for (final UFuture<?> result : results) {
+				@SuppressWarnings("unchecked")
+				final UFuture<String> future = (UFuture<String>)result;
+				this.results.add(future);
+			}
+		}
+
+		final ArrayList<UFuture<String>> results = new ArrayList<>();
+		final AtomicInteger invocations = new AtomicInteger();
+
+		@Override
+		public UFuture<String> call() {
+			final int i = invocations.getAndIncrement();
+			return results.get(Math.min(i, results.size() - 1));
+		}
+	}
+
+	private static UFuture<String> io() {
+		return UFuture.failed(new IOException("unavailable"));
+	}
+
+	@Test
+	public void retry() {
+		final URetry retry = new URetry(loop, 3).setBackoff(100, 1000, TimeUnit.MILLISECONDS).setJitter(0);
+		assertEquals(TimeUnit.MILLISECONDS.toNanos(100), retry.getDelayNanos(1));
+		assertEquals(TimeUnit.MILLISECONDS.toNanos(400), retry.getDelayNanos(3));
+		assertEquals(TimeUnit.MILLISECONDS.toNanos(1000), retry.getDelayNanos(5));
+
+		final Call call = new Call(io(), io(), UFuture.succeeded("ok"));
+		final UFuture<String> result = retry.execute(call);
+		loop.runPending();
+		assertEquals(1, call.invocations.get());
+		loop.advance(90, TimeUnit.MILLISECONDS);
+		assertEquals(1, call.invocations.get());
+		loop.advance(20, TimeUnit.MILLISECONDS);
+		assertEquals(2, call.invocations.get());
+		// the second retry waits twice as long
+		loop.advance(170, TimeUnit.MILLISECONDS);
+		assertEquals(2, call.invocations.get());
+		assertFalse(result.isDone());
+		loop.advance(30, TimeUnit.MILLISECONDS);
+		assertEquals(3, call.invocations.get());
+		assertEquals("ok", result.getNow());
+
+		// failures the predicate rejects are not retried
+		retry.setRetryOn(new UFunction<Throwable, Boolean>() {
+			@Override
+			public Boolean apply( final Throwable cause ) {
+				return cause instanceof IOException;
+			}
+		});
+		final Call invalid = new Call(UFuture.failed(new IllegalArgumentException("invalid")));
+		final UFuture<String> failed = retry.execute(invalid);
+		loop.runPending();
+		assertEquals(1, invalid.invocations.get());
+		assertTrue(failed.cause() instanceof IllegalArgumentException);
+
+		// the last failure is passed on after all attempts
+		final Call down = new Call(io());
+		final UFuture<String> exhausted = retry.execute(down);
+		loop.advance(1, TimeUnit.SECONDS);
+		assertEquals(3, down.invocations.get());
+		assertTrue(exhausted.cause() instanceof IOException);
+
+		// cancelling stops the retries
+		final Call cancelled = new Call(io());
+		final UFuture<String> pending = retry.execute(cancelled);
+		loop.runPending();
+		pending.cancel(false);
+		loop.advance(1, TimeUnit.SECONDS);
+		assertEquals(1, cancelled.invocations.get());
+		assertTrue(pending.isCancelled());
+
+		final UMap<String,Object> snapshot = retry.snapshot();
+		assertEquals("retry", snapshot.getString("type"));
+		assertEquals(4L, snapshot.getLong("calls"));
+		assertEquals(5L, snapshot.getLong("retries"));
+		assertEquals(2L, snapshot.getLong("failures"));
+	}
+
+	@Test
+	public void circuitBreaker() {
+		final UCircuitBreaker breaker = new UCircuitBreaker(loop.clock()).setWindow(4, 4).setFailureRateThreshold(0.5).setOpenDuration(1, TimeUnit.SECONDS).setTrialCalls(1);
+		breaker.execute(new Call(UFuture.succeeded("ok")));
+		breaker.execute(new Call(UFuture.succeeded("ok")));
+		breaker.execute(new Call(io()));
+		assertEquals(UCircuitState.CLOSED, breaker.getState());
+		breaker.execute(new Call(io()));
+		assertEquals(UCircuitState.OPEN, breaker.getState());
+		assertEquals(0.5, breaker.getFailureRate(), 0.0);
+
+		// an open breaker doesn't invoke the call
+		final Call rejected = new Call(UFuture.succeeded("ok"));
+		final UFuture<String> result = breaker.execute(rejected);
+		assertEquals(0, rejected.invocations.get());
+		final UCircuitOpenException e = (UCircuitOpenException)result.cause();
+		assertEquals(TimeUnit.SECONDS.toNanos(1), e.remainingNanos);
+
+		// after the open duration a single trial call is permitted
+		loop.advance(1, TimeUnit.SECONDS);
+		assertEquals(UCircuitState.HALF_OPEN, breaker.getState());
+		final UPromise<String> trial = new UPromise<String>(null);
+		breaker.execute(new Call(trial));
+		assertTrue(breaker.execute(new Call(UFuture.succeeded("ok"))).cause() instanceof UCircuitOpenException);
+		trial.complete("ok");
+		assertEquals(UCircuitState.CLOSED, breaker.getState());
+		assertEquals(0d, breaker.getFailureRate(), 0.0);
+
+		// a failed trial opens the breaker again
+		breaker.open();
+		loop.advance(1, TimeUnit.SECONDS);
+		breaker.execute(new Call(io()));
+		assertEquals(UCircuitState.OPEN, breaker.getState());
+
+		final UMap<String,Object> snapshot = breaker.snapshot();
+		assertEquals("circuitBreaker", snapshot.getString("type"));
+		assertEquals("OPEN", snapshot.getString("state"));
+		assertEquals(6L, snapshot.getLong("calls"));
+		assertEquals(3L, snapshot.getLong("failures"));
+		assertEquals(2L, snapshot.getLong("rejected"));
+	}
+
+	@Test
+	public void rateLimiter() {
+		final URateLimiter limiter = new URateLimiter(loop, 2, 1, TimeUnit.SECONDS).setMaxWait(600, TimeUnit.MILLISECONDS);
+		assertEquals(2, limiter.getAvailablePermits());
+		final Call call = new Call(UFuture.succeeded("ok"));
+		assertEquals("ok", limiter.execute(call).getNow());
+		assertEquals("ok", limiter.execute(call).getNow());
+
+		// the third call waits for the next permit, the fourth would wait too long
+		final UFuture<String> delayed = limiter.execute(call);
+		final UFuture<String> rejected = limiter.execute(call);
+		final URateLimitException e = (URateLimitException)rejected.cause();
+		assertEquals(TimeUnit.SECONDS.toNanos(1), e.waitNanos);
+		loop.advance(490, TimeUnit.MILLISECONDS);
+		assertEquals(2, call.invocations.get());
+		assertFalse(delayed.isDone());
+		loop.advance(20, TimeUnit.MILLISECONDS);
+		assertEquals(3, call.invocations.get());
+		assertEquals("ok", delayed.getNow());
+
+		// the bucket refills up to the burst size
+		loop.advance(5, TimeUnit.SECONDS);
+		assertEquals(2, limiter.getAvailablePermits());
+		final UMap<String,Object> snapshot = limiter.snapshot();
+		assertEquals("rateLimiter", snapshot.getString("type"));
+		assertEquals(2L, snapshot.getLong("permitted"));
+		assertEquals(1L, snapshot.getLong("delayed"));
+		assertEquals(1L, snapshot.getLong("rejected"));
+	}
+
+	@Test
+	public void bulkhead() {
+		final UBulkhead bulkhead = new UBulkhead(1, 1);
+		final UPromise<String> running = new UPromise<String>(null);
+		final Call first = new Call(running);
+		final Call second = new Call(UFuture.succeeded("second"));
+		final UFuture<String> result = bulkhead.execute(first);
+		final UFuture<String> queued = bulkhead.execute(second);
+		final UFuture<String> rejected = bulkhead.execute(new Call(UFuture.succeeded("third")));
+		assertTrue(rejected.cause() instanceof UBulkheadFullException);
+		assertEquals(1, bulkhead.getActive());
+		assertEquals(1, bulkhead.getQueued());
+		assertEquals(0, second.invocations.get());
+
+		// the waiting call starts once the running one completed
+		running.complete("first");
+		loop.runPending();
+		assertEquals("first", result.getNow());
+		assertEquals("second", queued.getNow());
+		assertEquals(0, bulkhead.getActive());
+
+		// cancelling a waiting call removes it from the queue
+		final UPromise<String> blocking = new UPromise<String>(null);
+		bulkhead.execute(new Call(blocking));
+		final Call cancelled = new Call(UFuture.succeeded("cancelled"));
+		bulkhead.execute(cancelled).cancel(false);
+		assertEquals(0, bulkhead.getQueued());
+		blocking.complete("done");
+		assertEquals(0, cancelled.invocations.get());
+		assertEquals(0, bulkhead.getActive());
+
+		final UMap<String,Object> snapshot = bulkhead.snapshot();
+		assertEquals("bulkhead", snapshot.getString("type"));
+		assertEquals(1L, snapshot.getLong("maxConcurrent"));
+		assertEquals(1L, snapshot.getLong("rejected"));
+	}
+
+	@Test
+	public void composition() throws Exception {
+		final URetry retry = new URetry(loop, 2).setBackoff(10, 10, TimeUnit.MILLISECONDS);
+		final UBulkhead bulkhead = new UBulkhead(1, 0);
+		final UPolicy policy = retry.and(new UCircuitBreaker(loop.clock())).and(bulkhead);
+		final AtomicInteger calls = new AtomicInteger();
+		final UFunction<String, UFuture<String>> echo = policy.wrap(new UFunction<String, UFuture<String>>() {
+			@Override
+			public UFuture<String> apply( final String value ) {
+				return calls.getAndIncrement()==0 ? io() : UFuture.succeeded(value);
+			}
+		});
+		final UFuture<String> result = echo.apply("hello");
+		loop.advance(100, TimeUnit.MILLISECONDS);
+		assertEquals("hello", result.getNow());
+		assertEquals(2, calls.get());
+
+		final UMap<String,Object> snapshot = policy.snapshot();
+		assertEquals("composite", snapshot.getString("type"));
+		final UList<Object> policies = snapshot.getList("policies");
+		assertEquals(3, policies.size());
+		@SuppressWarnings("unchecked")
+		final UMap<String,Object> first = (UMap<String,Object>)policies.get(0);
+		assertEquals("retry", first.getString("type"));
+		assertEquals(1L, first.getLong("retries"));
+		@SuppressWarnings("unchecked")
+		final UMap<String,Object> last = (UMap<String,Object>)policies.get(2);
+		assertEquals("bulkhead", last.getString("type"));
+		assertEquals(0L, last.getLong("active"));
+	}
+}
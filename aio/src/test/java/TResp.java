@@ -0,0 +1,234 @@
+import static org.junit.Assert.*;
+
+import java.net.InetSocketAddress;
+import java.nio.charset.StandardCharsets;
+import java.util.ArrayList;
+import java.util.List;
+import java.util.concurrent.LinkedBlockingQueue;
+import java.util.concurrent.TimeUnit;
+
+import org.junit.After;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UClient;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UMemoryChannel;
+import com.umpani.aio.USocketChannel;
+import com.umpani.aio.UVirtualEventLoop;
+import com.umpani.aio.resp.UResp;
+import com.umpani.aio.resp.URespDecoder;
+import com.umpani.aio.resp.URespEncoder;
+import com.umpani.aio.resp.URespError;
+import com.umpani.aio.resp.URespKeyspace;
+import com.umpani.aio.resp.URespServer;
+import com.umpani.aio.resp.URespServerHandler;
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+
+@SuppressWarnings("unchecked")
+public class TResp {
+	private UVirtualEventLoop loop;
+	private UBufferPool pool;
+	private URespKeyspace keyspace;
+
+	@Before
+	public void setUp() throws Exception {
+		loop = new UVirtualEventLoop("test");
+		pool = new UBufferPool(false).setLeakDetection(1);
+		keyspace = new URespKeyspace(loop);
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		loop.shutdown();
+		assertTrue(loop.isTerminated());
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	/**
+	 * Connects a client whose pipeline decodes the replies into the given list.
+	 */
+	private UMemoryChannel connect( final List<Object> replies, final boolean encode ) {
+		final UFuture<UMemoryChannel> opened = UMemoryChannel.openStream(loop, pool, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new URespDecoder());
+				if (encode) channel.pipeline().addLast(new URespEncoder());
+				channel.pipeline().addLast(new UChannelHandlerAdapter() {
+					@Override
+					public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+						replies.add(msg);
+					}
+				});
+			}
+		}, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new URespDecoder(), new URespEncoder(), new URespServerHandler(keyspace));
+			}
+		});
+		loop.runPending();
+		return opened.getNow();
+	}
+
+	private static UList<Object> command( final Object... args ) {
+		return UList.of(Object.class, args);
+	}
+
+	@Test
+	public void stringsAndHashes() throws Exception {
+		final ArrayList<Object> replies = new ArrayList<>();
+		final UMemoryChannel client = connect(replies, true);
+		client.write(command("SET", "greeting", "hello"));
+		client.write(command("GET", "greeting"));
+		client.write(command("GET", "missing"));
+		client.write(command("HSET", "user", "name", "alice", "age", "42"));
+		client.write(command("HSET", "user", "age", "43"));
+		client.write(command("HGET", "user", "age"));
+		client.write(command("HGETALL", "user"));
+		client.write(command("GET", "user"));
+		client.write(command("DEL", "greeting", "user", "missing"));
+		client.write(command("DBSIZE"));
+		client.write(command("flushall"));
+		client.writeAndFlush(command("NOPE", "x"));
+		loop.runPending();
+
+		assertEquals(12, replies.size());
+		assertEquals("OK", replies.get(0));
+		assertEquals("hello", replies.get(1));
+		assertSame(UResp.NULL, replies.get(2));
+		assertEquals(2L, replies.get(3));
+		assertEquals(0L, replies.get(4));
+		assertEquals("43", replies.get(5));
+		// RESP2 has no maps, the hash is a flat array of fields and values
+		assertEquals(4, ((List<Object>)replies.get(6)).size());
+		assertEquals("WRONGTYPE", ((URespError)replies.get(7)).code());
+		assertEquals(2L, replies.get(8));
+		assertEquals(0L, replies.get(9));
+		assertEquals("OK", replies.get(10));
+		assertEquals("ERR unknown command 'nope'", ((URespError)replies.get(11)).message());
+		client.close();
+		loop.runPending();
+	}
+
+	@Test
+	public void expiration() throws Exception {
+		final ArrayList<Object> replies = new ArrayList<>();
+		final UMemoryChannel client = connect(replies, true);
+		client.write(command("SET", "session", "abc", "EX", "10"));
+		client.write(command("SET", "session", "def", "NX"));
+		client.write(command("SET", "counter", "1"));
+		client.write(command("EXPIRE", "counter", "5"));
+		client.write(command("TTL", "session"));
+		client.writeAndFlush(command("TTL", "missing"));
+		loop.runPending();
+		assertEquals("[OK, (nil), OK, 1, 10, -2]", replies.toString());
+		replies.clear();
+
+		loop.advance(5, TimeUnit.SECONDS);
+		assertEquals(1L, keyspace.execute(command("DBSIZE")).getNow());
+		client.writeAndFlush(command("PTTL", "session"));
+		loop.runPending();
+		assertEquals(5000L, replies.get(0));
+		loop.advance(5, TimeUnit.SECONDS);
+		assertEquals(0L, keyspace.execute(command("DBSIZE")).getNow());
+		assertNull(keyspace.execute(command("GET", "session")).getNow());
+
+		// setting a key again removes its time to live
+		keyspace.execute(command("SET", "key", "value", "PX", "100"));
+		keyspace.execute(command("SET", "key", "value"));
+		assertEquals(-1L, keyspace.execute(command("TTL", "key")).getNow());
+		loop.advance(1, TimeUnit.SECONDS);
+		assertEquals("value", keyspace.execute(command("GET", "key")).getNow());
+		assertEquals(URespKeyspace.SYNTAX_ERROR, keyspace.execute(command("SET", "key", "value", "NX", "XX")).getNow());
+		client.close();
+		loop.runPending();
+	}
+
+	@Test
+	public void helloAndPipelining() throws Exception {
+		final ArrayList<Object> replies = new ArrayList<>();
+		final UMemoryChannel client = connect(replies, true);
+		// the commands arrive in pieces of three bytes
+		client.setMaxWriteSize(3);
+		client.write(command("HSET", "user", "name", "alice"));
+		client.write(command("HELLO", "3"));
+		client.write(command("HGETALL", "user"));
+		client.write(command("GET", "missing"));
+		client.writeAndFlush(command("HELLO", "4"));
+		loop.runPending();
+		assertEquals(5, replies.size());
+		assertEquals(1L, replies.get(0));
+		final UMap<String,Object> hello = (UMap<String,Object>)replies.get(1);
+		assertEquals(3L, hello.getLong("proto"));
+		final UMap<String,Object> user = (UMap<String,Object>)replies.get(2);
+		assertEquals("alice", user.getString("name"));
+		assertSame(UResp.NULL, replies.get(3));
+		assertEquals("NOPROTO", ((URespError)replies.get(4)).code());
+
+		client.writeAndFlush(command("QUIT"));
+		loop.runPending();
+		assertEquals("OK", replies.get(5));
+		assertFalse(client.isOpen());
+	}
+
+	@Test
+	public void inlineCommandsAndProtocolErrors() throws Exception {
+		final ArrayList<Object> replies = new ArrayList<>();
+		final UMemoryChannel client = connect(replies, false);
+		client.writeAndFlush("PING\r\n\r\necho  hi \r\n".getBytes(StandardCharsets.UTF_8));
+		loop.runPending();
+		assertEquals(2, replies.size());
+		assertEquals("PONG", replies.get(0));
+		assertEquals("hi", replies.get(1));
+
+		client.writeAndFlush("*1\r\n$x\r\n".getBytes(StandardCharsets.UTF_8));
+		loop.runPending();
+		assertEquals("ERR", ((URespError)replies.get(2)).code());
+		assertTrue(((URespError)replies.get(2)).message().startsWith("ERR Protocol error"));
+		assertFalse(client.isOpen());
+	}
+
+	@Test
+	public void serverOverTcp() throws Exception {
+		final UEventLoopGroup group = new UEventLoopGroup("test", 2);
+		final URespServer server = new URespServer(group, pool);
+		final LinkedBlockingQueue<Object> replies = new LinkedBlockingQueue<>();
+		try {
+			final InetSocketAddress address = server.bind(new InetSocketAddress("127.0.0.1", 0));
+			final UClient client = new UClient(group, new UChannelInitializer() {
+				@Override
+				public void initChannel( final UChannel channel ) {
+					channel.pipeline().addLast(new URespDecoder(), new URespEncoder(), new UChannelHandlerAdapter() {
+						@Override
+						public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+							replies.add(msg);
+						}
+					});
+				}
+			}, pool);
+			// connections on both loops share the keyspace owned by the first loop
+			final USocketChannel first = client.connect(address).get(5, TimeUnit.SECONDS);
+			final USocketChannel second = client.connect(address).get(5, TimeUnit.SECONDS);
+			for (int i=0; i < 100; i++) first.write(command("SET", "key"+i, Integer.toString(i)));
+			first.writeAndFlush(command("DBSIZE")).get(5, TimeUnit.SECONDS);
+			for (int i=0; i < 100; i++) assertEquals("OK", replies.poll(5, TimeUnit.SECONDS));
+			assertEquals(100L, replies.poll(5, TimeUnit.SECONDS));
+			for (int i=0; i < 100; i++) second.write(command("GET", "key"+i));
+			second.flush();
+			for (int i=0; i < 100; i++) assertEquals(Integer.toString(i), replies.poll(5, TimeUnit.SECONDS));
+			first.close();
+			second.close();
+		} finally {
+			server.close().await();
+			UEventLoopGroup.shutdown(5, TimeUnit.SECONDS, group);
+		}
+	}
+}
@@ -0,0 +1,237 @@
+import static org.junit.Assert.*;
+
+import java.net.InetSocketAddress;
+import java.nio.channels.ClosedChannelException;
+import java.util.ArrayList;
+import java.util.List;
+import java.util.concurrent.ExecutionException;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.TimeoutException;
+
+import org.junit.After;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UClient;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.UServer;
+import com.umpani.aio.USocketChannel;
+import com.umpani.aio.codec.UNdjsonDecoder;
+import com.umpani.aio.codec.UNdjsonEncoder;
+import com.umpani.aio.exception.URpcException;
+import com.umpani.aio.rpc.URpcClient;
+import com.umpani.aio.rpc.URpcClientHandler;
+import com.umpani.aio.rpc.URpcMethod;
+import com.umpani.aio.rpc.URpcServer;
+import com.umpani.aio.rpc.URpcServerHandler;
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+
+@SuppressWarnings("unchecked")
+public class TRpc {
+	private UEventLoopGroup group;
+	private UBufferPool pool;
+	private URpcServer server;
+	private final List<Object> notified = new ArrayList<>();
+
+	@Before
+	public void setUp() throws Exception {
+		group = new UEventLoopGroup("test", 2);
+		pool = new UBufferPool(false).setLeakDetection(1);
+		server = new URpcServer();
+		server.register("add", new URpcMethod() {
+			@Override
+			public UFuture<?> invoke( final Object params ) throws Exception {
+				if (!(params instanceof UList)) throw new IllegalArgumentException("Expected a list of numbers");
+				long sum = 0;
+				for (final Object value : (UList<Object>)params) sum += ((Number)value).longValue();
+				return UFuture.succeeded(sum);
+			}
+		});
+		server.register("greet", new URpcMethod() {
+			@Override
+			public UFuture<?> invoke( final Object params ) throws Exception {
+				return UFuture.succeeded("Hello "+((UMap<String,Object>)params).getString("name"));
+			}
+		});
+		server.register("fail", new URpcMethod() {
+			@Override
+			public UFuture<?> invoke( final Object params ) throws Exception {
+				throw new URpcException(42, "Failed", params);
+			}
+		});
+		server.register("notify", new URpcMethod() {
+			@Override
+			public UFuture<?> invoke( final Object params ) throws Exception {
+				synchronized (notified) {
+					notified.add(params);
+				}
+				return null;
+			}
+		});
+		server.register("never", new URpcMethod() {
+			@Override
+			public UFuture<?> invoke( final Object params ) throws Exception {
+				return new UPromise<Object>(null);
+			}
+		});
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		group.shutdown();
+		assertTrue(group.awaitTermination(5, TimeUnit.SECONDS));
+	}
+
+	private UMap<String,Object> handle( final String json ) throws Exception {
+		return (UMap<String,Object>)server.handle(json).get(5, TimeUnit.SECONDS);
+	}
+
+	private static long errorCode( final UMap<String,Object> response ) {
+		assertFalse(response.containsKey("result"));
+		return ((UMap<String,Object>)response.getMap("error")).getLong("code");
+	}
+
+	@Test
+	public void serverResponses() throws Exception {
+		UMap<String,Object> response = handle("{\"jsonrpc\":\"2.0\",\"method\":\"add\",\"params\":[1,2,3],\"id\":1}");
+		assertEquals("2.0", response.getString("jsonrpc"));
+		assertEquals(6L, response.getLong("result"));
+		assertEquals(1L, response.getLong("id"));
+
+		response = handle("{\"jsonrpc\":\"2.0\",\"method\":\"greet\",\"params\":{\"name\":\"rpc\"},\"id\":\"a\"}");
+		assertEquals("Hello rpc", response.getString("result"));
+		assertEquals("a", response.getString("id"));
+
+		response = handle("{\"jsonrpc\":\"2.0\",\"method\":\"add\",\"params\":{},\"id\":2}");
+		assertEquals(URpcException.INVALID_PARAMS, errorCode(response));
+
+		response = handle("{\"jsonrpc\":\"2.0\",\"method\":\"fail\",\"params\":[\"x\"],\"id\":3}");
+		assertEquals(42L, errorCode(response));
+		assertEquals(3L, response.getLong("id"));
+
+		response = handle("{\"jsonrpc\":\"2.0\",\"method\":\"missing\",\"id\":4}");
+		assertEquals(URpcException.METHOD_NOT_FOUND, errorCode(response));
+
+		response = handle("{\"jsonrpc\":\"2.0\",\"method\":");
+		assertEquals(URpcException.PARSE_ERROR, errorCode(response));
+		assertTrue(response.containsKey("id"));
+		assertNull(response.get("id"));
+
+		response = handle("{\"jsonrpc\":\"2.0\",\"method\":1,\"params\":\"bar\",\"id\":5}");
+		assertEquals(URpcException.INVALID_REQUEST, errorCode(response));
+		assertEquals(5L, response.getLong("id"));
+
+		response = handle("{\"jsonrpc\":\"1.0\",\"method\":\"add\",\"id\":6}");
+		assertEquals(URpcException.INVALID_REQUEST, errorCode(response));
+
+		response = handle("[]");
+		assertEquals(URpcException.INVALID_REQUEST, errorCode(response));
+
+		// notifications never have a response, not even if they fail
+		assertNull(server.handle("{\"jsonrpc\":\"2.0\",\"method\":\"notify\",\"params\":[7]}").get(5, TimeUnit.SECONDS));
+		assertNull(server.handle("{\"jsonrpc\":\"2.0\",\"method\":\"missing\"}").get(5, TimeUnit.SECONDS));
+		assertEquals(1, notified.size());
+	}
+
+	@Test
+	public void serverBatches() throws Exception {
+		UList<Object> responses = (UList<Object>)server.handle("["
+			+ "{\"jsonrpc\":\"2.0\",\"method\":\"add\",\"params\":[1,2],\"id\":1},"
+			+ "{\"jsonrpc\":\"2.0\",\"method\":\"notify\",\"params\":[3]},"
+			+ "{\"foo\":\"boo\"},"
+			+ "{\"jsonrpc\":\"2.0\",\"method\":\"missing\",\"id\":2}"
+			+ "]").get(5, TimeUnit.SECONDS);
+		assertEquals(3, responses.size());
+		assertEquals(3L, ((UMap<String,Object>)responses.get(0)).getLong("result"));
+		assertEquals(URpcException.INVALID_REQUEST, errorCode((UMap<String,Object>)responses.get(1)));
+		assertEquals(URpcException.METHOD_NOT_FOUND, errorCode((UMap<String,Object>)responses.get(2)));
+		assertEquals(1, notified.size());
+
+		responses = (UList<Object>)server.handle("[1,2]").get(5, TimeUnit.SECONDS);
+		assertEquals(2, responses.size());
+		assertEquals(URpcException.INVALID_REQUEST, errorCode((UMap<String,Object>)responses.get(0)));
+
+		assertNull(server.handle("[{\"jsonrpc\":\"2.0\",\"method\":\"notify\"},{\"jsonrpc\":\"2.0\",\"method\":\"notify\"}]").get(5, TimeUnit.SECONDS));
+		assertEquals(3, notified.size());
+	}
+
+	@Test
+	public void clientAndServerOverNdjson() throws Exception {
+		final UServer rpcServer = new UServer(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new UNdjsonDecoder(), new UNdjsonEncoder(), new URpcServerHandler(server));
+			}
+		}, pool);
+		final InetSocketAddress address = rpcServer.bind(new InetSocketAddress("127.0.0.1", 0));
+		final UClient rpcClient = new UClient(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new UNdjsonDecoder(), new UNdjsonEncoder(), new URpcClientHandler());
+			}
+		}, pool);
+		final USocketChannel channel = rpcClient.connect(address).get(5, TimeUnit.SECONDS);
+		final URpcClient client = channel.pipeline().get(URpcClientHandler.class).client();
+
+		// concurrent calls are correlated by id
+		final ArrayList<UFuture<Object>> calls = new ArrayList<>();
+		for (int i=0; i < 100; i++) calls.add(client.call("add", UList.of(Object.class, i, 1000)));
+		for (int i=0; i < 100; i++) assertEquals(i + 1000L, calls.get(i).get(5, TimeUnit.SECONDS));
+
+		assertEquals("Hello client", client.call("greet", UMap.of(String.class, Object.class, "name", "client")).get(5, TimeUnit.SECONDS));
+		try {
+			client.call("fail", UList.of(Object.class, "data")).get(5, TimeUnit.SECONDS);
+			fail();
+		} catch (ExecutionException e) {
+			final URpcException cause = (URpcException)e.getCause();
+			assertEquals(42, cause.getCode());
+			assertEquals("Failed", cause.getMessage());
+			assertEquals("data", ((UList<Object>)cause.getData()).get(0));
+		}
+
+		final URpcClient.Batch batch = client.batch();
+		final UFuture<Object> sum = batch.call("add", UList.of(Object.class, 2, 3));
+		final UFuture<Object> missing = batch.notification("notify", null).call("missing", null);
+		batch.send().get(5, TimeUnit.SECONDS);
+		assertEquals(5L, sum.get(5, TimeUnit.SECONDS));
+		try {
+			missing.get(5, TimeUnit.SECONDS);
+			fail();
+		} catch (ExecutionException e) {
+			assertEquals(URpcException.METHOD_NOT_FOUND, ((URpcException)e.getCause()).getCode());
+		}
+
+		client.sendNotification("notify", UList.of(Object.class, 1)).get(5, TimeUnit.SECONDS);
+		// requests of a connection are handled in order, so the notification was handled once this call returns
+		assertEquals(0L, client.call("add", new UList<Object>()).get(5, TimeUnit.SECONDS));
+		synchronized (notified) {
+			assertEquals(2, notified.size());
+		}
+		try {
+			client.call("never", null, 100, TimeUnit.MILLISECONDS).get(5, TimeUnit.SECONDS);
+			fail();
+		} catch (ExecutionException e) {
+			assertTrue(e.getCause() instanceof TimeoutException);
+		}
+		assertEquals(0, client.pending());
+
+		// pending calls fail once the connection is closed
+		final UFuture<Object> pending = client.call("never", null);
+		rpcServer.close().get(5, TimeUnit.SECONDS);
+		try {
+			pending.get(5, TimeUnit.SECONDS);
+			fail();
+		} catch (ExecutionException e) {
+			assertTrue(e.getCause() instanceof ClosedChannelException);
+		}
+		assertEquals(0, client.pending());
+		channel.closeFuture().get(5, TimeUnit.SECONDS);
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+}
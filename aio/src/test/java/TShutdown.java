@@ -0,0 +1,213 @@
+import static org.junit.Assert.*;
+
+import java.nio.charset.StandardCharsets;
+import java.util.ArrayList;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicBoolean;
+import java.util.concurrent.atomic.AtomicReference;
+
+import org.junit.After;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UBuffer;
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UDrainResult;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UMemoryChannel;
+import com.umpani.aio.UPromise;
+import com.umpani.aio.UServer;
+import com.umpani.aio.UVirtualEventLoop;
+import com.umpani.aio.codec.UNdjsonDecoder;
+import com.umpani.aio.codec.UNdjsonEncoder;
+import com.umpani.aio.http.UHttpHandler;
+import com.umpani.aio.http.UHttpRequest;
+import com.umpani.aio.http.UHttpRequestDecoder;
+import com.umpani.aio.http.UHttpResponseEncoder;
+import com.umpani.aio.http.UHttpServerHandler;
+import com.umpani.aio.rpc.URpcMethod;
+import com.umpani.aio.rpc.URpcServer;
+import com.umpani.aio.rpc.URpcServerHandler;
+
+public class TShutdown {
+	private UVirtualEventLoop loop;
+	private UBufferPool pool;
+
+	@Before
+	public void setUp() throws Exception {
+		loop = new UVirtualEventLoop("test");
+		pool = new UBufferPool(false).setLeakDetection(1);
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		loop.shutdown();
+		assertTrue(loop.isTerminated());
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	/**
+	 * Creates an initializer that appends all received bytes to the given builder.
+	 */
+	private static UChannelInitializer collect( final StringBuilder received ) {
+		return new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new UChannelHandlerAdapter() {
+					@Override
+					public void channelRead( final UHandlerContext ctx, final Object msg ) throws Exception {
+						final UBuffer buffer = (UBuffer)msg;
+						final byte[] bytes = new byte[buffer.remaining()];
+						buffer.nio().get(bytes);
+						received.append(new String(bytes, StandardCharsets.UTF_8));
+						buffer.release();
+					}
+				});
+			}
+		};
+	}
+
+	/**
+	 * Opens a connection and returns the client end.
+	 */
+	private UMemoryChannel open( final UChannelInitializer client, final UChannelInitializer server ) {
+		final UFuture<UMemoryChannel> opened = UMemoryChannel.openStream(loop, pool, client, server);
+		loop.runPending();
+		return opened.getNow();
+	}
+
+	private static void send( final UChannel channel, final String text ) {
+		channel.writeAndFlush(text.getBytes(StandardCharsets.UTF_8));
+	}
+
+	@Test
+	public void httpDrain() throws Exception {
+		final AtomicReference<UPromise<Object>> slow = new AtomicReference<>();
+		final UHttpHandler handler = new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				final UPromise<Object> promise = new UPromise<Object>(null);
+				slow.set(promise);
+				return promise;
+			}
+		};
+		final UChannelInitializer server = new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new UHttpRequestDecoder(), new UHttpResponseEncoder(), new UHttpServerHandler(handler));
+			}
+		};
+		final UMemoryChannel idle = open(null, server);
+		final StringBuilder received = new StringBuilder();
+		final UMemoryChannel busy = open(collect(received), server);
+		send(busy, "GET /slow HTTP/1.1\r\nHost: test\r\n\r\n");
+		loop.runPending();
+		assertNotNull(slow.get());
+
+		final ArrayList<UChannel> channels = new ArrayList<>();
+		channels.add(idle.peer());
+		channels.add(busy.peer());
+		final UFuture<UDrainResult> drained = UServer.drain(channels, 1, TimeUnit.SECONDS);
+		loop.runPending();
+		// the idle connection is closed at once, the busy one waits for its response
+		assertFalse(idle.peer().isOpen());
+		assertTrue(busy.peer().isOpen());
+		assertFalse(drained.isDone());
+
+		slow.get().complete("done");
+		loop.runPending();
+		assertTrue(received.toString(), received.toString().startsWith("HTTP/1.1 200"));
+		assertTrue(received.toString(), received.toString().toLowerCase().contains("connection: close\r\n"));
+		assertTrue(received.toString().endsWith("done"));
+		assertFalse(busy.peer().isOpen());
+		assertTrue(drained.isDone());
+		assertEquals(2, drained.getNow().drained());
+		assertEquals(0, drained.getNow().killed());
+		loop.runPending();
+		assertFalse(idle.isOpen());
+		assertFalse(busy.isOpen());
+	}
+
+	@Test
+	public void rpcDrainAndKill() throws Exception {
+		final URpcServer rpc = new URpcServer().register("hang", new URpcMethod() {
+			@Override
+			public UFuture<?> invoke( final Object params ) {
+				return new UPromise<Object>(null);
+			}
+		});
+		final UChannelInitializer server = new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new UNdjsonDecoder(), new UNdjsonEncoder(), new URpcServerHandler(rpc));
+			}
+		};
+		final StringBuilder received = new StringBuilder();
+		final UMemoryChannel client = open(collect(received), server);
+		send(client, "{\"jsonrpc\":\"2.0\",\"method\":\"hang\",\"id\":1}\n");
+		loop.runPending();
+
+		final ArrayList<UChannel> channels = new ArrayList<>();
+		channels.add(client.peer());
+		final UFuture<UDrainResult> drained = UServer.drain(channels, 100, TimeUnit.MILLISECONDS);
+		loop.runPending();
+		assertTrue(client.peer().isOpen());
+
+		// new requests are rejected while the call in progress may still complete
+		send(client, "{\"jsonrpc\":\"2.0\",\"method\":\"hang\",\"id\":2}\n");
+		loop.advance(50, TimeUnit.MILLISECONDS);
+		assertTrue(received.toString(), received.toString().contains("-32000"));
+		assertTrue(received.toString().contains("\"id\":2"));
+		assertFalse(drained.isDone());
+
+		// the call never completes and the connection is killed at the deadline
+		loop.advance(49, TimeUnit.MILLISECONDS);
+		assertTrue(client.peer().isOpen());
+		loop.advance(1, TimeUnit.MILLISECONDS);
+		assertFalse(client.peer().isOpen());
+		assertTrue(drained.isDone());
+		assertEquals(0, drained.getNow().drained());
+		assertEquals(1, drained.getNow().killed());
+		assertEquals("UDrainResult[drained=0, killed=1]", drained.getNow().toString());
+	}
+
+	@Test
+	public void drainNothing() throws Exception {
+		final UFuture<UDrainResult> drained = UServer.drain(new ArrayList<UChannel>(), 1, TimeUnit.SECONDS);
+		assertTrue(drained.isDone());
+		assertEquals(0, drained.getNow().drained() + drained.getNow().killed());
+	}
+
+	@Test
+	public void groupsInDependencyOrder() throws Exception {
+		final UEventLoopGroup servers = new UEventLoopGroup("servers", 1);
+		final UEventLoopGroup clients = new UEventLoopGroup("clients", 1);
+		final AtomicBoolean called = new AtomicBoolean();
+		servers.get(0).execute(new Runnable() {
+			@Override
+			public void run() {
+				try {
+					Thread.sleep(50);
+				} catch (InterruptedException e) {
+					Thread.currentThread().interrupt();
+				}
+				// the client group is still running while the servers shut down
+				clients.get(0).execute(new Runnable() {
+					@Override
+					public void run() {
+						called.set(true);
+					}
+				});
+			}
+		});
+		assertTrue(UEventLoopGroup.shutdown(5, TimeUnit.SECONDS, servers, clients));
+		assertTrue(called.get());
+		assertTrue(servers.get(0).isTerminated());
+		assertTrue(clients.get(0).isTerminated());
+	}
+}
@@ -0,0 +1,229 @@
+import static org.junit.Assert.*;
+
+import java.net.InetSocketAddress;
+import java.nio.charset.StandardCharsets;
+import java.util.ArrayList;
+import java.util.List;
+import java.util.concurrent.CopyOnWriteArrayList;
+import java.util.concurrent.CountDownLatch;
+import java.util.concurrent.ExecutionException;
+import java.util.concurrent.TimeUnit;
+
+import org.junit.After;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.exception.UHttpException;
+import com.umpani.aio.exception.UTooLongFrameException;
+import com.umpani.aio.http.UHttpBodyHandler;
+import com.umpani.aio.http.UHttpClient;
+import com.umpani.aio.http.UHttpHandler;
+import com.umpani.aio.http.UHttpHeaders;
+import com.umpani.aio.http.UHttpRequest;
+import com.umpani.aio.http.UHttpResponse;
+import com.umpani.aio.http.UHttpRouter;
+import com.umpani.aio.http.UHttpServer;
+import com.umpani.aio.sse.USseClient;
+import com.umpani.aio.sse.USseEvent;
+import com.umpani.aio.sse.USseHandler;
+import com.umpani.aio.sse.USseListener;
+import com.umpani.aio.sse.USseParser;
+import com.umpani.aio.sse.USseResponse;
+import com.umpani.aio.sse.USseStream;
+import com.umpani.util.UMap;
+
+@SuppressWarnings("unchecked")
+public class TSse {
+	private UEventLoopGroup group;
+	private UBufferPool pool;
+	private UHttpServer server;
+	private UHttpClient client;
+	private String url;
+	private final List<String> lastEventIds = new CopyOnWriteArrayList<String>();
+
+	@Before
+	public void setUp() throws Exception {
+		group = new UEventLoopGroup("test", 2);
+		pool = new UBufferPool(false).setLeakDetection(1);
+		final UHttpRouter router = new UHttpRouter();
+		// sends three events per connection, continuing after the last event id
+		router.get("/ticks", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return UFuture.succeeded(new USseResponse(new USseHandler() {
+					@Override
+					public void open( final USseStream stream ) {
+						lastEventIds.add(String.valueOf(stream.lastEventId()));
+						final long start = stream.lastEventId()==null ? 0 : Long.parseLong(stream.lastEventId()) + 1;
+						if (start==0) stream.send(new USseEvent().setRetry(50));
+						for (long n=start; n < start + 3; n++) {
+							stream.send(new USseEvent().setId(String.valueOf(n)).setEvent("tick").setJson(UMap.of(String.class, Object.class, "n", n)));
+						}
+						stream.close();
+					}
+				}));
+			}
+		});
+		router.get("/quiet", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return UFuture.succeeded(new USseResponse(new USseHandler() {
+					@Override
+					public void open( final USseStream stream ) {
+						stream.comment("hello\nworld");
+					}
+				}).setHeartbeat(30));
+			}
+		});
+		router.get("/gone", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return UFuture.succeeded(new UHttpResponse(204));
+			}
+		});
+		server = new UHttpServer(group, router, pool);
+		final InetSocketAddress address = server.bind(new InetSocketAddress("127.0.0.1", 0));
+		url = "http://127.0.0.1:"+address.getPort();
+		client = new UHttpClient(group, pool);
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		client.close();
+		server.close().get(5, TimeUnit.SECONDS);
+		group.shutdown();
+		assertTrue(group.awaitTermination(5, TimeUnit.SECONDS));
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	@Test
+	public void eventEncoding() throws Exception {
+		assertEquals("data: a\ndata: b\ndata: \ndata: c\n\n", new USseEvent("a\nb\r\n\rc").encode());
+		assertEquals("id: 7\nevent: tick\nretry: 100\ndata: {\"n\":1}\n\n",
+				USseEvent.json(UMap.of(String.class, Object.class, "n", 1L)).setId("7").setEvent("tick").setRetry(100).encode());
+		assertEquals("retry: 5\n\n", new USseEvent().setRetry(5).encode());
+		assertEquals(1L, ((UMap<String,Object>)new USseEvent("{\"n\":1}").json()).getLong("n"));
+		try {
+			new USseEvent().setId("a\nb");
+			fail("Expected an IllegalArgumentException");
+		} catch (IllegalArgumentException e) {
+			// expected
+		}
+	}
+
+	@Test
+	public void parser() throws Exception {
+		final List<USseEvent> events = new ArrayList<USseEvent>();
+		final USseParser parser = new USseParser(new USseListener() {
+			@Override
+			public void onEvent( final USseEvent event ) {
+				events.add(event);
+			}
+		}, 64);
+		final byte[] stream = ("\ufeff: comment\r\ndata: first\r\ndata:second\r\n\r\n"
+				+"id: 1\nevent: tick\ndata: ä😀\nunknown: x\n\n"
+				+"data\ndata\n\n"
+				+"id\nretry: 250\nretry: 1x\n\n"
+				+"data: no id\r\rid: 2\0\ndata: incomplete").getBytes(StandardCharsets.UTF_8);
+		// feed byte by byte, so that line terminators and characters are split
+		for (final byte b : stream) parser.feed(new byte[] { b });
+		assertEquals(4, events.size());
+		assertEquals("first\nsecond", events.get(0).data());
+		assertNull(events.get(0).id());
+		assertNull(events.get(0).event());
+		assertEquals("1", events.get(1).id());
+		assertEquals("tick", events.get(1).event());
+		assertEquals("ä😀", events.get(1).data());
+		assertEquals("\n", events.get(2).data());
+		assertEquals("1", events.get(2).id());
+		assertEquals("no id", events.get(3).data());
+		assertNull(events.get(3).id());
+		assertNull(parser.lastEventId());
+		assertEquals(250L, parser.retry());
+		// the incomplete event is discarded
+		parser.reset();
+		parser.feed("\n\n".getBytes(StandardCharsets.UTF_8));
+		assertEquals(4, events.size());
+
+		final StringBuilder sb = new StringBuilder("data: ");
+		for (int i=0; i < 64; i++) sb.append('x');
+		try {
+			parser.feed(sb.toString().getBytes(StandardCharsets.UTF_8));
+			fail("Expected an UTooLongFrameException");
+		} catch (UTooLongFrameException e) {
+			// expected
+		}
+	}
+
+	@Test
+	public void reconnectWithLastEventId() throws Exception {
+		final List<USseEvent> events = new CopyOnWriteArrayList<USseEvent>();
+		final CountDownLatch latch = new CountDownLatch(6);
+		final USseClient sse = new USseClient(client, url+"/ticks", new USseListener() {
+			@Override
+			public void onEvent( final USseEvent event ) {
+				events.add(event);
+				latch.countDown();
+			}
+		}).setRetry(60000L).start();
+		// the retry hint of the server makes the client reconnect quickly
+		assertTrue(latch.await(5, TimeUnit.SECONDS));
+		sse.close();
+		assertTrue(sse.closeFuture().isSuccess());
+		assertEquals(50L, sse.retry());
+		assertTrue(sse.connects() >= 2);
+		assertEquals("null", lastEventIds.get(0));
+		assertEquals("2", lastEventIds.get(1));
+		for (int i=0; i < 6; i++) {
+			final USseEvent event = events.get(i);
+			assertEquals(String.valueOf(i), event.id());
+			assertEquals("tick", event.event());
+			assertEquals(i, ((UMap<String,Object>)event.json()).getLong("n"));
+		}
+	}
+
+	@Test
+	public void heartbeats() throws Exception {
+		final StringBuffer received = new StringBuffer();
+		final CountDownLatch latch = new CountDownLatch(1);
+		final UFuture<UHttpResponse> future = client.send(new UHttpRequest("GET", url+"/quiet"), new UHttpBodyHandler() {
+			@Override
+			public void headers( final UHttpResponse response ) {
+				assertTrue(response.headers().get(UHttpHeaders.CONTENT_TYPE).startsWith(USseResponse.TEXT_EVENT_STREAM));
+				assertEquals("no-cache", response.headers().get(UHttpHeaders.CACHE_CONTROL));
+			}
+
+			@Override
+			public void data( final byte[] data ) {
+				received.append(new String(data, StandardCharsets.UTF_8));
+				if (received.indexOf(":\n\n:\n\n") >= 0) latch.countDown();
+			}
+		});
+		assertTrue(latch.await(5, TimeUnit.SECONDS));
+		assertTrue(received.toString().startsWith(": hello\n: world\n\n:\n\n"));
+		future.cancel(false);
+	}
+
+	@Test
+	public void stopsOnNoContentAndRejection() throws Exception {
+		final USseListener ignore = new USseListener() {
+			@Override
+			public void onEvent( final USseEvent event ) {}
+		};
+		final USseClient gone = new USseClient(client, url+"/gone", ignore).setRetry(10).start();
+		gone.closeFuture().get(5, TimeUnit.SECONDS);
+		assertEquals(1, gone.connects());
+
+		final USseClient missing = new USseClient(client, url+"/missing", ignore).setRetry(10).start();
+		try {
+			missing.closeFuture().get(5, TimeUnit.SECONDS);
+			fail("Expected a failure");
+		} catch (ExecutionException e) {
+			assertEquals(404, ((UHttpException)e.getCause()).getStatus());
+		}
+		assertEquals(1, missing.connects());
+	}
+}
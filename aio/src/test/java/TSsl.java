@@ -0,0 +1,297 @@
+import static org.junit.Assert.*;
+
+import java.io.ByteArrayOutputStream;
+import java.io.File;
+import java.io.InputStream;
+import java.net.InetSocketAddress;
+import java.net.Socket;
+import java.security.KeyStore;
+import java.util.Random;
+import java.util.concurrent.CountDownLatch;
+import java.util.concurrent.ExecutionException;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicReference;
+
+import javax.net.ssl.SSLException;
+
+import org.junit.After;
+import org.junit.Assume;
+import org.junit.Before;
+import org.junit.BeforeClass;
+import org.junit.Test;
+
+import com.umpani.aio.UBuffer;
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelHandlerAdapter;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UClient;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UHandlerContext;
+import com.umpani.aio.UServer;
+import com.umpani.aio.USocketChannel;
+import com.umpani.aio.http.UHttpClient;
+import com.umpani.aio.http.UHttpHandler;
+import com.umpani.aio.http.UHttpRequest;
+import com.umpani.aio.http.UHttpRouter;
+import com.umpani.aio.http.UHttpServer;
+import com.umpani.aio.ssl.USslContext;
+import com.umpani.aio.ssl.USslHandler;
+import com.umpani.aio.ssl.USslHandshakeEvent;
+import com.umpani.util.UMap;
+
+@SuppressWarnings("unchecked")
+public class TSsl {
+	private static final char[] PASSWORD = "changeit".toCharArray();
+	private static KeyStore serverKeys;
+	private static KeyStore clientKeys;
+	private UEventLoopGroup group;
+	private UBufferPool pool;
+
+	/**
+	 * Generates a self-signed key pair with the keytool of the running JVM.
+	 */
+	static KeyStore generate( final String name, final String dname ) throws Exception {
+		final File file = File.createTempFile("tssl-"+name, ".jks");
+		file.delete();
+		file.deleteOnExit();
+		final String keytool = new File(new File(System.getProperty("java.home"), "bin"), "keytool").getPath();
+		final Process process = new ProcessBuilder(keytool, "-genkeypair", "-alias", name, "-keyalg", "RSA", "-keysize", "2048",
+				"-validity", "2", "-dname", dname, "-ext", "SAN=dns:localhost,ip:127.0.0.1", "-storetype", "JKS",
+				"-keystore", file.getPath(), "-storepass", "changeit", "-keypass", "changeit").redirectErrorStream(true).start();
+		final ByteArrayOutputStream output = new ByteArrayOutputStream();
+		try (InputStream in = process.getInputStream()) {
+			final byte[] buffer = new byte[1024];
+			int n;
+			while ((n = in.read(buffer)) > 0) output.write(buffer, 0, n);
+		}
+		assertEquals(output.toString(), 0, process.waitFor());
+		return USslContext.loadKeyStore(file, PASSWORD);
+	}
+
+	@BeforeClass
+	public static void generateKeyStores() throws Exception {
+		serverKeys = generate("server", "CN=localhost");
+		clientKeys = generate("client", "CN=client");
+	}
+
+	@Before
+	public void setUp() throws Exception {
+		group = new UEventLoopGroup("test", 2);
+		pool = new UBufferPool(false).setLeakDetection(1);
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		group.shutdown();
+		assertTrue(group.awaitTermination(5, TimeUnit.SECONDS));
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	/**
+	 * Starts a TLS server that echoes all bytes.
+	 */
+	private UServer startEchoServer( final USslContext ssl ) throws Exception {
+		final UServer server = new UServer(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(ssl.newHandler(), new UChannelHandlerAdapter() {
+					@Override
+					public void channelRead( final UHandlerContext ctx, final Object msg ) {
+						ctx.write(msg);
+					}
+
+					@Override
+					public void channelReadComplete( final UHandlerContext ctx ) {
+						ctx.flush();
+					}
+
+					@Override
+					public void exceptionCaught( final UHandlerContext ctx, final Throwable cause ) {
+						// the handshake failures of the tests
+					}
+				});
+			}
+		}, pool);
+		server.bind(new InetSocketAddress("127.0.0.1", 0));
+		return server;
+	}
+
+	/**
+	 * Collects the received bytes of a client connection.
+	 */
+	private static final class Collector extends UChannelHandlerAdapter {
+		final ByteArrayOutputStream received = new ByteArrayOutputStream();
+		final AtomicReference<Object> event = new AtomicReference<Object>();
+		final CountDownLatch closed = new CountDownLatch(1);
+		volatile CountDownLatch latch;
+		volatile int expected;
+
+		@Override
+		public void channelRead( final UHandlerContext ctx, final Object msg ) {
+			final UBuffer buffer = (UBuffer)msg;
+			final byte[] bytes = new byte[buffer.remaining()];
+			buffer.nio().get(bytes);
+			buffer.release();
+			synchronized (received) {
+				received.write(bytes, 0, bytes.length);
+				if (received.size() >= expected && latch!=null) latch.countDown();
+			}
+		}
+
+		@Override
+		public void userEvent( final UHandlerContext ctx, final Object event ) {
+			this.event.set(event);
+		}
+
+		@Override
+		public void exceptionCaught( final UHandlerContext ctx, final Throwable cause ) {
+			// the handshake future reports the failure
+		}
+
+		@Override
+		public void channelInactive( final UHandlerContext ctx ) {
+			closed.countDown();
+		}
+	}
+
+	/**
+	 * Connects a TLS client to the given server.
+	 */
+	private USocketChannel connect( final UServer server, final USslContext ssl, final Collector collector ) throws Exception {
+		final UClient client = new UClient(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(ssl.newHandler("127.0.0.1", server.localAddress().getPort()), collector);
+			}
+		}, pool);
+		return client.connect(server.localAddress()).get(5, TimeUnit.SECONDS);
+	}
+
+	@Test
+	public void echo() throws Exception {
+		final UServer server = startEchoServer(USslContext.forServer(serverKeys, PASSWORD));
+		final Collector collector = new Collector();
+		final USocketChannel channel = connect(server, USslContext.forClient(serverKeys), collector);
+		// written before the handshake completed, so the write is held back
+		final byte[] data = new byte[200000];
+		new Random(7).nextBytes(data);
+		collector.expected = data.length;
+		collector.latch = new CountDownLatch(1);
+		final UFuture<Void> written = channel.writeAndFlush(data);
+		final USslHandler ssl = channel.pipeline().get(USslHandler.class);
+		assertSame(ssl, ssl.handshakeFuture().get(5, TimeUnit.SECONDS));
+		assertTrue(collector.latch.await(5, TimeUnit.SECONDS));
+		written.get(5, TimeUnit.SECONDS);
+		synchronized (collector.received) {
+			assertArrayEquals(data, collector.received.toByteArray());
+		}
+		assertSame(USslHandshakeEvent.SUCCESS, collector.event.get());
+		assertTrue(ssl.engine().getSession().getProtocol().startsWith("TLS"));
+		assertNull(ssl.applicationProtocol());
+
+		// close sends close_notify before the connection is closed
+		channel.close().get(5, TimeUnit.SECONDS);
+		assertTrue(collector.closed.await(5, TimeUnit.SECONDS));
+		server.close().get(5, TimeUnit.SECONDS);
+	}
+
+	@Test
+	public void alpn() throws Exception {
+		Assume.assumeTrue(USslContext.isAlpnSupported());
+		final UServer server = startEchoServer(USslContext.forServer(serverKeys, PASSWORD).setApplicationProtocols("h2", "http/1.1"));
+		final Collector collector = new Collector();
+		final USocketChannel channel = connect(server, USslContext.forClient(serverKeys).setApplicationProtocols("spdy/3", "http/1.1"), collector);
+		final USslHandler ssl = channel.pipeline().get(USslHandler.class);
+		ssl.handshakeFuture().get(5, TimeUnit.SECONDS);
+		assertEquals("http/1.1", ssl.applicationProtocol());
+		channel.close().get(5, TimeUnit.SECONDS);
+		server.close().get(5, TimeUnit.SECONDS);
+	}
+
+	@Test
+	public void clientCertificates() throws Exception {
+		final UServer server = startEchoServer(USslContext.forServer(serverKeys, PASSWORD, clientKeys).setClientAuth(USslContext.ClientAuth.REQUIRE));
+		final Collector collector = new Collector();
+		USocketChannel channel = connect(server, USslContext.forClient(serverKeys, clientKeys, PASSWORD), collector);
+		final USslHandler ssl = channel.pipeline().get(USslHandler.class);
+		ssl.handshakeFuture().get(5, TimeUnit.SECONDS);
+		// the server verified the certificate, so the connection works
+		collector.expected = 5;
+		collector.latch = new CountDownLatch(1);
+		channel.writeAndFlush("hello".getBytes("UTF-8"));
+		assertTrue(collector.latch.await(5, TimeUnit.SECONDS));
+		channel.close().get(5, TimeUnit.SECONDS);
+
+		// without a certificate the server rejects the client
+		final Collector rejected = new Collector();
+		channel = connect(server, USslContext.forClient(serverKeys), rejected);
+		assertTrue(rejected.closed.await(5, TimeUnit.SECONDS));
+		final UFuture<USslHandler> handshake = channel.pipeline().get(USslHandler.class).handshakeFuture();
+		// with TLS 1.3 the client completes its handshake before the server verified the certificate
+		if (!handshake.isSuccess()) {
+			assertTrue(handshake.cause() instanceof SSLException);
+			assertFalse(((USslHandshakeEvent)rejected.event.get()).isSuccess());
+		}
+		server.close().get(5, TimeUnit.SECONDS);
+	}
+
+	@Test
+	public void untrustedServer() throws Exception {
+		final UServer server = startEchoServer(USslContext.forServer(serverKeys, PASSWORD));
+		// the client trusts only the client certificate
+		final Collector collector = new Collector();
+		final USocketChannel channel = connect(server, USslContext.forClient(clientKeys), collector);
+		try {
+			channel.pipeline().get(USslHandler.class).handshakeFuture().get(5, TimeUnit.SECONDS);
+			fail("Expected a failure");
+		} catch (ExecutionException e) {
+			assertTrue(e.getCause() instanceof SSLException);
+		}
+		assertTrue(collector.closed.await(5, TimeUnit.SECONDS));
+		server.close().get(5, TimeUnit.SECONDS);
+	}
+
+	@Test
+	public void handshakeTimeout() throws Exception {
+		final UServer server = startEchoServer(USslContext.forServer(serverKeys, PASSWORD).setHandshakeTimeout(100));
+		try (Socket socket = new Socket("127.0.0.1", server.localAddress().getPort())) {
+			socket.setSoTimeout(5000);
+			// the client never sends a hello, so the server closes the connection, maybe after an alert
+			final InputStream in = socket.getInputStream();
+			while (in.read() >= 0);
+		}
+		server.close().get(5, TimeUnit.SECONDS);
+	}
+
+	@Test
+	public void https() throws Exception {
+		final UHttpRouter router = new UHttpRouter();
+		router.get("/hello", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return UFuture.succeeded(UMap.of(String.class, Object.class, "hello", "tls"));
+			}
+		});
+		final UHttpServer server = new UHttpServer(group, router, pool).setSslContext(USslContext.forServer(serverKeys, PASSWORD));
+		final int port = server.bind(new InetSocketAddress("127.0.0.1", 0)).getPort();
+		final UHttpClient client = new UHttpClient(group, pool).setSslContext(USslContext.forClient(serverKeys));
+		for (int i=0; i < 2; i++) {
+			final UMap<String,Object> reply = (UMap<String,Object>)client.getJson("https://127.0.0.1:"+port+"/hello").get(5, TimeUnit.SECONDS);
+			assertEquals("tls", reply.getString("hello"));
+		}
+		assertEquals(1, client.connections());
+		// a plain request to the TLS port fails
+		final UHttpClient plain = new UHttpClient(group, pool).setReadTimeout(1000);
+		try {
+			plain.get("http://127.0.0.1:"+port+"/hello").get(5, TimeUnit.SECONDS);
+			fail("Expected a failure");
+		} catch (ExecutionException e) {
+			// expected
+		}
+		plain.close();
+		client.close();
+		server.close().get(5, TimeUnit.SECONDS);
+	}
+}
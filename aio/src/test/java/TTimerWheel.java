@@ -0,0 +1,154 @@
+import static org.junit.Assert.*;
+
+import java.util.ArrayList;
+import java.util.List;
+import java.util.Random;
+import java.util.concurrent.TimeUnit;
+
+import org.junit.Test;
+
+import com.umpani.aio.UManualClock;
+import com.umpani.aio.UTimeout;
+import com.umpani.aio.UTimerWheel;
+
+public class TTimerWheel {
+	/**
+	 * A task that records the time of the clock when it is executed.
+	 */
+	static class Recorder implements Runnable {
+		Recorder( final UManualClock clock ) {
+			this.clock = clock;
+		}
+
+		final UManualClock clock;
+		long expiredAt = -1L;
+
+		@Override
+		public void run() {
+			assertEquals(-1L, expiredAt);
+			expiredAt = clock.nanoTime();
+		}
+	}
+
+	/**
+	 * Advances the clock tick by tick and expires the wheel.
+	 */
+	private static void run( final UManualClock clock, final UTimerWheel wheel, final int ticks ) {
+		for (int i=0; i < ticks; i++) {
+			clock.advance(1, TimeUnit.MILLISECONDS);
+			wheel.expire();
+		}
+	}
+
+	@Test
+	public void expireNotBeforeDeadline() {
+		final UManualClock clock = new UManualClock();
+		final UTimerWheel wheel = new UTimerWheel(clock, 1, TimeUnit.MILLISECONDS);
+		final Recorder recorder = new Recorder(clock);
+		final UTimeout timeout = wheel.schedule(recorder, 1500, TimeUnit.MICROSECONDS);
+		assertEquals(1, wheel.size());
+		assertEquals(TimeUnit.MILLISECONDS.toNanos(2), wheel.nextDelayNanos());
+		run(clock, wheel, 1);
+		assertTrue(timeout.isPending());
+		run(clock, wheel, 1);
+		assertTrue(timeout.isExpired());
+		assertEquals(TimeUnit.MILLISECONDS.toNanos(2), recorder.expiredAt);
+		assertTrue(wheel.isEmpty());
+		assertEquals(-1L, wheel.nextDelayNanos());
+	}
+
+	@Test
+	public void cancel() {
+		final UManualClock clock = new UManualClock();
+		final UTimerWheel wheel = new UTimerWheel(clock, 1, TimeUnit.MILLISECONDS);
+		final Recorder recorder = new Recorder(clock);
+		final UTimeout timeout = wheel.schedule(recorder, 10, TimeUnit.MILLISECONDS);
+		assertTrue(timeout.cancel());
+		assertFalse(timeout.cancel());
+		assertTrue(timeout.isCancelled());
+		assertEquals(0, wheel.size());
+		run(clock, wheel, 20);
+		assertEquals(-1L, recorder.expiredAt);
+	}
+
+	@Test
+	public void cascadeAndParkBeyondRange() {
+		final UManualClock clock = new UManualClock();
+		// four slots and two levels cover 16 ticks
+		final UTimerWheel wheel = new UTimerWheel(clock, 1, TimeUnit.MILLISECONDS, 4, 2);
+		final long[] delays = { 0, 1, 3, 4, 5, 15, 16, 17, 40, 1000 };
+		final List<Recorder> recorders = new ArrayList<Recorder>();
+		for (final long delay : delays) {
+			final Recorder recorder = new Recorder(clock);
+			wheel.schedule(recorder, delay, TimeUnit.MILLISECONDS);
+			recorders.add(recorder);
+		}
+		wheel.expire();
+		run(clock, wheel, 1000);
+		for (int i=0; i < delays.length; i++) {
+			assertEquals("delay "+delays[i], TimeUnit.MILLISECONDS.toNanos(delays[i]), recorders.get(i).expiredAt);
+		}
+		assertTrue(wheel.isEmpty());
+	}
+
+	@Test
+	public void manyTimersMostlyCancelled() {
+		final UManualClock clock = new UManualClock();
+		final UTimerWheel wheel = new UTimerWheel(clock, 1, TimeUnit.MILLISECONDS, 16, 3);
+		final Random random = new Random(42);
+		final List<Recorder> recorders = new ArrayList<Recorder>();
+		final List<Long> deadlines = new ArrayList<Long>();
+		for (int i=0; i < 10000; i++) {
+			final Recorder recorder = new Recorder(clock);
+			final long delay = 1 + random.nextInt(9999);
+			final UTimeout timeout = wheel.schedule(recorder, delay, TimeUnit.MILLISECONDS);
+			if (i % 10==0) {
+				recorders.add(recorder);
+				deadlines.add(TimeUnit.MILLISECONDS.toNanos(delay));
+			} else {
+				timeout.cancel();
+			}
+		}
+		assertEquals(1000, wheel.size());
+		run(clock, wheel, 10000);
+		for (int i=0; i < recorders.size(); i++) {
+			assertEquals(deadlines.get(i).longValue(), recorders.get(i).expiredAt);
+		}
+		assertEquals(0, wheel.size());
+	}
+
+	@Test
+	public void catchUpAfterIdle() {
+		final UManualClock clock = new UManualClock();
+		final UTimerWheel wheel = new UTimerWheel(clock, 1, TimeUnit.MILLISECONDS, 4, 2);
+		final Recorder early = new Recorder(clock);
+		final Recorder late = new Recorder(clock);
+		wheel.schedule(early, 7, TimeUnit.MILLISECONDS);
+		wheel.schedule(late, 100, TimeUnit.MILLISECONDS);
+		clock.advance(50, TimeUnit.MILLISECONDS);
+		assertEquals(1, wheel.expire());
+		assertEquals(TimeUnit.MILLISECONDS.toNanos(50), early.expiredAt);
+		assertEquals(-1L, late.expiredAt);
+		assertTrue(wheel.nextDelayNanos() > 0);
+		run(clock, wheel, 50);
+		assertEquals(TimeUnit.MILLISECONDS.toNanos(100), late.expiredAt);
+	}
+
+	@Test
+	public void scheduleFromTask() {
+		final UManualClock clock = new UManualClock();
+		final UTimerWheel wheel = new UTimerWheel(clock, 1, TimeUnit.MILLISECONDS);
+		final Recorder second = new Recorder(clock);
+		wheel.schedule(new Runnable() {
+			@Override
+			public void run() {
+				wheel.schedule(second, 0, TimeUnit.MILLISECONDS);
+			}
+		}, 1, TimeUnit.MILLISECONDS);
+		run(clock, wheel, 1);
+		// a task scheduled without delay runs at the next tick, not within the current one
+		assertEquals(-1L, second.expiredAt);
+		run(clock, wheel, 1);
+		assertEquals(TimeUnit.MILLISECONDS.toNanos(2), second.expiredAt);
+	}
+}
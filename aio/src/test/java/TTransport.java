@@ -0,0 +1,160 @@
+import static org.junit.Assert.*;
+
+import java.net.InetSocketAddress;
+import java.net.SocketAddress;
+import java.nio.file.Files;
+import java.nio.file.Path;
+import java.nio.file.attribute.PosixFilePermission;
+import java.nio.file.attribute.PosixFilePermissions;
+import java.util.List;
+import java.util.Set;
+import java.util.concurrent.TimeUnit;
+
+import org.junit.After;
+import org.junit.Assume;
+import org.junit.Before;
+import org.junit.Rule;
+import org.junit.Test;
+import org.junit.rules.TemporaryFolder;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UChannel;
+import com.umpani.aio.UChannelInitializer;
+import com.umpani.aio.UClient;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.UFuture;
+import com.umpani.aio.UServer;
+import com.umpani.aio.USocketChannel;
+import com.umpani.aio.UTransport;
+import com.umpani.aio.codec.UNdjsonDecoder;
+import com.umpani.aio.codec.UNdjsonEncoder;
+import com.umpani.aio.http.UHttpClient;
+import com.umpani.aio.http.UHttpHandler;
+import com.umpani.aio.http.UHttpHeaders;
+import com.umpani.aio.http.UHttpRequest;
+import com.umpani.aio.http.UHttpResponse;
+import com.umpani.aio.http.UHttpRouter;
+import com.umpani.aio.http.UHttpServer;
+import com.umpani.aio.rpc.URpcClient;
+import com.umpani.aio.rpc.URpcClientHandler;
+import com.umpani.aio.rpc.URpcMethod;
+import com.umpani.aio.rpc.URpcServer;
+import com.umpani.aio.rpc.URpcServerHandler;
+import com.umpani.util.UList;
+
+public class TTransport {
+	@Rule
+	public final TemporaryFolder folder = new TemporaryFolder();
+
+	private UEventLoopGroup group;
+	private UBufferPool pool;
+
+	@Before
+	public void setUp() throws Exception {
+		group = new UEventLoopGroup("test", 2);
+		pool = new UBufferPool(false).setLeakDetection(1);
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		group.shutdown();
+		assertTrue(group.awaitTermination(5, TimeUnit.SECONDS));
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	@Test
+	public void tcpByDefault() throws Exception {
+		assertTrue(UTransport.TCP.isAvailable());
+		assertEquals(UTransport.TCP, new UServer(group, null).getTransport());
+		assertEquals(UTransport.TCP, new UClient(group, null).getTransport());
+		final InetSocketAddress address = new InetSocketAddress("127.0.0.1", 80);
+		assertEquals(UTransport.TCP, UTransport.of(address));
+		assertNull(UTransport.unixPath(address));
+	}
+
+	@Test
+	public void unixNotAvailable() throws Exception {
+		Assume.assumeFalse(UTransport.UNIX.isAvailable());
+		try {
+			new UServer(group, null).setTransport(UTransport.UNIX);
+			fail("Expected an UnsupportedOperationException");
+		} catch (UnsupportedOperationException e) {
+			// expected
+		}
+		try {
+			UTransport.unixAddress(folder.getRoot().toPath().resolve("test.sock"));
+			fail("Expected an UnsupportedOperationException");
+		} catch (UnsupportedOperationException e) {
+			// expected
+		}
+	}
+
+	@Test
+	public void rpcOverUnixSocket() throws Exception {
+		Assume.assumeTrue(UTransport.UNIX.isAvailable());
+		final Path socketFile = folder.getRoot().toPath().resolve("rpc.sock");
+		final SocketAddress address = UTransport.unixAddress(socketFile);
+		assertEquals(UTransport.UNIX, UTransport.of(address));
+		assertEquals(socketFile, UTransport.unixPath(address));
+
+		final URpcServer rpc = new URpcServer().register("add", new URpcMethod() {
+			@Override
+			public UFuture<?> invoke( final Object params ) {
+				final List<?> list = (List<?>)params;
+				return UFuture.succeeded(((Number)list.get(0)).longValue() + ((Number)list.get(1)).longValue());
+			}
+		});
+		final Set<PosixFilePermission> permissions = PosixFilePermissions.fromString("rw-------");
+		final UServer server = new UServer(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new UNdjsonDecoder(), new UNdjsonEncoder(), new URpcServerHandler(rpc));
+			}
+		}, pool).setTransport(UTransport.UNIX).setSocketFilePermissions(permissions);
+		assertNull(server.bind(address));
+		assertEquals(address, server.localSocketAddress());
+		assertTrue(Files.exists(socketFile));
+		assertEquals(permissions, Files.getPosixFilePermissions(socketFile));
+
+		final USocketChannel channel = new UClient(group, new UChannelInitializer() {
+			@Override
+			public void initChannel( final UChannel channel ) {
+				channel.pipeline().addLast(new UNdjsonDecoder(), new UNdjsonEncoder(), new URpcClientHandler());
+			}
+		}, pool).setTransport(UTransport.UNIX).connect(address).get(5, TimeUnit.SECONDS);
+		final URpcClient client = channel.pipeline().get(URpcClientHandler.class).client();
+		assertEquals(42L, client.call("add", UList.of(Object.class, 40, 2)).get(5, TimeUnit.SECONDS));
+		channel.close().get(5, TimeUnit.SECONDS);
+
+		// the socket file is removed on shutdown, so that the server can be bound again
+		server.close().get(5, TimeUnit.SECONDS);
+		assertFalse(Files.exists(socketFile));
+	}
+
+	@Test
+	public void httpOverUnixSocket() throws Exception {
+		Assume.assumeTrue(UTransport.UNIX.isAvailable());
+		final Path socketFile = folder.getRoot().toPath().resolve("http.sock");
+		final UHttpRouter router = new UHttpRouter();
+		router.get("/hello", new UHttpHandler() {
+			@Override
+			public UFuture<?> handle( final UHttpRequest request ) {
+				return UFuture.succeeded("hello "+request.headers().get(UHttpHeaders.HOST));
+			}
+		});
+		final UHttpServer server = new UHttpServer(group, router, pool).setTransport(UTransport.UNIX);
+		server.bind(UTransport.unixAddress(socketFile));
+		assertNull(server.localAddress());
+
+		final UHttpClient client = new UHttpClient(group, pool).setUnixSocket(socketFile);
+		for (int i=0; i < 3; i++) {
+			final UHttpResponse response = client.get("http://sidecar/hello").get(5, TimeUnit.SECONDS);
+			assertEquals(200, response.status());
+			assertEquals("hello sidecar", response.bodyAsString());
+		}
+		assertEquals(1, client.connections());
+		client.close();
+		server.close().get(5, TimeUnit.SECONDS);
+		assertFalse(Files.exists(socketFile));
+	}
+}
@@ -0,0 +1,471 @@
+import static org.junit.Assert.*;
+
+import java.io.BufferedInputStream;
+import java.io.ByteArrayOutputStream;
+import java.io.DataInputStream;
+import java.io.IOException;
+import java.io.InputStream;
+import java.io.OutputStream;
+import java.net.InetSocketAddress;
+import java.net.Socket;
+import java.net.SocketException;
+import java.nio.charset.StandardCharsets;
+import java.util.Arrays;
+import java.util.concurrent.BlockingQueue;
+import java.util.concurrent.CountDownLatch;
+import java.util.concurrent.ExecutionException;
+import java.util.concurrent.LinkedBlockingQueue;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicReference;
+
+import org.junit.After;
+import org.junit.Before;
+import org.junit.Test;
+
+import com.umpani.aio.UBufferPool;
+import com.umpani.aio.UEventLoopGroup;
+import com.umpani.aio.exception.UHttpException;
+import com.umpani.aio.http.UHttpRouter;
+import com.umpani.aio.http.UHttpServer;
+import com.umpani.aio.websocket.UWebSocket;
+import com.umpani.aio.websocket.UWebSocketClient;
+import com.umpani.aio.websocket.UWebSocketFrame;
+import com.umpani.aio.websocket.UWebSocketHandshake;
+import com.umpani.aio.websocket.UWebSocketListenerAdapter;
+import com.umpani.aio.websocket.UWebSocketServerHandler;
+import com.umpani.util.UMap;
+
+@SuppressWarnings("unchecked")
+public class TWebSocket {
+	private UEventLoopGroup group;
+	private UBufferPool pool;
+	private UHttpServer server;
+	private InetSocketAddress address;
+	private final AtomicReference<UWebSocket> serverSide = new AtomicReference<>();
+	private final BlockingQueue<Integer> serverClosed = new LinkedBlockingQueue<>();
+
+	/**
+	 * Echoes every message, a JSON message wrapped into {"echo":message}.
+	 */
+	private final UWebSocketListenerAdapter echo = new UWebSocketListenerAdapter() {
+		@Override
+		public void onOpen( final UWebSocket webSocket ) {
+			serverSide.set(webSocket);
+		}
+
+		@Override
+		public void onMessage( final UWebSocket webSocket, final Object message ) {
+			if (message instanceof byte[]) {
+				webSocket.sendBinary((byte[])message);
+			} else
+			if (message instanceof String) {
+				webSocket.sendText((String)message);
+			} else
+			if ("bye".equals(((UMap<String,Object>)message).get("text"))) {
+				webSocket.close(4000, "done");
+			} else {
+				webSocket.send(UMap.of(String.class, Object.class, "echo", message));
+			}
+		}
+
+		@Override
+		public void onClose( final UWebSocket webSocket, final int code, final String reason ) {
+			serverClosed.add(code);
+		}
+	};
+
+	@Before
+	public void setUp() throws Exception {
+		group = new UEventLoopGroup("test", 2);
+		pool = new UBufferPool(false).setLeakDetection(1);
+		final UHttpRouter router = new UHttpRouter();
+		router.get("/echo", new UWebSocketServerHandler(echo).setJson(false).setMaxMessageSize(1 << 17));
+		router.get("/json", new UWebSocketServerHandler(echo));
+		server = new UHttpServer(group, router, pool);
+		address = server.bind(new InetSocketAddress("127.0.0.1", 0));
+	}
+
+	@After
+	public void tearDown() throws Exception {
+		server.close().get(5, TimeUnit.SECONDS);
+		group.shutdown();
+		assertTrue(group.awaitTermination(5, TimeUnit.SECONDS));
+		assertTrue(pool.getUnreleased().isEmpty());
+	}
+
+	/**
+	 * A client that writes frames byte by byte, to reproduce the protocol cases of the Autobahn test suite.
+	 */
+	private class RawClient implements AutoCloseable {
+		RawClient( final String path ) throws IOException {
+			socket = new Socket(address.getAddress(), address.getPort());
+			socket.setSoTimeout(5000);
+			in = new DataInputStream(new BufferedInputStream(socket.getInputStream()));
+			out = socket.getOutputStream();
+			final String key = UWebSocketHandshake.newKey();
+			write(("GET "+path+" HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"
+				+"Sec-WebSocket-Key: "+key+"\r\nSec-WebSocket-Version: 13\r\n\r\n").getBytes(StandardCharsets.ISO_8859_1));
+			assertEquals("HTTP/1.1 101 Switching Protocols", readLine());
+			String line;
+			String accept = null;
+			while (!(line = readLine()).isEmpty()) {
+				if (line.startsWith(UWebSocketHandshake.SEC_WEBSOCKET_ACCEPT+":")) accept = line.substring(line.indexOf(':') + 1).trim();
+			}
+			assertEquals(UWebSocketHandshake.acceptKey(key), accept);
+		}
+
+		final Socket socket;
+		final DataInputStream in;
+		final OutputStream out;
+
+		String readLine() throws IOException {
+			final StringBuilder sb = new StringBuilder();
+			int c;
+			while ((c = in.read())!='\n') {
+				if (c < 0) throw new IOException("EOF");
+				if (c!='\r') sb.append((char)c);
+			}
+			return sb.toString();
+		}
+
+		void write( final byte[] bytes ) throws IOException {
+			out.write(bytes);
+			out.flush();
+		}
+
+		/**
+		 * Sends a masked frame.
+		 */
+		void send( final boolean fin, final int rsv, final int opcode, final byte[] payload ) throws IOException {
+			write(frame(fin, rsv, opcode, payload, true));
+		}
+
+		void send( final int opcode, final byte[] payload ) throws IOException {
+			send(true, 0, opcode, payload);
+		}
+
+		void sendText( final boolean fin, final int opcode, final String text ) throws IOException {
+			send(fin, 0, opcode, text.getBytes(StandardCharsets.UTF_8));
+		}
+
+		UWebSocketFrame read() throws IOException {
+			final int b0 = in.readUnsignedByte();
+			final int b1 = in.readUnsignedByte();
+			assertEquals("server frames are not masked", 0, b1 & 0x80);
+			long length = b1 & 0x7F;
+			if (length==126) {
+				length = in.readUnsignedShort();
+			} else
+			if (length==127) {
+				length = in.readLong();
+			}
+			final byte[] payload = new byte[(int)length];
+			in.readFully(payload);
+			return new UWebSocketFrame((b0 & 0x80)!=0, (b0 >>> 4) & 7, b0 & 0xF, payload);
+		}
+
+		/**
+		 * Expects a close frame with the given code, followed by the end of the connection.
+		 */
+		void expectClose( final int code ) throws IOException {
+			final UWebSocketFrame frame = read();
+			assertEquals(UWebSocketFrame.CLOSE, frame.opcode());
+			assertEquals(code, frame.closeCode());
+			assertClosed(in);
+		}
+
+		@Override
+		public void close() throws IOException {
+			socket.close();
+		}
+	}
+
+	/**
+	 * Expects the end of the connection, which is reset if the server closed it with unread bytes.
+	 */
+	static void assertClosed( final InputStream in ) throws IOException {
+		try {
+			assertEquals(-1, in.read());
+		} catch (SocketException e) {
+			// reset
+		}
+	}
+
+	static byte[] frame( final boolean fin, final int rsv, final int opcode, final byte[] payload, final boolean masked ) {
+		final ByteArrayOutputStream out = new ByteArrayOutputStream();
+		out.write((fin ? 0x80 : 0) | (rsv << 4) | opcode);
+		final int mask = masked ? 0x80 : 0;
+		if (payload.length < 126) {
+			out.write(mask | payload.length);
+		} else
+		if (payload.length <= 0xFFFF) {
+			out.write(mask | 126);
+			out.write(payload.length >>> 8);
+			out.write(payload.length);
+		} else {
+			out.write(mask | 127);
+			for (int shift=56; shift >= 0; shift -= 8) out.write((int)((long)payload.length >>> shift));
+		}
+		final byte[] key = { 0x12, 0x34, 0x56, 0x78 };
+		if (masked) out.write(key, 0, 4);
+		for (int i=0; i < payload.length; i++) out.write(masked ? payload[i] ^ key[i & 3] : payload[i]);
+		return out.toByteArray();
+	}
+
+	static byte[] bytes( final int length ) {
+		final byte[] bytes = new byte[length];
+		for (int i=0; i < length; i++) bytes[i] = (byte)('a' + i % 26);
+		return bytes;
+	}
+
+	static byte[] closePayload( final int code, final byte... reason ) {
+		final byte[] payload = new byte[2 + reason.length];
+		payload[0] = (byte)(code >>> 8);
+		payload[1] = (byte)code;
+		System.arraycopy(reason, 0, payload, 2, reason.length);
+		return payload;
+	}
+
+	@Test
+	public void frames() throws Exception {
+		final UWebSocketFrame close = UWebSocketFrame.close(1000, "ok");
+		assertEquals(1000, close.closeCode());
+		assertEquals("ok", close.closeReason());
+		assertEquals(UWebSocketFrame.NO_STATUS, UWebSocketFrame.close(UWebSocketFrame.NO_STATUS, null).closeCode());
+		// a long reason is cut without splitting a character
+		final StringBuilder sb = new StringBuilder();
+		for (int i=0; i < 100; i++) sb.append('ä');
+		final UWebSocketFrame cut = UWebSocketFrame.close(1001, sb.toString());
+		assertTrue(cut.payload().length <= UWebSocketFrame.MAX_CONTROL_PAYLOAD);
+		assertEquals(sb.substring(0, 61), cut.closeReason());
+		assertTrue(UWebSocketFrame.isValidCloseCode(4999));
+		assertFalse(UWebSocketFrame.isValidCloseCode(1005));
+		assertFalse(UWebSocketFrame.isValidCloseCode(999));
+		// the example of RFC 6455, section 1.3
+		assertEquals("s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", UWebSocketHandshake.acceptKey("dGhlIHNhbXBsZSBub25jZQ=="));
+	}
+
+	@Test
+	public void handshakeRejections() throws Exception {
+		try (Socket socket = new Socket(address.getAddress(), address.getPort())) {
+			socket.setSoTimeout(5000);
+			socket.getOutputStream().write("GET /echo HTTP/1.1\r\nHost: x\r\n\r\nGET /echo HTTP/1.1\r\nHost: x\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 8\r\n\r\n".getBytes(StandardCharsets.ISO_8859_1));
+			final InputStream in = socket.getInputStream();
+			final String responses = readAvailable(in, 2);
+			assertTrue(responses, responses.startsWith("HTTP/1.1 426 "));
+			assertTrue(responses, responses.contains("Sec-WebSocket-Version: 13"));
+		}
+	}
+
+	/**
+	 * Reads until the given amount of status lines were received.
+	 */
+	private static String readAvailable( final InputStream in, final int responses ) throws IOException {
+		final StringBuilder sb = new StringBuilder();
+		int count = 0;
+		int index = 0;
+		while (count < responses) {
+			final int c = in.read();
+			if (c < 0) break;
+			sb.append((char)c);
+			final int found = sb.indexOf("HTTP/1.1 ", index);
+			if (found >= 0) {
+				count++;
+				index = found + 1;
+			}
+		}
+		// read the rest of the last response head
+		while (sb.lastIndexOf("\r\n\r\n") < index) sb.append((char)in.read());
+		return sb.toString();
+	}
+
+	@Test
+	public void framingCases() throws Exception {
+		try (RawClient client = new RawClient("/echo")) {
+			// 1.1.x text and 1.2.x binary messages with all length encodings
+			for (final int length : new int[]{ 0, 125, 126, 127, 65535, 65536 }) {
+				client.send(UWebSocketFrame.TEXT, bytes(length));
+				final UWebSocketFrame frame = client.read();
+				assertEquals(UWebSocketFrame.TEXT, frame.opcode());
+				assertTrue(frame.isFinal());
+				assertArrayEquals(bytes(length), frame.payload());
+			}
+			client.send(UWebSocketFrame.BINARY, new byte[]{ 0, (byte)0xff, 1 });
+			assertArrayEquals(new byte[]{ 0, (byte)0xff, 1 }, client.read().payload());
+			// 2.x ping is answered with a pong with the same payload, unsolicited pongs are ignored
+			client.send(UWebSocketFrame.PONG, bytes(3));
+			client.send(UWebSocketFrame.PING, bytes(125));
+			UWebSocketFrame frame = client.read();
+			assertEquals(UWebSocketFrame.PONG, frame.opcode());
+			assertArrayEquals(bytes(125), frame.payload());
+			// 5.x fragmented message with a ping in between, multi-byte character split between fragments
+			final byte[] text = "hällo".getBytes(StandardCharsets.UTF_8);
+			client.send(false, 0, UWebSocketFrame.TEXT, Arrays.copyOfRange(text, 0, 2));
+			client.send(UWebSocketFrame.PING, new byte[]{ 7 });
+			client.send(false, 0, UWebSocketFrame.CONTINUATION, Arrays.copyOfRange(text, 2, 4));
+			client.send(true, 0, UWebSocketFrame.CONTINUATION, Arrays.copyOfRange(text, 4, text.length));
+			frame = client.read();
+			assertEquals(UWebSocketFrame.PONG, frame.opcode());
+			assertArrayEquals(new byte[]{ 7 }, frame.payload());
+			frame = client.read();
+			assertEquals(UWebSocketFrame.TEXT, frame.opcode());
+			assertEquals("hällo", frame.text());
+			// 7.1.1 close handshake
+			client.send(UWebSocketFrame.CLOSE, closePayload(1000));
+			client.expectClose(1000);
+		}
+		assertEquals(1000, serverClosed.poll(5, TimeUnit.SECONDS).intValue());
+	}
+
+	/**
+	 * Sends the given frames and expects the server to close the connection with the given code.
+	 */
+	private void expectFailure( final int code, final byte[]... frames ) throws Exception {
+		try (RawClient client = new RawClient("/echo")) {
+			for (final byte[] frame : frames) client.write(frame);
+			UWebSocketFrame frame;
+			// messages sent before the violation are still echoed
+			while ((frame = client.read()).opcode()!=UWebSocketFrame.CLOSE) assertFalse(frame.isControl());
+			assertEquals(code, frame.closeCode());
+			assertClosed(client.in);
+		}
+		assertEquals(code, serverClosed.poll(5, TimeUnit.SECONDS).intValue());
+	}
+
+	@Test
+	public void protocolViolations() throws Exception {
+		final int error = UWebSocketFrame.PROTOCOL_ERROR;
+		final byte[] hello = frame(true, 0, UWebSocketFrame.TEXT, bytes(5), true);
+		// 2.5 ping with more than 125 bytes
+		expectFailure(error, frame(true, 0, UWebSocketFrame.PING, bytes(126), true));
+		// 3.x reserved bits without extension
+		expectFailure(error, hello, frame(true, 1, UWebSocketFrame.TEXT, bytes(5), true));
+		expectFailure(error, frame(true, 4, UWebSocketFrame.PING, bytes(1), true));
+		// 4.x reserved opcodes
+		expectFailure(error, frame(true, 0, 3, bytes(1), true));
+		expectFailure(error, hello, frame(true, 0, 0xB, bytes(1), true));
+		// 5.x fragmented control frame, continuation without message, new message within a fragmented message
+		expectFailure(error, frame(false, 0, UWebSocketFrame.PING, bytes(1), true));
+		expectFailure(error, frame(true, 0, UWebSocketFrame.CONTINUATION, bytes(1), true));
+		expectFailure(error, frame(false, 0, UWebSocketFrame.TEXT, bytes(1), true), frame(true, 0, UWebSocketFrame.TEXT, bytes(1), true));
+		// unmasked client frame
+		expectFailure(error, frame(true, 0, UWebSocketFrame.TEXT, bytes(1), false));
+		// 6.x invalid UTF-8, also if only a fragment is invalid
+		expectFailure(UWebSocketFrame.INVALID_PAYLOAD, frame(true, 0, UWebSocketFrame.TEXT, new byte[]{ (byte)0xce, (byte)0xba, (byte)0xe1, (byte)0xbd }, true));
+		expectFailure(UWebSocketFrame.INVALID_PAYLOAD, frame(false, 0, UWebSocketFrame.TEXT, bytes(3), true), frame(true, 0, UWebSocketFrame.CONTINUATION, new byte[]{ (byte)0xed, (byte)0xa0, (byte)0x80 }, true));
+		// 7.3.x and 7.5.x close frames with one byte, invalid codes and an invalid reason
+		expectFailure(error, frame(true, 0, UWebSocketFrame.CLOSE, new byte[]{ 3 }, true));
+		expectFailure(error, frame(true, 0, UWebSocketFrame.CLOSE, closePayload(999), true));
+		expectFailure(error, frame(true, 0, UWebSocketFrame.CLOSE, closePayload(1005), true));
+		expectFailure(UWebSocketFrame.INVALID_PAYLOAD, frame(true, 0, UWebSocketFrame.CLOSE, closePayload(1000, (byte)0xff), true));
+		// 9.x frames and fragmented messages above the limit
+		expectFailure(UWebSocketFrame.MESSAGE_TOO_BIG, frame(true, 0, UWebSocketFrame.BINARY, bytes((1 << 17) + 1), true));
+		expectFailure(UWebSocketFrame.MESSAGE_TOO_BIG, frame(false, 0, UWebSocketFrame.BINARY, bytes(1 << 16), true), frame(true, 0, UWebSocketFrame.CONTINUATION, bytes((1 << 16) + 1), true));
+	}
+
+	@Test
+	public void closeCases() throws Exception {
+		// 7.3.1 close without payload is answered without payload
+		try (RawClient client = new RawClient("/echo")) {
+			client.send(UWebSocketFrame.CLOSE, new byte[0]);
+			client.expectClose(UWebSocketFrame.NO_STATUS);
+		}
+		assertEquals(UWebSocketFrame.NO_STATUS, serverClosed.poll(5, TimeUnit.SECONDS).intValue());
+		// 7.1.x messages after the close frame are ignored
+		try (RawClient client = new RawClient("/echo")) {
+			client.write(concat(frame(true, 0, UWebSocketFrame.CLOSE, closePayload(3000, (byte)'x'), true), frame(true, 0, UWebSocketFrame.TEXT, bytes(3), true)));
+			final UWebSocketFrame frame = client.read();
+			assertEquals(UWebSocketFrame.CLOSE, frame.opcode());
+			assertEquals(3000, frame.closeCode());
+			assertClosed(client.in);
+		}
+		assertEquals(3000, serverClosed.poll(5, TimeUnit.SECONDS).intValue());
+		// the connection ends without close handshake
+		new RawClient("/echo").close();
+		assertEquals(UWebSocketFrame.ABNORMAL_CLOSURE, serverClosed.poll(5, TimeUnit.SECONDS).intValue());
+	}
+
+	static byte[] concat( final byte[] a, final byte[] b ) {
+		final byte[] result = Arrays.copyOf(a, a.length + b.length);
+		System.arraycopy(b, 0, result, a.length, b.length);
+		return result;
+	}
+
+	@Test
+	public void clientAndServer() throws Exception {
+		final UWebSocketClient client = new UWebSocketClient(group, pool);
+		final BlockingQueue<Object> received = new LinkedBlockingQueue<>();
+		final BlockingQueue<String> closed = new LinkedBlockingQueue<>();
+		final UWebSocketListenerAdapter listener = new UWebSocketListenerAdapter() {
+			@Override
+			public void onMessage( final UWebSocket webSocket, final Object message ) {
+				received.add(message);
+			}
+
+			@Override
+			public void onClose( final UWebSocket webSocket, final int code, final String reason ) {
+				closed.add(code+" "+reason);
+			}
+		};
+		UWebSocket webSocket = client.connect("ws://127.0.0.1:"+address.getPort()+"/json", listener).get(5, TimeUnit.SECONDS);
+		assertTrue(webSocket.isOpen());
+		webSocket.setFragmentSize(8);
+		webSocket.send(UMap.of(String.class, Object.class, "text", "hällo wörld, sent in fragments")).get(5, TimeUnit.SECONDS);
+		UMap<String,Object> reply = (UMap<String,Object>)received.poll(5, TimeUnit.SECONDS);
+		assertEquals("hällo wörld, sent in fragments", ((UMap<String,Object>)reply.getMap("echo")).getString("text"));
+		// the server pushes a message
+		serverSide.get().send(UMap.of(String.class, Object.class, "push", 1L));
+		reply = (UMap<String,Object>)received.poll(5, TimeUnit.SECONDS);
+		assertEquals(1L, reply.getLong("push"));
+		webSocket.close().get(5, TimeUnit.SECONDS);
+		assertFalse(webSocket.isOpen());
+		assertEquals("1000 ", closed.poll(5, TimeUnit.SECONDS));
+		assertEquals(1000, serverClosed.poll(5, TimeUnit.SECONDS).intValue());
+
+		// the server closes the connection
+		webSocket = client.connect("ws://127.0.0.1:"+address.getPort()+"/json", listener).get(5, TimeUnit.SECONDS);
+		webSocket.send(UMap.of(String.class, Object.class, "text", "bye"));
+		assertEquals("4000 done", closed.poll(5, TimeUnit.SECONDS));
+		assertEquals(4000, serverClosed.poll(5, TimeUnit.SECONDS).intValue());
+
+		// text that is not JSON is rejected
+		webSocket = client.connect("ws://127.0.0.1:"+address.getPort()+"/json", listener).get(5, TimeUnit.SECONDS);
+		webSocket.sendText("{invalid");
+		assertEquals(UWebSocketFrame.INVALID_PAYLOAD+" ", closed.poll(5, TimeUnit.SECONDS).substring(0, 5));
+
+		// the handshake fails for a path without WebSocket endpoint
+		try {
+			client.connect("ws://127.0.0.1:"+address.getPort()+"/nothing", listener).get(5, TimeUnit.SECONDS);
+			fail();
+		} catch (ExecutionException e) {
+			assertEquals(404, ((UHttpException)e.getCause()).getStatus());
+		}
+	}
+
+	@Test
+	public void backpressure() throws Exception {
+		final CountDownLatch unwritable = new CountDownLatch(1);
+		final CountDownLatch writable = new CountDownLatch(1);
+		final UWebSocket webSocket = new UWebSocketClient(group, pool).connect("ws://127.0.0.1:"+address.getPort()+"/echo", new UWebSocketListenerAdapter() {
+			@Override
+			public void onWritabilityChanged( final UWebSocket webSocket, final boolean isWritable ) {
+				(isWritable ? writable : unwritable).countDown();
+			}
+		}).get(5, TimeUnit.SECONDS);
+		// the server stops reading, so the client buffers until the channel is not writable anymore
+		while (serverSide.get()==null) Thread.sleep(1);
+		serverSide.get().setAutoRead(false);
+		Thread.sleep(50);
+		final byte[] data = new byte[16384];
+		for (int i=0; i < 8192 && webSocket.isWritable(); i++) {
+			webSocket.sendBinary(data);
+			if (i % 16==0) Thread.sleep(1);
+		}
+		assertTrue(unwritable.await(5, TimeUnit.SECONDS));
+		assertFalse(webSocket.isWritable());
+		// once the server reads again, the buffered bytes drain
+		serverSide.get().setAutoRead(true);
+		assertTrue(writable.await(5, TimeUnit.SECONDS));
+		webSocket.close().get(5, TimeUnit.SECONDS);
+	}
+}
@@ -296,10 +296,10 @@ public class UDuckTyped implements UType {
 				return (T) ((UMap)valueClass.newInstance()).map((UMap)value);
 			}
 			
-			// value is WList and valueClass is WList
-//			if ((value instanceof UList) && valueClass.isAssignableFrom(UList.class)) {
-//				return (T) ((UList)valueClass.newInstance()).map((UList)value);
-//			}
+			// value is UList and valueClass is UList
+			if ((value instanceof UList) && valueClass.isAssignableFrom(UList.class)) {
+				return (T) ((UList)valueClass.newInstance()).map((UList)value);
+			}
 
 			// value is JsonNumber and valueClass is WString
 //			if ((value instanceof Number) && valueClass.isAssignableFrom(String.class)) {
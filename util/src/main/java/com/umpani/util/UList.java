@@ -0,0 +1,591 @@
+package com.umpani.util;
+
+import java.lang.reflect.Array;
+import java.util.Arrays;
+import java.util.Collection;
+import java.util.ConcurrentModificationException;
+import java.util.Iterator;
+import java.util.List;
+import java.util.ListIterator;
+import java.util.NoSuchElementException;
+import java.util.RandomAccess;
+
+import com.umpani.util.exception.UReadOnlyException;
+
+/**
+ * A list implementation that is the counterpart of the {@link UMap}. It keeps all values in a row within an array
+ * that is wrapped in a data class, so that the data can be shared between multiple list views the same way as it is
+ * done by the map, for example using the <tt>map</tt> method.
+ *
+ * @param <E>
+ * the element type.
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UList<E> extends UDuckTyped implements List<E>, RandomAccess {
+	/**
+	 * The option bit to signal that the view or data is read-only.
+	 */
+	protected static final int OPT_READONLY = 1 << 0;
+
+	/**
+	 * The internal data that the UList has a view on. The methods of this internal data structure will not check if
+	 * the data is sealed!
+	 */
+	protected static class Data {
+		/**
+		 * Create a new data record of the specified initial capacity.
+		 * @param capacity
+		 * the desired capacity of the data.
+		 */
+		public Data( final int capacity ) {
+			this.values = new Object[capacity < 4 ? 4 : capacity];
+		}
+
+		/**
+		 * An array that stores the values of the list.
+		 */
+		protected Object[] values;
+
+		/**
+		 * The amount of valid values in the list.
+		 */
+		protected int size;
+
+		/**
+		 * Options of this data.
+		 */
+		protected int options;
+
+		/**
+		 * Returns true if this data array is sealed.
+		 */
+		protected final boolean isReadOnly() {
+			return (options & OPT_READONLY) == OPT_READONLY;
+		}
+
+		/**
+		 * Ensures that the values array is able to hold at least the given amount of values.
+		 * @param minCapacity
+		 * the minimal capacity.
+		 */
+		protected final void ensureCapacity( final int minCapacity ) {
+			if (minCapacity > values.length) {
+				int newCapacity = values.length << 1;
+				if (newCapacity < minCapacity) newCapacity = minCapacity;
+				values = Arrays.copyOf(values, newCapacity);
+			}
+		}
+	}
+
+	/**
+	 * The options of this view to the underlying data.
+	 */
+	protected int options;
+
+	/**
+	 * The data to which this list refers, may be null if nothing was added yet.
+	 */
+	protected Data data;
+
+	/**
+	 * A counter that is incremented with every structural modification done through this view, used to detect
+	 * concurrent modifications while iterating.
+	 */
+	protected int modCount;
+
+	/**
+	 * A helper method that can be used to create a new list from an array of values.
+	 *
+	 * @param valueType
+	 * the type of the values, if null the values are copied unchecked.
+	 * @param values
+	 * the values of the list.
+	 * @return
+	 * the new list for the given values.
+	 * @throws ClassCastException
+	 * if any value is not of the provided type.
+	 */
+	@SuppressWarnings("unchecked")
+	public static final <A> UList<A> of( final Class<A> valueType, final Object... values ) {
+		final UList<A> list = new UList<A>(false);
+		if (values!=null) {
+			for (int i=0; i < values.length; i++) {
+				final Object value = values[i];
+				if (value!=null && valueType!=null && !valueType.isInstance(value)) throw new ClassCastException("Value at index "+i+" is of an invalid type");
+				list.add((A)value);
+			}
+		}
+		list.init();
+		return list;
+	}
+
+	/**
+	 * Create a new empty list. This list will not allocate any memory until the first value is added.
+	 * @param callInit
+	 * if false, then the init method is not called.
+	 */
+	protected UList( final boolean callInit ) {
+		if (callInit) init();
+	}
+
+	/**
+	 * Create a new empty list. This list will not allocate any memory until the first value is added.
+	 */
+	public UList() {
+		init();
+	}
+
+	/**
+	 * A method that is called whenever the list is initialized. An initialization means that the data to which the
+	 * list refers is changed, so the list refers to other data. The default implementation will do nothing.
+	 */
+	protected void init() {}
+
+	/**
+	 * Returns true if this list or the underlying data is a read-only.
+	 * @return
+	 * true if this list or the underlying data is read-only.
+	 */
+	public final boolean isReadOnly() {
+		return ((options & OPT_READONLY)==OPT_READONLY) || (data!=null && data.isReadOnly());
+	}
+
+	/**
+	 * Makes this list and optionally the underlying data read-only.
+	 * @param data
+	 * true if this list and the underlying data should become read-only. Settings this parameter to true forces all
+	 * lists that refer to the same data to become read-only, doing so will make the access to the data thread safe.
+	 * @return
+	 * this.
+	 */
+	public final UList<E> setReadOnly( final boolean data ) {
+		options |= OPT_READONLY;
+		if (data && this.data!=null) this.data.options |= OPT_READONLY;
+		return this;
+	}
+
+	/**
+	 * This method forces this list to copy the data reference from the given list into this list. If the given list
+	 * is read-only, then this list will become read-only as well.
+	 * @param other
+	 * the other list from which to copy the reference to the underlying data.
+	 * @return
+	 * this.
+	 * @throws NullPointerException
+	 * if the provided other list is null.
+	 */
+	@SuppressWarnings("unchecked")
+	public <T extends UList<E>> T map( final UList<?> other ) throws NullPointerException {
+		this.data = other.data;
+		this.options = other.options;
+		this.modCount++;
+		init();
+		return (T)this;
+	}
+
+	/**
+	 * This method forces this list to copy the data reference from the given list into this list and to make this
+	 * list read-only.
+	 * @param other
+	 * the other list from which to copy the reference to the underlying data.
+	 * @return
+	 * this.
+	 * @throws NullPointerException
+	 * if the provided other list is null.
+	 */
+	@SuppressWarnings("unchecked")
+	public <T extends UList<E>> T mapReadOnly( final UList<?> other ) {
+		this.data = other.data;
+		this.options |= OPT_READONLY;
+		this.modCount++;
+		init();
+		return (T)this;
+	}
+
+	/**
+	 * This method forces this list to copy the data from the given list and to refer to the copied data. The copy is
+	 * not recursive.
+	 * @param other
+	 * the other list from which to copy the data.
+	 * @return
+	 * this.
+	 */
+	@SuppressWarnings("unchecked")
+	public <T extends UList<E>> T copy( final UList<?> other ) {
+		if (other!=null && other.data!=null) {
+			final Data otherData = other.data;
+			final Data data = this.data = new Data(otherData.values.length);
+			System.arraycopy(otherData.values, 0, data.values, 0, otherData.size);
+			data.size = otherData.size;
+		} else {
+			this.data = null;
+		}
+		this.options = 0;
+		this.modCount++;
+		init();
+		return (T)this;
+	}
+
+	/**
+	 * Ensures that this list may be modified and returns the data, creating it if necessary.
+	 * @param method
+	 * the name of the method that wants to modify the list.
+	 * @return
+	 * the data.
+	 * @throws UReadOnlyException
+	 * if this list is read-only.
+	 */
+	protected final Data writableData( final String method ) throws UReadOnlyException {
+		if (isReadOnly()) throw new UReadOnlyException(this,method,this);
+		Data data = this.data;
+		if (data==null) data = this.data = new Data(4);
+		return data;
+	}
+
+	/**
+	 * Throws an {@link IndexOutOfBoundsException} if the given index is not within the given bounds.
+	 */
+	private static final void checkIndex( final int index, final int size ) {
+		if (index < 0 || index >= size) throw new IndexOutOfBoundsException("Index: "+index+", Size: "+size);
+	}
+
+	@Override
+	public int size() {
+		return data==null ? 0 : data.size;
+	}
+
+	@Override
+	public final boolean isEmpty() {
+		return data==null || data.size==0;
+	}
+
+	@Override
+	public final boolean contains( final Object o ) {
+		return indexOf(o) >= 0;
+	}
+
+	@Override
+	public final Iterator<E> iterator() {
+		return new UListIterator(0);
+	}
+
+	@Override
+	public final Object[] toArray() {
+		final Data data = this.data;
+		if (data==null || data.size==0) return new Object[0];
+		final Object[] a = new Object[data.size];
+		for (int i=0; i < a.length; i++) a[i] = unboxValue(data.values[i]);
+		return a;
+	}
+
+	@SuppressWarnings("unchecked")
+	@Override
+	public final <T> T[] toArray( T[] a ) {
+		final int size = size();
+		if (a.length < size) {
+			a = (T[]) Array.newInstance(a.getClass().getComponentType(), size);
+		}
+		final Object[] values = size==0 ? null : data.values;
+		for (int i=0; i < size; i++) a[i] = (T)unboxValue(values[i]);
+		if (a.length > size) a[size] = null;
+		return a;
+	}
+
+	@Override
+	public final boolean add( final E e ) {
+		final Data data = writableData("add");
+		data.ensureCapacity(data.size+1);
+		data.values[data.size++] = boxValue(e);
+		modCount++;
+		return true;
+	}
+
+	@Override
+	public final boolean remove( final Object o ) {
+		final int index = indexOf(o);
+		if (index < 0) return false;
+		remove(index);
+		return true;
+	}
+
+	@Override
+	public final boolean containsAll( final Collection<?> c ) {
+		for (final Object o : c) {
+			if (!contains(o)) return false;
+		}
+		return true;
+	}
+
+	@Override
+	public final boolean addAll( final Collection<? extends E> c ) {
+		return addAll(size(), c);
+	}
+
+	@Override
+	public final boolean addAll( final int index, final Collection<? extends E> c ) {
+		final Data data = writableData("addAll");
+		if (index < 0 || index > data.size) throw new IndexOutOfBoundsException("Index: "+index+", Size: "+data.size);
+		final Object[] add = c.toArray();
+		if (add.length==0) return false;
+		data.ensureCapacity(data.size + add.length);
+		final Object[] values = data.values;
+		System.arraycopy(values, index, values, index+add.length, data.size-index);
+		for (int i=0; i < add.length; i++) values[index+i] = boxValue(add[i]);
+		data.size += add.length;
+		modCount++;
+		return true;
+	}
+
+	@Override
+	public final boolean removeAll( final Collection<?> c ) {
+		return retain(c, false);
+	}
+
+	@Override
+	public final boolean retainAll( final Collection<?> c ) {
+		return retain(c, true);
+	}
+
+	/**
+	 * Removes all values that are either contained or not contained in the given collection.
+	 * @param c
+	 * the collection to test against.
+	 * @param keep
+	 * true to keep all values contained in the collection; false to remove them.
+	 * @return
+	 * true if the list was modified.
+	 */
+	private final boolean retain( final Collection<?> c, final boolean keep ) {
+		if (c==null) throw new NullPointerException();
+		final Data data = this.data;
+		if (data==null || data.size==0) return false;
+		if (isReadOnly()) throw new UReadOnlyException(this,keep ? "retainAll" : "removeAll",this);
+		final Object[] values = data.values;
+		int j=0;
+		for (int i=0; i < data.size; i++) {
+			final Object value = values[i];
+			if (c.contains(unboxValue(value))==keep) values[j++] = value;
+		}
+		if (j==data.size) return false;
+		Arrays.fill(values, j, data.size, null);
+		data.size = j;
+		modCount++;
+		return true;
+	}
+
+	@Override
+	public final void clear() {
+		if (isReadOnly()) throw new UReadOnlyException(this,"clear",this);
+		if (this.data!=null) {
+			this.data.size = 0;
+			this.data.values = new Object[4];
+			modCount++;
+		}
+	}
+
+	@SuppressWarnings("unchecked")
+	@Override
+	public E get( final int index ) {
+		checkIndex(index, size());
+		return (E)unboxValue(data.values[index]);
+	}
+
+	@SuppressWarnings("unchecked")
+	@Override
+	public E set( final int index, final E element ) {
+		final Data data = writableData("set");
+		checkIndex(index, data.size);
+		final Object oldValue = data.values[index];
+		data.values[index] = boxValue(element);
+		return (E)unboxValue(oldValue);
+	}
+
+	@Override
+	public final void add( final int index, final E element ) {
+		final Data data = writableData("add");
+		if (index < 0 || index > data.size) throw new IndexOutOfBoundsException("Index: "+index+", Size: "+data.size);
+		data.ensureCapacity(data.size+1);
+		final Object[] values = data.values;
+		System.arraycopy(values, index, values, index+1, data.size-index);
+		values[index] = boxValue(element);
+		data.size++;
+		modCount++;
+	}
+
+	@SuppressWarnings("unchecked")
+	@Override
+	public final E remove( final int index ) {
+		final Data data = writableData("remove");
+		checkIndex(index, data.size);
+		final Object[] values = data.values;
+		final Object oldValue = values[index];
+		System.arraycopy(values, index+1, values, index, data.size-index-1);
+		values[--data.size] = null;
+		modCount++;
+		return (E)unboxValue(oldValue);
+	}
+
+	@Override
+	public final int indexOf( final Object o ) {
+		final Data data = this.data;
+		if (data==null) return -1;
+		final Object[] values = data.values;
+		for (int i=0; i < data.size; i++) {
+			final Object value = unboxValue(values[i]);
+			if (o==value || (o!=null && o.equals(value))) return i;
+		}
+		return -1;
+	}
+
+	@Override
+	public final int lastIndexOf( final Object o ) {
+		final Data data = this.data;
+		if (data==null) return -1;
+		final Object[] values = data.values;
+		for (int i=data.size-1; i >= 0; i--) {
+			final Object value = unboxValue(values[i]);
+			if (o==value || (o!=null && o.equals(value))) return i;
+		}
+		return -1;
+	}
+
+	@Override
+	public final ListIterator<E> listIterator() {
+		return new UListIterator(0);
+	}
+
+	@Override
+	public final ListIterator<E> listIterator( final int index ) {
+		if (index < 0 || index > size()) throw new IndexOutOfBoundsException("Index: "+index);
+		return new UListIterator(index);
+	}
+
+	/**
+	 * Returns a new list that contains a copy of the given range of this list. Unlike defined by the {@link List}
+	 * interface the returned list is not a view, modifications of it will not be reflected in this list.
+	 */
+	@SuppressWarnings("unchecked")
+	@Override
+	public final List<E> subList( final int fromIndex, final int toIndex ) {
+		if (fromIndex < 0 || toIndex > size() || fromIndex > toIndex) {
+			throw new IndexOutOfBoundsException("fromIndex: "+fromIndex+", toIndex: "+toIndex);
+		}
+		final UList<E> list = new UList<E>();
+		for (int i=fromIndex; i < toIndex; i++) list.add((E)unboxValue(data.values[i]));
+		return list;
+	}
+
+	@Override
+	public boolean equals( final Object other ) {
+		if (this==other) return true;
+		if (!(other instanceof List)) return false;
+		final List<?> otherList = (List<?>)other;
+		final int size = size();
+		if (size != otherList.size()) return false;
+		for (int i=0; i < size; i++) {
+			final Object value = unboxValue(data.values[i]);
+			final Object otherValue = otherList.get(i);
+			if (value==null ? otherValue!=null : !value.equals(otherValue)) return false;
+		}
+		return true;
+	}
+
+	@Override
+	public int hashCode() {
+		int hashCode = 1;
+		final int size = size();
+		for (int i=0; i < size; i++) {
+			final Object value = unboxValue(data.values[i]);
+			hashCode = 31*hashCode + (value==null ? 0 : value.hashCode());
+		}
+		return hashCode;
+	}
+
+	/**
+	 * The list iterator of the list.
+	 */
+	private final class UListIterator implements ListIterator<E> {
+		UListIterator( final int index ) {
+			this.cursor = index;
+			this.expectedModCount = modCount;
+		}
+
+		/**
+		 * The index of the next element to return.
+		 */
+		private int cursor;
+
+		/**
+		 * The index of the last returned element or -1.
+		 */
+		private int last = -1;
+
+		/**
+		 * The modification count expected.
+		 */
+		private int expectedModCount;
+
+		private final void checkModified() {
+			if (modCount != expectedModCount) throw new ConcurrentModificationException();
+		}
+
+		@Override
+		public boolean hasNext() {
+			return cursor < size();
+		}
+
+		@Override
+		public E next() {
+			checkModified();
+			if (cursor >= size()) throw new NoSuchElementException();
+			return get(last = cursor++);
+		}
+
+		@Override
+		public boolean hasPrevious() {
+			return cursor > 0;
+		}
+
+		@Override
+		public E previous() {
+			checkModified();
+			if (cursor <= 0) throw new NoSuchElementException();
+			return get(last = --cursor);
+		}
+
+		@Override
+		public int nextIndex() {
+			return cursor;
+		}
+
+		@Override
+		public int previousIndex() {
+			return cursor-1;
+		}
+
+		@Override
+		public void remove() {
+			if (last < 0) throw new IllegalStateException();
+			checkModified();
+			UList.this.remove(last);
+			cursor = last;
+			last = -1;
+			expectedModCount = modCount;
+		}
+
+		@Override
+		public void set( final E e ) {
+			if (last < 0) throw new IllegalStateException();
+			checkModified();
+			UList.this.set(last, e);
+		}
+
+		@Override
+		public void add( final E e ) {
+			checkModified();
+			UList.this.add(cursor++, e);
+			last = -1;
+			expectedModCount = modCount;
+		}
+	}
+}
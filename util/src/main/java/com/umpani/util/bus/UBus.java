@@ -0,0 +1,220 @@
+package com.umpani.util.bus;
+
+import java.util.ArrayList;
+import java.util.Collection;
+import java.util.List;
+import java.util.Map;
+import java.util.concurrent.CopyOnWriteArrayList;
+import java.util.concurrent.Executor;
+
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+import com.umpani.util.exception.UBusFullException;
+
+/**
+ * An in-process publish/subscribe message bus. Messages are published to hierarchical topics, whose segments are
+ * separated by dots, like <tt>orders.eu.created</tt>. Subscriptions use topic patterns, in which the segment
+ * <tt>*</tt> matches exactly one segment and the segment <tt>#</tt> matches any amount of segments, including none:
+ * <tt>orders.*</tt> matches <tt>orders.created</tt>, but not <tt>orders.eu.created</tt>, which is matched by
+ * <tt>orders.#</tt>, as is <tt>orders</tt> itself.
+ *
+ * </p><p>Every published message is copied once into a deep-frozen {@link UMap}, see {@link #freeze(Map)}, which is
+ * shared by all subscribers. Every subscriber has a bounded queue and an executor that delivers the messages, which
+ * may be an event loop of the aio module, a {@link UBusFullPolicy} decides what happens if the queue is full. The
+ * bus is thread safe.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UBus {
+	/**
+	 * The default capacity of the queue of a subscriber.
+	 */
+	public static final int DEFAULT_CAPACITY = 1024;
+
+	/**
+	 * Create a new bus.
+	 */
+	public UBus() {}
+
+	/**
+	 * The subscriptions.
+	 */
+	private final CopyOnWriteArrayList<UBusSubscription> subscriptions = new CopyOnWriteArrayList<UBusSubscription>();
+
+	/**
+	 * Subscribes to all topics that match the given pattern with a queue of the default capacity, which lets the
+	 * publisher fail when full.
+	 * @param pattern
+	 * the topic pattern.
+	 * @param executor
+	 * the executor that delivers the messages.
+	 * @param listener
+	 * the listener.
+	 * @return
+	 * the subscription.
+	 * @throws IllegalArgumentException
+	 * if the pattern is invalid.
+	 */
+	public UBusSubscription subscribe( final String pattern, final Executor executor, final UBusListener listener ) {
+		return subscribe(pattern, executor, DEFAULT_CAPACITY, UBusFullPolicy.ERROR, listener);
+	}
+
+	/**
+	 * Subscribes to all topics that match the given pattern.
+	 * @param pattern
+	 * the topic pattern.
+	 * @param executor
+	 * the executor that delivers the messages.
+	 * @param capacity
+	 * the maximal amount of messages that wait for delivery.
+	 * @param policy
+	 * the policy to apply if the queue is full.
+	 * @param listener
+	 * the listener.
+	 * @return
+	 * the subscription.
+	 * @throws IllegalArgumentException
+	 * if the pattern is invalid or the capacity is less than one.
+	 */
+	public UBusSubscription subscribe( final String pattern, final Executor executor, final int capacity, final UBusFullPolicy policy, final UBusListener listener ) {
+		if (executor==null) throw new NullPointerException("executor");
+		if (policy==null) throw new NullPointerException("policy");
+		if (listener==null) throw new NullPointerException("listener");
+		if (capacity <= 0) throw new IllegalArgumentException("capacity: "+capacity);
+		checkTopic(pattern, true);
+		final UBusSubscription subscription = new UBusSubscription(this, pattern, executor, capacity, policy, listener);
+		subscriptions.add(subscription);
+		subscription.start();
+		return subscription;
+	}
+
+	/**
+	 * Removes a cancelled subscription.
+	 */
+	final void remove( final UBusSubscription subscription ) {
+		subscriptions.remove(subscription);
+	}
+
+	/**
+	 * Returns a snapshot of the subscriptions.
+	 * @return
+	 * the subscriptions.
+	 */
+	public List<UBusSubscription> subscriptions() {
+		return new ArrayList<UBusSubscription>(subscriptions);
+	}
+
+	/**
+	 * Publishes a message to all subscribers whose pattern matches the given topic. The message is frozen, so that
+	 * later modifications of the given map have no effect.
+	 * @param topic
+	 * the topic, which must not contain wildcards.
+	 * @param message
+	 * the message.
+	 * @return
+	 * the amount of subscribers that received the message.
+	 * @throws IllegalArgumentException
+	 * if the topic is invalid or the message contains a value that can't be frozen.
+	 * @throws UBusFullException
+	 * if the queue of a subscriber with the policy {@link UBusFullPolicy#ERROR} was full.
+	 */
+	public int publish( final String topic, final Map<?,?> message ) {
+		checkTopic(topic, false);
+		if (message==null) throw new NullPointerException("message");
+		final String[] segments = topic.split("\\.", -1);
+		UMap<String,Object> frozen = null;
+		int delivered = 0;
+		int failed = 0;
+		for (final UBusSubscription subscription : subscriptions) {
+			if (!matches(subscription.segments, 0, segments, 0)) continue;
+			if (frozen==null) frozen = freeze(message);
+			if (subscription.offer(topic, frozen)) {
+				delivered++;
+			} else
+			if (subscription.policy==UBusFullPolicy.ERROR && !subscription.isCancelled()) {
+				failed++;
+			}
+		}
+		if (failed > 0) throw new UBusFullException(topic, failed);
+		return delivered;
+	}
+
+	/**
+	 * Returns true if the given topic matches the given pattern.
+	 * @param pattern
+	 * the topic pattern.
+	 * @param topic
+	 * the topic.
+	 * @return
+	 * true if the topic matches the pattern.
+	 */
+	public static boolean matches( final String pattern, final String topic ) {
+		return matches(pattern.split("\\.", -1), 0, topic.split("\\.", -1), 0);
+	}
+
+	/**
+	 * Matches the segments of the pattern starting at the given index against the segments of the topic.
+	 */
+	private static boolean matches( final String[] pattern, final int p, final String[] topic, final int t ) {
+		if (p==pattern.length) return t==topic.length;
+		if (pattern[p].equals("#")) {
+			for (int i=t; i <= topic.length; i++) {
+				if (matches(pattern, p + 1, topic, i)) return true;
+			}
+			return false;
+		}
+		if (t==topic.length) return false;
+		return (pattern[p].equals("*") || pattern[p].equals(topic[t])) && matches(pattern, p + 1, topic, t + 1);
+	}
+
+	/**
+	 * Throws if the given topic or pattern is invalid: empty segments and, in topics, wildcards are not allowed.
+	 */
+	private static void checkTopic( final String topic, final boolean pattern ) {
+		if (topic==null) throw new NullPointerException(pattern ? "pattern" : "topic");
+		for (final String segment : topic.split("\\.", -1)) {
+			if (segment.isEmpty()) throw new IllegalArgumentException("Empty segment in "+topic);
+			if (segment.equals("*") || segment.equals("#")) {
+				if (!pattern) throw new IllegalArgumentException("Wildcard in topic "+topic);
+			} else
+			if (segment.indexOf('*') >= 0 || segment.indexOf('#') >= 0) {
+				throw new IllegalArgumentException("Wildcards must be whole segments: "+topic);
+			}
+		}
+	}
+
+	/**
+	 * Returns a deep copy of the given map, in which all maps are read-only {@link UMap}s and all collections are
+	 * read-only {@link UList}s, so that it can be shared between threads. Other values must be immutable, which are
+	 * null, strings, numbers, booleans and characters, byte arrays are copied.
+	 * @param map
+	 * the map to freeze.
+	 * @return
+	 * the frozen copy.
+	 * @throws IllegalArgumentException
+	 * if a key is no string or a value is not supported.
+	 */
+	public static UMap<String,Object> freeze( final Map<?,?> map ) {
+		final UMap<String,Object> frozen = new UMap<String,Object>();
+		for (final Map.Entry<?,?> entry : map.entrySet()) {
+			if (!(entry.getKey() instanceof String)) throw new IllegalArgumentException("Key is no string: "+entry.getKey());
+			frozen.put((String)entry.getKey(), freezeValue(entry.getValue()));
+		}
+		return frozen.setReadOnly(true);
+	}
+
+	/**
+	 * Returns a frozen copy of the given value.
+	 */
+	private static Object freezeValue( final Object value ) {
+		if (value==null || value instanceof String || value instanceof Number || value instanceof Boolean || value instanceof Character) return value;
+		if (value instanceof Map) return freeze((Map<?,?>)value);
+		if (value instanceof Collection) {
+			final UList<Object> list = new UList<Object>();
+			for (final Object element : (Collection<?>)value) list.add(freezeValue(element));
+			return list.setReadOnly(true);
+		}
+		if (value instanceof byte[]) return ((byte[])value).clone();
+		throw new IllegalArgumentException("Unsupported value: "+value.getClass().getName());
+	}
+}
@@ -0,0 +1,25 @@
+package com.umpani.util.bus;
+
+/**
+ * The policy to apply by an {@link UBusSubscription} if its queue is full when a message is published.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public enum UBusFullPolicy {
+	/**
+	 * Drop the message for this subscriber and count it, see {@link UBusSubscription#getDropped()}.
+	 */
+	DROP,
+
+	/**
+	 * Block the publishing thread until there is room in the queue. A thread that delivers the messages of the
+	 * subscriber is never blocked, the message is dropped and counted instead.
+	 */
+	BLOCK,
+
+	/**
+	 * Drop the message for this subscriber and let the publisher fail with an
+	 * {@link com.umpani.util.exception.UBusFullException}, after the message was offered to all other subscribers.
+	 */
+	ERROR
+}
@@ -0,0 +1,22 @@
+package com.umpani.util.bus;
+
+import com.umpani.util.UMap;
+
+/**
+ * The listener of an {@link UBusSubscription}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface UBusListener {
+	/**
+	 * Called with every message published to a topic that matches the pattern of the subscription, messages are
+	 * delivered one after another in the order in which they were published.
+	 * @param topic
+	 * the topic to which the message was published.
+	 * @param message
+	 * the message, which is read-only including all nested maps and lists and therefore may be shared.
+	 * @throws Exception
+	 * if handling the message failed, the exception is logged and the next message is delivered.
+	 */
+	public void onMessage( final String topic, final UMap<String,Object> message ) throws Exception;
+}
@@ -0,0 +1,260 @@
+package com.umpani.util.bus;
+
+import java.util.ArrayDeque;
+import java.util.Collections;
+import java.util.Set;
+import java.util.WeakHashMap;
+import java.util.concurrent.Executor;
+import java.util.concurrent.RejectedExecutionException;
+import java.util.concurrent.atomic.AtomicLong;
+
+import com.umpani.util.UMap;
+import com.umpani.util.log.ULogger;
+
+/**
+ * A subscription at an {@link UBus}, created by {@link UBus#subscribe(String, Executor, int, UBusFullPolicy,
+ * UBusListener)}. Every subscription has a bounded queue of the messages that wait for delivery, the messages are
+ * handed to the listener by a task of the executor of the subscription, one after another. If the executor rejects
+ * the task, for example because the event loop behind it shut down, the subscription is cancelled.
+ *
+ * </p><p>With the {@link UBusFullPolicy#BLOCK} policy a thread that delivered messages of the subscription never
+ * blocks, the delivery may depend on it, for example the thread of an event loop or of a single threaded executor.
+ * If such a thread publishes while the queue is full, the message is dropped and counted instead.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class UBusSubscription {
+	/**
+	 * The logger of the subscriptions.
+	 */
+	private static final ULogger LOG = new ULogger(UBusSubscription.class.getName());
+
+	/**
+	 * The maximal amount of messages delivered by one task, before the task is submitted again, so that other tasks of
+	 * a shared executor are not starved.
+	 */
+	private static final int BATCH = 64;
+
+	/**
+	 * Create a new subscription.
+	 */
+	UBusSubscription( final UBus bus, final String pattern, final Executor executor, final int capacity, final UBusFullPolicy policy, final UBusListener listener ) {
+		this.bus = bus;
+		this.pattern = pattern;
+		this.segments = pattern.split("\\.", -1);
+		this.executor = executor;
+		this.capacity = capacity;
+		this.policy = policy;
+		this.listener = listener;
+	}
+
+	/**
+	 * The bus.
+	 */
+	private final UBus bus;
+
+	/**
+	 * The topic pattern.
+	 */
+	private final String pattern;
+
+	/**
+	 * The segments of the pattern.
+	 */
+	final String[] segments;
+
+	/**
+	 * The executor that delivers the messages.
+	 */
+	private final Executor executor;
+
+	/**
+	 * The maximal amount of queued messages.
+	 */
+	private final int capacity;
+
+	/**
+	 * The policy to apply if the queue is full.
+	 */
+	final UBusFullPolicy policy;
+
+	/**
+	 * The listener.
+	 */
+	private final UBusListener listener;
+
+	/**
+	 * The queued topics and messages in alternation, guarded by this.
+	 */
+	private final ArrayDeque<Object> queue = new ArrayDeque<Object>();
+
+	/**
+	 * True while a delivery task is submitted, guarded by this.
+	 */
+	private boolean scheduled;
+
+	/**
+	 * The threads that delivered messages, guarded by this.
+	 */
+	private final Set<Thread> deliveryThreads = Collections.newSetFromMap(new WeakHashMap<Thread,Boolean>());
+
+	/**
+	 * True once the subscription was cancelled.
+	 */
+	private volatile boolean cancelled;
+
+	/**
+	 * The amount of dropped messages.
+	 */
+	private final AtomicLong dropped = new AtomicLong();
+
+	/**
+	 * The task that delivers the queued messages.
+	 */
+	private final Runnable delivery = new Runnable() {
+		@Override
+		public void run() {
+			deliver();
+		}
+	};
+
+	/**
+	 * Returns the topic pattern.
+	 * @return
+	 * the topic pattern.
+	 */
+	public String pattern() {
+		return pattern;
+	}
+
+	/**
+	 * Returns true if the subscription was cancelled.
+	 * @return
+	 * true if the subscription was cancelled.
+	 */
+	public boolean isCancelled() {
+		return cancelled;
+	}
+
+	/**
+	 * Returns the amount of messages that wait for delivery.
+	 * @return
+	 * the amount of queued messages.
+	 */
+	public synchronized int getQueued() {
+		return queue.size() >> 1;
+	}
+
+	/**
+	 * Returns the amount of messages that were not delivered, because the queue was full.
+	 * @return
+	 * the amount of dropped messages.
+	 */
+	public long getDropped() {
+		return dropped.get();
+	}
+
+	/**
+	 * Cancels the subscription, queued messages are discarded and blocked publishers return.
+	 */
+	public void cancel() {
+		cancelled = true;
+		bus.remove(this);
+		synchronized (this) {
+			queue.clear();
+			notifyAll();
+		}
+	}
+
+	/**
+	 * Submits a first delivery task, so that the thread of the executor is known before the queue is full.
+	 */
+	void start() {
+		synchronized (this) {
+			scheduled = true;
+		}
+		schedule();
+	}
+
+	/**
+	 * Queues the given message.
+	 * @return
+	 * true if the message was queued; false if it was dropped.
+	 */
+	boolean offer( final String topic, final UMap<String,Object> message ) {
+		synchronized (this) {
+			while (!cancelled && queue.size() >= capacity << 1) {
+				if (policy!=UBusFullPolicy.BLOCK) {
+					dropped.incrementAndGet();
+					return false;
+				}
+				// the delivery may wait for this thread, so it would block forever
+				if (deliveryThreads.contains(Thread.currentThread())) {
+					dropped.incrementAndGet();
+					return false;
+				}
+				try {
+					wait();
+				} catch (InterruptedException e) {
+					Thread.currentThread().interrupt();
+					dropped.incrementAndGet();
+					return false;
+				}
+			}
+			if (cancelled) return false;
+			queue.add(topic);
+			queue.add(message);
+			if (scheduled) return true;
+			scheduled = true;
+		}
+		schedule();
+		return true;
+	}
+
+	/**
+	 * Submits the delivery task, the subscription is cancelled if the executor rejects it.
+	 */
+	private void schedule() {
+		try {
+			executor.execute(delivery);
+		} catch (RejectedExecutionException e) {
+			cancel();
+		}
+	}
+
+	/**
+	 * Delivers the queued messages, executed by the executor.
+	 */
+	@SuppressWarnings("unchecked")
+	private void deliver() {
+		synchronized (this) {
+			deliveryThreads.add(Thread.currentThread());
+		}
+		for (int i=0; i < BATCH; i++) {
+			final String topic;
+			final UMap<String,Object> message;
+			synchronized (this) {
+				if (queue.isEmpty()) {
+					scheduled = false;
+					return;
+				}
+				topic = (String)queue.poll();
+				message = (UMap<String,Object>)queue.poll();
+				notifyAll();
+			}
+			if (cancelled) continue;
+			try {
+				listener.onMessage(topic, message);
+			} catch (Throwable t) {
+				LOG.error("Failed to deliver a message", "topic", topic, "subscription", toString(), t);
+			}
+		}
+		// more messages are queued, give other tasks a chance
+		schedule();
+	}
+
+	@Override
+	public String toString() {
+		return "UBusSubscription["+pattern+"]";
+	}
+}
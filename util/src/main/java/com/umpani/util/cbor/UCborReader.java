@@ -0,0 +1,429 @@
+package com.umpani.util.cbor;
+
+import java.io.ByteArrayInputStream;
+import java.io.ByteArrayOutputStream;
+import java.io.Closeable;
+import java.io.IOException;
+import java.io.InputStream;
+import java.math.BigDecimal;
+import java.math.BigInteger;
+import java.nio.ByteBuffer;
+import java.nio.charset.CharacterCodingException;
+import java.nio.charset.CodingErrorAction;
+import java.nio.charset.StandardCharsets;
+
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+import com.umpani.util.exception.UCborException;
+
+/**
+ * A blocking CBOR (RFC 7049) parser that reads data items from an {@link InputStream} and converts them into the same
+ * types as the {@link com.umpani.util.json.UJsonReader}: {@link UMap}, {@link UList}, {@link String}, {@link Long},
+ * {@link BigInteger}, {@link Double}, {@link Boolean} or null. Byte strings are returned as byte[], decimal fractions
+ * as {@link BigDecimal}, bignums as {@link BigInteger}, undefined as null and all other tags are ignored. Map keys that
+ * are no text strings are converted to strings. Definite and indefinite lengths are supported.
+ *
+ * </p><p>The parser enforces limits for the nesting depth and for the length of strings and containers so that a
+ * malicious input can't exhaust the stack or the memory. All errors are reported as {@link UCborException} that holds
+ * the offset of the byte at which the error was detected.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UCborReader implements Closeable {
+	/**
+	 * The default maximal nesting depth of arrays and maps.
+	 */
+	public static final int DEFAULT_MAX_DEPTH = 512;
+
+	/**
+	 * The default maximal length of strings in bytes and of arrays and maps in entries.
+	 */
+	public static final int DEFAULT_MAX_LENGTH = 16*1024*1024;
+
+	/**
+	 * The marker returned for the break stop code.
+	 */
+	private static final Object BREAK = new Object();
+
+	/**
+	 * Create a new CBOR reader.
+	 * @param in
+	 * the stream from which to read the CBOR.
+	 * @throws NullPointerException
+	 * if the given stream is null.
+	 */
+	public UCborReader( final InputStream in ) {
+		if (in==null) throw new NullPointerException("in");
+		this.in = in;
+	}
+
+	/**
+	 * The stream from which to read.
+	 */
+	protected final InputStream in;
+
+	/**
+	 * The amount of bytes consumed so far.
+	 */
+	private long offset;
+
+	/**
+	 * The current nesting depth.
+	 */
+	private int depth;
+
+	/**
+	 * The maximal nesting depth.
+	 */
+	private int maxDepth = DEFAULT_MAX_DEPTH;
+
+	/**
+	 * The maximal length of strings and containers.
+	 */
+	private int maxLength = DEFAULT_MAX_LENGTH;
+
+	/**
+	 * Parses the given CBOR bytes that must contain exactly one data item.
+	 * @param cbor
+	 * the CBOR bytes.
+	 * @return
+	 * the parsed value.
+	 * @throws UCborException
+	 * if the given bytes are no valid CBOR.
+	 */
+	public static Object parse( final byte[] cbor ) throws UCborException {
+		return parse(cbor, 0, cbor.length);
+	}
+
+	/**
+	 * Parses the given CBOR bytes that must contain exactly one data item.
+	 * @param cbor
+	 * the array holding the CBOR bytes.
+	 * @param off
+	 * the offset of the first byte.
+	 * @param len
+	 * the amount of bytes.
+	 * @return
+	 * the parsed value.
+	 * @throws UCborException
+	 * if the given bytes are no valid CBOR.
+	 */
+	public static Object parse( final byte[] cbor, final int off, final int len ) throws UCborException {
+		final UCborReader reader = new UCborReader(new ByteArrayInputStream(cbor, off, len));
+		try {
+			final Object value = reader.next();
+			if (reader.offset < len) throw new UCborException("Unexpected data after the value", reader.offset);
+			return value;
+		} catch (UCborException e) {
+			throw e;
+		} catch (IOException e) {
+			// a byte array input stream does not throw
+			throw new IllegalStateException(e);
+		}
+	}
+
+	/**
+	 * Sets the maximal nesting depth of arrays and maps.
+	 * @param maxDepth
+	 * the maximal nesting depth.
+	 * @return
+	 * this.
+	 */
+	public final UCborReader setMaxDepth( final int maxDepth ) {
+		this.maxDepth = maxDepth;
+		return this;
+	}
+
+	/**
+	 * Sets the maximal length of strings in bytes and of arrays and maps in entries.
+	 * @param maxLength
+	 * the maximal length.
+	 * @return
+	 * this.
+	 */
+	public final UCborReader setMaxLength( final int maxLength ) {
+		this.maxLength = maxLength;
+		return this;
+	}
+
+	/**
+	 * Returns the amount of bytes consumed so far.
+	 * @return
+	 * the offset of the next byte.
+	 */
+	public final long getOffset() {
+		return offset;
+	}
+
+	/**
+	 * Reads the next data item.
+	 * @return
+	 * the value.
+	 * @throws UCborException
+	 * if the input is no valid CBOR or ends before the data item.
+	 * @throws IOException
+	 * if reading failed.
+	 */
+	public Object next() throws IOException {
+		final Object value = readItem();
+		if (value==BREAK) throw new UCborException("Unexpected break", offset - 1);
+		return value;
+	}
+
+	/**
+	 * Reads a data item, returns {@link #BREAK} for the break stop code.
+	 */
+	private Object readItem() throws IOException {
+		final long start = offset;
+		final int initial = read();
+		final int major = initial >>> 5;
+		final int info = initial & 0x1f;
+		switch (major) {
+			case UCborWriter.UNSIGNED:
+				return unsigned(argument(info, start));
+			case UCborWriter.NEGATIVE: {
+				final long n = argument(info, start);
+				// -1-n, n is unsigned
+				return n >= 0 ? (Object)Long.valueOf(-1 - n) : unsignedBig(n).not();
+			}
+			case UCborWriter.BYTES:
+				return readBytes(info, start, UCborWriter.BYTES);
+			case UCborWriter.TEXT:
+				return decodeUtf8(readBytes(info, start, UCborWriter.TEXT), start);
+			case UCborWriter.ARRAY:
+				return readArray(info, start);
+			case UCborWriter.MAP:
+				return readMap(info, start);
+			case UCborWriter.TAG:
+				return readTagged(argument(info, start), start);
+			default:
+				return readSimple(info, start);
+		}
+	}
+
+	/**
+	 * Reads an array.
+	 */
+	private UList<Object> readArray( final int info, final long start ) throws IOException {
+		enter(start);
+		final UList<Object> list = new UList<Object>();
+		if (info==31) {
+			Object value;
+			while ((value = readItem())!=BREAK) {
+				if (list.size() >= maxLength) throw new UCborException("Array too long", start);
+				list.add(value);
+			}
+		} else {
+			final long size = length(info, start);
+			for (long i=0; i < size; i++) list.add(next());
+		}
+		depth--;
+		return list;
+	}
+
+	/**
+	 * Reads a map.
+	 */
+	private UMap<String,Object> readMap( final int info, final long start ) throws IOException {
+		enter(start);
+		final UMap<String,Object> map = new UMap<String,Object>();
+		if (info==31) {
+			Object key;
+			while ((key = readItem())!=BREAK) {
+				if (map.size() >= maxLength) throw new UCborException("Map too long", start);
+				map.put(key(key), next());
+			}
+		} else {
+			final long size = length(info, start);
+			for (long i=0; i < size; i++) {
+				final String key = key(next());
+				map.put(key, next());
+			}
+		}
+		depth--;
+		return map;
+	}
+
+	/**
+	 * Converts a map key into a string.
+	 */
+	private static String key( final Object key ) {
+		if (key instanceof byte[]) return new String((byte[])key, StandardCharsets.UTF_8);
+		return String.valueOf(key);
+	}
+
+	/**
+	 * Reads the data item of a tag.
+	 */
+	private Object readTagged( final long tag, final long start ) throws IOException {
+		// nested tags count as nesting, so that they can't exhaust the stack
+		enter(start);
+		final Object value = next();
+		depth--;
+		if ((tag==2 || tag==3) && value instanceof byte[]) {
+			final BigInteger n = new BigInteger(1, (byte[])value);
+			return tag==2 ? n : n.not();
+		}
+		if (tag==4 && value instanceof UList && ((UList<?>)value).size()==2) {
+			final UList<?> fraction = (UList<?>)value;
+			final Object exponent = fraction.get(0);
+			final Object mantissa = fraction.get(1);
+			if (!(exponent instanceof Long) || !(mantissa instanceof Long || mantissa instanceof BigInteger)) {
+				throw new UCborException("Invalid decimal fraction", start);
+			}
+			final long scale = -(Long)exponent;
+			if (scale < Integer.MIN_VALUE || scale > Integer.MAX_VALUE) throw new UCborException("Decimal exponent out of range", start);
+			final BigInteger unscaled = mantissa instanceof Long ? BigInteger.valueOf((Long)mantissa) : (BigInteger)mantissa;
+			return new BigDecimal(unscaled, (int)scale);
+		}
+		return value;
+	}
+
+	/**
+	 * Reads a simple value or a float.
+	 */
+	private Object readSimple( final int info, final long start ) throws IOException {
+		switch (info) {
+			case 20: return Boolean.FALSE;
+			case 21: return Boolean.TRUE;
+			case 22: return null;
+			case 23: return null;
+			case 25: return Double.valueOf(halfToDouble((int)readUnsigned(2)));
+			case 26: return Double.valueOf(Float.intBitsToFloat((int)readUnsigned(4)));
+			case 27: return Double.valueOf(Double.longBitsToDouble(readUnsigned(8)));
+			case 31: return BREAK;
+			default: throw new UCborException("Unsupported simple value "+info, start);
+		}
+	}
+
+	/**
+	 * Reads a byte or text string, an indefinite string is concatenated from its chunks.
+	 */
+	private byte[] readBytes( final int info, final long start, final int major ) throws IOException {
+		if (info!=31) return readFully(length(info, start), start);
+		final ByteArrayOutputStream out = new ByteArrayOutputStream();
+		for (;;) {
+			final long chunkStart = offset;
+			final int initial = read();
+			if (initial==0xff) break;
+			if (initial >>> 5!=major || (initial & 0x1f)==31) throw new UCborException("Invalid chunk of an indefinite string", chunkStart);
+			final byte[] chunk = readFully(length(initial & 0x1f, chunkStart), chunkStart);
+			if (out.size() + chunk.length > maxLength) throw new UCborException("String too long", start);
+			out.write(chunk, 0, chunk.length);
+		}
+		return out.toByteArray();
+	}
+
+	/**
+	 * Reads the given amount of bytes.
+	 */
+	private byte[] readFully( final long length, final long start ) throws IOException {
+		final byte[] bytes = new byte[(int)length];
+		int n = 0;
+		while (n < bytes.length) {
+			final int r = in.read(bytes, n, bytes.length - n);
+			if (r < 0) throw new UCborException("Unexpected end of input", offset + n);
+			n += r;
+		}
+		offset += n;
+		return bytes;
+	}
+
+	/**
+	 * Decodes UTF-8, rejecting malformed input.
+	 */
+	private static String decodeUtf8( final byte[] bytes, final long start ) throws UCborException {
+		try {
+			return StandardCharsets.UTF_8.newDecoder().onMalformedInput(CodingErrorAction.REPORT)
+					.onUnmappableCharacter(CodingErrorAction.REPORT).decode(ByteBuffer.wrap(bytes)).toString();
+		} catch (CharacterCodingException e) {
+			throw new UCborException("Invalid UTF-8 in text string", start);
+		}
+	}
+
+	/**
+	 * Reads the argument of a header, the result is an unsigned 64 bit integer.
+	 */
+	private long argument( final int info, final long start ) throws IOException {
+		if (info < 24) return info;
+		switch (info) {
+			case 24: return readUnsigned(1);
+			case 25: return readUnsigned(2);
+			case 26: return readUnsigned(4);
+			case 27: return readUnsigned(8);
+			default: throw new UCborException("Invalid additional information "+info, start);
+		}
+	}
+
+	/**
+	 * Reads the argument of a header as length and checks it against the limit.
+	 */
+	private long length( final int info, final long start ) throws IOException {
+		final long length = argument(info, start);
+		if (length < 0 || length > maxLength) throw new UCborException("Length exceeds the limit of "+maxLength, start);
+		return length;
+	}
+
+	/**
+	 * Increments the nesting depth.
+	 */
+	private void enter( final long start ) throws UCborException {
+		if (++depth > maxDepth) throw new UCborException("Nesting exceeds the maximal depth of "+maxDepth, start);
+	}
+
+	/**
+	 * Reads a big endian unsigned integer of the given amount of bytes.
+	 */
+	private long readUnsigned( final int bytes ) throws IOException {
+		long value = 0;
+		for (int i=0; i < bytes; i++) value = (value << 8) | read();
+		return value;
+	}
+
+	/**
+	 * Reads the next byte.
+	 */
+	private int read() throws IOException {
+		final int b = in.read();
+		if (b < 0) throw new UCborException("Unexpected end of input", offset);
+		offset++;
+		return b;
+	}
+
+	/**
+	 * Returns the given unsigned 64 bit integer as Long or, if it does not fit, as BigInteger.
+	 */
+	private static Object unsigned( final long n ) {
+		return n >= 0 ? (Object)Long.valueOf(n) : unsignedBig(n);
+	}
+
+	/**
+	 * Converts the given unsigned 64 bit integer into a big integer.
+	 */
+	private static BigInteger unsignedBig( final long n ) {
+		return BigInteger.valueOf(n & Long.MAX_VALUE).setBit(63);
+	}
+
+	/**
+	 * Converts a half precision float into a double.
+	 */
+	private static double halfToDouble( final int half ) {
+		final int exponent = (half >>> 10) & 0x1f;
+		final int mantissa = half & 0x3ff;
+		final double value;
+		if (exponent==0) {
+			value = mantissa * Math.pow(2, -24);
+		} else
+		if (exponent==31) {
+			value = mantissa==0 ? Double.POSITIVE_INFINITY : Double.NaN;
+		} else {
+			value = (mantissa + 1024) * Math.pow(2, exponent - 25);
+		}
+		return (half & 0x8000)!=0 ? -value : value;
+	}
+
+	@Override
+	public void close() throws IOException {
+		in.close();
+	}
+}
@@ -0,0 +1,380 @@
+package com.umpani.util.cbor;
+
+import java.io.ByteArrayOutputStream;
+import java.io.Closeable;
+import java.io.Flushable;
+import java.io.IOException;
+import java.io.OutputStream;
+import java.lang.reflect.Array;
+import java.math.BigDecimal;
+import java.math.BigInteger;
+import java.nio.charset.StandardCharsets;
+import java.util.Collection;
+import java.util.Map;
+
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+
+/**
+ * Writes values as CBOR (RFC 7049), the binary counterpart of the {@link com.umpani.util.json.UJsonWriter}. Maps,
+ * {@link UMap}s, collections, {@link UList}s, arrays, strings, numbers, booleans and null are written like with JSON,
+ * byte arrays as byte strings, big integers that do not fit into 64 bits as bignums and big decimals as decimal
+ * fractions. Doubles that can be represented as float without loss are written with 32 bits. All other values are
+ * written as their string representation. Only definite lengths are written.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UCborWriter implements Closeable, Flushable {
+	/**
+	 * The major type of unsigned integers.
+	 */
+	static final int UNSIGNED = 0;
+
+	/**
+	 * The major type of negative integers.
+	 */
+	static final int NEGATIVE = 1;
+
+	/**
+	 * The major type of byte strings.
+	 */
+	static final int BYTES = 2;
+
+	/**
+	 * The major type of text strings.
+	 */
+	static final int TEXT = 3;
+
+	/**
+	 * The major type of arrays.
+	 */
+	static final int ARRAY = 4;
+
+	/**
+	 * The major type of maps.
+	 */
+	static final int MAP = 5;
+
+	/**
+	 * The major type of tags.
+	 */
+	static final int TAG = 6;
+
+	/**
+	 * The major type of simple values and floats.
+	 */
+	static final int SIMPLE = 7;
+
+	/**
+	 * The largest unsigned 64 bit integer.
+	 */
+	private static final BigInteger MAX_UNSIGNED = BigInteger.ONE.shiftLeft(64).subtract(BigInteger.ONE);
+
+	/**
+	 * Create a new CBOR writer.
+	 * @param out
+	 * the stream to write to.
+	 * @throws NullPointerException
+	 * if the given stream is null.
+	 */
+	public UCborWriter( final OutputStream out ) {
+		if (out==null) throw new NullPointerException("out");
+		this.out = out;
+	}
+
+	/**
+	 * The stream to which the CBOR is written.
+	 */
+	protected final OutputStream out;
+
+	/**
+	 * A buffer for the headers and numbers.
+	 */
+	private final byte[] buffer = new byte[9];
+
+	/**
+	 * Serializes the given value to CBOR.
+	 * @param value
+	 * the value to serialize.
+	 * @return
+	 * the CBOR bytes.
+	 */
+	public static byte[] toCbor( final Object value ) {
+		final ByteArrayOutputStream out = new ByteArrayOutputStream();
+		try {
+			new UCborWriter(out).value(value);
+		} catch (IOException e) {
+			// a byte array output stream does not throw
+			throw new IllegalStateException(e);
+		}
+		return out.toByteArray();
+	}
+
+	/**
+	 * Writes null.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 */
+	public UCborWriter nullValue() throws IOException {
+		out.write(0xf6);
+		return this;
+	}
+
+	/**
+	 * Writes a boolean.
+	 * @param value
+	 * the value.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 */
+	public UCborWriter value( final boolean value ) throws IOException {
+		out.write(value ? 0xf5 : 0xf4);
+		return this;
+	}
+
+	/**
+	 * Writes an integer.
+	 * @param value
+	 * the value.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 */
+	public UCborWriter value( final long value ) throws IOException {
+		// the negative value -1-n is written as n, which is ~value
+		if (value < 0) {
+			header(NEGATIVE, ~value);
+		} else {
+			header(UNSIGNED, value);
+		}
+		return this;
+	}
+
+	/**
+	 * Writes a floating point number, with 32 bits if that does not lose precision.
+	 * @param value
+	 * the value.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 */
+	public UCborWriter value( final double value ) throws IOException {
+		final float f = (float)value;
+		if (f==value || Double.isNaN(value)) {
+			final int bits = Float.floatToIntBits(f);
+			buffer[0] = (byte)0xfa;
+			for (int i=0; i < 4; i++) buffer[1+i] = (byte)(bits >>> (24 - 8*i));
+			out.write(buffer, 0, 5);
+		} else {
+			final long bits = Double.doubleToLongBits(value);
+			buffer[0] = (byte)0xfb;
+			for (int i=0; i < 8; i++) buffer[1+i] = (byte)(bits >>> (56 - 8*i));
+			out.write(buffer, 0, 9);
+		}
+		return this;
+	}
+
+	/**
+	 * Writes a text string.
+	 * @param value
+	 * the characters.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 */
+	public UCborWriter value( final CharSequence value ) throws IOException {
+		if (value==null) return nullValue();
+		final byte[] bytes = value.toString().getBytes(StandardCharsets.UTF_8);
+		header(TEXT, bytes.length);
+		out.write(bytes);
+		return this;
+	}
+
+	/**
+	 * Writes a byte string.
+	 * @param value
+	 * the bytes.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 */
+	public UCborWriter value( final byte[] value ) throws IOException {
+		if (value==null) return nullValue();
+		header(BYTES, value.length);
+		out.write(value);
+		return this;
+	}
+
+	/**
+	 * Writes the header of an array, the given amount of values must follow.
+	 * @param size
+	 * the amount of values.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 */
+	public UCborWriter beginArray( final int size ) throws IOException {
+		header(ARRAY, size);
+		return this;
+	}
+
+	/**
+	 * Writes the header of a map, the given amount of keys, each followed by its value, must follow.
+	 * @param size
+	 * the amount of entries.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 */
+	public UCborWriter beginMap( final int size ) throws IOException {
+		header(MAP, size);
+		return this;
+	}
+
+	/**
+	 * Writes an arbitrary value.
+	 * @param value
+	 * the value to write.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 * @throws IllegalArgumentException
+	 * if a map contains a null key.
+	 */
+	public UCborWriter value( final Object value ) throws IOException {
+		if (value==null) return nullValue();
+		if (value instanceof CharSequence) return value((CharSequence)value);
+		if (value instanceof Boolean) return value(((Boolean)value).booleanValue());
+		if (value instanceof Number) return number((Number)value);
+		if (value instanceof byte[]) return value((byte[])value);
+		if (value instanceof UMap) {
+			final Object[] keyValue = ((UMap<?,?>)value).getKeyValuePairs();
+			beginMap(keyValue.length / 2);
+			for (int i=0; i < keyValue.length;) {
+				value(keyValue[i++].toString());
+				value(keyValue[i++]);
+			}
+			return this;
+		}
+		if (value instanceof Map) {
+			final Map<?,?> map = (Map<?,?>)value;
+			beginMap(map.size());
+			for (final Map.Entry<?,?> entry : map.entrySet()) {
+				final Object key = entry.getKey();
+				if (key==null) throw new IllegalArgumentException("Maps with null keys can't be serialized");
+				value(key.toString());
+				value(entry.getValue());
+			}
+			return this;
+		}
+		if (value instanceof UList) {
+			final UList<?> list = (UList<?>)value;
+			final int size = list.size();
+			beginArray(size);
+			for (int i=0; i < size; i++) value(list.get(i));
+			return this;
+		}
+		if (value instanceof Collection) {
+			final Collection<?> collection = (Collection<?>)value;
+			beginArray(collection.size());
+			for (final Object v : collection) value(v);
+			return this;
+		}
+		if (value.getClass().isArray()) {
+			final int length = Array.getLength(value);
+			beginArray(length);
+			for (int i=0; i < length; i++) value(Array.get(value, i));
+			return this;
+		}
+		return value(value.toString());
+	}
+
+	/**
+	 * Writes a number.
+	 */
+	private UCborWriter number( final Number value ) throws IOException {
+		if (value instanceof Double || value instanceof Float) return value(value.doubleValue());
+		if (value instanceof BigInteger) return bigInteger((BigInteger)value);
+		if (value instanceof BigDecimal) {
+			// decimal fraction [exponent, mantissa]
+			final BigDecimal decimal = (BigDecimal)value;
+			header(TAG, 4);
+			beginArray(2);
+			value(-(long)decimal.scale());
+			return bigInteger(decimal.unscaledValue());
+		}
+		return value(value.longValue());
+	}
+
+	/**
+	 * Writes a big integer, as bignum if it does not fit into 64 bits.
+	 */
+	private UCborWriter bigInteger( final BigInteger value ) throws IOException {
+		final boolean negative = value.signum() < 0;
+		final BigInteger n = negative ? value.not() : value;
+		if (n.compareTo(MAX_UNSIGNED) <= 0) {
+			header(negative ? NEGATIVE : UNSIGNED, n.longValue());
+			return this;
+		}
+		header(TAG, negative ? 3 : 2);
+		byte[] bytes = n.toByteArray();
+		// strip the sign byte
+		if (bytes[0]==0) {
+			final byte[] stripped = new byte[bytes.length - 1];
+			System.arraycopy(bytes, 1, stripped, 0, stripped.length);
+			bytes = stripped;
+		}
+		return value(bytes);
+	}
+
+	/**
+	 * Writes the header of a data item with the given major type and argument, the argument is an unsigned 64 bit
+	 * integer.
+	 */
+	private void header( final int major, final long argument ) throws IOException {
+		final int type = major << 5;
+		if (argument >= 0 && argument < 24) {
+			out.write(type | (int)argument);
+			return;
+		}
+		final int length;
+		if (argument >= 0 && argument <= 0xffL) {
+			buffer[0] = (byte)(type | 24);
+			length = 1;
+		} else
+		if (argument >= 0 && argument <= 0xffffL) {
+			buffer[0] = (byte)(type | 25);
+			length = 2;
+		} else
+		if (argument >= 0 && argument <= 0xffffffffL) {
+			buffer[0] = (byte)(type | 26);
+			length = 4;
+		} else {
+			buffer[0] = (byte)(type | 27);
+			length = 8;
+		}
+		for (int i=0; i < length; i++) buffer[1+i] = (byte)(argument >>> (8*(length - 1 - i)));
+		out.write(buffer, 0, 1 + length);
+	}
+
+	@Override
+	public void flush() throws IOException {
+		out.flush();
+	}
+
+	@Override
+	public void close() throws IOException {
+		out.close();
+	}
+}
@@ -0,0 +1,32 @@
+package com.umpani.util.exception;
+
+/**
+ * Thrown by {@link com.umpani.util.bus.UBus#publish(String, java.util.Map)} if the queue of at least one subscriber
+ * with the policy {@link com.umpani.util.bus.UBusFullPolicy#ERROR} was full, all other subscribers received the
+ * message.
+ */
+@SuppressWarnings("serial")
+public class UBusFullException extends RuntimeException {
+	/**
+	 * Create a new exception.
+	 * @param topic
+	 * the topic of the message.
+	 * @param subscribers
+	 * the amount of subscribers that did not receive the message.
+	 */
+	public UBusFullException( final String topic, final int subscribers ) {
+		super("The queue of "+subscribers+" subscriber(s) of "+topic+" is full");
+		this.topic = topic;
+		this.subscribers = subscribers;
+	}
+
+	/**
+	 * The topic of the message.
+	 */
+	public final String topic;
+
+	/**
+	 * The amount of subscribers that did not receive the message.
+	 */
+	public final int subscribers;
+}
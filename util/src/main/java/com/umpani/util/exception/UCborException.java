@@ -0,0 +1,27 @@
+package com.umpani.util.exception;
+
+import java.io.IOException;
+
+/**
+ * An exception that is thrown by the CBOR reader if the input is not valid CBOR or if it exceeds one of the configured
+ * limits. The exception holds the offset within the input at which the error was detected.
+ */
+@SuppressWarnings("serial")
+public class UCborException extends IOException {
+	/**
+	 * Create a new CBOR exception.
+	 * @param message
+	 * the detail message.
+	 * @param offset
+	 * the offset of the byte at which the error was detected, starting with 0.
+	 */
+	public UCborException( final String message, final long offset ) {
+		super(message+" at offset "+offset);
+		this.offset = offset;
+	}
+
+	/**
+	 * The offset of the byte at which the error was detected, starting with 0.
+	 */
+	public final long offset;
+}
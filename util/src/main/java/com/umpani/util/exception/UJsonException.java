@@ -0,0 +1,43 @@
+package com.umpani.util.exception;
+
+import java.io.IOException;
+
+/**
+ * An exception that is thrown by the JSON parsers if the input is not valid JSON or if it exceeds one of the
+ * configured limits. The exception holds the position within the input at which the error was detected.
+ */
+@SuppressWarnings("serial")
+public class UJsonException extends IOException {
+	/**
+	 * Create a new JSON exception.
+	 * @param message
+	 * the detail message.
+	 * @param offset
+	 * the offset of the character at which the error was detected, starting with 0.
+	 * @param line
+	 * the line at which the error was detected, starting with 1.
+	 * @param column
+	 * the column at which the error was detected, starting with 1.
+	 */
+	public UJsonException( final String message, final long offset, final long line, final long column ) {
+		super(message+" at line "+line+", column "+column+" (offset "+offset+")");
+		this.offset = offset;
+		this.line = line;
+		this.column = column;
+	}
+
+	/**
+	 * The offset of the character at which the error was detected, starting with 0.
+	 */
+	public final long offset;
+
+	/**
+	 * The line at which the error was detected, starting with 1.
+	 */
+	public final long line;
+
+	/**
+	 * The column at which the error was detected, starting with 1.
+	 */
+	public final long column;
+}
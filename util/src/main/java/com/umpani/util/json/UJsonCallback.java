@@ -0,0 +1,20 @@
+package com.umpani.util.json;
+
+import java.io.IOException;
+
+/**
+ * The receiver of the top level values completed by an {@link UJsonPushParser}.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface UJsonCallback {
+	/**
+	 * Called for each completed top level value.
+	 * @param value
+	 * the value, a {@link com.umpani.util.UMap}, {@link com.umpani.util.UList}, {@link String}, {@link Number},
+	 * {@link Boolean} or null.
+	 * @throws IOException
+	 * if processing the value failed, the exception is thrown by the method that fed the parser.
+	 */
+	public void value( final Object value ) throws IOException;
+}
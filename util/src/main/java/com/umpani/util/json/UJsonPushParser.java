@@ -0,0 +1,832 @@
+package com.umpani.util.json;
+
+import java.io.IOException;
+import java.nio.ByteBuffer;
+
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+import com.umpani.util.exception.UJsonException;
+
+/**
+ * A non-blocking JSON parser that is fed with chunks of UTF-8 encoded bytes, for example as they arrive at a socket,
+ * and hands every completed top level value to an {@link UJsonCallback}. Tokens and multi-byte UTF-8 sequences may be
+ * split at any byte between two chunks, the parser keeps the partial state. Like the {@link UJsonReader} the parser
+ * accepts multiple top level values in a row, separated by whitespace, and produces the same values.
+ *
+ * </p><p>The parser enforces the same limits as the {@link UJsonReader} and reports errors at the same positions,
+ * counted in characters. Unlike the reader, which replaces malformed UTF-8 sequences, the parser rejects them. After
+ * an error, the parser must be {@link #reset()} before it can be fed again.
+ *
+ * </p><p>Apart from the parsed values the parser allocates nothing while parsing, the internal buffers are reused.
+ * A top level number is only complete when the character following it was seen, therefore {@link #finish()} must be
+ * called at the end of the input.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UJsonPushParser {
+	/**
+	 * A value is expected, at the top level or after a colon or a comma in an array.
+	 */
+	private static final int S_VALUE = 0;
+
+	/**
+	 * An array was opened, a value or the end of the array is expected.
+	 */
+	private static final int S_ARRAY_FIRST = 1;
+
+	/**
+	 * An object was opened, a key or the end of the object is expected.
+	 */
+	private static final int S_OBJECT_FIRST = 2;
+
+	/**
+	 * A key is expected after a comma in an object.
+	 */
+	private static final int S_KEY = 3;
+
+	/**
+	 * A colon is expected after a key.
+	 */
+	private static final int S_COLON = 4;
+
+	/**
+	 * A value within a container was completed, a comma or the end of the container is expected.
+	 */
+	private static final int S_AFTER_VALUE = 5;
+
+	/**
+	 * Within a string.
+	 */
+	private static final int S_STRING = 6;
+
+	/**
+	 * Within a string after a backslash.
+	 */
+	private static final int S_ESCAPE = 7;
+
+	/**
+	 * Within a unicode escape sequence.
+	 */
+	private static final int S_UNICODE = 8;
+
+	/**
+	 * Within a literal.
+	 */
+	private static final int S_LITERAL = 9;
+
+	/**
+	 * Within a number.
+	 */
+	private static final int S_NUMBER = 10;
+
+	/**
+	 * After the minus sign of a number.
+	 */
+	private static final int N_MINUS = 0;
+
+	/**
+	 * After a leading zero.
+	 */
+	private static final int N_ZERO = 1;
+
+	/**
+	 * Within the integer digits.
+	 */
+	private static final int N_INT = 2;
+
+	/**
+	 * After the decimal point.
+	 */
+	private static final int N_DOT = 3;
+
+	/**
+	 * Within the fraction digits.
+	 */
+	private static final int N_FRAC = 4;
+
+	/**
+	 * After the exponent character.
+	 */
+	private static final int N_EXP = 5;
+
+	/**
+	 * After the sign of the exponent.
+	 */
+	private static final int N_EXP_SIGN = 6;
+
+	/**
+	 * Within the exponent digits.
+	 */
+	private static final int N_EXP_DIGITS = 7;
+
+	/**
+	 * The maximal amount of integer digits that are converted without creating a string.
+	 */
+	private static final int MAX_FAST_DIGITS = 18;
+
+	/**
+	 * Create a new push parser.
+	 * @param callback
+	 * the callback that receives the completed top level values.
+	 * @throws NullPointerException
+	 * if the given callback is null.
+	 */
+	public UJsonPushParser( final UJsonCallback callback ) {
+		if (callback==null) throw new NullPointerException("callback");
+		this.callback = callback;
+	}
+
+	/**
+	 * The callback that receives the completed top level values.
+	 */
+	protected final UJsonCallback callback;
+
+	/**
+	 * The maximal nesting depth.
+	 */
+	private int maxDepth = UJsonReader.DEFAULT_MAX_DEPTH;
+
+	/**
+	 * The maximal length of strings and numbers.
+	 */
+	private int maxStringLength = UJsonReader.DEFAULT_MAX_STRING_LENGTH;
+
+	/**
+	 * The current state.
+	 */
+	private int state = S_VALUE;
+
+	/**
+	 * The containers that are currently open.
+	 */
+	private Object[] containers = new Object[16];
+
+	/**
+	 * The current key per open object.
+	 */
+	private String[] keys = new String[16];
+
+	/**
+	 * The current nesting depth.
+	 */
+	private int depth;
+
+	/**
+	 * A string builder reused for strings and numbers.
+	 */
+	private final StringBuilder sb = new StringBuilder();
+
+	/**
+	 * True if the current string is a key.
+	 */
+	private boolean isKey;
+
+	/**
+	 * The code and the amount of digits of the current unicode escape sequence.
+	 */
+	private int unicode, unicodeDigits;
+
+	/**
+	 * The current literal and the amount of characters matched.
+	 */
+	private String literal;
+	private int literalIndex;
+
+	/**
+	 * The state within the current number.
+	 */
+	private int numberState;
+
+	/**
+	 * The value of the integer digits of the current number and their amount.
+	 */
+	private long numberValue;
+	private int numberDigits;
+
+	/**
+	 * True if the current number is negative, has neither a fraction nor an exponent.
+	 */
+	private boolean negative, integer;
+
+	/**
+	 * The code point of the partial UTF-8 sequence, the amount of missing bytes and the minimal code point.
+	 */
+	private int utf8, utf8Missing, utf8Min;
+
+	/**
+	 * The amount of characters consumed so far.
+	 */
+	private long offset;
+
+	/**
+	 * The line of the last consumed character, starting with 1.
+	 */
+	private long line = 1;
+
+	/**
+	 * The column of the last consumed character, starting with 1.
+	 */
+	private long column;
+
+	/**
+	 * True if the last consumed character was a line-feed.
+	 */
+	private boolean newLine;
+
+	/**
+	 * The error, after the parser failed.
+	 */
+	private UJsonException failure;
+
+	/**
+	 * Sets the maximal nesting depth of objects and arrays.
+	 * @param maxDepth
+	 * the maximal nesting depth.
+	 * @return
+	 * this.
+	 */
+	public final UJsonPushParser setMaxDepth( final int maxDepth ) {
+		this.maxDepth = maxDepth;
+		return this;
+	}
+
+	/**
+	 * Sets the maximal length of strings and numbers in characters.
+	 * @param maxStringLength
+	 * the maximal length.
+	 * @return
+	 * this.
+	 */
+	public final UJsonPushParser setMaxStringLength( final int maxStringLength ) {
+		this.maxStringLength = maxStringLength;
+		return this;
+	}
+
+	/**
+	 * Returns the amount of characters consumed so far.
+	 * @return
+	 * the amount of characters consumed so far.
+	 */
+	public final long getOffset() {
+		return offset;
+	}
+
+	/**
+	 * Returns true if the parser is between two top level values, so no partial value is pending.
+	 * @return
+	 * true if no partial value is pending.
+	 */
+	public final boolean isIdle() {
+		return state==S_VALUE && depth==0 && utf8Missing==0;
+	}
+
+	/**
+	 * Resets the parser into its initial state, discarding any partial value and error.
+	 */
+	public void reset() {
+		for (int i=0; i < depth; i++) {
+			containers[i] = null;
+			keys[i] = null;
+		}
+		state = S_VALUE;
+		depth = 0;
+		sb.setLength(0);
+		literal = null;
+		utf8Missing = 0;
+		offset = 0L;
+		line = 1L;
+		column = 0L;
+		newLine = false;
+		failure = null;
+	}
+
+	/**
+	 * Feeds the remaining bytes of the given buffer to the parser, the position of the buffer is advanced. Each
+	 * completed top level value is handed to the callback before this method returns.
+	 * @param buffer
+	 * the buffer with UTF-8 encoded JSON.
+	 * @throws UJsonException
+	 * if the input is no valid JSON.
+	 * @throws IOException
+	 * if the callback failed.
+	 */
+	public void feed( final ByteBuffer buffer ) throws IOException {
+		if (failure!=null) throw failure;
+		try {
+			while (buffer.hasRemaining()) decode(buffer.get());
+		} catch (UJsonException e) {
+			failure = e;
+			throw e;
+		}
+	}
+
+	/**
+	 * Feeds the given bytes to the parser.
+	 * @param bytes
+	 * the array with UTF-8 encoded JSON.
+	 * @param off
+	 * the offset of the first byte.
+	 * @param len
+	 * the amount of bytes.
+	 * @throws UJsonException
+	 * if the input is no valid JSON.
+	 * @throws IOException
+	 * if the callback failed.
+	 */
+	public void feed( final byte[] bytes, final int off, final int len ) throws IOException {
+		if (failure!=null) throw failure;
+		try {
+			final int end = off + len;
+			for (int i=off; i < end; i++) decode(bytes[i]);
+		} catch (UJsonException e) {
+			failure = e;
+			throw e;
+		}
+	}
+
+	/**
+	 * Signals the end of the input, completes a pending top level number.
+	 * @throws UJsonException
+	 * if a value is incomplete.
+	 * @throws IOException
+	 * if the callback failed.
+	 */
+	public void finish() throws IOException {
+		if (failure!=null) throw failure;
+		try {
+			if (utf8Missing > 0) throw endOfInput();
+			if (state==S_NUMBER) {
+				switch (numberState) {
+					case N_MINUS:
+						throw endOfInput();
+					case N_DOT: case N_EXP: case N_EXP_SIGN:
+						throw error("Invalid number, digit expected");
+					default:
+						completeNumber();
+				}
+			}
+			if (state!=S_VALUE || depth > 0) throw endOfInput();
+		} catch (UJsonException e) {
+			failure = e;
+			throw e;
+		}
+	}
+
+	/**
+	 * Creates an exception for an error at the last consumed character.
+	 */
+	private final UJsonException error( final String message ) {
+		return new UJsonException(message, offset > 0 ? offset-1 : 0, line, column > 0 ? column : 1);
+	}
+
+	/**
+	 * Creates an exception for an error at the character before the last consumed one, which must be on the same
+	 * line. The blocking parser detects some errors before it consumes the offending character.
+	 */
+	private final UJsonException errorBefore( final String message ) {
+		return new UJsonException(message, offset > 1 ? offset-2 : 0, line, column > 1 ? column-1 : 1);
+	}
+
+	/**
+	 * Creates an exception for an unexpected end of the input.
+	 */
+	private final UJsonException endOfInput() {
+		return new UJsonException("Unexpected end of input", offset, newLine ? line+1 : line, newLine ? 1 : column+1);
+	}
+
+	/**
+	 * Decodes the next byte of the UTF-8 input.
+	 */
+	private final void decode( final byte b ) throws IOException {
+		if (utf8Missing==0) {
+			if (b >= 0) {
+				consume((char)b);
+				return;
+			}
+			final int u = b & 0xff;
+			if (u >= 0xc2 && u <= 0xdf) {
+				utf8 = u & 0x1f;
+				utf8Missing = 1;
+				utf8Min = 0x80;
+			} else
+			if (u >= 0xe0 && u <= 0xef) {
+				utf8 = u & 0x0f;
+				utf8Missing = 2;
+				utf8Min = 0x800;
+			} else
+			if (u >= 0xf0 && u <= 0xf4) {
+				utf8 = u & 0x07;
+				utf8Missing = 3;
+				utf8Min = 0x10000;
+			} else {
+				throw invalidUtf8();
+			}
+			return;
+		}
+		if ((b & 0xc0)!=0x80) throw invalidUtf8();
+		utf8 = (utf8 << 6) | (b & 0x3f);
+		if (--utf8Missing > 0) return;
+		final int code = utf8;
+		if (code < utf8Min || code > 0x10ffff || (code >= 0xd800 && code <= 0xdfff)) throw invalidUtf8();
+		if (code < 0x10000) {
+			consume((char)code);
+		} else {
+			consume(Character.highSurrogate(code));
+			consume(Character.lowSurrogate(code));
+		}
+	}
+
+	/**
+	 * Creates the exception for a malformed UTF-8 sequence, which counts as one character.
+	 */
+	private final UJsonException invalidUtf8() {
+		utf8Missing = 0;
+		advance('\ufffd');
+		return error("Invalid UTF-8 sequence");
+	}
+
+	/**
+	 * Updates the position for the given consumed character.
+	 */
+	private final void advance( final char c ) {
+		offset++;
+		if (newLine) {
+			line++;
+			column = 1;
+		} else {
+			column++;
+		}
+		newLine = c=='\n';
+	}
+
+	/**
+	 * Consumes the next character.
+	 */
+	private final void consume( final char c ) throws IOException {
+		advance(c);
+		process(c);
+	}
+
+	/**
+	 * Returns true if the given character is JSON whitespace.
+	 */
+	private static final boolean isWhitespace( final char c ) {
+		return c==' ' || c=='\t' || c=='\n' || c=='\r';
+	}
+
+	/**
+	 * Processes the given character in the current state, the position was already updated.
+	 */
+	private final void process( final char c ) throws IOException {
+		switch (state) {
+			case S_VALUE:
+				if (!isWhitespace(c)) startValue(c);
+				return;
+			case S_ARRAY_FIRST:
+				if (isWhitespace(c)) return;
+				if (c==']') {
+					close();
+				} else {
+					startValue(c);
+				}
+				return;
+			case S_OBJECT_FIRST:
+				if (isWhitespace(c)) return;
+				if (c=='}') {
+					close();
+					return;
+				}
+				startKey(c);
+				return;
+			case S_KEY:
+				if (!isWhitespace(c)) startKey(c);
+				return;
+			case S_COLON:
+				if (isWhitespace(c)) return;
+				if (c!=':') throw error("Expected ':' after key");
+				state = S_VALUE;
+				return;
+			case S_AFTER_VALUE:
+				if (isWhitespace(c)) return;
+				if (containers[depth-1] instanceof UMap) {
+					if (c=='}') {
+						close();
+					} else
+					if (c==',') {
+						state = S_KEY;
+					} else {
+						throw error("Expected ',' or '}'");
+					}
+				} else {
+					if (c==']') {
+						close();
+					} else
+					if (c==',') {
+						state = S_VALUE;
+					} else {
+						throw error("Expected ',' or ']'");
+					}
+				}
+				return;
+			case S_STRING:
+				if (c=='"') {
+					endString();
+					return;
+				}
+				if (c < 0x20) throw error("Unescaped control character in string");
+				if (c=='\\') {
+					state = S_ESCAPE;
+					return;
+				}
+				appendToString(c);
+				return;
+			case S_ESCAPE:
+				switch (c) {
+					case '"': case '\\': case '/': appendToString(c); break;
+					case 'b': appendToString('\b'); break;
+					case 'f': appendToString('\f'); break;
+					case 'n': appendToString('\n'); break;
+					case 'r': appendToString('\r'); break;
+					case 't': appendToString('\t'); break;
+					case 'u':
+						unicode = 0;
+						unicodeDigits = 0;
+						state = S_UNICODE;
+						return;
+					default:
+						throw error("Invalid escape sequence");
+				}
+				state = S_STRING;
+				return;
+			case S_UNICODE:
+				final int digit = Character.digit(c, 16);
+				if (digit < 0) throw error("Invalid unicode escape sequence");
+				unicode = (unicode << 4) | digit;
+				if (++unicodeDigits==4) {
+					state = S_STRING;
+					appendToString((char)unicode);
+				}
+				return;
+			case S_LITERAL:
+				if (c!=literal.charAt(literalIndex)) throw error("Invalid literal, expected '"+literal+"'");
+				if (++literalIndex==literal.length()) {
+					final char first = literal.charAt(0);
+					literal = null;
+					value(first=='t' ? Boolean.TRUE : (first=='f' ? Boolean.FALSE : null));
+				}
+				return;
+			case S_NUMBER:
+				processNumber(c);
+				return;
+			default:
+				throw new IllegalStateException("Invalid state "+state);
+		}
+	}
+
+	/**
+	 * Starts a new value with the given character.
+	 */
+	private final void startValue( final char c ) throws IOException {
+		switch (c) {
+			case '{':
+				open(new UMap<String,Object>());
+				state = S_OBJECT_FIRST;
+				return;
+			case '[':
+				open(new UList<Object>());
+				state = S_ARRAY_FIRST;
+				return;
+			case '"':
+				isKey = false;
+				sb.setLength(0);
+				state = S_STRING;
+				return;
+			case 't':
+				startLiteral("true");
+				return;
+			case 'f':
+				startLiteral("false");
+				return;
+			case 'n':
+				startLiteral("null");
+				return;
+			default:
+				if (c=='-' || (c >= '0' && c <= '9')) {
+					startNumber(c);
+					return;
+				}
+				throw error("Unexpected character '"+c+"'");
+		}
+	}
+
+	/**
+	 * Starts a key with the given character.
+	 */
+	private final void startKey( final char c ) throws UJsonException {
+		if (c!='"') throw error("Expected a string as key");
+		isKey = true;
+		sb.setLength(0);
+		state = S_STRING;
+	}
+
+	/**
+	 * Starts the given literal, whose first character was consumed.
+	 */
+	private final void startLiteral( final String literal ) {
+		this.literal = literal;
+		literalIndex = 1;
+		state = S_LITERAL;
+	}
+
+	/**
+	 * Appends a character to the current string and checks the length.
+	 */
+	private final void appendToString( final char c ) throws UJsonException {
+		if (sb.length() >= maxStringLength) throw error("Maximal string length of "+maxStringLength+" exceeded");
+		sb.append(c);
+	}
+
+	/**
+	 * Completes the current string.
+	 */
+	private final void endString() throws IOException {
+		final String s = sb.toString();
+		if (isKey) {
+			keys[depth-1] = s;
+			state = S_COLON;
+		} else {
+			value(s);
+		}
+	}
+
+	/**
+	 * Opens a new container.
+	 */
+	private final void open( final Object container ) throws UJsonException {
+		if (depth+1 > maxDepth) throw error("Maximal nesting depth of "+maxDepth+" exceeded");
+		if (depth==containers.length) {
+			final int length = Math.min(Math.max(depth+1, maxDepth), depth*2);
+			final Object[] containers = new Object[length];
+			System.arraycopy(this.containers, 0, containers, 0, depth);
+			this.containers = containers;
+			final String[] keys = new String[length];
+			System.arraycopy(this.keys, 0, keys, 0, depth);
+			this.keys = keys;
+		}
+		containers[depth++] = container;
+	}
+
+	/**
+	 * Closes the current container and completes it as value.
+	 */
+	private final void close() throws IOException {
+		final Object container = containers[--depth];
+		containers[depth] = null;
+		keys[depth] = null;
+		value(container);
+	}
+
+	/**
+	 * Completes a value, either at the top level or within the current container.
+	 */
+	@SuppressWarnings("unchecked")
+	private final void value( final Object value ) throws IOException {
+		if (depth==0) {
+			state = S_VALUE;
+			callback.value(value);
+			return;
+		}
+		final Object container = containers[depth-1];
+		if (container instanceof UMap) {
+			((UMap<String,Object>)container).put(keys[depth-1], value);
+		} else {
+			((UList<Object>)container).add(value);
+		}
+		state = S_AFTER_VALUE;
+	}
+
+	/**
+	 * Starts a number with the given character.
+	 */
+	private final void startNumber( final char c ) throws UJsonException {
+		sb.setLength(0);
+		numberValue = 0L;
+		numberDigits = 0;
+		integer = true;
+		negative = c=='-';
+		state = S_NUMBER;
+		if (negative) {
+			sb.append(c);
+			numberState = N_MINUS;
+		} else
+		if (c=='0') {
+			sb.append(c);
+			numberState = N_ZERO;
+		} else {
+			numberState = N_INT;
+			appendDigit(c);
+		}
+	}
+
+	/**
+	 * Appends a digit of the current number and checks the length.
+	 */
+	private final void appendDigit( final char c ) throws UJsonException {
+		// the blocking parser detects this before consuming the digit
+		if (sb.length() >= maxStringLength) throw errorBefore("Maximal number length of "+maxStringLength+" exceeded");
+		sb.append(c);
+		if (integer && numberDigits < MAX_FAST_DIGITS) numberValue = numberValue*10 + (c - '0');
+		numberDigits++;
+	}
+
+	/**
+	 * Processes the next character of the current number.
+	 */
+	private final void processNumber( final char c ) throws IOException {
+		final boolean isDigit = c >= '0' && c <= '9';
+		switch (numberState) {
+			case N_MINUS:
+				if (c=='0') {
+					sb.append(c);
+					numberState = N_ZERO;
+					return;
+				}
+				if (!isDigit) throw error("Invalid number");
+				numberState = N_INT;
+				appendDigit(c);
+				return;
+			case N_INT:
+				if (isDigit) {
+					appendDigit(c);
+					return;
+				}
+				// fall through, the integer part is complete
+			case N_ZERO:
+				if (c=='.') {
+					integer = false;
+					sb.append(c);
+					numberState = N_DOT;
+					return;
+				}
+				if (c=='e' || c=='E') {
+					integer = false;
+					sb.append(c);
+					numberState = N_EXP;
+					return;
+				}
+				break;
+			case N_DOT:
+				if (!isDigit) throw error("Invalid number, digit expected");
+				numberState = N_FRAC;
+				appendDigit(c);
+				return;
+			case N_FRAC:
+				if (isDigit) {
+					appendDigit(c);
+					return;
+				}
+				if (c=='e' || c=='E') {
+					sb.append(c);
+					numberState = N_EXP;
+					return;
+				}
+				break;
+			case N_EXP:
+				if (c=='+' || c=='-') {
+					sb.append(c);
+					numberState = N_EXP_SIGN;
+					return;
+				}
+				// fall through, a digit is expected
+			case N_EXP_SIGN:
+				if (!isDigit) throw error("Invalid number, digit expected");
+				numberState = N_EXP_DIGITS;
+				appendDigit(c);
+				return;
+			case N_EXP_DIGITS:
+				if (isDigit) {
+					appendDigit(c);
+					return;
+				}
+				break;
+			default:
+				throw new IllegalStateException("Invalid number state "+numberState);
+		}
+		// the character terminates the number and belongs to the next token
+		completeNumber();
+		process(c);
+	}
+
+	/**
+	 * Completes the current number.
+	 */
+	private final void completeNumber() throws IOException {
+		final Number number;
+		if (integer && numberDigits <= MAX_FAST_DIGITS) {
+			number = Long.valueOf(negative ? -numberValue : numberValue);
+		} else {
+			number = UJsonReader.toNumber(sb, integer);
+		}
+		value(number);
+	}
+}
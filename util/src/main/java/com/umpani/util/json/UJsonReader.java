@@ -0,0 +1,524 @@
+package com.umpani.util.json;
+
+import java.io.Closeable;
+import java.io.IOException;
+import java.io.InputStream;
+import java.io.InputStreamReader;
+import java.io.Reader;
+import java.io.StringReader;
+import java.math.BigInteger;
+import java.nio.charset.StandardCharsets;
+
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+import com.umpani.util.exception.UJsonException;
+
+/**
+ * A blocking JSON parser that reads JSON values from a {@link Reader} and converts them into {@link UMap},
+ * {@link UList}, {@link String}, {@link Long}, {@link BigInteger}, {@link Double}, {@link Boolean} or null. The
+ * reader supports multiple top level values in a row, separated by whitespace, as used for example by newline
+ * delimited JSON (NDJSON), use {@link #hasNext()} and {@link #next()} to read them one by one.
+ *
+ * </p><p>The parser enforces limits for the nesting depth and for the length of strings and numbers so that a
+ * malicious input can't exhaust the stack or the memory. All errors are reported as {@link UJsonException} that
+ * holds the position of the character at which the error was detected.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UJsonReader implements Closeable {
+	/**
+	 * The default maximal nesting depth of objects and arrays.
+	 */
+	public static final int DEFAULT_MAX_DEPTH = 512;
+
+	/**
+	 * The default maximal length of strings and numbers in characters.
+	 */
+	public static final int DEFAULT_MAX_STRING_LENGTH = 16*1024*1024;
+
+	/**
+	 * Create a new JSON reader.
+	 * @param in
+	 * the reader from which to read the JSON.
+	 * @throws NullPointerException
+	 * if the given reader is null.
+	 */
+	public UJsonReader( final Reader in ) {
+		if (in==null) throw new NullPointerException("in");
+		this.in = in;
+	}
+
+	/**
+	 * Create a new JSON reader that reads UTF-8 encoded JSON from the given stream.
+	 * @param in
+	 * the stream from which to read the JSON.
+	 * @throws NullPointerException
+	 * if the given stream is null.
+	 */
+	public UJsonReader( final InputStream in ) {
+		this(new InputStreamReader(in, StandardCharsets.UTF_8));
+	}
+
+	/**
+	 * The reader from which to read.
+	 */
+	protected final Reader in;
+
+	/**
+	 * The read buffer.
+	 */
+	private final char[] buffer = new char[8192];
+
+	/**
+	 * The position of the next character to read from the buffer.
+	 */
+	private int pos;
+
+	/**
+	 * The amount of valid characters in the buffer.
+	 */
+	private int limit;
+
+	/**
+	 * The amount of characters consumed so far.
+	 */
+	private long offset;
+
+	/**
+	 * The line of the last consumed character, starting with 1.
+	 */
+	private long line = 1;
+
+	/**
+	 * The column of the last consumed character, starting with 1.
+	 */
+	private long column;
+
+	/**
+	 * True if the last consumed character was a line-feed.
+	 */
+	private boolean newLine;
+
+	/**
+	 * The current nesting depth.
+	 */
+	private int depth;
+
+	/**
+	 * The maximal nesting depth.
+	 */
+	private int maxDepth = DEFAULT_MAX_DEPTH;
+
+	/**
+	 * The maximal length of strings and numbers.
+	 */
+	private int maxStringLength = DEFAULT_MAX_STRING_LENGTH;
+
+	/**
+	 * A string builder reused to parse strings and numbers.
+	 */
+	private final StringBuilder sb = new StringBuilder();
+
+	/**
+	 * Parses the given JSON string that must contain exactly one value.
+	 * @param json
+	 * the JSON string.
+	 * @return
+	 * the parsed value.
+	 * @throws UJsonException
+	 * if the given string is no valid JSON.
+	 */
+	public static Object parse( final CharSequence json ) throws UJsonException {
+		final UJsonReader reader = new UJsonReader(new StringReader(json.toString()));
+		try {
+			final Object value = reader.next();
+			if (reader.hasNext()) throw reader.error("Unexpected character after value");
+			return value;
+		} catch (UJsonException e) {
+			throw e;
+		} catch (IOException e) {
+			// a StringReader never throws an IOException
+			throw new IllegalStateException(e);
+		}
+	}
+
+	/**
+	 * Sets the maximal nesting depth of objects and arrays.
+	 * @param maxDepth
+	 * the maximal nesting depth.
+	 * @return
+	 * this.
+	 */
+	public final UJsonReader setMaxDepth( final int maxDepth ) {
+		this.maxDepth = maxDepth;
+		return this;
+	}
+
+	/**
+	 * Sets the maximal length of strings and numbers in characters.
+	 * @param maxStringLength
+	 * the maximal length.
+	 * @return
+	 * this.
+	 */
+	public final UJsonReader setMaxStringLength( final int maxStringLength ) {
+		this.maxStringLength = maxStringLength;
+		return this;
+	}
+
+	/**
+	 * Returns the amount of characters consumed so far.
+	 * @return
+	 * the amount of characters consumed so far.
+	 */
+	public final long getOffset() {
+		return offset;
+	}
+
+	/**
+	 * Skips whitespace and returns true if there is another value to read.
+	 * @return
+	 * true if there is another value; false if the end of the input was reached.
+	 * @throws IOException
+	 * if reading failed.
+	 */
+	public boolean hasNext() throws IOException {
+		skipWhitespace();
+		return peek() >= 0;
+	}
+
+	/**
+	 * Reads the next top level value.
+	 * @return
+	 * the value.
+	 * @throws UJsonException
+	 * if the input is no valid JSON or the end of the input was reached.
+	 * @throws IOException
+	 * if reading failed.
+	 */
+	public Object next() throws IOException {
+		skipWhitespace();
+		if (peek() < 0) throw endOfInput();
+		return readValue();
+	}
+
+	/**
+	 * Creates an exception for an error at the last consumed character.
+	 * @param message
+	 * the error message.
+	 * @return
+	 * the exception.
+	 */
+	protected final UJsonException error( final String message ) {
+		return new UJsonException(message, offset > 0 ? offset-1 : 0, line, column > 0 ? column : 1);
+	}
+
+	/**
+	 * Creates an exception for an unexpected end of the input.
+	 * @return
+	 * the exception.
+	 */
+	protected final UJsonException endOfInput() {
+		return new UJsonException("Unexpected end of input", offset, newLine ? line+1 : line, newLine ? 1 : column+1);
+	}
+
+	/**
+	 * Fills the buffer.
+	 * @return
+	 * true if characters are available; false if the end of the input was reached.
+	 * @throws IOException
+	 * if reading failed.
+	 */
+	private final boolean fill() throws IOException {
+		int read;
+		do {
+			read = in.read(buffer, 0, buffer.length);
+		} while (read==0);
+		if (read < 0) {
+			pos = limit = 0;
+			return false;
+		}
+		pos = 0;
+		limit = read;
+		return true;
+	}
+
+	/**
+	 * Returns the next character without consuming it.
+	 * @return
+	 * the next character or -1 if the end of the input was reached.
+	 * @throws IOException
+	 * if reading failed.
+	 */
+	private final int peek() throws IOException {
+		if (pos==limit && !fill()) return -1;
+		return buffer[pos];
+	}
+
+	/**
+	 * Consumes the next character.
+	 * @return
+	 * the next character.
+	 * @throws UJsonException
+	 * if the end of the input was reached.
+	 * @throws IOException
+	 * if reading failed.
+	 */
+	private final char read() throws IOException {
+		if (pos==limit && !fill()) throw endOfInput();
+		final char c = buffer[pos++];
+		offset++;
+		if (newLine) {
+			line++;
+			column = 1;
+		} else {
+			column++;
+		}
+		newLine = c=='\n';
+		return c;
+	}
+
+	/**
+	 * Skips all whitespace.
+	 * @throws IOException
+	 * if reading failed.
+	 */
+	private final void skipWhitespace() throws IOException {
+		for (int c=peek(); c==' ' || c=='\t' || c=='\n' || c=='\r'; c=peek()) read();
+	}
+
+	/**
+	 * Reads the next value, the caller must have skipped whitespace.
+	 * @return
+	 * the value.
+	 * @throws IOException
+	 * if reading failed or the input is invalid.
+	 */
+	private final Object readValue() throws IOException {
+		final int c = peek();
+		switch (c) {
+			case '{':
+				read();
+				return readObject();
+			case '[':
+				read();
+				return readArray();
+			case '"':
+				read();
+				return readString();
+			case 't':
+				readLiteral("true");
+				return Boolean.TRUE;
+			case 'f':
+				readLiteral("false");
+				return Boolean.FALSE;
+			case 'n':
+				readLiteral("null");
+				return null;
+			default:
+				if (c=='-' || (c >= '0' && c <= '9')) return readNumber();
+				if (c < 0) throw endOfInput();
+				read();
+				throw error("Unexpected character '"+(char)c+"'");
+		}
+	}
+
+	/**
+	 * Reads an object, the opening brace was consumed.
+	 * @return
+	 * the object.
+	 * @throws IOException
+	 * if reading failed or the input is invalid.
+	 */
+	private final UMap<String,Object> readObject() throws IOException {
+		if (++depth > maxDepth) throw error("Maximal nesting depth of "+maxDepth+" exceeded");
+		final UMap<String,Object> map = new UMap<String,Object>();
+		skipWhitespace();
+		if (peek()=='}') {
+			read();
+			depth--;
+			return map;
+		}
+		while (true) {
+			skipWhitespace();
+			if (read()!='"') throw error("Expected a string as key");
+			final String key = readString();
+			skipWhitespace();
+			if (read()!=':') throw error("Expected ':' after key");
+			skipWhitespace();
+			map.put(key, readValue());
+			skipWhitespace();
+			final char c = read();
+			if (c=='}') break;
+			if (c!=',') throw error("Expected ',' or '}'");
+		}
+		depth--;
+		return map;
+	}
+
+	/**
+	 * Reads an array, the opening bracket was consumed.
+	 * @return
+	 * the array.
+	 * @throws IOException
+	 * if reading failed or the input is invalid.
+	 */
+	private final UList<Object> readArray() throws IOException {
+		if (++depth > maxDepth) throw error("Maximal nesting depth of "+maxDepth+" exceeded");
+		final UList<Object> list = new UList<Object>();
+		skipWhitespace();
+		if (peek()==']') {
+			read();
+			depth--;
+			return list;
+		}
+		while (true) {
+			skipWhitespace();
+			list.add(readValue());
+			skipWhitespace();
+			final char c = read();
+			if (c==']') break;
+			if (c!=',') throw error("Expected ',' or ']'");
+		}
+		depth--;
+		return list;
+	}
+
+	/**
+	 * Reads a string, the opening quote was consumed.
+	 * @return
+	 * the string.
+	 * @throws IOException
+	 * if reading failed or the input is invalid.
+	 */
+	private final String readString() throws IOException {
+		final StringBuilder sb = this.sb;
+		final int maxStringLength = this.maxStringLength;
+		sb.setLength(0);
+		while (true) {
+			char c = read();
+			if (c=='"') break;
+			if (c < 0x20) throw error("Unescaped control character in string");
+			if (c=='\\') {
+				c = read();
+				switch (c) {
+					case '"': case '\\': case '/': break;
+					case 'b': c = '\b'; break;
+					case 'f': c = '\f'; break;
+					case 'n': c = '\n'; break;
+					case 'r': c = '\r'; break;
+					case 't': c = '\t'; break;
+					case 'u':
+						int code = 0;
+						for (int i=0; i < 4; i++) {
+							final int digit = Character.digit(read(), 16);
+							if (digit < 0) throw error("Invalid unicode escape sequence");
+							code = (code<<4) | digit;
+						}
+						c = (char)code;
+						break;
+					default:
+						throw error("Invalid escape sequence");
+				}
+			}
+			if (sb.length() >= maxStringLength) throw error("Maximal string length of "+maxStringLength+" exceeded");
+			sb.append(c);
+		}
+		return sb.toString();
+	}
+
+	/**
+	 * Reads the given literal.
+	 * @param literal
+	 * the literal to read.
+	 * @throws IOException
+	 * if reading failed or the input does not match the literal.
+	 */
+	private final void readLiteral( final String literal ) throws IOException {
+		for (int i=0; i < literal.length(); i++) {
+			if (read()!=literal.charAt(i)) throw error("Invalid literal, expected '"+literal+"'");
+		}
+	}
+
+	/**
+	 * Reads a number.
+	 * @return
+	 * the number as {@link Long}, {@link BigInteger} or {@link Double}.
+	 * @throws IOException
+	 * if reading failed or the input is invalid.
+	 */
+	private final Number readNumber() throws IOException {
+		final StringBuilder sb = this.sb;
+		sb.setLength(0);
+		boolean integer = true;
+		if (peek()=='-') sb.append(read());
+		int c = peek();
+		if (c=='0') {
+			sb.append(read());
+		} else
+		if (c >= '1' && c <= '9') {
+			readDigits();
+		} else {
+			if (c < 0) throw endOfInput();
+			read();
+			throw error("Invalid number");
+		}
+		if (peek()=='.') {
+			integer = false;
+			sb.append(read());
+			if (readDigits()==0) throw error("Invalid number, digit expected");
+		}
+		c = peek();
+		if (c=='e' || c=='E') {
+			integer = false;
+			sb.append(read());
+			c = peek();
+			if (c=='+' || c=='-') sb.append(read());
+			if (readDigits()==0) throw error("Invalid number, digit expected");
+		}
+		return toNumber(sb, integer);
+	}
+
+	/**
+	 * Reads digits into the string builder.
+	 * @return
+	 * the amount of digits read.
+	 * @throws IOException
+	 * if reading failed or the number is too long.
+	 */
+	private final int readDigits() throws IOException {
+		int count = 0;
+		for (int c=peek(); c >= '0' && c <= '9'; c=peek()) {
+			if (sb.length() >= maxStringLength) throw error("Maximal number length of "+maxStringLength+" exceeded");
+			sb.append(read());
+			count++;
+		}
+		if (count==0 && peek() >= 0) read();
+		return count;
+	}
+
+	/**
+	 * Converts the given characters that are known to be a valid JSON number into a number.
+	 * @param chars
+	 * the characters of the number.
+	 * @param integer
+	 * true if the number has neither a fraction nor an exponent.
+	 * @return
+	 * the number as {@link Long}, {@link BigInteger} or {@link Double}.
+	 */
+	static final Number toNumber( final CharSequence chars, final boolean integer ) {
+		final String s = chars.toString();
+		if (integer) {
+			if (s.length() < 19) return Long.valueOf(Long.parseLong(s));
+			final BigInteger big = new BigInteger(s);
+			if (big.bitLength() < 64) return Long.valueOf(big.longValue());
+			return big;
+		}
+		return Double.valueOf(s);
+	}
+
+	@Override
+	public void close() throws IOException {
+		in.close();
+	}
+}
@@ -0,0 +1,483 @@
+package com.umpani.util.json;
+
+import java.io.Closeable;
+import java.io.Flushable;
+import java.io.IOException;
+import java.lang.reflect.Array;
+import java.math.BigDecimal;
+import java.math.BigInteger;
+import java.util.Arrays;
+import java.util.Collection;
+import java.util.Map;
+
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+
+/**
+ * A streaming JSON serializer that writes directly into an {@link Appendable}, for example a {@link java.io.Writer}
+ * or a {@link StringBuilder}. The writer can either be used to serialize complete values (maps, lists, strings,
+ * numbers, booleans and null) using {@link #value(Object)} or to stream a document piece by piece using
+ * <tt>beginObject</tt>, <tt>key</tt>, <tt>beginArray</tt> and alike. The writer never buffers more than the
+ * current nesting state, therefore arbitrary large documents can be written.
+ *
+ * </p><p>Values that are neither maps, collections, arrays, strings, numbers nor booleans are written as strings
+ * using their <tt>toString</tt> method. Numbers that are not finite (NaN or infinity) are written as null, because
+ * JSON does not support them.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UJsonWriter implements Closeable, Flushable {
+	/**
+	 * Nothing was written yet at the top level.
+	 */
+	private static final byte EMPTY_DOCUMENT = 0;
+
+	/**
+	 * At least one value was written at the top level.
+	 */
+	private static final byte NONEMPTY_DOCUMENT = 1;
+
+	/**
+	 * An object was opened, but no key was written yet.
+	 */
+	private static final byte EMPTY_OBJECT = 2;
+
+	/**
+	 * An object was opened and at least one key-value pair was written.
+	 */
+	private static final byte NONEMPTY_OBJECT = 3;
+
+	/**
+	 * A key was written and the value is expected.
+	 */
+	private static final byte DANGLING_KEY = 4;
+
+	/**
+	 * An array was opened, but no value was written yet.
+	 */
+	private static final byte EMPTY_ARRAY = 5;
+
+	/**
+	 * An array was opened and at least one value was written.
+	 */
+	private static final byte NONEMPTY_ARRAY = 6;
+
+	/**
+	 * The hex digits used to escape control characters.
+	 */
+	private static final char[] HEX = "0123456789abcdef".toCharArray();
+
+	/**
+	 * Create a new JSON writer.
+	 * @param out
+	 * the appendable to write to.
+	 * @throws NullPointerException
+	 * if the given appendable is null.
+	 */
+	public UJsonWriter( final Appendable out ) {
+		if (out==null) throw new NullPointerException("out");
+		this.out = out;
+	}
+
+	/**
+	 * The appendable to which the JSON is written.
+	 */
+	protected final Appendable out;
+
+	/**
+	 * The nesting state, the last element is the current state.
+	 */
+	private byte[] stack = new byte[32];
+
+	/**
+	 * The current depth, the index of the current state in the stack.
+	 */
+	private int depth;
+
+	/**
+	 * If true, the top level values are separated by a line-feed instead of a space. This is the format used for
+	 * newline delimited JSON (NDJSON).
+	 */
+	private boolean lineSeparated;
+
+	/**
+	 * Serializes the given value to a JSON string.
+	 * @param value
+	 * the value to serialize.
+	 * @return
+	 * the JSON string.
+	 */
+	public static String toJson( final Object value ) {
+		final StringBuilder sb = new StringBuilder();
+		try {
+			new UJsonWriter(sb).value(value);
+		} catch (IOException e) {
+			// a StringBuilder never throws an IOException
+			throw new IllegalStateException(e);
+		}
+		return sb.toString();
+	}
+
+	/**
+	 * Tells the writer to separate top level values by a line-feed, so that every top level value is one line, as
+	 * required by NDJSON. By default top level values are separated by a single space.
+	 * @param lineSeparated
+	 * true if top level values should be separated by line-feeds.
+	 * @return
+	 * this.
+	 */
+	public final UJsonWriter setLineSeparated( final boolean lineSeparated ) {
+		this.lineSeparated = lineSeparated;
+		return this;
+	}
+
+	/**
+	 * Returns true if the writer is at the top level, so no object or array is open.
+	 * @return
+	 * true if the writer is at the top level.
+	 */
+	public final boolean isTopLevel() {
+		return depth==0;
+	}
+
+	/**
+	 * Writes the separator that is needed before a new value and updates the state.
+	 * @throws IOException
+	 * if writing failed.
+	 * @throws IllegalStateException
+	 * if no value is expected at the current position, for example if a key is expected.
+	 */
+	private final void beforeValue() throws IOException {
+		switch (stack[depth]) {
+			case EMPTY_DOCUMENT:
+				stack[depth] = NONEMPTY_DOCUMENT;
+				break;
+			case NONEMPTY_DOCUMENT:
+				out.append(lineSeparated ? '\n' : ' ');
+				break;
+			case EMPTY_ARRAY:
+				stack[depth] = NONEMPTY_ARRAY;
+				break;
+			case NONEMPTY_ARRAY:
+				out.append(',');
+				break;
+			case DANGLING_KEY:
+				stack[depth] = NONEMPTY_OBJECT;
+				break;
+			default:
+				throw new IllegalStateException("A key is expected, not a value");
+		}
+	}
+
+	/**
+	 * Pushes a new state to the stack.
+	 */
+	private final void push( final byte state ) {
+		if (++depth == stack.length) stack = Arrays.copyOf(stack, stack.length<<1);
+		stack[depth] = state;
+	}
+
+	/**
+	 * Opens a new JSON object.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 */
+	public UJsonWriter beginObject() throws IOException {
+		beforeValue();
+		push(EMPTY_OBJECT);
+		out.append('{');
+		return this;
+	}
+
+	/**
+	 * Closes the current JSON object.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 * @throws IllegalStateException
+	 * if there is no open object or a key was written without a value.
+	 */
+	public UJsonWriter endObject() throws IOException {
+		final byte state = stack[depth];
+		if (state!=EMPTY_OBJECT && state!=NONEMPTY_OBJECT) throw new IllegalStateException("No object to end");
+		depth--;
+		out.append('}');
+		return this;
+	}
+
+	/**
+	 * Opens a new JSON array.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 */
+	public UJsonWriter beginArray() throws IOException {
+		beforeValue();
+		push(EMPTY_ARRAY);
+		out.append('[');
+		return this;
+	}
+
+	/**
+	 * Closes the current JSON array.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 * @throws IllegalStateException
+	 * if there is no open array.
+	 */
+	public UJsonWriter endArray() throws IOException {
+		final byte state = stack[depth];
+		if (state!=EMPTY_ARRAY && state!=NONEMPTY_ARRAY) throw new IllegalStateException("No array to end");
+		depth--;
+		out.append(']');
+		return this;
+	}
+
+	/**
+	 * Writes the key of the next key-value pair of the current object.
+	 * @param key
+	 * the key.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 * @throws IllegalStateException
+	 * if no key is expected.
+	 * @throws NullPointerException
+	 * if the given key is null.
+	 */
+	public UJsonWriter key( final String key ) throws IOException {
+		if (key==null) throw new NullPointerException("key");
+		final byte state = stack[depth];
+		if (state==NONEMPTY_OBJECT) {
+			out.append(',');
+		} else
+		if (state!=EMPTY_OBJECT) {
+			throw new IllegalStateException("No key expected");
+		}
+		stack[depth] = DANGLING_KEY;
+		string(key);
+		out.append(':');
+		return this;
+	}
+
+	/**
+	 * Writes a null value.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 */
+	public UJsonWriter nullValue() throws IOException {
+		beforeValue();
+		out.append("null");
+		return this;
+	}
+
+	/**
+	 * Writes a boolean value.
+	 * @param value
+	 * the value to write.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 */
+	public UJsonWriter value( final boolean value ) throws IOException {
+		beforeValue();
+		out.append(value ? "true" : "false");
+		return this;
+	}
+
+	/**
+	 * Writes an integer value.
+	 * @param value
+	 * the value to write.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 */
+	public UJsonWriter value( final long value ) throws IOException {
+		beforeValue();
+		out.append(Long.toString(value));
+		return this;
+	}
+
+	/**
+	 * Writes a floating point value, not finite values are written as null.
+	 * @param value
+	 * the value to write.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 */
+	public UJsonWriter value( final double value ) throws IOException {
+		beforeValue();
+		if (Double.isNaN(value) || Double.isInfinite(value)) {
+			out.append("null");
+		} else {
+			out.append(Double.toString(value));
+		}
+		return this;
+	}
+
+	/**
+	 * Writes a string value.
+	 * @param value
+	 * the value to write, if null, then null is written.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 */
+	public UJsonWriter value( final CharSequence value ) throws IOException {
+		beforeValue();
+		if (value==null) {
+			out.append("null");
+		} else {
+			string(value);
+		}
+		return this;
+	}
+
+	/**
+	 * Writes an arbitrary value, maps are written as objects, collections and arrays as arrays.
+	 * @param value
+	 * the value to write.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 * @throws IllegalArgumentException
+	 * if a map contains a null key.
+	 */
+	public UJsonWriter value( final Object value ) throws IOException {
+		if (value==null) return nullValue();
+		if (value instanceof CharSequence) return value((CharSequence)value);
+		if (value instanceof Boolean) return value(((Boolean)value).booleanValue());
+		if (value instanceof Number) return number((Number)value);
+		if (value instanceof UMap) {
+			final Object[] keyValue = ((UMap<?,?>)value).getKeyValuePairs();
+			beginObject();
+			for (int i=0; i < keyValue.length;) {
+				key(keyValue[i++].toString());
+				value(keyValue[i++]);
+			}
+			return endObject();
+		}
+		if (value instanceof Map) {
+			beginObject();
+			for (final Map.Entry<?,?> entry : ((Map<?,?>)value).entrySet()) {
+				final Object key = entry.getKey();
+				if (key==null) throw new IllegalArgumentException("Maps with null keys can't be serialized");
+				key(key.toString());
+				value(entry.getValue());
+			}
+			return endObject();
+		}
+		if (value instanceof UList) {
+			final UList<?> list = (UList<?>)value;
+			final int size = list.size();
+			beginArray();
+			for (int i=0; i < size; i++) value(list.get(i));
+			return endArray();
+		}
+		if (value instanceof Collection) {
+			beginArray();
+			for (final Object v : (Collection<?>)value) value(v);
+			return endArray();
+		}
+		if (value.getClass().isArray()) {
+			final int length = Array.getLength(value);
+			beginArray();
+			for (int i=0; i < length; i++) value(Array.get(value, i));
+			return endArray();
+		}
+		return value(value.toString());
+	}
+
+	/**
+	 * Writes a number.
+	 * @param value
+	 * the number.
+	 * @return
+	 * this.
+	 * @throws IOException
+	 * if writing failed.
+	 */
+	private final UJsonWriter number( final Number value ) throws IOException {
+		if (value instanceof Double || value instanceof Float) return value(value.doubleValue());
+		if (value instanceof BigDecimal || value instanceof BigInteger) {
+			beforeValue();
+			out.append(value.toString());
+			return this;
+		}
+		return value(value.longValue());
+	}
+
+	/**
+	 * Writes the given characters as quoted and escaped JSON string.
+	 * @param s
+	 * the characters to write.
+	 * @throws IOException
+	 * if writing failed.
+	 */
+	private final void string( final CharSequence s ) throws IOException {
+		final Appendable out = this.out;
+		out.append('"');
+		final int length = s.length();
+		int start = 0;
+		for (int i=0; i < length; i++) {
+			final char c = s.charAt(i);
+			final String replacement;
+			if (c < 0x20) {
+				switch (c) {
+					case '\b': replacement = "\\b"; break;
+					case '\f': replacement = "\\f"; break;
+					case '\n': replacement = "\\n"; break;
+					case '\r': replacement = "\\r"; break;
+					case '\t': replacement = "\\t"; break;
+					default: replacement = null;
+				}
+			} else
+			if (c=='"') {
+				replacement = "\\\"";
+			} else
+			if (c=='\\') {
+				replacement = "\\\\";
+			} else
+			if (c=='\u2028' || c=='\u2029') {
+				replacement = null;
+			} else {
+				continue;
+			}
+			if (start < i) out.append(s, start, i);
+			if (replacement!=null) {
+				out.append(replacement);
+			} else {
+				out.append("\\u").append(HEX[(c>>>12)&0xF]).append(HEX[(c>>>8)&0xF]).append(HEX[(c>>>4)&0xF]).append(HEX[c&0xF]);
+			}
+			start = i+1;
+		}
+		if (start < length) out.append(s, start, length);
+		out.append('"');
+	}
+
+	@Override
+	public void flush() throws IOException {
+		if (out instanceof Flushable) ((Flushable)out).flush();
+	}
+
+	@Override
+	public void close() throws IOException {
+		if (out instanceof Closeable) ((Closeable)out).close();
+	}
+}
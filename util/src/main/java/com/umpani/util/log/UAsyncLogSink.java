@@ -0,0 +1,269 @@
+package com.umpani.util.log;
+
+import java.io.Closeable;
+import java.io.IOException;
+import java.util.Iterator;
+import java.util.concurrent.ArrayBlockingQueue;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicLong;
+import java.util.concurrent.locks.Lock;
+import java.util.concurrent.locks.ReentrantReadWriteLock;
+
+/**
+ * A log sink that buffers events in a bounded queue and appends them asynchronously to another sink using a daemon
+ * thread. If the queue is full, the configured {@link ULogDropPolicy} decides whether the new event is dropped, the
+ * oldest queued event is dropped or the logging thread is blocked. The amount of dropped events is counted and can
+ * be queried using {@link #getDropped()}. Whenever the queue runs empty the target sink is flushed.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class UAsyncLogSink implements ULogSink, Closeable {
+	/**
+	 * The event used to signal the writer thread to terminate.
+	 */
+	private static final ULogEvent CLOSE = new ULogEvent();
+
+	/**
+	 * An event used to signal a flush request to the writer thread.
+	 */
+	private static final class FlushMarker extends ULogEvent {
+		/**
+		 * True once the flush is done.
+		 */
+		private boolean done;
+
+		/**
+		 * Marks the flush as done and wakes up the waiting thread.
+		 */
+		synchronized void done() {
+			done = true;
+			notifyAll();
+		}
+
+		/**
+		 * Waits until the flush is done or the given thread terminated.
+		 * @param writer
+		 * the writer thread.
+		 */
+		synchronized void await( final Thread writer ) {
+			try {
+				while (!done && writer.isAlive()) wait(100);
+			} catch (InterruptedException e) {
+				Thread.currentThread().interrupt();
+			}
+		}
+	}
+
+	/**
+	 * Create a new asynchronous sink and start its writer thread.
+	 * @param target
+	 * the sink to which to append the events.
+	 * @param capacity
+	 * the maximal amount of queued events.
+	 * @param policy
+	 * the policy to apply if the queue is full.
+	 * @throws NullPointerException
+	 * if the target or the policy is null.
+	 */
+	public UAsyncLogSink( final ULogSink target, final int capacity, final ULogDropPolicy policy ) {
+		if (target==null) throw new NullPointerException("target");
+		if (policy==null) throw new NullPointerException("policy");
+		this.target = target;
+		this.policy = policy;
+		this.queue = new ArrayBlockingQueue<ULogEvent>(capacity);
+		this.writer = new Thread("ULogWriter") {
+			@Override
+			public void run() {
+				drain();
+			}
+		};
+		this.writer.setDaemon(true);
+		this.writer.start();
+	}
+
+	/**
+	 * The target sink.
+	 */
+	protected final ULogSink target;
+
+	/**
+	 * The policy to apply if the queue is full.
+	 */
+	protected final ULogDropPolicy policy;
+
+	/**
+	 * The queue of events.
+	 */
+	private final ArrayBlockingQueue<ULogEvent> queue;
+
+	/**
+	 * The writer thread.
+	 */
+	private final Thread writer;
+
+	/**
+	 * The amount of dropped events.
+	 */
+	private final AtomicLong dropped = new AtomicLong();
+
+	/**
+	 * True once the sink was closed.
+	 */
+	private volatile boolean closed;
+
+	/**
+	 * Held shared while an event is queued and exclusive while closing, so that no event is queued after the close
+	 * signal.
+	 */
+	private final ReentrantReadWriteLock closeLock = new ReentrantReadWriteLock();
+
+	/**
+	 * Returns the amount of events dropped so far.
+	 * @return
+	 * the amount of events dropped so far.
+	 */
+	public final long getDropped() {
+		return dropped.get();
+	}
+
+	/**
+	 * Returns the amount of currently queued events.
+	 * @return
+	 * the amount of currently queued events.
+	 */
+	public final int getQueued() {
+		return queue.size();
+	}
+
+	@Override
+	public void append( final ULogEvent event ) throws IOException {
+		final Lock lock = closeLock.readLock();
+		lock.lock();
+		try {
+			enqueue(event);
+		} finally {
+			lock.unlock();
+		}
+	}
+
+	/**
+	 * Queues the given event as the policy demands, the caller holds the shared close lock.
+	 */
+	private void enqueue( final ULogEvent event ) {
+		if (closed) {
+			dropped.incrementAndGet();
+			return;
+		}
+		switch (policy) {
+			case DROP_NEWEST:
+				if (!queue.offer(event)) dropped.incrementAndGet();
+				break;
+			case DROP_OLDEST:
+				while (!queue.offer(event)) {
+					if (!dropOldest()) {
+						// only flush requests and the close signal are queued, which must not be lost
+						dropped.incrementAndGet();
+						break;
+					}
+				}
+				break;
+			default:
+				try {
+					queue.put(event);
+				} catch (InterruptedException e) {
+					Thread.currentThread().interrupt();
+					dropped.incrementAndGet();
+				}
+		}
+	}
+
+	/**
+	 * Removes the oldest queued event, skipping flush requests and the close signal.
+	 * @return
+	 * false if no event is queued.
+	 */
+	private boolean dropOldest() {
+		final Iterator<ULogEvent> it = queue.iterator();
+		while (it.hasNext()) {
+			final ULogEvent oldest = it.next();
+			if (oldest==CLOSE || oldest instanceof FlushMarker) continue;
+			// does nothing if the writer took the event in the meantime
+			it.remove();
+			dropped.incrementAndGet();
+			return true;
+		}
+		return false;
+	}
+
+	/**
+	 * Returns when all events that were queued when calling this method are handed to the target and the target was
+	 * flushed, or when the writer thread terminated. If the queue is full, this method blocks until there is room
+	 * for the flush request.
+	 */
+	@Override
+	public void flush() throws IOException {
+		if (closed) return;
+		final FlushMarker marker = new FlushMarker();
+		try {
+			queue.put(marker);
+		} catch (InterruptedException e) {
+			Thread.currentThread().interrupt();
+			return;
+		}
+		marker.await(writer);
+	}
+
+	/**
+	 * The loop of the writer thread.
+	 */
+	private final void drain() {
+		final ArrayBlockingQueue<ULogEvent> queue = this.queue;
+		while (true) {
+			try {
+				ULogEvent event = queue.poll();
+				if (event==null) {
+					target.flush();
+					event = queue.poll(1, TimeUnit.SECONDS);
+					if (event==null) continue;
+				}
+				if (event==CLOSE) {
+					target.flush();
+					return;
+				}
+				if (event instanceof FlushMarker) {
+					target.flush();
+					((FlushMarker)event).done();
+					continue;
+				}
+				target.append(event);
+			} catch (InterruptedException e) {
+				return;
+			} catch (Exception e) {
+				System.err.println("Failed to write log event: "+e);
+			}
+		}
+	}
+
+	/**
+	 * Stops accepting new events, waits until all queued events are written and closes the target, if it is
+	 * closeable.
+	 */
+	@Override
+	public void close() throws IOException {
+		final Lock lock = closeLock.writeLock();
+		lock.lock();
+		try {
+			if (closed) return;
+			closed = true;
+		} finally {
+			lock.unlock();
+		}
+		try {
+			queue.put(CLOSE);
+			writer.join();
+		} catch (InterruptedException e) {
+			Thread.currentThread().interrupt();
+		}
+		if (target instanceof Closeable) ((Closeable)target).close();
+	}
+}
@@ -0,0 +1,169 @@
+package com.umpani.util.log;
+
+import java.util.Arrays;
+
+import com.umpani.util.UMap;
+
+/**
+ * The thread local context of the logging, comparable to a mapped diagnostic context (MDC). The context is a stack
+ * of read-only map layers, each layer is pushed by a caller and popped again when the returned {@link Scope} is
+ * closed. Reading a key searches the layers from top to bottom, so an upper layer shadows the same key of a lower
+ * layer without modifying it. This way a layer can be pushed and popped without copying the maps below it:
+ * <pre>
+ *	try (ULogContext.Scope scope = ULogContext.push("requestId", id)) {
+ *		logger.info("Request received");
+ *	}</pre>
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public final class ULogContext {
+	/**
+	 * The context of the current thread.
+	 */
+	private static final ThreadLocal<ULogContext> CURRENT = new ThreadLocal<ULogContext>() {
+		@Override
+		protected ULogContext initialValue() {
+			return new ULogContext();
+		}
+	};
+
+	/**
+	 * Returns the context of the current thread.
+	 * @return
+	 * the context of the current thread.
+	 */
+	public static ULogContext current() {
+		return CURRENT.get();
+	}
+
+	/**
+	 * Pushes a new layer with the given key-value pairs to the context of the current thread.
+	 * @param keyValue
+	 * the key-value pairs, keys must be strings, alternating with the values.
+	 * @return
+	 * the scope that must be closed to pop the layer again.
+	 * @throws IllegalArgumentException
+	 * if the given objects are an odd amount (1,3,5..).
+	 * @throws ClassCastException
+	 * if any key is not a string.
+	 */
+	public static Scope push( final Object... keyValue ) {
+		return current().pushLayer(UMap.of(String.class, Object.class, keyValue));
+	}
+
+	/**
+	 * Pushes the given map as new layer to the context of the current thread. The map is made read-only, so it must
+	 * not be modified afterwards.
+	 * @param layer
+	 * the layer to push.
+	 * @return
+	 * the scope that must be closed to pop the layer again.
+	 * @throws NullPointerException
+	 * if the given layer is null.
+	 */
+	public static Scope push( final UMap<String,Object> layer ) {
+		return current().pushLayer(layer);
+	}
+
+	/**
+	 * Private constructor, use {@link #current()}.
+	 */
+	private ULogContext() {}
+
+	/**
+	 * The layers, the first layer is the bottom.
+	 */
+	@SuppressWarnings("unchecked")
+	private UMap<String,Object>[] layers = new UMap[8];
+
+	/**
+	 * The amount of layers.
+	 */
+	private int depth;
+
+	/**
+	 * Pushes the given layer.
+	 * @param layer
+	 * the layer to push.
+	 * @return
+	 * the scope to pop it again.
+	 */
+	private Scope pushLayer( final UMap<String,Object> layer ) {
+		if (layer==null) throw new NullPointerException("layer");
+		layer.setReadOnly(true);
+		if (depth==layers.length) layers = Arrays.copyOf(layers, depth<<1);
+		layers[depth++] = layer;
+		return new Scope(this, depth-1);
+	}
+
+	/**
+	 * Returns the amount of layers.
+	 * @return
+	 * the amount of layers.
+	 */
+	public int depth() {
+		return depth;
+	}
+
+	/**
+	 * Returns the value of the given key from the top most layer that contains it.
+	 * @param key
+	 * the key to search for.
+	 * @return
+	 * the value or null, if no layer contains the key.
+	 */
+	public Object get( final String key ) {
+		for (int i=depth-1; i >= 0; i--) {
+			final UMap<String,Object> layer = layers[i];
+			if (layer.containsKey(key)) return layer.get(key);
+		}
+		return null;
+	}
+
+	/**
+	 * Copies all key-value pairs of all layers into the given target, so that the upper layers override the lower
+	 * layers.
+	 * @param target
+	 * the map to copy the key-value pairs into.
+	 * @return
+	 * the target.
+	 */
+	public <T extends UMap<String,Object>> T copyTo( final T target ) {
+		for (int i=0; i < depth; i++) {
+			final Object[] keyValue = layers[i].getKeyValuePairs();
+			for (int j=0; j < keyValue.length;) {
+				target.put((String)keyValue[j++], keyValue[j++]);
+			}
+		}
+		return target;
+	}
+
+	/**
+	 * The scope of a pushed layer, closing it pops the layer and all layers that were pushed above it and not yet
+	 * popped.
+	 */
+	public static final class Scope implements AutoCloseable {
+		Scope( final ULogContext context, final int index ) {
+			this.context = context;
+			this.index = index;
+		}
+
+		/**
+		 * The context to which the layer was pushed.
+		 */
+		private final ULogContext context;
+
+		/**
+		 * The index of the layer.
+		 */
+		private final int index;
+
+		@Override
+		public void close() {
+			final ULogContext context = this.context;
+			while (context.depth > index) {
+				context.layers[--context.depth] = null;
+			}
+		}
+	}
+}
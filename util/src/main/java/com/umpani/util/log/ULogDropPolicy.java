@@ -0,0 +1,23 @@
+package com.umpani.util.log;
+
+/**
+ * The policy to apply by the {@link UAsyncLogSink} if its queue is full.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public enum ULogDropPolicy {
+	/**
+	 * Drop the event that should be appended.
+	 */
+	DROP_NEWEST,
+
+	/**
+	 * Drop the oldest queued event to make room for the event that should be appended.
+	 */
+	DROP_OLDEST,
+
+	/**
+	 * Block the logging thread until there is room in the queue.
+	 */
+	BLOCK
+}
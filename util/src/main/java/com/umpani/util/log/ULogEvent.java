@@ -0,0 +1,116 @@
+package com.umpani.util.log;
+
+import java.io.PrintWriter;
+import java.io.StringWriter;
+
+import com.umpani.util.UMap;
+
+/**
+ * A log event, which is a simple map that is serialized as one JSON object per line. Next to the standard fields
+ * defined as constants in this class an event holds all fields of the {@link ULogContext} that was active when the
+ * event was created and all fields that were passed to the logger.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class ULogEvent extends UMap<String,Object> {
+	/**
+	 * The key of the timestamp, the milliseconds since the epoch.
+	 */
+	public static final String TIMESTAMP = "ts";
+
+	/**
+	 * The key of the level name.
+	 */
+	public static final String LEVEL = "level";
+
+	/**
+	 * The key of the logger name.
+	 */
+	public static final String LOGGER = "logger";
+
+	/**
+	 * The key of the thread name.
+	 */
+	public static final String THREAD = "thread";
+
+	/**
+	 * The key of the message.
+	 */
+	public static final String MESSAGE = "msg";
+
+	/**
+	 * The key of the error, which is a map with the keys "type", "message" and "stack".
+	 */
+	public static final String ERROR = "error";
+
+	/**
+	 * Create a new empty log event.
+	 */
+	public ULogEvent() {}
+
+	/**
+	 * Sets the standard fields of this event, the timestamp is set to the current time and the thread to the current
+	 * thread.
+	 * @param level
+	 * the level of the event.
+	 * @param logger
+	 * the name of the logger.
+	 * @param message
+	 * the message.
+	 * @return
+	 * this.
+	 */
+	public final ULogEvent setStandardFields( final ULogLevel level, final String logger, final String message ) {
+		put(TIMESTAMP, System.currentTimeMillis());
+		put(LEVEL, level.name());
+		put(LOGGER, logger);
+		put(THREAD, Thread.currentThread().getName());
+		put(MESSAGE, message);
+		return this;
+	}
+
+	/**
+	 * Returns the timestamp of this event.
+	 * @return
+	 * the milliseconds since the epoch.
+	 */
+	public final long getTimestamp() {
+		return getLong(TIMESTAMP);
+	}
+
+	/**
+	 * Returns the level of this event.
+	 * @return
+	 * the level or null, if the event has no valid level.
+	 */
+	public final ULogLevel getLevel() {
+		return ULogLevel.of(getString(LEVEL));
+	}
+
+	/**
+	 * Returns the message of this event.
+	 * @return
+	 * the message.
+	 */
+	public final String getMessage() {
+		return getString(MESSAGE);
+	}
+
+	/**
+	 * Adds the given error to this event.
+	 * @param t
+	 * the error to add.
+	 * @return
+	 * this.
+	 */
+	public final ULogEvent setError( final Throwable t ) {
+		final StringWriter stack = new StringWriter();
+		t.printStackTrace(new PrintWriter(stack));
+		put(ERROR, UMap.of(String.class, Object.class,
+			"type", t.getClass().getName(),
+			"message", t.getMessage(),
+			"stack", stack.toString()
+		));
+		return this;
+	}
+}
@@ -0,0 +1,142 @@
+package com.umpani.util.log;
+
+import java.io.BufferedOutputStream;
+import java.io.Closeable;
+import java.io.File;
+import java.io.FileOutputStream;
+import java.io.IOException;
+import java.io.OutputStream;
+import java.nio.charset.StandardCharsets;
+
+import com.umpani.util.json.UJsonWriter;
+
+/**
+ * A log sink that writes every event as one line of JSON (NDJSON) into a file and rotates the file when it exceeds a
+ * configured size. When rotating, the file <tt>app.log</tt> is renamed into <tt>app.log.1</tt>, a previously
+ * existing <tt>app.log.1</tt> into <tt>app.log.2</tt> and so on, until the configured amount of files is reached, the
+ * oldest file is deleted. The writer is thread safe, but it blocks the logging thread while writing, use it together
+ * with an {@link UAsyncLogSink} to decouple the logging threads from the disk.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class ULogFileWriter implements ULogSink, Closeable {
+	/**
+	 * Create a new log file writer, appending to an existing file.
+	 * @param file
+	 * the file to write into.
+	 * @param maxBytes
+	 * the size in bytes after which the file is rotated, zero or less to never rotate.
+	 * @param maxFiles
+	 * the maximal amount of rotated files to keep, not including the current file.
+	 * @throws IOException
+	 * if opening the file failed.
+	 */
+	public ULogFileWriter( final File file, final long maxBytes, final int maxFiles ) throws IOException {
+		if (file==null) throw new NullPointerException("file");
+		this.file = file;
+		this.maxBytes = maxBytes;
+		this.maxFiles = maxFiles;
+		open();
+	}
+
+	/**
+	 * The file to write into.
+	 */
+	protected final File file;
+
+	/**
+	 * The size after which to rotate the file.
+	 */
+	protected final long maxBytes;
+
+	/**
+	 * The maximal amount of rotated files.
+	 */
+	protected final int maxFiles;
+
+	/**
+	 * The stream to the current file.
+	 */
+	private OutputStream out;
+
+	/**
+	 * The amount of bytes in the current file.
+	 */
+	private long size;
+
+	/**
+	 * The buffer into which every event is serialized.
+	 */
+	private final StringBuilder sb = new StringBuilder(256);
+
+	/**
+	 * Opens the file for appending.
+	 * @throws IOException
+	 * if opening the file failed.
+	 */
+	private final void open() throws IOException {
+		final File parent = file.getAbsoluteFile().getParentFile();
+		if (parent!=null && !parent.isDirectory() && !parent.mkdirs()) throw new IOException("Failed to create "+parent);
+		out = new BufferedOutputStream(new FileOutputStream(file, true), 8192);
+		size = file.length();
+	}
+
+	/**
+	 * Returns the rotated file with the given index.
+	 * @param index
+	 * the index, where 1 is the latest rotated file.
+	 * @return
+	 * the rotated file.
+	 */
+	public final File rotatedFile( final int index ) {
+		return new File(file.getPath()+"."+index);
+	}
+
+	/**
+	 * Closes the current file, renames all files and opens a new file.
+	 * @throws IOException
+	 * if the rotation failed.
+	 */
+	protected synchronized void rotate() throws IOException {
+		out.close();
+		out = null;
+		if (maxFiles <= 0) {
+			if (!file.delete()) throw new IOException("Failed to delete "+file);
+		} else {
+			final File oldest = rotatedFile(maxFiles);
+			if (oldest.exists() && !oldest.delete()) throw new IOException("Failed to delete "+oldest);
+			for (int i=maxFiles-1; i > 0; i--) {
+				final File rotated = rotatedFile(i);
+				if (rotated.exists() && !rotated.renameTo(rotatedFile(i+1))) throw new IOException("Failed to rename "+rotated);
+			}
+			if (!file.renameTo(rotatedFile(1))) throw new IOException("Failed to rename "+file);
+		}
+		open();
+	}
+
+	@Override
+	public synchronized void append( final ULogEvent event ) throws IOException {
+		if (out==null) throw new IOException("Log file writer is closed");
+		final StringBuilder sb = this.sb;
+		sb.setLength(0);
+		new UJsonWriter(sb).value(event);
+		sb.append('\n');
+		final byte[] bytes = sb.toString().getBytes(StandardCharsets.UTF_8);
+		if (maxBytes > 0 && size > 0 && size + bytes.length > maxBytes) rotate();
+		out.write(bytes);
+		size += bytes.length;
+	}
+
+	@Override
+	public synchronized void flush() throws IOException {
+		if (out!=null) out.flush();
+	}
+
+	@Override
+	public synchronized void close() throws IOException {
+		if (out!=null) {
+			out.close();
+			out = null;
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package com.umpani.util.log;
+
+/**
+ * The levels of log events, ordered by severity.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public enum ULogLevel {
+	TRACE, DEBUG, INFO, WARN, ERROR;
+
+	/**
+	 * Returns the level with the given name, ignoring the case.
+	 * @param name
+	 * the name of the level.
+	 * @return
+	 * the level or null, if no such level exists.
+	 */
+	public static ULogLevel of( final String name ) {
+		if (name==null) return null;
+		for (final ULogLevel level : values()) {
+			if (level.name().equalsIgnoreCase(name)) return level;
+		}
+		return null;
+	}
+}
@@ -0,0 +1,105 @@
+package com.umpani.util.log;
+
+import java.io.Closeable;
+import java.io.File;
+import java.io.FileInputStream;
+import java.io.IOException;
+
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+import com.umpani.util.exception.UJsonException;
+import com.umpani.util.json.UJsonReader;
+
+/**
+ * A reader for log files written by the {@link ULogFileWriter}, it parses every line back into a {@link UMap}. This
+ * is mainly useful for tests and for tools that analyze logs.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class ULogReader implements Closeable {
+	/**
+	 * Create a new log reader for the given file.
+	 * @param file
+	 * the file to read.
+	 * @throws IOException
+	 * if opening the file failed.
+	 */
+	public ULogReader( final File file ) throws IOException {
+		this.json = new UJsonReader(new FileInputStream(file));
+	}
+
+	/**
+	 * The parser.
+	 */
+	private final UJsonReader json;
+
+	/**
+	 * Reads all events of the given file.
+	 * @param file
+	 * the file to read.
+	 * @return
+	 * all events of the file.
+	 * @throws IOException
+	 * if reading failed or the file contains invalid lines.
+	 */
+	public static UList<UMap<String,Object>> readAll( final File file ) throws IOException {
+		final UList<UMap<String,Object>> events = new UList<UMap<String,Object>>();
+		try (ULogReader reader = new ULogReader(file)) {
+			while (reader.hasNext()) events.add(reader.next());
+		}
+		return events;
+	}
+
+	/**
+	 * Reads all events of the given file and all its rotated files, oldest first.
+	 * @param file
+	 * the current log file.
+	 * @param maxFiles
+	 * the maximal amount of rotated files, as configured at the {@link ULogFileWriter}.
+	 * @return
+	 * all events, oldest first.
+	 * @throws IOException
+	 * if reading failed or any file contains invalid lines.
+	 */
+	public static UList<UMap<String,Object>> readRotated( final File file, final int maxFiles ) throws IOException {
+		final UList<UMap<String,Object>> events = new UList<UMap<String,Object>>();
+		for (int i=maxFiles; i >= 0; i--) {
+			final File f = i==0 ? file : new File(file.getPath()+"."+i);
+			if (f.isFile()) events.addAll(readAll(f));
+		}
+		return events;
+	}
+
+	/**
+	 * Returns true if there is another event.
+	 * @return
+	 * true if there is another event.
+	 * @throws IOException
+	 * if reading failed.
+	 */
+	public boolean hasNext() throws IOException {
+		return json.hasNext();
+	}
+
+	/**
+	 * Reads the next event.
+	 * @return
+	 * the next event.
+	 * @throws UJsonException
+	 * if the next line is no JSON object or there are no more events.
+	 * @throws IOException
+	 * if reading failed.
+	 */
+	@SuppressWarnings("unchecked")
+	public UMap<String,Object> next() throws IOException {
+		final long offset = json.getOffset();
+		final Object value = json.next();
+		if (!(value instanceof UMap)) throw new UJsonException("Log line is no JSON object", offset, 0, 0);
+		return (UMap<String,Object>)value;
+	}
+
+	@Override
+	public void close() throws IOException {
+		json.close();
+	}
+}
@@ -0,0 +1,26 @@
+package com.umpani.util.log;
+
+import java.io.IOException;
+
+/**
+ * The target to which a {@link ULogger} hands its events.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public interface ULogSink {
+	/**
+	 * Appends the given event. The event is read-only and is owned by the sink from now on.
+	 * @param event
+	 * the event to append.
+	 * @throws IOException
+	 * if appending the event failed.
+	 */
+	public void append( final ULogEvent event ) throws IOException;
+
+	/**
+	 * Flushes all buffered events.
+	 * @throws IOException
+	 * if flushing failed.
+	 */
+	public void flush() throws IOException;
+}
@@ -0,0 +1,51 @@
+package com.umpani.util.log;
+
+import java.io.IOException;
+import java.io.OutputStream;
+import java.nio.charset.StandardCharsets;
+
+import com.umpani.util.json.UJsonWriter;
+
+/**
+ * A log sink that writes every event as one line of JSON (NDJSON) into an output stream, for example
+ * {@link System#err}. The sink is thread safe, the stream is never closed by the sink.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class ULogStreamSink implements ULogSink {
+	/**
+	 * Create a new sink.
+	 * @param out
+	 * the stream to write into.
+	 * @throws NullPointerException
+	 * if the stream is null.
+	 */
+	public ULogStreamSink( final OutputStream out ) {
+		if (out==null) throw new NullPointerException("out");
+		this.out = out;
+	}
+
+	/**
+	 * The stream to write into.
+	 */
+	protected final OutputStream out;
+
+	/**
+	 * The buffer into which every event is serialized.
+	 */
+	private final StringBuilder sb = new StringBuilder(256);
+
+	@Override
+	public synchronized void append( final ULogEvent event ) throws IOException {
+		final StringBuilder sb = this.sb;
+		sb.setLength(0);
+		new UJsonWriter(sb).value(event);
+		sb.append('\n');
+		out.write(sb.toString().getBytes(StandardCharsets.UTF_8));
+	}
+
+	@Override
+	public synchronized void flush() throws IOException {
+		out.flush();
+	}
+}
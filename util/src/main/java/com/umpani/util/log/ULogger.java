@@ -0,0 +1,234 @@
+package com.umpani.util.log;
+
+import java.io.IOException;
+
+/**
+ * A lightweight structured logger that creates a {@link ULogEvent} per log call and hands it to a {@link ULogSink}.
+ * Next to the message every log method accepts additional fields as key-value pairs. If the amount of these
+ * arguments is odd and the last one is a {@link Throwable}, it is treated as the error of the event:
+ * <pre>
+ *	logger.warn("Request failed", "url", url, "status", 503, exception);</pre>
+ *
+ * </p><p>A logger created without sink appends to the default sink, which writes to {@link System#err} unless replaced
+ * with {@link #setDefaultSink(ULogSink)}. The logger is thread safe, as long as the sink is thread safe.
+ *
+ * @author Alexander Weber <xeus2001@gmail.com>
+ */
+public class ULogger {
+	/**
+	 * The sink that delegates to the current default sink.
+	 */
+	private static final ULogSink DEFAULT = new ULogSink() {
+		@Override
+		public void append( final ULogEvent event ) throws IOException {
+			defaultSink.append(event);
+		}
+
+		@Override
+		public void flush() throws IOException {
+			defaultSink.flush();
+		}
+	};
+
+	/**
+	 * The current default sink.
+	 */
+	private static volatile ULogSink defaultSink = new ULogStreamSink(System.err);
+
+	/**
+	 * Returns the sink of all loggers created without sink.
+	 * @return
+	 * the default sink.
+	 */
+	public static ULogSink getDefaultSink() {
+		return defaultSink;
+	}
+
+	/**
+	 * Sets the sink of all loggers created without sink, including those created before.
+	 * @param sink
+	 * the default sink.
+	 * @throws NullPointerException
+	 * if the sink is null.
+	 */
+	public static void setDefaultSink( final ULogSink sink ) {
+		if (sink==null) throw new NullPointerException("sink");
+		defaultSink = sink;
+	}
+
+	/**
+	 * Create a new logger with the level {@link ULogLevel#INFO} that appends to the default sink.
+	 * @param name
+	 * the name of the logger.
+	 * @throws NullPointerException
+	 * if the name is null.
+	 */
+	public ULogger( final String name ) {
+		this(name, DEFAULT);
+	}
+
+	/**
+	 * Create a new logger with the level {@link ULogLevel#INFO}.
+	 * @param name
+	 * the name of the logger.
+	 * @param sink
+	 * the sink to which to append the events.
+	 * @throws NullPointerException
+	 * if any of the given arguments is null.
+	 */
+	public ULogger( final String name, final ULogSink sink ) {
+		if (name==null) throw new NullPointerException("name");
+		if (sink==null) throw new NullPointerException("sink");
+		this.name = name;
+		this.sink = sink;
+	}
+
+	/**
+	 * The name of the logger.
+	 */
+	protected final String name;
+
+	/**
+	 * The sink to which events are appended.
+	 */
+	protected final ULogSink sink;
+
+	/**
+	 * The minimal level of events to log.
+	 */
+	protected volatile ULogLevel level = ULogLevel.INFO;
+
+	/**
+	 * Returns the name of this logger.
+	 * @return
+	 * the name of this logger.
+	 */
+	public final String getName() {
+		return name;
+	}
+
+	/**
+	 * Returns the minimal level of events to log.
+	 * @return
+	 * the minimal level of events to log.
+	 */
+	public final ULogLevel getLevel() {
+		return level;
+	}
+
+	/**
+	 * Sets the minimal level of events to log.
+	 * @param level
+	 * the minimal level of events to log.
+	 * @return
+	 * this.
+	 * @throws NullPointerException
+	 * if the given level is null.
+	 */
+	public final ULogger setLevel( final ULogLevel level ) {
+		if (level==null) throw new NullPointerException("level");
+		this.level = level;
+		return this;
+	}
+
+	/**
+	 * Returns true if events of the given level are logged.
+	 * @param level
+	 * the level to test.
+	 * @return
+	 * true if events of the given level are logged.
+	 */
+	public final boolean isEnabled( final ULogLevel level ) {
+		return level.ordinal() >= this.level.ordinal();
+	}
+
+	/**
+	 * Logs an event with the level TRACE, if enabled.
+	 * @param message
+	 * the message.
+	 * @param fields
+	 * the additional fields as key-value pairs, optionally followed by a {@link Throwable}.
+	 */
+	public final void trace( final String message, final Object... fields ) {
+		if (isEnabled(ULogLevel.TRACE)) log(ULogLevel.TRACE, message, fields);
+	}
+
+	/**
+	 * Logs an event with the level DEBUG, if enabled.
+	 * @param message
+	 * the message.
+	 * @param fields
+	 * the additional fields as key-value pairs, optionally followed by a {@link Throwable}.
+	 */
+	public final void debug( final String message, final Object... fields ) {
+		if (isEnabled(ULogLevel.DEBUG)) log(ULogLevel.DEBUG, message, fields);
+	}
+
+	/**
+	 * Logs an event with the level INFO, if enabled.
+	 * @param message
+	 * the message.
+	 * @param fields
+	 * the additional fields as key-value pairs, optionally followed by a {@link Throwable}.
+	 */
+	public final void info( final String message, final Object... fields ) {
+		if (isEnabled(ULogLevel.INFO)) log(ULogLevel.INFO, message, fields);
+	}
+
+	/**
+	 * Logs an event with the level WARN, if enabled.
+	 * @param message
+	 * the message.
+	 * @param fields
+	 * the additional fields as key-value pairs, optionally followed by a {@link Throwable}.
+	 */
+	public final void warn( final String message, final Object... fields ) {
+		if (isEnabled(ULogLevel.WARN)) log(ULogLevel.WARN, message, fields);
+	}
+
+	/**
+	 * Logs an event with the level ERROR, if enabled.
+	 * @param message
+	 * the message.
+	 * @param fields
+	 * the additional fields as key-value pairs, optionally followed by a {@link Throwable}.
+	 */
+	public final void error( final String message, final Object... fields ) {
+		if (isEnabled(ULogLevel.ERROR)) log(ULogLevel.ERROR, message, fields);
+	}
+
+	/**
+	 * Logs an event, if the given level is enabled.
+	 * @param level
+	 * the level of the event.
+	 * @param message
+	 * the message.
+	 * @param fields
+	 * the additional fields as key-value pairs, optionally followed by a {@link Throwable}.
+	 */
+	public void log( final ULogLevel level, final String message, final Object... fields ) {
+		if (!isEnabled(level)) return;
+		final ULogEvent event = ULogContext.current().copyTo(new ULogEvent());
+		int length = fields==null ? 0 : fields.length;
+		if ((length&1)==1) {
+			final Object last = fields[--length];
+			if (last instanceof Throwable) {
+				event.setError((Throwable)last);
+			} else {
+				event.put("arg", last);
+			}
+		}
+		for (int i=0; i < length; i+=2) {
+			final Object key = fields[i];
+			if (key!=null) event.put(key.toString(), fields[i+1]);
+		}
+		event.setStandardFields(level, name, message);
+		event.setReadOnly(true);
+		try {
+			sink.append(event);
+		} catch (IOException e) {
+			// logging must never fail the caller
+			System.err.println("Failed to append log event of logger "+name+": "+e);
+		}
+	}
+}
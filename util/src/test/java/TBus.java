@@ -0,0 +1,241 @@
+import static org.junit.Assert.*;
+
+import java.util.ArrayDeque;
+import java.util.ArrayList;
+import java.util.List;
+import java.util.concurrent.Executor;
+import java.util.concurrent.ExecutorService;
+import java.util.concurrent.Executors;
+import java.util.concurrent.RejectedExecutionException;
+import java.util.concurrent.TimeUnit;
+
+import org.junit.Test;
+
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+import com.umpani.util.bus.UBus;
+import com.umpani.util.bus.UBusFullPolicy;
+import com.umpani.util.bus.UBusListener;
+import com.umpani.util.bus.UBusSubscription;
+import com.umpani.util.exception.UBusFullException;
+import com.umpani.util.exception.UReadOnlyException;
+
+public class TBus {
+	/**
+	 * An executor that queues the tasks until they are run explicitly.
+	 */
+	static class ManualExecutor implements Executor {
+		final ArrayDeque<Runnable> tasks = new ArrayDeque<Runnable>();
+
+		@Override
+		public synchronized void execute( final Runnable task ) {
+			tasks.add(task);
+		}
+
+		void runAll() {
+			Runnable task;
+			while ((task = poll())!=null) task.run();
+		}
+
+		synchronized Runnable poll() {
+			return tasks.poll();
+		}
+	}
+
+	/**
+	 * A listener that collects the topics and messages.
+	 */
+	static class CollectingListener implements UBusListener {
+		final List<String> topics = new ArrayList<String>();
+		final List<UMap<String,Object>> messages = new ArrayList<UMap<String,Object>>();
+
+		@Override
+		public synchronized void onMessage( final String topic, final UMap<String,Object> message ) {
+			topics.add(topic);
+			messages.add(message);
+		}
+	}
+
+	private static UMap<String,Object> message( final int id ) {
+		return UMap.of(String.class, Object.class, "id", id);
+	}
+
+	@Test
+	public void topicPatterns() {
+		assertTrue(UBus.matches("orders.*", "orders.created"));
+		assertFalse(UBus.matches("orders.*", "orders.eu.created"));
+		assertFalse(UBus.matches("orders.*", "orders"));
+		assertTrue(UBus.matches("orders.#", "orders"));
+		assertTrue(UBus.matches("orders.#", "orders.eu.created"));
+		assertTrue(UBus.matches("#.created", "orders.eu.created"));
+		assertTrue(UBus.matches("*.eu.*", "orders.eu.created"));
+		assertTrue(UBus.matches("#", "anything.at.all"));
+		assertFalse(UBus.matches("orders.created", "orders.deleted"));
+
+		final UBus bus = new UBus();
+		final ManualExecutor executor = new ManualExecutor();
+		final CollectingListener listener = new CollectingListener();
+		for (final String invalid : new String[] { "orders..created", "orders.cre*", "" }) {
+			try {
+				bus.subscribe(invalid, executor, listener);
+				fail("Expected an IllegalArgumentException for "+invalid);
+			} catch (IllegalArgumentException e) {
+				// expected
+			}
+		}
+		try {
+			bus.publish("orders.*", message(1));
+			fail("Expected an IllegalArgumentException");
+		} catch (IllegalArgumentException e) {
+			// expected, wildcards are only allowed in patterns
+		}
+	}
+
+	@Test
+	public void deliveryOfFrozenMessages() {
+		final UBus bus = new UBus();
+		final ManualExecutor executor = new ManualExecutor();
+		final CollectingListener orders = new CollectingListener();
+		final CollectingListener created = new CollectingListener();
+		bus.subscribe("orders.#", executor, orders);
+		bus.subscribe("*.created", executor, created);
+
+		final UMap<String,Object> items = new UMap<String,Object>();
+		items.put("count", 2);
+		final UList<Object> tags = new UList<Object>();
+		tags.add("new");
+		final UMap<String,Object> message = UMap.of(String.class, Object.class, "id", 1, "items", items, "tags", tags);
+		assertEquals(2, bus.publish("orders.created", message));
+		assertEquals(1, bus.publish("orders.eu.deleted", message(2)));
+		assertEquals(0, bus.publish("users.deleted", message(3)));
+		// modifications after publishing have no effect
+		items.put("count", 3);
+		assertTrue(orders.messages.isEmpty());
+		executor.runAll();
+
+		assertEquals("[orders.created, orders.eu.deleted]", orders.topics.toString());
+		assertEquals("[orders.created]", created.topics.toString());
+		final UMap<String,Object> received = orders.messages.get(0);
+		assertSame(received, created.messages.get(0));
+		final UMap<String,Object> receivedItems = received.getMap("items");
+		assertEquals(2L, receivedItems.getLong("count"));
+		assertTrue(received.isReadOnly());
+		try {
+			receivedItems.put("count", 4);
+			fail("Expected an UReadOnlyException");
+		} catch (UReadOnlyException e) {
+			// expected, the message is frozen deeply
+		}
+		try {
+			final UList<Object> receivedTags = received.getList("tags");
+			receivedTags.add("old");
+			fail("Expected an UReadOnlyException");
+		} catch (UReadOnlyException e) {
+			// expected
+		}
+	}
+
+	@Test
+	public void dropAndErrorWhenFull() {
+		final UBus bus = new UBus();
+		final ManualExecutor executor = new ManualExecutor();
+		final CollectingListener dropping = new CollectingListener();
+		final CollectingListener failing = new CollectingListener();
+		final UBusSubscription drop = bus.subscribe("orders.*", executor, 2, UBusFullPolicy.DROP, dropping);
+		final UBusSubscription error = bus.subscribe("orders.created", executor, 2, UBusFullPolicy.ERROR, failing);
+		bus.publish("orders.created", message(1));
+		bus.publish("orders.created", message(2));
+		assertEquals(2, drop.getQueued());
+		try {
+			bus.publish("orders.created", message(3));
+			fail("Expected an UBusFullException");
+		} catch (UBusFullException e) {
+			assertEquals("orders.created", e.topic);
+			assertEquals(1, e.subscribers);
+		}
+		// the dropping subscriber never fails the publisher
+		assertEquals(0, bus.publish("orders.deleted", message(4)));
+		assertEquals(2, drop.getDropped());
+		assertEquals(1, error.getDropped());
+		executor.runAll();
+		assertEquals(2, dropping.messages.size());
+		assertEquals(2, failing.messages.size());
+		assertEquals(0, drop.getQueued());
+		assertEquals(2, bus.publish("orders.created", message(5)));
+	}
+
+	@Test
+	public void blockWhenFull() throws Exception {
+		final UBus bus = new UBus();
+		final ManualExecutor executor = new ManualExecutor();
+		final CollectingListener listener = new CollectingListener();
+		final UBusSubscription subscription = bus.subscribe("orders.*", executor, 1, UBusFullPolicy.BLOCK, listener);
+		final Thread publisher = new Thread() {
+			@Override
+			public void run() {
+				for (int i=0; i < 3; i++) bus.publish("orders.created", message(i));
+			}
+		};
+		publisher.start();
+		final long deadline = System.nanoTime() + TimeUnit.SECONDS.toNanos(5);
+		while (listener.messages.size() < 3 && System.nanoTime() < deadline) {
+			executor.runAll();
+			Thread.sleep(1);
+		}
+		publisher.join(5000);
+		assertFalse(publisher.isAlive());
+		assertEquals(3, listener.messages.size());
+		assertEquals(0, subscription.getDropped());
+		for (int i=0; i < 3; i++) assertEquals(i, listener.messages.get(i).getInt("id"));
+	}
+
+	@Test
+	public void neverBlockTheDeliveryExecutor() throws Exception {
+		final UBus bus = new UBus();
+		final ExecutorService executor = Executors.newSingleThreadExecutor();
+		try {
+			final CollectingListener listener = new CollectingListener();
+			final UBusSubscription subscription = bus.subscribe("orders.*", executor, 1, UBusFullPolicy.BLOCK, listener);
+			// the delivery waits for the publishing task, so the full queue must not block it
+			executor.submit(new Runnable() {
+				@Override
+				public void run() {
+					for (int i=0; i < 3; i++) bus.publish("orders.created", message(i));
+				}
+			}).get(5, TimeUnit.SECONDS);
+			assertEquals(2, subscription.getDropped());
+			final long deadline = System.nanoTime() + TimeUnit.SECONDS.toNanos(5);
+			while (listener.messages.isEmpty() && System.nanoTime() < deadline) Thread.sleep(1);
+			assertEquals(1, listener.messages.size());
+			assertEquals(0, listener.messages.get(0).getInt("id"));
+		} finally {
+			executor.shutdown();
+		}
+	}
+
+	@Test
+	public void cancel() {
+		final UBus bus = new UBus();
+		final ManualExecutor executor = new ManualExecutor();
+		final CollectingListener listener = new CollectingListener();
+		final UBusSubscription subscription = bus.subscribe("orders.#", executor, listener);
+		assertEquals(1, bus.publish("orders", message(1)));
+		subscription.cancel();
+		assertTrue(subscription.isCancelled());
+		assertTrue(bus.subscriptions().isEmpty());
+		assertEquals(0, bus.publish("orders", message(2)));
+		executor.runAll();
+		assertTrue(listener.messages.isEmpty());
+
+		// a subscription whose executor rejects the delivery is cancelled
+		final UBusSubscription rejected = bus.subscribe("orders.#", new Executor() {
+			@Override
+			public void execute( final Runnable command ) {
+				throw new RejectedExecutionException();
+			}
+		}, listener);
+		bus.publish("orders", message(3));
+		assertTrue(rejected.isCancelled());
+		assertTrue(bus.subscriptions().isEmpty());
+	}
+}
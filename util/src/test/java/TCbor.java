@@ -0,0 +1,132 @@
+import static org.junit.Assert.*;
+
+import java.io.ByteArrayInputStream;
+import java.math.BigDecimal;
+import java.math.BigInteger;
+
+import org.junit.Test;
+
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+import com.umpani.util.cbor.UCborReader;
+import com.umpani.util.cbor.UCborWriter;
+import com.umpani.util.exception.UCborException;
+
+@SuppressWarnings("unchecked")
+public class TCbor {
+
+	private static byte[] hex( final String hex ) {
+		final byte[] bytes = new byte[hex.length() / 2];
+		for (int i=0; i < bytes.length; i++) bytes[i] = (byte)Integer.parseInt(hex.substring(2*i, 2*i + 2), 16);
+		return bytes;
+	}
+
+	private static String toHex( final byte[] bytes ) {
+		final StringBuilder sb = new StringBuilder();
+		for (final byte b : bytes) sb.append(String.format("%02x", b & 0xff));
+		return sb.toString();
+	}
+
+	@Test
+	public void writeValues() {
+		// the examples of RFC 7049, appendix A
+		assertEquals("00", toHex(UCborWriter.toCbor(0)));
+		assertEquals("17", toHex(UCborWriter.toCbor(23)));
+		assertEquals("1818", toHex(UCborWriter.toCbor(24)));
+		assertEquals("1903e8", toHex(UCborWriter.toCbor(1000)));
+		assertEquals("1a000f4240", toHex(UCborWriter.toCbor(1000000)));
+		assertEquals("1b000000e8d4a51000", toHex(UCborWriter.toCbor(1000000000000L)));
+		assertEquals("20", toHex(UCborWriter.toCbor(-1)));
+		assertEquals("3903e7", toHex(UCborWriter.toCbor(-1000)));
+		assertEquals("1bffffffffffffffff", toHex(UCborWriter.toCbor(new BigInteger("18446744073709551615"))));
+		assertEquals("c249010000000000000000", toHex(UCborWriter.toCbor(new BigInteger("18446744073709551616"))));
+		assertEquals("3bffffffffffffffff", toHex(UCborWriter.toCbor(new BigInteger("-18446744073709551616"))));
+		assertEquals("c349010000000000000000", toHex(UCborWriter.toCbor(new BigInteger("-18446744073709551617"))));
+		assertEquals("fa3fc00000", toHex(UCborWriter.toCbor(1.5d)));
+		assertEquals("fb3ff199999999999a", toHex(UCborWriter.toCbor(1.1d)));
+		assertEquals("f4", toHex(UCborWriter.toCbor(false)));
+		assertEquals("f6", toHex(UCborWriter.toCbor(null)));
+		assertEquals("60", toHex(UCborWriter.toCbor("")));
+		assertEquals("62c3bc", toHex(UCborWriter.toCbor("ü")));
+		assertEquals("4401020304", toHex(UCborWriter.toCbor(new byte[] { 1, 2, 3, 4 })));
+		assertEquals("83010203", toHex(UCborWriter.toCbor(new int[] { 1, 2, 3 })));
+		assertEquals("a26161016162820203", toHex(UCborWriter.toCbor(UMap.of(String.class, Object.class, "a", 1L, "b", UList.of(Object.class, 2L, 3L)))));
+		assertEquals("c482211903e7", toHex(UCborWriter.toCbor(new BigDecimal("9.99"))));
+	}
+
+	@Test
+	public void readValues() throws Exception {
+		assertEquals(Long.valueOf(100), UCborReader.parse(hex("1864")));
+		assertEquals(Long.valueOf(-100), UCborReader.parse(hex("3863")));
+		assertEquals(new BigInteger("18446744073709551615"), UCborReader.parse(hex("1bffffffffffffffff")));
+		assertEquals(new BigInteger("-18446744073709551616"), UCborReader.parse(hex("3bffffffffffffffff")));
+		assertEquals(new BigInteger("18446744073709551616"), UCborReader.parse(hex("c249010000000000000000")));
+		assertEquals(new BigInteger("-18446744073709551617"), UCborReader.parse(hex("c349010000000000000000")));
+		assertEquals(Double.valueOf(1.5), UCborReader.parse(hex("f93e00")));
+		assertEquals(Double.valueOf(-4.0), UCborReader.parse(hex("f9c400")));
+		assertEquals(Double.valueOf(5.960464477539063e-8), UCborReader.parse(hex("f90001")));
+		assertEquals(Double.valueOf(Double.POSITIVE_INFINITY), UCborReader.parse(hex("f97c00")));
+		assertEquals(Double.valueOf(100000.0), UCborReader.parse(hex("fa47c35000")));
+		assertEquals(Double.valueOf(1.1), UCborReader.parse(hex("fb3ff199999999999a")));
+		assertEquals(Boolean.TRUE, UCborReader.parse(hex("f5")));
+		assertNull(UCborReader.parse(hex("f7")));
+		assertEquals("IETF", UCborReader.parse(hex("6449455446")));
+		assertArrayEquals(new byte[] { 1, 2, 3, 4 }, (byte[])UCborReader.parse(hex("4401020304")));
+		assertEquals(new BigDecimal("273.15"), UCborReader.parse(hex("c48221196ab3")));
+		// a tag that is not known is ignored
+		assertEquals("2013-03-21T20:04:00Z", UCborReader.parse(hex("c074323031332d30332d32315432303a30343a30305a")));
+
+		final UMap<String,Object> map = (UMap<String,Object>)UCborReader.parse(hex("a26161016162820203"));
+		assertEquals(1L, map.getLong("a"));
+		assertEquals(UList.of(Object.class, 2L, 3L), map.get("b"));
+		// integer keys are converted to strings
+		assertEquals(UMap.of(String.class, Object.class, "1", 2L, "3", 4L), UCborReader.parse(hex("a201020304")));
+	}
+
+	@Test
+	public void readIndefiniteLengths() throws Exception {
+		assertArrayEquals(new byte[] { 1, 2, 3, 4, 5 }, (byte[])UCborReader.parse(hex("5f42010243030405ff")));
+		assertEquals("streaming", UCborReader.parse(hex("7f657374726561646d696e67ff")));
+		assertEquals(new UList<Object>(), UCborReader.parse(hex("9fff")));
+		final UList<Object> list = (UList<Object>)UCborReader.parse(hex("9f018202039f0405ffff"));
+		assertEquals(3, list.size());
+		assertEquals(UList.of(Object.class, 4L, 5L), list.get(2));
+		final UMap<String,Object> map = (UMap<String,Object>)UCborReader.parse(hex("bf61610161629f0203ffff"));
+		assertEquals(UList.of(Object.class, 2L, 3L), map.get("b"));
+	}
+
+	@Test
+	public void roundTrip() throws Exception {
+		final UMap<String,Object> map = UMap.of(String.class, Object.class, "name", "umpani", "n", -42L, "pi", 3.14159d, "ok", true,
+				"list", UList.of(Object.class, "a", 1L, UMap.of(String.class, Object.class, "x", 0.5d)));
+		final byte[] cbor = UCborWriter.toCbor(map);
+		final UCborReader reader = new UCborReader(new ByteArrayInputStream(cbor));
+		assertEquals(map, reader.next());
+		assertEquals(cbor.length, reader.getOffset());
+	}
+
+	@Test
+	public void invalid() throws Exception {
+		final String[] invalid = { "", "62c3", "0000", "ff", "1c", "62c328", "5f6161ff", "a1" };
+		for (final String hex : invalid) {
+			try {
+				UCborReader.parse(hex(hex));
+				fail("Expected an UCborException for "+hex);
+			} catch (UCborException e) {
+				// expected
+			}
+		}
+		try {
+			new UCborReader(new ByteArrayInputStream(hex("818181818101"))).setMaxDepth(4).next();
+			fail("Expected an UCborException");
+		} catch (UCborException e) {
+			assertEquals(4, e.offset);
+		}
+		try {
+			new UCborReader(new ByteArrayInputStream(hex("6449455446"))).setMaxLength(3).next();
+			fail("Expected an UCborException");
+		} catch (UCborException e) {
+			assertEquals(0, e.offset);
+		}
+	}
+}
@@ -0,0 +1,120 @@
+import static org.junit.Assert.*;
+
+import java.io.StringReader;
+import java.math.BigInteger;
+
+import org.junit.Test;
+
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+import com.umpani.util.exception.UJsonException;
+import com.umpani.util.json.UJsonReader;
+import com.umpani.util.json.UJsonWriter;
+
+@SuppressWarnings("unchecked")
+public class TJson {
+
+	@Test
+	public void writeValues() {
+		assertEquals("null", UJsonWriter.toJson(null));
+		assertEquals("true", UJsonWriter.toJson(Boolean.TRUE));
+		assertEquals("42", UJsonWriter.toJson(42));
+		assertEquals("1.5", UJsonWriter.toJson(1.5d));
+		assertEquals("null", UJsonWriter.toJson(Double.NaN));
+		assertEquals("\"a\\\"b\\\\c\\n\\u0001\"", UJsonWriter.toJson("a\"b\\c\n\u0001"));
+		assertEquals("[1,\"x\",[]]", UJsonWriter.toJson(UList.of(Object.class, 1L, "x", new UList<Object>())));
+		assertEquals("{\"a\":1}", UJsonWriter.toJson(UMap.of(String.class, Object.class, "a", 1L)));
+	}
+
+	@Test
+	public void writeStreaming() throws Exception {
+		final StringBuilder sb = new StringBuilder();
+		final UJsonWriter writer = new UJsonWriter(sb).setLineSeparated(true);
+		writer.beginObject().key("a").value(1L).key("b").beginArray().value(true).nullValue().endArray().endObject();
+		writer.beginObject().endObject();
+		assertEquals("{\"a\":1,\"b\":[true,null]}\n{}", sb.toString());
+		assertTrue(writer.isTopLevel());
+	}
+
+	@Test(expected=IllegalStateException.class)
+	public void writeValueWithoutKey() throws Exception {
+		new UJsonWriter(new StringBuilder()).beginObject().value(1L);
+	}
+
+	@Test
+	public void readValues() throws Exception {
+		assertNull(UJsonReader.parse("null"));
+		assertEquals(Boolean.FALSE, UJsonReader.parse(" false "));
+		assertEquals(Long.valueOf(-12), UJsonReader.parse("-12"));
+		assertEquals(Double.valueOf(1.25e2), UJsonReader.parse("1.25e2"));
+		assertEquals(new BigInteger("123456789012345678901234567890"), UJsonReader.parse("123456789012345678901234567890"));
+		assertEquals("a\"\u00e4\ud83d\ude00", UJsonReader.parse("\"a\\\"\\u00e4\\ud83d\\ude00\""));
+	}
+
+	@Test
+	public void roundTrip() throws Exception {
+		final String json = "{\"name\":\"umpani\",\"tags\":[\"a\",\"b\"],\"nested\":{\"x\":1,\"y\":2.5,\"z\":null}}";
+		final Object value = UJsonReader.parse(json);
+		assertTrue(value instanceof UMap);
+		final UMap<String,Object> map = (UMap<String,Object>)value;
+		assertEquals("umpani", map.getString("name"));
+		assertEquals(2, map.<UList<?>>getList("tags").size());
+		final UMap<String,Object> nested = map.getMap("nested");
+		assertEquals(1L, nested.getLong("x"));
+		assertEquals(2.5d, nested.getDouble("y"), 0d);
+		assertTrue(nested.containsKey("z"));
+		assertEquals(value, UJsonReader.parse(UJsonWriter.toJson(value)));
+	}
+
+	@Test
+	public void readMultipleValues() throws Exception {
+		final UJsonReader reader = new UJsonReader(new StringReader("{\"a\":1}\n{\"a\":2}\n\n[3]\n"));
+		assertTrue(reader.hasNext());
+		assertEquals(1L, ((UMap<String,Object>)reader.next()).getLong("a"));
+		assertEquals(2L, ((UMap<String,Object>)reader.next()).getLong("a"));
+		assertEquals(1, ((UList<?>)reader.next()).size());
+		assertFalse(reader.hasNext());
+		reader.close();
+	}
+
+	@Test
+	public void errorPosition() throws Exception {
+		try {
+			UJsonReader.parse("{\"a\":1,\n \"b\" 2}");
+			fail();
+		} catch (UJsonException e) {
+			assertEquals(2, e.line);
+			assertEquals(6, e.column);
+			assertEquals(13, e.offset);
+		}
+		try {
+			UJsonReader.parse("[1,2");
+			fail();
+		} catch (UJsonException e) {
+			assertEquals(1, e.line);
+			assertEquals(5, e.column);
+			assertEquals(4, e.offset);
+		}
+	}
+
+	@Test
+	public void limits() throws Exception {
+		try {
+			new UJsonReader(new StringReader("[[[1]]]")).setMaxDepth(2).next();
+			fail();
+		} catch (UJsonException e) {
+			assertEquals(3, e.column);
+		}
+		try {
+			new UJsonReader(new StringReader("\"abcdef\"")).setMaxStringLength(4).next();
+			fail();
+		} catch (UJsonException e) {
+			assertEquals(6, e.column);
+		}
+	}
+
+	@Test(expected=UJsonException.class)
+	public void invalidNumber() throws Exception {
+		UJsonReader.parse("01");
+	}
+}
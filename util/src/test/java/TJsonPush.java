@@ -0,0 +1,142 @@
+import static org.junit.Assert.*;
+
+import java.io.StringReader;
+import java.nio.ByteBuffer;
+import java.nio.charset.StandardCharsets;
+
+import org.junit.Test;
+
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+import com.umpani.util.exception.UJsonException;
+import com.umpani.util.json.UJsonCallback;
+import com.umpani.util.json.UJsonPushParser;
+import com.umpani.util.json.UJsonReader;
+
+@SuppressWarnings("unchecked")
+public class TJsonPush {
+	/**
+	 * A callback that collects all values.
+	 */
+	static class Collector implements UJsonCallback {
+		final UList<Object> values = new UList<Object>();
+
+		@Override
+		public void value( final Object value ) {
+			values.add(value);
+		}
+	}
+
+	/**
+	 * Feeds the given JSON byte by byte and returns the parsed values.
+	 */
+	private static UList<Object> parseBytewise( final String json ) throws Exception {
+		final Collector collector = new Collector();
+		final UJsonPushParser parser = new UJsonPushParser(collector);
+		for (final byte b : json.getBytes(StandardCharsets.UTF_8)) parser.feed(ByteBuffer.wrap(new byte[] { b }));
+		parser.finish();
+		return collector.values;
+	}
+
+	@Test
+	public void sameValuesAsReader() throws Exception {
+		final String[] docs = {
+			"null", "true", "-12", "0", "-0", "1.25e2", "3E-2", "123456789012345678901234567890", "9223372036854775807",
+			"\"a\\\"\\u00e4\\ud83d\\ude00\\n\"", "[]", "{}", "[1,[2,[3]],{\"a\":null}]",
+			"{\"name\":\"umpani\",\"tags\":[\"a\",\"b\"],\"nested\":{\"x\":1,\"y\":2.5,\"z\":null}}"
+		};
+		for (final String doc : docs) {
+			final UList<Object> values = parseBytewise(" "+doc+" ");
+			assertEquals(doc, 1, values.size());
+			assertEquals(doc, UJsonReader.parse(doc), values.get(0));
+		}
+	}
+
+	@Test
+	public void multiByteSplitAcrossBuffers() throws Exception {
+		final UList<Object> values = parseBytewise("{\"k\u00e4y\":\"\u20ac \ud83d\ude00\"}");
+		final UMap<String,Object> map = (UMap<String,Object>)values.get(0);
+		assertEquals("\u20ac \ud83d\ude00", map.getString("k\u00e4y"));
+	}
+
+	@Test
+	public void multipleValuesAndFinish() throws Exception {
+		final Collector collector = new Collector();
+		final UJsonPushParser parser = new UJsonPushParser(collector);
+		parser.feed(ByteBuffer.wrap("{\"a\":1}\n{\"a\"".getBytes(StandardCharsets.UTF_8)));
+		assertEquals(1, collector.values.size());
+		assertFalse(parser.isIdle());
+		parser.feed(ByteBuffer.wrap(":2}\n[3]\n42".getBytes(StandardCharsets.UTF_8)));
+		assertEquals(3, collector.values.size());
+		// the number may continue with the next chunk
+		parser.feed(ByteBuffer.wrap("0".getBytes(StandardCharsets.UTF_8)));
+		parser.finish();
+		assertEquals(4, collector.values.size());
+		assertEquals(2L, ((UMap<String,Object>)collector.values.get(1)).getLong("a"));
+		assertEquals(420L, collector.values.get(3));
+		assertTrue(parser.isIdle());
+	}
+
+	/**
+	 * Asserts that the reader and the push parser report the same error position.
+	 */
+	private static void assertSameError( final String json, final int maxDepth, final int maxStringLength ) throws Exception {
+		UJsonException expected = null;
+		try {
+			final UJsonReader reader = new UJsonReader(new StringReader(json)).setMaxDepth(maxDepth).setMaxStringLength(maxStringLength);
+			while (reader.hasNext()) reader.next();
+		} catch (UJsonException e) {
+			expected = e;
+		}
+		assertNotNull(json, expected);
+		try {
+			final UJsonPushParser parser = new UJsonPushParser(new Collector()).setMaxDepth(maxDepth).setMaxStringLength(maxStringLength);
+			for (final byte b : json.getBytes(StandardCharsets.UTF_8)) parser.feed(new byte[] { b }, 0, 1);
+			parser.finish();
+			fail(json);
+		} catch (UJsonException e) {
+			assertEquals(json, expected.getMessage(), e.getMessage());
+		}
+	}
+
+	@Test
+	public void sameErrorsAsReader() throws Exception {
+		final String[] docs = {
+			"{\"a\":1,\n \"b\" 2}", "[1,2", "[1 2]", "{\"a\":1,}", "[1,]", "-x", "-", "1.", "1.x", "1e", "1e+", "tru", "trux",
+			"\"abc", "\"a\\x\"", "\"\\u12g4\"", "\"a\u0001\"", "{1:2}", "]", "[01]", "{\"a\"\n:\n", "nul"
+		};
+		for (final String doc : docs) assertSameError(doc, 512, 1024);
+		assertSameError("[[[1]]]", 2, 1024);
+		assertSameError("\"abcdef\"", 512, 4);
+		assertSameError("[123456]", 512, 4);
+		assertSameError("-123456", 512, 4);
+	}
+
+	@Test
+	public void invalidUtf8() throws Exception {
+		final UJsonPushParser parser = new UJsonPushParser(new Collector());
+		try {
+			parser.feed(new byte[] { '"', 'a', (byte)0xc3, 'b' }, 0, 4);
+			fail();
+		} catch (UJsonException e) {
+			assertEquals(3, e.column);
+		}
+		// the parser stays failed until it is reset
+		try {
+			parser.feed(new byte[] { '1' }, 0, 1);
+			fail();
+		} catch (UJsonException e) {
+			// expected
+		}
+		parser.reset();
+		parser.feed(new byte[] { '1', ' ' }, 0, 2);
+		// overlong encoding of '/'
+		parser.reset();
+		try {
+			parser.feed(new byte[] { (byte)0xc0, (byte)0xaf }, 0, 2);
+			fail();
+		} catch (UJsonException e) {
+			assertEquals(0, e.offset);
+		}
+	}
+}
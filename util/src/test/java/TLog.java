@@ -0,0 +1,252 @@
+import static org.junit.Assert.*;
+
+import java.io.File;
+import java.io.IOException;
+import java.util.concurrent.CountDownLatch;
+import java.util.concurrent.atomic.AtomicInteger;
+
+import org.junit.Rule;
+import org.junit.Test;
+import org.junit.rules.TemporaryFolder;
+
+import com.umpani.util.UList;
+import com.umpani.util.UMap;
+import com.umpani.util.log.UAsyncLogSink;
+import com.umpani.util.log.ULogContext;
+import com.umpani.util.log.ULogDropPolicy;
+import com.umpani.util.log.ULogEvent;
+import com.umpani.util.log.ULogFileWriter;
+import com.umpani.util.log.ULogLevel;
+import com.umpani.util.log.ULogReader;
+import com.umpani.util.log.ULogSink;
+import com.umpani.util.log.ULogger;
+
+public class TLog {
+	@Rule
+	public TemporaryFolder folder = new TemporaryFolder();
+
+	/**
+	 * A sink that collects all events.
+	 */
+	static class CollectingSink implements ULogSink {
+		final UList<ULogEvent> events = new UList<ULogEvent>();
+
+		@Override
+		public synchronized void append( final ULogEvent event ) {
+			events.add(event);
+		}
+
+		@Override
+		public void flush() {}
+	}
+
+	@Test
+	public void eventFields() {
+		final CollectingSink sink = new CollectingSink();
+		final ULogger logger = new ULogger("test", sink);
+		logger.debug("not logged");
+		logger.warn("hello", "user", "alex", "count", 3, new IOException("boom"));
+		assertEquals(1, sink.events.size());
+		final ULogEvent event = sink.events.get(0);
+		assertEquals(ULogLevel.WARN, event.getLevel());
+		assertEquals("hello", event.getMessage());
+		assertEquals("test", event.getString(ULogEvent.LOGGER));
+		assertEquals("alex", event.getString("user"));
+		assertEquals(3L, event.getLong("count"));
+		assertTrue(event.getTimestamp() > 0);
+		final UMap<String,Object> error = event.getMap(ULogEvent.ERROR);
+		assertEquals("java.io.IOException", error.getString("type"));
+		assertEquals("boom", error.getString("message"));
+		assertTrue(event.isReadOnly());
+	}
+
+	@Test
+	public void contextLayers() {
+		final CollectingSink sink = new CollectingSink();
+		final ULogger logger = new ULogger("test", sink);
+		try (ULogContext.Scope outer = ULogContext.push("requestId", "r1", "user", "a")) {
+			try (ULogContext.Scope inner = ULogContext.push("user", "b")) {
+				assertEquals("b", ULogContext.current().get("user"));
+				logger.info("inner");
+			}
+			assertEquals("a", ULogContext.current().get("user"));
+			logger.info("outer", "user", "c");
+		}
+		assertEquals(0, ULogContext.current().depth());
+		logger.info("none");
+
+		assertEquals("r1", sink.events.get(0).getString("requestId"));
+		assertEquals("b", sink.events.get(0).getString("user"));
+		assertEquals("r1", sink.events.get(1).getString("requestId"));
+		assertEquals("c", sink.events.get(1).getString("user"));
+		assertFalse(sink.events.get(2).containsKey("requestId"));
+	}
+
+	@Test
+	public void writeAndReadRotatedFiles() throws Exception {
+		final File file = new File(folder.getRoot(), "logs/app.log");
+		final ULogFileWriter writer = new ULogFileWriter(file, 512, 3);
+		final ULogger logger = new ULogger("file", writer);
+		for (int i=0; i < 20; i++) logger.info("message", "i", i, "text", "line\nbreak \"quoted\"");
+		writer.close();
+
+		assertTrue(file.length() <= 512);
+		assertTrue(writer.rotatedFile(3).isFile());
+		assertFalse(writer.rotatedFile(4).isFile());
+
+		final UList<UMap<String,Object>> current = ULogReader.readAll(file);
+		assertFalse(current.isEmpty());
+		assertEquals(19L, current.get(current.size()-1).getLong("i"));
+
+		final UList<UMap<String,Object>> all = ULogReader.readRotated(file, 3);
+		assertTrue(all.size() < 20);
+		long i = 20 - all.size();
+		for (final UMap<String,Object> event : all) {
+			assertEquals(i++, event.getLong("i"));
+			assertEquals("line\nbreak \"quoted\"", event.getString("text"));
+			assertEquals("INFO", event.getString(ULogEvent.LEVEL));
+		}
+	}
+
+	@Test
+	public void defaultSink() throws Exception {
+		final ULogger logger = new ULogger("default");
+		final ULogSink previous = ULogger.getDefaultSink();
+		final CollectingSink target = new CollectingSink();
+		ULogger.setDefaultSink(target);
+		try {
+			// the logger was created before, but appends to the new default sink
+			logger.warn("replaced", "i", 1);
+			assertEquals(1, target.events.size());
+			assertEquals("replaced", target.events.get(0).getMessage());
+		} finally {
+			ULogger.setDefaultSink(previous);
+		}
+	}
+
+	@Test
+	public void asyncWrite() throws Exception {
+		final File file = new File(folder.getRoot(), "async.log");
+		final UAsyncLogSink sink = new UAsyncLogSink(new ULogFileWriter(file, 0, 0), 1024, ULogDropPolicy.BLOCK);
+		final ULogger logger = new ULogger("async", sink);
+		for (int i=0; i < 100; i++) logger.info("message", "i", i);
+		sink.flush();
+		assertEquals(100, ULogReader.readAll(file).size());
+		sink.close();
+		assertEquals(0L, sink.getDropped());
+	}
+
+	@Test
+	public void asyncDropNewest() throws Exception {
+		final CountDownLatch blocked = new CountDownLatch(1);
+		final CountDownLatch release = new CountDownLatch(1);
+		final CollectingSink target = new CollectingSink() {
+			@Override
+			public synchronized void append( final ULogEvent event ) {
+				super.append(event);
+				blocked.countDown();
+				try {
+					release.await();
+				} catch (InterruptedException e) {
+					Thread.currentThread().interrupt();
+				}
+			}
+		};
+		final UAsyncLogSink sink = new UAsyncLogSink(target, 2, ULogDropPolicy.DROP_NEWEST);
+		final ULogger logger = new ULogger("drop", sink);
+		logger.info("first");
+		blocked.await();
+		// the writer thread blocks in the target, so only two further events fit into the queue
+		for (int i=0; i < 5; i++) logger.info("queued", "i", i);
+		assertEquals(3L, sink.getDropped());
+		release.countDown();
+		sink.close();
+		assertEquals(3, target.events.size());
+		assertEquals(1L, target.events.get(2).getLong("i"));
+	}
+
+	@Test
+	public void asyncCloseWhileAppending() throws Exception {
+		for (int round=0; round < 20; round++) {
+			final CollectingSink target = new CollectingSink();
+			final UAsyncLogSink sink = new UAsyncLogSink(target, 16, ULogDropPolicy.BLOCK);
+			final ULogger logger = new ULogger("close", sink);
+			final AtomicInteger appended = new AtomicInteger();
+			final Thread[] threads = new Thread[4];
+			for (int t=0; t < threads.length; t++) {
+				threads[t] = new Thread() {
+					@Override
+					public void run() {
+						for (int i=0; i < 1000; i++) {
+							logger.info("event", "i", i);
+							appended.incrementAndGet();
+						}
+					}
+				};
+				threads[t].start();
+			}
+			sink.close();
+			for (final Thread thread : threads) thread.join(5000);
+			// every event is either written or counted as dropped
+			assertEquals(appended.get(), target.events.size() + sink.getDropped());
+		}
+	}
+
+	@Test
+	public void asyncDropOldestKeepsSignals() throws Exception {
+		final CountDownLatch blocked = new CountDownLatch(1);
+		final CountDownLatch release = new CountDownLatch(1);
+		final CollectingSink target = new CollectingSink() {
+			@Override
+			public synchronized void append( final ULogEvent event ) {
+				super.append(event);
+				blocked.countDown();
+				try {
+					release.await();
+				} catch (InterruptedException e) {
+					Thread.currentThread().interrupt();
+				}
+			}
+		};
+		final UAsyncLogSink sink = new UAsyncLogSink(target, 2, ULogDropPolicy.DROP_OLDEST);
+		final ULogger logger = new ULogger("drop", sink);
+		logger.info("first");
+		blocked.await();
+		logger.info("queued", "i", 0);
+		final Thread flusher = new Thread() {
+			@Override
+			public void run() {
+				try {
+					sink.flush();
+				} catch (IOException e) {
+					throw new IllegalStateException(e);
+				}
+			}
+		};
+		flusher.start();
+		while (sink.getQueued() < 2) Thread.sleep(1);
+		// the queue is full, only the events are dropped, never the flush request
+		for (int i=1; i < 4; i++) logger.info("queued", "i", i);
+		assertEquals(3L, sink.getDropped());
+		flusher.join(100);
+		assertTrue(flusher.isAlive());
+		final Thread closer = new Thread() {
+			@Override
+			public void run() {
+				try {
+					sink.close();
+				} catch (IOException e) {
+					throw new IllegalStateException(e);
+				}
+			}
+		};
+		closer.start();
+		release.countDown();
+		closer.join(5000);
+		assertFalse(closer.isAlive());
+		flusher.join(5000);
+		assertFalse(flusher.isAlive());
+		assertEquals(2, target.events.size());
+		assertEquals(3L, target.events.get(1).getLong("i"));
+	}
+}